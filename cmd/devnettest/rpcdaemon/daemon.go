@@ -31,7 +31,7 @@ func RunDaemon() {
 		}
 
 		apiList := commands.APIList(db, borDb, backend, txPool, mining, starknet, ff, stateCache, blockReader, agg, txNums, *cfg)
-		if err := cli.StartRpcServer(ctx, *cfg, apiList, nil); err != nil {
+		if err := cli.StartRpcServer(ctx, *cfg, apiList, nil, nil); err != nil {
 			log.Error(err.Error())
 			return nil
 		}
@@ -12,6 +12,7 @@ import (
 	"github.com/anacrolix/torrent"
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/anacrolix/torrent/storage"
+	"github.com/c2h5oh/datasize"
 	common2 "github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
@@ -36,6 +37,8 @@ type Downloader struct {
 	stats     AggStats
 
 	folder storage.ClientImplCloser
+
+	scheduledRates *downloadercfg.RateScheduleEntry // last applied entry of cfg.RateSchedule, accessed only by MainLoop
 }
 
 type AggStats struct {
@@ -100,6 +103,22 @@ func New(cfg *downloadercfg.Cfg) (*Downloader, error) {
 	return d, nil
 }
 
+// SetRateLimits - changes download and upload rates without restart
+func (d *Downloader) SetRateLimits(downloadRate, uploadRate datasize.ByteSize) {
+	d.cfg.SetRateLimits(downloadRate, uploadRate)
+	log.Info("[torrent] Rate limits", "download", downloadRate.String(), "upload", uploadRate.String())
+}
+
+// applyRateSchedule - sets rates of cfg.RateSchedule, if they changed since last call
+func (d *Downloader) applyRateSchedule(now time.Time) {
+	e, ok := d.cfg.RateSchedule.At(now)
+	if !ok || (d.scheduledRates != nil && *d.scheduledRates == e) {
+		return
+	}
+	d.scheduledRates = &e
+	d.SetRateLimits(e.DownloadRate, e.UploadRate)
+}
+
 func (d *Downloader) SnapDir() string {
 	d.clientLock.RLock()
 	defer d.clientLock.RUnlock()
@@ -237,7 +256,7 @@ func (d *Downloader) addSegments() error {
 		wg.Add(1)
 		go func(f string) {
 			defer wg.Done()
-			_, err := AddSegment(f, d.cfg.DataDir, d.torrentClient)
+			_, err := AddSegment(f, d.cfg.DataDir, d.torrentClient, d.cfg.WebSeeds)
 			if err != nil {
 				log.Warn("[snapshots] AddSegment", "err", err)
 				return
@@ -335,7 +354,7 @@ func MainLoop(ctx context.Context, d *Downloader, silent bool) {
 			torrents := d.Torrent().Torrents()
 			for _, t := range torrents {
 				<-t.GotInfo()
-				if t.Complete.Bool() {
+				if t.Complete.Bool() || d.cfg.SeedOnly {
 					continue
 				}
 				if err := sem.Acquire(ctx, 1); err != nil {
@@ -362,12 +381,18 @@ func MainLoop(ctx context.Context, d *Downloader, silent bool) {
 	statInterval := 20 * time.Second
 	statEvery := time.NewTicker(statInterval)
 	defer statEvery.Stop()
+
+	d.applyRateSchedule(time.Now())
+	scheduleEvery := time.NewTicker(time.Minute)
+	defer scheduleEvery.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-statEvery.C:
 			d.ReCalcStats(statInterval)
+		case now := <-scheduleEvery.C:
+			d.applyRateSchedule(now)
 
 		case <-logEvery.C:
 			if silent {
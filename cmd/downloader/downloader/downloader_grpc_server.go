@@ -34,6 +34,7 @@ func (s *GrpcServer) Download(ctx context.Context, request *proto_downloader.Dow
 
 	torrentClient := s.d.Torrent()
 	snapDir := s.d.SnapDir()
+	webSeeds := s.d.cfg.WebSeeds
 	for i, it := range request.Items {
 		select {
 		case <-logEvery.C:
@@ -44,7 +45,7 @@ func (s *GrpcServer) Download(ctx context.Context, request *proto_downloader.Dow
 		if it.TorrentHash == nil {
 			// if we dont have the torrent hash then we seed a new snapshot
 			log.Info("[snapshots] seeding a new snapshot")
-			ok, err := seedNewSnapshot(it, torrentClient, snapDir)
+			ok, err := seedNewSnapshot(it, torrentClient, snapDir, webSeeds)
 			if err != nil {
 				return nil, err
 			}
@@ -56,7 +57,11 @@ func (s *GrpcServer) Download(ctx context.Context, request *proto_downloader.Dow
 			continue
 		}
 
-		_, err := createMagnetLinkWithInfoHash(it.TorrentHash, torrentClient, snapDir)
+		if s.d.cfg.SeedOnly {
+			log.Warn("[snapshots] seed-only mode, skip download", "hash", Proto2InfoHash(it.TorrentHash))
+			continue
+		}
+		_, err := createMagnetLinkWithInfoHash(it.TorrentHash, torrentClient, snapDir, webSeeds)
 		if err != nil {
 			return nil, err
 		}
@@ -99,14 +104,14 @@ func Proto2InfoHash(in *prototypes.H160) metainfo.Hash {
 // decides what we do depending on wether we have the .seg file or the .torrent file
 // have .torrent no .seg => get .seg file from .torrent
 // have .seg no .torrent => get .torrent from .seg
-func seedNewSnapshot(it *proto_downloader.DownloadItem, torrentClient *torrent.Client, snapDir string) (bool, error) {
+func seedNewSnapshot(it *proto_downloader.DownloadItem, torrentClient *torrent.Client, snapDir string, webSeeds []string) (bool, error) {
 	// if we dont have the torrent file we build it if we have the .seg file
 	if err := BuildTorrentFileIfNeed(it.Path, snapDir); err != nil {
 		return false, err
 	}
 
 	// we add the .seg file we have and create the .torrent file if we dont have it
-	ok, err := AddSegment(it.Path, snapDir, torrentClient)
+	ok, err := AddSegment(it.Path, snapDir, torrentClient, webSeeds)
 	if err != nil {
 		return false, fmt.Errorf("AddSegment: %w", err)
 	}
@@ -121,7 +126,7 @@ func seedNewSnapshot(it *proto_downloader.DownloadItem, torrentClient *torrent.C
 }
 
 // we dont have .seg or .torrent so we get them through the torrent hash
-func createMagnetLinkWithInfoHash(hash *prototypes.H160, torrentClient *torrent.Client, snapDir string) (bool, error) {
+func createMagnetLinkWithInfoHash(hash *prototypes.H160, torrentClient *torrent.Client, snapDir string, webSeeds []string) (bool, error) {
 	mi := &metainfo.MetaInfo{AnnounceList: Trackers}
 	if hash == nil {
 		return false, nil
@@ -141,6 +146,8 @@ func createMagnetLinkWithInfoHash(hash *prototypes.H160, torrentClient *torrent.
 			log.Warn("[downloader] add magnet link", "err", err)
 			return
 		}
+		// metadata comes from peers only, but then pieces can be downloaded from webseeds too
+		t.AddWebSeeds(webSeeds)
 		t.DisallowDataDownload()
 		t.AllowDataUpload()
 		<-t.GotInfo()
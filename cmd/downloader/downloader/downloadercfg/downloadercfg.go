@@ -3,6 +3,7 @@ package downloadercfg
 import (
 	"fmt"
 	"net"
+	"net/url"
 	"strings"
 
 	lg "github.com/anacrolix/log"
@@ -25,6 +26,9 @@ const DefaultNetworkChunkSize = 1 * 1024 * 1024
 type Cfg struct {
 	*torrent.ClientConfig
 	DownloadSlots int
+	WebSeeds      []string // base urls of http(s) servers with the .seg files, see ParseWebSeeds
+	SeedOnly      bool     // seed files which are already downloaded, but don't download anything
+	RateSchedule  RateSchedule
 }
 
 func Default() *torrent.ClientConfig {
@@ -53,7 +57,11 @@ func Default() *torrent.ClientConfig {
 	return torrentConfig
 }
 
-func New(snapDir string, verbosity lg.Level, dbg bool, natif nat.Interface, downloadRate, uploadRate datasize.ByteSize, port, connsPerFile, downloadSlots int) (*Cfg, error) {
+func New(snapDir string, verbosity lg.Level, dbg bool, natif nat.Interface, downloadRate, uploadRate datasize.ByteSize, port, connsPerFile, downloadSlots int, webSeeds []string) (*Cfg, error) {
+	webSeeds, err := ParseWebSeeds(webSeeds)
+	if err != nil {
+		return nil, err
+	}
 	torrentConfig := Default()
 	// We would-like to reduce amount of goroutines in Erigon, so reducing next params
 	torrentConfig.EstablishedConnsPerTorrent = connsPerFile // default: 50
@@ -102,20 +110,57 @@ func New(snapDir string, verbosity lg.Level, dbg bool, natif nat.Interface, down
 			log.Info("[torrent] Public IP", "ip", ip)
 		}
 	}
+	// own limiters - to change them at runtime, see SetRateLimits
+	torrentConfig.UploadRateLimiter = rate.NewLimiter(rate.Inf, 0)
+	torrentConfig.DownloadRateLimiter = rate.NewLimiter(rate.Inf, 0)
+	setRateLimits(torrentConfig, downloadRate, uploadRate)
+
+	// debug
+	//	torrentConfig.Debug = false
+	torrentConfig.Logger = lg.Default.FilterLevel(verbosity)
+	torrentConfig.Logger.Handlers = []lg.Handler{adapterHandler{}}
+
+	return &Cfg{ClientConfig: torrentConfig, DownloadSlots: downloadSlots, WebSeeds: webSeeds}, nil
+}
+
+// SetRateLimits - changes rates of running torrent client
+func (c *Cfg) SetRateLimits(downloadRate, uploadRate datasize.ByteSize) {
+	setRateLimits(c.ClientConfig, downloadRate, uploadRate)
+}
+
+func setRateLimits(torrentConfig *torrent.ClientConfig, downloadRate, uploadRate datasize.ByteSize) {
 	// rates are divided by 2 - I don't know why it works, maybe bug inside torrent lib accounting
-	torrentConfig.UploadRateLimiter = rate.NewLimiter(rate.Limit(uploadRate.Bytes()), 2*DefaultNetworkChunkSize) // default: unlimited
+	torrentConfig.UploadRateLimiter.SetLimit(rate.Limit(uploadRate.Bytes()))
+	torrentConfig.UploadRateLimiter.SetBurst(2 * DefaultNetworkChunkSize)
 	if downloadRate.Bytes() < 500_000_000 {
 		b := 2 * DefaultNetworkChunkSize
 		if downloadRate.Bytes() > DefaultNetworkChunkSize {
 			b = int(2 * downloadRate.Bytes())
 		}
-		torrentConfig.DownloadRateLimiter = rate.NewLimiter(rate.Limit(downloadRate.Bytes()), b) // default: unlimited
+		torrentConfig.DownloadRateLimiter.SetLimit(rate.Limit(downloadRate.Bytes()))
+		torrentConfig.DownloadRateLimiter.SetBurst(b)
+	} else {
+		torrentConfig.DownloadRateLimiter.SetLimit(rate.Inf) // unlimited
 	}
+}
 
-	// debug
-	//	torrentConfig.Debug = false
-	torrentConfig.Logger = lg.Default.FilterLevel(verbosity)
-	torrentConfig.Logger.Handlers = []lg.Handler{adapterHandler{}}
-
-	return &Cfg{ClientConfig: torrentConfig, DownloadSlots: downloadSlots}, nil
+// ParseWebSeeds - checks http(s) urls of webseeds (BEP-19) and adds trailing slash to them: then torrent lib will
+// download file by url <webseed>/<file name> - so one url serves all .seg files of the network. Downloaded pieces
+// are checked by hashes from .torrent file - same as pieces downloaded from peers - and both sources work in parallel
+func ParseWebSeeds(in []string) ([]string, error) {
+	webSeeds := make([]string, 0, len(in))
+	for _, s := range in {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("webseed %s: %w", s, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webseed %s: expected http(s) url", s)
+		}
+		if !strings.HasSuffix(u.Path, "/") {
+			u.Path += "/"
+		}
+		webSeeds = append(webSeeds, u.String())
+	}
+	return webSeeds, nil
 }
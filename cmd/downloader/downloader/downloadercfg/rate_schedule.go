@@ -0,0 +1,75 @@
+package downloadercfg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+)
+
+// RateScheduleEntry - rates which apply from given time of day until next entry
+type RateScheduleEntry struct {
+	From         time.Duration // since midnight, local time
+	DownloadRate datasize.ByteSize
+	UploadRate   datasize.ByteSize
+}
+
+// RateSchedule - rates changing by time of day, sorted by From
+type RateSchedule []RateScheduleEntry
+
+// ParseRateSchedule - parses comma separated list of `<HH:MM>=<download rate>/<upload rate>`, for example
+// "01:00=512mb/128mb,07:00=16mb/4mb" - full speed at night. Rates of last entry apply until first entry of next day.
+// Empty string - no schedule
+func ParseRateSchedule(s string) (RateSchedule, error) {
+	var schedule RateSchedule
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		at, rates, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("rate schedule %q: expected <HH:MM>=<download rate>/<upload rate>", item)
+		}
+		t, err := time.Parse("15:04", strings.TrimSpace(at))
+		if err != nil {
+			return nil, fmt.Errorf("rate schedule %q: %w", item, err)
+		}
+		download, upload, ok := strings.Cut(rates, "/")
+		if !ok {
+			return nil, fmt.Errorf("rate schedule %q: expected <download rate>/<upload rate>", item)
+		}
+		e := RateScheduleEntry{From: time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute}
+		if err := e.DownloadRate.UnmarshalText([]byte(strings.TrimSpace(download))); err != nil {
+			return nil, fmt.Errorf("rate schedule %q: %w", item, err)
+		}
+		if err := e.UploadRate.UnmarshalText([]byte(strings.TrimSpace(upload))); err != nil {
+			return nil, fmt.Errorf("rate schedule %q: %w", item, err)
+		}
+		schedule = append(schedule, e)
+	}
+	sort.Slice(schedule, func(i, j int) bool { return schedule[i].From < schedule[j].From })
+	for i := 1; i < len(schedule); i++ {
+		if schedule[i].From == schedule[i-1].From {
+			return nil, fmt.Errorf("rate schedule: time %s used twice", schedule[i].From)
+		}
+	}
+	return schedule, nil
+}
+
+// At - rates at given time, false if schedule is empty
+func (s RateSchedule) At(t time.Time) (e RateScheduleEntry, ok bool) {
+	if len(s) == 0 {
+		return e, false
+	}
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	e = s[len(s)-1]
+	for _, entry := range s {
+		if entry.From > sinceMidnight {
+			break
+		}
+		e = entry
+	}
+	return e, true
+}
@@ -0,0 +1,36 @@
+package downloadercfg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateSchedule(t *testing.T) {
+	s, err := ParseRateSchedule("07:00=16mb/4mb, 01:00=512mb/128mb")
+	require.NoError(t, err)
+	require.Len(t, s, 2)
+
+	at := func(hour, minute int) RateScheduleEntry {
+		e, ok := s.At(time.Date(2022, 8, 1, hour, minute, 0, 0, time.Local))
+		require.True(t, ok)
+		return e
+	}
+	require.Equal(t, 512*datasize.MB, at(1, 0).DownloadRate)
+	require.Equal(t, 128*datasize.MB, at(6, 59).UploadRate)
+	require.Equal(t, 16*datasize.MB, at(7, 0).DownloadRate)
+	require.Equal(t, 4*datasize.MB, at(23, 59).UploadRate)
+	require.Equal(t, 16*datasize.MB, at(0, 30).DownloadRate) // last entry of previous day
+
+	s, err = ParseRateSchedule("")
+	require.NoError(t, err)
+	_, ok := s.At(time.Now())
+	require.False(t, ok)
+
+	for _, invalid := range []string{"7=16mb/4mb", "07:00=16mb", "07:00", "07:00=16xb/4mb", "07:00=1mb/1mb,07:00=2mb/2mb"} {
+		_, err = ParseRateSchedule(invalid)
+		require.Error(t, err, invalid)
+	}
+}
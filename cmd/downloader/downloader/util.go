@@ -74,6 +74,8 @@ func AllTorrentFiles(dir string) ([]string, error) {
 	}
 	return res, nil
 }
+
+// seedableSegmentFiles - full segments, except receipts, which every node produces for itself after execution
 func seedableSegmentFiles(dir string) ([]string, error) {
 	files, err := os.ReadDir(dir)
 	if err != nil {
@@ -98,7 +100,7 @@ func seedableSegmentFiles(dir string) ([]string, error) {
 		if err != nil {
 			return nil, fmt.Errorf("ParseFileName: %w", err)
 		}
-		if !ff.Seedable() {
+		if !ff.Seedable() || ff.T == snap.Receipts {
 			continue
 		}
 		res = append(res, f.Name())
@@ -112,7 +114,7 @@ func BuildTorrentFileIfNeed(originalFileName, root string) (err error) {
 	if err != nil {
 		return fmt.Errorf("ParseFileName: %w", err)
 	}
-	if !f.NeedTorrentFile() {
+	if !f.NeedTorrentFile() || f.T == snap.Receipts {
 		return nil
 	}
 	if err := createTorrentFileFromSegment(f, nil); err != nil {
@@ -132,7 +134,7 @@ func createTorrentFileFromSegment(f snap.FileInfo, mi *metainfo.MetaInfo) error
 }
 
 // AddSegment - add existing .seg file, create corresponding .torrent if need
-func AddSegment(originalFileName, snapDir string, client *torrent.Client) (bool, error) {
+func AddSegment(originalFileName, snapDir string, client *torrent.Client, webSeeds []string) (bool, error) {
 	f, err := snap.ParseFileName(snapDir, originalFileName)
 	if err != nil {
 		return false, fmt.Errorf("ParseFileName: %w", err)
@@ -140,7 +142,7 @@ func AddSegment(originalFileName, snapDir string, client *torrent.Client) (bool,
 	if !f.TorrentFileExists() {
 		return false, nil
 	}
-	_, err = AddTorrentFile(f.Path+".torrent", client)
+	_, err = AddTorrentFile(f.Path+".torrent", client, webSeeds)
 	if err != nil {
 		return false, fmt.Errorf("AddTorrentFile: %w", err)
 	}
@@ -268,7 +270,7 @@ func verifyTorrent(info *metainfo.Info, root string, consumer func(i int, good b
 			return err
 		}
 		if int64(len(mm)) != file.Length {
-			return fmt.Errorf("file %q has wrong length", filename)
+			return fmt.Errorf("file %q: %w", filename, errWrongLength)
 		}
 		span.Append(mm)
 	}
@@ -292,7 +294,8 @@ func verifyTorrent(info *metainfo.Info, root string, consumer func(i int, good b
 // added first time - pieces verification process will start (disk IO heavy) - Progress
 // kept in `piece completion storage` (surviving reboot). Once it done - no disk IO needed again.
 // Don't need call torrent.VerifyData manually
-func AddTorrentFile(torrentFilePath string, torrentClient *torrent.Client) (*torrent.Torrent, error) {
+// webSeeds - http(s) sources of the file in addition to peers, see downloadercfg.ParseWebSeeds
+func AddTorrentFile(torrentFilePath string, torrentClient *torrent.Client, webSeeds []string) (*torrent.Torrent, error) {
 	mi, err := metainfo.LoadFromFile(torrentFilePath)
 	if err != nil {
 		return nil, err
@@ -309,6 +312,7 @@ func AddTorrentFile(torrentFilePath string, torrentClient *torrent.Client) (*tor
 		ts.ChunkSize = 0
 	}
 
+	ts.Webseeds = append(ts.Webseeds, webSeeds...)
 	ts.DisallowDataDownload = true
 	t, _, err := torrentClient.AddTorrentSpec(ts)
 	if err != nil {
@@ -320,44 +324,57 @@ func AddTorrentFile(torrentFilePath string, torrentClient *torrent.Client) (*tor
 }
 
 var ErrSkip = fmt.Errorf("skip")
+var errWrongLength = fmt.Errorf("wrong length")
 
 func VerifyDtaFiles(ctx context.Context, snapDir string) error {
+	broken, err := BrokenDataFiles(ctx, snapDir)
+	if err != nil {
+		return err
+	}
+	if len(broken) > 0 {
+		return fmt.Errorf("not all files are valid")
+	}
+	log.Info("[Snapshots] Verify done")
+	return nil
+}
+
+// BrokenDataFiles - checks hashes of pieces of files which have .torrent file, returns names of files with wrong hash
+// or length. Files which are not downloaded yet are skipped
+func BrokenDataFiles(ctx context.Context, snapDir string) (broken []string, err error) {
 	logEvery := time.NewTicker(5 * time.Second)
 	defer logEvery.Stop()
 
 	files, err := AllTorrentPaths(snapDir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	totalPieces := 0
 	for _, f := range files {
 		metaInfo, err := metainfo.LoadFromFile(f)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		info, err := metaInfo.UnmarshalInfo()
 		if err != nil {
-			return err
+			return nil, err
 		}
 		totalPieces += info.NumPieces()
 	}
 
 	j := 0
-	failsAmount := 0
 	for _, f := range files {
 		metaInfo, err := metainfo.LoadFromFile(f)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		info, err := metaInfo.UnmarshalInfo()
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		if err = verifyTorrent(&info, snapDir, func(i int, good bool) error {
 			j++
 			if !good {
-				failsAmount++
 				log.Error("[Snapshots] Verify hash mismatch", "at piece", i, "file", info.Name)
 				return ErrSkip
 			}
@@ -370,17 +387,17 @@ func VerifyDtaFiles(ctx context.Context, snapDir string) error {
 			}
 			return nil
 		}); err != nil {
-			if errors.Is(ErrSkip, err) {
+			if errors.Is(err, ErrSkip) || errors.Is(err, errWrongLength) {
+				broken = append(broken, info.Name)
 				continue
 			}
-			return err
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
 		}
 	}
-	if failsAmount > 0 {
-		return fmt.Errorf("not all files are valid")
-	}
-	log.Info("[Snapshots] Verify done")
-	return nil
+	return broken, nil
 }
 
 func portMustBeTCPAndUDPOpen(port int) error {
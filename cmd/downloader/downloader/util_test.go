@@ -0,0 +1,29 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync/snap"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeedableSegmentFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		snap.SegmentFileName(0, 500_000, snap.Headers),
+		snap.SegmentFileName(0, 500_000, snap.Receipts),
+		snap.SegmentFileName(500_000, 501_000, snap.Headers),
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte{1}, 0644))
+	}
+	files, err := seedableSegmentFiles(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{snap.SegmentFileName(0, 500_000, snap.Headers)}, files)
+
+	// Torrent is not created for the receipts
+	require.NoError(t, BuildTorrentFileIfNeed(snap.SegmentFileName(0, 500_000, snap.Receipts), dir))
+	_, err = os.Stat(filepath.Join(dir, snap.SegmentFileName(0, 500_000, snap.Receipts)+".torrent"))
+	require.True(t, os.IsNotExist(err))
+}
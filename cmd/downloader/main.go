@@ -44,6 +44,9 @@ var (
 	torrentPort                    int
 	torrentMaxPeers                int
 	torrentConnsPerFile            int
+	torrentWebSeeds                string
+	torrentRateSchedule            string
+	seedOnly                       bool
 	targetFile                     string
 )
 
@@ -62,6 +65,9 @@ func init() {
 	rootCmd.Flags().IntVar(&torrentMaxPeers, "torrent.maxpeers", utils.TorrentMaxPeersFlag.Value, utils.TorrentMaxPeersFlag.Usage)
 	rootCmd.Flags().IntVar(&torrentConnsPerFile, "torrent.conns.perfile", utils.TorrentConnsPerFileFlag.Value, utils.TorrentConnsPerFileFlag.Usage)
 	rootCmd.Flags().IntVar(&torrentDownloadSlots, "torrent.download.slots", utils.TorrentDownloadSlotsFlag.Value, utils.TorrentDownloadSlotsFlag.Usage)
+	rootCmd.Flags().BoolVar(&seedOnly, "seed.only", false, "only seed files which are already downloaded, don't download new files. Use --torrent.upload.rate and --torrent.conns.perfile to limit bandwidth and connections")
+	rootCmd.Flags().StringVar(&torrentRateSchedule, "torrent.rate.schedule", utils.TorrentRateScheduleFlag.Value, utils.TorrentRateScheduleFlag.Usage)
+	rootCmd.Flags().StringVar(&torrentWebSeeds, "torrent.webseeds", utils.TorrentWebSeedsFlag.Value, utils.TorrentWebSeedsFlag.Usage)
 
 	withDataDir(printTorrentHashes)
 	printTorrentHashes.PersistentFlags().BoolVar(&forceRebuild, "rebuild", false, "Force re-create .torrent files")
@@ -127,16 +133,20 @@ func Downloader(ctx context.Context) error {
 		return err
 	}
 
-	log.Info("Run snapshot downloader", "addr", downloaderApiAddr, "datadir", dirs.DataDir, "download.rate", downloadRate.String(), "upload.rate", uploadRate.String())
+	log.Info("Run snapshot downloader", "addr", downloaderApiAddr, "datadir", dirs.DataDir, "download.rate", downloadRate.String(), "upload.rate", uploadRate.String(), "seed.only", seedOnly)
 	natif, err := nat.Parse(natSetting)
 	if err != nil {
 		return fmt.Errorf("invalid nat option %s: %w", natSetting, err)
 	}
 
-	cfg, err := downloadercfg.New(dirs.Snap, torrentLogLevel, dbg, natif, downloadRate, uploadRate, torrentPort, torrentConnsPerFile, torrentDownloadSlots)
+	cfg, err := downloadercfg.New(dirs.Snap, torrentLogLevel, dbg, natif, downloadRate, uploadRate, torrentPort, torrentConnsPerFile, torrentDownloadSlots, utils.SplitAndTrim(torrentWebSeeds))
 	if err != nil {
 		return err
 	}
+	cfg.SeedOnly = seedOnly
+	if cfg.RateSchedule, err = downloadercfg.ParseRateSchedule(torrentRateSchedule); err != nil {
+		return err
+	}
 
 	d, err := downloader.New(cfg)
 	if err != nil {
@@ -6,6 +6,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"math/big"
 	"net"
 	"net/http"
 	"os"
@@ -63,7 +64,8 @@ var rootCmd = &cobra.Command{
 func RootCommand() (*cobra.Command, *httpcfg.HttpCfg) {
 	utils.CobraFlags(rootCmd, append(debug.Flags, utils.MetricFlags...))
 
-	cfg := &httpcfg.HttpCfg{Enabled: true, StateCache: kvcache.DefaultCoherentConfig}
+	cfg := &httpcfg.HttpCfg{Enabled: true, StateCache: kvcache.DefaultCoherentConfig, Gpo: ethconfig.Defaults.GPO}
+	var gpoMaxPrice int64
 	rootCmd.PersistentFlags().StringVar(&cfg.PrivateApiAddr, "private.api.addr", "127.0.0.1:9090", "private api network address, for example: 127.0.0.1:9090")
 	rootCmd.PersistentFlags().StringVar(&cfg.DataDir, "datadir", "", "path to Erigon working directory")
 	rootCmd.PersistentFlags().StringVar(&cfg.HttpListenAddress, "http.addr", nodecfg.DefaultHTTPHost, "HTTP-RPC server listening interface")
@@ -76,12 +78,44 @@ func RootCommand() (*cobra.Command, *httpcfg.HttpCfg) {
 	rootCmd.PersistentFlags().BoolVar(&cfg.HttpCompression, "http.compression", true, "Disable http compression")
 	rootCmd.PersistentFlags().StringSliceVar(&cfg.API, "http.api", []string{"eth", "erigon"}, "API's offered over the HTTP-RPC interface: eth,erigon,web3,net,debug,trace,txpool,db,starknet. Supported methods: https://github.com/ledgerwatch/erigon/tree/devel/cmd/rpcdaemon")
 	rootCmd.PersistentFlags().Uint64Var(&cfg.Gascap, "rpc.gascap", 50000000, "Sets a cap on gas that can be used in eth_call/estimateGas")
+	rootCmd.PersistentFlags().DurationVar(&cfg.EvmCallTimeout, utils.RpcEvmTimeoutFlag.Name, utils.RpcEvmTimeoutFlag.Value, utils.RpcEvmTimeoutFlag.Usage)
+	rootCmd.PersistentFlags().Uint64Var(&cfg.EvmMaxMemory, utils.RpcEvmMemoryFlag.Name, utils.RpcEvmMemoryFlag.Value, utils.RpcEvmMemoryFlag.Usage)
+	rootCmd.PersistentFlags().Uint64Var(&cfg.CallBudgetMaxGas, utils.RpcCallBudgetMaxGasFlag.Name, utils.RpcCallBudgetMaxGasFlag.Value, utils.RpcCallBudgetMaxGasFlag.Usage)
+	rootCmd.PersistentFlags().DurationVar(&cfg.CallBudgetMaxTimeout, utils.RpcCallBudgetMaxTimeoutFlag.Name, utils.RpcCallBudgetMaxTimeoutFlag.Value, utils.RpcCallBudgetMaxTimeoutFlag.Usage)
+	rootCmd.PersistentFlags().Uint64Var(&cfg.CallBudgetMaxMemory, utils.RpcCallBudgetMaxMemoryFlag.Name, utils.RpcCallBudgetMaxMemoryFlag.Value, utils.RpcCallBudgetMaxMemoryFlag.Usage)
+	rootCmd.PersistentFlags().Uint64Var(&cfg.SharedStateCache, utils.RpcSharedStateCacheFlag.Name, utils.RpcSharedStateCacheFlag.Value, utils.RpcSharedStateCacheFlag.Usage)
 	rootCmd.PersistentFlags().Uint64Var(&cfg.MaxTraces, "trace.maxtraces", 200, "Sets a limit on traces that can be returned in trace_filter")
+	rootCmd.PersistentFlags().Uint64Var(&cfg.MaxVmTraceOps, utils.TraceMaxVmTraceOpsFlag.Name, utils.TraceMaxVmTraceOpsFlag.Value, utils.TraceMaxVmTraceOpsFlag.Usage)
+	rootCmd.PersistentFlags().BoolVar(&cfg.DebugDbEnabled, utils.RpcDebugDbFlag.Name, false, utils.RpcDebugDbFlag.Usage)
+	rootCmd.PersistentFlags().Uint64Var(&cfg.DebugDbMaxDump, utils.RpcDebugDbMaxDumpFlag.Name, utils.RpcDebugDbMaxDumpFlag.Value, utils.RpcDebugDbMaxDumpFlag.Usage)
+	rootCmd.PersistentFlags().Uint64Var(&cfg.TracerOpBudget, utils.RpcTracerOpBudgetFlag.Name, utils.RpcTracerOpBudgetFlag.Value, utils.RpcTracerOpBudgetFlag.Usage)
 	rootCmd.PersistentFlags().BoolVar(&cfg.WebsocketEnabled, "ws", false, "Enable Websockets")
 	rootCmd.PersistentFlags().BoolVar(&cfg.WebsocketCompression, "ws.compression", false, "Enable Websocket compression (RFC 7692)")
+	rootCmd.PersistentFlags().IntVar(&cfg.WebsocketSendQueue, utils.WsSendQueueFlag.Name, 0, utils.WsSendQueueFlag.Usage)
+	rootCmd.PersistentFlags().StringVar(&cfg.WebsocketSendPolicy, utils.WsSendQueuePolicyFlag.Name, utils.WsSendQueuePolicyFlag.Value, utils.WsSendQueuePolicyFlag.Usage)
+	rootCmd.PersistentFlags().IntVar(&cfg.WebsocketSubsMax, utils.WsSubscriptionsMaxFlag.Name, 0, utils.WsSubscriptionsMaxFlag.Usage)
 	rootCmd.PersistentFlags().StringVar(&cfg.RpcAllowListFilePath, "rpc.accessList", "", "Specify granular (method-by-method) API allowlist")
 	rootCmd.PersistentFlags().UintVar(&cfg.RpcBatchConcurrency, utils.RpcBatchConcurrencyFlag.Name, 2, utils.RpcBatchConcurrencyFlag.Usage)
+	rootCmd.PersistentFlags().StringVar(&cfg.RpcRateLimitsFilePath, utils.RpcRateLimitsFlag.Name, "", utils.RpcRateLimitsFlag.Usage)
+	rootCmd.PersistentFlags().StringVar(&cfg.RpcApiKeysFilePath, utils.RpcApiKeysFlag.Name, "", utils.RpcApiKeysFlag.Usage)
+	rootCmd.PersistentFlags().StringVar(&cfg.RpcAuditFilePath, utils.RpcAuditFileFlag.Name, "", utils.RpcAuditFileFlag.Usage)
+	rootCmd.PersistentFlags().Float64Var(&cfg.RpcAuditSampleRate, utils.RpcAuditSampleFlag.Name, utils.RpcAuditSampleFlag.Value, utils.RpcAuditSampleFlag.Usage)
+	rootCmd.PersistentFlags().DurationVar(&cfg.RpcAuditSlow, utils.RpcAuditSlowFlag.Name, utils.RpcAuditSlowFlag.Value, utils.RpcAuditSlowFlag.Usage)
+	rootCmd.PersistentFlags().StringVar(&cfg.LocalTxsJournal, utils.RpcLocalTxsJournalFlag.Name, "", utils.RpcLocalTxsJournalFlag.Usage)
+	rootCmd.PersistentFlags().DurationVar(&cfg.LocalTxsResubmit, utils.RpcLocalTxsResubmitFlag.Name, utils.RpcLocalTxsResubmitFlag.Value, utils.RpcLocalTxsResubmitFlag.Usage)
+	rootCmd.PersistentFlags().IntVar(&cfg.TxsPerClient, utils.RpcTxsPerClientFlag.Name, 0, utils.RpcTxsPerClientFlag.Usage)
+	rootCmd.PersistentFlags().IntVar(&cfg.TxsPerSender, utils.RpcTxsPerSenderFlag.Name, 0, utils.RpcTxsPerSenderFlag.Usage)
+	rootCmd.PersistentFlags().StringVar(&cfg.RpcLanes, utils.RpcLanesFlag.Name, "", utils.RpcLanesFlag.Usage)
+	rootCmd.PersistentFlags().IntVar(&cfg.PinnedViewsMax, utils.RpcViewsMaxFlag.Name, 0, utils.RpcViewsMaxFlag.Usage)
+	rootCmd.PersistentFlags().DurationVar(&cfg.PinnedViewsTTL, utils.RpcViewsTTLFlag.Name, utils.RpcViewsTTLFlag.Value, utils.RpcViewsTTLFlag.Usage)
 	rootCmd.PersistentFlags().BoolVar(&cfg.RpcStreamingDisable, utils.RpcStreamingDisableFlag.Name, false, utils.RpcStreamingDisableFlag.Usage)
+	rootCmd.PersistentFlags().UintVar(&cfg.GetLogsParallel, utils.RpcGetLogsParallelFlag.Name, utils.RpcGetLogsParallelFlag.Value, utils.RpcGetLogsParallelFlag.Usage)
+	rootCmd.PersistentFlags().UintVar(&cfg.TraceBlockParallel, utils.RpcTraceBlockParallelFlag.Name, utils.RpcTraceBlockParallelFlag.Value, utils.RpcTraceBlockParallelFlag.Usage)
+	rootCmd.PersistentFlags().BoolVar(&cfg.TimestampIndex, utils.RpcTimestampIndexFlag.Name, false, utils.RpcTimestampIndexFlag.Usage)
+	rootCmd.PersistentFlags().IntVar(&cfg.Gpo.Blocks, utils.GpoBlocksFlag.Name, utils.GpoBlocksFlag.Value, utils.GpoBlocksFlag.Usage)
+	rootCmd.PersistentFlags().IntVar(&cfg.Gpo.Percentile, utils.GpoPercentileFlag.Name, utils.GpoPercentileFlag.Value, utils.GpoPercentileFlag.Usage)
+	rootCmd.PersistentFlags().Int64Var(&gpoMaxPrice, utils.GpoMaxGasPriceFlag.Name, utils.GpoMaxGasPriceFlag.Value, utils.GpoMaxGasPriceFlag.Usage)
+	rootCmd.PersistentFlags().StringVar(&cfg.Gpo.Estimator, utils.GpoEstimatorFlag.Name, utils.GpoEstimatorFlag.Value, utils.GpoEstimatorFlag.Usage)
 	rootCmd.PersistentFlags().IntVar(&cfg.DBReadConcurrency, utils.DBReadConcurrencyFlag.Name, utils.DBReadConcurrencyFlag.Value, utils.DBReadConcurrencyFlag.Usage)
 	rootCmd.PersistentFlags().BoolVar(&cfg.TraceCompatibility, "trace.compat", false, "Bug for bug compatibility with OE for trace_ routines")
 	rootCmd.PersistentFlags().StringVar(&cfg.TxPoolApiAddr, "txpool.api.addr", "", "txpool api network address, for example: 127.0.0.1:9090 (default: use value of --private.api.addr)")
@@ -92,6 +126,9 @@ func RootCommand() (*cobra.Command, *httpcfg.HttpCfg) {
 	rootCmd.PersistentFlags().StringVar(&cfg.GRPCListenAddress, "grpc.addr", nodecfg.DefaultGRPCHost, "GRPC server listening interface")
 	rootCmd.PersistentFlags().IntVar(&cfg.GRPCPort, "grpc.port", nodecfg.DefaultGRPCPort, "GRPC server listening port")
 	rootCmd.PersistentFlags().BoolVar(&cfg.GRPCHealthCheckEnabled, "grpc.healthcheck", false, "Enable GRPC health check")
+	rootCmd.PersistentFlags().BoolVar(&cfg.GRPCEthEnabled, "grpc.eth", false, "Serve the blocks, receipts and raw state of the database on the GRPC server (remote.KV, remote.ETHBACKEND and rpcdaemon.Eth services)")
+	rootCmd.PersistentFlags().BoolVar(&cfg.SnapshotsOnly, "snapshots.only", false, "Serve the block snapshots and the state history files of --datadir, without the chaindata of Erigon and without a running Erigon")
+	rootCmd.PersistentFlags().StringVar(&cfg.Chain, utils.ChainFlag.Name, utils.ChainFlag.Value, "Name of the chain of the snapshots, with --snapshots.only")
 	rootCmd.PersistentFlags().StringVar(&cfg.StarknetGRPCAddress, "starknet.grpc.address", "127.0.0.1:6066", "Starknet GRPC address")
 	rootCmd.PersistentFlags().BoolVar(&cfg.TraceRequests, utils.HTTPTraceFlag.Name, false, "Trace HTTP requests with INFO level")
 	rootCmd.PersistentFlags().DurationVar(&cfg.HTTPTimeouts.ReadTimeout, "http.timeouts.read", rpccfg.DefaultHTTPTimeouts.ReadTimeout, "Maximum duration for reading the entire request, including the body.")
@@ -101,6 +138,12 @@ func RootCommand() (*cobra.Command, *httpcfg.HttpCfg) {
 	if err := rootCmd.MarkPersistentFlagFilename("rpc.accessList", "json"); err != nil {
 		panic(err)
 	}
+	if err := rootCmd.MarkPersistentFlagFilename(utils.RpcRateLimitsFlag.Name, "json"); err != nil {
+		panic(err)
+	}
+	if err := rootCmd.MarkPersistentFlagFilename(utils.RpcApiKeysFlag.Name, "json"); err != nil {
+		panic(err)
+	}
 	if err := rootCmd.MarkPersistentFlagDirname("datadir"); err != nil {
 		panic(err)
 	}
@@ -119,6 +162,10 @@ func RootCommand() (*cobra.Command, *httpcfg.HttpCfg) {
 		if cfg.TxPoolApiAddr == "" {
 			cfg.TxPoolApiAddr = cfg.PrivateApiAddr
 		}
+		if cfg.DebugDbMaxDump == 0 {
+			return fmt.Errorf("--%s must be positive", utils.RpcDebugDbMaxDumpFlag.Name)
+		}
+		cfg.Gpo.MaxPrice = big.NewInt(gpoMaxPrice)
 		return nil
 	}
 	rootCmd.PersistentPostRunE = func(cmd *cobra.Command, args []string) error {
@@ -269,6 +316,13 @@ func RemoteServices(ctx context.Context, cfg httpcfg.HttpCfg, logger log.Logger,
 	agg *libstate.Aggregator22,
 	txNums *exec22.TxNums,
 	err error) {
+	if cfg.SnapshotsOnly {
+		if !cfg.WithDatadir {
+			return nil, nil, nil, nil, nil, nil, nil, nil, ff, nil, nil, fmt.Errorf("--snapshots.only requires --datadir")
+		}
+		db, eth, stateCache, blockReader, ff, agg, txNums, err = snapshotsOnlyServices(ctx, cfg)
+		return db, nil, eth, nil, nil, nil, stateCache, blockReader, ff, agg, txNums, err
+	}
 	if !cfg.WithDatadir && cfg.PrivateApiAddr == "" {
 		return nil, nil, nil, nil, nil, nil, nil, nil, ff, nil, nil, fmt.Errorf("either remote db or local db must be specified")
 	}
@@ -279,7 +333,7 @@ func RemoteServices(ctx context.Context, cfg httpcfg.HttpCfg, logger log.Logger,
 		var rwKv kv.RwDB
 		log.Trace("Creating chain db", "path", cfg.Dirs.Chaindata)
 		limiter := semaphore.NewWeighted(int64(cfg.DBReadConcurrency))
-		rwKv, err = kv2.NewMDBX(logger).RoTxsLimiter(limiter).Path(cfg.Dirs.Chaindata).Readonly().Open()
+		rwKv, err = kv2.NewMDBX(logger).RoTxsLimiter(limiter).Path(cfg.Dirs.Chaindata).WithTableCfg(rawdb.WithOtsTables).Readonly().Open()
 		if err != nil {
 			return nil, nil, nil, nil, nil, nil, nil, nil, ff, nil, nil, err
 		}
@@ -450,7 +504,9 @@ func RemoteServices(ctx context.Context, cfg httpcfg.HttpCfg, logger log.Logger,
 	return db, borDb, eth, txPool, mining, starknet, stateCache, blockReader, ff, agg, txNums, err
 }
 
-func StartRpcServer(ctx context.Context, cfg httpcfg.HttpCfg, rpcAPI []rpc.API, authAPI []rpc.API) error {
+// StartRpcServer starts the HTTP and websocket endpoints of rpcAPI, the authenticated endpoint of authAPI, and the gRPC
+// server if enabled, with the services registered by grpcAPI if not nil
+func StartRpcServer(ctx context.Context, cfg httpcfg.HttpCfg, rpcAPI []rpc.API, authAPI []rpc.API, grpcAPI func(*grpc.Server)) error {
 	if len(authAPI) > 0 {
 		engineInfo, err := startAuthenticatedRpcServer(cfg, authAPI)
 		if err != nil {
@@ -460,13 +516,13 @@ func StartRpcServer(ctx context.Context, cfg httpcfg.HttpCfg, rpcAPI []rpc.API,
 	}
 
 	if cfg.Enabled {
-		return startRegularRpcServer(ctx, cfg, rpcAPI)
+		return startRegularRpcServer(ctx, cfg, rpcAPI, grpcAPI)
 	}
 
 	return nil
 }
 
-func startRegularRpcServer(ctx context.Context, cfg httpcfg.HttpCfg, rpcAPI []rpc.API) error {
+func startRegularRpcServer(ctx context.Context, cfg httpcfg.HttpCfg, rpcAPI []rpc.API, grpcAPI func(*grpc.Server)) error {
 	// register apis and create handler stack
 	httpEndpoint := fmt.Sprintf("%s:%d", cfg.HttpListenAddress, cfg.HttpPort)
 
@@ -479,6 +535,54 @@ func startRegularRpcServer(ctx context.Context, cfg httpcfg.HttpCfg, rpcAPI []rp
 	}
 	srv.SetAllowList(allowListForRPC)
 
+	rateLimits, err := parseRateLimitsForRPC(cfg.RpcRateLimitsFilePath)
+	if err != nil {
+		return err
+	}
+	if err = srv.SetRateLimits(rateLimits); err != nil {
+		return err
+	}
+	if path := strings.TrimSpace(cfg.RpcApiKeysFilePath); path != "" {
+		apiKeys, err := parseAPIKeysForRPC(path)
+		if err != nil {
+			return err
+		}
+		if err = srv.SetAPIKeys(apiKeys); err != nil {
+			return fmt.Errorf("invalid --%s: %w", utils.RpcApiKeysFlag.Name, err)
+		}
+		go watchAPIKeysForRPC(ctx, path, srv)
+	}
+	if cfg.RpcAuditFilePath != "" {
+		auditFile, err := os.OpenFile(cfg.RpcAuditFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("open the audit log: %w", err)
+		}
+		if err = srv.SetAuditLog(auditFile, rpc.AuditConfig{SampleRate: cfg.RpcAuditSampleRate, SlowThreshold: cfg.RpcAuditSlow}); err != nil {
+			auditFile.Close()
+			return fmt.Errorf("invalid audit log settings: %w", err)
+		}
+	}
+	lanes, err := rpc.ParseLanes(cfg.RpcLanes)
+	if err != nil {
+		return fmt.Errorf("invalid --%s: %w", utils.RpcLanesFlag.Name, err)
+	}
+	srv.SetLanes(lanes)
+	if err = srv.SetSubscriptionLimits(rpc.SubscriptionLimits{
+		SendQueue: cfg.WebsocketSendQueue,
+		Policy:    rpc.SendQueuePolicy(cfg.WebsocketSendPolicy),
+		PerClient: cfg.WebsocketSubsMax,
+	}); err != nil {
+		return fmt.Errorf("invalid websocket limits: %w", err)
+	}
+
+	if cfg.CallBudgetMaxGas > 0 || cfg.CallBudgetMaxTimeout > 0 || cfg.CallBudgetMaxMemory > 0 {
+		callBudgetSecret, err := obtainJWTSecret(cfg)
+		if err != nil {
+			return err
+		}
+		srv.SetCallBudgetSecret(callBudgetSecret)
+	}
+
 	var defaultAPIList []rpc.API
 
 	for _, api := range rpcAPI {
@@ -532,6 +636,9 @@ func startRegularRpcServer(ctx context.Context, cfg httpcfg.HttpCfg, rpcAPI []rp
 			healthServer = grpcHealth.NewServer()
 			grpc_health_v1.RegisterHealthServer(grpcServer, healthServer)
 		}
+		if grpcAPI != nil {
+			grpcAPI(grpcServer)
+		}
 		go grpcServer.Serve(grpcListener)
 		info = append(info, "grpc.port", cfg.GRPCPort)
 	}
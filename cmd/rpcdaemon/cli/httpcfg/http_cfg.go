@@ -1,8 +1,12 @@
 package httpcfg
 
 import (
+	"time"
+
 	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/core"
 	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/erigon/eth/gasprice"
 	"github.com/ledgerwatch/erigon/node/nodecfg/datadir"
 	"github.com/ledgerwatch/erigon/rpc/rpccfg"
 )
@@ -26,15 +30,46 @@ type HttpCfg struct {
 	HttpCompression          bool
 	API                      []string
 	Gascap                   uint64
+	EvmCallTimeout           time.Duration // limits of eth_call/estimateGas, 0 - no limit
+	EvmMaxMemory             uint64
+	CallBudgetMaxGas         uint64 // ceilings up to which the requests authenticated with the JWT secret may raise
+	CallBudgetMaxTimeout     time.Duration
+	CallBudgetMaxMemory      uint64
+	SharedStateCache         uint64 // bytes of the historical state shared by the concurrent calls, 0 - disabled
 	MaxTraces                uint64
+	MaxVmTraceOps            uint64 // operations recorded in the vmTrace of one transaction, 0 - no limit
+	DebugDbEnabled           bool   // debug_dbGet and debug_dbDump on the port authenticated by the JWT secret
+	DebugDbMaxDump           uint64 // entries returned by one call of debug_dbDump
+	TracerOpBudget           uint64 // opcodes each JavaScript tracer of debug_trace* may be called for, 0 - no limit
 	WebsocketEnabled         bool
 	WebsocketCompression     bool
+	WebsocketSendQueue       int    // notifications queued per websocket connection, 0 - no queue
+	WebsocketSendPolicy      string // of the notifications over WebsocketSendQueue, see rpc.SendQueuePolicy
+	WebsocketSubsMax         int    // websocket subscriptions per client IP address, 0 - unlimited
 	RpcAllowListFilePath     string
+	RpcRateLimitsFilePath    string // JSON file with the rpc.RateLimits of the calls, empty - no limits
+	RpcApiKeysFilePath       string // JSON file with the rpc.APIKeys, reloaded on change, empty - no key is required
+	RpcAuditFilePath         string // JSON lines of the rpc.AuditRecord of the calls, empty - the calls are not audited
+	RpcAuditSampleRate       float64
+	RpcAuditSlow             time.Duration
+	LocalTxsJournal          string // file of rpchelper.LocalTxs, empty - the local transactions are not tracked
+	LocalTxsResubmit         time.Duration
+	TxsPerClient             int    // transactions sent by eth_sendRawTransaction which each client may have in the txpool, 0 - unlimited
+	TxsPerSender             int    // and each sender
+	RpcLanes                 string // worker pools and queue limits of the lanes of the calls, see rpc.ParseLanes
+	PinnedViewsMax           int    // database views pinned at once by erigon_pinView, 0 - disabled
+	PinnedViewsTTL           time.Duration
 	RpcBatchConcurrency      uint
 	RpcStreamingDisable      bool
+	GetLogsParallel          uint
+	TraceBlockParallel       uint
+	TimestampIndex           bool            // in-memory index of the timestamps of the blocks in the snapshots, for erigon_getBlockByTimestamp
+	Gpo                      gasprice.Config // eth_gasPrice and eth_maxPriorityFeePerGas suggestions
 	DBReadConcurrency        int
 	TraceCompatibility       bool // Bug for bug compatibility for trace_ routines with OpenEthereum
 	TxPoolApiAddr            string
+	TxPool                   *core.TxPoolConfig         // policy of the pool reported by txpool_status, nil - the pool is in another process
+	TxConditions             *core.TxConditionsRegistry // of eth_sendRawTransactionConditional, nil - the miner is in another process
 	TevmEnabled              bool
 	StateCache               kvcache.CoherentConfig
 	Snap                     ethconfig.Snapshot
@@ -43,6 +78,9 @@ type HttpCfg struct {
 	GRPCListenAddress        string
 	GRPCPort                 int
 	GRPCHealthCheckEnabled   bool
+	GRPCEthEnabled           bool   // serve the database over the remote interfaces on the GRPC server, see grpcapi.Register
+	SnapshotsOnly            bool   // serve the snapshots of DataDir without its chaindata, see cli.snapshotsOnlyServices
+	Chain                    string // name of the chain of the snapshots, with SnapshotsOnly
 	StarknetGRPCAddress      string
 	JWTSecretPath            string // Engine API Authentication
 	TraceRequests            bool   // Always trace requests in INFO level
@@ -1,14 +1,21 @@
 package cli
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/log/v3"
 )
 
+// apiKeysReloadInterval is how often the file of the API keys is checked for changes
+const apiKeysReloadInterval = 5 * time.Second
+
 type allowListFile struct {
 	Allow rpc.AllowList `json:"allow"`
 }
@@ -41,3 +48,75 @@ func parseAllowListForRPC(path string) (rpc.AllowList, error) {
 
 	return allowListFileObj.Allow, nil
 }
+
+func parseRateLimitsForRPC(path string) (*rpc.RateLimits, error) {
+	path = strings.TrimSpace(path)
+	if path == "" { // no file is provided
+		return nil, nil
+	}
+
+	fileContents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rateLimits rpc.RateLimits
+	if err = json.Unmarshal(fileContents, &rateLimits); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	return &rateLimits, nil
+}
+
+func parseAPIKeysForRPC(path string) (rpc.APIKeys, error) {
+	fileContents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys rpc.APIKeys
+	if err = json.Unmarshal(fileContents, &keys); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if keys == nil {
+		keys = rpc.APIKeys{}
+	}
+
+	return keys, nil
+}
+
+// watchAPIKeysForRPC reloads the API keys of srv when the file changes, until ctx is done. A file which can't be parsed
+// is logged, and the previous keys stay in effect
+func watchAPIKeysForRPC(ctx context.Context, path string, srv *rpc.Server) {
+	ticker := time.NewTicker(apiKeysReloadInterval)
+	defer ticker.Stop()
+	var modTime time.Time
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Warn("[rpc] Cannot read the API keys", "file", path, "err", err)
+			continue
+		}
+		if info.ModTime().Equal(modTime) {
+			continue
+		}
+		modTime = info.ModTime()
+		keys, err := parseAPIKeysForRPC(path)
+		if err == nil {
+			err = srv.SetAPIKeys(keys)
+		}
+		if err != nil {
+			log.Warn("[rpc] Keeping the previous API keys", "file", path, "err", err)
+			continue
+		}
+		log.Info("[rpc] Reloaded the API keys", "file", path, "keys", len(keys))
+	}
+}
@@ -0,0 +1,217 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common/dir"
+	"github.com/ledgerwatch/erigon-lib/etl"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	types2 "github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	libstate "github.com/ledgerwatch/erigon-lib/state"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/cli/httpcfg"
+	"github.com/ledgerwatch/erigon/cmd/state/exec22"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/p2p"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/turbo/rpchelper"
+	"github.com/ledgerwatch/erigon/turbo/services"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync/snap"
+	"github.com/ledgerwatch/log/v3"
+)
+
+var errSnapshotsOnly = errors.New("not available in the --snapshots.only mode of rpcdaemon")
+
+// snapshotsOnlyServices - the services of rpcdaemon started with --snapshots.only: instead of the chaindata of Erigon,
+// it reads the block snapshots (.seg) of --datadir and the history of the state in its erigon22 directory (.kv).
+// The small tables which the API needs besides them (canonical hashes, header numbers, total difficulties and the chain
+// config) are filled at startup in an in-memory database, so the daemon needs neither MDBX nor a running Erigon.
+//
+// The latest block is the last block of the snapshots, and the state of every block but the genesis is read from the
+// history files, so it's available up to the last block covered by the .kv files
+func snapshotsOnlyServices(ctx context.Context, cfg httpcfg.HttpCfg) (
+	db kv.RoDB, eth rpchelper.ApiBackend, stateCache kvcache.Cache, blockReader services.FullBlockReader,
+	ff *rpchelper.Filters, agg *libstate.Aggregator22, txNums *exec22.TxNums, err error) {
+	genesis := core.DefaultGenesisBlockByChainName(cfg.Chain)
+	if genesis == nil {
+		return nil, nil, nil, nil, nil, nil, nil, fmt.Errorf("unknown chain %s", cfg.Chain)
+	}
+
+	cfg.Snap.Enabled = true
+	allSnapshots := snapshotsync.NewRoSnapshots(cfg.Snap, cfg.Dirs.Snap)
+	if err = allSnapshots.ReopenFolder(); err != nil {
+		return nil, nil, nil, nil, nil, nil, nil, fmt.Errorf("open snapshots: %w", err)
+	}
+	allSnapshots.LogStat()
+	if allSnapshots.BlocksAvailable() == 0 {
+		return nil, nil, nil, nil, nil, nil, nil, fmt.Errorf("no indexed block snapshots in %s", cfg.Dirs.Snap)
+	}
+	blockReader = snapshotsync.NewBlockReaderWithSnapshots(allSnapshots)
+
+	memDb := memdb.New()
+	chainConfig, _, err := core.CommitGenesisBlock(memDb, genesis)
+	if err != nil {
+		memDb.Close()
+		return nil, nil, nil, nil, nil, nil, nil, fmt.Errorf("commit genesis: %w", err)
+	}
+	if err = memDb.Update(ctx, func(tx kv.RwTx) error {
+		return fillSnapshotsOnlyDB(ctx, tx, cfg, allSnapshots, blockReader)
+	}); err != nil {
+		memDb.Close()
+		return nil, nil, nil, nil, nil, nil, nil, err
+	}
+	db = memDb
+
+	txNums = exec22.TxNumsFromDB(allSnapshots, db)
+	e22Dir := filepath.Join(cfg.DataDir, "erigon22")
+	dir.MustExist(e22Dir)
+	if agg, err = libstate.NewAggregator22(e22Dir, ethconfig.HistoryV2AggregationStep); err != nil {
+		memDb.Close()
+		return nil, nil, nil, nil, nil, nil, nil, fmt.Errorf("create aggregator: %w", err)
+	}
+
+	eth = &snapshotsBackend{chainConfig: chainConfig, blockReader: blockReader}
+	// Without Erigon there are no new blocks, pending transactions or logs to subscribe to
+	ff = rpchelper.New(ctx, nil, nil, nil, func() {})
+	return db, eth, kvcache.NewDummy(), blockReader, ff, agg, txNums, nil
+}
+
+// fillSnapshotsOnlyDB writes the tables read by the API which are not in the snapshots, like the Headers stage does
+// after downloading the snapshots, and marks the blocks of the snapshots as synced
+func fillSnapshotsOnlyDB(ctx context.Context, tx kv.RwTx, cfg httpcfg.HttpCfg, allSnapshots *snapshotsync.RoSnapshots, blockReader services.FullBlockReader) error {
+	if err := snap.ForceSetFlags(tx, cfg.Snap); err != nil {
+		return err
+	}
+	if err := rawdb.HistoryV2.ForceWrite(tx, true); err != nil {
+		return err
+	}
+
+	logEvery := time.NewTicker(20 * time.Second)
+	defer logEvery.Stop()
+
+	h2n := etl.NewCollector("Snapshots", cfg.Dirs.Tmp, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	defer h2n.Close()
+	h2n.LogLvl(log.LvlDebug)
+
+	td := big.NewInt(0)
+	if err := snapshotsync.ForEachHeader(ctx, allSnapshots, func(header *types.Header) error {
+		blockNum, blockHash := header.Number.Uint64(), header.Hash()
+		td.Add(td, header.Difficulty)
+		if err := rawdb.WriteTd(tx, blockHash, blockNum, td); err != nil {
+			return err
+		}
+		if err := rawdb.WriteCanonicalHash(tx, blockHash, blockNum); err != nil {
+			return err
+		}
+		if err := h2n.Collect(blockHash[:], dbutils.EncodeBlockNumber(blockNum)); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-logEvery.C:
+			log.Info("[snapshots.only] Indexing the headers of the snapshots", "block_num", blockNum)
+		default:
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := h2n.Load(tx, kv.HeaderNumber, etl.IdentityLoadFunc, etl.TransformArgs{}); err != nil {
+		return err
+	}
+
+	lastBlock := allSnapshots.BlocksAvailable()
+	lastHash, err := blockReader.CanonicalHash(ctx, tx, lastBlock)
+	if err != nil {
+		return err
+	}
+	if err = rawdb.WriteHeadHeaderHash(tx, lastHash); err != nil {
+		return err
+	}
+	// The head of the fork choice is the latest block, while the Execution stage stays at the genesis: the plain state
+	// holds only the genesis allocation, the state of the other blocks is read from the history
+	rawdb.WriteForkchoiceHead(tx, lastHash)
+	for _, stage := range []stages.SyncStage{stages.Headers, stages.BlockHashes, stages.Bodies, stages.Senders, stages.TxLookup, stages.Finish} {
+		if err = stages.SaveStageProgress(tx, stage, lastBlock); err != nil {
+			return err
+		}
+	}
+	log.Info("[snapshots.only] Serving the blocks of the snapshots", "blocks", lastBlock)
+	return nil
+}
+
+// snapshotsBackend is the rpchelper.ApiBackend of the --snapshots.only mode, it serves the blocks of the snapshots and
+// the static information of the chain, the calls which need a running Erigon return errSnapshotsOnly
+type snapshotsBackend struct {
+	chainConfig *params.ChainConfig
+	blockReader services.FullBlockReader
+}
+
+func (b *snapshotsBackend) Etherbase(context.Context) (common.Address, error) {
+	return common.Address{}, errSnapshotsOnly
+}
+
+func (b *snapshotsBackend) NetVersion(context.Context) (uint64, error) {
+	return b.chainConfig.ChainID.Uint64(), nil
+}
+
+func (b *snapshotsBackend) NetPeerCount(context.Context) (uint64, error) { return 0, nil }
+
+func (b *snapshotsBackend) ProtocolVersion(context.Context) (uint64, error) {
+	return 0, errSnapshotsOnly
+}
+
+func (b *snapshotsBackend) ClientVersion(context.Context) (string, error) {
+	return common.MakeName("rpcdaemon", params.Version), nil
+}
+
+func (b *snapshotsBackend) Subscribe(context.Context, func(*remote.SubscribeReply)) error {
+	return errSnapshotsOnly
+}
+
+func (b *snapshotsBackend) SubscribeLogs(context.Context, func(*remote.SubscribeLogsReply), *atomic.Value) error {
+	return errSnapshotsOnly
+}
+
+func (b *snapshotsBackend) BlockWithSenders(ctx context.Context, tx kv.Getter, hash common.Hash, blockHeight uint64) (*types.Block, []common.Address, error) {
+	return b.blockReader.BlockWithSenders(ctx, tx, hash, blockHeight)
+}
+
+func (b *snapshotsBackend) EngineNewPayloadV1(context.Context, *types2.ExecutionPayload) (*remote.EnginePayloadStatus, error) {
+	return nil, errSnapshotsOnly
+}
+
+func (b *snapshotsBackend) EngineForkchoiceUpdatedV1(context.Context, *remote.EngineForkChoiceUpdatedRequest) (*remote.EngineForkChoiceUpdatedReply, error) {
+	return nil, errSnapshotsOnly
+}
+
+func (b *snapshotsBackend) EngineGetPayloadV1(context.Context, uint64) (*types2.ExecutionPayload, error) {
+	return nil, errSnapshotsOnly
+}
+
+func (b *snapshotsBackend) NodeInfo(context.Context, uint32) ([]p2p.NodeInfo, error) {
+	return nil, errSnapshotsOnly
+}
+
+func (b *snapshotsBackend) Peers(context.Context) ([]*p2p.PeerInfo, error) {
+	return []*p2p.PeerInfo{}, nil
+}
+
+// PendingBlock returns nil, without a miner there is no pending block
+func (b *snapshotsBackend) PendingBlock(context.Context) (*types.Block, error) { return nil, nil }
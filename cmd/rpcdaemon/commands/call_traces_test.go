@@ -180,6 +180,50 @@ func TestFilterNoAddresses(t *testing.T) {
 	assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, blockNumbersFromTraces(t, buf.Bytes()))
 }
 
+func TestFilterPage(t *testing.T) {
+	m := stages.Mock(t)
+	defer m.DB.Close()
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 10, func(i int, gen *core.BlockGen) {
+		gen.SetCoinbase(common.Address{1})
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain))
+	api := NewTraceAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), nil, nil, false), m.DB, &httpcfg.HttpCfg{MaxTraces: 4})
+
+	var fromBlock, toBlock, count uint64 = 1, 10, 3
+	req := TraceFilterRequest{
+		FromBlock: (*hexutil.Uint64)(&fromBlock),
+		ToBlock:   (*hexutil.Uint64)(&toBlock),
+		Count:     &count,
+	}
+	var numbers []int
+	for pages := 1; ; pages++ {
+		var buf bytes.Buffer
+		stream := jsoniter.NewStream(jsoniter.ConfigDefault, &buf, 4096)
+		require.NoError(t, api.FilterPage(context.Background(), req, stream))
+		var page struct {
+			Traces jsoniter.RawMessage `json:"traces"`
+			Cursor *TraceFilterCursor  `json:"cursor"`
+		}
+		require.NoError(t, jsoniter.Unmarshal(buf.Bytes(), &page))
+		numbers = append(numbers, blockNumbersFromTraces(t, page.Traces)...)
+		if page.Cursor == nil {
+			require.Equal(t, 4, pages)
+			break
+		}
+		req.Cursor = page.Cursor
+	}
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, numbers)
+
+	// the count is limited by MaxTraces
+	count = 100
+	req.Cursor = nil
+	var buf bytes.Buffer
+	stream := jsoniter.NewStream(jsoniter.ConfigDefault, &buf, 4096)
+	require.NoError(t, api.FilterPage(context.Background(), req, stream))
+	assert.Contains(t, buf.String(), `"cursor":"4.1"`)
+}
+
 func TestFilterAddressIntersection(t *testing.T) {
 	m := stages.Mock(t)
 	defer m.DB.Close()
@@ -1,6 +1,8 @@
 package commands
 
 import (
+	"context"
+
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/starknet"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
 	"github.com/ledgerwatch/erigon-lib/kv"
@@ -11,6 +13,8 @@ import (
 	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/erigon/turbo/rpchelper"
 	"github.com/ledgerwatch/erigon/turbo/services"
+	"github.com/ledgerwatch/erigon/turbo/transactions"
+	"github.com/ledgerwatch/log/v3"
 )
 
 // APIList describes the list of available RPC apis
@@ -22,18 +26,64 @@ func APIList(db kv.RoDB, borDb kv.RoDB, eth rpchelper.ApiBackend, txPool txpool.
 	if cfg.TevmEnabled {
 		base.EnableTevmExperiment()
 	}
+	if err := base.SetSharedStateCacheSize(cfg.SharedStateCache); err != nil {
+		log.Error("Historical state is not cached", "err", err)
+	}
+	// The requests with a pinned view read its transaction instead of beginning their own
+	var views *rpchelper.PinnedViews
+	if cfg.PinnedViewsMax > 0 {
+		views = rpchelper.NewPinnedViews(db, cfg.PinnedViewsMax, cfg.PinnedViewsTTL)
+		db = views.DB()
+	}
 	ethImpl := NewEthAPI(base, db, eth, txPool, mining, cfg.Gascap)
+	ethImpl.GetLogsParallel = int(cfg.GetLogsParallel)
+	ethImpl.GPO = cfg.Gpo
+	ethImpl.EvmCallTimeout = cfg.EvmCallTimeout
+	ethImpl.EvmMaxMemory = cfg.EvmMaxMemory
+	ethImpl.txConditions = cfg.TxConditions
+	ethImpl.CallBudgetCeiling = transactions.CallBudget{
+		GasCap:    cfg.CallBudgetMaxGas,
+		Timeout:   cfg.CallBudgetMaxTimeout,
+		MaxMemory: cfg.CallBudgetMaxMemory,
+	}
+	if cfg.LocalTxsJournal != "" {
+		localTxs, err := rpchelper.NewLocalTxs(db, blockReader, txPool, cfg.LocalTxsJournal)
+		if err != nil {
+			log.Error("Local transactions are not journaled", "err", err)
+		} else {
+			if cfg.LocalTxsResubmit > 0 {
+				go localTxs.Loop(context.Background(), cfg.LocalTxsResubmit)
+			}
+			ethImpl.localTxs = localTxs
+		}
+	}
+	if cfg.TxsPerClient > 0 || cfg.TxsPerSender > 0 {
+		txQuota, err := rpchelper.NewTxQuota(txPool, cfg.TxsPerClient, cfg.TxsPerSender)
+		if err != nil {
+			log.Error("Transactions per client and per sender are not limited", "err", err)
+		} else {
+			ethImpl.txQuota = txQuota
+		}
+	}
 	erigonImpl := NewErigonAPI(base, db, eth)
+	erigonImpl.TimestampIndex = cfg.TimestampIndex
+	erigonImpl.views = views
 	starknetImpl := NewStarknetAPI(base, db, starknet, txPool)
 	txpoolImpl := NewTxPoolAPI(base, db, txPool)
+	txpoolImpl.localTxs = ethImpl.localTxs
+	txpoolImpl.policy = cfg.TxPool
 	netImpl := NewNetAPIImpl(eth)
 	debugImpl := NewPrivateDebugAPI(base, db, cfg.Gascap)
+	debugImpl.TracerOpBudget = cfg.TracerOpBudget
+	debugImpl.TraceBlockParallel = int(cfg.TraceBlockParallel)
 	traceImpl := NewTraceAPI(base, db, &cfg)
 	web3Impl := NewWeb3APIImpl(eth)
 	dbImpl := NewDBAPIImpl() /* deprecated */
 	adminImpl := NewAdminAPI(eth)
 	parityImpl := NewParityAPIImpl(db)
 	borImpl := NewBorAPI(base, db, borDb) // bor (consensus) specific
+	otsImpl := NewOtterscanAPI(base, db)
+	ots2Impl := NewOts2API(base, db)
 
 	for _, enabledAPI := range cfg.API {
 		switch enabledAPI {
@@ -121,6 +171,20 @@ func APIList(db kv.RoDB, borDb kv.RoDB, eth rpchelper.ApiBackend, txPool txpool.
 				Service:   ParityAPI(parityImpl),
 				Version:   "1.0",
 			})
+		case "ots":
+			list = append(list, rpc.API{
+				Namespace: "ots",
+				Public:    true,
+				Service:   OtterscanAPI(otsImpl),
+				Version:   "1.0",
+			})
+		case "ots2":
+			list = append(list, rpc.API{
+				Namespace: "ots2",
+				Public:    true,
+				Service:   Ots2API(ots2Impl),
+				Version:   "1.0",
+			})
 		}
 	}
 
@@ -146,6 +210,7 @@ func AuthAPIList(db kv.RoDB, eth rpchelper.ApiBackend, txPool txpool.TxpoolClien
 		Service:   EngineAPI(engineImpl),
 		Version:   "1.0",
 	})
+	list = append(list, DebugDbAPIList(db, cfg)...)
 
 	return list
 }
@@ -35,25 +35,45 @@ type PrivateDebugAPI interface {
 	GetModifiedAccountsByNumber(ctx context.Context, startNum rpc.BlockNumber, endNum *rpc.BlockNumber) ([]common.Address, error)
 	GetModifiedAccountsByHash(_ context.Context, startHash common.Hash, endHash *common.Hash) ([]common.Address, error)
 	TraceCall(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash, config *tracers.TraceConfig, stream *jsoniter.Stream) error
+	TraceCallMany(ctx context.Context, bundles []Bundle, simulateContext StateContext, config *tracers.TraceConfig, stream *jsoniter.Stream) error
 	AccountAt(ctx context.Context, blockHash common.Hash, txIndex uint64, account common.Address) (*AccountResult, error)
+	ExecutionWitness(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error)
+	GetRawHeader(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error)
+	GetRawBlock(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error)
+	GetRawReceipts(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) ([]hexutil.Bytes, error)
+	IntermediateRoots(ctx context.Context, blockHash common.Hash, config *tracers.TraceConfig) ([]common.Hash, error)
+	SimulateUserOperations(ctx context.Context, entryPointAddr common.Address, ops []UserOperation, minStake *hexutil.Big, minUnstakeDelay *hexutil.Uint64) ([]*UserOperationResult, error)
 }
 
 // PrivateDebugAPIImpl is implementation of the PrivateDebugAPI interface based on remote Db access
 type PrivateDebugAPIImpl struct {
 	*BaseAPI
-	db     kv.RoDB
-	GasCap uint64
+	db                 kv.RoDB
+	GasCap             uint64
+	TracerOpBudget     uint64 // opcodes each JavaScript tracer may be called for, 0 - no limit
+	TraceBlockParallel int    // max number of transactions traced at once by debug_traceBlock*, sequential if 0 or 1
 }
 
 // NewPrivateDebugAPI returns PrivateDebugAPIImpl instance
 func NewPrivateDebugAPI(base *BaseAPI, db kv.RoDB, gascap uint64) *PrivateDebugAPIImpl {
 	return &PrivateDebugAPIImpl{
-		BaseAPI: base,
-		db:      db,
-		GasCap:  gascap,
+		BaseAPI:        base,
+		db:             db,
+		GasCap:         gascap,
+		TracerOpBudget: tracers.DefaultOpBudget,
 	}
 }
 
+// traceConfig returns the config with the op budget of the server, users can't change it
+func (api *PrivateDebugAPIImpl) traceConfig(config *tracers.TraceConfig) *tracers.TraceConfig {
+	if config == nil || config.Tracer == nil {
+		return config
+	}
+	withBudget := *config
+	withBudget.OpBudget = api.TracerOpBudget
+	return &withBudget
+}
+
 // StorageRangeAt implements debug_storageRangeAt. Returns information about a range of storage locations (if any) for the given address.
 func (api *PrivateDebugAPIImpl) StorageRangeAt(ctx context.Context, blockHash common.Hash, txIndex uint64, contractAddress common.Address, keyStart hexutil.Bytes, maxResult int) (StorageRangeResult, error) {
 	tx, err := api.db.BeginRo(ctx)
@@ -82,6 +102,16 @@ func (api *PrivateDebugAPIImpl) StorageRangeAt(ctx context.Context, blockHash co
 		return h
 	}
 
+	if api.historyV2(tx) && api._agg != nil && api._txNums != nil {
+		aggCtx := api._agg.MakeContext()
+		aggCtx.SetTx(tx)
+		r := state.NewHistoryReader22(aggCtx)
+		r.SetTx(tx)
+		// +1 for the system transaction at the beginning of the block
+		r.SetTxNum(api._txNums.MinOf(block.NumberU64()) + 1 + txIndex)
+		return StorageRangeAt(r, contractAddress, keyStart, maxResult)
+	}
+
 	contractHasTEVM := func(contractHash common.Hash) (bool, error) { return false, nil }
 	if api.TevmEnabled {
 		contractHasTEVM = ethdb.GetHasTEVM(tx)
@@ -7,11 +7,17 @@ import (
 	"testing"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/rpcdaemontest"
 	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/eth/tracers"
 	"github.com/ledgerwatch/erigon/internal/ethapi"
+	"github.com/ledgerwatch/erigon/rlp"
 	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
 )
@@ -85,6 +91,35 @@ func TestTraceBlockByNumber(t *testing.T) {
 	}
 }
 
+func TestTraceBlockParallel(t *testing.T) {
+	db := rpcdaemontest.CreateTestKV(t)
+	stateCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	baseApi := NewBaseApi(nil, stateCache, snapshotsync.NewBlockReader(), nil, nil, false)
+	ethApi := NewEthAPI(baseApi, db, nil, nil, nil, 5000000)
+	api := NewPrivateDebugAPI(baseApi, db, 0)
+	latest, err := ethApi.BlockNumber(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace := func(blockNum rpc.BlockNumber, parallel int) string {
+		var buf bytes.Buffer
+		stream := jsoniter.NewStream(jsoniter.ConfigDefault, &buf, 4096)
+		api.TraceBlockParallel = parallel
+		if err := api.TraceBlockByNumber(context.Background(), blockNum, &tracers.TraceConfig{}, stream); err != nil {
+			t.Fatalf("traceBlock %d: %v", blockNum, err)
+		}
+		if err := stream.Flush(); err != nil {
+			t.Fatalf("error flusing: %v", err)
+		}
+		return buf.String()
+	}
+	for blockNum := rpc.BlockNumber(1); blockNum <= rpc.BlockNumber(latest); blockNum++ {
+		if sequential, parallel := trace(blockNum, 0), trace(blockNum, 2); sequential != parallel {
+			t.Errorf("traceBlock %d: parallel traces %s differ from the sequential ones %s", blockNum, parallel, sequential)
+		}
+	}
+}
+
 func TestTraceBlockByHash(t *testing.T) {
 	db := rpcdaemontest.CreateTestKV(t)
 	stateCache := kvcache.New(kvcache.DefaultCoherentConfig)
@@ -183,3 +218,134 @@ func TestTraceTransactionNoRefund(t *testing.T) {
 		}
 	}
 }
+
+func TestGetRawBlock(t *testing.T) {
+	db := rpcdaemontest.CreateTestKV(t)
+	stateCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	api := NewPrivateDebugAPI(NewBaseApi(nil, stateCache, snapshotsync.NewBlockReader(), nil, nil, false), db, 0)
+	for n := rpc.BlockNumber(0); n <= 10; n++ {
+		var block *types.Block
+		if err := db.View(context.Background(), func(tx kv.Tx) (err error) {
+			block, err = rawdb.ReadBlockByNumber(tx, uint64(n))
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		blockNrOrHash := rpc.BlockNumberOrHashWithNumber(n)
+
+		header, err := api.GetRawHeader(context.Background(), blockNrOrHash)
+		if err != nil {
+			t.Fatalf("getRawHeader %d: %v", n, err)
+		}
+		if want, _ := rlp.EncodeToBytes(block.Header()); !bytes.Equal(header, want) {
+			t.Errorf("wrong header %d, got %x, expected %x", n, header, want)
+		}
+		raw, err := api.GetRawBlock(context.Background(), blockNrOrHash)
+		if err != nil {
+			t.Fatalf("getRawBlock %d: %v", n, err)
+		}
+		if want, _ := rlp.EncodeToBytes(block); !bytes.Equal(raw, want) {
+			t.Errorf("wrong block %d, got %x, expected %x", n, raw, want)
+		}
+		receipts, err := api.GetRawReceipts(context.Background(), blockNrOrHash)
+		if err != nil {
+			t.Fatalf("getRawReceipts %d: %v", n, err)
+		}
+		if len(receipts) != len(block.Transactions()) {
+			t.Errorf("wrong number of receipts of block %d, got %d, expected %d", n, len(receipts), len(block.Transactions()))
+		}
+	}
+}
+
+func TestIntermediateRoots(t *testing.T) {
+	db := rpcdaemontest.CreateTestKV(t)
+	stateCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	api := NewPrivateDebugAPI(NewBaseApi(nil, stateCache, snapshotsync.NewBlockReader(), nil, nil, false), db, 0)
+	for n := uint64(1); n <= 10; n++ {
+		var block *types.Block
+		if err := db.View(context.Background(), func(tx kv.Tx) (err error) {
+			block, err = rawdb.ReadBlockByNumber(tx, n)
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		// The root before the first transaction is checked against the root of the parent
+		roots, err := api.IntermediateRoots(context.Background(), block.Hash(), nil)
+		if err != nil {
+			t.Fatalf("intermediateRoots %d: %v", n, err)
+		}
+		if len(roots) != len(block.Transactions()) {
+			t.Fatalf("wrong number of roots of block %d, got %d, expected %d", n, len(roots), len(block.Transactions()))
+		}
+		for i := 1; i < len(roots); i++ {
+			if roots[i] == roots[i-1] {
+				t.Errorf("same root after transactions %d and %d of block %d", i-1, i, n)
+			}
+		}
+	}
+}
+
+func TestDbDump(t *testing.T) {
+	db := rpcdaemontest.CreateTestKV(t)
+	api := NewDebugDbAPI(db, 1000)
+
+	hash, err := api.DbGet(context.Background(), kv.HeaderCanonical, dbutils.EncodeBlockNumber(0))
+	if err != nil {
+		t.Fatalf("dbGet: %v", err)
+	}
+	if len(hash) != common.HashLength {
+		t.Errorf("dbGet: hash of the genesis %x", hash)
+	}
+	if _, err = api.DbGet(context.Background(), "NoSuchTable", []byte{0}); err == nil {
+		t.Errorf("dbGet: no error for an unknown table")
+	}
+
+	page, err := api.DbDump(context.Background(), kv.HeaderCanonical, nil, nil, 2, nil)
+	if err != nil {
+		t.Fatalf("dbDump: %v", err)
+	}
+	if len(page.Entries) != 2 || !bytes.Equal(page.Entries[0].Value, hash) {
+		t.Fatalf("dbDump: unexpected first page %+v", page.Entries)
+	}
+	if !bytes.Equal(page.Next, dbutils.EncodeBlockNumber(2)) {
+		t.Errorf("dbDump: next %x, expected block 2", page.Next)
+	}
+	page, err = api.DbDump(context.Background(), kv.HeaderCanonical, page.Next, dbutils.EncodeBlockNumber(3), 2, nil)
+	if err != nil {
+		t.Fatalf("dbDump: %v", err)
+	}
+	if len(page.Entries) != 1 || !bytes.Equal(page.Entries[0].Key, dbutils.EncodeBlockNumber(2)) || page.Next != nil {
+		t.Errorf("dbDump: unexpected last page %+v, next %x", page.Entries, page.Next)
+	}
+
+	// Pages of a DupSort table end inside the keys with many values
+	all, err := api.DbDump(context.Background(), kv.AccountChangeSet, nil, nil, 0, nil)
+	if err != nil {
+		t.Fatalf("dbDump: %v", err)
+	}
+	var paged []DbDumpEntry
+	var from hexutil.Bytes
+	var fromValue *hexutil.Bytes
+	for {
+		page, err = api.DbDump(context.Background(), kv.AccountChangeSet, from, nil, 2, fromValue)
+		if err != nil {
+			t.Fatalf("dbDump: %v", err)
+		}
+		if len(page.Entries) > 2 {
+			t.Fatalf("dbDump: %d entries in a page of 2", len(page.Entries))
+		}
+		paged = append(paged, page.Entries...)
+		if page.Next == nil {
+			break
+		}
+		from, fromValue = page.Next, &page.NextValue
+	}
+	if len(paged) != len(all.Entries) {
+		t.Fatalf("dbDump: %d entries in pages, %d in one dump", len(paged), len(all.Entries))
+	}
+	for i := range paged {
+		if !bytes.Equal(paged[i].Key, all.Entries[i].Key) || !bytes.Equal(paged[i].Value, all.Entries[i].Value) {
+			t.Errorf("dbDump: entry %d is %+v in pages, %+v in one dump", i, paged[i], all.Entries[i])
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/cli/httpcfg"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/rpc"
+)
+
+// DebugDbAPI the interface for the debug_db* RPC commands, reading the raw content of the chain database. They are
+// served only on the port authenticated by the JWT secret, see DebugDbAPIList
+type DebugDbAPI interface {
+	DbGet(ctx context.Context, table string, key hexutil.Bytes) (hexutil.Bytes, error)
+	DbDump(ctx context.Context, table string, from hexutil.Bytes, to hexutil.Bytes, limit uint64, fromValue *hexutil.Bytes) (*DbDumpResult, error)
+}
+
+// DebugDbAPIImpl data structure to store things needed for debug_db* commands
+type DebugDbAPIImpl struct {
+	db      kv.RoDB
+	maxDump uint64
+}
+
+// NewDebugDbAPI returns DebugDbAPIImpl instance
+func NewDebugDbAPI(db kv.RoDB, maxDump uint64) *DebugDbAPIImpl {
+	return &DebugDbAPIImpl{
+		db:      db,
+		maxDump: maxDump,
+	}
+}
+
+// DebugDbAPIList returns the debug_db* commands to serve on the authenticated port, if enabled by --rpc.debugdb
+func DebugDbAPIList(db kv.RoDB, cfg httpcfg.HttpCfg) (list []rpc.API) {
+	if !cfg.DebugDbEnabled {
+		return nil
+	}
+	return append(list, rpc.API{
+		Namespace: "debug",
+		Public:    false,
+		Service:   DebugDbAPI(NewDebugDbAPI(db, cfg.DebugDbMaxDump)),
+		Version:   "1.0",
+	})
+}
+
+// DbDumpEntry is a key and its value in the result of debug_dbDump
+type DbDumpEntry struct {
+	Key   hexutil.Bytes `json:"key"`
+	Value hexutil.Bytes `json:"value"`
+}
+
+// DbDumpResult is a page of debug_dbDump
+type DbDumpResult struct {
+	Entries   []DbDumpEntry `json:"entries"`
+	Next      hexutil.Bytes `json:"next,omitempty"`      // key to continue the dump from, empty at the end of the range
+	NextValue hexutil.Bytes `json:"nextValue,omitempty"` // value of the next key to continue from, for DupSort tables
+}
+
+// DbGet implements debug_dbGet. Returns the value of the key in the table, nil if there is no such key. For DupSort
+// tables, returns the first value of the key
+func (api *DebugDbAPIImpl) DbGet(ctx context.Context, table string, key hexutil.Bytes) (hexutil.Bytes, error) {
+	if err := checkDbTable(table); err != nil {
+		return nil, err
+	}
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	v, err := tx.GetOne(table, key)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, nil
+	}
+	return common.CopyBytes(v), nil
+}
+
+// DbDump implements debug_dbDump. Returns at most limit entries of the table with the keys in [from, to), an empty
+// to means up to the end of the table. The values of a key of a DupSort table are separate entries, and a page may
+// end inside a key: the next page starts from the value fromValue of the key from, as returned in next and nextValue
+func (api *DebugDbAPIImpl) DbDump(ctx context.Context, table string, from hexutil.Bytes, to hexutil.Bytes, limit uint64, fromValue *hexutil.Bytes) (*DbDumpResult, error) {
+	if err := checkDbTable(table); err != nil {
+		return nil, err
+	}
+	if limit == 0 || limit > api.maxDump {
+		limit = api.maxDump
+	}
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var c kv.Cursor
+	var dc kv.CursorDupSort
+	if kv.ChaindataTablesCfg[table].Flags&kv.DupSort != 0 {
+		if dc, err = tx.CursorDupSort(table); err != nil {
+			return nil, err
+		}
+		c = dc
+	} else if c, err = tx.Cursor(table); err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	k, v, err := c.Seek(from)
+	if err != nil {
+		return nil, err
+	}
+	if dc != nil && fromValue != nil && k != nil && bytes.Equal(k, from) {
+		if v, err = dc.SeekBothRange(from, *fromValue); err != nil {
+			return nil, err
+		}
+		if v == nil {
+			// All the values of the key are before fromValue
+			if _, _, err = c.Seek(from); err != nil {
+				return nil, err
+			}
+			if k, v, err = dc.NextNoDup(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	result := &DbDumpResult{Entries: []DbDumpEntry{}}
+	for ; k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return nil, err
+		}
+		if len(to) > 0 && bytes.Compare(k, to) >= 0 {
+			break
+		}
+		if uint64(len(result.Entries)) >= limit {
+			result.Next = common.CopyBytes(k)
+			if dc != nil {
+				result.NextValue = common.CopyBytes(v)
+			}
+			break
+		}
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		result.Entries = append(result.Entries, DbDumpEntry{Key: common.CopyBytes(k), Value: common.CopyBytes(v)})
+	}
+	return result, nil
+}
+
+func checkDbTable(table string) error {
+	for _, t := range kv.ChaindataTables {
+		if t == table {
+			return nil
+		}
+	}
+	for _, t := range rawdb.OtsTables {
+		if t == table {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown table %s", table)
+}
@@ -0,0 +1,268 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/changeset"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/consensus/ethash"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/eth/tracers"
+	"github.com/ledgerwatch/erigon/ethdb"
+	"github.com/ledgerwatch/erigon/turbo/trie"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// intermediateRootsMaxDepth is the maximum number of blocks debug_intermediateRoots rewinds the hashed state over
+const intermediateRootsMaxDepth = 1024
+
+// IntermediateRoots implements debug_intermediateRoots. Returns the state root after each transaction of the block,
+// like Geth, without the block rewards. The hashed state and the trie are rewound in memory to the beginning of the
+// block from the change sets, then the transactions are re-executed and the root is updated after each of them from
+// the keys changed so far. config is accepted for compatibility with Geth and is ignored
+func (api *PrivateDebugAPIImpl) IntermediateRoots(ctx context.Context, blockHash common.Hash, config *tracers.TraceConfig) ([]common.Hash, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if api.historyV2(tx) {
+		return nil, fmt.Errorf("debug_intermediateRoots is not supported with history v2")
+	}
+	block, err := api.blockByHashWithSenders(tx, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block %x not found", blockHash)
+	}
+	blockNumber := block.NumberU64()
+	if blockNumber == 0 {
+		return []common.Hash{}, nil
+	}
+	trieProgress, err := stages.GetStageProgress(tx, stages.IntermediateHashes)
+	if err != nil {
+		return nil, err
+	}
+	hashStateProgress, err := stages.GetStageProgress(tx, stages.HashState)
+	if err != nil {
+		return nil, err
+	}
+	if hashStateProgress != trieProgress {
+		return nil, fmt.Errorf("hashed state is at block %d and trie at %d, try again later", hashStateProgress, trieProgress)
+	}
+	if blockNumber > trieProgress {
+		return nil, fmt.Errorf("block %d is not in the trie yet, it is at block %d", blockNumber, trieProgress)
+	}
+	if trieProgress-blockNumber >= intermediateRootsMaxDepth {
+		return nil, fmt.Errorf("block %d is too old, only the last %d blocks are supported", blockNumber, intermediateRootsMaxDepth)
+	}
+	parent, err := api._blockReader.Header(ctx, tx, block.ParentHash(), blockNumber-1)
+	if err != nil {
+		return nil, err
+	}
+	if parent == nil {
+		return nil, fmt.Errorf("header %d(%x) not found", blockNumber-1, block.ParentHash())
+	}
+
+	batch := memdb.NewMemoryBatch(tx)
+	defer batch.Rollback()
+	retained := map[string]bool{}
+	if err = rewindHashedState(tx, batch, blockNumber, trieProgress, retained); err != nil {
+		return nil, err
+	}
+	root, err := intermediateRoot(batch, retained, ctx.Done())
+	if err != nil {
+		return nil, err
+	}
+	if root != parent.Root {
+		return nil, fmt.Errorf("wrong trie root of block %d: %x, expected (from header): %x", blockNumber-1, root, parent.Root)
+	}
+
+	chainConfig, err := api.chainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	getHeader := func(hash common.Hash, number uint64) *types.Header {
+		h, e := api._blockReader.Header(ctx, tx, hash, number)
+		if e != nil {
+			log.Error("getHeader error", "number", number, "hash", hash, "err", e)
+		}
+		return h
+	}
+	contractHasTEVM := func(contractHash common.Hash) (bool, error) { return false, nil }
+	if api.TevmEnabled {
+		contractHasTEVM = ethdb.GetHasTEVM(tx)
+	}
+
+	ibs := state.New(api.historyStateReader(tx, blockNumber))
+	header := block.Header()
+	usedGas := new(uint64)
+	gp := new(core.GasPool).AddGas(block.GasLimit())
+	roots := make([]common.Hash, 0, len(block.Transactions()))
+	for i, txn := range block.Transactions() {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		ibs.Prepare(txn.Hash(), block.Hash(), i)
+		writer := &retainingStateWriter{DbStateWriter: state.NewDbStateWriter(batch, blockNumber), retained: retained}
+		if _, _, err = core.ApplyTransaction(chainConfig, core.GetHashFn(header, getHeader), ethash.NewFaker(), nil, gp, ibs, writer, header, txn, usedGas, vm.Config{}, contractHasTEVM); err != nil {
+			return nil, err
+		}
+		if root, err = intermediateRoot(batch, retained, ctx.Done()); err != nil {
+			return nil, err
+		}
+		roots = append(roots, root)
+	}
+	return roots, nil
+}
+
+// rewindHashedState writes into the batch the hashed state at the beginning of the block from, the same way as the
+// unwind of the HashState and IntermediateHashes stages from the block to. The changed keys are added to retained, the
+// value is true if the key is deleted
+func rewindHashedState(tx kv.Tx, batch kv.RwTx, from, to uint64, retained map[string]bool) error {
+	var staleStorageTries [][]byte
+	seen := map[string]struct{}{}
+	if err := changeset.ForRange(tx, kv.AccountChangeSet, from, to+1, func(_ uint64, k, v []byte) error {
+		if _, ok := seen[string(k)]; ok {
+			return nil
+		}
+		seen[string(k)] = struct{}{}
+		addrHash, err := common.HashData(k)
+		if err != nil {
+			return err
+		}
+		// The storage trie of an account which is self-destructed or re-created since the block is recomputed
+		current, err := batch.GetOne(kv.HashedAccounts, addrHash[:])
+		if err != nil {
+			return err
+		}
+		var acc, currentAcc accounts.Account
+		if err = acc.DecodeForStorage(v); err != nil {
+			return err
+		}
+		if err = currentAcc.DecodeForStorage(current); err != nil {
+			return err
+		}
+		if currentAcc.Incarnation > 0 && (len(v) == 0 || acc.Incarnation != currentAcc.Incarnation) {
+			staleStorageTries = append(staleStorageTries, common.CopyBytes(addrHash[:]))
+		}
+		retained[string(addrHash[:])] = len(v) == 0
+		if len(v) == 0 {
+			return batch.Delete(kv.HashedAccounts, addrHash[:])
+		}
+		if acc.Incarnation > 0 && acc.IsEmptyCodeHash() {
+			codeHash, err := tx.GetOne(kv.ContractCode, dbutils.GenerateStoragePrefix(addrHash[:], acc.Incarnation))
+			if err != nil {
+				return fmt.Errorf("adjusting codeHash for ks %x, inc %d: %w", addrHash, acc.Incarnation, err)
+			}
+			copy(acc.CodeHash[:], codeHash)
+		}
+		value := make([]byte, acc.EncodingLengthForStorage())
+		acc.EncodeForStorage(value)
+		return batch.Put(kv.HashedAccounts, addrHash[:], value)
+	}); err != nil {
+		return err
+	}
+	for _, addrHash := range staleStorageTries {
+		var keys [][]byte
+		if err := batch.ForPrefix(kv.TrieOfStorage, addrHash, func(k, _ []byte) error {
+			keys = append(keys, common.CopyBytes(k))
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := batch.Delete(kv.TrieOfStorage, k); err != nil {
+				return err
+			}
+		}
+	}
+
+	seen = map[string]struct{}{}
+	return changeset.ForRange(tx, kv.StorageChangeSet, from, to+1, func(_ uint64, k, v []byte) error {
+		if _, ok := seen[string(k)]; ok {
+			return nil
+		}
+		seen[string(k)] = struct{}{}
+		address, incarnation, location := dbutils.PlainParseCompositeStorageKey(k)
+		addrHash, err := common.HashData(address[:])
+		if err != nil {
+			return err
+		}
+		seckey, err := common.HashData(location[:])
+		if err != nil {
+			return err
+		}
+		compositeKey := dbutils.GenerateCompositeStorageKey(addrHash, incarnation, seckey)
+		retained[string(compositeKey)] = len(v) == 0
+		if len(v) == 0 {
+			return batch.Delete(kv.HashedStorage, compositeKey)
+		}
+		return batch.Put(kv.HashedStorage, compositeKey, v)
+	})
+}
+
+// intermediateRoot computes the state root of the hashed state in the batch, reusing the trie except for the paths of
+// the retained keys
+func intermediateRoot(batch kv.Tx, retained map[string]bool, quit <-chan struct{}) (common.Hash, error) {
+	rl := trie.NewRetainList(0)
+	for k, deleted := range retained {
+		rl.AddKeyWithMarker([]byte(k), deleted)
+	}
+	loader := trie.NewFlatDBTrieLoader("intermediateRoots")
+	if err := loader.Reset(rl, nil, nil, false); err != nil {
+		return trie.EmptyRoot, err
+	}
+	return loader.CalcTrieRoot(batch, []byte{}, quit)
+}
+
+// retainingStateWriter writes the hashed state like state.DbStateWriter and adds the changed keys to retained
+type retainingStateWriter struct {
+	*state.DbStateWriter
+	retained map[string]bool
+}
+
+func (w *retainingStateWriter) UpdateAccountData(address common.Address, original, account *accounts.Account) error {
+	addrHash, err := common.HashData(address[:])
+	if err != nil {
+		return err
+	}
+	w.retained[string(addrHash[:])] = false
+	return w.DbStateWriter.UpdateAccountData(address, original, account)
+}
+
+func (w *retainingStateWriter) DeleteAccount(address common.Address, original *accounts.Account) error {
+	addrHash, err := common.HashData(address[:])
+	if err != nil {
+		return err
+	}
+	w.retained[string(addrHash[:])] = true
+	return w.DbStateWriter.DeleteAccount(address, original)
+}
+
+func (w *retainingStateWriter) WriteAccountStorage(address common.Address, incarnation uint64, key *common.Hash, original, value *uint256.Int) error {
+	if *original != *value {
+		addrHash, err := common.HashData(address[:])
+		if err != nil {
+			return err
+		}
+		seckey, err := common.HashData(key[:])
+		if err != nil {
+			return err
+		}
+		w.retained[string(dbutils.GenerateCompositeStorageKey(addrHash, incarnation, seckey))] = value.IsZero()
+	}
+	return w.DbStateWriter.WriteAccountStorage(address, incarnation, key, original, value)
+}
@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/rpchelper"
+)
+
+// GetRawHeader implements debug_getRawHeader. Returns the RLP of the header, as it is stored in the snapshot segment
+// or in the database
+func (api *PrivateDebugAPIImpl) GetRawHeader(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	blockNumber, hash, _, err := rpchelper.GetBlockNumber(blockNrOrHash, tx, api.filters)
+	if err != nil {
+		return nil, err
+	}
+	return api.rawHeader(ctx, tx, hash, blockNumber)
+}
+
+// GetRawBlock implements debug_getRawBlock. Returns the RLP of the block, made of the header as it is stored and of
+// the body
+func (api *PrivateDebugAPIImpl) GetRawBlock(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	blockNumber, hash, _, err := rpchelper.GetBlockNumber(blockNrOrHash, tx, api.filters)
+	if err != nil {
+		return nil, err
+	}
+	headerRlp, err := api.rawHeader(ctx, tx, hash, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	bodyRlp, err := api._blockReader.BodyRlp(ctx, tx, hash, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	// The body is the list of the transactions and of the uncles, the block is the list of the header, the
+	// transactions and the uncles
+	bodyItems, _, err := rlp.SplitList(bodyRlp)
+	if err != nil {
+		return nil, fmt.Errorf("body %d(%x): %w", blockNumber, hash, err)
+	}
+	var buf bytes.Buffer
+	var b [33]byte
+	if err = types.EncodeStructSizePrefix(len(headerRlp)+len(bodyItems), &buf, b[:]); err != nil {
+		return nil, err
+	}
+	buf.Write(headerRlp)
+	buf.Write(bodyItems)
+	return buf.Bytes(), nil
+}
+
+// GetRawReceipts implements debug_getRawReceipts. Returns the consensus encoding of each receipt of the block, with
+// the type byte of the typed receipts
+func (api *PrivateDebugAPIImpl) GetRawReceipts(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) ([]hexutil.Bytes, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	chainConfig, err := api.chainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	blockNumber, hash, _, err := rpchelper.GetBlockNumber(blockNrOrHash, tx, api.filters)
+	if err != nil {
+		return nil, err
+	}
+	block, err := api.blockWithSenders(tx, hash, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block %d(%x) not found", blockNumber, hash)
+	}
+	receipts, err := api.getReceipts(ctx, tx, chainConfig, block, block.Body().SendersFromTxs())
+	if err != nil {
+		return nil, fmt.Errorf("getReceipts error: %w", err)
+	}
+	result := make([]hexutil.Bytes, len(receipts))
+	for i := range receipts {
+		var buf bytes.Buffer
+		receipts.EncodeIndex(i, &buf)
+		result[i] = buf.Bytes()
+	}
+	return result, nil
+}
+
+func (api *PrivateDebugAPIImpl) rawHeader(ctx context.Context, tx kv.Tx, hash common.Hash, blockNumber uint64) (hexutil.Bytes, error) {
+	headerRlp, err := api._blockReader.HeaderRlp(ctx, tx, hash, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if len(headerRlp) == 0 {
+		return nil, fmt.Errorf("header %d(%x) not found", blockNumber, hash)
+	}
+	return common.CopyBytes(headerRlp), nil
+}
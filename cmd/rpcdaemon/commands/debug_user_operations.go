@@ -0,0 +1,279 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/accounts/abi"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/common/math"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/eth/tracers"
+	"github.com/ledgerwatch/erigon/ethdb"
+	"github.com/ledgerwatch/erigon/internal/ethapi"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/rpchelper"
+	"github.com/ledgerwatch/erigon/turbo/transactions"
+)
+
+// entryPointABI is the part of the ABI of the ERC-4337 EntryPoint v0.6 used by debug_simulateUserOperations
+const entryPointABI = `[
+{"type":"function","name":"simulateValidation","inputs":[{"name":"userOp","type":"tuple","components":[
+	{"name":"sender","type":"address"},{"name":"nonce","type":"uint256"},{"name":"initCode","type":"bytes"},
+	{"name":"callData","type":"bytes"},{"name":"callGasLimit","type":"uint256"},{"name":"verificationGasLimit","type":"uint256"},
+	{"name":"preVerificationGas","type":"uint256"},{"name":"maxFeePerGas","type":"uint256"},{"name":"maxPriorityFeePerGas","type":"uint256"},
+	{"name":"paymasterAndData","type":"bytes"},{"name":"signature","type":"bytes"}]}],"outputs":[]},
+{"type":"error","name":"FailedOp","inputs":[{"name":"opIndex","type":"uint256"},{"name":"reason","type":"string"}]},
+{"type":"error","name":"ValidationResult","inputs":[
+	{"name":"returnInfo","type":"tuple","components":[{"name":"preOpGas","type":"uint256"},{"name":"prefund","type":"uint256"},
+		{"name":"sigFailed","type":"bool"},{"name":"validAfter","type":"uint48"},{"name":"validUntil","type":"uint48"},{"name":"paymasterContext","type":"bytes"}]},
+	{"name":"senderInfo","type":"tuple","components":[{"name":"stake","type":"uint256"},{"name":"unstakeDelaySec","type":"uint256"}]},
+	{"name":"factoryInfo","type":"tuple","components":[{"name":"stake","type":"uint256"},{"name":"unstakeDelaySec","type":"uint256"}]},
+	{"name":"paymasterInfo","type":"tuple","components":[{"name":"stake","type":"uint256"},{"name":"unstakeDelaySec","type":"uint256"}]}]}
+]`
+
+var entryPoint = func() abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(entryPointABI))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}()
+
+// UserOperation is an ERC-4337 v0.6 UserOperation in the format of the bundler RPC
+type UserOperation struct {
+	Sender               common.Address `json:"sender"`
+	Nonce                *hexutil.Big   `json:"nonce"`
+	InitCode             hexutil.Bytes  `json:"initCode"`
+	CallData             hexutil.Bytes  `json:"callData"`
+	CallGasLimit         *hexutil.Big   `json:"callGasLimit"`
+	VerificationGasLimit *hexutil.Big   `json:"verificationGasLimit"`
+	PreVerificationGas   *hexutil.Big   `json:"preVerificationGas"`
+	MaxFeePerGas         *hexutil.Big   `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big   `json:"maxPriorityFeePerGas"`
+	PaymasterAndData     hexutil.Bytes  `json:"paymasterAndData"`
+	Signature            hexutil.Bytes  `json:"signature"`
+}
+
+// userOperationABI is the UserOperation tuple of the EntryPoint
+type userOperationABI struct {
+	Sender               common.Address
+	Nonce                *big.Int
+	InitCode             []byte
+	CallData             []byte
+	CallGasLimit         *big.Int
+	VerificationGasLimit *big.Int
+	PreVerificationGas   *big.Int
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+	PaymasterAndData     []byte
+	Signature            []byte
+}
+
+type stakeInfoABI struct {
+	Stake           *big.Int
+	UnstakeDelaySec *big.Int
+}
+
+// validationResultABI are the arguments of the ValidationResult error of simulateValidation
+type validationResultABI struct {
+	ReturnInfo struct {
+		PreOpGas         *big.Int
+		Prefund          *big.Int
+		SigFailed        bool
+		ValidAfter       *big.Int
+		ValidUntil       *big.Int
+		PaymasterContext []byte
+	}
+	SenderInfo    stakeInfoABI
+	FactoryInfo   stakeInfoABI
+	PaymasterInfo stakeInfoABI
+}
+
+func (op *UserOperation) toABI() userOperationABI {
+	toBig := func(b *hexutil.Big) *big.Int {
+		if b == nil {
+			return new(big.Int)
+		}
+		return b.ToInt()
+	}
+	return userOperationABI{
+		Sender:               op.Sender,
+		Nonce:                toBig(op.Nonce),
+		InitCode:             op.InitCode,
+		CallData:             op.CallData,
+		CallGasLimit:         toBig(op.CallGasLimit),
+		VerificationGasLimit: toBig(op.VerificationGasLimit),
+		PreVerificationGas:   toBig(op.PreVerificationGas),
+		MaxFeePerGas:         toBig(op.MaxFeePerGas),
+		MaxPriorityFeePerGas: toBig(op.MaxPriorityFeePerGas),
+		PaymasterAndData:     op.PaymasterAndData,
+		Signature:            op.Signature,
+	}
+}
+
+// entities returns the factory and the paymaster of the operation, nil if it has none
+func (op *UserOperation) entities() (factory, paymaster *common.Address) {
+	if len(op.InitCode) >= common.AddressLength {
+		addr := common.BytesToAddress(op.InitCode[:common.AddressLength])
+		factory = &addr
+	}
+	if len(op.PaymasterAndData) >= common.AddressLength {
+		addr := common.BytesToAddress(op.PaymasterAndData[:common.AddressLength])
+		paymaster = &addr
+	}
+	return factory, paymaster
+}
+
+// UserOperationResult is the result of the simulation of a UserOperation by debug_simulateUserOperations
+type UserOperationResult struct {
+	Valid      bool         `json:"valid"`           // no error, no violation and a valid signature
+	Error      string       `json:"error,omitempty"` // the reason of FailedOp, or why simulateValidation failed otherwise
+	PreOpGas   *hexutil.Big `json:"preOpGas,omitempty"`
+	Prefund    *hexutil.Big `json:"prefund,omitempty"`
+	SigFailed  bool         `json:"sigFailed"`
+	ValidAfter *hexutil.Big `json:"validAfter,omitempty"`
+	ValidUntil *hexutil.Big `json:"validUntil,omitempty"`
+	Staked     []string     `json:"staked"`     // the staked entities among account, factory and paymaster
+	Violations []string     `json:"violations"` // the broken rules of ERC-7562
+}
+
+// SimulateUserOperations implements debug_simulateUserOperations. Runs EntryPoint.simulateValidation for each
+// UserOperation of a bundle on the latest state, on which the pending block is built, and checks the validation rules
+// of ERC-7562 which bundlers enforce: the forbidden opcodes, the access to the storage and to the addresses without
+// code, the calls to the EntryPoint, and across the bundle the access to the storage of the senders of the other
+// operations. An entity is staked if it has a stake of at least minStake (default: any) in the EntryPoint and an
+// unstake delay of at least minUnstakeDelay seconds (default: any)
+func (api *PrivateDebugAPIImpl) SimulateUserOperations(ctx context.Context, entryPointAddr common.Address, ops []UserOperation, minStake *hexutil.Big, minUnstakeDelay *hexutil.Uint64) ([]*UserOperationResult, error) {
+	dbtx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer dbtx.Rollback()
+	chainConfig, err := api.chainConfig(dbtx)
+	if err != nil {
+		return nil, err
+	}
+	latest := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+	blockNumber, hash, _, err := rpchelper.GetBlockNumber(latest, dbtx, api.filters)
+	if err != nil {
+		return nil, err
+	}
+	header, err := api._blockReader.Header(ctx, dbtx, hash, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("block %d(%x) not found", blockNumber, hash)
+	}
+	stateReader, err := api.stateReader(ctx, dbtx, latest)
+	if err != nil {
+		return nil, err
+	}
+	var baseFee *uint256.Int
+	if header.BaseFee != nil {
+		baseFee, _ = uint256.FromBig(header.BaseFee)
+	}
+	contractHasTEVM := func(contractHash common.Hash) (bool, error) { return false, nil }
+	if api.TevmEnabled {
+		contractHasTEVM = ethdb.GetHasTEVM(dbtx)
+	}
+	isStaked := func(info stakeInfoABI) bool {
+		if info.Stake == nil || info.Stake.Sign() == 0 || info.UnstakeDelaySec == nil || info.UnstakeDelaySec.Sign() == 0 {
+			return false
+		}
+		if minStake != nil && info.Stake.Cmp(minStake.ToInt()) < 0 {
+			return false
+		}
+		return minUnstakeDelay == nil || info.UnstakeDelaySec.Cmp(new(big.Int).SetUint64(uint64(*minUnstakeDelay))) >= 0
+	}
+
+	results := make([]*UserOperationResult, len(ops))
+	opTracers := make([]*tracers.UserOpTracer, len(ops))
+	for i := range ops {
+		op := &ops[i]
+		data, err := entryPoint.Pack("simulateValidation", op.toABI())
+		if err != nil {
+			return nil, fmt.Errorf("user operation %d: %w", i, err)
+		}
+		input := hexutil.Bytes(data)
+		args := ethapi.CallArgs{To: &entryPointAddr, Data: &input}
+		msg, err := args.ToMessage(api.GasCap, baseFee)
+		if err != nil {
+			return nil, err
+		}
+		factory, paymaster := op.entities()
+		tracer := tracers.NewUserOpTracer(entryPointAddr, op.Sender, factory, paymaster)
+		blockCtx, txCtx := transactions.GetEvmContext(msg, header, true, dbtx, contractHasTEVM, api._blockReader)
+		evm := vm.NewEVM(blockCtx, txCtx, state.New(stateReader), chainConfig, vm.Config{Debug: true, Tracer: tracer, NoBaseFee: true})
+		execResult, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(math.MaxUint64), true /* refunds */, false /* gasBailout */)
+		if err != nil {
+			return nil, fmt.Errorf("user operation %d: %w", i, err)
+		}
+		result := &UserOperationResult{Staked: []string{}}
+		staked := map[tracers.UserOpEntity]bool{}
+		revert := execResult.Revert()
+		switch {
+		case len(revert) >= 4 && bytes.Equal(revert[:4], entryPoint.Errors["ValidationResult"].ID[:4]):
+			var validation validationResultABI
+			values, err := entryPoint.Errors["ValidationResult"].Unpack(revert)
+			if err == nil {
+				err = entryPoint.Errors["ValidationResult"].Inputs.Copy(&validation, values.([]interface{}))
+			}
+			if err != nil {
+				return nil, fmt.Errorf("user operation %d: invalid ValidationResult: %w", i, err)
+			}
+			info := validation.ReturnInfo
+			result.PreOpGas, result.Prefund = (*hexutil.Big)(info.PreOpGas), (*hexutil.Big)(info.Prefund)
+			result.SigFailed = info.SigFailed
+			result.ValidAfter, result.ValidUntil = (*hexutil.Big)(info.ValidAfter), (*hexutil.Big)(info.ValidUntil)
+			staked[tracers.UserOpAccount] = isStaked(validation.SenderInfo)
+			staked[tracers.UserOpFactory] = factory != nil && isStaked(validation.FactoryInfo)
+			staked[tracers.UserOpPaymaster] = paymaster != nil && isStaked(validation.PaymasterInfo)
+			for _, entity := range []tracers.UserOpEntity{tracers.UserOpAccount, tracers.UserOpFactory, tracers.UserOpPaymaster} {
+				if staked[entity] {
+					result.Staked = append(result.Staked, string(entity))
+				}
+			}
+		case len(revert) >= 4 && bytes.Equal(revert[:4], entryPoint.Errors["FailedOp"].ID[:4]):
+			values, err := entryPoint.Errors["FailedOp"].Unpack(revert)
+			if err != nil {
+				return nil, fmt.Errorf("user operation %d: invalid FailedOp: %w", i, err)
+			}
+			result.Error = values.([]interface{})[1].(string)
+		case execResult.Err != nil:
+			result.Error = fmt.Sprintf("simulateValidation failed: %v", execResult.Err)
+		default:
+			result.Error = "simulateValidation did not revert, is it an EntryPoint v0.6?"
+		}
+		result.Violations = tracer.Violations(func(entity tracers.UserOpEntity) bool { return staked[entity] })
+		results[i], opTracers[i] = result, tracer
+	}
+
+	// An operation may not use the storage of the sender of another one, nor an entity which is the sender of another
+	// one, the bundle could invalidate itself
+	for i := range ops {
+		factory, paymaster := ops[i].entities()
+		for j := range ops {
+			if i == j {
+				continue
+			}
+			sender := ops[j].Sender
+			if sender != ops[i].Sender && opTracers[i].AccessesStorageOf(sender) {
+				results[i].Violations = append(results[i].Violations, fmt.Sprintf("accesses the storage of %x, the sender of the user operation %d", sender, j))
+			}
+			if (factory != nil && *factory == sender) || (paymaster != nil && *paymaster == sender) {
+				results[i].Violations = append(results[i].Violations, fmt.Sprintf("uses %x, the sender of the user operation %d, as an entity", sender, j))
+			}
+		}
+		results[i].Valid = results[i].Error == "" && !results[i].SigFailed && len(results[i].Violations) == 0
+	}
+	return results, nil
+}
@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/consensus/ethash"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/ethdb"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/rpchelper"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// ExecutionWitness implements debug_executionWitness. Returns the state accessed by the block, as it was before
+// the block (see state.StateWitness), RLP encoded. The block is re-executed on the historical state
+func (api *PrivateDebugAPIImpl) ExecutionWitness(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	chainConfig, err := api.chainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	blockNumber, hash, _, err := rpchelper.GetBlockNumber(blockNrOrHash, tx, api.filters)
+	if err != nil {
+		return nil, err
+	}
+	block, err := api.blockWithSenders(tx, hash, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block %d(%x) not found", blockNumber, hash)
+	}
+
+	getHeader := func(hash common.Hash, number uint64) *types.Header {
+		h, e := api._blockReader.Header(ctx, tx, hash, number)
+		if e != nil {
+			log.Error("getHeader error", "number", number, "hash", hash, "err", e)
+		}
+		return h
+	}
+	contractHasTEVM := func(contractHash common.Hash) (bool, error) { return false, nil }
+	if api.TevmEnabled {
+		contractHasTEVM = ethdb.GetHasTEVM(tx)
+	}
+
+	recorder := state.NewWitnessRecorder(api.historyStateReader(tx, blockNumber))
+	ibs := state.New(recorder)
+	header := block.Header()
+	usedGas := new(uint64)
+	gp := new(core.GasPool).AddGas(block.GasLimit())
+	noopWriter := state.NewNoopWriter()
+	for i, txn := range block.Transactions() {
+		ibs.Prepare(txn.Hash(), block.Hash(), i)
+		if _, _, err = core.ApplyTransaction(chainConfig, core.GetHashFn(header, getHeader), ethash.NewFaker(), nil, gp, ibs, noopWriter, header, txn, usedGas, vm.Config{}, contractHasTEVM); err != nil {
+			return nil, err
+		}
+	}
+	// Rewards are not applied by the faker, but the accounts receiving them are a part of the witness
+	ibs.GetBalance(block.Coinbase())
+	for _, uncle := range block.Uncles() {
+		ibs.GetBalance(uncle.Coinbase)
+	}
+	if err = ibs.Error(); err != nil {
+		return nil, err
+	}
+	return recorder.Witness().Encode()
+}
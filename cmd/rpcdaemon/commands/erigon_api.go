@@ -24,10 +24,14 @@ type ErigonAPI interface {
 	GetBlockByTimestamp(ctx context.Context, timeStamp rpc.Timestamp, fullTx bool) (map[string]interface{}, error)
 	GetBalanceChangesInBlock(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (map[common.Address]*hexutil.Big, error)
 
+	// State related (see ./erigon_state_diff.go)
+	GetStateDiff(ctx context.Context, fromBlock, toBlock rpc.BlockNumber) (map[common.Address]*ErigonAccountDiff, error)
+
 	// Receipt related (see ./erigon_receipts.go)
 	GetLogsByHash(ctx context.Context, hash common.Hash) ([][]*types.Log, error)
 	//GetLogsByNumber(ctx context.Context, number rpc.BlockNumber) ([][]*types.Log, error)
 	GetLogs(ctx context.Context, crit ethFilters.FilterCriteria) ([]*types.Log, error)
+	GetLatestLogs(ctx context.Context, crit ethFilters.FilterCriteria, logCount uint64) ([]*types.Log, error)
 
 	// WatchTheBurn / reward related (see ./erigon_issuance.go)
 	WatchTheBurn(ctx context.Context, blockNr rpc.BlockNumber) (Issuance, error)
@@ -37,6 +41,10 @@ type ErigonAPI interface {
 
 	// NodeInfo returns a collection of metadata known about the host.
 	NodeInfo(ctx context.Context) ([]p2p.NodeInfo, error)
+
+	// Pinned views of the database (see ./erigon_views.go)
+	PinView(ctx context.Context) (*PinnedView, error)
+	UnpinView(ctx context.Context, id string) (bool, error)
 }
 
 // ErigonImpl is implementation of the ErigonAPI interface
@@ -44,6 +52,10 @@ type ErigonImpl struct {
 	*BaseAPI
 	db         kv.RoDB
 	ethBackend rpchelper.ApiBackend
+
+	TimestampIndex bool // index the timestamps of the blocks in the snapshots for erigon_getBlockByTimestamp
+	timestamps     blockTimestamps
+	views          *rpchelper.PinnedViews // nil - erigon_pinView is disabled
 }
 
 // NewErigonAPI returns ErigonImpl instance
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"sync"
 
 	"github.com/holiman/uint256"
 	"github.com/ledgerwatch/erigon-lib/kv"
@@ -19,6 +20,7 @@ import (
 	"github.com/ledgerwatch/erigon/internal/ethapi"
 	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/erigon/turbo/rpchelper"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
 )
 
 // GetHeaderByNumber implements erigon_getHeaderByNumber. Returns a block's header given a block number ignoring the block's transaction and uncle list (may be faster).
@@ -74,6 +76,9 @@ func (api *ErigonImpl) GetHeaderByHash(ctx context.Context, hash common.Hash) (*
 	return header, nil
 }
 
+// GetBlockByTimestamp implements erigon_getBlockByTimestamp. Returns the first block with the given timestamp, or
+// the last block before it. The block is found by a binary search over the headers, narrowed by the in-memory index of
+// the timestamps of the blocks in the snapshots if TimestampIndex is set
 func (api *ErigonImpl) GetBlockByTimestamp(ctx context.Context, timeStamp rpc.Timestamp, fullTx bool) (map[string]interface{}, error) {
 	tx, err := api.db.BeginRo(ctx)
 	if err != nil {
@@ -99,63 +104,69 @@ func (api *ErigonImpl) GetBlockByTimestamp(ctx context.Context, timeStamp rpc.Ti
 	firstHeaderTime := firstHeader.Time
 
 	if currenttHeaderTime <= uintTimestamp {
-		blockResponse, err := buildBlockResponse(tx, highestNumber, fullTx)
-		if err != nil {
-			return nil, err
-		}
-
-		return blockResponse, nil
+		return api.buildBlockResponse(tx, highestNumber, fullTx)
 	}
 
 	if firstHeaderTime >= uintTimestamp {
-		blockResponse, err := buildBlockResponse(tx, 0, fullTx)
-		if err != nil {
-			return nil, err
-		}
-
-		return blockResponse, nil
+		return api.buildBlockResponse(tx, 0, fullTx)
 	}
 
-	blockNum := sort.Search(int(currentHeader.Number.Uint64()), func(blockNum int) bool {
-		currentHeader, err := api._blockReader.HeaderByNumber(ctx, tx, uint64(blockNum))
+	headerTime := func(blockNum uint64) (uint64, error) {
+		header, err := api._blockReader.HeaderByNumber(ctx, tx, blockNum)
 		if err != nil {
-			return false
+			return 0, err
 		}
-
-		if currentHeader == nil {
-			return false
+		if header == nil {
+			return 0, fmt.Errorf("no header found with header number: %d", blockNum)
 		}
-
-		return currentHeader.Time >= uintTimestamp
-	})
-
-	resultingHeader, err := api._blockReader.HeaderByNumber(ctx, tx, uint64(blockNum))
-	if err != nil {
-		return nil, err
+		return header.Time, nil
 	}
 
-	if resultingHeader == nil {
-		return nil, fmt.Errorf("no header found with header number: %d", blockNum)
+	// The first block with the timestamp or after it is in (low, high]
+	low, high, highTime := uint64(0), highestNumber, currenttHeaderTime
+	if api.TimestampIndex {
+		if snapshots := api.snapshots(); snapshots != nil {
+			if err = api.timestamps.update(snapshots.BlocksAvailable(), headerTime); err != nil {
+				return nil, err
+			}
+			low, high, highTime = api.timestamps.narrow(uintTimestamp, low, high, highTime)
+		}
 	}
-
-	if resultingHeader.Time > uintTimestamp {
-		response, err := buildBlockResponse(tx, uint64(blockNum)-1, fullTx)
+	for low+1 < high {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		mid := low + (high-low)/2
+		midTime, err := headerTime(mid)
 		if err != nil {
 			return nil, err
 		}
-		return response, nil
+		if midTime >= uintTimestamp {
+			high, highTime = mid, midTime
+		} else {
+			low = mid
+		}
 	}
 
-	response, err := buildBlockResponse(tx, uint64(blockNum), fullTx)
-	if err != nil {
-		return nil, err
+	if highTime > uintTimestamp {
+		return api.buildBlockResponse(tx, high-1, fullTx)
 	}
+	return api.buildBlockResponse(tx, high, fullTx)
+}
 
-	return response, nil
+// snapshots returns the snapshots of the block reader, nil if the blocks are read only from the database
+func (api *ErigonImpl) snapshots() *snapshotsync.RoSnapshots {
+	reader, ok := api._blockReader.(interface {
+		Snapshots() *snapshotsync.RoSnapshots
+	})
+	if !ok || reader.Snapshots() == nil || !reader.Snapshots().Cfg().Enabled {
+		return nil
+	}
+	return reader.Snapshots()
 }
 
-func buildBlockResponse(db kv.Tx, blockNum uint64, fullTx bool) (map[string]interface{}, error) {
-	block, err := rawdb.ReadBlockByNumber(db, blockNum)
+func (api *ErigonImpl) buildBlockResponse(tx kv.Tx, blockNum uint64, fullTx bool) (map[string]interface{}, error) {
+	block, err := api.blockByNumberWithSenders(tx, blockNum)
 	if err != nil {
 		return nil, err
 	}
@@ -175,6 +186,45 @@ func buildBlockResponse(db kv.Tx, blockNum uint64, fullTx bool) (map[string]inte
 	return response, err
 }
 
+// timestampIndexStep is the distance between the blocks in the index of timestamps
+const timestampIndexStep = 1024
+
+// blockTimestamps is the index of the timestamps of the blocks in the snapshots, which never change: times[i] is the
+// timestamp of the block i*timestampIndexStep. It is extended as the snapshots grow
+type blockTimestamps struct {
+	lock  sync.RWMutex
+	times []uint64
+}
+
+// update adds to the index the blocks up to frozen
+func (ti *blockTimestamps) update(frozen uint64, headerTime func(blockNum uint64) (uint64, error)) error {
+	ti.lock.Lock()
+	defer ti.lock.Unlock()
+	for blockNum := uint64(len(ti.times)) * timestampIndexStep; blockNum <= frozen; blockNum += timestampIndexStep {
+		t, err := headerTime(blockNum)
+		if err != nil {
+			return err
+		}
+		ti.times = append(ti.times, t)
+	}
+	return nil
+}
+
+// narrow returns the range (low, high] of the first block with the timestamp ts or after it, the indexed part of the
+// given range. highTime is the timestamp of the block high
+func (ti *blockTimestamps) narrow(ts, low, high, highTime uint64) (uint64, uint64, uint64) {
+	ti.lock.RLock()
+	defer ti.lock.RUnlock()
+	i := sort.Search(len(ti.times), func(i int) bool { return ti.times[i] >= ts })
+	if i > 0 && uint64(i-1)*timestampIndexStep > low {
+		low = uint64(i-1) * timestampIndexStep
+	}
+	if i < len(ti.times) && uint64(i)*timestampIndexStep < high {
+		high, highTime = uint64(i)*timestampIndexStep, ti.times[i]
+	}
+	return low, high, highTime
+}
+
 func (api *ErigonImpl) GetBalanceChangesInBlock(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (map[common.Address]*hexutil.Big, error) {
 	tx, err := api.db.BeginRo(ctx)
 	if err != nil {
@@ -199,7 +249,7 @@ func (api *ErigonImpl) GetBalanceChangesInBlock(ctx context.Context, blockNrOrHa
 
 	balancesMapping := make(map[common.Address]*hexutil.Big)
 
-	newReader, err := rpchelper.CreateStateReader(ctx, tx, blockNrOrHash, api.filters, api.stateCache)
+	newReader, err := api.stateReader(ctx, tx, blockNrOrHash)
 	if err != nil {
 		return nil, err
 	}
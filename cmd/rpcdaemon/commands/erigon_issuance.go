@@ -101,7 +101,15 @@ func (api *ErigonImpl) WatchTheBurn(ctx context.Context, blockNr rpc.BlockNumber
 	tips := big.NewInt(0)
 
 	if header.BaseFee != nil {
-		receipts, err := rawdb.ReadReceiptsByHash(tx, header.Hash())
+		// receipts of the retired blocks are only in the snapshots
+		block, err := api.blockByNumberWithSenders(tx, uint64(blockNr))
+		if err != nil {
+			return Issuance{}, err
+		}
+		if block == nil {
+			return Issuance{}, fmt.Errorf("could not find block %d", uint64(blockNr))
+		}
+		receipts, err := api.getReceipts(ctx, tx, chainConfig, block, block.Body().SendersFromTxs())
 		if err != nil {
 			return Issuance{}, err
 		}
@@ -99,6 +99,121 @@ func (api *ErigonImpl) GetLogs(ctx context.Context, crit filters.FilterCriteria)
 	if end > roaring.MaxUint32 {
 		return nil, fmt.Errorf("end (%d) > MaxUint32", end)
 	}
+	blockNumbers, err := logsBlockNumbers(tx, crit, begin, end)
+	if err != nil {
+		return nil, err
+	}
+	if blockNumbers.GetCardinality() == 0 {
+		return logs, nil
+	}
+
+	iter := blockNumbers.Iterator()
+	for iter.HasNext() {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		blockLogs, err := api.blockLogs(ctx, tx, uint64(iter.Next()), crit)
+		if err != nil {
+			return logs, err
+		}
+		logs = append(logs, blockLogs...)
+	}
+
+	return logs, nil
+}
+
+// latestLogsWindow is the number of blocks whose log indices are read at once by erigon_getLatestLogs
+const latestLogsWindow = 100_000
+
+// GetLatestLogs implements erigon_getLatestLogs. Returns the logCount most recent logs matching the filter, in the
+// order of the chain. The log indices are walked backwards from toBlock (default: latest) down to fromBlock
+// (default: 0), so there is no need to guess a fromBlock
+func (api *ErigonImpl) GetLatestLogs(ctx context.Context, crit filters.FilterCriteria, logCount uint64) ([]*types.Log, error) {
+	if logCount == 0 {
+		return nil, fmt.Errorf("logCount must be greater than 0")
+	}
+	if crit.BlockHash != nil {
+		return nil, fmt.Errorf("blockHash is not supported, use erigon_getLogs")
+	}
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	latest, err := rpchelper.GetLatestBlockNumber(tx)
+	if err != nil {
+		return nil, err
+	}
+	var begin uint64
+	if crit.FromBlock != nil {
+		if crit.FromBlock.Sign() >= 0 {
+			begin = crit.FromBlock.Uint64()
+		} else if !crit.FromBlock.IsInt64() || crit.FromBlock.Int64() != int64(rpc.LatestBlockNumber) {
+			return nil, fmt.Errorf("negative value for FromBlock: %v", crit.FromBlock)
+		} else {
+			begin = latest
+		}
+	}
+	end := latest
+	if crit.ToBlock != nil {
+		if crit.ToBlock.Sign() >= 0 {
+			end = crit.ToBlock.Uint64()
+		} else if !crit.ToBlock.IsInt64() || crit.ToBlock.Int64() != int64(rpc.LatestBlockNumber) {
+			return nil, fmt.Errorf("negative value for ToBlock: %v", crit.ToBlock)
+		}
+	}
+	if end < begin {
+		return nil, fmt.Errorf("end (%d) < begin (%d)", end, begin)
+	}
+	if end > roaring.MaxUint32 {
+		return nil, fmt.Errorf("end (%d) > MaxUint32", end)
+	}
+
+	// Blocks of logs, from the most recent one
+	var latestLogs [][]*types.Log
+	var count uint64
+	for windowEnd := end; count < logCount; windowEnd -= latestLogsWindow {
+		windowBegin := begin
+		if windowEnd-begin >= latestLogsWindow {
+			windowBegin = windowEnd - latestLogsWindow + 1
+		}
+		blockNumbers, err := logsBlockNumbers(tx, crit, windowBegin, windowEnd)
+		if err != nil {
+			return nil, err
+		}
+		iter := blockNumbers.ReverseIterator()
+		for iter.HasNext() && count < logCount {
+			if err = ctx.Err(); err != nil {
+				return nil, err
+			}
+			blockLogs, err := api.blockLogs(ctx, tx, uint64(iter.Next()), crit)
+			if err != nil {
+				return nil, err
+			}
+			if uint64(len(blockLogs)) > logCount-count {
+				blockLogs = blockLogs[uint64(len(blockLogs))-(logCount-count):]
+			}
+			if len(blockLogs) > 0 {
+				latestLogs = append(latestLogs, blockLogs)
+				count += uint64(len(blockLogs))
+			}
+		}
+		if windowBegin == begin {
+			break
+		}
+	}
+
+	logs := make([]*types.Log, 0, count)
+	for i := len(latestLogs) - 1; i >= 0; i-- {
+		logs = append(logs, latestLogs[i]...)
+	}
+	return logs, nil
+}
+
+// logsBlockNumbers returns the numbers of the blocks in [begin, end] which may have logs matching the criteria,
+// according to the log indices
+func logsBlockNumbers(tx kv.Tx, crit filters.FilterCriteria, begin, end uint64) (*roaring.Bitmap, error) {
 	blockNumbers := roaring.New()
 	blockNumbers.AddRange(begin, end+1) // [min,max)
 
@@ -126,80 +241,78 @@ func (api *ErigonImpl) GetLogs(ctx context.Context, crit filters.FilterCriteria)
 	if addrBitmap != nil {
 		blockNumbers.And(addrBitmap)
 	}
+	return blockNumbers, nil
+}
 
-	if blockNumbers.GetCardinality() == 0 {
-		return logs, nil
-	}
-
-	iter := blockNumbers.Iterator()
-	for iter.HasNext() {
-		if err = ctx.Err(); err != nil {
-			return nil, err
+// blockLogs returns the logs of the block matching the criteria, with all their fields set
+func (api *ErigonImpl) blockLogs(ctx context.Context, tx kv.Tx, blockNumber uint64, crit filters.FilterCriteria) ([]*types.Log, error) {
+	var logIndex uint
+	var txIndex uint
+	var blockLogs []*types.Log
+	found := false
+	err := tx.ForPrefix(kv.Log, dbutils.EncodeBlockNumber(blockNumber), func(k, v []byte) error {
+		found = true
+		var logs types.Logs
+		if err := cbor.Unmarshal(&logs, bytes.NewReader(v)); err != nil {
+			return fmt.Errorf("receipt unmarshal failed:  %w", err)
 		}
-
-		blockNumber := uint64(iter.Next())
-		var logIndex uint
-		var txIndex uint
-		var blockLogs []*types.Log
-		err := tx.ForPrefix(kv.Log, dbutils.EncodeBlockNumber(blockNumber), func(k, v []byte) error {
-			var logs types.Logs
-			if err := cbor.Unmarshal(&logs, bytes.NewReader(v)); err != nil {
-				return fmt.Errorf("receipt unmarshal failed:  %w", err)
-			}
-			for _, log := range logs {
-				log.Index = logIndex
-				logIndex++
-			}
-			filtered := filterLogs(logs, crit.Addresses, crit.Topics)
-			if len(filtered) == 0 {
-				return nil
-			}
-			txIndex = uint(binary.BigEndian.Uint32(k[8:]))
-			for _, log := range filtered {
-				log.TxIndex = txIndex
-			}
-			blockLogs = append(blockLogs, filtered...)
-
+		for _, log := range logs {
+			log.Index = logIndex
+			logIndex++
+		}
+		filtered := filterLogs(logs, crit.Addresses, crit.Topics)
+		if len(filtered) == 0 {
 			return nil
-		})
-		if err != nil {
-			return logs, err
 		}
-		if len(blockLogs) == 0 {
-			continue
+		txIndex = uint(binary.BigEndian.Uint32(k[8:]))
+		for _, log := range filtered {
+			log.TxIndex = txIndex
 		}
+		blockLogs = append(blockLogs, filtered...)
 
-		header, err := api._blockReader.HeaderByNumber(ctx, tx, blockNumber)
-		if err != nil {
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		// the index says the block has matching logs, so they have been pruned or retired into the snapshots
+		if blockLogs, err = api.regeneratedLogs(ctx, tx, blockNumber, crit); err != nil {
 			return nil, err
 		}
-		if header == nil {
-			return nil, fmt.Errorf("block header not found: %d", blockNumber)
-		}
-		timestamp := header.Time
+	}
+	if len(blockLogs) == 0 {
+		return nil, nil
+	}
 
-		blockHash, err := rawdb.ReadCanonicalHash(tx, blockNumber)
-		if err != nil {
-			return nil, err
-		}
+	header, err := api._blockReader.HeaderByNumber(ctx, tx, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("block header not found: %d", blockNumber)
+	}
+	timestamp := header.Time
 
-		body, err := api._blockReader.BodyWithTransactions(ctx, tx, blockHash, blockNumber)
-		if err != nil {
-			return nil, err
-		}
-		if body == nil {
-			return nil, fmt.Errorf("block not found %d", blockNumber)
-		}
-		for _, log := range blockLogs {
-			log.Timestamp = timestamp
-			log.BlockNumber = blockNumber
-			log.BlockHash = blockHash
-			log.TxHash = body.Transactions[log.TxIndex].Hash()
-		}
-		logs = append(logs, blockLogs...)
+	blockHash, err := rawdb.ReadCanonicalHash(tx, blockNumber)
+	if err != nil {
+		return nil, err
 	}
 
-	return logs, nil
+	body, err := api._blockReader.BodyWithTransactions(ctx, tx, blockHash, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return nil, fmt.Errorf("block not found %d", blockNumber)
+	}
+	for _, log := range blockLogs {
+		log.Timestamp = timestamp
+		log.BlockNumber = blockNumber
+		log.BlockHash = blockHash
+		log.TxHash = body.Transactions[log.TxIndex].Hash()
+	}
+	return blockLogs, nil
 }
 
 // GetLogsByNumber implements erigon_getLogsByHash. Returns all the logs that appear in a block given the block's hash.
@@ -0,0 +1,34 @@
+package commands
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/rpcdaemontest"
+	"github.com/ledgerwatch/erigon/eth/filters"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetLatestLogs(t *testing.T) {
+	db := rpcdaemontest.CreateTestKV(t)
+	stateCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	api := NewErigonAPI(NewBaseApi(nil, stateCache, snapshotsync.NewBlockReader(), nil, nil, false), db, nil)
+
+	all, err := api.GetLogs(context.Background(), filters.FilterCriteria{FromBlock: big.NewInt(0)})
+	require.NoError(t, err)
+	require.Greater(t, len(all), 3)
+
+	latest, err := api.GetLatestLogs(context.Background(), filters.FilterCriteria{}, 3)
+	require.NoError(t, err)
+	require.Equal(t, all[len(all)-3:], latest)
+
+	latest, err = api.GetLatestLogs(context.Background(), filters.FilterCriteria{}, uint64(len(all))+10)
+	require.NoError(t, err)
+	require.Equal(t, all, latest)
+
+	_, err = api.GetLatestLogs(context.Background(), filters.FilterCriteria{}, 0)
+	require.Error(t, err)
+}
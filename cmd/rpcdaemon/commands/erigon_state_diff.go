@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/rpchelper"
+)
+
+// ErigonAccountDiff is the change of an account. Before or After is nil if the account did not exist
+type ErigonAccountDiff struct {
+	Before  *ErigonAccountState               `json:"before"`
+	After   *ErigonAccountState               `json:"after"`
+	Storage map[common.Hash]ErigonStorageDiff `json:"storage,omitempty"`
+}
+
+type ErigonAccountState struct {
+	Balance  *hexutil.Big   `json:"balance"`
+	Nonce    hexutil.Uint64 `json:"nonce"`
+	CodeHash common.Hash    `json:"codeHash"`
+}
+
+type ErigonStorageDiff struct {
+	Before common.Hash `json:"before"`
+	After  common.Hash `json:"after"`
+}
+
+func newErigonAccountState(a *accounts.Account) *ErigonAccountState {
+	if a == nil {
+		return nil
+	}
+	return &ErigonAccountState{Balance: (*hexutil.Big)(a.Balance.ToBig()), Nonce: hexutil.Uint64(a.Nonce), CodeHash: a.CodeHash}
+}
+
+// GetStateDiff implements erigon_getStateDiff. Returns the accounts and storage changed by the blocks after fromBlock
+// up to toBlock (inclusive), computed from the history without re-executing the blocks. Requires history v2
+func (api *ErigonImpl) GetStateDiff(ctx context.Context, fromBlock, toBlock rpc.BlockNumber) (map[common.Address]*ErigonAccountDiff, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if !api.historyV2(tx) || api._agg == nil || api._txNums == nil {
+		return nil, fmt.Errorf("erigon_getStateDiff requires history v2")
+	}
+	from, _, _, err := rpchelper.GetBlockNumber(rpc.BlockNumberOrHashWithNumber(fromBlock), tx, api.filters)
+	if err != nil {
+		return nil, err
+	}
+	to, _, _, err := rpchelper.GetBlockNumber(rpc.BlockNumberOrHashWithNumber(toBlock), tx, api.filters)
+	if err != nil {
+		return nil, err
+	}
+	if from > to {
+		return nil, fmt.Errorf("fromBlock %d is after toBlock %d", from, to)
+	}
+	if to > api._txNums.LastBlockNum() {
+		return nil, fmt.Errorf("toBlock %d is not executed yet", to)
+	}
+
+	ac := api._agg.MakeContext()
+	ac.SetTx(tx)
+	// The state after the block is the state before the first txNum of the next one
+	diff, err := state.StateDiff(tx, ac, api._txNums.MaxOf(from)+1, api._txNums.MaxOf(to)+1)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[common.Address]*ErigonAccountDiff, len(diff))
+	for address, d := range diff {
+		account := &ErigonAccountDiff{Before: newErigonAccountState(d.Before), After: newErigonAccountState(d.After)}
+		if len(d.Storage) > 0 {
+			account.Storage = make(map[common.Hash]ErigonStorageDiff, len(d.Storage))
+			for location, s := range d.Storage {
+				account.Storage[location] = ErigonStorageDiff{Before: common.BytesToHash(s.Before), After: common.BytesToHash(s.After)}
+			}
+		}
+		result[address] = account
+	}
+	return result, nil
+}
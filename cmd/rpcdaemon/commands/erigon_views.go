@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/turbo/rpchelper"
+)
+
+var errPinnedViewsDisabled = errors.New("pinned views are disabled, see --rpc.views.max")
+
+// PinnedView is the database view pinned by erigon_pinView
+type PinnedView struct {
+	ID          string         `json:"id"`          // value of the X-Erigon-View header of the requests reading the view
+	TxID        hexutil.Uint64 `json:"txId"`        // id of the read transaction of the view
+	BlockNumber hexutil.Uint64 `json:"blockNumber"` // latest block of the view
+}
+
+// PinView implements erigon_pinView. Pins a view of the database, which the requests with its id in the
+// rpc.ViewHeader read instead of the latest one until it's unpinned or not used for --rpc.views.ttl
+func (api *ErigonImpl) PinView(ctx context.Context) (*PinnedView, error) {
+	if api.views == nil {
+		return nil, errPinnedViewsDisabled
+	}
+	id, err := api.views.Pin()
+	if err != nil {
+		return nil, err
+	}
+	view := &PinnedView{ID: id}
+	if err := api.views.View(ctx, id, func(tx kv.Tx) error {
+		blockNum, err := rpchelper.GetLatestBlockNumber(tx)
+		if err != nil {
+			return err
+		}
+		view.TxID, view.BlockNumber = hexutil.Uint64(tx.ViewID()), hexutil.Uint64(blockNum)
+		return nil
+	}); err != nil {
+		api.views.Unpin(id)
+		return nil, err
+	}
+	return view, nil
+}
+
+// UnpinView implements erigon_unpinView. Releases a view pinned by erigon_pinView, returns false if it's not pinned
+func (api *ErigonImpl) UnpinView(_ context.Context, id string) (bool, error) {
+	if api.views == nil {
+		return false, errPinnedViewsDisabled
+	}
+	return api.views.Unpin(id), nil
+}
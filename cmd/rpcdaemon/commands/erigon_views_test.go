@@ -0,0 +1,72 @@
+package commands
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/rpcdaemontest"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/rpchelper"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPinView(t *testing.T) {
+	m, _, _ := rpcdaemontest.CreateTestSentry(t)
+	views := rpchelper.NewPinnedViews(m.DB, 1, time.Minute)
+	api := NewErigonAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), nil, nil, false), views.DB(), nil)
+	api.views = views
+	ctx := context.Background()
+
+	view, err := api.PinView(ctx)
+	require.NoError(t, err)
+	var latest uint64
+	require.NoError(t, m.DB.View(ctx, func(tx kv.Tx) (err error) {
+		latest, err = rpchelper.GetLatestBlockNumber(tx)
+		return err
+	}))
+	require.Equal(t, hexutil.Uint64(latest), view.BlockNumber)
+
+	_, err = api.PinView(ctx)
+	require.Error(t, err, "more views than --rpc.views.max")
+
+	// A write after pinning is seen by the requests without the view only
+	key := []byte("pinned_view_test")
+	require.NoError(t, m.DB.Update(ctx, func(tx kv.RwTx) error { return tx.Put(kv.DatabaseInfo, key, []byte{1}) }))
+	read := func(ctx context.Context) (v []byte, err error) {
+		err = api.db.View(ctx, func(tx kv.Tx) error {
+			v, err = tx.GetOne(kv.DatabaseInfo, key)
+			v = common.CopyBytes(v)
+			return err
+		})
+		return v, err
+	}
+	v, err := read(rpc.ContextWithView(ctx, view.ID))
+	require.NoError(t, err)
+	require.Nil(t, v)
+	v, err = read(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1}, v)
+
+	ok, err := api.UnpinView(ctx, view.ID)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = api.UnpinView(ctx, view.ID)
+	require.NoError(t, err)
+	require.False(t, ok)
+	_, err = read(rpc.ContextWithView(ctx, view.ID))
+	require.Error(t, err)
+
+	// An unused view expires after the ttl, each use restarts it
+	views = rpchelper.NewPinnedViews(m.DB, 1, 10*time.Millisecond)
+	id, err := views.Pin()
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return views.View(ctx, id, func(kv.Tx) error { return nil }) != nil
+	}, time.Second, 50*time.Millisecond)
+}
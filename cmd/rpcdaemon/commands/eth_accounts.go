@@ -6,13 +6,16 @@ import (
 	"math/big"
 
 	"github.com/ledgerwatch/erigon-lib/gointerfaces"
-	"github.com/ledgerwatch/erigon/turbo/rpchelper"
 	"google.golang.org/grpc"
 
 	txpool_proto "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
 	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/rpchelper"
+	"github.com/ledgerwatch/erigon/turbo/trie"
 )
 
 // GetBalance implements eth_getBalance. Returns the balance of an account for a given address.
@@ -22,7 +25,7 @@ func (api *APIImpl) GetBalance(ctx context.Context, address common.Address, bloc
 		return nil, fmt.Errorf("getBalance cannot open tx: %w", err1)
 	}
 	defer tx.Rollback()
-	reader, err := rpchelper.CreateStateReader(ctx, tx, blockNrOrHash, api.filters, api.stateCache)
+	reader, err := api.stateReader(ctx, tx, blockNrOrHash)
 	if err != nil {
 		return nil, err
 	}
@@ -58,7 +61,7 @@ func (api *APIImpl) GetTransactionCount(ctx context.Context, address common.Addr
 		return nil, fmt.Errorf("getTransactionCount cannot open tx: %w", err1)
 	}
 	defer tx.Rollback()
-	reader, err := rpchelper.CreateStateReader(ctx, tx, blockNrOrHash, api.filters, api.stateCache)
+	reader, err := api.stateReader(ctx, tx, blockNrOrHash)
 	if err != nil {
 		return nil, err
 	}
@@ -77,7 +80,7 @@ func (api *APIImpl) GetCode(ctx context.Context, address common.Address, blockNr
 		return nil, fmt.Errorf("getCode cannot open tx: %w", err1)
 	}
 	defer tx.Rollback()
-	reader, err := rpchelper.CreateStateReader(ctx, tx, blockNrOrHash, api.filters, api.stateCache)
+	reader, err := api.stateReader(ctx, tx, blockNrOrHash)
 	if err != nil {
 		return nil, err
 	}
@@ -103,7 +106,7 @@ func (api *APIImpl) GetStorageAt(ctx context.Context, address common.Address, in
 	}
 	defer tx.Rollback()
 
-	reader, err := rpchelper.CreateStateReader(ctx, tx, blockNrOrHash, api.filters, api.stateCache)
+	reader, err := api.stateReader(ctx, tx, blockNrOrHash)
 	if err != nil {
 		return hexutil.Encode(common.LeftPadBytes(empty, 32)), err
 	}
@@ -119,3 +122,61 @@ func (api *APIImpl) GetStorageAt(ctx context.Context, address common.Address, in
 	}
 	return hexutil.Encode(common.LeftPadBytes(res, 32)), err
 }
+
+// AccountInfo is the result of eth_getAccount
+type AccountInfo struct {
+	Balance     *hexutil.Big   `json:"balance"`
+	Nonce       hexutil.Uint64 `json:"nonce"`
+	CodeHash    common.Hash    `json:"codeHash"`
+	StorageRoot common.Hash    `json:"storageRoot"`
+}
+
+// GetAccount implements eth_getAccount. Returns the balance, nonce, code hash and storage root of an account at a
+// given block. The storage roots are not kept with the plain state, so it is computed from the storage of the account
+// as of the block, which takes time for the contracts with a large storage
+func (api *APIImpl) GetAccount(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*AccountInfo, error) {
+	tx, err1 := api.db.BeginRo(ctx)
+	if err1 != nil {
+		return nil, fmt.Errorf("getAccount cannot open tx: %w", err1)
+	}
+	defer tx.Rollback()
+	blockNumber, _, _, err := rpchelper.GetBlockNumber(blockNrOrHash, tx, api.filters)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := api.stateReader(ctx, tx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+
+	acc, err := reader.ReadAccountData(address)
+	if err != nil {
+		return nil, fmt.Errorf("cant get account %x: %w", address.String(), err)
+	}
+	if acc == nil {
+		// Special case - non-existent account is assumed to be empty
+		empty := accounts.NewAccount()
+		acc = &empty
+	}
+	result := &AccountInfo{
+		Balance:     (*hexutil.Big)(acc.Balance.ToBig()),
+		Nonce:       hexutil.Uint64(acc.Nonce),
+		CodeHash:    acc.CodeHash,
+		StorageRoot: trie.EmptyRoot,
+	}
+	if acc.Incarnation == 0 {
+		// only contracts have storage
+		return result, nil
+	}
+
+	storage := trie.New(common.Hash{})
+	if err = state.WalkAsOfStorage(tx, address, acc.Incarnation, common.Hash{}, blockNumber+1, func(_, loc, vs []byte) (bool, error) {
+		h, _ := common.HashData(loc)
+		storage.Update(h.Bytes(), common.CopyBytes(vs))
+		return true, nil
+	}); err != nil {
+		return nil, fmt.Errorf("walking over storage for %x: %w", address, err)
+	}
+	result.StorageRoot = storage.Hash()
+	return result, nil
+}
@@ -0,0 +1,53 @@
+package commands
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/rpcdaemontest"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAccount(t *testing.T) {
+	db := rpcdaemontest.CreateTestKV(t)
+	stateCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	api := NewEthAPI(NewBaseApi(nil, stateCache, snapshotsync.NewBlockReader(), nil, nil, false), db, nil, nil, nil, 5000000)
+	ctx, latest := context.Background(), rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+
+	sender := common.HexToAddress("0x71562b71999873DB5b286dF957af199Ec94617F7")
+	account, err := api.GetAccount(ctx, sender, latest)
+	require.NoError(t, err)
+	balance, err := api.GetBalance(ctx, sender, latest)
+	require.NoError(t, err)
+	nonce, err := api.GetTransactionCount(ctx, sender, latest)
+	require.NoError(t, err)
+	require.Equal(t, balance.ToInt(), account.Balance.ToInt())
+	require.Equal(t, *nonce, account.Nonce)
+	require.Equal(t, crypto.Keccak256Hash(nil), account.CodeHash)
+	require.Equal(t, trie.EmptyRoot, account.StorageRoot)
+
+	// the token contract is deployed in block 3 and minted in block 4
+	token := crypto.CreateAddress(sender, 2)
+	account, err = api.GetAccount(ctx, token, rpc.BlockNumberOrHashWithNumber(2))
+	require.NoError(t, err)
+	require.Equal(t, crypto.Keccak256Hash(nil), account.CodeHash)
+	require.Equal(t, trie.EmptyRoot, account.StorageRoot)
+
+	deployed, err := api.GetAccount(ctx, token, rpc.BlockNumberOrHashWithNumber(3))
+	require.NoError(t, err)
+	code, err := api.GetCode(ctx, token, rpc.BlockNumberOrHashWithNumber(3))
+	require.NoError(t, err)
+	require.Equal(t, crypto.Keccak256Hash(code), deployed.CodeHash)
+	require.NotEqual(t, trie.EmptyRoot, deployed.StorageRoot)
+
+	account, err = api.GetAccount(ctx, token, latest)
+	require.NoError(t, err)
+	require.Equal(t, deployed.CodeHash, account.CodeHash)
+	require.NotEqual(t, deployed.StorageRoot, account.StorageRoot)
+}
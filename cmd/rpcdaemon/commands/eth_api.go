@@ -5,6 +5,7 @@ import (
 	"context"
 	"math/big"
 	"sync"
+	"time"
 
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/holiman/uint256"
@@ -17,14 +18,19 @@ import (
 	"github.com/ledgerwatch/erigon/common/hexutil"
 	"github.com/ledgerwatch/erigon/common/math"
 	"github.com/ledgerwatch/erigon/consensus/misc"
+	"github.com/ledgerwatch/erigon/core"
 	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
 	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
 	ethFilters "github.com/ledgerwatch/erigon/eth/filters"
+	"github.com/ledgerwatch/erigon/eth/gasprice"
 	"github.com/ledgerwatch/erigon/internal/ethapi"
 	"github.com/ledgerwatch/erigon/params"
 	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/erigon/turbo/rpchelper"
 	"github.com/ledgerwatch/erigon/turbo/services"
+	"github.com/ledgerwatch/erigon/turbo/transactions"
 	"github.com/ledgerwatch/log/v3"
 )
 
@@ -68,6 +74,7 @@ type EthAPI interface {
 	GetTransactionCount(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*hexutil.Uint64, error)
 	GetStorageAt(ctx context.Context, address common.Address, index string, blockNrOrHash rpc.BlockNumberOrHash) (string, error)
 	GetCode(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error)
+	GetAccount(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*AccountInfo, error)
 
 	// System related (see ./eth_system.go)
 	BlockNumber(ctx context.Context) (hexutil.Uint64, error)
@@ -77,14 +84,16 @@ type EthAPI interface {
 	GasPrice(_ context.Context) (*hexutil.Big, error)
 
 	// Sending related (see ./eth_call.go)
-	Call(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *ethapi.StateOverrides) (hexutil.Bytes, error)
+	Call(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *ethapi.StateOverrides, blockOverrides *ethapi.BlockOverrides) (hexutil.Bytes, error)
 	EstimateGas(ctx context.Context, argsOrNil *ethapi.CallArgs, blockNrOrHash *rpc.BlockNumberOrHash) (hexutil.Uint64, error)
 	SendRawTransaction(ctx context.Context, encodedTx hexutil.Bytes) (common.Hash, error)
+	SendRawTransactionConditional(ctx context.Context, encodedTx hexutil.Bytes, conditions core.TransactionConditions) (common.Hash, error)
 	SendTransaction(_ context.Context, txObject interface{}) (common.Hash, error)
 	Sign(ctx context.Context, _ common.Address, _ hexutil.Bytes) (hexutil.Bytes, error)
 	SignTransaction(_ context.Context, txObject interface{}) (common.Hash, error)
-	GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNr rpc.BlockNumber) (*interface{}, error)
-	CreateAccessList(ctx context.Context, args ethapi.CallArgs, blockNrOrHash *rpc.BlockNumberOrHash, optimizeGas *bool) (*accessListResult, error)
+	GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNrOrHash rpc.BlockNumberOrHash) (*ethapi.AccountResult, error)
+	CreateAccessList(ctx context.Context, args ethapi.CallArgs, blockNrOrHash *rpc.BlockNumberOrHash, optimizeGas *bool, compareGas *bool) (*accessListResult, error)
+	SimulateV1(ctx context.Context, payload SimulationPayload, blockNrOrHash *rpc.BlockNumberOrHash) ([]map[string]interface{}, error)
 
 	// Mining related (see ./eth_mining.go)
 	Coinbase(ctx context.Context) (common.Address, error)
@@ -96,8 +105,12 @@ type EthAPI interface {
 }
 
 type BaseAPI struct {
-	stateCache   kvcache.Cache // thread-safe
-	blocksLRU    *lru.Cache    // thread-safe
+	stateCache   kvcache.Cache             // thread-safe
+	blocksLRU    *lru.Cache                // thread-safe
+	txResultsLRU *lru.Cache                // thread-safe, outputs of re-executed transactions, see txResultKey
+	receiptsLRU  *lru.Cache                // thread-safe, receipts of re-executed blocks by block hash
+	sharedState  *state.SharedStateCache   // thread-safe, historical state read by the concurrent calls
+	feeHistory   *gasprice.FeeHistoryCache // thread-safe, processed blocks of eth_feeHistory
 	filters      *rpchelper.Filters
 	_chainConfig *params.ChainConfig
 	_genesis     *types.Block
@@ -113,6 +126,9 @@ type BaseAPI struct {
 	TevmEnabled  bool // experiment
 }
 
+// DefaultSharedStateCacheSize is the size of the historical state shared by the concurrent calls, in bytes
+const DefaultSharedStateCacheSize = 64 * 1024 * 1024
+
 func NewBaseApi(f *rpchelper.Filters, stateCache kvcache.Cache, blockReader services.FullBlockReader, agg *libstate.Aggregator22, txNums *exec22.TxNums, singleNodeMode bool) *BaseAPI {
 	blocksLRUSize := 128 // ~32Mb
 	if !singleNodeMode {
@@ -122,8 +138,20 @@ func NewBaseApi(f *rpchelper.Filters, stateCache kvcache.Cache, blockReader serv
 	if err != nil {
 		panic(err)
 	}
+	txResultsLRU, err := lru.New(blocksLRUSize * 4)
+	if err != nil {
+		panic(err)
+	}
+	receiptsLRU, err := lru.New(blocksLRUSize)
+	if err != nil {
+		panic(err)
+	}
+	sharedState, err := state.NewSharedStateCache(DefaultSharedStateCacheSize)
+	if err != nil {
+		panic(err)
+	}
 
-	return &BaseAPI{filters: f, stateCache: stateCache, blocksLRU: blocksLRU, _blockReader: blockReader, _txnReader: blockReader, _agg: agg, _txNums: txNums}
+	return &BaseAPI{filters: f, stateCache: stateCache, blocksLRU: blocksLRU, txResultsLRU: txResultsLRU, receiptsLRU: receiptsLRU, sharedState: sharedState, feeHistory: gasprice.NewFeeHistoryCache(blocksLRUSize * 16), _blockReader: blockReader, _txnReader: blockReader, _agg: agg, _txNums: txNums}
 }
 
 func (api *BaseAPI) chainConfig(tx kv.Tx) (*params.ChainConfig, error) {
@@ -133,6 +161,21 @@ func (api *BaseAPI) chainConfig(tx kv.Tx) (*params.ChainConfig, error) {
 
 func (api *BaseAPI) EnableTevmExperiment() { api.TevmEnabled = true }
 
+// SetSharedStateCacheSize replaces the cache of the historical state shared by the concurrent calls with the
+// cache of the given size in bytes, 0 disables it
+func (api *BaseAPI) SetSharedStateCacheSize(size uint64) error {
+	if size == 0 {
+		api.sharedState = nil
+		return nil
+	}
+	sharedState, err := state.NewSharedStateCache(size)
+	if err != nil {
+		return err
+	}
+	api.sharedState = sharedState
+	return nil
+}
+
 // nolint:unused
 func (api *BaseAPI) genesis(tx kv.Tx) (*types.Block, error) {
 	_, genesis, err := api.chainConfigWithGenesis(tx)
@@ -210,6 +253,56 @@ func (api *BaseAPI) historyV2(tx kv.Tx) bool {
 	return enabled
 }
 
+// stateReader returns the reader of the state after the given block, which reads from the history files
+// if history v2 is enabled
+func (api *BaseAPI) stateReader(ctx context.Context, tx kv.Tx, blockNrOrHash rpc.BlockNumberOrHash) (state.StateReader, error) {
+	blockNumber, _, latest, err := rpchelper.GetCanonicalBlockNumber(blockNrOrHash, tx, api.filters)
+	if err != nil {
+		return nil, err
+	}
+	if latest {
+		cacheView, err := api.stateCache.View(ctx, tx)
+		if err != nil {
+			return nil, err
+		}
+		return state.NewCachedReader2(cacheView, tx), nil
+	}
+	return createHistoryStateReader(tx, blockNumber+1, api.historyV2(tx), api._agg, api._txNums), nil
+}
+
+// historyStateReader returns the reader of the state at the beginning of the given block
+func (api *BaseAPI) historyStateReader(tx kv.Tx, blockNumber uint64) state.StateReader {
+	r := createHistoryStateReader(tx, blockNumber, api.historyV2(tx), api._agg, api._txNums)
+	if _, latest := r.(*state.PlainStateReader); latest || api.sharedState == nil || blockNumber == 0 {
+		return r
+	}
+	// Read in the same transaction as the state, so the hash matches the state even if there is a reorg
+	parentHash, err := rawdb.ReadCanonicalHash(tx, blockNumber-1)
+	if err != nil || parentHash == (common.Hash{}) {
+		return r
+	}
+	return state.NewSharedCachedReader(r, api.sharedState, parentHash)
+}
+
+// createHistoryStateReader returns the reader of the state at the beginning of the given block. With history v2,
+// the state is read directly from the history files of the aggregator, as of the first txNum of the block,
+// without change sets, which are not written by the nodes with history v2
+func createHistoryStateReader(tx kv.Tx, blockNumber uint64, historyV2 bool, agg *libstate.Aggregator22, txNums *exec22.TxNums) state.StateReader {
+	if !historyV2 || agg == nil || txNums == nil {
+		return state.NewPlainState(tx, blockNumber)
+	}
+	if blockNumber > txNums.LastBlockNum()+1 {
+		// The state at the beginning of the block after the last one is the current state
+		return state.NewPlainStateReader(tx)
+	}
+	aggCtx := agg.MakeContext()
+	aggCtx.SetTx(tx)
+	r := state.NewHistoryReader22(aggCtx)
+	r.SetTx(tx)
+	r.SetTxNum(txNums.MinOf(blockNumber))
+	return r
+}
+
 func (api *BaseAPI) chainConfigWithGenesis(tx kv.Tx) (*params.ChainConfig, *types.Block, error) {
 	api._genesisLock.RLock()
 	cc, genesisBlock := api._chainConfig, api._genesis
@@ -265,6 +358,18 @@ type APIImpl struct {
 	mining     txpool.MiningClient
 	db         kv.RoDB
 	GasCap     uint64
+
+	GetLogsParallel int             // max number of snapshot segments read at once by eth_getLogs, sequential if 0 or 1
+	GPO             gasprice.Config // settings of the gas price oracle of eth_gasPrice and eth_maxPriorityFeePerGas
+
+	EvmCallTimeout    time.Duration           // limits of eth_call and of each execution of eth_estimateGas, 0 - no limit
+	EvmMaxMemory      uint64                  // bytes of each call frame
+	CallBudgetCeiling transactions.CallBudget // up to which the authenticated requests may raise the limits
+
+	localTxs *rpchelper.LocalTxs // journal of the transactions sent by eth_sendRawTransaction, nil - disabled
+	txQuota  *rpchelper.TxQuota  // of the transactions sent by eth_sendRawTransaction per client and sender, nil - unlimited
+
+	txConditions *core.TxConditionsRegistry // checked by the miner of the node, nil - the node is in another process
 }
 
 // NewEthAPI returns APIImpl instance
@@ -280,6 +385,9 @@ func NewEthAPI(base *BaseAPI, db kv.RoDB, eth rpchelper.ApiBackend, txPool txpoo
 		txPool:     txPool,
 		mining:     mining,
 		GasCap:     gascap,
+		GPO:        ethconfig.Defaults.GPO,
+
+		EvmCallTimeout: transactions.DefaultCallTimeout,
 	}
 }
 
@@ -84,7 +84,7 @@ func (api *APIImpl) CallBundle(ctx context.Context, txHashes []common.Hash, stat
 		}
 		stateReader = state.NewCachedReader2(cacheView, tx)
 	} else {
-		stateReader = state.NewPlainState(tx, stateBlockNumber)
+		stateReader = api.historyStateReader(tx, stateBlockNumber)
 	}
 	st := state.New(stateReader)
 
@@ -30,7 +30,7 @@ import (
 )
 
 // Call implements eth_call. Executes a new message call immediately without creating a transaction on the block chain.
-func (api *APIImpl) Call(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *ethapi.StateOverrides) (hexutil.Bytes, error) {
+func (api *APIImpl) Call(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *ethapi.StateOverrides, blockOverrides *ethapi.BlockOverrides) (hexutil.Bytes, error) {
 	tx, err := api.db.BeginRo(ctx)
 	if err != nil {
 		return nil, err
@@ -42,8 +42,12 @@ func (api *APIImpl) Call(ctx context.Context, args ethapi.CallArgs, blockNrOrHas
 		return nil, err
 	}
 
+	budget, err := api.callBudget(ctx)
+	if err != nil {
+		return nil, err
+	}
 	if args.Gas == nil || uint64(*args.Gas) == 0 {
-		args.Gas = (*hexutil.Uint64)(&api.GasCap)
+		args.Gas = (*hexutil.Uint64)(&budget.GasCap)
 	}
 
 	contractHasTEVM := func(contractHash common.Hash) (bool, error) { return false, nil }
@@ -63,7 +67,11 @@ func (api *APIImpl) Call(ctx context.Context, args ethapi.CallArgs, blockNrOrHas
 		return nil, nil
 	}
 
-	result, err := transactions.DoCall(ctx, args, tx, blockNrOrHash, block, overrides, api.GasCap, chainConfig, api.filters, api.stateCache, contractHasTEVM, api._blockReader)
+	stateReader, err := api.stateReader(ctx, tx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	result, err := transactions.DoCall(ctx, args, tx, blockNrOrHash, block, overrides, blockOverrides, budget, chainConfig, stateReader, contractHasTEVM, api._blockReader)
 	if err != nil {
 		return nil, err
 	}
@@ -76,6 +84,21 @@ func (api *APIImpl) Call(ctx context.Context, args ethapi.CallArgs, blockNrOrHas
 	return result.Return(), result.Err
 }
 
+// callBudget returns the limits of the executions of eth_call and eth_estimateGas. The authenticated requests may
+// raise them by the rpc.CallBudgetHeader, up to the CallBudgetCeiling
+func (api *APIImpl) callBudget(ctx context.Context) (transactions.CallBudget, error) {
+	budget := transactions.CallBudget{GasCap: api.GasCap, Timeout: api.EvmCallTimeout, MaxMemory: api.EvmMaxMemory}
+	requested, ok := rpc.CallBudgetFromContext(ctx)
+	if !ok {
+		return budget, nil
+	}
+	raise, err := transactions.ParseCallBudget(requested)
+	if err != nil {
+		return budget, err
+	}
+	return budget.Raise(raise, api.CallBudgetCeiling), nil
+}
+
 // headerByNumberOrHash - intent to read recent headers only
 func headerByNumberOrHash(ctx context.Context, tx kv.Tx, blockNrOrHash rpc.BlockNumberOrHash, api *APIImpl) (*types.Header, error) {
 	blockNum, _, _, err := rpchelper.GetBlockNumber(blockNrOrHash, tx, api.filters)
@@ -103,6 +126,10 @@ func (api *APIImpl) EstimateGas(ctx context.Context, argsOrNil *ethapi.CallArgs,
 		bNrOrHash = *blockNrOrHash
 	}
 
+	budget, err := api.callBudget(ctx)
+	if err != nil {
+		return 0, err
+	}
 	dbtx, err := api.db.BeginRo(ctx)
 	if err != nil {
 		return 0, err
@@ -193,9 +220,9 @@ func (api *APIImpl) EstimateGas(ctx context.Context, argsOrNil *ethapi.CallArgs,
 	}
 
 	// Recap the highest gas allowance with specified gascap.
-	if hi > api.GasCap {
-		log.Warn("Caller gas above allowance, capping", "requested", hi, "cap", api.GasCap)
-		hi = api.GasCap
+	if hi > budget.GasCap {
+		log.Warn("Caller gas above allowance, capping", "requested", hi, "cap", budget.GasCap)
+		hi = budget.GasCap
 	}
 	cap = hi
 	var lastBlockNum = rpc.LatestBlockNumber
@@ -227,8 +254,12 @@ func (api *APIImpl) EstimateGas(ctx context.Context, argsOrNil *ethapi.CallArgs,
 			return false, nil, nil
 		}
 
-		result, err := transactions.DoCall(ctx, args, dbtx, numOrHash, block, nil,
-			api.GasCap, chainConfig, api.filters, api.stateCache, contractHasTEVM, api._blockReader)
+		stateReader, err := api.stateReader(ctx, dbtx, numOrHash)
+		if err != nil {
+			return false, nil, err
+		}
+		result, err := transactions.DoCall(ctx, args, dbtx, numOrHash, block, nil, nil,
+			budget, chainConfig, stateReader, contractHasTEVM, api._blockReader)
 		if err != nil {
 			if errors.Is(err, core.ErrIntrinsicGas) {
 				// Special case, raise gas limit
@@ -277,12 +308,6 @@ func (api *APIImpl) EstimateGas(ctx context.Context, argsOrNil *ethapi.CallArgs,
 	return hexutil.Uint64(hi), nil
 }
 
-// GetProof not implemented
-func (api *APIImpl) GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNr rpc.BlockNumber) (*interface{}, error) {
-	var stub interface{}
-	return &stub, fmt.Errorf(NotImplemented, "eth_getProof")
-}
-
 // accessListResult returns an optional accesslist
 // Its the result of the `eth_createAccessList` RPC call.
 // It contains an error if the transaction itself failed.
@@ -290,12 +315,17 @@ type accessListResult struct {
 	Accesslist *types.AccessList `json:"accessList"`
 	Error      string            `json:"error,omitempty"`
 	GasUsed    hexutil.Uint64    `json:"gasUsed"`
+	// set if requested by compareGas, gas used with the access list of the arguments (if any) instead of the created one
+	GasUsedWithoutList *hexutil.Uint64 `json:"gasUsedWithoutAccessList,omitempty"`
 }
 
 // CreateAccessList implements eth_createAccessList. It creates an access list for the given transaction.
 // If the accesslist creation fails an error is returned.
 // If the transaction itself fails, an vmErr is returned.
-func (api *APIImpl) CreateAccessList(ctx context.Context, args ethapi.CallArgs, blockNrOrHash *rpc.BlockNumberOrHash, optimizeGas *bool) (*accessListResult, error) {
+// The transaction is executed again with the list until no new accounts or slots are accessed. The sender,
+// the recipient (or the created contract), the contracts created by the transaction and the precompiles are
+// warm anyway and not included. If compareGas is set, the gas used without the list is returned too.
+func (api *APIImpl) CreateAccessList(ctx context.Context, args ethapi.CallArgs, blockNrOrHash *rpc.BlockNumberOrHash, optimizeGas *bool, compareGas *bool) (*accessListResult, error) {
 	bNrOrHash := rpc.BlockNumberOrHashWithNumber(rpc.PendingBlockNumber)
 	if blockNrOrHash != nil {
 		bNrOrHash = *blockNrOrHash
@@ -334,7 +364,7 @@ func (api *APIImpl) CreateAccessList(ctx context.Context, args ethapi.CallArgs,
 		}
 		stateReader = state.NewCachedReader2(cacheView, tx)
 	} else {
-		stateReader = state.NewPlainState(tx, blockNumber+1)
+		stateReader = api.historyStateReader(tx, blockNumber+1)
 	}
 
 	header := block.Header()
@@ -348,15 +378,18 @@ func (api *APIImpl) CreateAccessList(ctx context.Context, args ethapi.CallArgs,
 	} else {
 		// Require nonce to calculate address of created contract
 		if args.Nonce == nil {
-			var nonce uint64
-			reply, err := api.txPool.Nonce(ctx, &txpool_proto.NonceRequest{
-				Address: gointerfaces.ConvertAddressToH160(*args.From),
-			}, &grpc.EmptyCallOption{})
-			if err != nil {
-				return nil, err
-			}
-			if reply.Found {
-				nonce = reply.Nonce + 1
+			// pending nonce if the pool has transactions of the sender, otherwise the nonce in the state
+			nonce := state.New(stateReader).GetNonce(*args.From)
+			if api.txPool != nil {
+				reply, err := api.txPool.Nonce(ctx, &txpool_proto.NonceRequest{
+					Address: gointerfaces.ConvertAddressToH160(*args.From),
+				}, &grpc.EmptyCallOption{})
+				if err != nil {
+					return nil, err
+				}
+				if reply.Found {
+					nonce = reply.Nonce + 1
+				}
 			}
 			args.Nonce = (*hexutil.Uint64)(&nonce)
 		}
@@ -366,17 +399,14 @@ func (api *APIImpl) CreateAccessList(ctx context.Context, args ethapi.CallArgs,
 	// Retrieve the precompiles since they don't need to be added to the access list
 	precompiles := vm.ActivePrecompiles(chainConfig.Rules(blockNumber))
 
-	// Create an initial tracer
-	prevTracer := logger.NewAccessListTracer(nil, *args.From, to, precompiles)
-	if args.AccessList != nil {
-		prevTracer = logger.NewAccessListTracer(*args.AccessList, *args.From, to, precompiles)
+	var baseFee *uint256.Int = nil
+	// check if EIP-1559
+	if header.BaseFee != nil {
+		baseFee, _ = uint256.FromBig(header.BaseFee)
 	}
-	for {
+	// applyWithList executes the transaction with the access list on top of the state of the block
+	applyWithList := func(accessList types.AccessList, tracer vm.Tracer) (*core.ExecutionResult, error) {
 		state := state.New(stateReader)
-		// Retrieve the current access list to expand
-		accessList := prevTracer.AccessList()
-		log.Trace("Creating access list", "input", accessList)
-
 		// If no gas amount was specified, each unique access list needs it's own
 		// gas calculation. This is quite expensive, but we need to be accurate
 		// and it's convered by the sender only anyway.
@@ -386,42 +416,60 @@ func (api *APIImpl) CreateAccessList(ctx context.Context, args ethapi.CallArgs,
 		// Set the accesslist to the last al
 		args.AccessList = &accessList
 
-		var msg types.Message
-
-		var baseFee *uint256.Int = nil
-		// check if EIP-1559
-		if header.BaseFee != nil {
-			baseFee, _ = uint256.FromBig(header.BaseFee)
-		}
-
-		msg, err = args.ToMessage(api.GasCap, baseFee)
+		msg, err := args.ToMessage(api.GasCap, baseFee)
 		if err != nil {
 			return nil, err
 		}
 
-		// Apply the transaction with the access list tracer
-		tracer := logger.NewAccessListTracer(accessList, *args.From, to, precompiles)
-		config := vm.Config{Tracer: tracer, Debug: true, NoBaseFee: true}
+		config := vm.Config{NoBaseFee: true}
+		if tracer != nil {
+			config.Tracer, config.Debug = tracer, true
+		}
 		blockCtx, txCtx := transactions.GetEvmContext(msg, header, bNrOrHash.RequireCanonical, tx, contractHasTEVM, api._blockReader)
 
 		evm := vm.NewEVM(blockCtx, txCtx, state, chainConfig, config)
 		gp := new(core.GasPool).AddGas(msg.Gas())
-		res, err := core.ApplyMessage(evm, msg, gp, true /* refunds */, false /* gasBailout */)
+		return core.ApplyMessage(evm, msg, gp, true /* refunds */, false /* gasBailout */)
+	}
+
+	var inputList types.AccessList
+	if args.AccessList != nil {
+		inputList = *args.AccessList
+	}
+	// Create an initial tracer
+	prevTracer := logger.NewAccessListTracer(inputList, *args.From, to, precompiles)
+	for {
+		// Retrieve the current access list to expand
+		accessList := prevTracer.AccessList()
+		log.Trace("Creating access list", "input", accessList)
+
+		// Apply the transaction with the access list tracer
+		tracer := logger.NewAccessListTracer(accessList, *args.From, to, precompiles)
+		res, err := applyWithList(accessList, tracer)
 		if err != nil {
 			return nil, err
 		}
-		if tracer.Equal(prevTracer) {
-			var errString string
-			if res.Err != nil {
-				errString = res.Err.Error()
-			}
-			accessList := &accessListResult{Accesslist: &accessList, Error: errString, GasUsed: hexutil.Uint64(res.UsedGas)}
-			if optimizeGas != nil && *optimizeGas {
-				optimizeToInAccessList(accessList, to)
+		if !tracer.Equal(prevTracer) {
+			prevTracer = tracer
+			continue
+		}
+		var errString string
+		if res.Err != nil {
+			errString = res.Err.Error()
+		}
+		result := &accessListResult{Accesslist: &accessList, Error: errString, GasUsed: hexutil.Uint64(res.UsedGas)}
+		if optimizeGas != nil && *optimizeGas {
+			optimizeToInAccessList(result, to)
+		}
+		if compareGas != nil && *compareGas {
+			res, err := applyWithList(inputList, nil)
+			if err != nil {
+				return nil, err
 			}
-			return accessList, nil
+			gasUsed := hexutil.Uint64(res.UsedGas)
+			result.GasUsedWithoutList = &gasUsed
 		}
-		prevTracer = tracer
+		return result, nil
 	}
 }
 
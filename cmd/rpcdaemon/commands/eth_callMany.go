@@ -15,7 +15,9 @@ import (
 	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/core/state"
 	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
 	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/eth/tracers"
 	"github.com/ledgerwatch/erigon/ethdb"
 	rpcapi "github.com/ledgerwatch/erigon/internal/ethapi"
 	"github.com/ledgerwatch/erigon/rpc"
@@ -37,6 +39,16 @@ type BlockOverrides struct {
 type Bundle struct {
 	Transactions  []rpcapi.CallArgs
 	BlockOverride BlockOverrides
+	// StateOverrides are applied before the transactions with the same index, nil entries are skipped
+	StateOverrides []*rpcapi.StateOverrides
+	// TraceConfigs of debug_traceCallMany replace the config of the request for the transactions with the same index,
+	// nil entries are skipped
+	TraceConfigs []*tracers.TraceConfig
+}
+
+// CallManyOptions are the optional parts of the results of eth_callMany
+type CallManyOptions struct {
+	StateDiff bool `json:"stateDiff"` // the changes made by each call, in the format of trace_call
 }
 
 type StateContext struct {
@@ -70,7 +82,58 @@ func blockHeaderOverride(blockCtx *vm.BlockContext, blockOverride BlockOverrides
 	}
 }
 
-func (api *APIImpl) CallMany(ctx context.Context, bundles []Bundle, simulateContext StateContext, stateOverride *rpcapi.StateOverrides, timeoutMilliSecondsPtr *int64) ([][]map[string]interface{}, error) {
+// stateWriters is a StateWriter writing into all of the writers
+type stateWriters []state.StateWriter
+
+func (ws stateWriters) UpdateAccountData(address common.Address, original, account *accounts.Account) error {
+	for _, w := range ws {
+		if err := w.UpdateAccountData(address, original, account); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ws stateWriters) UpdateAccountCode(address common.Address, incarnation uint64, codeHash common.Hash, code []byte) error {
+	for _, w := range ws {
+		if err := w.UpdateAccountCode(address, incarnation, codeHash, code); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ws stateWriters) DeleteAccount(address common.Address, original *accounts.Account) error {
+	for _, w := range ws {
+		if err := w.DeleteAccount(address, original); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ws stateWriters) WriteAccountStorage(address common.Address, incarnation uint64, key *common.Hash, original, value *uint256.Int) error {
+	for _, w := range ws {
+		if err := w.WriteAccountStorage(address, incarnation, key, original, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ws stateWriters) CreateContract(address common.Address) error {
+	for _, w := range ws {
+		if err := w.CreateContract(address); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CallMany implements eth_callMany. Executes the bundles of calls one after another, on the state in the middle of
+// the block of simulateContext, each call seeing the changes of the previous ones. Returns the output and the gas
+// used by each call, and the changes made by it if requested in callOptions
+func (api *APIImpl) CallMany(ctx context.Context, bundles []Bundle, simulateContext StateContext, stateOverride *rpcapi.StateOverrides, timeoutMilliSecondsPtr *int64, callOptions *CallManyOptions) ([][]map[string]interface{}, error) {
 	var (
 		hash               common.Hash
 		replayTransactions types.Transactions
@@ -131,13 +194,16 @@ func (api *APIImpl) CallMany(ctx context.Context, bundles []Bundle, simulateCont
 
 	replayTransactions = block.Transactions()[:transactionIndex]
 
-	stateReader, err := rpchelper.CreateStateReader(ctx, tx, rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(blockNum-1)), api.filters, api.stateCache)
+	stateReader, err := api.stateReader(ctx, tx, rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(blockNum-1)))
 
 	if err != nil {
 		return nil, err
 	}
 
-	st := state.New(stateReader)
+	// The changes of the calls are written into the overlay, so that the state before each call can be compared
+	// with the state after it
+	overlay := state.NewOverlayState(stateReader)
+	st := state.New(overlay)
 
 	parent := block.Header()
 
@@ -230,15 +296,21 @@ func (api *APIImpl) CallMany(ctx context.Context, bundles []Bundle, simulateCont
 		if evm.Cancelled() {
 			return nil, fmt.Errorf("execution aborted (timeout = %v)", timeout)
 		}
+		if err = st.FinalizeTx(rules, overlay); err != nil {
+			return nil, err
+		}
 	}
 
 	// after replaying the txns, we want to overload the state
 	// overload state
 	if stateOverride != nil {
-		err = stateOverride.Override((evm.IntraBlockState()).(*state.IntraBlockState))
+		err = stateOverride.Override(st)
 		if err != nil {
 			return nil, err
 		}
+		if err = st.FinalizeTx(rules, overlay); err != nil {
+			return nil, err
+		}
 	}
 
 	ret := make([][]map[string]interface{}, 0)
@@ -269,7 +341,15 @@ func (api *APIImpl) CallMany(ctx context.Context, bundles []Bundle, simulateCont
 			}
 		}
 		results := []map[string]interface{}{}
-		for _, txn := range bundle.Transactions {
+		for i, txn := range bundle.Transactions {
+			if i < len(bundle.StateOverrides) && bundle.StateOverrides[i] != nil {
+				if err = bundle.StateOverrides[i].Override(st); err != nil {
+					return nil, err
+				}
+				if err = st.FinalizeTx(rules, overlay); err != nil {
+					return nil, err
+				}
+			}
 			if txn.Gas == nil || *(txn.Gas) == 0 {
 				txn.Gas = (*hexutil.Uint64)(&api.GasCap)
 			}
@@ -288,6 +368,23 @@ func (api *APIImpl) CallMany(ctx context.Context, bundles []Bundle, simulateCont
 				return nil, fmt.Errorf("execution aborted (timeout = %v)", timeout)
 			}
 			jsonResult := make(map[string]interface{})
+			if callOptions != nil && callOptions.StateDiff {
+				// The changes go into a layer over the state before the call, until they are compared
+				sdMap := make(map[common.Address]*StateDiffAccount)
+				sd := &StateDiff{sdMap: sdMap}
+				changes := overlay.Fork()
+				if err = st.FinalizeTx(rules, stateWriters{sd, changes}); err != nil {
+					return nil, err
+				}
+				sd.CompareStates(state.New(overlay), st)
+				if err = changes.Apply(overlay); err != nil {
+					return nil, err
+				}
+				jsonResult["stateDiff"] = sdMap
+			} else if err = st.FinalizeTx(rules, overlay); err != nil {
+				return nil, err
+			}
+			jsonResult["gasUsed"] = hexutil.Uint64(result.UsedGas)
 			if result.Err != nil {
 				if len(result.Revert()) > 0 {
 					jsonResult["error"] = ethapi.NewRevertError(result)
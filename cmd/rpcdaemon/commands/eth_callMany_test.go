@@ -12,6 +12,7 @@ import (
 	"github.com/ledgerwatch/erigon/accounts/abi/bind"
 	"github.com/ledgerwatch/erigon/accounts/abi/bind/backends"
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/commands/contracts"
+	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/common/hexutil"
 	"github.com/ledgerwatch/erigon/core"
 	"github.com/ledgerwatch/erigon/crypto"
@@ -100,7 +101,7 @@ func TestCallMany(t *testing.T) {
 	timeout := int64(50000)
 	txIndex := -1
 	res, err := api.CallMany(ctx, []Bundle{{
-		Transactions: []ethapi.CallArgs{callArgAddr1, callArgAddr2}}}, StateContext{BlockNumber: rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), TransactionIndex: &txIndex}, nil, &timeout)
+		Transactions: []ethapi.CallArgs{callArgAddr1, callArgAddr2}}}, StateContext{BlockNumber: rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), TransactionIndex: &txIndex}, nil, &timeout, nil)
 	if err != nil {
 		t.Errorf("eth_callMany: %v", err)
 	}
@@ -123,7 +124,7 @@ func TestCallMany(t *testing.T) {
 
 	txIndex = 2
 	res, err = api.CallMany(ctx, []Bundle{{
-		Transactions: []ethapi.CallArgs{callArgAddr1, callArgAddr2}}}, StateContext{BlockNumber: rpc.BlockNumberOrHashWithNumber(1), TransactionIndex: &txIndex}, nil, &timeout)
+		Transactions: []ethapi.CallArgs{callArgAddr1, callArgAddr2}}}, StateContext{BlockNumber: rpc.BlockNumberOrHashWithNumber(1), TransactionIndex: &txIndex}, nil, &timeout, nil)
 	if err != nil {
 		t.Errorf("eth_callMany: %v", err)
 	}
@@ -143,7 +144,7 @@ func TestCallMany(t *testing.T) {
 		t.Errorf("eth_callMany: %s", "balanceUnmatch")
 	}
 	txIndex = -1
-	res, err = api.CallMany(ctx, []Bundle{{Transactions: []ethapi.CallArgs{callArgTransferAddr2, callArgAddr1, callArgAddr2}}}, StateContext{BlockNumber: rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), TransactionIndex: &txIndex}, nil, &timeout)
+	res, err = api.CallMany(ctx, []Bundle{{Transactions: []ethapi.CallArgs{callArgTransferAddr2, callArgAddr1, callArgAddr2}}}, StateContext{BlockNumber: rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), TransactionIndex: &txIndex}, nil, &timeout, nil)
 	if err != nil {
 		t.Errorf("%v", err)
 	}
@@ -162,4 +163,20 @@ func TestCallMany(t *testing.T) {
 	if addr1Balance != 100 || addr2Balance != 0 {
 		t.Errorf("eth_callMany: %s", "balanceUnmatch")
 	}
+
+	// the transfer changes the storage of the token, the balance check does not
+	res, err = api.CallMany(ctx, []Bundle{{Transactions: []ethapi.CallArgs{callArgTransferAddr2, callArgAddr1}}}, StateContext{BlockNumber: rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), TransactionIndex: &txIndex}, nil, &timeout, &CallManyOptions{StateDiff: true})
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if _, ok := res[0][0]["gasUsed"]; !ok {
+		t.Errorf("eth_callMany: %s", "no gasUsed")
+	}
+	transferDiff := res[0][0]["stateDiff"].(map[common.Address]*StateDiffAccount)
+	if tokenDiff, ok := transferDiff[tokenAddr]; !ok || len(tokenDiff.Storage) == 0 {
+		t.Errorf("eth_callMany: %s", "no storage changes of the transfer")
+	}
+	if _, ok := res[0][1]["stateDiff"].(map[common.Address]*StateDiffAccount)[tokenAddr]; ok {
+		t.Errorf("eth_callMany: %s", "token changed by the balance check")
+	}
 }
@@ -47,6 +47,24 @@ func TestEstimateGas(t *testing.T) {
 	}
 }
 
+func TestCreateAccessList(t *testing.T) {
+	db := rpcdaemontest.CreateTestKV(t)
+	stateCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	api := NewEthAPI(NewBaseApi(nil, stateCache, snapshotsync.NewBlockReader(), nil, nil, false), db, nil, nil, nil, 5000000)
+	var from = common.HexToAddress("0x71562b71999873db5b286df957af199ec94617f7")
+	var to = common.HexToAddress("0x1234")
+	latest := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+	compareGas := true
+	res, err := api.CreateAccessList(context.Background(), ethapi.CallArgs{From: &from, To: &to}, &latest, nil, &compareGas)
+	if err != nil {
+		t.Fatalf("calling CreateAccessList: %v", err)
+	}
+	// plain transfer, the sender and the recipient are warm anyway
+	assert.Empty(t, *res.Accesslist)
+	assert.NotNil(t, res.GasUsedWithoutList)
+	assert.Equal(t, res.GasUsed, *res.GasUsedWithoutList)
+}
+
 func TestEthCallNonCanonical(t *testing.T) {
 	db := rpcdaemontest.CreateTestKV(t)
 	stateCache := kvcache.New(kvcache.DefaultCoherentConfig)
@@ -56,7 +74,7 @@ func TestEthCallNonCanonical(t *testing.T) {
 	if _, err := api.Call(context.Background(), ethapi.CallArgs{
 		From: &from,
 		To:   &to,
-	}, rpc.BlockNumberOrHashWithHash(common.HexToHash("0x3fcb7c0d4569fddc89cbea54b42f163e0c789351d98810a513895ab44b47020b"), true), nil); err != nil {
+	}, rpc.BlockNumberOrHashWithHash(common.HexToHash("0x3fcb7c0d4569fddc89cbea54b42f163e0c789351d98810a513895ab44b47020b"), true), nil, nil); err != nil {
 		if fmt.Sprintf("%v", err) != "hash 3fcb7c0d4569fddc89cbea54b42f163e0c789351d98810a513895ab44b47020b is not currently canonical" {
 			t.Errorf("wrong error: %v", err)
 		}
@@ -81,7 +99,7 @@ func TestEthCallToPrunedBlock(t *testing.T) {
 		From: &bankAddress,
 		To:   &contractAddress,
 		Data: &callDataBytes,
-	}, rpc.BlockNumberOrHashWithNumber(ethCallBlockNumber), nil); err != nil {
+	}, rpc.BlockNumberOrHashWithNumber(ethCallBlockNumber), nil, nil); err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
 }
@@ -298,6 +316,27 @@ func TestGetBlockByTimestamp(t *testing.T) {
 	}
 }
 
+func TestBlockTimestampsNarrow(t *testing.T) {
+	// Block n has the timestamp 10*n
+	headerTime := func(blockNum uint64) (uint64, error) { return 10 * blockNum, nil }
+	var ti blockTimestamps
+	if err := ti.update(3*timestampIndexStep+5, headerTime); err != nil {
+		t.Fatal(err)
+	}
+	if len(ti.times) != 4 {
+		t.Fatalf("wrong size of the index, got %d, expected 4", len(ti.times))
+	}
+	low, high, highTime := ti.narrow(10*(timestampIndexStep+7), 0, 10*timestampIndexStep, 10*10*timestampIndexStep)
+	if low != timestampIndexStep || high != 2*timestampIndexStep || highTime != 10*2*timestampIndexStep {
+		t.Errorf("wrong range (%d, %d], time %d", low, high, highTime)
+	}
+	// The timestamps after the indexed blocks only raise the lower bound
+	low, high, highTime = ti.narrow(10*(3*timestampIndexStep+2), 0, 4*timestampIndexStep, 10*4*timestampIndexStep)
+	if low != 3*timestampIndexStep || high != 4*timestampIndexStep || highTime != 10*4*timestampIndexStep {
+		t.Errorf("wrong range (%d, %d], time %d", low, high, highTime)
+	}
+}
+
 func chainWithDeployedContract(t *testing.T) (kv.RwDB, common.Address, common.Address) {
 	var (
 		signer      = types.LatestSignerForChainID(nil)
@@ -378,3 +417,73 @@ func prune(t *testing.T, db kv.RwDB, pruneTo uint64) {
 	err = tx.Commit()
 	assert.NoError(t, err)
 }
+
+// Reads of the historical state from the history files of the aggregator need to match the ones from the plain state history
+func TestHistoryV2StateReader(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	recipient, contract := common.Address{1}, common.Address{2}
+	gspec := &core.Genesis{
+		Config: params.AllEthashProtocolChanges,
+		Alloc: core.GenesisAlloc{
+			address: {Balance: big.NewInt(params.Ether)},
+			// Stores the calldata in slot 0, or returns slot 0 if there is no calldata
+			contract: {Balance: common.Big0, Code: common.FromHex("36600f5760005460005260206000f35b60003560005500")},
+		},
+	}
+	signer := types.LatestSigner(gspec.Config)
+	generate := func(m *stages.MockSentry) {
+		chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 4, func(i int, b *core.BlockGen) {
+			transfer, err := types.SignTx(types.NewTransaction(b.TxNonce(address), recipient, uint256.NewInt(uint64(i+1)), params.TxGas, uint256.NewInt(params.GWei), nil), *signer, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.AddTx(transfer)
+			store, err := types.SignTx(types.NewTransaction(b.TxNonce(address), contract, uint256.NewInt(0), 100_000, uint256.NewInt(params.GWei), common.LeftPadBytes([]byte{byte(i + 1)}, 32)), *signer, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.AddTx(store)
+		}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = m.InsertChain(chain); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, mV2 := stages.MockWithGenesis(t, gspec, key, false), stages.MockWithHistoryV2(t, gspec, key)
+	generate(m)
+	generate(mV2)
+	br := snapshotsync.NewBlockReader()
+	api := NewEthAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), br, nil, nil, false), m.DB, nil, nil, nil, 5000000)
+	apiV2 := NewEthAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), br, mV2.Agg(), mV2.TxNums(), false), mV2.DB, nil, nil, nil, 5000000)
+
+	ctx := context.Background()
+	// Block 4 is the latest one, it is read from the plain state
+	for bn := int64(0); bn < 4; bn++ {
+		blockNrOrHash := rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(bn))
+		balance, err := api.GetBalance(ctx, recipient, blockNrOrHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		balanceV2, err := apiV2.GetBalance(ctx, recipient, blockNrOrHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Transfers of all blocks up to bn
+		assert.Equal(t, big.NewInt(bn*(bn+1)/2), balance.ToInt(), "block %d", bn)
+		assert.Equal(t, balance.ToInt(), balanceV2.ToInt(), "block %d", bn)
+
+		result, err := api.Call(ctx, ethapi.CallArgs{To: &contract}, blockNrOrHash, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resultV2, err := apiV2.Call(ctx, ethapi.CallArgs{To: &contract}, blockNrOrHash, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, common.LeftPadBytes([]byte{byte(bn)}, 32), []byte(result), "block %d", bn)
+		assert.Equal(t, result, resultV2, "block %d", bn)
+	}
+}
@@ -2,11 +2,18 @@ package commands
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/common/debug"
 	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/consensus/misc"
+	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/eth/filters"
+	"github.com/ledgerwatch/erigon/params"
 	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/erigon/turbo/rpchelper"
 	"github.com/ledgerwatch/log/v3"
@@ -141,7 +148,7 @@ func (api *APIImpl) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
 			case h, ok := <-headers:
 				if h != nil {
 					err := notifier.Notify(rpcSub.ID, h)
-					if err != nil {
+					if err != nil && !errors.Is(err, rpc.ErrNotificationDropped) {
 						log.Warn("error while notifying subscription", "err", err)
 						return
 					}
@@ -159,8 +166,49 @@ func (api *APIImpl) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
 	return rpcSub, nil
 }
 
-// NewPendingTransactions send a notification each time a new (header) block is appended to the chain.
-func (api *APIImpl) NewPendingTransactions(ctx context.Context) (*rpc.Subscription, error) {
+// PendingTxsFilter narrows down the transactions of the newPendingTransactions subscription. Empty lists match any
+// address
+type PendingTxsFilter struct {
+	From   []common.Address `json:"from"`
+	To     []common.Address `json:"to"`
+	MinTip *hexutil.Big     `json:"minTip"` // min effective tip at the base fee of the next block
+}
+
+func (f *PendingTxsFilter) needsSender() bool {
+	return f != nil && len(f.From) > 0
+}
+
+func (f *PendingTxsFilter) match(txn types.Transaction, sender common.Address, baseFee *uint256.Int) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.From) > 0 && !containsAddress(f.From, sender) {
+		return false
+	}
+	if len(f.To) > 0 && (txn.GetTo() == nil || !containsAddress(f.To, *txn.GetTo())) {
+		return false
+	}
+	if f.MinTip != nil {
+		minTip, overflow := uint256.FromBig(f.MinTip.ToInt())
+		if overflow || txn.GetEffectiveGasTip(baseFee).Lt(minTip) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsAddress(addresses []common.Address, address common.Address) bool {
+	for i := range addresses {
+		if addresses[i] == address {
+			return true
+		}
+	}
+	return false
+}
+
+// NewPendingTransactions send a notification each time a new transaction is added to the pool: its hash, or the
+// whole transaction if fullTx is set. Only the transactions matching the filter are notified
+func (api *APIImpl) NewPendingTransactions(ctx context.Context, fullTx *bool, filter *PendingTxsFilter) (*rpc.Subscription, error) {
 	if api.filters == nil {
 		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
 	}
@@ -168,6 +216,8 @@ func (api *APIImpl) NewPendingTransactions(ctx context.Context) (*rpc.Subscripti
 	if !supported {
 		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
 	}
+	full := fullTx != nil && *fullTx
+	withHeader := full || filter.needsSender() || (filter != nil && filter.MinTip != nil)
 
 	rpcSub := notifier.CreateSubscription()
 
@@ -180,14 +230,41 @@ func (api *APIImpl) NewPendingTransactions(ctx context.Context) (*rpc.Subscripti
 		for {
 			select {
 			case txs, ok := <-txsCh:
+				var cc *params.ChainConfig
+				var header *types.Header
+				var signer *types.Signer
+				var baseFee *uint256.Int
+				if withHeader && len(txs) > 0 {
+					var err error
+					if cc, header, err = api.pendingTxsContext(); err != nil {
+						log.Warn("error while reading pending transactions context", "err", err)
+						return
+					}
+					signer = types.LatestSigner(cc)
+					baseFee, _ = uint256.FromBig(misc.CalcBaseFee(cc, header))
+				}
 				for _, t := range txs {
-					if t != nil {
-						err := notifier.Notify(rpcSub.ID, t.Hash())
-						if err != nil {
-							log.Warn("error while notifying subscription", "err", err)
-							return
+					if t == nil {
+						continue
+					}
+					var sender common.Address
+					if signer != nil {
+						var err error
+						if sender, err = t.Sender(*signer); err != nil {
+							continue
 						}
 					}
+					if !filter.match(t, sender, baseFee) {
+						continue
+					}
+					var notification interface{} = t.Hash()
+					if full {
+						notification = newRPCPendingTransaction(t, header, cc)
+					}
+					if err := notifier.Notify(rpcSub.ID, notification); err != nil && !errors.Is(err, rpc.ErrNotificationDropped) {
+						log.Warn("error while notifying subscription", "err", err)
+						return
+					}
 				}
 				if !ok {
 					log.Warn("new pending transactions channel was closed")
@@ -202,6 +279,25 @@ func (api *APIImpl) NewPendingTransactions(ctx context.Context) (*rpc.Subscripti
 	return rpcSub, nil
 }
 
+// pendingTxsContext returns the chain config and the current header, to recover the senders and compute the tips of
+// the pending transactions
+func (api *APIImpl) pendingTxsContext() (*params.ChainConfig, *types.Header, error) {
+	tx, err := api.db.BeginRo(context.Background())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+	cc, err := api.chainConfig(tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	header := rawdb.ReadCurrentHeader(tx)
+	if header == nil {
+		return nil, nil, fmt.Errorf("current header not found")
+	}
+	return cc, header, nil
+}
+
 // Logs send a notification each time a new log appears.
 func (api *APIImpl) Logs(ctx context.Context, crit filters.FilterCriteria) (*rpc.Subscription, error) {
 	if api.filters == nil {
@@ -224,7 +320,7 @@ func (api *APIImpl) Logs(ctx context.Context, crit filters.FilterCriteria) (*rpc
 			case h, ok := <-logs:
 				if h != nil {
 					err := notifier.Notify(rpcSub.ID, h)
-					if err != nil {
+					if err != nil && !errors.Is(err, rpc.ErrNotificationDropped) {
 						log.Warn("error while notifying subscription", "err", err)
 						return
 					}
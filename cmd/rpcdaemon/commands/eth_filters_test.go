@@ -1,17 +1,20 @@
 package commands
 
 import (
+	"math/big"
 	"math/rand"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/holiman/uint256"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
 	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/rpcdaemontest"
 	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
 	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/eth/filters"
 	"github.com/ledgerwatch/erigon/turbo/rpchelper"
@@ -96,3 +99,24 @@ func TestLogsSubscribeAndUnsubscribe_WithoutConcurrentMapIssue(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestPendingTxsFilter(t *testing.T) {
+	assert := assert.New(t)
+	from, to := common.HexToAddress("0x1111"), common.HexToAddress("0x2222")
+	txn := types.NewTransaction(0, to, uint256.NewInt(1), 21000, uint256.NewInt(10), nil)
+	creation := types.NewContractCreation(0, uint256.NewInt(1), 21000, uint256.NewInt(10), nil)
+
+	var filter *PendingTxsFilter
+	assert.True(filter.match(txn, from, nil))
+
+	filter = &PendingTxsFilter{To: []common.Address{to}}
+	assert.True(filter.match(txn, from, nil))
+	assert.False(filter.match(creation, from, nil))
+
+	filter = &PendingTxsFilter{From: []common.Address{to}}
+	assert.False(filter.match(txn, from, nil))
+
+	filter = &PendingTxsFilter{MinTip: (*hexutil.Big)(big.NewInt(5))}
+	assert.True(filter.match(txn, from, uint256.NewInt(5)))
+	assert.False(filter.match(txn, from, uint256.NewInt(6))) // tip is the gas price above the base fee
+}
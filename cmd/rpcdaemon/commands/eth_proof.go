@@ -0,0 +1,263 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	libstate "github.com/ledgerwatch/erigon-lib/state"
+	"github.com/ledgerwatch/erigon/cmd/state/exec22"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/internal/ethapi"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/rpchelper"
+	"github.com/ledgerwatch/erigon/turbo/trie"
+)
+
+// maxGetProofRewindBlockCount limits how far behind the head of the trie stage eth_getProof goes, because the
+// changes made since the block are rolled back in memory
+const maxGetProofRewindBlockCount = 10_000
+
+// GetProof implements eth_getProof (EIP-1186). The proof is built from the hashed state and the intermediate hashes
+// of the trie stage. For a block behind the head of the trie stage, the changes made since the block are rolled back
+// in memory, with the values taken from the history of the accounts and the storage (history v2 only), and the
+// resulting trie root is checked against the header of the block
+func (api *APIImpl) GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNrOrHash rpc.BlockNumberOrHash) (*ethapi.AccountResult, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	blockNum, hash, _, err := rpchelper.GetBlockNumber(blockNrOrHash, tx, api.filters)
+	if err != nil {
+		return nil, err
+	}
+	header := rawdb.ReadHeader(tx, hash, blockNum)
+	if header == nil {
+		return nil, fmt.Errorf("block %d(%x) not found", blockNum, hash)
+	}
+	latest, err := stages.GetStageProgress(tx, stages.IntermediateHashes)
+	if err != nil {
+		return nil, err
+	}
+	if blockNum > latest {
+		return nil, fmt.Errorf("block %d is ahead of the trie stage at %d", blockNum, latest)
+	}
+
+	// The hashed state is rolled back in the batch, the database is never written
+	batch := memdb.NewMemoryBatch(tx)
+	defer batch.Rollback()
+	loadRetain := trie.NewRetainList(0)
+	if blockNum < latest {
+		if latest-blockNum > maxGetProofRewindBlockCount {
+			return nil, fmt.Errorf("block %d is more than %d blocks behind the trie stage at %d", blockNum, maxGetProofRewindBlockCount, latest)
+		}
+		if !api.historyV2(tx) || api._agg == nil || api._txNums == nil {
+			return nil, fmt.Errorf("proofs of the blocks behind the trie stage at %d need history v2", latest)
+		}
+		if err = rewindHashedState(batch, tx, api._agg, api._txNums, blockNum, latest, loadRetain); err != nil {
+			return nil, err
+		}
+	}
+
+	addrHash, err := common.HashData(address[:])
+	if err != nil {
+		return nil, err
+	}
+	acc := accounts.NewAccount()
+	enc, err := batch.GetOne(kv.HashedAccounts, addrHash[:])
+	if err != nil {
+		return nil, err
+	}
+	if len(enc) > 0 {
+		if err = acc.DecodeForStorage(enc); err != nil {
+			return nil, err
+		}
+	}
+	proofRetain := trie.NewRetainList(0)
+	loadRetain.AddKey(addrHash[:])
+	proofRetain.AddKey(addrHash[:])
+	keyHashes := make([]common.Hash, len(storageKeys))
+	for i, key := range storageKeys {
+		if keyHashes[i], err = common.HashData(common.HexToHash(key).Bytes()); err != nil {
+			return nil, err
+		}
+		storageKey := dbutils.GenerateCompositeStorageKey(addrHash, acc.Incarnation, keyHashes[i])
+		loadRetain.AddKey(storageKey)
+		proofRetain.AddKey(storageKey)
+	}
+
+	loader := trie.NewFlatDBTrieLoader("eth_getProof")
+	if err = loader.Reset(loadRetain, nil, nil, false); err != nil {
+		return nil, err
+	}
+	loader.SetProofRetainer(proofRetain)
+	root, err := loader.CalcTrieRoot(batch, []byte{}, ctx.Done())
+	if err != nil {
+		return nil, err
+	}
+	if root != header.Root {
+		return nil, fmt.Errorf("wrong trie root of block %d: %x, expected (from header): %x", blockNum, root, header.Root)
+	}
+	tr := loader.ProofTrie()
+	accountProof, err := tr.Prove(addrHash[:], 0, false)
+	if err != nil {
+		return nil, err
+	}
+	result := &ethapi.AccountResult{
+		Address:      address,
+		AccountProof: toHexSlice(accountProof),
+		Balance:      (*hexutil.Big)(acc.Balance.ToBig()),
+		CodeHash:     acc.CodeHash,
+		Nonce:        hexutil.Uint64(acc.Nonce),
+		StorageHash:  trie.EmptyRoot,
+		StorageProof: make([]ethapi.StorageResult, len(storageKeys)),
+	}
+	if trieAcc, ok := tr.GetAccount(addrHash[:]); ok && trieAcc != nil {
+		result.StorageHash = trieAcc.Root
+	}
+	for i, key := range storageKeys {
+		trieKey := append(common.CopyBytes(addrHash[:]), keyHashes[i][:]...)
+		proof, err := tr.Prove(trieKey, 64 /* skip the account nodes */, true)
+		if err != nil {
+			return nil, err
+		}
+		value := new(big.Int)
+		if v, ok := tr.Get(trieKey); ok {
+			value.SetBytes(v)
+		}
+		result.StorageProof[i] = ethapi.StorageResult{Key: key, Value: (*hexutil.Big)(value), Proof: toHexSlice(proof)}
+	}
+	return result, nil
+}
+
+// rewindHashedState writes into batch the hashed accounts and storage changed after blockNum, up to latest, with
+// their values as of blockNum taken from the history, and adds their keys to rl. The keys that do not exist in the
+// latest state are marked, as unwindIntermediateHashesStageImpl does, so that the trie loader does not use the
+// intermediate hashes around them
+func rewindHashedState(batch kv.RwTx, tx kv.Tx, agg *libstate.Aggregator22, txNums *exec22.TxNums, blockNum, latest uint64, rl *trie.RetainList) error {
+	fromTxNum, toTxNum := txNums.MinOf(blockNum+1), txNums.MaxOf(latest)+1
+	accountsHistory, storageHistory := agg.Accounts().MakeContext(), agg.Storage().MakeContext()
+	// Incarnations of the accounts as of blockNum, which are a part of the keys of the storage
+	incarnations := map[common.Address]uint64{}
+
+	accountsIt := agg.Accounts().InvertedIndex.MakeContext().IterateChangedKeys(fromTxNum, toTxNum, tx)
+	defer accountsIt.Close()
+	for accountsIt.HasNext() {
+		key := accountsIt.Next(nil)
+		v, ok, err := accountsHistory.GetNoStateWithRecent(key, fromTxNum, tx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// Not changed since fromTxNum, the latest value is used
+			continue
+		}
+		addrHash, err := common.HashData(key)
+		if err != nil {
+			return err
+		}
+		latestV, err := tx.GetOne(kv.HashedAccounts, addrHash[:])
+		if err != nil {
+			return err
+		}
+		rl.AddKeyWithMarker(addrHash[:], len(latestV) == 0)
+		var incarnation uint64
+		if len(v) == 0 {
+			if err = batch.Delete(kv.HashedAccounts, addrHash[:]); err != nil {
+				return err
+			}
+		} else {
+			acc := accounts.NewAccount()
+			if err = accounts.Deserialise2(&acc, v); err != nil {
+				return err
+			}
+			if acc.Incarnation > 0 && acc.IsEmptyCodeHash() {
+				codeHash, err := tx.GetOne(kv.PlainContractCode, dbutils.PlainGenerateStoragePrefix(key, acc.Incarnation))
+				if err != nil {
+					return err
+				}
+				copy(acc.CodeHash[:], codeHash)
+			}
+			value := make([]byte, acc.EncodingLengthForStorage())
+			acc.EncodeForStorage(value)
+			if err = batch.Put(kv.HashedAccounts, addrHash[:], value); err != nil {
+				return err
+			}
+			incarnation = acc.Incarnation
+		}
+		incarnations[common.BytesToAddress(key)] = incarnation
+	}
+
+	storageIt := agg.Storage().InvertedIndex.MakeContext().IterateChangedKeys(fromTxNum, toTxNum, tx)
+	defer storageIt.Close()
+	for storageIt.HasNext() {
+		key := storageIt.Next(nil)
+		v, ok, err := storageHistory.GetNoStateWithRecent(key, fromTxNum, tx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		address := common.BytesToAddress(key[:common.AddressLength])
+		incarnation, ok := incarnations[address]
+		if !ok {
+			// The account has not changed since blockNum
+			enc, err := tx.GetOne(kv.PlainState, address[:])
+			if err != nil {
+				return err
+			}
+			if len(enc) > 0 {
+				var acc accounts.Account
+				if err = acc.DecodeForStorage(enc); err != nil {
+					return err
+				}
+				incarnation = acc.Incarnation
+			}
+			incarnations[address] = incarnation
+		}
+		if incarnation == 0 {
+			// Storage of the contract created after blockNum, or of the account that is not a contract at blockNum
+			continue
+		}
+		addrHash, err := common.HashData(address[:])
+		if err != nil {
+			return err
+		}
+		locHash, err := common.HashData(key[common.AddressLength:])
+		if err != nil {
+			return err
+		}
+		hashedKey := dbutils.GenerateCompositeStorageKey(addrHash, incarnation, locHash)
+		latestV, err := tx.GetOne(kv.HashedStorage, hashedKey)
+		if err != nil {
+			return err
+		}
+		rl.AddKeyWithMarker(hashedKey, len(latestV) == 0)
+		if len(v) == 0 {
+			err = batch.Delete(kv.HashedStorage, hashedKey)
+		} else {
+			err = batch.Put(kv.HashedStorage, hashedKey, v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func toHexSlice(b [][]byte) []string {
+	r := make([]string, len(b))
+	for i := range b {
+		r[i] = hexutil.Encode(b[i])
+	}
+	return r
+}
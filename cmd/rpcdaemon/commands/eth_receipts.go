@@ -28,13 +28,31 @@ import (
 	"github.com/ledgerwatch/erigon/params"
 	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/erigon/turbo/rpchelper"
-	"github.com/ledgerwatch/erigon/turbo/transactions"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync/snap"
+	"golang.org/x/sync/errgroup"
 )
 
 func (api *BaseAPI) getReceipts(ctx context.Context, tx kv.Tx, chainConfig *params.ChainConfig, block *types.Block, senders []common.Address) (types.Receipts, error) {
 	if cached := rawdb.ReadReceipts(tx, block, senders); cached != nil {
 		return cached, nil
 	}
+	if cached, ok := api.cachedReceipts(block.Hash()); ok {
+		return cached, nil
+	}
+	// Receipts segments of the executed blocks, retired from the db
+	receipts, err := api._blockReader.RawReceipts(ctx, tx, block.NumberU64())
+	if err != nil {
+		return nil, err
+	}
+	if receipts != nil {
+		if len(senders) > 0 {
+			block.SendersToTxs(senders)
+		}
+		if err = receipts.DeriveFields(block.Hash(), block.NumberU64(), block.Transactions(), senders); err == nil {
+			return receipts, nil
+		}
+		log.Warn("Failed to derive block receipts fields, re-executing the block", "number", block.NumberU64(), "err", err)
+	}
 
 	getHeader := func(hash common.Hash, number uint64) *types.Header {
 		h, e := api._blockReader.Header(ctx, tx, hash, number)
@@ -44,10 +62,8 @@ func (api *BaseAPI) getReceipts(ctx context.Context, tx kv.Tx, chainConfig *para
 		return h
 	}
 	contractHasTEVM := ethdb.GetHasTEVM(tx)
-	_, _, _, ibs, _, err := transactions.ComputeTxEnv(ctx, block, chainConfig, getHeader, contractHasTEVM, ethash.NewFaker(), tx, block.Hash(), 0)
-	if err != nil {
-		return nil, err
-	}
+	// The state at the beginning of the block, from the history files with history v2
+	ibs := state.New(api.historyStateReader(tx, block.NumberU64()))
 
 	usedGas := new(uint64)
 	gp := new(core.GasPool).AddGas(block.GasLimit())
@@ -55,7 +71,7 @@ func (api *BaseAPI) getReceipts(ctx context.Context, tx kv.Tx, chainConfig *para
 	ethashFaker := ethash.NewFaker()
 	noopWriter := state.NewNoopWriter()
 
-	receipts := make(types.Receipts, len(block.Transactions()))
+	receipts = make(types.Receipts, len(block.Transactions()))
 
 	for i, txn := range block.Transactions() {
 		ibs.Prepare(txn.Hash(), block.Hash(), i)
@@ -67,6 +83,7 @@ func (api *BaseAPI) getReceipts(ctx context.Context, tx kv.Tx, chainConfig *para
 		receipt.BlockHash = block.Hash()
 		receipts[i] = receipt
 	}
+	api.cacheReceipts(block.Hash(), receipts)
 
 	return receipts, nil
 }
@@ -162,9 +179,95 @@ func (api *APIImpl) GetLogs(ctx context.Context, crit filters.FilterCriteria) ([
 		return logs, nil
 	}
 
+	// The transaction of a pinned view is used by one request at a time, so its blocks are read sequentially
+	if _, pinned := rpc.ViewFromContext(ctx); api.GetLogsParallel > 1 && !pinned {
+		return api.getLogsParallel(ctx, blockNumbers, crit)
+	}
+	return api.logsInBlocks(ctx, tx, blockNumbers, crit)
+}
+
+// getLogsParallel splits the blocks by snapshot segment, and reads the logs of up to GetLogsParallel segments at
+// once, each in its own transaction. The results are merged in the order of the blocks
+func (api *APIImpl) getLogsParallel(ctx context.Context, blockNumbers *roaring.Bitmap, crit filters.FilterCriteria) ([]*types.Log, error) {
+	var chunks []*roaring.Bitmap
+	for from := uint64(blockNumbers.Minimum()); from <= uint64(blockNumbers.Maximum()); {
+		to := from - from%snap.DEFAULT_SEGMENT_SIZE + snap.DEFAULT_SEGMENT_SIZE
+		chunk := roaring.New()
+		chunk.AddRange(from, to)
+		chunk.And(blockNumbers)
+		if !chunk.IsEmpty() {
+			chunks = append(chunks, chunk)
+		}
+		from = to
+	}
+
+	results := make([][]*types.Log, len(chunks))
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(api.GetLogsParallel)
+	for i, chunk := range chunks {
+		i, chunk := i, chunk
+		g.Go(func() error {
+			tx, err := api.db.BeginRo(gCtx)
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+			results[i], err = api.logsInBlocks(gCtx, tx, chunk, crit)
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	logs := []*types.Log{}
+	for _, chunkLogs := range results {
+		logs = append(logs, chunkLogs...)
+	}
+	return logs, nil
+}
+
+// regeneratedLogs returns the logs of the block matching the criteria from its receipts, re-executing it unless the
+// receipts have been cached or retired into the receipts segments
+func (api *BaseAPI) regeneratedLogs(ctx context.Context, tx kv.Tx, blockNumber uint64, crit filters.FilterCriteria) ([]*types.Log, error) {
+	chainConfig, err := api.chainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	block, err := api.blockByNumberWithSenders(tx, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block not found %d", blockNumber)
+	}
+	receipts, err := api.getReceipts(ctx, tx, chainConfig, block, block.Body().SendersFromTxs())
+	if err != nil {
+		return nil, err
+	}
+	var logs []*types.Log
+	var logIndex uint
+	for txIndex, receipt := range receipts {
+		for _, log := range receipt.Logs {
+			logIndex++
+			if len(filterLogs([]*types.Log{log}, crit.Addresses, crit.Topics)) == 0 {
+				continue
+			}
+			// receipts are shared by the cache, so the logs are copied
+			l := *log
+			l.BlockNumber, l.BlockHash = blockNumber, block.Hash()
+			l.TxHash, l.TxIndex, l.Index = block.Transactions()[txIndex].Hash(), uint(txIndex), logIndex-1
+			logs = append(logs, &l)
+		}
+	}
+	return logs, nil
+}
+
+// logsInBlocks returns the logs of the blocks matching the criteria, in the order of the blocks
+func (api *APIImpl) logsInBlocks(ctx context.Context, tx kv.Tx, blockNumbers *roaring.Bitmap, crit filters.FilterCriteria) ([]*types.Log, error) {
+	logs := []*types.Log{}
 	iter := blockNumbers.Iterator()
 	for iter.HasNext() {
-		if err = ctx.Err(); err != nil {
+		if err := ctx.Err(); err != nil {
 			return nil, err
 		}
 
@@ -172,7 +275,9 @@ func (api *APIImpl) GetLogs(ctx context.Context, crit filters.FilterCriteria) ([
 		var logIndex uint
 		var txIndex uint
 		var blockLogs []*types.Log
+		found := false
 		err := tx.ForPrefix(kv.Log, dbutils.EncodeBlockNumber(blockNumber), func(k, v []byte) error {
+			found = true
 			var logs types.Logs
 			if err := cbor.Unmarshal(&logs, bytes.NewReader(v)); err != nil {
 				return fmt.Errorf("receipt unmarshal failed:  %w", err)
@@ -196,6 +301,14 @@ func (api *APIImpl) GetLogs(ctx context.Context, crit filters.FilterCriteria) ([
 		if err != nil {
 			return logs, err
 		}
+		if !found {
+			// the index says the block has matching logs, so they have been pruned or retired into the snapshots
+			if blockLogs, err = api.regeneratedLogs(ctx, tx, blockNumber, crit); err != nil {
+				return nil, err
+			}
+			logs = append(logs, blockLogs...)
+			continue
+		}
 		if len(blockLogs) == 0 {
 			continue
 		}
@@ -0,0 +1,515 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/consensus/misc"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/ethdb"
+	rpcapi "github.com/ledgerwatch/erigon/internal/ethapi"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/adapter/ethapi"
+	"github.com/ledgerwatch/erigon/turbo/rpchelper"
+	"github.com/ledgerwatch/log/v3"
+)
+
+const (
+	// maxSimulateBlocks limits the number of the simulated blocks, including the empty blocks filling the gaps
+	maxSimulateBlocks = 256
+	maxSimulateCalls  = 1000
+	simulateTimeout   = 5 * time.Second
+	// simulateBlockTime is the default difference between the timestamps of the simulated blocks
+	simulateBlockTime = 12
+)
+
+var (
+	// transferLogAddress and transferLogTopic are the address and the topic of the logs of ether transfers (see
+	// SimulationPayload.TraceTransfers), the same as of the ERC-20 Transfer event
+	transferLogAddress = common.HexToAddress("0xEeeeeEeeeEeEeeEeEeEeeEEEeeeeEeeeeeeeEEeE")
+	transferLogTopic   = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+)
+
+// SimulationPayload is the request of eth_simulateV1
+type SimulationPayload struct {
+	BlockStateCalls        []SimulatedBlock `json:"blockStateCalls"`
+	TraceTransfers         bool             `json:"traceTransfers"`         // ether transfers are returned as logs
+	Validation             bool             `json:"validation"`             // nonces, balances and base fee are checked as in the real blocks
+	ReturnFullTransactions bool             `json:"returnFullTransactions"` // blocks contain transactions, not only hashes
+}
+
+// SimulatedBlock is the block of eth_simulateV1: the state overrides are applied before the calls
+type SimulatedBlock struct {
+	BlockOverrides *SimulatedBlockOverrides `json:"blockOverrides"`
+	StateOverrides *rpcapi.StateOverrides   `json:"stateOverrides"`
+	Calls          []rpcapi.CallArgs        `json:"calls"`
+}
+
+type SimulatedBlockOverrides struct {
+	Number        *hexutil.Big    `json:"number"`
+	Time          *hexutil.Uint64 `json:"time"`
+	GasLimit      *hexutil.Uint64 `json:"gasLimit"`
+	FeeRecipient  *common.Address `json:"feeRecipient"`
+	PrevRandao    *common.Hash    `json:"prevRandao"`
+	BaseFeePerGas *hexutil.Big    `json:"baseFeePerGas"`
+}
+
+type SimulatedCallResult struct {
+	ReturnData hexutil.Bytes       `json:"returnData"`
+	Logs       []*types.Log        `json:"logs"`
+	GasUsed    hexutil.Uint64      `json:"gasUsed"`
+	Status     hexutil.Uint64      `json:"status"`
+	Error      *SimulatedCallError `json:"error,omitempty"`
+}
+
+type SimulatedCallError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    string `json:"data,omitempty"`
+}
+
+// Error codes of eth_simulateV1, as defined by the execution-apis spec
+const (
+	simulateErrInvalidParams      = -32602
+	simulateErrInvalidTransaction = -32000
+	simulateErrFeeCapTooLow       = -32005
+	simulateErrReverted           = 3
+	simulateErrVM                 = -32015
+	simulateErrNonceTooLow        = -38010
+	simulateErrNonceTooHigh       = -38011
+	simulateErrIntrinsicGas       = -38013
+	simulateErrInsufficientFunds  = -38014
+	simulateErrBlockGasLimit      = -38015
+	simulateErrBlockNumber        = -38020
+	simulateErrBlockTimestamp     = -38021
+	simulateErrSenderNoEOA        = -38024
+	simulateErrClientLimit        = -38026
+)
+
+// SimulateError is the error of eth_simulateV1 that fails the whole request, with the code defined by the spec
+type SimulateError struct {
+	Code int
+	Err  error
+}
+
+func (e *SimulateError) Error() string  { return e.Err.Error() }
+func (e *SimulateError) ErrorCode() int { return e.Code }
+func (e *SimulateError) Unwrap() error  { return e.Err }
+
+func simulateErrorf(code int, format string, args ...interface{}) *SimulateError {
+	return &SimulateError{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// applyMessageErrorCode returns the code of the error that prevented the call from being executed
+func applyMessageErrorCode(err error) int {
+	switch {
+	case errors.Is(err, core.ErrNonceTooLow):
+		return simulateErrNonceTooLow
+	case errors.Is(err, core.ErrNonceTooHigh), errors.Is(err, core.ErrNonceMax):
+		return simulateErrNonceTooHigh
+	case errors.Is(err, core.ErrIntrinsicGas):
+		return simulateErrIntrinsicGas
+	case errors.Is(err, core.ErrInsufficientFunds), errors.Is(err, vm.ErrInsufficientBalance):
+		return simulateErrInsufficientFunds
+	case errors.Is(err, core.ErrGasLimitReached):
+		return simulateErrBlockGasLimit
+	case errors.Is(err, core.ErrFeeCapTooLow):
+		return simulateErrFeeCapTooLow
+	case errors.Is(err, core.ErrSenderNoEOA):
+		return simulateErrSenderNoEOA
+	default:
+		return simulateErrInvalidTransaction
+	}
+}
+
+// simulateCanceller cancels the EVM that is executing a call of the simulation when the simulation times out, so
+// that one goroutine watches the context for all the calls
+type simulateCanceller struct {
+	lock      sync.Mutex
+	evm       *vm.EVM
+	cancelled bool
+}
+
+func (c *simulateCanceller) watch(ctx context.Context) {
+	<-ctx.Done()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cancelled = true
+	if c.evm != nil {
+		c.evm.Cancel()
+	}
+}
+
+// setEVM makes evm the one cancelled on timeout, cancelling it right away if the simulation has already timed out
+func (c *simulateCanceller) setEVM(evm *vm.EVM) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.evm = evm
+	if c.cancelled {
+		evm.Cancel()
+	}
+}
+
+// SimulateV1 implements eth_simulateV1. Executes the calls in a sequence of blocks on top of blockNrOrHash, each
+// block seeing the changes of the previous ones, and returns the blocks with the results of the calls. The gaps
+// between the block numbers are filled with empty blocks. The calls together may use at most the RPC gas cap. The
+// state roots of the blocks are not computed
+func (api *APIImpl) SimulateV1(ctx context.Context, payload SimulationPayload, blockNrOrHash *rpc.BlockNumberOrHash) ([]map[string]interface{}, error) {
+	if len(payload.BlockStateCalls) == 0 {
+		return nil, simulateErrorf(simulateErrInvalidParams, "empty blockStateCalls")
+	}
+	if len(payload.BlockStateCalls) > maxSimulateBlocks {
+		return nil, simulateErrorf(simulateErrClientLimit, "too many blocks: %d, max %d", len(payload.BlockStateCalls), maxSimulateBlocks)
+	}
+	callCount := 0
+	for _, simulated := range payload.BlockStateCalls {
+		callCount += len(simulated.Calls)
+	}
+	if callCount > maxSimulateCalls {
+		return nil, simulateErrorf(simulateErrClientLimit, "too many calls: %d, max %d", callCount, maxSimulateCalls)
+	}
+	bNrOrHash := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+	if blockNrOrHash != nil {
+		bNrOrHash = *blockNrOrHash
+	}
+
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	chainConfig, err := api.chainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	blockNum, hash, _, err := rpchelper.GetBlockNumber(bNrOrHash, tx, api.filters)
+	if err != nil {
+		return nil, err
+	}
+	block, err := api.blockWithSenders(tx, hash, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block %d(%x) not found", blockNum, hash)
+	}
+	stateReader, err := api.stateReader(ctx, tx, bNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(start time.Time) { log.Trace("Executing EVM simulateV1 finished", "runtime", time.Since(start)) }(time.Now())
+	ctx, cancel := context.WithTimeout(ctx, simulateTimeout)
+	defer cancel()
+	canceller := &simulateCanceller{}
+	go canceller.watch(ctx)
+
+	contractHasTEVM := func(contractHash common.Hash) (bool, error) { return false, nil }
+	if api.TevmEnabled {
+		contractHasTEVM = ethdb.GetHasTEVM(tx)
+	}
+	// Hashes of the simulated blocks, for BLOCKHASH
+	simulatedHashes := map[uint64]common.Hash{}
+	getHash := func(i uint64) common.Hash {
+		if hash, ok := simulatedHashes[i]; ok {
+			return hash
+		}
+		hash, err := rawdb.ReadCanonicalHash(tx, i)
+		if err != nil {
+			log.Debug("Can't get block hash by number", "number", i, "only-canonical", true)
+		}
+		return hash
+	}
+
+	// The changes of the blocks are kept in the overlay, the database is never written
+	overlay := state.NewOverlayState(stateReader)
+	sim := &simulation{
+		chainConfig:     chainConfig,
+		payload:         &payload,
+		overlay:         overlay,
+		getHash:         getHash,
+		contractHasTEVM: contractHasTEVM,
+		canceller:       canceller,
+		gasCap:          api.GasCap,
+	}
+	parent := block.Header()
+	results := make([]map[string]interface{}, 0, len(payload.BlockStateCalls))
+	appendBlock := func(header *types.Header, simulated SimulatedBlock) error {
+		fields, err := api.simulateBlock(sim, header, simulated)
+		if err != nil {
+			return err
+		}
+		simulatedHashes[header.Number.Uint64()] = header.Hash()
+		results = append(results, fields)
+		parent = header
+		return nil
+	}
+	for _, simulated := range payload.BlockStateCalls {
+		if overrides := simulated.BlockOverrides; overrides != nil && overrides.Number != nil {
+			number := overrides.Number.ToInt()
+			if number.Cmp(parent.Number) <= 0 {
+				return nil, simulateErrorf(simulateErrBlockNumber, "block number %d is not after %d", number, parent.Number)
+			}
+			if new(big.Int).Sub(number, block.Number()).Cmp(big.NewInt(maxSimulateBlocks)) > 0 {
+				return nil, simulateErrorf(simulateErrClientLimit, "too many blocks: block number %d is more than %d after %d", number, maxSimulateBlocks, block.Number())
+			}
+			for new(big.Int).Add(parent.Number, common.Big1).Cmp(number) < 0 {
+				if err := appendBlock(simulatedHeader(chainConfig, parent, payload.Validation), SimulatedBlock{}); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if len(results) >= maxSimulateBlocks {
+			return nil, simulateErrorf(simulateErrClientLimit, "too many blocks, max %d", maxSimulateBlocks)
+		}
+		header := simulatedHeader(chainConfig, parent, payload.Validation)
+		if err := applyBlockOverrides(header, parent, simulated.BlockOverrides); err != nil {
+			return nil, err
+		}
+		if err := appendBlock(header, simulated); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// simulation is the state of eth_simulateV1 shared by the simulated blocks
+type simulation struct {
+	chainConfig     *params.ChainConfig
+	payload         *SimulationPayload
+	overlay         *state.OverlayState
+	getHash         func(uint64) common.Hash
+	contractHasTEVM func(common.Hash) (bool, error)
+	canceller       *simulateCanceller
+	// gasCap is the gas all the calls together may use, 0 if the gas is not capped
+	gasCap  uint64
+	gasUsed uint64
+}
+
+// simulatedHeader returns the header of the block after parent, without the overrides. GasUsed, Bloom and the
+// roots are filled by simulateBlock
+func simulatedHeader(chainConfig *params.ChainConfig, parent *types.Header, validation bool) *types.Header {
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		UncleHash:  types.EmptyUncleHash,
+		Coinbase:   parent.Coinbase,
+		Difficulty: new(big.Int),
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		GasLimit:   parent.GasLimit,
+		Time:       parent.Time + simulateBlockTime,
+	}
+	if chainConfig.IsLondon(header.Number.Uint64()) {
+		// Without validation the calls do not pay for gas by default, as in eth_call
+		header.BaseFee = new(big.Int)
+		if validation {
+			header.BaseFee = misc.CalcBaseFee(chainConfig, parent)
+		}
+	}
+	return header
+}
+
+// applyBlockOverrides applies the overrides to the header of the block after parent. The gaps between the numbers
+// are filled by SimulateV1, so the overridden number must follow parent's
+func applyBlockOverrides(header, parent *types.Header, overrides *SimulatedBlockOverrides) error {
+	if overrides == nil {
+		return nil
+	}
+	if overrides.Number != nil && overrides.Number.ToInt().Cmp(header.Number) != 0 {
+		return simulateErrorf(simulateErrBlockNumber, "block number %d does not follow %d", overrides.Number.ToInt(), parent.Number)
+	}
+	if overrides.Time != nil {
+		if uint64(*overrides.Time) <= parent.Time {
+			return simulateErrorf(simulateErrBlockTimestamp, "block timestamp %d is not after %d", *overrides.Time, parent.Time)
+		}
+		header.Time = uint64(*overrides.Time)
+	}
+	if overrides.GasLimit != nil {
+		header.GasLimit = uint64(*overrides.GasLimit)
+	}
+	if overrides.FeeRecipient != nil {
+		header.Coinbase = *overrides.FeeRecipient
+	}
+	if overrides.PrevRandao != nil {
+		header.MixDigest = *overrides.PrevRandao
+	}
+	if overrides.BaseFeePerGas != nil {
+		header.BaseFee = new(big.Int).Set(overrides.BaseFeePerGas.ToInt())
+	}
+	return nil
+}
+
+// simulateBlock executes the calls of the block, writes the resulting state into the overlay, and returns the block
+// in the RPC representation, with the results of the calls
+func (api *APIImpl) simulateBlock(sim *simulation, header *types.Header, simulated SimulatedBlock) (map[string]interface{}, error) {
+	chainConfig, payload, overlay := sim.chainConfig, sim.payload, sim.overlay
+	blockNum := header.Number.Uint64()
+	rules := chainConfig.Rules(blockNum)
+	ibs := state.New(overlay)
+	if simulated.StateOverrides != nil {
+		if err := simulated.StateOverrides.Override(ibs); err != nil {
+			return nil, err
+		}
+		if err := ibs.FinalizeTx(rules, overlay); err != nil {
+			return nil, err
+		}
+	}
+
+	var baseFee *uint256.Int
+	if header.BaseFee != nil {
+		var overflow bool
+		if baseFee, overflow = uint256.FromBig(header.BaseFee); overflow {
+			return nil, fmt.Errorf("header.BaseFee uint256 overflow")
+		}
+	}
+	blockCtx := vm.BlockContext{
+		CanTransfer:     core.CanTransfer,
+		Transfer:        core.Transfer,
+		GetHash:         sim.getHash,
+		ContractHasTEVM: sim.contractHasTEVM,
+		Coinbase:        header.Coinbase,
+		BlockNumber:     blockNum,
+		Time:            header.Time,
+		Difficulty:      header.Difficulty,
+		GasLimit:        header.GasLimit,
+		BaseFee:         baseFee,
+	}
+	if header.MixDigest != (common.Hash{}) {
+		random := header.MixDigest
+		blockCtx.PrevRanDao = &random
+	}
+	if payload.TraceTransfers {
+		blockCtx.Transfer = transferWithLog
+	}
+	vmConfig := vm.Config{NoBaseFee: !payload.Validation}
+
+	gp := new(core.GasPool).AddGas(header.GasLimit)
+	txs := make(types.Transactions, 0, len(simulated.Calls))
+	receipts := make(types.Receipts, 0, len(simulated.Calls))
+	calls := make([]SimulatedCallResult, 0, len(simulated.Calls))
+	for i, args := range simulated.Calls {
+		if args.Gas == nil || uint64(*args.Gas) == 0 {
+			// By default the call may use the rest of the block, as long as the simulation has gas left
+			remaining := gp.Gas()
+			if sim.gasCap != 0 && remaining > sim.gasCap-sim.gasUsed {
+				remaining = sim.gasCap - sim.gasUsed
+			}
+			args.Gas = (*hexutil.Uint64)(&remaining)
+		}
+		if sim.gasCap != 0 && (sim.gasUsed >= sim.gasCap || uint64(*args.Gas) > sim.gasCap-sim.gasUsed) {
+			return nil, simulateErrorf(simulateErrClientLimit, "call %d of block %d: gas cap of the simulation %d exceeded, %d left", i, blockNum, sim.gasCap, sim.gasCap-sim.gasUsed)
+		}
+		msg, err := args.ToMessage(sim.gasCap, baseFee)
+		if err != nil {
+			return nil, simulateErrorf(simulateErrInvalidParams, "call %d of block %d: %w", i, blockNum, err)
+		}
+		nonce := ibs.GetNonce(msg.From())
+		if args.Nonce != nil {
+			nonce = uint64(*args.Nonce)
+		}
+		msg = types.NewMessage(msg.From(), msg.To(), nonce, msg.Value(), msg.Gas(), msg.GasPrice(), msg.FeeCap(), msg.Tip(), msg.Data(), msg.AccessList(), payload.Validation)
+		txn := simulatedTransaction(msg)
+		ibs.Prepare(txn.Hash(), common.Hash{}, i)
+
+		evm := vm.NewEVM(blockCtx, core.NewEVMTxContext(msg), ibs, chainConfig, vmConfig)
+		sim.canceller.setEVM(evm)
+		result, err := core.ApplyMessage(evm, msg, gp, true /* refunds */, false /* gasBailout */)
+		if err != nil {
+			return nil, &SimulateError{Code: applyMessageErrorCode(err), Err: fmt.Errorf("call %d of block %d: %w", i, blockNum, err)}
+		}
+		if evm.Cancelled() {
+			return nil, fmt.Errorf("execution aborted (timeout = %v)", simulateTimeout)
+		}
+		sim.gasUsed += result.UsedGas
+		if err = ibs.FinalizeTx(rules, overlay); err != nil {
+			return nil, err
+		}
+
+		header.GasUsed += result.UsedGas
+		receipt := types.NewReceipt(result.Failed(), header.GasUsed)
+		receipt.TxHash = txn.Hash()
+		receipt.GasUsed = result.UsedGas
+		receipt.Logs = ibs.GetLogs(txn.Hash())
+		receipt.TransactionIndex = uint(i)
+		call := SimulatedCallResult{ReturnData: result.Return(), Logs: receipt.Logs, GasUsed: hexutil.Uint64(result.UsedGas), Status: hexutil.Uint64(receipt.Status)}
+		if call.Logs == nil {
+			call.Logs = []*types.Log{}
+		}
+		if errors.Is(result.Err, vm.ErrExecutionReverted) {
+			revertErr := ethapi.NewRevertError(result)
+			call.Error = &SimulatedCallError{Code: simulateErrReverted, Message: revertErr.Error(), Data: hexutil.Encode(result.Revert())}
+		} else if result.Err != nil {
+			call.Error = &SimulatedCallError{Code: simulateErrVM, Message: result.Err.Error()}
+		}
+		txs = append(txs, txn)
+		receipts = append(receipts, receipt)
+		calls = append(calls, call)
+	}
+
+	header.Bloom = types.CreateBloom(receipts)
+	header.TxHash = types.DeriveSha(txs)
+	header.ReceiptHash = types.DeriveSha(receipts)
+	blockHash := header.Hash()
+	for _, receipt := range receipts {
+		for _, l := range receipt.Logs {
+			l.BlockHash = blockHash
+			l.BlockNumber = blockNum
+		}
+	}
+
+	fields := ethapi.RPCMarshalHeader(header)
+	if payload.ReturnFullTransactions {
+		rpcTxs := make([]*RPCTransaction, len(txs))
+		for i, txn := range txs {
+			rpcTxs[i] = newRPCTransaction(txn, blockHash, blockNum, uint64(i), header.BaseFee)
+		}
+		fields["transactions"] = rpcTxs
+	} else {
+		hashes := make([]common.Hash, len(txs))
+		for i, txn := range txs {
+			hashes[i] = txn.Hash()
+		}
+		fields["transactions"] = hashes
+	}
+	fields["calls"] = calls
+	return fields, nil
+}
+
+// simulatedTransaction returns the unsigned transaction of the call, with the sender of the call. Its hash identifies
+// the call in the logs and in the block
+func simulatedTransaction(msg types.Message) types.Transaction {
+	var txn *types.LegacyTx
+	if msg.To() == nil {
+		txn = types.NewContractCreation(msg.Nonce(), msg.Value(), msg.Gas(), msg.GasPrice(), msg.Data())
+	} else {
+		txn = types.NewTransaction(msg.Nonce(), *msg.To(), msg.Value(), msg.Gas(), msg.GasPrice(), msg.Data())
+	}
+	txn.SetSender(msg.From())
+	return txn
+}
+
+// transferWithLog is core.Transfer that adds a log of the transfer, like the Transfer event of ERC-20
+func transferWithLog(db vm.IntraBlockState, sender, recipient common.Address, amount *uint256.Int, bailout bool) {
+	core.Transfer(db, sender, recipient, amount, bailout)
+	if amount.IsZero() {
+		return
+	}
+	data := amount.Bytes32()
+	db.AddLog(&types.Log{
+		Address: transferLogAddress,
+		Topics:  []common.Hash{transferLogTopic, sender.Hash(), recipient.Hash()},
+		Data:    data[:],
+	})
+}
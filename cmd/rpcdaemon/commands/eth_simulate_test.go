@@ -0,0 +1,134 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/rpcdaemontest"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/internal/ethapi"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulateV1(t *testing.T) {
+	db := rpcdaemontest.CreateTestKV(t)
+	stateCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	api := NewEthAPI(NewBaseApi(nil, stateCache, snapshotsync.NewBlockReader(), nil, nil, false), db, nil, nil, nil, 5000000)
+
+	from, to := common.HexToAddress("0x1111"), common.HexToAddress("0x2222")
+	balance := (*hexutil.Big)(big.NewInt(1000))
+	value := (*hexutil.Big)(big.NewInt(400))
+	transfer := ethapi.CallArgs{From: &from, To: &to, Value: value}
+	res, err := api.SimulateV1(context.Background(), SimulationPayload{
+		BlockStateCalls: []SimulatedBlock{
+			{StateOverrides: &ethapi.StateOverrides{from: ethapi.Account{Balance: &balance}}, Calls: []ethapi.CallArgs{transfer}},
+			{Calls: []ethapi.CallArgs{transfer}}, // sees the balance left by the first block
+		},
+		TraceTransfers: true,
+	}, nil)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	require.Equal(t, res[0]["hash"], res[1]["parentHash"])
+	require.Equal(t, new(big.Int).Add(res[0]["number"].(*hexutil.Big).ToInt(), big.NewInt(1)), res[1]["number"].(*hexutil.Big).ToInt())
+
+	calls := res[0]["calls"].([]SimulatedCallResult)
+	require.Len(t, calls, 1)
+	require.Nil(t, calls[0].Error)
+	require.Equal(t, hexutil.Uint64(1), calls[0].Status)
+	require.Len(t, calls[0].Logs, 1)
+	require.Equal(t, transferLogAddress, calls[0].Logs[0].Address)
+	require.Equal(t, to.Hash(), calls[0].Logs[0].Topics[2])
+
+	_, err = api.SimulateV1(context.Background(), SimulationPayload{
+		BlockStateCalls: []SimulatedBlock{{Calls: []ethapi.CallArgs{transfer}}},
+	}, nil)
+	require.Error(t, err) // not enough balance without the override
+	var simErr *SimulateError
+	require.True(t, errors.As(err, &simErr))
+	require.Equal(t, simulateErrInsufficientFunds, simErr.Code)
+}
+
+func TestSimulateV1Errors(t *testing.T) {
+	db := rpcdaemontest.CreateTestKV(t)
+	stateCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	api := NewEthAPI(NewBaseApi(nil, stateCache, snapshotsync.NewBlockReader(), nil, nil, false), db, nil, nil, nil, 5000000)
+
+	reverter, invalid := common.HexToAddress("0x3333"), common.HexToAddress("0x4444")
+	revertCode := hexutil.Bytes(common.FromHex("0x60006000fd")) // REVERT(0, 0)
+	invalidCode := hexutil.Bytes(common.FromHex("0xfe"))        // INVALID
+	res, err := api.SimulateV1(context.Background(), SimulationPayload{
+		BlockStateCalls: []SimulatedBlock{{
+			StateOverrides: &ethapi.StateOverrides{reverter: ethapi.Account{Code: &revertCode}, invalid: ethapi.Account{Code: &invalidCode}},
+			Calls:          []ethapi.CallArgs{{To: &reverter}, {To: &invalid}},
+		}},
+	}, nil)
+	require.NoError(t, err)
+	calls := res[0]["calls"].([]SimulatedCallResult)
+	require.Len(t, calls, 2)
+	require.Equal(t, hexutil.Uint64(0), calls[0].Status)
+	require.Equal(t, &SimulatedCallError{Code: 3, Message: "execution reverted", Data: "0x"}, calls[0].Error)
+	require.Equal(t, hexutil.Uint64(0), calls[1].Status)
+	require.Equal(t, simulateErrVM, calls[1].Error.Code)
+
+	// The calls together may not use more than the gas cap
+	gas := hexutil.Uint64(3000000)
+	_, err = api.SimulateV1(context.Background(), SimulationPayload{
+		BlockStateCalls: []SimulatedBlock{
+			{StateOverrides: &ethapi.StateOverrides{invalid: ethapi.Account{Code: &invalidCode}}, Calls: []ethapi.CallArgs{{To: &invalid, Gas: &gas}}},
+			{Calls: []ethapi.CallArgs{{To: &invalid, Gas: &gas}}},
+		},
+	}, nil)
+	var simErr *SimulateError
+	require.True(t, errors.As(err, &simErr))
+	require.Equal(t, simulateErrClientLimit, simErr.Code)
+
+	latest, err := api.BlockNumber(context.Background())
+	require.NoError(t, err)
+	timestamp := hexutil.Uint64(1)
+	_, err = api.SimulateV1(context.Background(), SimulationPayload{
+		BlockStateCalls: []SimulatedBlock{{BlockOverrides: &SimulatedBlockOverrides{Time: &timestamp}}},
+	}, nil)
+	require.True(t, errors.As(err, &simErr))
+	require.Equal(t, simulateErrBlockTimestamp, simErr.Code)
+
+	number := (*hexutil.Big)(new(big.Int).SetUint64(uint64(latest)))
+	_, err = api.SimulateV1(context.Background(), SimulationPayload{
+		BlockStateCalls: []SimulatedBlock{{BlockOverrides: &SimulatedBlockOverrides{Number: number}}},
+	}, nil)
+	require.True(t, errors.As(err, &simErr))
+	require.Equal(t, simulateErrBlockNumber, simErr.Code)
+
+	number = (*hexutil.Big)(new(big.Int).SetUint64(uint64(latest) + maxSimulateBlocks + 1))
+	_, err = api.SimulateV1(context.Background(), SimulationPayload{
+		BlockStateCalls: []SimulatedBlock{{BlockOverrides: &SimulatedBlockOverrides{Number: number}}},
+	}, nil)
+	require.True(t, errors.As(err, &simErr))
+	require.Equal(t, simulateErrClientLimit, simErr.Code)
+}
+
+func TestSimulateV1FillsGaps(t *testing.T) {
+	db := rpcdaemontest.CreateTestKV(t)
+	stateCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	api := NewEthAPI(NewBaseApi(nil, stateCache, snapshotsync.NewBlockReader(), nil, nil, false), db, nil, nil, nil, 5000000)
+
+	latest, err := api.BlockNumber(context.Background())
+	require.NoError(t, err)
+	number := (*hexutil.Big)(new(big.Int).SetUint64(uint64(latest) + 4))
+	res, err := api.SimulateV1(context.Background(), SimulationPayload{
+		BlockStateCalls: []SimulatedBlock{{BlockOverrides: &SimulatedBlockOverrides{Number: number}}},
+	}, nil)
+	require.NoError(t, err)
+	require.Len(t, res, 4) // three empty blocks before the requested one
+	for i, fields := range res {
+		require.Equal(t, new(big.Int).SetUint64(uint64(latest)+uint64(i)+1), fields["number"].(*hexutil.Big).ToInt())
+		if i > 0 {
+			require.Equal(t, res[i-1]["hash"], fields["parentHash"])
+			require.Greater(t, uint64(fields["timestamp"].(hexutil.Uint64)), uint64(res[i-1]["timestamp"].(hexutil.Uint64)))
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+)
+
+// ots2MaxListSize is the maximum number of contracts returned by one call of ots2_get*List
+const ots2MaxListSize = 1_000
+
+// Ots2API the interface for the ots2_ RPC commands, served from the contract index built by the OtsContracts stage
+// of erigon (`ots2` in --experiments)
+type Ots2API interface {
+	GetContractCreator(ctx context.Context, addr common.Address) (*ContractCreator, error)
+	GetAddressAttributes(ctx context.Context, addr common.Address) (*AddressAttributes, error)
+	GetAllContractsCount(ctx context.Context) (hexutil.Uint64, error)
+	GetAllContractsList(ctx context.Context, idx, count uint64) ([]*ContractListItem, error)
+	GetERC20Count(ctx context.Context) (hexutil.Uint64, error)
+	GetERC20List(ctx context.Context, idx, count uint64) ([]*ContractListItem, error)
+	GetERC721Count(ctx context.Context) (hexutil.Uint64, error)
+	GetERC721List(ctx context.Context, idx, count uint64) ([]*ContractListItem, error)
+}
+
+// Ots2APIImpl data structure to store things needed for ots2_ commands
+type Ots2APIImpl struct {
+	*BaseAPI
+	db kv.RoDB
+}
+
+// NewOts2API returns Ots2APIImpl instance
+func NewOts2API(base *BaseAPI, db kv.RoDB) *Ots2APIImpl {
+	return &Ots2APIImpl{
+		BaseAPI: base,
+		db:      db,
+	}
+}
+
+// ContractCreator is the transaction which deployed a contract
+type ContractCreator struct {
+	Hash        common.Hash    `json:"hash"`
+	Creator     common.Address `json:"creator"`
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+}
+
+// AddressAttributes are the properties of an address found by probing its code
+type AddressAttributes struct {
+	ERC20  bool `json:"erc20,omitempty"`
+	ERC721 bool `json:"erc721,omitempty"`
+}
+
+// ContractListItem is a contract of ots2_getAllContractsList, ots2_getERC20List or ots2_getERC721List
+type ContractListItem struct {
+	Address     common.Address `json:"address"`
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	Hash        common.Hash    `json:"hash"`
+	Creator     common.Address `json:"creator"`
+}
+
+// GetContractCreator implements ots2_getContractCreator. Returns nil if the address is not a contract deployed by a
+// transaction
+func (api *Ots2APIImpl) GetContractCreator(ctx context.Context, addr common.Address) (*ContractCreator, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = checkContractIndex(tx); err != nil {
+		return nil, err
+	}
+	creation, err := rawdb.ReadContractCreation(tx, addr)
+	if err != nil {
+		return nil, err
+	}
+	if creation == nil {
+		return nil, nil
+	}
+	return &ContractCreator{Hash: creation.Hash, Creator: creation.Creator, BlockNumber: hexutil.Uint64(creation.BlockNumber)}, nil
+}
+
+// GetAddressAttributes implements ots2_getAddressAttributes
+func (api *Ots2APIImpl) GetAddressAttributes(ctx context.Context, addr common.Address) (*AddressAttributes, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = checkContractIndex(tx); err != nil {
+		return nil, err
+	}
+	attrs, err := rawdb.ReadAddressAttributes(tx, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &AddressAttributes{ERC20: attrs&rawdb.AttrERC20 != 0, ERC721: attrs&rawdb.AttrERC721 != 0}, nil
+}
+
+// GetAllContractsCount implements ots2_getAllContractsCount
+func (api *Ots2APIImpl) GetAllContractsCount(ctx context.Context) (hexutil.Uint64, error) {
+	return api.contractListCount(ctx, rawdb.OtsAllContracts)
+}
+
+// GetAllContractsList implements ots2_getAllContractsList. Returns the contracts from the ordinal idx, in the order of
+// deployment
+func (api *Ots2APIImpl) GetAllContractsList(ctx context.Context, idx, count uint64) ([]*ContractListItem, error) {
+	return api.contractList(ctx, rawdb.OtsAllContracts, idx, count)
+}
+
+// GetERC20Count implements ots2_getERC20Count
+func (api *Ots2APIImpl) GetERC20Count(ctx context.Context) (hexutil.Uint64, error) {
+	return api.contractListCount(ctx, rawdb.OtsERC20)
+}
+
+// GetERC20List implements ots2_getERC20List
+func (api *Ots2APIImpl) GetERC20List(ctx context.Context, idx, count uint64) ([]*ContractListItem, error) {
+	return api.contractList(ctx, rawdb.OtsERC20, idx, count)
+}
+
+// GetERC721Count implements ots2_getERC721Count
+func (api *Ots2APIImpl) GetERC721Count(ctx context.Context) (hexutil.Uint64, error) {
+	return api.contractListCount(ctx, rawdb.OtsERC721)
+}
+
+// GetERC721List implements ots2_getERC721List
+func (api *Ots2APIImpl) GetERC721List(ctx context.Context, idx, count uint64) ([]*ContractListItem, error) {
+	return api.contractList(ctx, rawdb.OtsERC721, idx, count)
+}
+
+func (api *Ots2APIImpl) contractListCount(ctx context.Context, table string) (hexutil.Uint64, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err = checkContractIndex(tx); err != nil {
+		return 0, err
+	}
+	n, err := rawdb.ReadContractListCount(tx, table)
+	return hexutil.Uint64(n), err
+}
+
+func (api *Ots2APIImpl) contractList(ctx context.Context, table string, idx, count uint64) ([]*ContractListItem, error) {
+	if count > ots2MaxListSize {
+		return nil, fmt.Errorf("count %d exceeds the limit of %d contracts", count, ots2MaxListSize)
+	}
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = checkContractIndex(tx); err != nil {
+		return nil, err
+	}
+	entries, err := rawdb.ReadContractList(tx, table, idx, count)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*ContractListItem, 0, len(entries))
+	for _, entry := range entries {
+		item := &ContractListItem{Address: entry.Address, BlockNumber: hexutil.Uint64(entry.BlockNumber)}
+		creation, err := rawdb.ReadContractCreation(tx, entry.Address)
+		if err != nil {
+			return nil, err
+		}
+		// The creation of a contract deployed again at the same address is the latest one
+		if creation != nil && creation.BlockNumber == entry.BlockNumber {
+			item.Hash = creation.Hash
+			item.Creator = creation.Creator
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// checkContractIndex returns an error if erigon does not build the contract index
+func checkContractIndex(tx kv.Tx) error {
+	progress, err := stages.GetStageProgress(tx, stages.OtsContracts)
+	if err != nil {
+		return err
+	}
+	if progress == 0 {
+		return fmt.Errorf("contract index is not available, add `ots2` to --experiments of erigon")
+	}
+	return nil
+}
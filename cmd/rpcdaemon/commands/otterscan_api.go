@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+)
+
+// OtterscanAPI the interface for the ots_ RPC commands
+type OtterscanAPI interface {
+	GetTransactionBySenderAndNonce(ctx context.Context, addr common.Address, nonce uint64) (*common.Hash, error)
+	SearchTransactionsBefore(ctx context.Context, addr common.Address, blockNum uint64, pageSize uint16) (*TransactionsWithReceipts, error)
+	SearchTransactionsAfter(ctx context.Context, addr common.Address, blockNum uint64, pageSize uint16) (*TransactionsWithReceipts, error)
+}
+
+// OtterscanAPIImpl data structure to store things needed for ots_ commands
+type OtterscanAPIImpl struct {
+	*BaseAPI
+	db kv.RoDB
+}
+
+// NewOtterscanAPI returns OtterscanAPIImpl instance
+func NewOtterscanAPI(base *BaseAPI, db kv.RoDB) *OtterscanAPIImpl {
+	return &OtterscanAPIImpl{
+		BaseAPI: base,
+		db:      db,
+	}
+}
+
+// GetTransactionBySenderAndNonce implements ots_getTransactionBySenderAndNonce. Returns the hash of the transaction
+// of the sender with the given nonce, nil if it has not been mined. The block is found by the binary search of the
+// first block after which the nonce of the sender is greater, in the account history, so no extra index is needed
+func (api *OtterscanAPIImpl) GetTransactionBySenderAndNonce(ctx context.Context, addr common.Address, nonce uint64) (*common.Hash, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	latest := rawdb.ReadCurrentBlockNumber(tx)
+	if latest == nil {
+		return nil, fmt.Errorf("current block number not found")
+	}
+	// nonceAfter returns the nonce of the sender after the execution of the block
+	var searchErr error
+	nonceAfter := func(blockNumber uint64) uint64 {
+		if searchErr != nil {
+			return 0
+		}
+		var acc *accounts.Account
+		if acc, searchErr = api.historyStateReader(tx, blockNumber+1).ReadAccountData(addr); acc == nil {
+			return 0
+		}
+		return acc.Nonce
+	}
+	if nonceAfter(*latest) <= nonce {
+		return nil, searchErr
+	}
+	blockNumber := uint64(sort.Search(int(*latest)+1, func(i int) bool {
+		return nonceAfter(uint64(i)) > nonce
+	}))
+	if searchErr != nil {
+		return nil, searchErr
+	}
+
+	block, err := api.blockByNumberWithSenders(tx, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block not found %d", blockNumber)
+	}
+	senders := block.Body().SendersFromTxs()
+	for i, txn := range block.Transactions() {
+		if txn.GetNonce() == nonce && i < len(senders) && senders[i] == addr {
+			hash := txn.Hash()
+			return &hash, nil
+		}
+	}
+	// the nonce of a contract is increased by the contracts it creates, not by transactions
+	return nil, nil
+}
@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/rpcdaemontest"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetTransactionBySenderAndNonce(t *testing.T) {
+	db := rpcdaemontest.CreateTestKV(t)
+	stateCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	base := NewBaseApi(nil, stateCache, snapshotsync.NewBlockReader(), nil, nil, false)
+	api := NewOtterscanAPI(base, db)
+	ethApi := NewEthAPI(base, db, nil, nil, nil, 5000000)
+	sender := common.HexToAddress("0x71562b71999873db5b286df957af199ec94617f7")
+
+	for nonce := uint64(0); nonce < 3; nonce++ {
+		hash, err := api.GetTransactionBySenderAndNonce(context.Background(), sender, nonce)
+		require.NoError(t, err)
+		require.NotNil(t, hash)
+		txn, err := ethApi.GetTransactionByHash(context.Background(), *hash)
+		require.NoError(t, err)
+		require.Equal(t, sender, txn.From)
+		require.Equal(t, nonce, uint64(txn.Nonce))
+	}
+
+	hash, err := api.GetTransactionBySenderAndNonce(context.Background(), sender, 1_000_000)
+	require.NoError(t, err)
+	require.Nil(t, hash)
+}
+
+func TestSearchTransactions(t *testing.T) {
+	db := rpcdaemontest.CreateTestKV(t)
+	stateCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	api := NewOtterscanAPI(NewBaseApi(nil, stateCache, snapshotsync.NewBlockReader(), nil, nil, false), db)
+	sender := common.HexToAddress("0x71562b71999873db5b286df957af199ec94617f7")
+
+	all, err := api.SearchTransactionsBefore(context.Background(), sender, 0, 1000)
+	require.NoError(t, err)
+	require.True(t, all.FirstPage)
+	require.True(t, all.LastPage)
+	require.NotEmpty(t, all.Txs)
+	require.Equal(t, len(all.Txs), len(all.Receipts))
+	for i := 1; i < len(all.Txs); i++ {
+		require.LessOrEqual(t, all.Txs[i].BlockNumber.ToInt().Uint64(), all.Txs[i-1].BlockNumber.ToInt().Uint64())
+	}
+
+	after, err := api.SearchTransactionsAfter(context.Background(), sender, 0, 1000)
+	require.NoError(t, err)
+	require.True(t, after.FirstPage)
+	require.True(t, after.LastPage)
+	require.Equal(t, len(all.Txs), len(after.Txs))
+	for i := range all.Txs {
+		require.Equal(t, all.Txs[i].Hash, after.Txs[i].Hash)
+	}
+
+	// Pages of one block at least, each one starting before the last block of the previous one
+	var hashes []common.Hash
+	blockNum := uint64(0)
+	for {
+		page, err := api.SearchTransactionsBefore(context.Background(), sender, blockNum, 1)
+		require.NoError(t, err)
+		for _, txn := range page.Txs {
+			hashes = append(hashes, txn.Hash)
+		}
+		if page.LastPage {
+			break
+		}
+		require.NotEmpty(t, page.Txs)
+		blockNum = page.Txs[len(page.Txs)-1].BlockNumber.ToInt().Uint64()
+	}
+	require.Equal(t, len(all.Txs), len(hashes))
+	for i := range all.Txs {
+		require.Equal(t, all.Txs[i].Hash, hashes[i])
+	}
+}
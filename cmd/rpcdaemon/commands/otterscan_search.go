@@ -0,0 +1,262 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/consensus/ethash"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/ethdb"
+	"github.com/ledgerwatch/erigon/ethdb/bitmapdb"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/turbo/transactions"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// otsSearchWindow is the number of blocks whose call indices are read at once by the transaction search
+const otsSearchWindow = 100_000
+
+// TransactionsWithReceipts is a page of ots_searchTransactionsBefore/After, with the most recent transactions first.
+// The number of the block of the last transaction of the page is the blockNum of the request of the next page
+type TransactionsWithReceipts struct {
+	Txs       []*RPCTransaction        `json:"txs"`
+	Receipts  []map[string]interface{} `json:"receipts"`
+	FirstPage bool                     `json:"firstPage"`
+	LastPage  bool                     `json:"lastPage"`
+}
+
+// SearchTransactionsBefore implements ots_searchTransactionsBefore. Returns the transactions with the address in
+// their call traces, in the blocks before blockNum (0 - from the latest block), the most recent first. The page has
+// at least pageSize transactions, unless there are no more, and never splits a block. The blocks are taken from the
+// call indices (kv.CallFromIndex and kv.CallToIndex) walked backwards, only those blocks are re-executed
+func (api *OtterscanAPIImpl) SearchTransactionsBefore(ctx context.Context, addr common.Address, blockNum uint64, pageSize uint16) (*TransactionsWithReceipts, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	chainConfig, err := api.chainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	latest := rawdb.ReadCurrentBlockNumber(tx)
+	if latest == nil {
+		return nil, fmt.Errorf("current block number not found")
+	}
+
+	result := &TransactionsWithReceipts{Txs: []*RPCTransaction{}, Receipts: []map[string]interface{}{}}
+	end := *latest
+	if blockNum == 0 {
+		result.FirstPage = true
+	} else if blockNum-1 < end {
+		end = blockNum - 1
+	}
+	for windowEnd := end; ; windowEnd -= otsSearchWindow {
+		var windowBegin uint64
+		if windowEnd >= otsSearchWindow {
+			windowBegin = windowEnd - otsSearchWindow + 1
+		}
+		blocks, err := callBlocks(tx, addr, windowBegin, windowEnd)
+		if err != nil {
+			return nil, err
+		}
+		iter := blocks.ReverseIterator()
+		for iter.HasNext() {
+			if len(result.Txs) >= int(pageSize) {
+				return result, nil
+			}
+			if err = api.searchBlock(ctx, tx, chainConfig, iter.Next(), addr, true /* reverse */, result); err != nil {
+				return nil, err
+			}
+		}
+		if windowBegin == 0 {
+			break
+		}
+	}
+	result.LastPage = true
+	return result, nil
+}
+
+// SearchTransactionsAfter implements ots_searchTransactionsAfter. Returns the transactions with the address in their
+// call traces, in the blocks after blockNum (0 - from the genesis), the most recent first, like
+// ots_searchTransactionsBefore. The blocks are taken from the call indices walked forwards
+func (api *OtterscanAPIImpl) SearchTransactionsAfter(ctx context.Context, addr common.Address, blockNum uint64, pageSize uint16) (*TransactionsWithReceipts, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	chainConfig, err := api.chainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	latest := rawdb.ReadCurrentBlockNumber(tx)
+	if latest == nil {
+		return nil, fmt.Errorf("current block number not found")
+	}
+
+	result := &TransactionsWithReceipts{Txs: []*RPCTransaction{}, Receipts: []map[string]interface{}{}}
+	begin := blockNum + 1
+	if blockNum == 0 {
+		result.LastPage = true
+		begin = 0
+	}
+	full := false
+	for windowBegin := begin; windowBegin <= *latest && !full; windowBegin += otsSearchWindow {
+		windowEnd := *latest
+		if *latest-windowBegin >= otsSearchWindow {
+			windowEnd = windowBegin + otsSearchWindow - 1
+		}
+		blocks, err := callBlocks(tx, addr, windowBegin, windowEnd)
+		if err != nil {
+			return nil, err
+		}
+		iter := blocks.Iterator()
+		for iter.HasNext() {
+			if len(result.Txs) >= int(pageSize) {
+				full = true
+				break
+			}
+			if err = api.searchBlock(ctx, tx, chainConfig, iter.Next(), addr, false /* reverse */, result); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !full {
+		result.FirstPage = true
+	}
+	// The most recent first
+	for i, j := 0, len(result.Txs)-1; i < j; i, j = i+1, j-1 {
+		result.Txs[i], result.Txs[j] = result.Txs[j], result.Txs[i]
+		result.Receipts[i], result.Receipts[j] = result.Receipts[j], result.Receipts[i]
+	}
+	return result, nil
+}
+
+// callBlocks returns the numbers of the blocks in [from, to] with the address in their call traces
+func callBlocks(tx kv.Tx, addr common.Address, from, to uint64) (*roaring64.Bitmap, error) {
+	blocks, err := bitmapdb.Get64(tx, kv.CallFromIndex, addr.Bytes(), from, to)
+	if err != nil {
+		return nil, err
+	}
+	toBlocks, err := bitmapdb.Get64(tx, kv.CallToIndex, addr.Bytes(), from, to)
+	if err != nil {
+		return nil, err
+	}
+	blocks.Or(toBlocks)
+	blocks.RemoveRange(0, from)
+	blocks.RemoveRange(to+1, uint64(0x100000000))
+	return blocks, nil
+}
+
+// searchBlock re-executes the block and appends to the result its transactions with the address in their call
+// traces, with their receipts. The block is in the call indices because of at least one of its transactions, or
+// because the address is the miner of the block or of an uncle
+func (api *OtterscanAPIImpl) searchBlock(ctx context.Context, tx kv.Tx, chainConfig *params.ChainConfig, blockNum uint64, addr common.Address, reverse bool, result *TransactionsWithReceipts) error {
+	block, err := api.blockByNumberWithSenders(tx, blockNum)
+	if err != nil {
+		return err
+	}
+	if block == nil {
+		return fmt.Errorf("block not found %d", blockNum)
+	}
+	if len(block.Transactions()) == 0 {
+		return nil
+	}
+
+	contractHasTEVM := func(contractHash common.Hash) (bool, error) { return false, nil }
+	if api.TevmEnabled {
+		contractHasTEVM = ethdb.GetHasTEVM(tx)
+	}
+	getHeader := func(hash common.Hash, number uint64) *types.Header {
+		h, e := api._blockReader.Header(ctx, tx, hash, number)
+		if e != nil {
+			log.Error("getHeader error", "number", number, "hash", hash, "err", e)
+		}
+		return h
+	}
+	_, blockCtx, _, ibs, reader, err := transactions.ComputeTxEnv(ctx, block, chainConfig, getHeader, contractHasTEVM, ethash.NewFaker(), tx, block.Hash(), 0)
+	if err != nil {
+		return err
+	}
+	signer := types.MakeSigner(chainConfig, blockNum)
+	rules := chainConfig.Rules(blockNum)
+	var found []int
+	for idx, txn := range block.Transactions() {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		ibs.Prepare(txn.Hash(), block.Hash(), idx)
+		msg, err := txn.AsMessage(*signer, block.BaseFee(), rules)
+		if err != nil {
+			return err
+		}
+		tracer := &addressTracer{addr: addr}
+		evm := vm.NewEVM(blockCtx, core.NewEVMTxContext(msg), ibs, chainConfig, vm.Config{Debug: true, Tracer: tracer})
+		if _, err = core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(msg.Gas()), true /* refunds */, false /* gasBailout */); err != nil {
+			return fmt.Errorf("transaction %x failed: %w", txn.Hash(), err)
+		}
+		_ = ibs.FinalizeTx(rules, reader)
+		if tracer.found {
+			found = append(found, idx)
+		}
+	}
+	if len(found) == 0 {
+		return nil
+	}
+
+	receipts, err := api.getReceipts(ctx, tx, chainConfig, block, block.Body().SendersFromTxs())
+	if err != nil {
+		return fmt.Errorf("getReceipts error: %w", err)
+	}
+	for i := range found {
+		idx := found[i]
+		if reverse {
+			idx = found[len(found)-1-i]
+		}
+		txn := block.Transactions()[idx]
+		result.Txs = append(result.Txs, newRPCTransaction(txn, block.Hash(), blockNum, uint64(idx), block.BaseFee()))
+		result.Receipts = append(result.Receipts, marshalReceipt(receipts[idx], txn, chainConfig, block, txn.Hash(), true))
+	}
+	return nil
+}
+
+// addressTracer finds the address in the call traces of a transaction, like calltracer.CallTracer does for the
+// call indices
+type addressTracer struct {
+	addr  common.Address
+	found bool
+}
+
+func (t *addressTracer) CaptureStart(env *vm.EVM, depth int, from common.Address, to common.Address, precompile bool, create bool, calltype vm.CallType, input []byte, gas uint64, value *big.Int, code []byte) {
+	if from == t.addr || to == t.addr {
+		t.found = true
+	}
+}
+func (t *addressTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+}
+func (t *addressTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+func (t *addressTracer) CaptureEnd(depth int, output []byte, startGas, endGas uint64, d time.Duration, err error) {
+}
+func (t *addressTracer) CaptureSelfDestruct(from common.Address, to common.Address, value *big.Int) {
+	if from == t.addr || to == t.addr {
+		t.found = true
+	}
+}
+func (t *addressTracer) CaptureAccountRead(account common.Address) error {
+	return nil
+}
+func (t *addressTracer) CaptureAccountWrite(account common.Address) error {
+	return nil
+}
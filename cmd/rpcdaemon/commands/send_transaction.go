@@ -6,21 +6,31 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
 
 	txPoolProto "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core"
 	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
 	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/crypto"
 	"github.com/ledgerwatch/erigon/eth/ethconfig"
 	"github.com/ledgerwatch/erigon/params"
 	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/log/v3"
 )
 
+// txsPooledTimer measures eth_sendRawTransaction from the call to the reply of the pool
+var txsPooledTimer = metrics.GetOrCreateSummary(`rpc_sendtx_pooled_seconds`)
+
 // SendRawTransaction implements eth_sendRawTransaction. Creates new message call transaction or a contract creation for previously-signed transactions.
 func (api *APIImpl) SendRawTransaction(ctx context.Context, encodedTx hexutil.Bytes) (common.Hash, error) {
+	start := time.Now()
 	txn, err := types.DecodeTransaction(rlp.NewStream(bytes.NewReader(encodedTx), uint64(len(encodedTx))))
 	if err != nil {
 		return common.Hash{}, err
@@ -35,10 +45,25 @@ func (api *APIImpl) SendRawTransaction(ctx context.Context, encodedTx hexutil.By
 		return common.Hash{}, errors.New("only replay-protected (EIP-155) transactions allowed over RPC")
 	}
 	hash := txn.Hash()
+	quotaDone := func(common.Hash, bool) {}
+	if api.txQuota != nil {
+		// The sender is the same whatever the fork, the transaction is replay-protected
+		sender, err := txn.Sender(*types.LatestSignerForChainID(txn.GetChainID().ToBig()))
+		if err != nil {
+			return common.Hash{}, err
+		}
+		if quotaDone, err = api.txQuota.Reserve(ctx, sender); err != nil {
+			return common.Hash{}, err
+		}
+	}
 	res, err := api.txPool.Add(ctx, &txPoolProto.AddRequest{RlpTxs: [][]byte{encodedTx}})
 	if err != nil {
+		quotaDone(hash, false)
 		return common.Hash{}, err
 	}
+	quotaDone(hash, res.Imported[0] == txPoolProto.ImportResult_SUCCESS)
+	txsPooledTimer.UpdateDuration(start)
+	metrics.GetOrCreateCounter(fmt.Sprintf(`rpc_sendtx_submitted{result="%s"}`, res.Imported[0])).Inc()
 
 	if res.Imported[0] != txPoolProto.ImportResult_SUCCESS {
 		return hash, fmt.Errorf("%s: %s", txPoolProto.ImportResult_name[int32(res.Imported[0])], res.Errors[0])
@@ -79,10 +104,73 @@ func (api *APIImpl) SendRawTransaction(ctx context.Context, encodedTx hexutil.By
 	} else {
 		log.Info("Submitted transaction", "hash", txn.Hash().Hex(), "from", from, "nonce", txn.GetNonce(), "recipient", txn.GetTo(), "value", txn.GetValue())
 	}
+	if api.localTxs != nil {
+		// The transaction is in the pool already, failing to journal it only loses the resubmission
+		if err = api.localTxs.Add(txn, from, encodedTx); err != nil {
+			log.Warn("Failed to journal local transaction", "hash", txn.Hash().Hex(), "err", err)
+		}
+	}
 
 	return txn.Hash(), nil
 }
 
+// SendRawTransactionConditional implements eth_sendRawTransactionConditional. The conditions are checked against the
+// latest block and state before the transaction is added to the pool, and again by the miner when building the block.
+// Only the RPC daemon embedded in the node has the miner
+func (api *APIImpl) SendRawTransactionConditional(ctx context.Context, encodedTx hexutil.Bytes, conditions core.TransactionConditions) (common.Hash, error) {
+	if api.txConditions == nil {
+		return common.Hash{}, fmt.Errorf("conditional transactions are checked by the miner, not available in a standalone rpcdaemon")
+	}
+	txn, err := types.DecodeTransaction(rlp.NewStream(bytes.NewReader(encodedTx), uint64(len(encodedTx))))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if err = conditions.Validate(); err != nil {
+		return common.Hash{}, err
+	}
+	sender, err := api.checkTxConditions(ctx, txn, &conditions)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	// Registered before the transaction reaches the pool, so that the miner never sees it without the conditions
+	hash := txn.Hash()
+	if err = api.txConditions.Add(hash, sender, txn.GetNonce(), &conditions); err != nil {
+		return common.Hash{}, err
+	}
+	if _, err = api.SendRawTransaction(ctx, encodedTx); err != nil {
+		api.txConditions.Remove(hash)
+		return common.Hash{}, err
+	}
+	return hash, nil
+}
+
+// checkTxConditions checks the conditions against the latest block and state, and recovers the sender of the transaction
+func (api *APIImpl) checkTxConditions(ctx context.Context, txn types.Transaction, conditions *core.TransactionConditions) (common.Address, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return common.Address{}, err
+	}
+	defer tx.Rollback()
+	header := rawdb.ReadCurrentHeader(tx)
+	if header == nil {
+		return common.Address{}, fmt.Errorf("current header not found")
+	}
+	cc, err := api.chainConfig(tx)
+	if err != nil {
+		return common.Address{}, err
+	}
+	sender, err := txn.Sender(*types.MakeSigner(cc, header.Number.Uint64()))
+	if err != nil {
+		return common.Address{}, err
+	}
+	stateReader, err := api.stateReader(ctx, tx, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber))
+	if err != nil {
+		return common.Address{}, err
+	}
+	return sender, conditions.Check(header, state.New(stateReader))
+}
+
 // SendTransaction implements eth_sendTransaction. Creates new message call transaction or a contract creation if the data field contains code.
 func (api *APIImpl) SendTransaction(_ context.Context, txObject interface{}) (common.Hash, error) {
 	return common.Hash{0}, fmt.Errorf(NotImplemented, "eth_sendTransaction")
@@ -22,9 +22,9 @@ import (
 	"github.com/ledgerwatch/erigon/core/types/accounts"
 	"github.com/ledgerwatch/erigon/core/vm"
 	"github.com/ledgerwatch/erigon/ethdb"
+	"github.com/ledgerwatch/erigon/rlp"
 	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/erigon/turbo/rpchelper"
-	"github.com/ledgerwatch/erigon/turbo/shards"
 	"github.com/ledgerwatch/erigon/turbo/transactions"
 	"github.com/ledgerwatch/log/v3"
 )
@@ -236,6 +236,9 @@ type OeTracer struct {
 	lastOffStack *VmTraceOp
 	vmOpStack    []*VmTraceOp // Stack of vmTrace operations as call depth increases
 	idx          []string     // Prefix for the "idx" inside operations, for easier navigation
+	vmOpsLimit   int          // Maximum number of operations recorded in the vmTrace, 0 - no limit
+	vmOps        int          // Number of operations recorded in the vmTrace so far
+	vmTraceErr   error        // Set when the vmTrace goes over vmOpsLimit, the recording stops then
 }
 
 func (ot *OeTracer) CaptureStart(env *vm.EVM, depth int, from common.Address, to common.Address, precompile bool, create bool, calltype vm.CallType, input []byte, gas uint64, value *big.Int, code []byte) {
@@ -425,7 +428,7 @@ func (ot *OeTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost
 	memory := scope.Memory
 	st := scope.Stack
 
-	if ot.r.VmTrace != nil {
+	if ot.r.VmTrace != nil && ot.vmTraceErr == nil {
 		var vmTrace *VmTrace
 		if len(ot.vmOpStack) > 0 {
 			vmTrace = ot.vmOpStack[len(ot.vmOpStack)-1].Sub
@@ -484,6 +487,11 @@ func (ot *OeTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost
 			// Looks like OE is "optimising away" the second STOP
 			return
 		}
+		if ot.vmOpsLimit > 0 && ot.vmOps >= ot.vmOpsLimit {
+			ot.vmTraceErr = fmt.Errorf("vmTrace exceeds the limit of %d operations", ot.vmOpsLimit)
+			return
+		}
+		ot.vmOps++
 		ot.lastVmOp = &VmTraceOp{Ex: &VmTraceEx{}}
 		vmTrace.Ops = append(vmTrace.Ops, ot.lastVmOp)
 		if !ot.compat {
@@ -664,6 +672,12 @@ func (sd *StateDiff) CompareStates(initialIbs, ibs *state.IntraBlockState) {
 					m["-"] = hexutil.Uint64(initialIbs.GetNonce(addr))
 					accountDiff.Nonce = m
 				}
+				// Transform storage
+				for _, sm := range accountDiff.Storage {
+					str := sm["*"].(*StateDiffStorage)
+					delete(sm, "*")
+					sm["-"] = &str.From
+				}
 			}
 		} else if exist {
 			{
@@ -728,6 +742,9 @@ func (api *TraceAPIImpl) ReplayTransaction(ctx context.Context, txHash common.Ha
 			break
 		}
 	}
+	if cached, ok := api.cachedTraceResult(txHash, block.Hash(), traceTypes); ok {
+		return cached, nil
+	}
 
 	bn := hexutil.Uint64(blockNum)
 
@@ -770,6 +787,7 @@ func (api *TraceAPIImpl) ReplayTransaction(ctx context.Context, txHash common.Ha
 			if traceTypeVmTrace {
 				result.VmTrace = trace.VmTrace
 			}
+			api.cacheTraceResult(txHash, block.Hash(), traceTypes, trace)
 
 			return trace, nil
 		}
@@ -879,7 +897,7 @@ func (api *TraceAPIImpl) Call(ctx context.Context, args TraceCallParam, traceTyp
 		}
 		stateReader = state.NewCachedReader2(cacheView, tx)
 	} else {
-		stateReader = state.NewPlainState(tx, blockNumber+1)
+		stateReader = api.historyStateReader(tx, blockNumber+1)
 	}
 	ibs := state.New(stateReader)
 
@@ -924,6 +942,7 @@ func (api *TraceAPIImpl) Call(ctx context.Context, args TraceCallParam, traceTyp
 	}
 	var ot OeTracer
 	ot.compat = api.compatibility
+	ot.vmOpsLimit = api.maxVmTraceOps
 	if traceTypeTrace || traceTypeVmTrace {
 		ot.r = traceResult
 		ot.traceAddr = []int{}
@@ -967,6 +986,9 @@ func (api *TraceAPIImpl) Call(ctx context.Context, args TraceCallParam, traceTyp
 	if err != nil {
 		return nil, err
 	}
+	if ot.vmTraceErr != nil {
+		return nil, ot.vmTraceErr
+	}
 	traceResult.Output = common.CopyBytes(execResult.ReturnData)
 	if traceTypeStateDiff {
 		sdMap := make(map[common.Address]*StateDiffAccount)
@@ -1095,12 +1117,11 @@ func (api *TraceAPIImpl) doCallMany(ctx context.Context, dbtx kv.Tx, msgs []type
 		}
 		stateReader = state.NewCachedReader2(cacheView, dbtx) // this cache stays between RPC calls
 	} else {
-		stateReader = state.NewPlainState(dbtx, blockNumber+1)
+		stateReader = api.historyStateReader(dbtx, blockNumber+1)
 	}
-	stateCache := shards.NewStateCache(32, 0 /* no limit */) // this cache living only during current RPC call, but required to store state writes
-	cachedReader := state.NewCachedReader(stateReader, stateCache)
+	// The changes of each call are written into the overlay, so that the next call runs on top of them
+	overlay := state.NewOverlayState(stateReader)
 	noop := state.NewNoopWriter()
-	cachedWriter := state.NewCachedWriter(noop, stateCache)
 
 	// TODO: can read here only parent header
 	parentBlock, err := api.blockWithSenders(dbtx, hash, blockNumber)
@@ -1157,9 +1178,10 @@ func (api *TraceAPIImpl) doCallMany(ctx context.Context, dbtx kv.Tx, msgs []type
 			}
 		}
 		vmConfig := vm.Config{}
+		var ot OeTracer
 		if (traceTypeTrace && (txIndexNeeded == -1 || txIndex == txIndexNeeded)) || traceTypeVmTrace {
-			var ot OeTracer
 			ot.compat = api.compatibility
+			ot.vmOpsLimit = api.maxVmTraceOps
 			ot.r = traceResult
 			ot.idx = []string{fmt.Sprintf("%d-", txIndex)}
 			if traceTypeTrace && (txIndexNeeded == -1 || txIndex == txIndexNeeded) {
@@ -1178,19 +1200,12 @@ func (api *TraceAPIImpl) doCallMany(ctx context.Context, dbtx kv.Tx, msgs []type
 			blockCtx.GasLimit = math.MaxUint64
 			blockCtx.MaxGasLimit = true
 		}
-		ibs := state.New(cachedReader)
-		// Create initial IntraBlockState, we will compare it with ibs (IntraBlockState after the transaction)
+		ibs := state.New(overlay)
 
 		evm := vm.NewEVM(blockCtx, txCtx, ibs, chainConfig, vmConfig)
 
 		gp := new(core.GasPool).AddGas(msg.Gas())
 		var execResult *core.ExecutionResult
-		// Clone the state cache before applying the changes, clone is discarded
-		var cloneReader state.StateReader
-		if traceTypeStateDiff {
-			cloneCache := stateCache.Clone()
-			cloneReader = state.NewCachedReader(stateReader, cloneCache)
-		}
 		if args.txHash != nil {
 			ibs.Prepare(*args.txHash, header.Hash(), txIndex)
 		} else {
@@ -1200,9 +1215,13 @@ func (api *TraceAPIImpl) doCallMany(ctx context.Context, dbtx kv.Tx, msgs []type
 		if err != nil {
 			return nil, fmt.Errorf("first run for txIndex %d error: %w", txIndex, err)
 		}
+		if ot.vmTraceErr != nil {
+			return nil, fmt.Errorf("txIndex %d: %w", txIndex, ot.vmTraceErr)
+		}
 		traceResult.Output = common.CopyBytes(execResult.ReturnData)
 		if traceTypeStateDiff {
-			initialIbs := state.New(cloneReader)
+			// The overlay is not written yet, it has the state before the call
+			initialIbs := state.New(overlay)
 			sdMap := make(map[common.Address]*StateDiffAccount)
 			traceResult.StateDiff = sdMap
 			sd := &StateDiff{sdMap: sdMap}
@@ -1210,16 +1229,13 @@ func (api *TraceAPIImpl) doCallMany(ctx context.Context, dbtx kv.Tx, msgs []type
 				return nil, err
 			}
 			sd.CompareStates(initialIbs, ibs)
-			if err = ibs.CommitBlock(evm.ChainRules(), cachedWriter); err != nil {
-				return nil, err
-			}
 		} else {
 			if err = ibs.FinalizeTx(evm.ChainRules(), noop); err != nil {
 				return nil, err
 			}
-			if err = ibs.CommitBlock(evm.ChainRules(), cachedWriter); err != nil {
-				return nil, err
-			}
+		}
+		if err = ibs.CommitBlock(evm.ChainRules(), overlay); err != nil {
+			return nil, err
 		}
 		if !traceTypeTrace {
 			traceResult.Trace = []*ParityTrace{}
@@ -1229,8 +1245,45 @@ func (api *TraceAPIImpl) doCallMany(ctx context.Context, dbtx kv.Tx, msgs []type
 	return results, nil
 }
 
-// RawTransaction implements trace_rawTransaction.
-func (api *TraceAPIImpl) RawTransaction(ctx context.Context, txHash common.Hash, traceTypes []string) ([]interface{}, error) {
-	var stub []interface{}
-	return stub, fmt.Errorf(NotImplemented, "trace_rawTransaction")
+// RawTransaction implements trace_rawTransaction. Traces the signed transaction on top of the latest block, like
+// OpenEthereum the nonce and the balance of the sender are checked
+func (api *TraceAPIImpl) RawTransaction(ctx context.Context, encodedTx hexutil.Bytes, traceTypes []string) (*TraceCallResult, error) {
+	txn, err := types.DecodeTransaction(rlp.NewStream(bytes.NewReader(encodedTx), uint64(len(encodedTx))))
+	if err != nil {
+		return nil, err
+	}
+
+	dbtx, err := api.kv.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer dbtx.Rollback()
+
+	chainConfig, err := api.chainConfig(dbtx)
+	if err != nil {
+		return nil, err
+	}
+	latest := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+	blockNumber, _, _, err := rpchelper.GetBlockNumber(latest, dbtx, api.filters)
+	if err != nil {
+		return nil, err
+	}
+	header, err := api.headerByRPCNumber(rpc.BlockNumber(blockNumber), dbtx)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("header %d not found", blockNumber)
+	}
+	msg, err := txn.AsMessage(*types.MakeSigner(chainConfig, blockNumber+1), header.BaseFee, chainConfig.Rules(blockNumber+1))
+	if err != nil {
+		return nil, fmt.Errorf("convert tx into msg: %w", err)
+	}
+	txHash := txn.Hash()
+	callParams := []TraceCallParam{{txHash: &txHash, traceTypes: traceTypes}}
+	traces, err := api.doCallMany(ctx, dbtx, []types.Message{msg}, callParams, &latest, nil, false /* gasBailout */, -1 /* all tx indices */)
+	if err != nil {
+		return nil, err
+	}
+	return traces[0], nil
 }
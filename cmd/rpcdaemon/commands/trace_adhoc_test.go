@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/holiman/uint256"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/cli/httpcfg"
@@ -12,6 +13,11 @@ import (
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/common/hexutil"
 	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rlp"
 	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
 	"github.com/stretchr/testify/require"
@@ -106,3 +112,55 @@ func TestReplayBlockTransactions(t *testing.T) {
 	v := addrDiff.Balance.(map[string]*hexutil.Big)["+"].ToInt().Uint64()
 	require.Equal(t, uint64(1_000_000_000_000_000), v)
 }
+
+func TestReplayBlockTransactionsVmTraceLimit(t *testing.T) {
+	db := rpcdaemontest.CreateTestKV(t)
+	stateCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	base := NewBaseApi(nil, stateCache, snapshotsync.NewBlockReader(), nil, nil, false)
+
+	// Block 4 mints tokens
+	n := rpc.BlockNumber(4)
+	results, err := NewTraceAPI(base, db, &httpcfg.HttpCfg{}).ReplayBlockTransactions(context.Background(), rpc.BlockNumberOrHash{BlockNumber: &n}, []string{"vmTrace"})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.NotNil(t, results[0].VmTrace)
+	require.Greater(t, len(results[0].VmTrace.Ops), 10)
+
+	_, err = NewTraceAPI(base, db, &httpcfg.HttpCfg{MaxVmTraceOps: 10}).ReplayBlockTransactions(context.Background(), rpc.BlockNumberOrHash{BlockNumber: &n}, []string{"vmTrace"})
+	require.Error(t, err)
+}
+
+func TestRawTransaction(t *testing.T) {
+	db := rpcdaemontest.CreateTestKV(t)
+	stateCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	api := NewTraceAPI(NewBaseApi(nil, stateCache, snapshotsync.NewBlockReader(), nil, nil, false), db, &httpcfg.HttpCfg{})
+
+	key, _ := crypto.HexToECDSA("49a7b37aa6f6645917e7b807e9d1c00d4fa71f18343b0d4122a4d2df64dd6fee")
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	var nonce uint64
+	require.NoError(t, db.View(context.Background(), func(tx kv.Tx) error {
+		acc, err := state.NewPlainStateReader(tx).ReadAccountData(from)
+		if acc != nil {
+			nonce = acc.Nonce
+		}
+		return err
+	}))
+	signer := types.LatestSignerForChainID(params.AllEthashProtocolChanges.ChainID)
+	to := common.Address{0xaa}
+	encode := func(nonce uint64) hexutil.Bytes {
+		txn, err := types.SignTx(types.NewTransaction(nonce, to, uint256.NewInt(1), 21000, uint256.NewInt(20_000_000_000), nil), *signer, key)
+		require.NoError(t, err)
+		encoded, err := rlp.EncodeToBytes(txn)
+		require.NoError(t, err)
+		return encoded
+	}
+
+	result, err := api.RawTransaction(context.Background(), encode(nonce), []string{TraceTypeTrace, TraceTypeStateDiff})
+	require.NoError(t, err)
+	require.Len(t, result.Trace, 1)
+	require.Contains(t, result.StateDiff, to)
+
+	// Unlike trace_call, the nonce is checked
+	_, err = api.RawTransaction(context.Background(), encode(nonce+1), []string{TraceTypeTrace})
+	require.Error(t, err)
+}
@@ -19,13 +19,15 @@ type TraceAPI interface {
 	ReplayTransaction(ctx context.Context, txHash common.Hash, traceTypes []string) (*TraceCallResult, error)
 	Call(ctx context.Context, call TraceCallParam, types []string, blockNr *rpc.BlockNumberOrHash) (*TraceCallResult, error)
 	CallMany(ctx context.Context, calls json.RawMessage, blockNr *rpc.BlockNumberOrHash) ([]*TraceCallResult, error)
-	RawTransaction(ctx context.Context, txHash common.Hash, traceTypes []string) ([]interface{}, error)
+	RawTransaction(ctx context.Context, encodedTx hexutil.Bytes, traceTypes []string) (*TraceCallResult, error)
 
 	// Filtering (see ./trace_filtering.go)
 	Transaction(ctx context.Context, txHash common.Hash) (ParityTraces, error)
 	Get(ctx context.Context, txHash common.Hash, txIndicies []hexutil.Uint64) (*ParityTrace, error)
 	Block(ctx context.Context, blockNr rpc.BlockNumber) (ParityTraces, error)
 	Filter(ctx context.Context, req TraceFilterRequest, stream *jsoniter.Stream) error
+	FilterPage(ctx context.Context, req TraceFilterRequest, stream *jsoniter.Stream) error
+	FilterStream(ctx context.Context, req TraceFilterRequest) (*rpc.Subscription, error)
 }
 
 // TraceAPIImpl is implementation of the TraceAPI interface based on remote Db access
@@ -33,6 +35,7 @@ type TraceAPIImpl struct {
 	*BaseAPI
 	kv            kv.RoDB
 	maxTraces     uint64
+	maxVmTraceOps int
 	gasCap        uint64
 	compatibility bool // Bug for bug compatiblity with OpenEthereum
 }
@@ -43,6 +46,7 @@ func NewTraceAPI(base *BaseAPI, kv kv.RoDB, cfg *httpcfg.HttpCfg) *TraceAPIImpl
 		BaseAPI:       base,
 		kv:            kv,
 		maxTraces:     cfg.MaxTraces,
+		maxVmTraceOps: int(cfg.MaxVmTraceOps),
 		gasCap:        cfg.Gascap,
 		compatibility: cfg.TraceCompatibility,
 	}
@@ -2,6 +2,7 @@ package commands
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/ledgerwatch/erigon-lib/kv"
 
 	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/debug"
 	"github.com/ledgerwatch/erigon/common/hexutil"
 	"github.com/ledgerwatch/erigon/consensus/ethash"
 	"github.com/ledgerwatch/erigon/core/rawdb"
@@ -19,6 +21,7 @@ import (
 	"github.com/ledgerwatch/erigon/params"
 	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/erigon/turbo/rpchelper"
+	"github.com/ledgerwatch/log/v3"
 )
 
 // Transaction implements trace_transaction
@@ -215,7 +218,220 @@ func (api *TraceAPIImpl) Filter(ctx context.Context, req TraceFilterRequest, str
 		return fmt.Errorf("traceFilter cannot open tx: %w", err1)
 	}
 	defer dbtx.Rollback()
+	filter, err := api.newTraceFilter(dbtx, req)
+	if err != nil {
+		return err
+	}
+
+	stream.WriteArrayStart()
+	first := true
+	count := uint64(^uint(0)) // this just makes it easier to use below
+	if req.Count != nil {
+		count = *req.Count
+	}
+	after := uint64(0) // this just makes it easier to use below
+	if req.After != nil {
+		after = *req.After
+	}
+	nSeen := uint64(0)
+	nExported := uint64(0)
+	if err = api.filterTraces(ctx, dbtx, filter, func(trace []byte, err error, _ TraceFilterCursor) (bool, error) {
+		if err == nil {
+			if nExported >= count {
+				return false, nil
+			}
+			nSeen++
+			if nSeen <= after {
+				return true, nil
+			}
+		}
+		if first {
+			first = false
+		} else {
+			stream.WriteMore()
+		}
+		if err != nil {
+			stream.WriteObjectStart()
+			rpc.HandleError(err, stream)
+			stream.WriteObjectEnd()
+			return true, nil
+		}
+		stream.Write(trace)
+		nExported++
+		return nExported < count, nil
+	}); err != nil {
+		return err
+	}
+	stream.WriteArrayEnd()
+	return stream.Flush()
+}
+
+// FilterPage implements trace_filterPage. Returns a page of the traces of trace_filter, of at most count traces
+// (--trace.maxtraces by default and at most), with the cursor of the next page: {"traces": [...], "cursor": "..."}.
+// The next page is requested with the same filter and the cursor, without re-executing the blocks of the previous
+// pages. The cursor is null after the last page
+func (api *TraceAPIImpl) FilterPage(ctx context.Context, req TraceFilterRequest, stream *jsoniter.Stream) error {
+	dbtx, err := api.kv.BeginRo(ctx)
+	if err != nil {
+		return fmt.Errorf("traceFilter cannot open tx: %w", err)
+	}
+	defer dbtx.Rollback()
+	if req.After != nil {
+		return fmt.Errorf("invalid parameters: after is not supported by pages, use cursor")
+	}
+	count := api.maxTraces
+	if req.Count != nil {
+		if *req.Count == 0 {
+			return fmt.Errorf("invalid parameters: count must be positive")
+		}
+		if count == 0 || *req.Count < count {
+			count = *req.Count
+		}
+	}
+	filter, err := api.newTraceFilter(dbtx, req)
+	if err != nil {
+		return err
+	}
+
+	stream.WriteObjectStart()
+	stream.WriteObjectField("traces")
+	stream.WriteArrayStart()
+	var (
+		nExported  uint64
+		last, next *TraceFilterCursor
+	)
+	if err = api.filterTraces(ctx, dbtx, filter, func(trace []byte, err error, cursor TraceFilterCursor) (bool, error) {
+		if count > 0 && nExported == count {
+			// there is one more trace, so the cursor of the last page is null
+			next = last
+			return false, nil
+		}
+		last = &cursor
+		if nExported > 0 {
+			stream.WriteMore()
+		}
+		if err != nil {
+			stream.WriteObjectStart()
+			rpc.HandleError(err, stream)
+			stream.WriteObjectEnd()
+		} else {
+			stream.Write(trace)
+		}
+		nExported++
+		return true, nil
+	}); err != nil {
+		return err
+	}
+	stream.WriteArrayEnd()
+	stream.WriteMore()
+	stream.WriteObjectField("cursor")
+	if next == nil {
+		stream.WriteNil()
+	} else {
+		stream.WriteString(next.String())
+	}
+	stream.WriteObjectEnd()
+	return stream.Flush()
+}
+
+// TraceFilterNotification is a notification of the filterStream subscription. The cursor resumes the subscription
+// after the trace (or the error of a block), done is set in the last notification, without a trace
+type TraceFilterNotification struct {
+	Trace  json.RawMessage `json:"trace,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	Cursor string          `json:"cursor,omitempty"`
+	Done   bool            `json:"done,omitempty"`
+}
+
+// FilterStream implements trace_subscribe("filterStream", filter). Sends the traces of trace_filter one by one as
+// TraceFilterNotification, so they are consumed as they are produced, over websocket. After and count are not
+// supported: a disconnected client resumes by subscribing with the cursor of the last notification it got
+func (api *TraceAPIImpl) FilterStream(ctx context.Context, req TraceFilterRequest) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	if req.After != nil || req.Count != nil {
+		return &rpc.Subscription{}, fmt.Errorf("invalid parameters: after and count are not supported by subscriptions, use cursor")
+	}
+	dbtx, err := api.kv.BeginRo(ctx)
+	if err != nil {
+		return &rpc.Subscription{}, fmt.Errorf("traceFilter cannot open tx: %w", err)
+	}
+	filter, err := api.newTraceFilter(dbtx, req)
+	dbtx.Rollback()
+	if err != nil {
+		return &rpc.Subscription{}, err
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		defer debug.LogPanic()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-rpcSub.Err():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		dbtx, err := api.kv.BeginRo(ctx)
+		if err != nil {
+			log.Warn("traceFilter cannot open tx", "err", err)
+			return
+		}
+		defer dbtx.Rollback()
 
+		err = api.filterTraces(ctx, dbtx, filter, func(trace []byte, err error, cursor TraceFilterCursor) (bool, error) {
+			notification := &TraceFilterNotification{Trace: trace, Cursor: cursor.String()}
+			if err != nil {
+				notification.Error = err.Error()
+			}
+			return true, notifier.Notify(rpcSub.ID, notification)
+		})
+		if err == nil {
+			err = notifier.Notify(rpcSub.ID, &TraceFilterNotification{Done: true})
+		}
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Warn("error while notifying subscription", "err", err)
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// TraceFilterCursor is the position in the results of trace_filter after the Index first traces (and errors) of
+// the Block. Encoded as "block.index"
+type TraceFilterCursor struct {
+	Block uint64
+	Index uint64
+}
+
+func (c TraceFilterCursor) String() string {
+	return fmt.Sprintf("%d.%d", c.Block, c.Index)
+}
+
+func (c TraceFilterCursor) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c *TraceFilterCursor) UnmarshalText(input []byte) error {
+	if _, err := fmt.Sscanf(string(input), "%d.%d", &c.Block, &c.Index); err != nil {
+		return fmt.Errorf("invalid trace filter cursor %q", input)
+	}
+	return nil
+}
+
+// traceFilter is the blocks matching a TraceFilterRequest, found by the call trace indices, from its cursor if any
+type traceFilter struct {
+	blocks        roaring64.Bitmap
+	fromAddresses map[common.Address]struct{}
+	toAddresses   map[common.Address]struct{}
+	cursor        *TraceFilterCursor
+}
+
+func (api *TraceAPIImpl) newTraceFilter(dbtx kv.Tx, req TraceFilterRequest) (*traceFilter, error) {
 	var fromBlock uint64
 	var toBlock uint64
 	if req.FromBlock == nil {
@@ -232,7 +448,13 @@ func (api *TraceAPIImpl) Filter(ctx context.Context, req TraceFilterRequest, str
 	}
 
 	if fromBlock > toBlock {
-		return fmt.Errorf("invalid parameters: fromBlock cannot be greater than toBlock")
+		return nil, fmt.Errorf("invalid parameters: fromBlock cannot be greater than toBlock")
+	}
+	if req.Cursor != nil {
+		if req.Cursor.Block < fromBlock || req.Cursor.Block > toBlock {
+			return nil, fmt.Errorf("invalid parameters: cursor out of the range of blocks")
+		}
+		fromBlock = req.Cursor.Block
 	}
 
 	fromAddresses := make(map[common.Address]struct{}, len(req.FromAddress))
@@ -250,7 +472,7 @@ func (api *TraceAPIImpl) Filter(ctx context.Context, req TraceFilterRequest, str
 				if errors.Is(err, ethdb.ErrKeyNotFound) {
 					continue
 				}
-				return err
+				return nil, err
 			}
 			allBlocks.Or(b)
 			fromAddresses[*addr] = struct{}{}
@@ -265,7 +487,7 @@ func (api *TraceAPIImpl) Filter(ctx context.Context, req TraceFilterRequest, str
 					continue
 				}
 
-				return err
+				return nil, err
 			}
 			blocksTo.Or(b)
 			toAddresses[*addr] = struct{}{}
@@ -288,66 +510,60 @@ func (api *TraceAPIImpl) Filter(ctx context.Context, req TraceFilterRequest, str
 		allBlocks.RemoveRange(0, fromBlock)
 		allBlocks.RemoveRange(toBlock+1, uint64(0x100000000))
 	}
+	return &traceFilter{blocks: allBlocks, fromAddresses: fromAddresses, toAddresses: toAddresses, cursor: req.Cursor}, nil
+}
 
+// filterTraces executes the blocks of the filter and passes the matching traces, marshalled, to emit in order, with
+// the cursor after each. The errors of reading and executing blocks are passed to emit too, instead of traces, and
+// don't stop the filtering. Stops once emit returns false or an error
+func (api *TraceAPIImpl) filterTraces(ctx context.Context, dbtx kv.Tx, filter *traceFilter, emit func(trace []byte, err error, cursor TraceFilterCursor) (bool, error)) error {
+	fromAddresses, toAddresses := filter.fromAddresses, filter.toAddresses
 	chainConfig, err := api.chainConfig(dbtx)
 	if err != nil {
 		return err
 	}
 
 	var json = jsoniter.ConfigCompatibleWithStandardLibrary
-	stream.WriteArrayStart()
-	first := true
 	// Execute all transactions in picked blocks
-
-	count := uint64(^uint(0)) // this just makes it easier to use below
-	if req.Count != nil {
-		count = *req.Count
-	}
-	after := uint64(0) // this just makes it easier to use below
-	if req.After != nil {
-		after = *req.After
-	}
-	nSeen := uint64(0)
-	nExported := uint64(0)
-
-	it := allBlocks.Iterator()
+	it := filter.blocks.Iterator()
 	for it.HasNext() {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
 		b := it.Next()
+		cursor := TraceFilterCursor{Block: b}
+		var skip uint64 // the traces of the block before the cursor
+		if filter.cursor != nil && filter.cursor.Block == b {
+			skip = filter.cursor.Index
+		}
+		// emitNext passes the trace or the error to emit, unless it is before the cursor
+		emitNext := func(trace []byte, err error) (bool, error) {
+			cursor.Index++
+			if cursor.Index <= skip {
+				return true, nil
+			}
+			return emit(trace, err, cursor)
+		}
 		// Extract transactions from block
 		hash, hashErr := rawdb.ReadCanonicalHash(dbtx, b)
 		if hashErr != nil {
-			if first {
-				first = false
-			} else {
-				stream.WriteMore()
+			if more, err := emitNext(nil, hashErr); err != nil || !more {
+				return err
 			}
-			stream.WriteObjectStart()
-			rpc.HandleError(hashErr, stream)
-			stream.WriteObjectEnd()
 			continue
 		}
 
 		block, bErr := api.blockWithSenders(dbtx, hash, b)
 		if bErr != nil {
-			if first {
-				first = false
-			} else {
-				stream.WriteMore()
+			if more, err := emitNext(nil, bErr); err != nil || !more {
+				return err
 			}
-			stream.WriteObjectStart()
-			rpc.HandleError(bErr, stream)
-			stream.WriteObjectEnd()
 			continue
 		}
 		if block == nil {
-			if first {
-				first = false
-			} else {
-				stream.WriteMore()
+			if more, err := emitNext(nil, fmt.Errorf("could not find block %x %d", hash, b)); err != nil || !more {
+				return err
 			}
-			stream.WriteObjectStart()
-			rpc.HandleError(fmt.Errorf("could not find block %x %d", hash, b), stream)
-			stream.WriteObjectEnd()
 			continue
 		}
 
@@ -356,14 +572,9 @@ func (api *TraceAPIImpl) Filter(ctx context.Context, req TraceFilterRequest, str
 		txs := block.Transactions()
 		t, tErr := api.callManyTransactions(ctx, dbtx, txs, []string{TraceTypeTrace}, block.ParentHash(), rpc.BlockNumber(block.NumberU64()-1), block.Header(), -1 /* all tx indices */, types.MakeSigner(chainConfig, b), chainConfig.Rules(b))
 		if tErr != nil {
-			if first {
-				first = false
-			} else {
-				stream.WriteMore()
+			if more, err := emitNext(nil, tErr); err != nil || !more {
+				return err
 			}
-			stream.WriteObjectStart()
-			rpc.HandleError(tErr, stream)
-			stream.WriteObjectEnd()
 			continue
 		}
 		includeAll := len(fromAddresses) == 0 && len(toAddresses) == 0
@@ -373,38 +584,18 @@ func (api *TraceAPIImpl) Filter(ctx context.Context, req TraceFilterRequest, str
 			// Check if transaction concerns any of the addresses we wanted
 			for _, pt := range trace.Trace {
 				if includeAll || filter_trace(pt, fromAddresses, toAddresses) {
-					nSeen++
 					pt.BlockHash = &blockHash
 					pt.BlockNumber = &blockNumber
 					pt.TransactionHash = &txHash
 					pt.TransactionPosition = &txPosition
-					b, err := json.Marshal(pt)
-					if err != nil {
-						if first {
-							first = false
-						} else {
-							stream.WriteMore()
-						}
-						stream.WriteObjectStart()
-						rpc.HandleError(err, stream)
-						stream.WriteObjectEnd()
-						continue
-					}
-					if nSeen > after && nExported < count {
-						if first {
-							first = false
-						} else {
-							stream.WriteMore()
-						}
-						stream.Write(b)
-						nExported++
+					if more, err := emitNext(json.Marshal(pt)); err != nil || !more {
+						return err
 					}
 				}
 			}
 		}
 		minerReward, uncleRewards := ethash.AccumulateRewards(chainConfig, block.Header(), block.Uncles())
 		if _, ok := toAddresses[block.Coinbase()]; ok || includeAll {
-			nSeen++
 			var tr ParityTrace
 			var rewardAction = &RewardTraceAction{}
 			rewardAction.Author = block.Coinbase()
@@ -417,32 +608,13 @@ func (api *TraceAPIImpl) Filter(ctx context.Context, req TraceFilterRequest, str
 			*tr.BlockNumber = block.NumberU64()
 			tr.Type = "reward" // nolint: goconst
 			tr.TraceAddress = []int{}
-			b, err := json.Marshal(tr)
-			if err != nil {
-				if first {
-					first = false
-				} else {
-					stream.WriteMore()
-				}
-				stream.WriteObjectStart()
-				rpc.HandleError(err, stream)
-				stream.WriteObjectEnd()
-				continue
-			}
-			if nSeen > after && nExported < count {
-				if first {
-					first = false
-				} else {
-					stream.WriteMore()
-				}
-				stream.Write(b)
-				nExported++
+			if more, err := emitNext(json.Marshal(tr)); err != nil || !more {
+				return err
 			}
 		}
 		for i, uncle := range block.Uncles() {
 			if _, ok := toAddresses[uncle.Coinbase]; ok || includeAll {
 				if i < len(uncleRewards) {
-					nSeen++
 					var tr ParityTrace
 					rewardAction := &RewardTraceAction{}
 					rewardAction.Author = uncle.Coinbase
@@ -455,33 +627,14 @@ func (api *TraceAPIImpl) Filter(ctx context.Context, req TraceFilterRequest, str
 					*tr.BlockNumber = block.NumberU64()
 					tr.Type = "reward" // nolint: goconst
 					tr.TraceAddress = []int{}
-					b, err := json.Marshal(tr)
-					if err != nil {
-						if first {
-							first = false
-						} else {
-							stream.WriteMore()
-						}
-						stream.WriteObjectStart()
-						rpc.HandleError(err, stream)
-						stream.WriteObjectEnd()
-						continue
-					}
-					if nSeen > after && nExported < count {
-						if first {
-							first = false
-						} else {
-							stream.WriteMore()
-						}
-						stream.Write(b)
-						nExported++
+					if more, err := emitNext(json.Marshal(tr)); err != nil || !more {
+						return err
 					}
 				}
 			}
 		}
 	}
-	stream.WriteArrayEnd()
-	return stream.Flush()
+	return nil
 }
 
 func filter_trace(pt *ParityTrace, fromAddresses map[common.Address]struct{}, toAddresses map[common.Address]struct{}) bool {
@@ -546,13 +699,14 @@ func (api *TraceAPIImpl) callManyTransactions(ctx context.Context, dbtx kv.Tx, t
 
 // TraceFilterRequest represents the arguments for trace_filter
 type TraceFilterRequest struct {
-	FromBlock   *hexutil.Uint64   `json:"fromBlock"`
-	ToBlock     *hexutil.Uint64   `json:"toBlock"`
-	FromAddress []*common.Address `json:"fromAddress"`
-	ToAddress   []*common.Address `json:"toAddress"`
-	Mode        TraceFilterMode   `json:"mode"`
-	After       *uint64           `json:"after"`
-	Count       *uint64           `json:"count"`
+	FromBlock   *hexutil.Uint64    `json:"fromBlock"`
+	ToBlock     *hexutil.Uint64    `json:"toBlock"`
+	FromAddress []*common.Address  `json:"fromAddress"`
+	ToAddress   []*common.Address  `json:"toAddress"`
+	Mode        TraceFilterMode    `json:"mode"`
+	After       *uint64            `json:"after"`
+	Count       *uint64            `json:"count"`
+	Cursor      *TraceFilterCursor `json:"cursor"` // resumes after the position, see FilterPage
 }
 
 type TraceFilterMode string
@@ -1,13 +1,16 @@
 package commands
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"math/big"
+	"sync"
 	"time"
 
 	"github.com/holiman/uint256"
 	jsoniter "github.com/json-iterator/go"
+	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/common/hexutil"
 	"github.com/ledgerwatch/erigon/common/math"
@@ -20,6 +23,7 @@ import (
 	"github.com/ledgerwatch/erigon/eth/tracers"
 	"github.com/ledgerwatch/erigon/ethdb"
 	"github.com/ledgerwatch/erigon/internal/ethapi"
+	"github.com/ledgerwatch/erigon/params"
 	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/erigon/turbo/rpchelper"
 	"github.com/ledgerwatch/erigon/turbo/transactions"
@@ -89,12 +93,17 @@ func (api *PrivateDebugAPIImpl) traceBlock(ctx context.Context, blockNrOrHash rp
 		return h
 	}
 
-	_, blockCtx, _, ibs, reader, err := transactions.ComputeTxEnv(ctx, block, chainConfig, getHeader, contractHasTEVM, ethash.NewFaker(), tx, block.Hash(), 0)
-	if err != nil {
-		stream.WriteNil()
-		return err
+	// The transaction of a pinned view is used by one request at a time, so its transactions are traced sequentially
+	if _, pinned := rpc.ViewFromContext(ctx); api.TraceBlockParallel > 1 && len(block.Transactions()) > 1 && !pinned {
+		return api.traceBlockParallel(ctx, tx, block, chainConfig, config, stream)
 	}
 
+	header := block.Header()
+	blockCtx := core.NewEVMBlockContext(header, core.GetHashFn(header, getHeader), ethash.NewFaker(), nil, contractHasTEVM)
+	// The state at the beginning of the block, from the history files with history v2
+	ibs := state.New(api.historyStateReader(tx, block.NumberU64()))
+	noopWriter := state.NewNoopWriter()
+
 	signer := types.MakeSigner(chainConfig, block.NumberU64())
 	rules := chainConfig.Rules(block.NumberU64())
 	stream.WriteArrayStart()
@@ -113,8 +122,8 @@ func (api *PrivateDebugAPIImpl) traceBlock(ctx context.Context, blockNrOrHash rp
 			GasPrice: msg.GasPrice().ToBig(),
 		}
 
-		transactions.TraceTx(ctx, msg, blockCtx, txCtx, ibs, config, chainConfig, stream)
-		_ = ibs.FinalizeTx(rules, reader)
+		transactions.TraceTx(ctx, msg, blockCtx, txCtx, ibs, api.traceConfig(config), chainConfig, stream)
+		_ = ibs.FinalizeTx(rules, noopWriter)
 		if idx != len(block.Transactions())-1 {
 			stream.WriteMore()
 		}
@@ -125,6 +134,146 @@ func (api *PrivateDebugAPIImpl) traceBlock(ctx context.Context, blockNrOrHash rp
 	return nil
 }
 
+// traceBlockParallel executes the transactions of the block once without tracing, keeping the changes of each of
+// them in its own layer of state.OverlayState, then traces up to TraceBlockParallel transactions at once, each over
+// the layers of the transactions before it and in its own read transaction, so the traces are the same as of the
+// sequential tracing. The traces are written in the order of the transactions, as soon as they are done
+func (api *PrivateDebugAPIImpl) traceBlockParallel(ctx context.Context, tx kv.Tx, block *types.Block, chainConfig *params.ChainConfig, config *tracers.TraceConfig, stream *jsoniter.Stream) error {
+	header, txs := block.Header(), block.Transactions()
+	blockContext := func(tx kv.Tx) vm.BlockContext {
+		contractHasTEVM := func(contractHash common.Hash) (bool, error) { return false, nil }
+		if api.TevmEnabled {
+			contractHasTEVM = ethdb.GetHasTEVM(tx)
+		}
+		getHeader := func(hash common.Hash, number uint64) *types.Header {
+			h, e := api._blockReader.Header(ctx, tx, hash, number)
+			if e != nil {
+				log.Error("getHeader error", "number", number, "hash", hash, "err", e)
+			}
+			return h
+		}
+		return core.NewEVMBlockContext(header, core.GetHashFn(header, getHeader), ethash.NewFaker(), nil, contractHasTEVM)
+	}
+	refunds := config == nil || config.NoRefunds == nil || !*config.NoRefunds
+
+	// preStates[i] is the state before the transaction i
+	signer := types.MakeSigner(chainConfig, block.NumberU64())
+	rules := chainConfig.Rules(block.NumberU64())
+	msgs := make([]core.Message, len(txs))
+	preStates := make([]*state.OverlayState, len(txs))
+	preStates[0] = state.NewOverlayState(api.historyStateReader(tx, block.NumberU64()))
+	ibs := state.New(preStates[0])
+	vmenv := vm.NewEVM(blockContext(tx), vm.TxContext{}, ibs, chainConfig, vm.Config{})
+	for idx, txn := range txs {
+		if err := ctx.Err(); err != nil {
+			stream.WriteNil()
+			return err
+		}
+		msgs[idx], _ = txn.AsMessage(*signer, block.BaseFee(), rules)
+		if idx == len(txs)-1 {
+			break
+		}
+		ibs.Prepare(txn.Hash(), block.Hash(), idx)
+		vmenv.Reset(core.NewEVMTxContext(msgs[idx]), ibs)
+		if _, err := core.ApplyMessage(vmenv, msgs[idx], new(core.GasPool).AddGas(txn.GetGas()), refunds, false /* gasBailout */); err != nil {
+			stream.WriteNil()
+			return fmt.Errorf("transaction %x failed: %w", txn.Hash(), err)
+		}
+		preStates[idx+1] = preStates[idx].Fork()
+		if err := ibs.FinalizeTx(rules, preStates[idx+1]); err != nil {
+			stream.WriteNil()
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+	traces := make([]bytes.Buffer, len(txs))
+	errs := make([]error, len(txs))
+	done := make([]chan struct{}, len(txs))
+	for idx := range done {
+		done[idx] = make(chan struct{})
+	}
+	// the traces done but not written yet are kept in memory, so the workers get ahead of the writing by window at most
+	window := make(chan struct{}, 2*api.TraceBlockParallel)
+	next := make(chan int)
+	go func() {
+		defer close(next)
+		for idx := range txs {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case next <- idx:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for i := 0; i < api.TraceBlockParallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dbtx, err := api.db.BeginRo(ctx)
+			if err == nil {
+				defer dbtx.Rollback()
+			}
+			var blockCtx vm.BlockContext
+			var base state.StateReader
+			if err == nil {
+				blockCtx, base = blockContext(dbtx), api.historyStateReader(dbtx, block.NumberU64())
+			}
+			for idx := range next {
+				if err != nil {
+					errs[idx] = err
+					close(done[idx])
+					continue
+				}
+				txn := txs[idx]
+				ibs := state.New(preStates[idx].Over(base))
+				ibs.Prepare(txn.Hash(), block.Hash(), idx)
+				txCtx := vm.TxContext{
+					TxHash:   txn.Hash(),
+					Origin:   msgs[idx].From(),
+					GasPrice: msgs[idx].GasPrice().ToBig(),
+				}
+				traceStream := jsoniter.NewStream(jsoniter.ConfigDefault, &traces[idx], 4096)
+				transactions.TraceTx(ctx, msgs[idx], blockCtx, txCtx, ibs, api.traceConfig(config), chainConfig, traceStream)
+				errs[idx] = traceStream.Flush()
+				close(done[idx])
+			}
+		}()
+	}
+
+	stream.WriteArrayStart()
+	for idx := range txs {
+		select {
+		case <-done[idx]:
+		case <-ctx.Done():
+			stream.WriteNil()
+			return ctx.Err()
+		}
+		if errs[idx] != nil {
+			stream.WriteNil()
+			return errs[idx]
+		}
+		stream.Write(traces[idx].Bytes())
+		traces[idx] = bytes.Buffer{}
+		<-window
+		if idx != len(txs)-1 {
+			stream.WriteMore()
+		}
+		stream.Flush()
+	}
+	stream.WriteArrayEnd()
+	stream.Flush()
+	return nil
+}
+
 // TraceTransaction implements debug_traceTransaction. Returns Geth style transaction traces.
 func (api *PrivateDebugAPIImpl) TraceTransaction(ctx context.Context, hash common.Hash, config *tracers.TraceConfig, stream *jsoniter.Stream) error {
 	tx, err := api.db.BeginRo(ctx)
@@ -184,19 +333,24 @@ func (api *PrivateDebugAPIImpl) TraceTransaction(ctx context.Context, hash commo
 	}
 
 	getHeader := func(hash common.Hash, number uint64) *types.Header {
-		return rawdb.ReadHeader(tx, hash, number)
+		h, e := api._blockReader.Header(ctx, tx, hash, number)
+		if e != nil {
+			log.Error("getHeader error", "number", number, "hash", hash, "err", e)
+		}
+		return h
 	}
 	contractHasTEVM := func(contractHash common.Hash) (bool, error) { return false, nil }
 	if api.TevmEnabled {
 		contractHasTEVM = ethdb.GetHasTEVM(tx)
 	}
-	msg, blockCtx, txCtx, ibs, _, err := transactions.ComputeTxEnv(ctx, block, chainConfig, getHeader, contractHasTEVM, ethash.NewFaker(), tx, blockHash, txnIndex)
+	reader := api.historyStateReader(tx, block.NumberU64())
+	msg, blockCtx, txCtx, ibs, err := transactions.ComputeTxEnvWithState(ctx, block, chainConfig, getHeader, contractHasTEVM, ethash.NewFaker(), reader, state.NewNoopWriter(), blockHash, txnIndex)
 	if err != nil {
 		stream.WriteNil()
 		return err
 	}
 	// Trace the transaction and return
-	return transactions.TraceTx(ctx, msg, blockCtx, txCtx, ibs, config, chainConfig, stream)
+	return transactions.TraceTx(ctx, msg, blockCtx, txCtx, ibs, api.traceConfig(config), chainConfig, stream)
 }
 
 func (api *PrivateDebugAPIImpl) TraceCall(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash, config *tracers.TraceConfig, stream *jsoniter.Stream) error {
@@ -226,9 +380,13 @@ func (api *PrivateDebugAPIImpl) TraceCall(ctx context.Context, args ethapi.CallA
 		}
 		stateReader = state.NewCachedReader2(cacheView, dbtx)
 	} else {
-		stateReader = state.NewPlainState(dbtx, blockNumber)
+		stateReader = api.historyStateReader(dbtx, blockNumber)
+	}
+	header, err := api._blockReader.Header(ctx, dbtx, hash, blockNumber)
+	if err != nil {
+		stream.WriteNil()
+		return err
 	}
-	header := rawdb.ReadHeader(dbtx, hash, blockNumber)
 	if header == nil {
 		stream.WriteNil()
 		return fmt.Errorf("block %d(%x) not found", blockNumber, hash)
@@ -249,6 +407,13 @@ func (api *PrivateDebugAPIImpl) TraceCall(ctx context.Context, args ethapi.CallA
 			return fmt.Errorf("header.BaseFee uint256 overflow")
 		}
 	}
+	if config != nil && config.BlockOverrides != nil && config.BlockOverrides.BaseFee != nil {
+		var overflow bool
+		baseFee, overflow = uint256.FromBig(config.BlockOverrides.BaseFee.ToInt())
+		if overflow {
+			return fmt.Errorf("blockOverrides.BaseFee uint256 overflow")
+		}
+	}
 	msg, err := args.ToMessage(api.GasCap, baseFee)
 	if err != nil {
 		return err
@@ -259,10 +424,18 @@ func (api *PrivateDebugAPIImpl) TraceCall(ctx context.Context, args ethapi.CallA
 		contractHasTEVM = ethdb.GetHasTEVM(dbtx)
 	}
 	blockCtx, txCtx := transactions.GetEvmContext(msg, header, blockNrOrHash.RequireCanonical, dbtx, contractHasTEVM, api._blockReader)
+	if config != nil && config.BlockOverrides != nil {
+		if err := config.BlockOverrides.Override(&blockCtx); err != nil {
+			return err
+		}
+	}
 	// Trace the transaction and return
-	return transactions.TraceTx(ctx, msg, blockCtx, txCtx, ibs, config, chainConfig, stream)
+	return transactions.TraceTx(ctx, msg, blockCtx, txCtx, ibs, api.traceConfig(config), chainConfig, stream)
 }
 
+// TraceCallMany implements debug_traceCallMany. Traces the bundles of calls one after another, on the state in the
+// middle of the block of simulateContext, each call seeing the changes of the previous ones. The calls are traced
+// with the config of the bundle for the call if given (see Bundle.TraceConfigs), with the config otherwise
 func (api *PrivateDebugAPIImpl) TraceCallMany(ctx context.Context, bundles []Bundle, simulateContext StateContext, config *tracers.TraceConfig, stream *jsoniter.Stream) error {
 	var (
 		hash               common.Hash
@@ -330,7 +503,7 @@ func (api *PrivateDebugAPIImpl) TraceCallMany(ctx context.Context, bundles []Bun
 
 	replayTransactions = block.Transactions()[:transactionIndex]
 
-	stateReader, err := rpchelper.CreateStateReader(ctx, tx, rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(blockNum-1)), api.filters, api.stateCache)
+	stateReader, err := api.stateReader(ctx, tx, rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(blockNum-1)))
 
 	if err != nil {
 		stream.WriteNil()
@@ -403,12 +576,15 @@ func (api *PrivateDebugAPIImpl) TraceCallMany(ctx context.Context, bundles []Bun
 			stream.WriteNil()
 			return err
 		}
-
+		if err = st.FinalizeTx(rules, state.NewNoopWriter()); err != nil {
+			stream.WriteNil()
+			return err
+		}
 	}
 
 	// after replaying the txns, we want to overload the state
-	if config.StateOverrides != nil {
-		err = config.StateOverrides.Override(evm.IntraBlockState().(*state.IntraBlockState))
+	if config != nil && config.StateOverrides != nil {
+		err = config.StateOverrides.Override(st)
 		if err != nil {
 			stream.WriteNil()
 			return err
@@ -421,6 +597,16 @@ func (api *PrivateDebugAPIImpl) TraceCallMany(ctx context.Context, bundles []Bun
 		// first change blockContext
 		blockHeaderOverride(&blockCtx, bundle.BlockOverride, overrideBlockHash)
 		for txn_index, txn := range bundle.Transactions {
+			if txn_index < len(bundle.StateOverrides) && bundle.StateOverrides[txn_index] != nil {
+				if err = bundle.StateOverrides[txn_index].Override(st); err != nil {
+					stream.WriteNil()
+					return err
+				}
+			}
+			callConfig := config
+			if txn_index < len(bundle.TraceConfigs) && bundle.TraceConfigs[txn_index] != nil {
+				callConfig = bundle.TraceConfigs[txn_index]
+			}
 			if txn.Gas == nil || *(txn.Gas) == 0 {
 				txn.Gas = (*hexutil.Uint64)(&api.GasCap)
 			}
@@ -430,14 +616,17 @@ func (api *PrivateDebugAPIImpl) TraceCallMany(ctx context.Context, bundles []Bun
 				return err
 			}
 			txCtx = core.NewEVMTxContext(msg)
-			ibs := evm.IntraBlockState().(*state.IntraBlockState)
-			ibs.Prepare(common.Hash{}, parent.Hash(), txn_index)
-			err = transactions.TraceTx(ctx, msg, blockCtx, txCtx, evm.IntraBlockState(), config, chainConfig, stream)
+			st.Prepare(common.Hash{}, parent.Hash(), txn_index)
+			err = transactions.TraceTx(ctx, msg, blockCtx, txCtx, st, api.traceConfig(callConfig), chainConfig, stream)
 
 			if err != nil {
 				stream.WriteNil()
 				return err
 			}
+			// the next calls see the changes of this one
+			if err = st.FinalizeTx(rules, state.NewNoopWriter()); err != nil {
+				return err
+			}
 
 			if txn_index < len(bundle.Transactions)-1 {
 				stream.WriteMore()
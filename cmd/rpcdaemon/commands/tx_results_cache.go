@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types"
+)
+
+// txResultKey identifies the outputs of re-executing a historical transaction: the transaction, and the version
+// of the state it was executed on. The state is determined by the hash of the block containing the transaction,
+// so after a reorg, the outputs computed for the blocks which are no longer canonical cannot be returned for
+// the blocks replacing them, and get evicted
+type txResultKey struct {
+	txHash     common.Hash
+	blockHash  common.Hash
+	traceTypes string
+}
+
+func newTxResultKey(txHash, blockHash common.Hash, traceTypes []string) txResultKey {
+	sorted := make([]string, len(traceTypes))
+	copy(sorted, traceTypes)
+	sort.Strings(sorted)
+	return txResultKey{txHash: txHash, blockHash: blockHash, traceTypes: strings.Join(sorted, ",")}
+}
+
+// cachedTraceResult returns the result of replaying the transaction with the given trace types, if it has been
+// computed before. Result is shared between the callers and must not be modified
+func (api *BaseAPI) cachedTraceResult(txHash, blockHash common.Hash, traceTypes []string) (*TraceCallResult, bool) {
+	if api.txResultsLRU == nil {
+		return nil, false
+	}
+	if it, ok := api.txResultsLRU.Get(newTxResultKey(txHash, blockHash, traceTypes)); ok && it != nil {
+		return it.(*TraceCallResult), true
+	}
+	return nil, false
+}
+
+func (api *BaseAPI) cacheTraceResult(txHash, blockHash common.Hash, traceTypes []string, result *TraceCallResult) {
+	if api.txResultsLRU == nil || result == nil {
+		return
+	}
+	api.txResultsLRU.Add(newTxResultKey(txHash, blockHash, traceTypes), result)
+}
+
+// cachedReceipts returns the receipts (logs and gas used) of the block computed by re-executing it before, for
+// eth_getBlockReceipts, eth_getTransactionReceipt and eth_getLogs over pruned logs. Block hash determines the
+// state, so a reorg does not need to invalidate them. Receipts are shared between the callers and must not be modified
+func (api *BaseAPI) cachedReceipts(blockHash common.Hash) (types.Receipts, bool) {
+	if api.receiptsLRU == nil {
+		return nil, false
+	}
+	if it, ok := api.receiptsLRU.Get(blockHash); ok && it != nil {
+		return it.(types.Receipts), true
+	}
+	return nil, false
+}
+
+func (api *BaseAPI) cacheReceipts(blockHash common.Hash, receipts types.Receipts) {
+	if api.receiptsLRU == nil {
+		return
+	}
+	api.receiptsLRU.Add(blockHash, receipts)
+}
@@ -3,28 +3,41 @@ package commands
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 
+	"github.com/holiman/uint256"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces"
 	proto_txpool "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core"
 	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/turbo/rpchelper"
 )
 
 // NetAPI the interface for the net_ RPC commands
 type TxPoolAPI interface {
 	Content(ctx context.Context) (map[string]map[string]map[string]*RPCTransaction, error)
+	ContentFrom(ctx context.Context, sender common.Address) (map[string]map[string]*RPCTransaction, error)
+	ContentPage(ctx context.Context, cursor *common.Address, limit *hexutil.Uint) (*TxPoolContentPage, error)
+	Summary(ctx context.Context) (map[string]*TxPoolSubpoolSummary, error)
+	Explain(ctx context.Context, hashOrTx hexutil.Bytes) (*TxPoolExplanation, error)
+	Locals(ctx context.Context) ([]common.Hash, error)
+	DropLocal(ctx context.Context, hash common.Hash) (bool, error)
 }
 
 // TxPoolAPIImpl data structure to store things needed for net_ commands
 type TxPoolAPIImpl struct {
 	*BaseAPI
-	pool proto_txpool.TxpoolClient
-	db   kv.RoDB
+	pool     proto_txpool.TxpoolClient
+	db       kv.RoDB
+	localTxs *rpchelper.LocalTxs
+	policy   *core.TxPoolConfig // nil - the pool is in another process
 }
 
 // NewTxPoolAPI returns NetAPIImplImpl instance
@@ -36,47 +49,53 @@ func NewTxPoolAPI(base *BaseAPI, db kv.RoDB, pool proto_txpool.TxpoolClient) *Tx
 	}
 }
 
-func (api *TxPoolAPIImpl) Content(ctx context.Context) (map[string]map[string]map[string]*RPCTransaction, error) {
+// txPoolSubpools are the names of the subpools in the responses, in the order of the result of poolContent
+var txPoolSubpools = [3]string{"pending", "baseFee", "queued"}
+
+const (
+	txPoolPageDefault = 100  // senders in a page of txpool_contentPage without a limit
+	txPoolPageMax     = 1000 // senders in a page of txpool_contentPage
+)
+
+// txPoolSummaryPercentiles are the percentiles of the fee distribution in txpool_summary
+var txPoolSummaryPercentiles = []int{0, 10, 25, 50, 75, 90, 100}
+
+// poolContent returns the transactions of each subpool by sender, in the order of txPoolSubpools
+func (api *TxPoolAPIImpl) poolContent(ctx context.Context) ([3]map[common.Address][]types.Transaction, error) {
+	content := [3]map[common.Address][]types.Transaction{}
+	for i := range content {
+		content[i] = make(map[common.Address][]types.Transaction, 8)
+	}
 	reply, err := api.pool.All(ctx, &proto_txpool.AllRequest{})
 	if err != nil {
-		return nil, err
+		return content, err
 	}
-
-	content := map[string]map[string]map[string]*RPCTransaction{
-		"pending": make(map[string]map[string]*RPCTransaction),
-		"baseFee": make(map[string]map[string]*RPCTransaction),
-		"queued":  make(map[string]map[string]*RPCTransaction),
-	}
-
-	pending := make(map[common.Address][]types.Transaction, 8)
-	baseFee := make(map[common.Address][]types.Transaction, 8)
-	queued := make(map[common.Address][]types.Transaction, 8)
 	for i := range reply.Txs {
 		stream := rlp.NewStream(bytes.NewReader(reply.Txs[i].RlpTx), 0)
 		txn, err := types.DecodeTransaction(stream)
 		if err != nil {
-			return nil, err
+			return content, err
 		}
 		addr := gointerfaces.ConvertH160toAddress(reply.Txs[i].Sender)
+		var subpool int
 		switch reply.Txs[i].TxnType {
 		case proto_txpool.AllReply_PENDING:
-			if _, ok := pending[addr]; !ok {
-				pending[addr] = make([]types.Transaction, 0, 4)
-			}
-			pending[addr] = append(pending[addr], txn)
+			subpool = 0
 		case proto_txpool.AllReply_BASE_FEE:
-			if _, ok := baseFee[addr]; !ok {
-				baseFee[addr] = make([]types.Transaction, 0, 4)
-			}
-			baseFee[addr] = append(baseFee[addr], txn)
+			subpool = 1
 		case proto_txpool.AllReply_QUEUED:
-			if _, ok := queued[addr]; !ok {
-				queued[addr] = make([]types.Transaction, 0, 4)
-			}
-			queued[addr] = append(queued[addr], txn)
+			subpool = 2
+		default:
+			continue
 		}
+		content[subpool][addr] = append(content[subpool][addr], txn)
 	}
+	return content, nil
+}
 
+// dumpPoolContent flattens the transactions of the senders by nonce, for each subpool. Returns nil if there is no
+// current header
+func (api *TxPoolAPIImpl) dumpPoolContent(ctx context.Context, content [3]map[common.Address][]types.Transaction, senders []common.Address) (map[string]map[string]map[string]*RPCTransaction, error) {
 	tx, err := api.db.BeginRo(ctx)
 	if err != nil {
 		return nil, err
@@ -91,44 +110,203 @@ func (api *TxPoolAPIImpl) Content(ctx context.Context) (map[string]map[string]ma
 	if curHeader == nil {
 		return nil, nil
 	}
-	// Flatten the pending transactions
-	for account, txs := range pending {
-		dump := make(map[string]*RPCTransaction)
-		for _, txn := range txs {
-			dump[fmt.Sprintf("%d", txn.GetNonce())] = newRPCPendingTransaction(txn, curHeader, cc)
+	dump := make(map[string]map[string]map[string]*RPCTransaction, len(content))
+	for i, name := range txPoolSubpools {
+		dump[name] = make(map[string]map[string]*RPCTransaction)
+		for _, account := range senders {
+			txs, ok := content[i][account]
+			if !ok {
+				continue
+			}
+			byNonce := make(map[string]*RPCTransaction, len(txs))
+			for _, txn := range txs {
+				byNonce[fmt.Sprintf("%d", txn.GetNonce())] = newRPCPendingTransaction(txn, curHeader, cc)
+			}
+			dump[name][account.Hex()] = byNonce
 		}
-		content["pending"][account.Hex()] = dump
 	}
-	// Flatten the baseFee transactions
-	for account, txs := range baseFee {
-		dump := make(map[string]*RPCTransaction)
-		for _, txn := range txs {
-			dump[fmt.Sprintf("%d", txn.GetNonce())] = newRPCPendingTransaction(txn, curHeader, cc)
+	return dump, nil
+}
+
+// poolSenders returns the senders of the transactions of all subpools in ascending order
+func poolSenders(content [3]map[common.Address][]types.Transaction) []common.Address {
+	seen := map[common.Address]struct{}{}
+	var senders []common.Address
+	for _, subpool := range content {
+		for account := range subpool {
+			if _, ok := seen[account]; !ok {
+				seen[account] = struct{}{}
+				senders = append(senders, account)
+			}
 		}
-		content["baseFee"][account.Hex()] = dump
 	}
-	// Flatten the queued transactions
-	for account, txs := range queued {
-		dump := make(map[string]*RPCTransaction)
-		for _, txn := range txs {
-			dump[fmt.Sprintf("%d", txn.GetNonce())] = newRPCPendingTransaction(txn, curHeader, cc)
+	sort.Slice(senders, func(i, j int) bool {
+		return bytes.Compare(senders[i][:], senders[j][:]) < 0
+	})
+	return senders
+}
+
+// Content implements txpool_content. Returns the transactions of each subpool by sender and nonce, see
+// txpool_contentPage for large pools
+func (api *TxPoolAPIImpl) Content(ctx context.Context) (map[string]map[string]map[string]*RPCTransaction, error) {
+	content, err := api.poolContent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return api.dumpPoolContent(ctx, content, poolSenders(content))
+}
+
+// ContentFrom implements txpool_contentFrom. Returns the transactions of the sender in each subpool by nonce
+func (api *TxPoolAPIImpl) ContentFrom(ctx context.Context, sender common.Address) (map[string]map[string]*RPCTransaction, error) {
+	content, err := api.poolContent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dump, err := api.dumpPoolContent(ctx, content, []common.Address{sender})
+	if err != nil || dump == nil {
+		return nil, err
+	}
+	result := make(map[string]map[string]*RPCTransaction, len(dump))
+	for name, bySender := range dump {
+		result[name] = bySender[sender.Hex()]
+		if result[name] == nil {
+			result[name] = make(map[string]*RPCTransaction)
 		}
-		content["queued"][account.Hex()] = dump
 	}
-	return content, nil
+	return result, nil
+}
+
+// TxPoolContentPage is a page of txpool_content: the transactions of the senders after the cursor, in ascending order
+type TxPoolContentPage struct {
+	Pending map[string]map[string]*RPCTransaction `json:"pending"`
+	BaseFee map[string]map[string]*RPCTransaction `json:"baseFee"`
+	Queued  map[string]map[string]*RPCTransaction `json:"queued"`
+	Next    *common.Address                       `json:"next"` // cursor of the next page, nil on the last page
+}
+
+// ContentPage implements txpool_contentPage. Returns the transactions of up to limit senders after the cursor, all the
+// transactions of a sender are on the same page. Without a cursor the first page is returned
+func (api *TxPoolAPIImpl) ContentPage(ctx context.Context, cursor *common.Address, limit *hexutil.Uint) (*TxPoolContentPage, error) {
+	pageSize := txPoolPageDefault
+	if limit != nil {
+		if *limit == 0 || *limit > txPoolPageMax {
+			return nil, fmt.Errorf("limit must be between 1 and %d", txPoolPageMax)
+		}
+		pageSize = int(*limit)
+	}
+	content, err := api.poolContent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	senders := poolSenders(content)
+	if cursor != nil {
+		senders = senders[sort.Search(len(senders), func(i int) bool {
+			return bytes.Compare(senders[i][:], cursor[:]) > 0
+		}):]
+	}
+	page := &TxPoolContentPage{}
+	if len(senders) > pageSize {
+		senders = senders[:pageSize]
+		page.Next = &senders[pageSize-1]
+	}
+	dump, err := api.dumpPoolContent(ctx, content, senders)
+	if err != nil || dump == nil {
+		return nil, err
+	}
+	page.Pending, page.BaseFee, page.Queued = dump["pending"], dump["baseFee"], dump["queued"]
+	return page, nil
+}
+
+// TxPoolSubpoolSummary are the counts and the fee distribution of the transactions of a subpool
+type TxPoolSubpoolSummary struct {
+	Transactions hexutil.Uint   `json:"transactions"`
+	Senders      hexutil.Uint   `json:"senders"`
+	FeeCap       []*hexutil.Big `json:"feeCap"` // at txPoolSummaryPercentiles, empty if there are no transactions
+	Tip          []*hexutil.Big `json:"tip"`
+}
+
+// Summary implements txpool_summary. Returns the counts and the distribution of the fee caps and tips of each subpool,
+// without the transactions
+func (api *TxPoolAPIImpl) Summary(ctx context.Context) (map[string]*TxPoolSubpoolSummary, error) {
+	content, err := api.poolContent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	summary := make(map[string]*TxPoolSubpoolSummary, len(content))
+	for i, name := range txPoolSubpools {
+		var feeCaps, tips []*uint256.Int
+		for _, txs := range content[i] {
+			for _, txn := range txs {
+				feeCaps = append(feeCaps, txn.GetFeeCap())
+				tips = append(tips, txn.GetTip())
+			}
+		}
+		summary[name] = &TxPoolSubpoolSummary{
+			Transactions: hexutil.Uint(len(feeCaps)),
+			Senders:      hexutil.Uint(len(content[i])),
+			FeeCap:       feePercentiles(feeCaps),
+			Tip:          feePercentiles(tips),
+		}
+	}
+	return summary, nil
+}
+
+// feePercentiles returns the fees at txPoolSummaryPercentiles, sorts fees
+func feePercentiles(fees []*uint256.Int) []*hexutil.Big {
+	result := make([]*hexutil.Big, 0, len(txPoolSummaryPercentiles))
+	if len(fees) == 0 {
+		return result
+	}
+	sort.Slice(fees, func(i, j int) bool { return fees[i].Lt(fees[j]) })
+	for _, p := range txPoolSummaryPercentiles {
+		result = append(result, (*hexutil.Big)(fees[(len(fees)-1)*p/100].ToBig()))
+	}
+	return result
 }
 
-// Status returns the number of pending and queued transaction in the pool.
+// Status returns the number of pending and queued transaction in the pool. The policy of the pool is added when it
+// runs in the same process
 func (api *TxPoolAPIImpl) Status(ctx context.Context) (map[string]hexutil.Uint, error) {
 	reply, err := api.pool.Status(ctx, &proto_txpool.StatusRequest{})
 	if err != nil {
 		return nil, err
 	}
-	return map[string]hexutil.Uint{
+	status := map[string]hexutil.Uint{
 		"pending": hexutil.Uint(reply.PendingCount),
 		"baseFee": hexutil.Uint(reply.BaseFeeCount),
 		"queued":  hexutil.Uint(reply.QueuedCount),
-	}, nil
+	}
+	if api.policy != nil {
+		status["priceBump"] = hexutil.Uint(api.policy.PriceBump)
+		status["priceLimit"] = hexutil.Uint(api.policy.PriceLimit)
+		status["maxReplacements"] = hexutil.Uint(api.policy.MaxReplacements)
+		status["maxNonceGap"] = hexutil.Uint(api.policy.MaxNonceGap)
+		status["accountSlots"] = hexutil.Uint(api.policy.AccountSlots)
+		status["pendingLimit"] = hexutil.Uint(api.policy.GlobalSlots)
+		status["baseFeeLimit"] = hexutil.Uint(api.policy.GlobalBaseFeeQueue)
+		status["queuedLimit"] = hexutil.Uint(api.policy.GlobalQueue)
+	}
+	return status, nil
+}
+
+var errLocalTxsDisabled = errors.New("local transactions are not tracked, see --rpc.localtxs.journal")
+
+// Locals implements txpool_locals. Returns the hashes of the transactions sent by eth_sendRawTransaction which are not
+// mined yet, they are submitted to the pool again if it drops them
+func (api *TxPoolAPIImpl) Locals(_ context.Context) ([]common.Hash, error) {
+	if api.localTxs == nil {
+		return nil, errLocalTxsDisabled
+	}
+	return api.localTxs.Hashes(), nil
+}
+
+// DropLocal implements txpool_dropLocal. Stops submitting a local transaction to the pool again, returns false if it's
+// not local. The pool keeps the transaction until it's mined or evicted
+func (api *TxPoolAPIImpl) DropLocal(_ context.Context, hash common.Hash) (bool, error) {
+	if api.localTxs == nil {
+		return false, errLocalTxsDisabled
+	}
+	return api.localTxs.Drop(hash)
 }
 
 /*
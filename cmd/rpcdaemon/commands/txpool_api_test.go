@@ -3,6 +3,8 @@ package commands
 import (
 	"bytes"
 	"fmt"
+	"math/big"
+	"path/filepath"
 	"testing"
 
 	"github.com/holiman/uint256"
@@ -61,4 +63,182 @@ func TestTxPoolContent(t *testing.T) {
 	require.Len(status, 3)
 	require.Equal(status["pending"], hexutil.Uint(1))
 	require.Equal(status["queued"], hexutil.Uint(0))
+
+	policy := core.DeprecatedDefaultTxPoolConfig
+	policy.MaxReplacements = 3
+	api.policy = &policy
+	status, err = api.Status(ctx)
+	require.NoError(err)
+	require.Equal(hexutil.Uint(policy.PriceBump), status["priceBump"])
+	require.Equal(hexutil.Uint(3), status["maxReplacements"])
+	require.Equal(hexutil.Uint(policy.GlobalSlots), status["pendingLimit"])
+
+	contentFrom, err := api.ContentFrom(ctx, m.Address)
+	require.NoError(err)
+	require.Equal(expectValue, contentFrom["pending"]["0"].Value.ToInt().Uint64())
+	require.Empty(contentFrom["queued"])
+	contentFrom, err = api.ContentFrom(ctx, common.Address{1})
+	require.NoError(err)
+	require.Empty(contentFrom["pending"])
+
+	limit := hexutil.Uint(1)
+	page, err := api.ContentPage(ctx, nil, &limit)
+	require.NoError(err)
+	require.Equal(1, len(page.Pending[sender]))
+	require.Nil(page.Next)
+	page, err = api.ContentPage(ctx, &m.Address, nil)
+	require.NoError(err)
+	require.Empty(page.Pending)
+	limit = 0
+	_, err = api.ContentPage(ctx, nil, &limit)
+	require.Error(err)
+
+	summary, err := api.Summary(ctx)
+	require.NoError(err)
+	require.Equal(hexutil.Uint(1), summary["pending"].Transactions)
+	require.Equal(hexutil.Uint(1), summary["pending"].Senders)
+	require.Len(summary["pending"].FeeCap, len(txPoolSummaryPercentiles))
+	require.Equal(uint64(10*params.GWei), summary["pending"].FeeCap[0].ToInt().Uint64())
+	require.Empty(summary["queued"].FeeCap)
+}
+
+func TestFeePercentiles(t *testing.T) {
+	var fees []*uint256.Int
+	for i := 100; i > 0; i-- {
+		fees = append(fees, uint256.NewInt(uint64(i)))
+	}
+	percentiles := feePercentiles(fees)
+	require.Len(t, percentiles, len(txPoolSummaryPercentiles))
+	require.Equal(t, uint64(1), percentiles[0].ToInt().Uint64())
+	require.Equal(t, uint64(50), percentiles[3].ToInt().Uint64())
+	require.Equal(t, uint64(100), percentiles[len(percentiles)-1].ToInt().Uint64())
+	require.Empty(t, feePercentiles(nil))
+}
+
+func TestTxPoolExplain(t *testing.T) {
+	m, require := stages.MockWithTxPool(t), require.New(t)
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 1, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{1})
+	}, false /* intermediateHashes */)
+	require.NoError(err)
+	require.NoError(m.InsertChain(chain))
+
+	ctx, conn := rpcdaemontest.CreateTestGrpcConn(t, m)
+	txPool := txpool.NewTxpoolClient(conn)
+	ff := rpchelper.New(ctx, nil, txPool, txpool.NewMiningClient(conn), func() {})
+	api := NewTxPoolAPI(NewBaseApi(ff, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), nil, nil, false), m.DB, txPool)
+	signer := types.LatestSignerForChainID(m.ChainConfig.ChainID)
+	encode := func(txn types.Transaction) []byte {
+		buf := bytes.NewBuffer(nil)
+		require.NoError(txn.MarshalBinary(buf))
+		return buf.Bytes()
+	}
+
+	newTx := func(signer *types.Signer, nonce, gas, gasPrice uint64) types.Transaction {
+		txn, err := types.SignTx(types.NewTransaction(nonce, common.Address{1}, uint256.NewInt(1), gas, uint256.NewInt(gasPrice), nil), *signer, m.Key)
+		require.NoError(err)
+		return txn
+	}
+
+	pending := newTx(signer, 0, params.TxGas, 10*params.GWei)
+	reply, err := txPool.Add(ctx, &txpool.AddRequest{RlpTxs: [][]byte{encode(pending)}})
+	require.NoError(err)
+	require.Equal(txPoolProto.ImportResult_SUCCESS, reply.Imported[0], fmt.Sprintf("%s", reply.Errors))
+	explanation, err := api.Explain(ctx, pending.Hash().Bytes())
+	require.NoError(err)
+	require.Equal("pending", explanation.Status)
+	require.Equal(m.Address, *explanation.Sender)
+	require.Empty(explanation.Reasons)
+
+	// Transactions which are not sent are explained from their RLP, the nonce 2 waits for the nonce 1
+	explanation, err = api.Explain(ctx, encode(newTx(signer, 2, params.TxGas, 10*params.GWei)))
+	require.NoError(err)
+	require.Equal(txStatusUnknown, explanation.Status)
+	require.Len(explanation.Reasons, 1)
+	require.Equal(txReasonNonceGap, explanation.Reasons[0].Reason)
+	require.Equal(uint64(1), explanation.Reasons[0].Threshold.ToInt().Uint64())
+
+	explanation, err = api.Explain(ctx, encode(newTx(signer, 0, params.TxGas, 20*params.GWei)))
+	require.NoError(err)
+	require.Len(explanation.Reasons, 1)
+	require.Equal(txReasonNonceTaken, explanation.Reasons[0].Reason)
+
+	explanation, err = api.Explain(ctx, encode(newTx(signer, 1, params.TxGas-1, 10*params.GWei)))
+	require.NoError(err)
+	require.Len(explanation.Reasons, 1)
+	require.Equal(txReasonIntrinsicGas, explanation.Reasons[0].Reason)
+	require.Equal(params.TxGas, explanation.Reasons[0].Threshold.ToInt().Uint64())
+
+	// The sender of a transaction signed for another chain is still recovered
+	otherChainID := new(big.Int).Add(m.ChainConfig.ChainID, big.NewInt(1))
+	explanation, err = api.Explain(ctx, encode(newTx(types.LatestSignerForChainID(otherChainID), 1, params.TxGas, 10*params.GWei)))
+	require.NoError(err)
+	require.Equal(m.Address, *explanation.Sender)
+	require.Len(explanation.Reasons, 1)
+	require.Equal(txReasonChainID, explanation.Reasons[0].Reason)
+	require.Equal(otherChainID, explanation.Reasons[0].Value.ToInt())
+
+	explanation, err = api.Explain(ctx, common.Hash{1}.Bytes())
+	require.NoError(err)
+	require.Equal(txStatusUnknown, explanation.Status)
+	require.Nil(explanation.Sender)
+}
+
+func TestTxPoolLocals(t *testing.T) {
+	m, require := stages.MockWithTxPool(t), require.New(t)
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 1, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{1})
+	}, false /* intermediateHashes */)
+	require.NoError(err)
+	require.NoError(m.InsertChain(chain))
+
+	ctx, conn := rpcdaemontest.CreateTestGrpcConn(t, m)
+	txPool := txpool.NewTxpoolClient(conn)
+	ff := rpchelper.New(ctx, nil, txPool, txpool.NewMiningClient(conn), func() {})
+	base := NewBaseApi(ff, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), nil, nil, false)
+	journal := filepath.Join(t.TempDir(), "local_txs.rlp")
+	localTxs, err := rpchelper.NewLocalTxs(m.DB, snapshotsync.NewBlockReader(), txPool, journal)
+	require.NoError(err)
+	ethAPI := NewEthAPI(base, m.DB, nil, txPool, nil, 5000000)
+	ethAPI.localTxs = localTxs
+	api := NewTxPoolAPI(base, m.DB, txPool)
+	api.localTxs = localTxs
+
+	txn, err := types.SignTx(types.NewTransaction(0, common.Address{1}, uint256.NewInt(1234), params.TxGas, uint256.NewInt(10*params.GWei), nil), *types.LatestSignerForChainID(m.ChainConfig.ChainID), m.Key)
+	require.NoError(err)
+	buf := bytes.NewBuffer(nil)
+	require.NoError(txn.MarshalBinary(buf))
+	hash, err := ethAPI.SendRawTransaction(ctx, buf.Bytes())
+	require.NoError(err)
+
+	locals, err := api.Locals(ctx)
+	require.NoError(err)
+	require.Equal([]common.Hash{hash}, locals)
+
+	// The pool has the transaction, it's kept and not submitted again
+	require.NoError(localTxs.Resubmit(ctx))
+	require.Equal([]common.Hash{hash}, localTxs.Hashes())
+
+	// A replacement of the same nonce takes its place
+	txn, err = types.SignTx(types.NewTransaction(0, common.Address{1}, uint256.NewInt(1234), params.TxGas, uint256.NewInt(20*params.GWei), nil), *types.LatestSignerForChainID(m.ChainConfig.ChainID), m.Key)
+	require.NoError(err)
+	buf.Reset()
+	require.NoError(txn.MarshalBinary(buf))
+	hash, err = ethAPI.SendRawTransaction(ctx, buf.Bytes())
+	require.NoError(err)
+	require.Equal([]common.Hash{hash}, localTxs.Hashes())
+
+	// The journal survives restarts until the transaction is dropped
+	reloaded, err := rpchelper.NewLocalTxs(m.DB, snapshotsync.NewBlockReader(), txPool, journal)
+	require.NoError(err)
+	require.Equal([]common.Hash{hash}, reloaded.Hashes())
+	dropped, err := api.DropLocal(ctx, hash)
+	require.NoError(err)
+	require.True(dropped)
+	dropped, err = api.DropLocal(ctx, hash)
+	require.NoError(err)
+	require.False(dropped)
+	reloaded, err = rpchelper.NewLocalTxs(m.DB, snapshotsync.NewBlockReader(), txPool, journal)
+	require.NoError(err)
+	require.Empty(reloaded.Hashes())
 }
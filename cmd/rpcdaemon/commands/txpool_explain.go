@@ -0,0 +1,210 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	proto_txpool "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
+	types2 "github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/consensus/misc"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/rpc"
+)
+
+// The statuses of a transaction in txpool_explain, besides the names of the subpools
+const (
+	txStatusMined   = "mined"
+	txStatusUnknown = "unknown" // neither in the pool nor mined
+)
+
+// The reasons of txpool_explain why a transaction is not pending
+const (
+	txReasonChainID        = "chainId"     // signed for another chain
+	txReasonNonceTooLow    = "nonceTooLow" // the nonce of the sender is past the nonce of the transaction
+	txReasonNonceGap       = "nonceGap"    // a transaction with a lower nonce of the sender is missing from the pool
+	txReasonNonceTaken     = "nonceTaken"  // another transaction of the sender with the same nonce is in the pool
+	txReasonFunds          = "insufficientFunds"
+	txReasonBaseFee        = "feeCapBelowBaseFee" // of the pending block
+	txReasonTipAboveFeeCap = "tipAboveFeeCap"
+	txReasonIntrinsicGas   = "intrinsicGas"
+	txReasonBlockGasLimit  = "exceedsBlockGasLimit"
+)
+
+// TxPoolExplanation is the result of txpool_explain
+type TxPoolExplanation struct {
+	Hash    common.Hash     `json:"hash"`
+	Sender  *common.Address `json:"sender"`  // nil if the transaction is unknown
+	Status  string          `json:"status"`  // the subpool of the transaction, "mined" or "unknown"
+	Reasons []TxPoolReason  `json:"reasons"` // why the transaction can't be pending, empty if it can
+}
+
+// TxPoolReason is a check of the pool which the transaction fails: its value is compared to the threshold of the check
+type TxPoolReason struct {
+	Reason    string       `json:"reason"`
+	Message   string       `json:"message"`
+	Value     *hexutil.Big `json:"value,omitempty"`
+	Threshold *hexutil.Big `json:"threshold,omitempty"`
+}
+
+func newTxPoolReason(reason string, value, threshold *big.Int, format string, args ...interface{}) TxPoolReason {
+	return TxPoolReason{Reason: reason, Message: fmt.Sprintf(format, args...), Value: (*hexutil.Big)(value), Threshold: (*hexutil.Big)(threshold)}
+}
+
+// Explain implements txpool_explain. Given the hash of a transaction or a signed transaction, returns the subpool of
+// the transaction and the checks of the pool which it fails against the latest state and the pending block. The checks
+// depending on the settings of the txpool (min fee, slots per account, price bump) are not done.
+// The transaction is looked up in the pool by hash, and the other transactions of the sender are only known by the
+// highest nonce among them, so a missing nonce below a transaction in the pool is not detected. The subpool is
+// derived from the failed checks, the same way the pool sorts the transactions
+func (api *TxPoolAPIImpl) Explain(ctx context.Context, hashOrTx hexutil.Bytes) (*TxPoolExplanation, error) {
+	var txn types.Transaction
+	var err error
+	explanation := &TxPoolExplanation{Status: txStatusUnknown, Reasons: []TxPoolReason{}}
+	if len(hashOrTx) == common.HashLength {
+		explanation.Hash = common.BytesToHash(hashOrTx)
+	} else {
+		if txn, err = types.DecodeTransaction(rlp.NewStream(bytes.NewReader(hashOrTx), uint64(len(hashOrTx)))); err != nil {
+			return nil, err
+		}
+		explanation.Hash = txn.Hash()
+	}
+
+	reply, err := api.pool.Transactions(ctx, &proto_txpool.TransactionsRequest{Hashes: []*types2.H256{gointerfaces.ConvertHashToH256(explanation.Hash)}})
+	if err != nil {
+		return nil, err
+	}
+	inPool := len(reply.RlpTxs) > 0 && len(reply.RlpTxs[0]) > 0
+	if inPool {
+		if txn, err = types.DecodeTransaction(rlp.NewStream(bytes.NewReader(reply.RlpTxs[0]), uint64(len(reply.RlpTxs[0])))); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if !inPool {
+		_, mined, err := api.txnLookup(ctx, tx, explanation.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if mined {
+			explanation.Status = txStatusMined
+			return explanation, nil
+		}
+	}
+	if txn == nil {
+		return explanation, nil
+	}
+
+	cc, err := api.chainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	header := rawdb.ReadCurrentHeader(tx)
+	if header == nil {
+		return nil, fmt.Errorf("current header not found")
+	}
+	pendingNumber := header.Number.Uint64() + 1
+	reasons := explanation.Reasons
+
+	// Checked before the sender is recovered, which fails for another chain
+	signer := types.MakeSigner(cc, pendingNumber)
+	if chainID := txn.GetChainID().ToBig(); txn.Protected() && chainID.Cmp(cc.ChainID) != 0 {
+		reasons = append(reasons, newTxPoolReason(txReasonChainID, chainID, cc.ChainID, "signed for chain %d, the chain is %d", chainID, cc.ChainID))
+		signer = types.LatestSignerForChainID(chainID)
+	}
+	sender, err := txn.Sender(*signer)
+	if err != nil {
+		return nil, err
+	}
+	explanation.Sender = &sender
+
+	stateReader, err := api.stateReader(ctx, tx, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber))
+	if err != nil {
+		return nil, err
+	}
+	account, err := stateReader.ReadAccountData(sender)
+	if err != nil {
+		return nil, err
+	}
+	var stateNonce uint64
+	balance := new(big.Int)
+	if account != nil {
+		stateNonce, balance = account.Nonce, account.Balance.ToBig()
+	}
+	nonce := txn.GetNonce()
+	if nonce < stateNonce {
+		reasons = append(reasons, newTxPoolReason(txReasonNonceTooLow, new(big.Int).SetUint64(nonce), new(big.Int).SetUint64(stateNonce), "nonce %d, the next nonce of the sender is %d", nonce, stateNonce))
+	}
+	// Only the highest nonce of the transactions of the sender in the pool is known, so the nonces are checked
+	// against the pool for the transactions which are not in it
+	feeCap, tip := txn.GetFeeCap().ToBig(), txn.GetTip().ToBig()
+	if !inPool && nonce >= stateNonce {
+		nonceReply, err := api.pool.Nonce(ctx, &proto_txpool.NonceRequest{Address: gointerfaces.ConvertAddressToH160(sender)})
+		if err != nil {
+			return nil, err
+		}
+		nextNonce := stateNonce
+		if nonceReply.Found && nonceReply.Nonce >= stateNonce {
+			nextNonce = nonceReply.Nonce + 1
+		}
+		if nonce > nextNonce {
+			reasons = append(reasons, newTxPoolReason(txReasonNonceGap, new(big.Int).SetUint64(nonce), new(big.Int).SetUint64(nextNonce), "nonce %d, the transaction with nonce %d is missing", nonce, nextNonce))
+		} else if nonce < nextNonce {
+			highest := new(big.Int).SetUint64(nonceReply.Nonce)
+			reasons = append(reasons, newTxPoolReason(txReasonNonceTaken, new(big.Int).SetUint64(nonce), highest, "nonce %d, the pool has transactions of the sender up to nonce %d", nonce, highest))
+		}
+	}
+	cost := new(big.Int).Mul(feeCap, new(big.Int).SetUint64(txn.GetGas()))
+	cost.Add(cost, txn.GetValue().ToBig())
+	if balance.Cmp(cost) < 0 {
+		reasons = append(reasons, newTxPoolReason(txReasonFunds, cost, balance, "gas * fee cap + value is %d, the balance of the sender is %d", cost, balance))
+	}
+	if tip.Cmp(feeCap) > 0 {
+		reasons = append(reasons, newTxPoolReason(txReasonTipAboveFeeCap, tip, feeCap, "tip %d is above the fee cap %d", tip, feeCap))
+	}
+	if cc.IsLondon(pendingNumber) {
+		baseFee := misc.CalcBaseFee(cc, header)
+		if feeCap.Cmp(baseFee) < 0 {
+			reasons = append(reasons, newTxPoolReason(txReasonBaseFee, feeCap, baseFee, "fee cap %d is below the base fee %d of the pending block", feeCap, baseFee))
+		}
+	}
+	intrinsicGas, err := core.IntrinsicGas(txn.GetData(), txn.GetAccessList(), txn.GetTo() == nil, cc.IsHomestead(pendingNumber), cc.IsIstanbul(pendingNumber))
+	if err != nil {
+		return nil, err
+	}
+	if txn.GetGas() < intrinsicGas {
+		reasons = append(reasons, newTxPoolReason(txReasonIntrinsicGas, new(big.Int).SetUint64(txn.GetGas()), new(big.Int).SetUint64(intrinsicGas), "gas %d is below the intrinsic gas %d", txn.GetGas(), intrinsicGas))
+	}
+	if txn.GetGas() > header.GasLimit {
+		reasons = append(reasons, newTxPoolReason(txReasonBlockGasLimit, new(big.Int).SetUint64(txn.GetGas()), new(big.Int).SetUint64(header.GasLimit), "gas %d exceeds the block gas limit %d", txn.GetGas(), header.GasLimit))
+	}
+	explanation.Reasons = reasons
+	if inPool {
+		explanation.Status = txPoolSubpool(reasons)
+	}
+	return explanation, nil
+}
+
+// txPoolSubpool returns the subpool of a transaction in the pool by the checks it fails: pending if there are none,
+// baseFee if the fee cap is only below the base fee, queued otherwise
+func txPoolSubpool(reasons []TxPoolReason) string {
+	if len(reasons) == 0 {
+		return txPoolSubpools[0]
+	}
+	if len(reasons) == 1 && reasons[0].Reason == txReasonBaseFee {
+		return txPoolSubpools[1]
+	}
+	return txPoolSubpools[2]
+}
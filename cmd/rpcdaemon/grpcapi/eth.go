@@ -0,0 +1,241 @@
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/remotedbserver"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/turbo/rpchelper"
+	"github.com/ledgerwatch/erigon/turbo/services"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Register registers on the gRPC server of rpcdaemon the services reading its database, for the consumers which
+// already use the erigon-lib gRPC interfaces:
+//   - remote.KV - the raw tables, i.e. the state and its history
+//   - remote.ETHBACKEND - Block, TxnLookup and ClientVersion
+//   - rpcdaemon.Eth - BlockNumber and Receipts, which have no counterpart in the remote interfaces
+func Register(ctx context.Context, server *grpc.Server, db kv.RoDB, blockReader services.FullBlockReader) {
+	remote.RegisterKVServer(server, remotedbserver.NewKvServer(ctx, db, nil))
+	remote.RegisterETHBACKENDServer(server, NewEthBackendServer(db, blockReader))
+	RegisterEthServer(server, NewEthServer(db, blockReader))
+}
+
+// EthBackendServer implements the read methods of remote.ETHBACKEND over the database of rpcdaemon
+type EthBackendServer struct {
+	remote.UnimplementedETHBACKENDServer // must be embedded to have forward compatible implementations.
+
+	db          kv.RoDB
+	blockReader services.FullBlockReader
+}
+
+func NewEthBackendServer(db kv.RoDB, blockReader services.FullBlockReader) *EthBackendServer {
+	return &EthBackendServer{db: db, blockReader: blockReader}
+}
+
+func (s *EthBackendServer) ClientVersion(_ context.Context, _ *remote.ClientVersionRequest) (*remote.ClientVersionReply, error) {
+	return &remote.ClientVersionReply{NodeName: common.MakeName("rpcdaemon", params.Version)}, nil
+}
+
+func (s *EthBackendServer) TxnLookup(ctx context.Context, req *remote.TxnLookupRequest) (*remote.TxnLookupReply, error) {
+	tx, err := s.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	blockNum, ok, err := s.blockReader.TxnLookup(ctx, tx, gointerfaces.ConvertH256ToHash(req.TxnHash))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// Same as erigon: assumes there are no transactions in block 0
+		return &remote.TxnLookupReply{BlockNumber: 0}, nil
+	}
+	return &remote.TxnLookupReply{BlockNumber: blockNum}, nil
+}
+
+// Block returns the block of the hash and height, the canonical block of the height if the hash is not set
+func (s *EthBackendServer) Block(ctx context.Context, req *remote.BlockRequest) (*remote.BlockReply, error) {
+	tx, err := s.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	block, senders, err := blockWithSenders(ctx, tx, s.blockReader, req)
+	if err != nil {
+		return nil, err
+	}
+	blockRlp, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return nil, err
+	}
+	sendersBytes := make([]byte, 20*len(senders))
+	for i, sender := range senders {
+		copy(sendersBytes[i*20:], sender[:])
+	}
+	return &remote.BlockReply{BlockRlp: blockRlp, Senders: sendersBytes}, nil
+}
+
+// EthServer is the rpcdaemon.Eth gRPC service
+type EthServer interface {
+	// BlockNumber returns the number of the latest executed block, like eth_blockNumber
+	BlockNumber(context.Context, *emptypb.Empty) (*wrapperspb.UInt64Value, error)
+	// Receipts returns the RLP of the receipts of the block, with their logs
+	Receipts(context.Context, *remote.BlockRequest) (*wrapperspb.BytesValue, error)
+}
+
+type ethServer struct {
+	db          kv.RoDB
+	blockReader services.FullBlockReader
+}
+
+func NewEthServer(db kv.RoDB, blockReader services.FullBlockReader) EthServer {
+	return &ethServer{db: db, blockReader: blockReader}
+}
+
+func (s *ethServer) BlockNumber(ctx context.Context, _ *emptypb.Empty) (*wrapperspb.UInt64Value, error) {
+	tx, err := s.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	blockNum, err := rpchelper.GetLatestBlockNumber(tx)
+	if err != nil {
+		return nil, err
+	}
+	return wrapperspb.UInt64(blockNum), nil
+}
+
+func (s *ethServer) Receipts(ctx context.Context, req *remote.BlockRequest) (*wrapperspb.BytesValue, error) {
+	tx, err := s.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	block, senders, err := blockWithSenders(ctx, tx, s.blockReader, req)
+	if err != nil {
+		return nil, err
+	}
+	receipts := rawdb.ReadReceipts(tx, block, senders)
+	if receipts == nil && len(block.Transactions()) > 0 {
+		return nil, status.Errorf(codes.NotFound, "receipts of block %d not found, they may be pruned", block.NumberU64())
+	}
+	if receipts == nil {
+		receipts = types.Receipts{}
+	}
+	receiptsRlp, err := rlp.EncodeToBytes(receipts)
+	if err != nil {
+		return nil, err
+	}
+	return wrapperspb.Bytes(receiptsRlp), nil
+}
+
+func blockWithSenders(ctx context.Context, tx kv.Tx, blockReader services.FullBlockReader, req *remote.BlockRequest) (*types.Block, []common.Address, error) {
+	hash := gointerfaces.ConvertH256ToHash(req.BlockHash)
+	if hash == (common.Hash{}) {
+		var err error
+		if hash, err = blockReader.CanonicalHash(ctx, tx, req.BlockHeight); err != nil {
+			return nil, nil, err
+		}
+	}
+	block, senders, err := blockReader.BlockWithSenders(ctx, tx, hash, req.BlockHeight)
+	if err != nil {
+		return nil, nil, err
+	}
+	if block == nil {
+		return nil, nil, status.Errorf(codes.NotFound, "block %d(%x) not found", req.BlockHeight, hash)
+	}
+	return block, senders, nil
+}
+
+// RegisterEthServer registers the rpcdaemon.Eth service on the server
+func RegisterEthServer(s *grpc.Server, srv EthServer) {
+	s.RegisterService(&ethServiceDesc, srv)
+}
+
+var ethServiceDesc = grpc.ServiceDesc{
+	ServiceName: "rpcdaemon.Eth",
+	HandlerType: (*EthServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "BlockNumber", Handler: ethBlockNumberHandler},
+		{MethodName: "Receipts", Handler: ethReceiptsHandler},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func ethBlockNumberHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EthServer).BlockNumber(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/rpcdaemon.Eth/BlockNumber"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EthServer).BlockNumber(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func ethReceiptsHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(remote.BlockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EthServer).Receipts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/rpcdaemon.Eth/Receipts"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EthServer).Receipts(ctx, req.(*remote.BlockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// EthClient is the client of the rpcdaemon.Eth service
+type EthClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEthClient(cc grpc.ClientConnInterface) *EthClient {
+	return &EthClient{cc: cc}
+}
+
+func (c *EthClient) BlockNumber(ctx context.Context, opts ...grpc.CallOption) (uint64, error) {
+	out := new(wrapperspb.UInt64Value)
+	if err := c.cc.Invoke(ctx, "/rpcdaemon.Eth/BlockNumber", &emptypb.Empty{}, out, opts...); err != nil {
+		return 0, err
+	}
+	return out.Value, nil
+}
+
+// Receipts returns the receipts of the block, without the fields derived from the block (see types.Receipts.DeriveFields)
+func (c *EthClient) Receipts(ctx context.Context, hash common.Hash, height uint64, opts ...grpc.CallOption) (types.Receipts, error) {
+	out := new(wrapperspb.BytesValue)
+	req := &remote.BlockRequest{BlockHash: gointerfaces.ConvertHashToH256(hash), BlockHeight: height}
+	if err := c.cc.Invoke(ctx, "/rpcdaemon.Eth/Receipts", req, out, opts...); err != nil {
+		return nil, err
+	}
+	var receipts types.Receipts
+	if err := rlp.DecodeBytes(out.Value, &receipts); err != nil {
+		return nil, fmt.Errorf("decoding receipts: %w", err)
+	}
+	return receipts, nil
+}
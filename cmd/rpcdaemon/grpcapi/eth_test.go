@@ -0,0 +1,74 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/rpcdaemontest"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestEthServices(t *testing.T) {
+	m, chain, _ := rpcdaemontest.CreateTestSentry(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := grpc.NewServer()
+	Register(ctx, server, m.DB, snapshotsync.NewBlockReader())
+	listener := bufconn.Listen(1024 * 1024)
+	go server.Serve(listener) //nolint:errcheck
+	defer server.Stop()
+	conn, err := grpc.DialContext(ctx, "", grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ethClient := NewEthClient(conn)
+	backendClient := remote.NewETHBACKENDClient(conn)
+
+	blockNum, err := ethClient.BlockNumber(ctx)
+	require.NoError(t, err)
+	last := chain.Blocks[len(chain.Blocks)-1]
+	require.Equal(t, last.NumberU64(), blockNum)
+
+	var txBlock *types.Block
+	for _, block := range chain.Blocks {
+		if len(block.Transactions()) > 0 {
+			txBlock = block
+			break
+		}
+	}
+	require.NotNil(t, txBlock)
+
+	// The canonical block of the height, without the hash
+	reply, err := backendClient.Block(ctx, &remote.BlockRequest{BlockHeight: txBlock.NumberU64()})
+	require.NoError(t, err)
+	block := new(types.Block)
+	require.NoError(t, rlp.DecodeBytes(reply.BlockRlp, block))
+	require.Equal(t, txBlock.Hash(), block.Hash())
+	require.Equal(t, 20*len(txBlock.Transactions()), len(reply.Senders))
+
+	lookup, err := backendClient.TxnLookup(ctx, &remote.TxnLookupRequest{TxnHash: gointerfaces.ConvertHashToH256(txBlock.Transactions()[0].Hash())})
+	require.NoError(t, err)
+	require.Equal(t, txBlock.NumberU64(), lookup.BlockNumber)
+
+	receipts, err := ethClient.Receipts(ctx, txBlock.Hash(), txBlock.NumberU64())
+	require.NoError(t, err)
+	require.Len(t, receipts, len(txBlock.Transactions()))
+	require.Equal(t, txBlock.ReceiptHash(), types.DeriveSha(receipts))
+
+	_, err = ethClient.Receipts(ctx, common.Hash{}, last.NumberU64()+1)
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
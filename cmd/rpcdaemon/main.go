@@ -6,8 +6,10 @@ import (
 	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/cli"
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/commands"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/grpcapi"
 	"github.com/ledgerwatch/log/v3"
 	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
 )
 
 func main() {
@@ -27,7 +29,13 @@ func main() {
 		}
 
 		apiList := commands.APIList(db, borDb, backend, txPool, mining, starknet, ff, stateCache, blockReader, agg, txNums, *cfg)
-		if err := cli.StartRpcServer(ctx, *cfg, apiList, nil); err != nil {
+		// The debug_db* commands are the only ones served on the authenticated port by the standalone daemon
+		authAPIList := commands.DebugDbAPIList(db, *cfg)
+		var grpcAPI func(*grpc.Server)
+		if cfg.GRPCEthEnabled {
+			grpcAPI = func(server *grpc.Server) { grpcapi.Register(ctx, server, db, blockReader) }
+		}
+		if err := cli.StartRpcServer(ctx, *cfg, apiList, authAPIList, grpcAPI); err != nil {
 			log.Error(err.Error())
 			return nil
 		}
@@ -82,6 +82,14 @@ func (api *PrivateDebugAPIImpl) StorageRangeAt(ctx context.Context, blockHash co
 		return h
 	}
 
+	if api._agg != nil && api._txNums != nil {
+		r := state.NewHistoryReader23(api._agg.MakeContext(), nil /* ReadIndices */)
+		r.SetTx(tx)
+		// +1 for the system transaction at the beginning of the block
+		r.SetTxNum(api._txNums.MinOf(block.NumberU64()) + 1 + txIndex)
+		return StorageRangeAt(r, contractAddress, keyStart, maxResult)
+	}
+
 	contractHasTEVM := func(contractHash common.Hash) (bool, error) { return false, nil }
 	if api.TevmEnabled {
 		contractHasTEVM = ethdb.GetHasTEVM(tx)
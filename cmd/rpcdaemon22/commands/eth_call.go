@@ -63,7 +63,11 @@ func (api *APIImpl) Call(ctx context.Context, args ethapi.CallArgs, blockNrOrHas
 		return nil, nil
 	}
 
-	result, err := transactions.DoCall(ctx, args, tx, blockNrOrHash, block, overrides, api.GasCap, chainConfig, api.filters, api.stateCache, contractHasTEVM, api._blockReader)
+	stateReader, err := rpchelper.CreateStateReader(ctx, tx, blockNrOrHash, api.filters, api.stateCache)
+	if err != nil {
+		return nil, err
+	}
+	result, err := transactions.DoCall(ctx, args, tx, blockNrOrHash, block, overrides, nil, transactions.CallBudget{GasCap: api.GasCap, Timeout: transactions.DefaultCallTimeout}, chainConfig, stateReader, contractHasTEVM, api._blockReader)
 	if err != nil {
 		return nil, err
 	}
@@ -227,8 +231,12 @@ func (api *APIImpl) EstimateGas(ctx context.Context, argsOrNil *ethapi.CallArgs,
 			return false, nil, nil
 		}
 
-		result, err := transactions.DoCall(ctx, args, dbtx, numOrHash, block, nil,
-			api.GasCap, chainConfig, api.filters, api.stateCache, contractHasTEVM, api._blockReader)
+		stateReader, err := rpchelper.CreateStateReader(ctx, dbtx, numOrHash, api.filters, api.stateCache)
+		if err != nil {
+			return false, nil, err
+		}
+		result, err := transactions.DoCall(ctx, args, dbtx, numOrHash, block, nil, nil,
+			transactions.CallBudget{GasCap: api.GasCap, Timeout: transactions.DefaultCallTimeout}, chainConfig, stateReader, contractHasTEVM, api._blockReader)
 		if err != nil {
 			if errors.Is(err, core.ErrIntrinsicGas) {
 				// Special case, raise gas limit
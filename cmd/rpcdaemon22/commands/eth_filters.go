@@ -2,6 +2,7 @@ package commands
 
 import (
 	"context"
+	"errors"
 
 	"github.com/ledgerwatch/erigon/common/debug"
 	"github.com/ledgerwatch/erigon/common/hexutil"
@@ -141,7 +142,7 @@ func (api *APIImpl) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
 			case h, ok := <-headers:
 				if h != nil {
 					err := notifier.Notify(rpcSub.ID, h)
-					if err != nil {
+					if err != nil && !errors.Is(err, rpc.ErrNotificationDropped) {
 						log.Warn("error while notifying subscription", "err", err)
 						return
 					}
@@ -183,7 +184,7 @@ func (api *APIImpl) NewPendingTransactions(ctx context.Context) (*rpc.Subscripti
 				for _, t := range txs {
 					if t != nil {
 						err := notifier.Notify(rpcSub.ID, t.Hash())
-						if err != nil {
+						if err != nil && !errors.Is(err, rpc.ErrNotificationDropped) {
 							log.Warn("error while notifying subscription", "err", err)
 							return
 						}
@@ -224,7 +225,7 @@ func (api *APIImpl) Logs(ctx context.Context, crit filters.FilterCriteria) (*rpc
 			case h, ok := <-logs:
 				if h != nil {
 					err := notifier.Notify(rpcSub.ID, h)
-					if err != nil {
+					if err != nil && !errors.Is(err, rpc.ErrNotificationDropped) {
 						log.Warn("error while notifying subscription", "err", err)
 						return
 					}
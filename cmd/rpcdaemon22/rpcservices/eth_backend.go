@@ -190,12 +190,18 @@ func (back *RemoteBackend) HeaderByNumber(ctx context.Context, tx kv.Getter, blo
 func (back *RemoteBackend) HeaderByHash(ctx context.Context, tx kv.Getter, hash common.Hash) (*types.Header, error) {
 	return back.blockReader.HeaderByHash(ctx, tx, hash)
 }
+func (back *RemoteBackend) HeaderRlp(ctx context.Context, tx kv.Getter, hash common.Hash, blockHeight uint64) (rlp.RawValue, error) {
+	return back.blockReader.HeaderRlp(ctx, tx, hash, blockHeight)
+}
 func (back *RemoteBackend) CanonicalHash(ctx context.Context, tx kv.Getter, blockHeight uint64) (common.Hash, error) {
 	return back.blockReader.CanonicalHash(ctx, tx, blockHeight)
 }
 func (back *RemoteBackend) TxnByIdxInBlock(ctx context.Context, tx kv.Getter, blockNum uint64, i int) (types.Transaction, error) {
 	return back.blockReader.TxnByIdxInBlock(ctx, tx, blockNum, i)
 }
+func (back *RemoteBackend) RawReceipts(ctx context.Context, tx kv.Tx, blockHeight uint64) (types.Receipts, error) {
+	return back.blockReader.RawReceipts(ctx, tx, blockHeight)
+}
 
 func (back *RemoteBackend) EngineNewPayloadV1(ctx context.Context, payload *types2.ExecutionPayload) (res *remote.EnginePayloadStatus, err error) {
 	return back.remoteEthBackend.EngineNewPayloadV1(ctx, payload)
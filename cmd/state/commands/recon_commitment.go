@@ -0,0 +1,176 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/aggregator"
+	"github.com/ledgerwatch/erigon-lib/commitment"
+	"github.com/ledgerwatch/erigon-lib/common/length"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	kv2 "github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// reconCommitmentBatch is the number of updates after which the commitment aggregator finishes its transaction
+const reconCommitmentBatch = 100_000
+
+// reconCommitment computes the commitment of the reconstituted state incrementally, as the final values are
+// produced, using the same aggregator as erigon2 command. It implements state.StateWriter, and serialises
+// the writes coming from the workers
+type reconCommitment struct {
+	lock    sync.Mutex
+	dir     string
+	db      kv.RwDB
+	rwTx    kv.RwTx
+	agg     *aggregator.Aggregator
+	w       *aggregator.Writer
+	ww      *WriterWrapper
+	batch   uint64 // sequence number of the current batch of updates, used as the block number for the aggregator
+	updates int
+}
+
+func newReconCommitment(dir string, logger log.Logger) (*reconCommitment, error) {
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	rc := &reconCommitment{dir: dir}
+	var err error
+	if rc.db, err = kv2.NewMDBX(logger).Path(dir).WriteMap().Open(); err != nil {
+		return nil, err
+	}
+	if rc.rwTx, err = rc.db.BeginRw(context.Background()); err != nil {
+		rc.db.Close()
+		return nil, err
+	}
+	trie := commitment.InitializeTrie(commitment.VariantHexPatriciaTrie)
+	if rc.agg, err = aggregator.NewAggregator(dir, unwindLimit, aggregationStep, false /* changesets */, true /* commitments */, 100_000_000, trie, rc.rwTx); err != nil {
+		rc.rwTx.Rollback()
+		rc.db.Close()
+		return nil, fmt.Errorf("create commitment aggregator: %w", err)
+	}
+	rc.w = rc.agg.MakeStateWriter(false /* beforeOn */)
+	if err = rc.w.Reset(rc.batch, rc.rwTx); err != nil {
+		rc.Close()
+		return nil, err
+	}
+	rc.ww = &WriterWrapper{w: rc.w}
+	return rc, nil
+}
+
+// finishBatch must be called with the lock held
+func (rc *reconCommitment) finishBatch() error {
+	if err := rc.w.FinishTx(rc.batch, false /* trace */); err != nil {
+		return err
+	}
+	if err := rc.w.Aggregate(false /* trace */); err != nil {
+		return err
+	}
+	rc.batch++
+	rc.updates = 0
+	rc.ww.blockNum = rc.batch
+	return rc.w.Reset(rc.batch, rc.rwTx)
+}
+
+// updated must be called with the lock held, after each update
+func (rc *reconCommitment) updated() error {
+	rc.updates++
+	if rc.updates < reconCommitmentBatch {
+		return nil
+	}
+	return rc.finishBatch()
+}
+
+func (rc *reconCommitment) UpdateAccountData(address common.Address, original, account *accounts.Account) error {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	if err := rc.ww.UpdateAccountData(address, original, account); err != nil {
+		return err
+	}
+	return rc.updated()
+}
+
+func (rc *reconCommitment) UpdateAccountCode(address common.Address, incarnation uint64, codeHash common.Hash, code []byte) error {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	if err := rc.ww.UpdateAccountCode(address, incarnation, codeHash, code); err != nil {
+		return err
+	}
+	return rc.updated()
+}
+
+func (rc *reconCommitment) DeleteAccount(address common.Address, original *accounts.Account) error {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	if err := rc.ww.DeleteAccount(address, original); err != nil {
+		return err
+	}
+	return rc.updated()
+}
+
+func (rc *reconCommitment) WriteAccountStorage(address common.Address, incarnation uint64, key *common.Hash, original, value *uint256.Int) error {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	if err := rc.ww.WriteAccountStorage(address, incarnation, key, original, value); err != nil {
+		return err
+	}
+	return rc.updated()
+}
+
+func (rc *reconCommitment) CreateContract(address common.Address) error {
+	return nil
+}
+
+// UpdatePlainState feeds an entry of the plain state that has not been produced by the replay, but filled
+// from the history files
+func (rc *reconCommitment) UpdatePlainState(k, v []byte) error {
+	switch len(k) {
+	case length.Addr:
+		var a accounts.Account
+		if err := a.DecodeForStorage(v); err != nil {
+			return err
+		}
+		return rc.UpdateAccountData(common.BytesToAddress(k), nil, &a)
+	case length.Addr + length.Incarnation + length.Hash:
+		location := common.BytesToHash(k[length.Addr+length.Incarnation:])
+		var value uint256.Int
+		value.SetBytes(v)
+		return rc.WriteAccountStorage(common.BytesToAddress(k[:length.Addr]), state.FirstContractIncarnation, &location, nil, &value)
+	}
+	return nil
+}
+
+// RootHash finishes the current batch and returns the commitment of all updates so far
+func (rc *reconCommitment) RootHash() ([]byte, error) {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	if err := rc.w.FinishTx(rc.batch, false /* trace */); err != nil {
+		return nil, err
+	}
+	rootHash, err := rc.w.ComputeCommitment(false /* trace */)
+	if err != nil {
+		return nil, err
+	}
+	if err = rc.w.Aggregate(false /* trace */); err != nil {
+		return nil, err
+	}
+	return rootHash, nil
+}
+
+func (rc *reconCommitment) Close() {
+	if rc.agg != nil {
+		rc.agg.Close()
+	}
+	rc.rwTx.Rollback()
+	rc.db.Close()
+	os.RemoveAll(rc.dir)
+}
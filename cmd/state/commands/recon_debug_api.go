@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// ReconDebugAPI exposes diagnostics of running state reconstitution over JSON-RPC
+type ReconDebugAPI struct {
+	rs *state.ReconState
+}
+
+// ReconConflicts implements debug_reconConflicts. Returns top contracts, storage slots and
+// dependency txNums that caused most rollbacks so far
+func (api *ReconDebugAPI) ReconConflicts(_ context.Context, limit *int) (*state.ReconConflictReport, error) {
+	n := 20
+	if limit != nil && *limit > 0 {
+		n = *limit
+	}
+	return api.rs.ConflictReport(n), nil
+}
+
+// startReconDebugServer serves ReconDebugAPI on given address, until the returned server is closed
+func startReconDebugServer(addr string, rs *state.ReconState) (*http.Server, error) {
+	srv := rpc.NewServer(1, false /* traceRequests */, true)
+	if err := srv.RegisterName("debug", &ReconDebugAPI{rs: rs}); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	httpSrv := &http.Server{Handler: srv}
+	go func() {
+		if err := httpSrv.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Warn("Recon debug server stopped", "err", err)
+		}
+	}()
+	log.Info("Recon debug server started", "addr", listener.Addr())
+	return httpSrv, nil
+}
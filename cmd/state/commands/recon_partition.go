@@ -0,0 +1,314 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// Distributed reconstitution: every worker machine, with its own copy of the history files and block snapshots,
+// runs `recon --partition i/n --run <file>`. It replays only the transactions of its partition (and, on demand,
+// those they depend on), and writes what its partition produced into a sorted run. The coordinator then runs
+// `recon --runs <file1>,<file2>,...` to merge the runs into recondb instead of replaying, and completes the
+// reconstitution as usual. Runs are sorted because recon tables are keyed by txNum first, and partitions
+// do not overlap, so the merge is a concatenation in the order of partitions
+
+// reconRunTables are the recon tables shipped in runs, in the order they are written
+var reconRunTables = []string{kv.PlainStateR, kv.CodeR, kv.PlainContractR}
+
+const reconRunMagic = "RECONRUN1"
+
+// reconRunHeader identifies the part of the reconstitution contained in a run
+type reconRunHeader struct {
+	Block        uint64
+	FromTxNum    uint64 // inclusive
+	ToTxNum      uint64 // exclusive
+	Partition    int
+	Partitions   int
+	PlannedTxs   uint64 // cardinality of the whole plan, for the coordinator to check that all runs agree
+	PartitionTxs uint64 // cardinality of the plan within the partition
+}
+
+// parseReconPartition parses "i/n", where 0 <= i < n
+func parseReconPartition(s string) (int, int, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("partition %q is not in the form i/n", s)
+	}
+	i, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("partition %q: %w", s, err)
+	}
+	n, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("partition %q: %w", s, err)
+	}
+	if n <= 0 || i < 0 || i >= n {
+		return 0, 0, fmt.Errorf("partition %q is out of range", s)
+	}
+	return i, n, nil
+}
+
+// reconPartitionRange splits the txNums [0, endTxNum) into n ranges with (roughly) the same number of planned
+// transactions each, and returns the range of partition i
+func reconPartitionRange(plan *roaring64.Bitmap, i, n int, endTxNum uint64) (uint64, uint64, error) {
+	count := plan.GetCardinality()
+	bound := func(j int) (uint64, error) {
+		switch {
+		case j == 0:
+			return 0, nil
+		case j == n:
+			return endTxNum, nil
+		}
+		rank := count * uint64(j) / uint64(n)
+		if rank >= count {
+			return endTxNum, nil
+		}
+		return plan.Select(rank)
+	}
+	from, err := bound(i)
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := bound(i + 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	return from, to, nil
+}
+
+func writeReconRunUvarint(w *bufio.Writer, x uint64) error {
+	var buf [binary.MaxVarintLen64]byte
+	_, err := w.Write(buf[:binary.PutUvarint(buf[:], x)])
+	return err
+}
+
+func writeReconRunBytes(w *bufio.Writer, b []byte) error {
+	if err := writeReconRunUvarint(w, uint64(len(b))); err != nil {
+		return err
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// writeReconRun writes the entries of recon tables produced by txNums of the partition into the run file.
+// Layout: magic, header fields as uvarints, then for each table: number of entries and the entries as
+// length-prefixed keys and values
+func writeReconRun(ctx context.Context, db kv.RoDB, fileName string, h reconRunHeader) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriterSize(f, 1024*1024)
+	if _, err = w.WriteString(reconRunMagic); err != nil {
+		return err
+	}
+	for _, x := range []uint64{h.Block, h.FromTxNum, h.ToTxNum, uint64(h.Partition), uint64(h.Partitions), h.PlannedTxs, h.PartitionTxs} {
+		if err = writeReconRunUvarint(w, x); err != nil {
+			return err
+		}
+	}
+	var fromKey [8]byte
+	binary.BigEndian.PutUint64(fromKey[:], h.FromTxNum)
+	if err = db.View(ctx, func(tx kv.Tx) error {
+		for _, table := range reconRunTables {
+			// Count first, so that the reader knows where the table ends
+			var count uint64
+			if err := reconRunForEach(tx, table, fromKey[:], h.ToTxNum, func(k, v []byte) error {
+				count++
+				return nil
+			}); err != nil {
+				return err
+			}
+			if err := writeReconRunUvarint(w, count); err != nil {
+				return err
+			}
+			if err := reconRunForEach(tx, table, fromKey[:], h.ToTxNum, func(k, v []byte) error {
+				if err := writeReconRunBytes(w, k); err != nil {
+					return err
+				}
+				return writeReconRunBytes(w, v)
+			}); err != nil {
+				return err
+			}
+			log.Info("Written to run", "table", table, "entries", count)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// reconRunForEach visits the entries of a recon table with txNums in [fromKey, toTxNum)
+func reconRunForEach(tx kv.Tx, table string, fromKey []byte, toTxNum uint64, walker func(k, v []byte) error) error {
+	cursor, err := tx.Cursor(table)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close()
+	var k, v []byte
+	for k, v, err = cursor.Seek(fromKey); err == nil && k != nil; k, v, err = cursor.Next() {
+		if binary.BigEndian.Uint64(k) >= toTxNum {
+			break
+		}
+		if err = walker(k, v); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+type reconRunReader struct {
+	fileName string
+	f        *os.File
+	r        *bufio.Reader
+	header   reconRunHeader
+}
+
+func openReconRun(fileName string) (*reconRunReader, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	rr := &reconRunReader{fileName: fileName, f: f, r: bufio.NewReaderSize(f, 1024*1024)}
+	magic := make([]byte, len(reconRunMagic))
+	if _, err = io.ReadFull(rr.r, magic); err != nil || string(magic) != reconRunMagic {
+		f.Close()
+		return nil, fmt.Errorf("%s is not a recon run", fileName)
+	}
+	var fields [7]uint64
+	for i := range fields {
+		if fields[i], err = binary.ReadUvarint(rr.r); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("reading header of %s: %w", fileName, err)
+		}
+	}
+	rr.header = reconRunHeader{
+		Block:        fields[0],
+		FromTxNum:    fields[1],
+		ToTxNum:      fields[2],
+		Partition:    int(fields[3]),
+		Partitions:   int(fields[4]),
+		PlannedTxs:   fields[5],
+		PartitionTxs: fields[6],
+	}
+	return rr, nil
+}
+
+func (rr *reconRunReader) readBytes() ([]byte, error) {
+	l, err := binary.ReadUvarint(rr.r)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, l)
+	if _, err = io.ReadFull(rr.r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// appendTo appends all entries of the run to the recon tables. Entries of every table need to be greater
+// than the ones already there, which holds when runs are appended in the order of partitions
+func (rr *reconRunReader) appendTo(rwTx kv.RwTx) error {
+	for _, table := range reconRunTables {
+		count, err := binary.ReadUvarint(rr.r)
+		if err != nil {
+			return err
+		}
+		c, err := rwTx.RwCursor(table)
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i < count; i++ {
+			k, err := rr.readBytes()
+			if err != nil {
+				c.Close()
+				return err
+			}
+			v, err := rr.readBytes()
+			if err != nil {
+				c.Close()
+				return err
+			}
+			if err = c.Append(k, v); err != nil {
+				c.Close()
+				return fmt.Errorf("appending %s from %s: %w", table, rr.fileName, err)
+			}
+		}
+		c.Close()
+	}
+	return nil
+}
+
+func (rr *reconRunReader) Close() {
+	rr.f.Close()
+}
+
+// mergeReconRuns checks that the runs together cover all txNums up to endTxNum of the block, without
+// gaps and overlaps, and appends them to the recon tables of db
+func mergeReconRuns(ctx context.Context, db kv.RwDB, fileNames []string, block, endTxNum uint64) error {
+	runs := make([]*reconRunReader, 0, len(fileNames))
+	defer func() {
+		for _, rr := range runs {
+			rr.Close()
+		}
+	}()
+	for _, fileName := range fileNames {
+		rr, err := openReconRun(fileName)
+		if err != nil {
+			return err
+		}
+		runs = append(runs, rr)
+		if rr.header.Block != block {
+			return fmt.Errorf("run %s is for block %d, but block %d is requested", fileName, rr.header.Block, block)
+		}
+	}
+	if len(runs) == 0 {
+		return errors.New("no runs to merge")
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].header.FromTxNum < runs[j].header.FromTxNum })
+	var next uint64
+	for _, rr := range runs {
+		if rr.header.FromTxNum != next {
+			return fmt.Errorf("runs do not cover txNums [%d, %d)", next, rr.header.FromTxNum)
+		}
+		if rr.header.PlannedTxs != runs[0].header.PlannedTxs || rr.header.Partitions != runs[0].header.Partitions {
+			return fmt.Errorf("run %s was planned differently from %s", rr.fileName, runs[0].fileName)
+		}
+		next = rr.header.ToTxNum
+	}
+	if next != endTxNum {
+		return fmt.Errorf("runs do not cover txNums [%d, %d)", next, endTxNum)
+	}
+	return db.Update(ctx, func(rwTx kv.RwTx) error {
+		for _, table := range reconRunTables {
+			if err := rwTx.ClearBucket(table); err != nil {
+				return err
+			}
+		}
+		for _, rr := range runs {
+			// Tables are stored one after another in each run, so each run is appended as a whole
+			if err := rr.appendTo(rwTx); err != nil {
+				return err
+			}
+			log.Info("Merged run", "file", rr.fileName, "partition", fmt.Sprintf("%d/%d", rr.header.Partition, rr.header.Partitions), "from txNum", rr.header.FromTxNum, "to txNum", rr.header.ToTxNum)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,135 @@
+package commands
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
+	"github.com/ledgerwatch/log/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ReconProgress is a snapshot of the progress of state reconstitution
+type ReconProgress struct {
+	Time          time.Time
+	Done          uint64  // number of replayed transactions
+	Total         uint64  // number of transactions to replay
+	Rollbacks     uint64  // number of rollbacks so far
+	RollbackRatio float64 // rollbacks per replayed transaction since the previous snapshot, in percent
+	TxPerSecond   float64
+	ETA           time.Duration // estimated time until all transactions are replayed, 0 if unknown
+	FlushSize     uint64        // estimated size of the changes accumulated since the last flush
+}
+
+func (p *ReconProgress) toStruct() (*structpb.Struct, error) {
+	return structpb.NewStruct(map[string]interface{}{
+		"time":          p.Time.Unix(),
+		"done":          p.Done,
+		"total":         p.Total,
+		"rollbacks":     p.Rollbacks,
+		"rollbackRatio": p.RollbackRatio,
+		"txPerSecond":   p.TxPerSecond,
+		"etaSeconds":    p.ETA.Seconds(),
+		"flushSize":     p.FlushSize,
+	})
+}
+
+// reconProgressFeed keeps the latest progress snapshot and wakes up the streams waiting for the next one
+type reconProgressFeed struct {
+	lock    sync.Mutex
+	latest  *ReconProgress
+	updated chan struct{} // closed and replaced on every update
+}
+
+func newReconProgressFeed() *reconProgressFeed {
+	return &reconProgressFeed{updated: make(chan struct{})}
+}
+
+func (f *reconProgressFeed) update(p ReconProgress) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.latest = &p
+	close(f.updated)
+	f.updated = make(chan struct{})
+}
+
+// next returns the latest snapshot, if it is different from prev, otherwise the channel to wait on
+func (f *reconProgressFeed) next(prev *ReconProgress) (*ReconProgress, <-chan struct{}) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.latest != nil && f.latest != prev {
+		return f.latest, nil
+	}
+	return nil, f.updated
+}
+
+// reconProgressServiceDesc describes the streaming service by hand, so that it does not need generated code.
+// Messages are well-known protobuf types, google.protobuf.Empty and google.protobuf.Struct, with the fields
+// of ReconProgress, so any gRPC client can consume the stream
+var reconProgressServiceDesc = grpc.ServiceDesc{
+	ServiceName: "recon.ReconProgress",
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			ServerStreams: true,
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				if err := stream.RecvMsg(&emptypb.Empty{}); err != nil {
+					return err
+				}
+				return srv.(*reconProgressFeed).subscribe(stream)
+			},
+		},
+	},
+	Metadata: "recon_progress",
+}
+
+// subscribe sends the latest snapshot, and then every new one, until the client goes away
+func (f *reconProgressFeed) subscribe(stream grpc.ServerStream) error {
+	var prev *ReconProgress
+	for {
+		p, wait := f.next(prev)
+		if p == nil {
+			select {
+			case <-wait:
+				continue
+			case <-stream.Context().Done():
+				return stream.Context().Err()
+			}
+		}
+		msg, err := p.toStruct()
+		if err != nil {
+			return err
+		}
+		if err = stream.SendMsg(msg); err != nil {
+			return err
+		}
+		prev = p
+	}
+}
+
+// startReconProgressServer serves the progress stream on given address, until the returned server is stopped
+func startReconProgressServer(ctx context.Context, addr string, feed *reconProgressFeed) (*grpc.Server, error) {
+	var lc net.ListenConfig
+	lis, err := lc.Listen(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	grpcServer := grpc.NewServer(
+		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(grpc_recovery.StreamServerInterceptor())),
+		grpc.MaxConcurrentStreams(100),
+	)
+	grpcServer.RegisterService(&reconProgressServiceDesc, feed)
+	go func() {
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Warn("Recon progress server stopped", "err", err)
+		}
+	}()
+	log.Info("Recon progress server started", "addr", lis.Addr())
+	return grpcServer, nil
+}
@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// reconVerifyLogLimit is the maximum number of mismatching entries logged per table
+const reconVerifyLogLimit = 100
+
+// verifyRecon compares the reconstituted plain state, code and contract code in db with the same tables of
+// trusted database, synced to the same block. Returns the number of mismatching entries
+func verifyRecon(ctx context.Context, db, trustedDb kv.RoDB, block uint64) (uint64, error) {
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	trustedTx, err := trustedDb.BeginRo(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer trustedTx.Rollback()
+	trustedBlock, err := stages.GetStageProgress(trustedTx, stages.Execution)
+	if err != nil {
+		return 0, err
+	}
+	if trustedBlock != block {
+		return 0, fmt.Errorf("trusted database is executed up to block %d, but reconstitution is for block %d", trustedBlock, block)
+	}
+	var mismatches uint64
+	for _, table := range []string{kv.PlainState, kv.Code, kv.PlainContractCode} {
+		var normalise func(k, v []byte) ([]byte, []byte, error)
+		switch table {
+		case kv.PlainState:
+			normalise = normaliseReconPlainState
+		case kv.PlainContractCode:
+			normalise = normaliseReconContractCode
+		}
+		count, err := verifyReconTable(tx, trustedTx, table, normalise)
+		if err != nil {
+			return 0, err
+		}
+		log.Info("Verified reconstituted table", "table", table, "mismatches", count)
+		mismatches += count
+	}
+	return mismatches, nil
+}
+
+// verifyReconTable walks the table in both transactions side by side. normalise, if not nil, is applied to
+// the trusted entries, so that they are comparable with the reconstituted ones
+func verifyReconTable(tx, trustedTx kv.Tx, table string, normalise func(k, v []byte) ([]byte, []byte, error)) (uint64, error) {
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+	trustedC, err := trustedTx.Cursor(table)
+	if err != nil {
+		return 0, err
+	}
+	defer trustedC.Close()
+	trustedNext := func(k, v []byte, err error) ([]byte, []byte, error) {
+		if err != nil || k == nil || normalise == nil {
+			return k, v, err
+		}
+		return normalise(k, v)
+	}
+	var mismatches uint64
+	report := func(k, v, trustedV []byte) {
+		mismatches++
+		if mismatches <= reconVerifyLogLimit {
+			log.Warn("Reconstituted state mismatch", "table", table, "key", fmt.Sprintf("%x", k), "reconstituted", fmt.Sprintf("%x", v), "trusted", fmt.Sprintf("%x", trustedV))
+		}
+	}
+	k, v, err := c.First()
+	if err != nil {
+		return 0, err
+	}
+	trustedK, trustedV, err := trustedNext(trustedC.First())
+	if err != nil {
+		return 0, err
+	}
+	for k != nil || trustedK != nil {
+		switch cmp := bytes.Compare(k, trustedK); {
+		case trustedK == nil || (k != nil && cmp < 0):
+			// Present only in the reconstituted state
+			report(k, v, nil)
+			if k, v, err = c.Next(); err != nil {
+				return 0, err
+			}
+		case k == nil || cmp > 0:
+			// Missing from the reconstituted state
+			report(trustedK, nil, trustedV)
+			if trustedK, trustedV, err = trustedNext(trustedC.Next()); err != nil {
+				return 0, err
+			}
+		default:
+			if !bytes.Equal(v, trustedV) {
+				report(k, v, trustedV)
+			}
+			if k, v, err = c.Next(); err != nil {
+				return 0, err
+			}
+			if trustedK, trustedV, err = trustedNext(trustedC.Next()); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return mismatches, nil
+}
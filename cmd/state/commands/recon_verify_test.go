@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyReconTable(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	_, trustedTx := memdb.NewTestTx(t)
+	contract := common.Address{1}
+	storageKey := func(incarnation uint64, slot byte) []byte {
+		return dbutils.PlainGenerateCompositeStorageKey(contract[:], incarnation, common.Hash{slot}.Bytes())
+	}
+	count := func() uint64 {
+		count, err := verifyReconTable(tx, trustedTx, kv.PlainState, normaliseReconPlainState)
+		require.NoError(t, err)
+		return count
+	}
+	require.Zero(t, count())
+
+	// Trusted database has the contract at its second incarnation
+	require.NoError(t, trustedTx.Put(kv.PlainState, contract[:], encodeReconTestAccount(2)))
+	require.NoError(t, trustedTx.Put(kv.PlainState, storageKey(2, 1), []byte{1}))
+	require.NoError(t, trustedTx.Put(kv.PlainState, storageKey(2, 2), []byte{2}))
+	require.NoError(t, tx.Put(kv.PlainState, contract[:], encodeReconTestAccount(state.FirstContractIncarnation)))
+	require.NoError(t, tx.Put(kv.PlainState, storageKey(state.FirstContractIncarnation, 1), []byte{1}))
+	require.NoError(t, tx.Put(kv.PlainState, storageKey(state.FirstContractIncarnation, 2), []byte{2}))
+	require.Zero(t, count())
+
+	// Missing key
+	require.NoError(t, tx.Delete(kv.PlainState, storageKey(state.FirstContractIncarnation, 1)))
+	require.Equal(t, uint64(1), count())
+	// Extra key, which is the last one in the table
+	require.NoError(t, tx.Put(kv.PlainState, storageKey(state.FirstContractIncarnation, 3), []byte{3}))
+	require.Equal(t, uint64(2), count())
+	// Differing value
+	require.NoError(t, tx.Put(kv.PlainState, storageKey(state.FirstContractIncarnation, 2), []byte{4}))
+	require.Equal(t, uint64(3), count())
+	// Extra key, which is the first one in the table
+	require.NoError(t, tx.Put(kv.PlainState, common.Address{}.Bytes(), encodeReconTestAccount(0)))
+	require.Equal(t, uint64(4), count())
+}
+
+func TestVerifyRecon(t *testing.T) {
+	db, trustedDb := memdb.NewTestDB(t), memdb.NewTestDB(t)
+	ctx := context.Background()
+	require.NoError(t, trustedDb.Update(ctx, func(tx kv.RwTx) error {
+		if err := stages.SaveStageProgress(tx, stages.Execution, 10); err != nil {
+			return err
+		}
+		return tx.Put(kv.Code, common.Hash{1}.Bytes(), []byte{1})
+	}))
+	_, err := verifyRecon(ctx, db, trustedDb, 11)
+	require.Error(t, err)
+	mismatches, err := verifyRecon(ctx, db, trustedDb, 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), mismatches)
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		return tx.Put(kv.Code, common.Hash{1}.Bytes(), []byte{1})
+	}))
+	mismatches, err = verifyRecon(ctx, db, trustedDb, 10)
+	require.NoError(t, err)
+	require.Zero(t, mismatches)
+}
@@ -112,15 +112,15 @@ func ReplayTx(genesis *core.Genesis) error {
 	defer agg.Close()
 	ac := agg.MakeContext()
 	workCh := make(chan *state.TxTask)
-	rs := state.NewReconState(workCh)
-	if err = replayTxNum(ctx, allSnapshots, blockReader, txNum, txNums, rs, ac); err != nil {
+	rs := state.NewReconState(workCh, state.DefaultReconSchedulerCfg)
+	if err = replayTxNum(ctx, allSnapshots, blockReader, txNum, txNums, rs, ac, agg.Accounts().InvertedIndex.MakeContext()); err != nil {
 		return err
 	}
 	return nil
 }
 
 func replayTxNum(ctx context.Context, allSnapshots *snapshotsync.RoSnapshots, blockReader services.FullBlockReader,
-	txNum uint64, txNums []uint64, rs *state.ReconState, ac *libstate.Aggregator22Context,
+	txNum uint64, txNums []uint64, rs *state.ReconState, ac *libstate.Aggregator22Context, accountsIdx *libstate.InvertedIndexContext,
 ) error {
 	bn := uint64(sort.Search(len(txNums), func(i int) bool {
 		return txNums[i] > txNum
@@ -139,7 +139,7 @@ func replayTxNum(ctx context.Context, allSnapshots *snapshotsync.RoSnapshots, bl
 	}
 	txn := b.Transactions()[txIndex]
 	stateWriter := state.NewStateReconWriter(ac, rs)
-	stateReader := state.NewHistoryReaderNoState(ac, rs)
+	stateReader := state.NewHistoryReaderNoState(ac, accountsIdx, rs)
 	stateReader.SetTxNum(txNum)
 	stateWriter.SetTxNum(txNum)
 	noop := state.NewNoopWriter()
@@ -180,7 +180,7 @@ func replayTxNum(ctx context.Context, allSnapshots *snapshotsync.RoSnapshots, bl
 		}
 		if dependency, ok := stateReader.ReadError(); ok {
 			fmt.Printf("dependency %d on %d\n", txNum, dependency)
-			if err = replayTxNum(ctx, allSnapshots, blockReader, dependency, txNums, rs, ac); err != nil {
+			if err = replayTxNum(ctx, allSnapshots, blockReader, dependency, txNums, rs, ac, accountsIdx); err != nil {
 				return err
 			}
 		} else {
@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
 	"errors"
@@ -11,13 +12,16 @@ import (
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/c2h5oh/datasize"
 	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/length"
 	"github.com/ledgerwatch/erigon-lib/etl"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	kv2 "github.com/ledgerwatch/erigon-lib/kv/mdbx"
@@ -29,6 +33,7 @@ import (
 	"github.com/ledgerwatch/erigon/consensus"
 	"github.com/ledgerwatch/erigon/consensus/misc"
 	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/core/state"
 	"github.com/ledgerwatch/erigon/core/systemcontracts"
 	"github.com/ledgerwatch/erigon/core/types"
@@ -44,11 +49,50 @@ import (
 	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
 	stages2 "github.com/ledgerwatch/erigon/turbo/stages"
 	"github.com/ledgerwatch/log/v3"
+	"github.com/ledgerwatch/secp256k1"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/semaphore"
 )
 
+var (
+	reconMemBudget  string
+	reconSchedCfg   state.ReconSchedulerCfg
+	reconResume     bool
+	reconDeps       bool
+	reconParFlush   bool
+	reconConflicts  bool
+	reconDebugAddr  string
+	reconVerify     string
+	reconFromTxNum  uint64
+	reconETL        bool
+	reconCommitRoot bool
+	reconGrpcAddr   string
+	reconPartition  string
+	reconRun        string
+	reconRuns       []string
+	reconBlocks     bool
+)
+
 func init() {
+	reconCmd.Flags().StringVar(&reconMemBudget, "membudget", "", "memory budget for accumulated changes, after which they are spilled into temporary database (e.g. 4GB), no spilling if empty")
+	reconCmd.Flags().IntVar(&reconSchedCfg.QueueDepth, "queuedepth", state.DefaultReconSchedulerCfg.QueueDepth, "maximum number of transactions queued for the workers")
+	reconCmd.Flags().IntVar(&reconSchedCfg.PrefetchBatch, "prefetch", state.DefaultReconSchedulerCfg.PrefetchBatch, "maximum number of transactions fetched into the queue at once")
+	reconCmd.Flags().BoolVar(&reconDeps, "deps", false, "before the replay, predict the dependencies of transactions from the history and the trace indices, and schedule transactions after their dependencies, to avoid rollbacks")
+	reconCmd.Flags().BoolVar(&reconParFlush, "parallelflush", false, "flush accumulated changes without stopping the workers")
+	reconCmd.Flags().BoolVar(&reconConflicts, "conflicts", false, "track and periodically log contracts and storage slots causing most rollbacks")
+	reconCmd.Flags().StringVar(&reconDebugAddr, "debug.addr", "", "address to serve debug_reconConflicts JSON-RPC method on (e.g. localhost:8548), implies --conflicts")
+	reconCmd.Flags().BoolVar(&reconResume, "resume", false, "resume reconstitution from the last checkpoint in recondb, if it exists")
+	reconCmd.Flags().Uint64Var(&reconSchedCfg.GasWindow, "gaswindow", 0, "if non-zero, schedule the heaviest (by gas used) transaction within this many txNums from the lowest one first")
+	reconCmd.Flags().StringVar(&reconVerify, "verify", "", "path to chaindata of a trusted node synced to the same block, to compare the reconstituted state with")
+	reconCmd.Flags().Uint64Var(&reconFromTxNum, "fromtxnum", 0, "if non-zero, reconstitute only the state modified from this txNum up to the block, into separate tables of recondb")
+	reconCmd.Flags().BoolVar(&reconETL, "etl", false, "keep accumulated changes in arenas and sort them with etl collectors on flush, instead of btrees; not compatible with --membudget and --parallelflush")
+	reconCmd.Flags().StringVar(&reconPartition, "partition", "", "i/n to replay only the i-th of n partitions of transactions (by txNum ranges) and write the result into --run, for distributed reconstitution")
+	reconCmd.Flags().StringVar(&reconRun, "run", "", "file to write the result of replaying the partition into")
+	reconCmd.Flags().StringSliceVar(&reconRuns, "runs", nil, "files written by the partitions, to merge instead of replaying the transactions")
+	reconCmd.Flags().BoolVar(&reconBlocks, "blocks", false, "schedule planned transactions of each block together, to be executed in order by one worker, while blocks are executed concurrently")
+	reconCmd.Flags().StringVar(&reconGrpcAddr, "grpc.addr", "", "address to serve gRPC stream of reconstitution progress on (e.g. localhost:9093)")
+	reconCmd.Flags().BoolVar(&reconCommitRoot, "commitment", false, "compute the state root incrementally with the commitment aggregator, as the final values are produced, instead of the intermediate hashes stage")
+	reconCmd.Flags().IntVar(&reconSchedCfg.LowWatermark, "lowwatermark", state.DefaultReconSchedulerCfg.LowWatermark, "queue is refilled when it has fewer transactions than this")
 	withBlock(reconCmd)
 	withChain(reconCmd)
 	withDataDir(reconCmd)
@@ -72,6 +116,8 @@ type ReconWorker struct {
 	allSnapshots *snapshotsync.RoSnapshots
 	stateWriter  *state.StateReconWriter
 	stateReader  *state.HistoryReaderNoState
+	timedReader  *state.TimedStateReader
+	cryptoCtx    *secp256k1.Context // for recovery of the senders not recovered by the Senders stage
 	getHeader    func(hash common.Hash, number uint64) *types.Header
 	ctx          context.Context
 	engine       consensus.Engine
@@ -84,7 +130,7 @@ type ReconWorker struct {
 	posa         consensus.PoSA
 }
 
-func NewReconWorker(lock sync.Locker, wg *sync.WaitGroup, rs *state.ReconState,
+func NewReconWorker(ctx context.Context, lock sync.Locker, wg *sync.WaitGroup, rs *state.ReconState,
 	a *libstate.Aggregator22, blockReader services.FullBlockReader, allSnapshots *snapshotsync.RoSnapshots,
 	chainConfig *params.ChainConfig, logger log.Logger, genesis *core.Genesis, engine consensus.Engine,
 	chainTx kv.Tx,
@@ -96,14 +142,16 @@ func NewReconWorker(lock sync.Locker, wg *sync.WaitGroup, rs *state.ReconState,
 		rs:           rs,
 		blockReader:  blockReader,
 		allSnapshots: allSnapshots,
-		ctx:          context.Background(),
+		ctx:          ctx,
 		stateWriter:  state.NewStateReconWriter(ac, rs),
-		stateReader:  state.NewHistoryReaderNoState(ac, rs),
+		stateReader:  state.NewHistoryReaderNoState(ac, a.Accounts().InvertedIndex.MakeContext(), rs),
 		chainConfig:  chainConfig,
 		logger:       logger,
 		genesis:      genesis,
 		engine:       engine,
 	}
+	rw.timedReader = state.NewTimedStateReader(rw.stateReader)
+	rw.cryptoCtx = secp256k1.ContextForThread(0)
 	rw.epoch = exec22.NewEpochReader(chainTx)
 	rw.chain = exec22.NewChainReader(chainConfig, chainTx, blockReader)
 	rw.posa, rw.isPoSA = engine.(consensus.PoSA)
@@ -124,20 +172,39 @@ func (rw *ReconWorker) run() {
 		}
 		return h
 	}
-	for txTask, ok := rw.rs.Schedule(); ok; txTask, ok = rw.rs.Schedule() {
-		rw.runTxTask(txTask)
+	for txTask, ok := rw.rs.Schedule(rw.ctx); ok; txTask, ok = rw.rs.Schedule(rw.ctx) {
+		rw.runGroup(txTask)
+	}
+}
+
+// runGroup executes the transaction and the group of transactions following it in the same block, in order.
+// If one of them is rolled back, the rest of the group is deferred until it is done
+func (rw *ReconWorker) runGroup(txTask *state.TxTask) {
+	tasks := append([]*state.TxTask{txTask}, txTask.Group...)
+	txTask.Group = nil
+	for i, t := range tasks {
+		if rw.runTxTask(t) {
+			continue
+		}
+		if rest := tasks[i+1:]; len(rest) > 0 {
+			rest[0].Group = rest[1:]
+			rw.rs.DeferTx(rest[0], t.TxNum)
+		}
+		return
 	}
 }
 
-func (rw *ReconWorker) runTxTask(txTask *state.TxTask) {
+// runTxTask returns false if the transaction has been rolled back
+func (rw *ReconWorker) runTxTask(txTask *state.TxTask) bool {
 	rw.lock.Lock()
 	defer rw.lock.Unlock()
+	start := time.Now()
 	rw.stateReader.SetTxNum(txTask.TxNum)
 	rw.stateReader.ResetError()
 	rw.stateWriter.SetTxNum(txTask.TxNum)
 	noop := state.NewNoopWriter()
 	rules := rw.chainConfig.Rules(txTask.BlockNum)
-	ibs := state.New(rw.stateReader)
+	ibs := state.New(rw.timedReader)
 	daoForkTx := rw.chainConfig.DAOForkSupport && rw.chainConfig.DAOForkBlock != nil && rw.chainConfig.DAOForkBlock.Uint64() == txTask.BlockNum && txTask.TxIndex == -1
 	var err error
 	if txTask.BlockNum == 0 && txTask.TxIndex == -1 {
@@ -174,11 +241,15 @@ func (rw *ReconWorker) runTxTask(txTask *state.TxTask) {
 		}
 		rw.engine.Initialize(rw.chainConfig, rw.chain, rw.epoch, txTask.Header, txTask.Block.Transactions(), txTask.Block.Uncles(), syscall)
 	} else {
+		if err = exec22.RecoverSender(rw.cryptoCtx, rw.chainConfig, txTask); err != nil {
+			panic(err)
+		}
 		if rw.isPoSA {
 			if isSystemTx, err := rw.posa.IsSystemTransaction(txTask.Tx, txTask.Header); err != nil {
 				panic(err)
 			} else if isSystemTx {
-				return
+				rw.timedReader.AddExecTimes(time.Since(start))
+				return true
 			}
 		}
 		txHash := txTask.Tx.Hash()
@@ -203,16 +274,21 @@ func (rw *ReconWorker) runTxTask(txTask *state.TxTask) {
 			panic(err)
 		}
 	}
+	rw.timedReader.AddExecTimes(time.Since(start))
 	if dependency, ok := rw.stateReader.ReadError(); ok {
 		//fmt.Printf("rollback %d\n", txNum)
-		rw.rs.RollbackTx(txTask, dependency)
-	} else {
-		if err = ibs.CommitBlock(rules, rw.stateWriter); err != nil {
-			panic(err)
-		}
-		//fmt.Printf("commit %d\n", txNum)
-		rw.rs.CommitTxNum(txTask.TxNum)
-	}
+		defer state.TimeExecPhase(state.PhaseConflict, time.Now())
+		rw.rs.RollbackTx(txTask, dependency, rw.stateReader.ReadErrorKey())
+		return false
+	}
+	putStart := time.Now()
+	if err = ibs.CommitBlock(rules, rw.stateWriter); err != nil {
+		panic(err)
+	}
+	state.TimeExecPhase(state.PhaseReconPut, putStart)
+	//fmt.Printf("commit %d\n", txNum)
+	rw.rs.CommitTxNum(txTask.TxNum)
+	return true
 }
 
 type FillWorker struct {
@@ -282,9 +358,7 @@ func (fw *FillWorker) fillAccounts(plainStateCollector *etl.Collector) {
 			if incBytes > 0 {
 				a.Incarnation = bytesToUint64(val[pos : pos+incBytes])
 			}
-			if a.Incarnation > 0 {
-				a.Incarnation = state.FirstContractIncarnation
-			}
+			// Incarnation is normalised on load, see reconIncarnations
 			value := make([]byte, a.EncodingLengthForStorage())
 			a.EncodeForStorage(value)
 			if err := plainStateCollector.Collect(key, value); err != nil {
@@ -305,7 +379,7 @@ func (fw *FillWorker) fillStorage(plainStateCollector *etl.Collector) {
 		key, val, progress := it.Next()
 		atomic.StoreUint64(&fw.progress, progress)
 		fw.currentKey = key
-		compositeKey := dbutils.PlainGenerateCompositeStorageKey(key[:20], state.FirstContractIncarnation, key[20:])
+		compositeKey := dbutils.PlainGenerateCompositeStorageKey(key[:20], reconFilledIncarnation, key[20:])
 		if len(val) > 0 {
 			if err := plainStateCollector.Collect(compositeKey, val); err != nil {
 				panic(err)
@@ -401,106 +475,222 @@ func (fw *FillWorker) bitmapCode(codeCollectorX *etl.Collector) {
 	}
 }
 
-func Recon(genesis *core.Genesis, logger log.Logger) error {
-	sigs := make(chan os.Signal, 1)
-	interruptCh := make(chan bool, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+// normaliseReconPlainState brings incarnation of a contract account, or of a storage item, to FirstContractIncarnation.
+// Storage of the earlier incarnations of the contract needs to be dropped first, see reconIncarnations
+func normaliseReconPlainState(k, v []byte) ([]byte, []byte, error) {
+	switch len(k) {
+	case length.Addr:
+		var a accounts.Account
+		if err := a.DecodeForStorage(v); err != nil {
+			return nil, nil, err
+		}
+		if a.Incarnation > 0 {
+			a.Incarnation = state.FirstContractIncarnation
+		}
+		value := make([]byte, a.EncodingLengthForStorage())
+		a.EncodeForStorage(value)
+		return k, value, nil
+	case length.Addr + length.Incarnation + length.Hash:
+		return dbutils.PlainGenerateCompositeStorageKey(k[:length.Addr], state.FirstContractIncarnation, k[length.Addr+length.Incarnation:]), v, nil
+	}
+	return k, v, nil
+}
 
-	go func() {
-		<-sigs
-		interruptCh <- true
-	}()
-	ctx := context.Background()
-	aggPath := filepath.Join(datadir, "agg22")
-	agg, err := libstate.NewAggregator22(aggPath, stagedsync.AggregationStep)
-	if err != nil {
-		return fmt.Errorf("create history: %w", err)
+// normaliseReconContractCode is the same as normaliseReconPlainState, for the contract code mapping. Unlike storage,
+// code is replayed only for the last change of the address, so there is only one incarnation to normalise
+func normaliseReconContractCode(k, v []byte) ([]byte, []byte, error) {
+	return dbutils.PlainGenerateStoragePrefix(k[:length.Addr], state.FirstContractIncarnation), v, nil
+}
+
+// reconFilledIncarnation is the incarnation of storage items filled from the history files. Their values are the ones
+// seen at the target txNum, so they belong to whichever incarnation the contract has then
+const reconFilledIncarnation = 0
+
+// reconIncarnations drops storage left by the earlier incarnations of a contract (removed by selfdestruct, then
+// re-created), which has the last change before the one of the current incarnation, and so is replayed as well.
+// The remaining items are normalised by normaliseReconPlainState. Plain state items need to be passed in the order
+// of keys, so that the account comes before its storage
+type reconIncarnations struct {
+	addr        []byte
+	incarnation uint64
+	exists      bool // the account is not a tombstone
+	// If true, storage of the accounts which are not passed is kept, because their incarnations have not changed.
+	// Otherwise, the storage is dropped, because the accounts are deleted
+	keepUnknown bool
+}
+
+// normalise returns false if the item needs to be dropped
+func (ri *reconIncarnations) normalise(k, v []byte) ([]byte, []byte, bool, error) {
+	switch len(k) {
+	case length.Addr:
+		ri.addr = append(ri.addr[:0], k...)
+		ri.exists, ri.incarnation = len(v) > 0, 0
+		if !ri.exists {
+			return k, v, true, nil
+		}
+		var a accounts.Account
+		if err := a.DecodeForStorage(v); err != nil {
+			return nil, nil, false, err
+		}
+		ri.incarnation = a.Incarnation
+	case length.Addr + length.Incarnation:
+		// Incarnation of the deleted contract, only needed during the replay, see state.ReconIncarnationKey2
+		return nil, nil, false, nil
+	case length.Addr + length.Incarnation + length.Hash:
+		incarnation := binary.BigEndian.Uint64(k[length.Addr:])
+		if !bytes.Equal(k[:length.Addr], ri.addr) {
+			if !ri.keepUnknown {
+				return nil, nil, false, nil
+			}
+		} else if ri.exists && incarnation != reconFilledIncarnation && incarnation != ri.incarnation {
+			return nil, nil, false, nil
+		} else if !ri.exists && len(v) > 0 {
+			// Tombstones are kept, values are deleted with the account
+			return nil, nil, false, nil
+		}
 	}
-	defer agg.Close()
-	reconDbPath := path.Join(datadir, "recondb")
-	if _, err = os.Stat(reconDbPath); err != nil {
-		if !errors.Is(err, os.ErrNotExist) {
-			return err
+	key, val, err := normaliseReconPlainState(k, v)
+	return key, val, err == nil, err
+}
+
+// reconTxTask creates the task for txNum, which can be the initialisation of the block (TxIndex -1),
+// one of its transactions, or its finalisation
+func reconTxTask(ctx context.Context, blockReader services.FullBlockReader, txNums *exec22.TxNums, txNum uint64) (*state.TxTask, error) {
+	var bn uint64
+	if txNum > 0 {
+		var ok bool
+		if ok, bn = txNums.Find(txNum - 1); !ok {
+			return nil, fmt.Errorf("block of txNum %d not found", txNum)
 		}
-	} else if err = os.RemoveAll(reconDbPath); err != nil {
-		return err
 	}
-	startTime := time.Now()
-	workerCount := runtime.NumCPU()
-	limiterB := semaphore.NewWeighted(int64(workerCount + 1))
-	db, err := kv2.NewMDBX(logger).Path(reconDbPath).RoTxsLimiter(limiterB).WriteMap().WithTableCfg(func(defaultBuckets kv.TableCfg) kv.TableCfg { return kv.ReconTablesCfg }).Open()
+	header, err := blockReader.HeaderByNumber(ctx, nil, bn)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	limiter := semaphore.NewWeighted(int64(workerCount + 1))
-	chainDbPath := path.Join(datadir, "chaindata")
-	chainDb, err := kv2.NewMDBX(logger).Path(chainDbPath).RoTxsLimiter(limiter).Open()
+	blockHash := header.Hash()
+	b, senders, err := blockReader.BlockWithSenders(ctx, nil, blockHash, bn)
 	if err != nil {
-		return err
-	}
-	var blockReader services.FullBlockReader
-	allSnapshots := snapshotsync.NewRoSnapshots(ethconfig.NewSnapCfg(true, false, true), path.Join(datadir, "snapshots"))
-	defer allSnapshots.Close()
-	if err := allSnapshots.ReopenFolder(); err != nil {
-		return fmt.Errorf("reopen snapshot segments: %w", err)
+		return nil, err
+	}
+	txs := b.Transactions()
+	txIndex := int(txNum-txNums.MinOf(bn)) - 1
+	txTask := &state.TxTask{
+		Header:    header,
+		BlockNum:  bn,
+		Block:     b,
+		TxNum:     txNum,
+		TxIndex:   txIndex,
+		BlockHash: blockHash,
+		Final:     txIndex == len(txs),
+	}
+	if txIndex >= 0 && txIndex < len(txs) {
+		txTask.Tx = txs[txIndex]
+		if txIndex < len(senders) {
+			txTask.Sender = &senders[txIndex]
+		}
 	}
-	blockReader = snapshotsync.NewBlockReaderWithSnapshots(allSnapshots)
-	// Compute mapping blockNum -> last TxNum in that block
-	txNums := exec22.TxNumsFromDB(allSnapshots, db)
-	endTxNumMinimax := agg.EndTxNumMinimax()
-	fmt.Printf("Max txNum in files: %d\n", endTxNumMinimax)
-	ok, blockNum := txNums.Find(endTxNumMinimax)
-	if !ok {
-		return fmt.Errorf("mininmax txNum not found in snapshot blocks: %d", endTxNumMinimax)
+	return txTask, nil
+}
+
+// reconCopyWindow copies the state produced by txNums from fromTxNum to toTxNum into the window tables,
+// leaving out the state produced by the transactions that were replayed only because the window depends on them
+func reconCopyWindow(ctx context.Context, db kv.RwDB, fromTxNum, toTxNum uint64) error {
+	var fromKey [8]byte
+	binary.BigEndian.PutUint64(fromKey[:], fromTxNum)
+	// Plain state is sorted by key before incarnations are normalised, see reconIncarnations
+	plainStateCollector := etl.NewCollector("recon window plainState", datadir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	defer plainStateCollector.Close()
+	return db.Update(ctx, func(tx kv.RwTx) error {
+		for _, t := range []struct {
+			from, to  string
+			normalise func(k, v []byte) ([]byte, []byte, error)
+		}{
+			{from: kv.PlainStateR, to: state.ReconWindowPlainState},
+			{from: kv.CodeR, to: state.ReconWindowCode},
+			{from: kv.PlainContractR, to: state.ReconWindowPlainContractCode, normalise: normaliseReconContractCode},
+		} {
+			if err := tx.ClearBucket(t.to); err != nil {
+				return err
+			}
+			cursor, err := tx.Cursor(t.from)
+			if err != nil {
+				return err
+			}
+			defer cursor.Close()
+			var k, v []byte
+			for k, v, err = cursor.Seek(fromKey[:]); err == nil && k != nil; k, v, err = cursor.Next() {
+				if binary.BigEndian.Uint64(k) > toTxNum {
+					break
+				}
+				key, val := k[8:], v
+				if t.from == kv.PlainStateR {
+					if err = plainStateCollector.Collect(key, val); err != nil {
+						return err
+					}
+					continue
+				}
+				// Tombstones are kept, so that the keys deleted within the window can be deleted by the repair
+				if t.normalise != nil {
+					if key, val, err = t.normalise(key, v); err != nil {
+						return err
+					}
+				}
+				if err = tx.Put(t.to, key, val); err != nil {
+					return err
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+		// Accounts not changed within the window keep their incarnations, so their storage is kept as well.
+		// Items are put directly, because loading empty values would delete the keys instead of keeping the tombstones
+		incarnations := &reconIncarnations{keepUnknown: true}
+		return plainStateCollector.Load(nil, "", func(k, v []byte, table etl.CurrentTableReader, next etl.LoadNextFunc) error {
+			key, val, keep, err := incarnations.normalise(k, v)
+			if err != nil || !keep {
+				return err
+			}
+			return tx.Put(state.ReconWindowPlainState, key, val)
+		}, etl.TransformArgs{})
+	})
+}
+
+// reconGasUsed returns gas used by the transaction as recorded in the receipts, or its gas limit
+// if the receipts are not available (e.g. pruned)
+func reconGasUsed(receipts types.Receipts, txn types.Transaction, txIndex int) uint64 {
+	if txIndex >= len(receipts) || receipts[txIndex] == nil {
+		return txn.GetGas()
 	}
-	if blockNum == 0 {
-		return fmt.Errorf("not enough transactions in the history data")
+	if txIndex == 0 {
+		return receipts[0].CumulativeGasUsed
 	}
-	if block+1 > blockNum {
-		return fmt.Errorf("specified block %d which is higher than available %d", block, blockNum)
+	if receipts[txIndex-1] == nil {
+		return txn.GetGas()
 	}
-	fmt.Printf("Max blockNum = %d\n", blockNum)
-	blockNum = block + 1
-	txNum := txNums.MaxOf(blockNum - 1)
-	fmt.Printf("Corresponding block num = %d, txNum = %d\n", blockNum, txNum)
-	var wg sync.WaitGroup
-	workCh := make(chan *state.TxTask, 128)
-	rs := state.NewReconState(workCh)
-	var fromKey, toKey []byte
-	bigCount := big.NewInt(int64(workerCount))
-	bigStep := big.NewInt(0x100000000)
-	bigStep.Div(bigStep, bigCount)
-	bigCurrent := big.NewInt(0)
-	fillWorkers := make([]*FillWorker, workerCount)
-	var doneCount uint64
-	for i := 0; i < workerCount; i++ {
-		fromKey = toKey
-		if i == workerCount-1 {
-			toKey = nil
-		} else {
-			bigCurrent.Add(bigCurrent, bigStep)
-			toKey = make([]byte, 4)
-			bigCurrent.FillBytes(toKey)
-		}
-		//fmt.Printf("%d) Fill worker [%x] - [%x]\n", i, fromKey, toKey)
-		fillWorkers[i] = NewFillWorker(txNum, &doneCount, agg, fromKey, toKey)
-	}
-	logEvery := time.NewTicker(logInterval)
-	defer logEvery.Stop()
+	return receipts[txIndex].CumulativeGasUsed - receipts[txIndex-1].CumulativeGasUsed
+}
+
+// scanReconTxs fills XAccount, XStorage and XCode tables with txNums of the last modification of each key,
+// and returns the bitmap of txNums that need to be replayed
+func scanReconTxs(ctx context.Context, db kv.RwDB, fillWorkers []*FillWorker, doneCount *uint64, logEvery *time.Ticker) (*roaring64.Bitmap, error) {
+	workerCount := len(fillWorkers)
+	var err error
+	bitmap := roaring64.New()
 	var brwTx kv.RwTx
 	defer func() {
 		if brwTx != nil {
 			brwTx.Rollback()
 		}
 	}()
-	doneCount = 0
+	*doneCount = 0
 	accountCollectorsX := make([]*etl.Collector, workerCount)
 	for i := 0; i < workerCount; i++ {
 		fillWorkers[i].ResetProgress()
 		accountCollectorsX[i] = etl.NewCollector("account scan X", datadir, etl.NewSortableBuffer(etl.BufferOptimalSize))
 		go fillWorkers[i].bitmapAccounts(accountCollectorsX[i])
 	}
-	for atomic.LoadUint64(&doneCount) < uint64(workerCount) {
+	for atomic.LoadUint64(doneCount) < uint64(workerCount) {
 		<-logEvery.C
 		var m runtime.MemStats
 		libcommon.ReadMemStats(&m)
@@ -521,32 +711,32 @@ func Recon(genesis *core.Genesis, logger log.Logger) error {
 		if err = accountCollectorsX[i].Load(nil, "", func(k, v []byte, table etl.CurrentTableReader, next etl.LoadNextFunc) error {
 			return accountCollectorX.Collect(k, v)
 		}, etl.TransformArgs{}); err != nil {
-			return err
+			return nil, err
 		}
 		accountCollectorsX[i].Close()
 		accountCollectorsX[i] = nil
 	}
 	if brwTx, err = db.BeginRw(ctx); err != nil {
-		return err
+		return nil, err
 	}
 	if err = accountCollectorX.Load(nil, "", func(k, v []byte, table etl.CurrentTableReader, next etl.LoadNextFunc) error {
 		return brwTx.Put(kv.XAccount, k, v)
 	}, etl.TransformArgs{}); err != nil {
-		return err
+		return nil, err
 	}
 	if err = brwTx.Commit(); err != nil {
-		return err
+		return nil, err
 	}
 	accountCollectorX.Close()
 	accountCollectorX = nil
-	doneCount = 0
+	*doneCount = 0
 	storageCollectorsX := make([]*etl.Collector, workerCount)
 	for i := 0; i < workerCount; i++ {
 		fillWorkers[i].ResetProgress()
 		storageCollectorsX[i] = etl.NewCollector("storage scan X", datadir, etl.NewSortableBuffer(etl.BufferOptimalSize))
 		go fillWorkers[i].bitmapStorage(storageCollectorsX[i])
 	}
-	for atomic.LoadUint64(&doneCount) < uint64(workerCount) {
+	for atomic.LoadUint64(doneCount) < uint64(workerCount) {
 		<-logEvery.C
 		var m runtime.MemStats
 		libcommon.ReadMemStats(&m)
@@ -567,32 +757,32 @@ func Recon(genesis *core.Genesis, logger log.Logger) error {
 		if err = storageCollectorsX[i].Load(nil, "", func(k, v []byte, table etl.CurrentTableReader, next etl.LoadNextFunc) error {
 			return storageCollectorX.Collect(k, v)
 		}, etl.TransformArgs{}); err != nil {
-			return err
+			return nil, err
 		}
 		storageCollectorsX[i].Close()
 		storageCollectorsX[i] = nil
 	}
 	if brwTx, err = db.BeginRw(ctx); err != nil {
-		return err
+		return nil, err
 	}
 	if err = storageCollectorX.Load(nil, "", func(k, v []byte, table etl.CurrentTableReader, next etl.LoadNextFunc) error {
 		return brwTx.Put(kv.XStorage, k, v)
 	}, etl.TransformArgs{}); err != nil {
-		return err
+		return nil, err
 	}
 	if err = brwTx.Commit(); err != nil {
-		return err
+		return nil, err
 	}
 	storageCollectorX.Close()
 	storageCollectorX = nil
-	doneCount = 0
+	*doneCount = 0
 	codeCollectorsX := make([]*etl.Collector, workerCount)
 	for i := 0; i < workerCount; i++ {
 		fillWorkers[i].ResetProgress()
 		codeCollectorsX[i] = etl.NewCollector("code scan X", datadir, etl.NewSortableBuffer(etl.BufferOptimalSize))
 		go fillWorkers[i].bitmapCode(codeCollectorsX[i])
 	}
-	for atomic.LoadUint64(&doneCount) < uint64(workerCount) {
+	for atomic.LoadUint64(doneCount) < uint64(workerCount) {
 		<-logEvery.C
 		var m runtime.MemStats
 		libcommon.ReadMemStats(&m)
@@ -609,31 +799,389 @@ func Recon(genesis *core.Genesis, logger log.Logger) error {
 	}
 	codeCollectorX := etl.NewCollector("code scan total X", datadir, etl.NewSortableBuffer(etl.BufferOptimalSize))
 	defer codeCollectorX.Close()
-	var bitmap roaring64.Bitmap
 	for i := 0; i < workerCount; i++ {
 		bitmap.Or(&fillWorkers[i].bitmap)
 		if err = codeCollectorsX[i].Load(nil, "", func(k, v []byte, table etl.CurrentTableReader, next etl.LoadNextFunc) error {
 			return codeCollectorX.Collect(k, v)
 		}, etl.TransformArgs{}); err != nil {
-			return err
+			return nil, err
 		}
 		codeCollectorsX[i].Close()
 		codeCollectorsX[i] = nil
 	}
 	if brwTx, err = db.BeginRw(ctx); err != nil {
-		return err
+		return nil, err
 	}
 	if err = codeCollectorX.Load(nil, "", func(k, v []byte, table etl.CurrentTableReader, next etl.LoadNextFunc) error {
 		return brwTx.Put(kv.XCode, k, v)
 	}, etl.TransformArgs{}); err != nil {
-		return err
+		return nil, err
 	}
 	if err = brwTx.Commit(); err != nil {
-		return err
+		return nil, err
 	}
 	codeCollectorX.Close()
 	codeCollectorX = nil
+	return bitmap, nil
+}
+
+// scanReconDependencies fills ReconDependencies table with the dependencies of the transactions to replay (in the
+// bitmap), and returns the number of dependencies found. The reads of a transaction are not recorded in the history,
+// so they are predicted from the trace indices: a transaction that sends from, or calls, an account reads it,
+// and depends on the last change of the account (from XAccount) if the change precedes the transaction. A transaction
+// calling a contract is likely to read its storage, so it depends on the latest of the last changes of the storage
+// slots of the contract (from XStorage) preceding the transaction. Reads that are not traced (e.g. BALANCE of
+// an account that is not called), and earlier last changes of the storage, are not predicted, and these conflicts
+// are still resolved by rollbacks
+func scanReconDependencies(ctx context.Context, db kv.RwDB, chainDb kv.RoDB, agg *libstate.Aggregator22, bitmap *roaring64.Bitmap, endTxNum uint64, logEvery *time.Ticker) (uint64, error) {
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	// Trace indices that are not yet in the files are in the chain database
+	chainTx, err := chainDb.BeginRo(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer chainTx.Rollback()
+	ac := agg.MakeContext()
+	collector := etl.NewCollector("recon dependencies", datadir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	defer collector.Close()
+	var count uint64
+	var depKey [16]byte
+	addDependency := func(txNum, dependency uint64) error {
+		if !bitmap.Contains(txNum) {
+			return nil
+		}
+		binary.BigEndian.PutUint64(depKey[:], txNum)
+		binary.BigEndian.PutUint64(depKey[8:], dependency)
+		count++
+		return collector.Collect(depKey[:], nil)
+	}
+	logProgress := func(table string, key []byte) {
+		select {
+		case <-logEvery.C:
+			log.Info("Scan dependencies", "table", table, "key", fmt.Sprintf("%x", key), "dependencies", count)
+		default:
+		}
+	}
+	if err = tx.ForEach(kv.XAccount, nil, func(k, v []byte) error {
+		lastTxNum := binary.BigEndian.Uint64(v)
+		if !bitmap.Contains(lastTxNum) {
+			return nil
+		}
+		for _, it := range []libstate.InvertedIterator{
+			ac.TraceFromIterator(k, lastTxNum+1, endTxNum, chainTx),
+			ac.TraceToIterator(k, lastTxNum+1, endTxNum, chainTx),
+		} {
+			for it.HasNext() {
+				if err := addDependency(it.Next(), lastTxNum); err != nil {
+					it.Close()
+					return err
+				}
+			}
+			it.Close()
+		}
+		logProgress(kv.XAccount, k)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	// Storage keys are address + location, so the slots of each contract are iterated together
+	var address []byte
+	var lastTxNums []uint64 // last changes of the storage slots of the contract, that need to be replayed
+	addStorageDependencies := func() error {
+		if len(lastTxNums) == 0 {
+			return nil
+		}
+		sort.Slice(lastTxNums, func(i, j int) bool { return lastTxNums[i] < lastTxNums[j] })
+		it := ac.TraceToIterator(address, lastTxNums[0]+1, endTxNum, chainTx)
+		defer it.Close()
+		i := 0
+		for it.HasNext() {
+			txNum := it.Next()
+			for i+1 < len(lastTxNums) && lastTxNums[i+1] < txNum {
+				i++
+			}
+			if err := addDependency(txNum, lastTxNums[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err = tx.ForEach(kv.XStorage, nil, func(k, v []byte) error {
+		if !bytes.HasPrefix(k, address) || address == nil {
+			if err := addStorageDependencies(); err != nil {
+				return err
+			}
+			address = append(address[:0], k[:length.Addr]...)
+			lastTxNums = lastTxNums[:0]
+			logProgress(kv.XStorage, k)
+		}
+		if lastTxNum := binary.BigEndian.Uint64(v); bitmap.Contains(lastTxNum) {
+			lastTxNums = append(lastTxNums, lastTxNum)
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	if err = addStorageDependencies(); err != nil {
+		return 0, err
+	}
+	if err = db.Update(ctx, func(rwTx kv.RwTx) error {
+		return collector.Load(nil, "", func(k, _ []byte, _ etl.CurrentTableReader, _ etl.LoadNextFunc) error {
+			return rwTx.Put(state.ReconDependencies, k, []byte{})
+		}, etl.TransformArgs{})
+	}); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// reconDependencies returns the dependencies of the transaction found by scanReconDependencies
+func reconDependencies(tx kv.Tx, txKey []byte) ([]uint64, error) {
+	var dependencies []uint64
+	if err := tx.ForPrefix(state.ReconDependencies, txKey, func(k, _ []byte) error {
+		dependencies = append(dependencies, binary.BigEndian.Uint64(k[8:]))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return dependencies, nil
+}
+
+func Recon(genesis *core.Genesis, logger log.Logger) error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	ctx := context.Background()
+	// Cancellation of runCtx stops the replay, but not the database operations needed to save the checkpoint
+	runCtx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
+	go func() {
+		select {
+		case <-sigs:
+			log.Warn("Interrupted, finishing transactions in progress and saving checkpoint")
+			cancelRun()
+		case <-runCtx.Done():
+		}
+	}()
+	aggPath := filepath.Join(datadir, "agg22")
+	agg, err := libstate.NewAggregator22(aggPath, stagedsync.AggregationStep)
+	if err != nil {
+		return fmt.Errorf("create history: %w", err)
+	}
+	defer agg.Close()
+	reconDbPath := path.Join(datadir, "recondb")
+	if _, err = os.Stat(reconDbPath); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	} else if !reconResume {
+		if err = os.RemoveAll(reconDbPath); err != nil {
+			return err
+		}
+	}
+	startTime := time.Now()
+	workerCount := runtime.NumCPU()
+	limiterB := semaphore.NewWeighted(int64(workerCount + 1))
+	db, err := kv2.NewMDBX(logger).Path(reconDbPath).RoTxsLimiter(limiterB).WriteMap().WithTableCfg(func(defaultBuckets kv.TableCfg) kv.TableCfg { return state.ReconTablesCfg() }).Open()
+	if err != nil {
+		return err
+	}
+	var checkpoint *state.ReconCheckpoint
+	if reconResume {
+		if err = db.View(ctx, func(tx kv.Tx) error {
+			checkpoint, err = state.ReadReconCheckpoint(tx)
+			return err
+		}); err != nil {
+			return err
+		}
+		if checkpoint != nil && checkpoint.Block != block {
+			return fmt.Errorf("checkpoint in %s is for block %d, but block %d is requested, run without --resume", reconDbPath, checkpoint.Block, block)
+		}
+	}
+	limiter := semaphore.NewWeighted(int64(workerCount + 1))
+	chainDbPath := path.Join(datadir, "chaindata")
+	chainDb, err := kv2.NewMDBX(logger).Path(chainDbPath).RoTxsLimiter(limiter).Open()
+	if err != nil {
+		return err
+	}
+	var blockReader services.FullBlockReader
+	allSnapshots := snapshotsync.NewRoSnapshots(ethconfig.NewSnapCfg(true, false, true), path.Join(datadir, "snapshots"))
+	defer allSnapshots.Close()
+	if err := allSnapshots.ReopenFolder(); err != nil {
+		return fmt.Errorf("reopen snapshot segments: %w", err)
+	}
+	blockReader = snapshotsync.NewBlockReaderWithSnapshots(allSnapshots)
+	// Compute mapping blockNum -> last TxNum in that block
+	txNums := exec22.TxNumsFromDB(allSnapshots, db)
+	endTxNumMinimax := agg.EndTxNumMinimax()
+	fmt.Printf("Max txNum in files: %d\n", endTxNumMinimax)
+	ok, blockNum := txNums.Find(endTxNumMinimax)
+	if !ok {
+		return fmt.Errorf("mininmax txNum not found in snapshot blocks: %d", endTxNumMinimax)
+	}
+	if blockNum == 0 {
+		return fmt.Errorf("not enough transactions in the history data")
+	}
+	if block+1 > blockNum {
+		return fmt.Errorf("specified block %d which is higher than available %d", block, blockNum)
+	}
+	fmt.Printf("Max blockNum = %d\n", blockNum)
+	blockNum = block + 1
+	txNum := txNums.MaxOf(blockNum - 1)
+	fmt.Printf("Corresponding block num = %d, txNum = %d\n", blockNum, txNum)
+	if reconFromTxNum > txNum {
+		return fmt.Errorf("fromtxnum %d is beyond txNum %d of the block", reconFromTxNum, txNum)
+	}
+	var partition, partitions int
+	if reconPartition != "" {
+		if partition, partitions, err = parseReconPartition(reconPartition); err != nil {
+			return err
+		}
+		if reconRun == "" {
+			return fmt.Errorf("--partition requires --run")
+		}
+	}
+	if (reconPartition != "" || len(reconRuns) > 0) && (reconResume || reconFromTxNum > 0 || reconCommitRoot) {
+		return fmt.Errorf("--partition and --runs cannot be combined with --resume, --fromtxnum or --commitment")
+	}
+	if reconPartition != "" && len(reconRuns) > 0 {
+		return fmt.Errorf("--partition cannot be combined with --runs")
+	}
+	var wg sync.WaitGroup
+	workCh := make(chan *state.TxTask, 128)
+	rs := state.NewReconState(workCh, reconSchedCfg)
+	if reconConflicts || reconDebugAddr != "" {
+		rs.TrackConflicts()
+	}
+	if reconDebugAddr != "" {
+		debugSrv, err := startReconDebugServer(reconDebugAddr, rs)
+		if err != nil {
+			return err
+		}
+		defer debugSrv.Close()
+	}
+	progressFeed := newReconProgressFeed()
+	if reconGrpcAddr != "" {
+		progressSrv, err := startReconProgressServer(ctx, reconGrpcAddr, progressFeed)
+		if err != nil {
+			return err
+		}
+		defer progressSrv.Stop()
+	}
+	if reconCommitRoot && (reconResume || reconFromTxNum > 0) {
+		// Commitment is not persisted in checkpoints, and a window does not produce the whole state
+		return fmt.Errorf("--commitment cannot be combined with --resume or --fromtxnum")
+	}
+	if reconETL {
+		if reconMemBudget != "" || reconParFlush {
+			return fmt.Errorf("--etl cannot be combined with --membudget or --parallelflush")
+		}
+		rs.UseETL(datadir)
+	}
+	if reconMemBudget != "" {
+		var memBudget datasize.ByteSize
+		if err = memBudget.UnmarshalText([]byte(reconMemBudget)); err != nil {
+			return fmt.Errorf("parsing membudget: %w", err)
+		}
+		// The second database receives the spills while --parallelflush writes out the first one
+		var spillDbs [2]kv.RwDB
+		for i := range spillDbs {
+			spillDbPath := path.Join(datadir, fmt.Sprintf("reconspill%d", i))
+			if err = os.RemoveAll(spillDbPath); err != nil {
+				return err
+			}
+			spillDb, err := kv2.NewMDBX(logger).Path(spillDbPath).WriteMap().WithTableCfg(func(defaultBuckets kv.TableCfg) kv.TableCfg { return state.ReconTablesCfg() }).Open()
+			if err != nil {
+				return err
+			}
+			defer func() {
+				spillDb.Close()
+				os.RemoveAll(spillDbPath)
+			}()
+			spillDbs[i] = spillDb
+		}
+		defer rs.CloseSpill()
+		rs.SetSpill(spillDbs[0], spillDbs[1], memBudget.Bytes())
+	}
+	var fromKey, toKey []byte
+	bigCount := big.NewInt(int64(workerCount))
+	bigStep := big.NewInt(0x100000000)
+	bigStep.Div(bigStep, bigCount)
+	bigCurrent := big.NewInt(0)
+	fillWorkers := make([]*FillWorker, workerCount)
+	var doneCount uint64
+	for i := 0; i < workerCount; i++ {
+		fromKey = toKey
+		if i == workerCount-1 {
+			toKey = nil
+		} else {
+			bigCurrent.Add(bigCurrent, bigStep)
+			toKey = make([]byte, 4)
+			bigCurrent.FillBytes(toKey)
+		}
+		//fmt.Printf("%d) Fill worker [%x] - [%x]\n", i, fromKey, toKey)
+		fillWorkers[i] = NewFillWorker(txNum, &doneCount, agg, fromKey, toKey)
+	}
+	logEvery := time.NewTicker(logInterval)
+	defer logEvery.Stop()
+	var bitmap *roaring64.Bitmap
+	var runHeader reconRunHeader
+	var restoredDeps map[uint64][]uint64 // dependencies of transactions that were waiting in triggers at the checkpoint
+	if checkpoint == nil {
+		if bitmap, err = scanReconTxs(ctx, db, fillWorkers, &doneCount, logEvery); err != nil {
+			return err
+		}
+		if reconFromTxNum > 0 {
+			bitmap.RemoveRange(0, reconFromTxNum)
+		}
+		if reconPartition != "" {
+			if runHeader.FromTxNum, runHeader.ToTxNum, err = reconPartitionRange(bitmap, partition, partitions, txNum+1); err != nil {
+				return err
+			}
+			runHeader.Block, runHeader.Partition, runHeader.Partitions, runHeader.PlannedTxs = block, partition, partitions, bitmap.GetCardinality()
+			bitmap.RemoveRange(0, runHeader.FromTxNum)
+			bitmap.RemoveRange(runHeader.ToTxNum, txNum+1)
+			runHeader.PartitionTxs = bitmap.GetCardinality()
+			log.Info("Replaying partition", "partition", reconPartition, "from txNum", runHeader.FromTxNum, "to txNum", runHeader.ToTxNum)
+		}
+		if len(reconRuns) > 0 {
+			// All transactions have been replayed by the partitions
+			bitmap.Clear()
+		}
+		if err = db.Update(ctx, func(tx kv.RwTx) error { return state.SaveReconPlan(tx, block, bitmap) }); err != nil {
+			return err
+		}
+		if reconDeps {
+			depCount, err := scanReconDependencies(ctx, db, chainDb, agg, bitmap, txNum+1, logEvery)
+			if err != nil {
+				return err
+			}
+			log.Info("Scanned dependencies", "dependencies", depCount)
+		}
+	} else {
+		bitmap = checkpoint.Todo
+		rs.RestoreDone(checkpoint.Done)
+		restoredDeps = checkpoint.PendingDependencies()
+		if err = db.View(ctx, rs.RestoreCodes); err != nil {
+			return err
+		}
+		log.Info("Resuming from checkpoint", "done", checkpoint.Done.GetCardinality(), "pending triggers", len(restoredDeps), "flushed up to txNum", checkpoint.Flushed)
+	}
 	log.Info("Ready to replay", "transactions", bitmap.GetCardinality(), "out of", txNum)
+	if reconFromTxNum > 0 || reconPartition != "" {
+		// State read by the window, but last modified before it, is produced by replaying transactions on demand
+		rs.SetOnDemand(bitmap, func(txNum uint64) *state.TxTask {
+			txTask, err := reconTxTask(ctx, blockReader, txNums, txNum)
+			if err != nil {
+				panic(err)
+			}
+			return txTask
+		})
+	}
 	var lock sync.RWMutex
 	reconWorkers := make([]*ReconWorker, workerCount)
 	roTxs := make([]kv.Tx, workerCount)
@@ -658,9 +1206,20 @@ func Recon(genesis *core.Genesis, logger log.Logger) error {
 	}
 	engine := initConsensusEngine(chainConfig, logger, allSnapshots)
 	for i := 0; i < workerCount; i++ {
-		reconWorkers[i] = NewReconWorker(lock.RLocker(), &wg, rs, agg, blockReader, allSnapshots, chainConfig, logger, genesis, engine, chainTxs[i])
+		reconWorkers[i] = NewReconWorker(runCtx, lock.RLocker(), &wg, rs, agg, blockReader, allSnapshots, chainConfig, logger, genesis, engine, chainTxs[i])
+		reconWorkers[i].cryptoCtx = secp256k1.ContextForThread(i)
 		reconWorkers[i].SetTx(roTxs[i])
 	}
+	var rc *reconCommitment
+	if reconCommitRoot {
+		if rc, err = newReconCommitment(path.Join(datadir, "reconcommitment"), logger); err != nil {
+			return err
+		}
+		defer rc.Close()
+		for i := 0; i < workerCount; i++ {
+			reconWorkers[i].stateWriter.SetCommitment(rc)
+		}
+	}
 	wg.Add(workerCount)
 	count := uint64(0)
 	rollbackCount := uint64(0)
@@ -668,11 +1227,28 @@ func Recon(genesis *core.Genesis, logger log.Logger) error {
 	for i := 0; i < workerCount; i++ {
 		go reconWorkers[i].run()
 	}
+	reconDone := make(chan struct{})
+	// Before the transactions of the workers are rolled back, on every return
+	workersStopped := false
+	stopWorkers := func() {
+		if workersStopped {
+			return
+		}
+		workersStopped = true
+		close(workCh)
+		wg.Wait()
+		reconDone <- struct{}{} // Complete logging and committing go-routine
+	}
+	defer func() {
+		if !workersStopped {
+			cancelRun()
+			stopWorkers()
+		}
+	}()
 	commitThreshold := uint64(256 * 1024 * 1024)
 	prevCount := uint64(0)
 	prevRollbackCount := uint64(0)
 	prevTime := time.Now()
-	reconDone := make(chan struct{})
 	go func() {
 		for {
 			select {
@@ -692,13 +1268,66 @@ func Recon(genesis *core.Genesis, logger log.Logger) error {
 				if count > prevCount {
 					repeatRatio = 100.0 * float64(rollbackCount-prevRollbackCount) / float64(count-prevCount)
 				}
+				var eta time.Duration
+				if speedTx > 0 && total > count {
+					eta = time.Duration(float64(total-count) / speedTx * float64(time.Second))
+				}
+				progressFeed.update(ReconProgress{
+					Time:          currentTime,
+					Done:          count,
+					Total:         total,
+					Rollbacks:     rollbackCount,
+					RollbackRatio: repeatRatio,
+					TxPerSecond:   speedTx,
+					ETA:           eta,
+					FlushSize:     sizeEstimate,
+				})
 				prevTime = currentTime
 				prevCount = count
 				prevRollbackCount = rollbackCount
-				log.Info("State reconstitution", "workers", workerCount, "progress", fmt.Sprintf("%.2f%%", progress), "tx/s", fmt.Sprintf("%.1f", speedTx), "repeat ratio", fmt.Sprintf("%.2f%%", repeatRatio), "buffer", libcommon.ByteCount(sizeEstimate),
-					"alloc", libcommon.ByteCount(m.Alloc), "sys", libcommon.ByteCount(m.Sys),
+				log.Info("State reconstitution", "workers", workerCount, "progress", fmt.Sprintf("%.2f%%", progress), "tx/s", fmt.Sprintf("%.1f", speedTx), "repeat ratio", fmt.Sprintf("%.2f%%", repeatRatio), "deferred", rs.DeferCount(), "buffer", libcommon.ByteCount(sizeEstimate),
+					"spills", rs.SpillCount(), "alloc", libcommon.ByteCount(m.Alloc), "sys", libcommon.ByteCount(m.Sys),
 				)
-				if sizeEstimate >= commitThreshold {
+				if report := rs.ConflictReport(5); report != nil && len(report.Contracts) > 0 {
+					var top []interface{}
+					for _, c := range report.Contracts {
+						top = append(top, fmt.Sprintf("%x", c.Address), c.Count)
+					}
+					log.Info("Top conflicting contracts", top...)
+				}
+				if sizeEstimate >= commitThreshold && reconParFlush {
+					err := func() error {
+						rwTx, err := db.BeginRw(ctx)
+						if err != nil {
+							return err
+						}
+						defer rwTx.Rollback()
+						done, err := rs.ParallelFlush(rwTx, datadir)
+						if err != nil {
+							return err
+						}
+						if err = rs.SaveFlushedCheckpoint(rwTx, done); err != nil {
+							return err
+						}
+						if err = rwTx.Commit(); err != nil {
+							return err
+						}
+						// Workers need to be stopped only to switch to the new transactions
+						lock.Lock()
+						defer lock.Unlock()
+						for i := 0; i < workerCount; i++ {
+							roTxs[i].Rollback()
+							if roTxs[i], err = db.BeginRo(ctx); err != nil {
+								return err
+							}
+							reconWorkers[i].SetTx(roTxs[i])
+						}
+						return rs.ReleaseFrozen()
+					}()
+					if err != nil {
+						panic(err)
+					}
+				} else if sizeEstimate >= commitThreshold {
 					err := func() error {
 						lock.Lock()
 						defer lock.Unlock()
@@ -714,6 +1343,9 @@ func Recon(genesis *core.Genesis, logger log.Logger) error {
 						if err = rs.Flush(rwTx); err != nil {
 							return err
 						}
+						if err = rs.SaveCheckpoint(rwTx); err != nil {
+							return err
+						}
 						if err = rwTx.Commit(); err != nil {
 							return err
 						}
@@ -735,18 +1367,35 @@ func Recon(genesis *core.Genesis, logger log.Logger) error {
 	var inputTxNum uint64
 	var header *types.Header
 	var txKey [8]byte
+	var depTx kv.Tx
+	if reconDeps {
+		if depTx, err = db.BeginRo(ctx); err != nil {
+			return err
+		}
+		defer depTx.Rollback()
+	}
 	for bn := uint64(0); bn < blockNum; bn++ {
 		if header, err = blockReader.HeaderByNumber(ctx, nil, bn); err != nil {
-			panic(err)
+			return err
 		}
 		blockHash := header.Hash()
-		b, _, err := blockReader.BlockWithSenders(ctx, nil, blockHash, bn)
+		b, senders, err := blockReader.BlockWithSenders(ctx, nil, blockHash, bn)
 		if err != nil {
-			panic(err)
+			return err
 		}
 		txs := b.Transactions()
+		var receipts types.Receipts
+		if reconSchedCfg.GasWindow > 0 {
+			if err = chainDb.View(ctx, func(tx kv.Tx) error {
+				receipts = rawdb.ReadRawReceipts(tx, bn)
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		var blockTasks []*state.TxTask
 		for txIndex := -1; txIndex <= len(txs); txIndex++ {
-			if bitmap.Contains(inputTxNum) {
+			if bitmap.Contains(inputTxNum) && (checkpoint == nil || !checkpoint.Done.Contains(inputTxNum)) {
 				binary.BigEndian.PutUint64(txKey[:], inputTxNum)
 				txTask := &state.TxTask{
 					Header:    header,
@@ -759,15 +1408,44 @@ func Recon(genesis *core.Genesis, logger log.Logger) error {
 				}
 				if txIndex >= 0 && txIndex < len(txs) {
 					txTask.Tx = txs[txIndex]
+					if txIndex < len(senders) {
+						txTask.Sender = &senders[txIndex]
+					}
+					if reconSchedCfg.GasWindow > 0 {
+						txTask.GasUsed = reconGasUsed(receipts, txTask.Tx, txIndex)
+					}
+				}
+				if depTx != nil {
+					if txTask.Dependencies, err = reconDependencies(depTx, txKey[:]); err != nil {
+						return err
+					}
+				}
+				// Transactions that were rolled back before the checkpoint wait for the same dependencies again
+				txTask.Dependencies = append(txTask.Dependencies, restoredDeps[inputTxNum]...)
+				if reconBlocks {
+					blockTasks = append(blockTasks, txTask)
+				} else {
+					select {
+					case workCh <- txTask:
+					case <-runCtx.Done():
+					}
 				}
-				workCh <- txTask
 			}
 			inputTxNum++
 		}
+		if len(blockTasks) > 0 {
+			// Transactions of the block are sent as a group, and the block is scheduled as a whole
+			blockTasks[0].Group = blockTasks[1:]
+			select {
+			case workCh <- blockTasks[0]:
+			case <-runCtx.Done():
+			}
+		}
+		if runCtx.Err() != nil {
+			break
+		}
 	}
-	close(workCh)
-	wg.Wait()
-	reconDone <- struct{}{} // Complete logging and committing go-routine
+	stopWorkers()
 	for i := 0; i < workerCount; i++ {
 		roTxs[i].Rollback()
 	}
@@ -780,9 +1458,35 @@ func Recon(genesis *core.Genesis, logger log.Logger) error {
 	if err = rs.Flush(rwTx); err != nil {
 		return err
 	}
+	if err = rs.SaveCheckpoint(rwTx); err != nil {
+		return err
+	}
 	if err = rwTx.Commit(); err != nil {
 		return err
 	}
+	if runCtx.Err() != nil {
+		log.Info("Checkpoint saved, run with --resume to continue", "done", rs.DoneCount(), "out of", total)
+		return runCtx.Err()
+	}
+	if reconFromTxNum > 0 {
+		if err = reconCopyWindow(ctx, db, reconFromTxNum, txNum); err != nil {
+			return err
+		}
+		log.Info("Reconstitution of the window complete", "from txNum", reconFromTxNum, "to txNum", txNum, "replayed on demand", rs.OnDemandCount(), "duration", time.Since(startTime))
+		return nil
+	}
+	if reconPartition != "" {
+		if err = writeReconRun(ctx, db, reconRun, runHeader); err != nil {
+			return err
+		}
+		log.Info("Reconstitution of the partition complete", "partition", reconPartition, "run", reconRun, "replayed on demand", rs.OnDemandCount(), "duration", time.Since(startTime))
+		return nil
+	}
+	if len(reconRuns) > 0 {
+		if err = mergeReconRuns(ctx, db, reconRuns, block, txNum+1); err != nil {
+			return err
+		}
+	}
 	plainStateCollector := etl.NewCollector("recon plainState", datadir, etl.NewSortableBuffer(etl.BufferOptimalSize))
 	defer plainStateCollector.Close()
 	codeCollector := etl.NewCollector("recon code", datadir, etl.NewOldestEntryBuffer(etl.BufferOptimalSize))
@@ -801,6 +1505,11 @@ func Recon(genesis *core.Genesis, logger log.Logger) error {
 	defer cursor.Close()
 	var k, v []byte
 	for k, v, err = cursor.First(); err == nil && k != nil; k, v, err = cursor.Next() {
+		if len(v) == 0 {
+			// Tombstone of deleted account or cleared storage slot, plain state does not hold empty values
+			continue
+		}
+		// Incarnations are normalised once the items are sorted by key, see reconIncarnations
 		if err = plainStateCollector.Collect(k[8:], v); err != nil {
 			return err
 		}
@@ -827,7 +1536,15 @@ func Recon(genesis *core.Genesis, logger log.Logger) error {
 	}
 	defer cursor.Close()
 	for k, v, err = cursor.First(); err == nil && k != nil; k, v, err = cursor.Next() {
-		if err = plainContractCollector.Collect(k[8:], v); err != nil {
+		if len(v) == 0 {
+			// Tombstone of the code of deleted contract
+			continue
+		}
+		key, val, err := normaliseReconContractCode(k[8:], v)
+		if err != nil {
+			return err
+		}
+		if err = plainContractCollector.Collect(key, val); err != nil {
 			return err
 		}
 	}
@@ -925,6 +1642,12 @@ func Recon(genesis *core.Genesis, logger log.Logger) error {
 	// Load all collections into the main collector
 	for i := 0; i < workerCount; i++ {
 		if err = plainStateCollectors[i].Load(nil, "", func(k, v []byte, table etl.CurrentTableReader, next etl.LoadNextFunc) error {
+			if rc != nil {
+				// Values filled from the history have not been seen by the commitment
+				if err := rc.UpdatePlainState(k, v); err != nil {
+					return err
+				}
+			}
 			return plainStateCollector.Collect(k, v)
 		}, etl.TransformArgs{}); err != nil {
 			return err
@@ -958,7 +1681,16 @@ func Recon(genesis *core.Genesis, logger log.Logger) error {
 	if err = rwTx.ClearBucket(kv.PlainContractCode); err != nil {
 		return err
 	}
-	if err = plainStateCollector.Load(rwTx, kv.PlainState, etl.IdentityLoadFunc, etl.TransformArgs{}); err != nil {
+	// Normalised storage keys of a contract are not always in order, if some were filled from the history files,
+	// so they are put rather than appended
+	incarnations := &reconIncarnations{}
+	if err = plainStateCollector.Load(nil, "", func(k, v []byte, table etl.CurrentTableReader, next etl.LoadNextFunc) error {
+		key, val, keep, err := incarnations.normalise(k, v)
+		if err != nil || !keep {
+			return err
+		}
+		return rwTx.Put(kv.PlainState, key, val)
+	}, etl.TransformArgs{}); err != nil {
 		return err
 	}
 	plainStateCollector.Close()
@@ -970,6 +1702,19 @@ func Recon(genesis *core.Genesis, logger log.Logger) error {
 		return err
 	}
 	plainContractCollector.Close()
+	if rc != nil {
+		// Code of the contracts filled from the history has not been seen by the commitment, and updating
+		// the code produced by the replay again does not change it
+		if err = rwTx.ForEach(kv.PlainContractCode, nil, func(k, v []byte) error {
+			code, err := rwTx.GetOne(kv.Code, v)
+			if err != nil {
+				return err
+			}
+			return rc.UpdateAccountCode(common.BytesToAddress(k[:length.Addr]), binary.BigEndian.Uint64(k[length.Addr:]), common.BytesToHash(v), code)
+		}); err != nil {
+			return err
+		}
+	}
 	if err = rwTx.Commit(); err != nil {
 		return err
 	}
@@ -1038,7 +1783,14 @@ func Recon(genesis *core.Genesis, logger log.Logger) error {
 		return err
 	}
 	var rootHash common.Hash
-	if rootHash, err = stagedsync.RegenerateIntermediateHashes("recon", rwTx, stagedsync.StageTrieCfg(chainDb, false /* checkRoot */, true /* saveHashesToDB */, false /* badBlockHalt */, tmpDir, blockReader, nil /* HeaderDownload */, cfg.HistoryV2, txNums, agg), common.Hash{}, make(chan struct{}, 1)); err != nil {
+	if rc != nil {
+		log.Info("Computing commitment")
+		commitmentRoot, err := rc.RootHash()
+		if err != nil {
+			return err
+		}
+		rootHash = common.BytesToHash(commitmentRoot)
+	} else if rootHash, err = stagedsync.RegenerateIntermediateHashes("recon", rwTx, stagedsync.StageTrieCfg(chainDb, false /* checkRoot */, true /* saveHashesToDB */, false /* badBlockHalt */, tmpDir, blockReader, nil /* HeaderDownload */, cfg.HistoryV2, txNums, agg), common.Hash{}, make(chan struct{}, 1)); err != nil {
 		return err
 	}
 	trieStage, err := stagedSync.StageState(stages.IntermediateHashes, rwTx, chainDb)
@@ -1054,5 +1806,20 @@ func Recon(genesis *core.Genesis, logger log.Logger) error {
 	if rootHash != header.Root {
 		log.Error("Incorrect root hash", "expected", fmt.Sprintf("%x", header.Root))
 	}
+	if reconVerify != "" {
+		trustedDb, err := kv2.NewMDBX(logger).Path(reconVerify).Readonly().Open()
+		if err != nil {
+			return err
+		}
+		defer trustedDb.Close()
+		mismatches, err := verifyRecon(ctx, chainDb, trustedDb, block)
+		if err != nil {
+			return err
+		}
+		if mismatches > 0 || rootHash != header.Root {
+			return fmt.Errorf("verification failed: %d mismatching entries, root hash %x, expected %x", mismatches, rootHash, header.Root)
+		}
+		log.Info("Verification complete, reconstituted state matches the trusted database")
+	}
 	return nil
 }
@@ -0,0 +1,301 @@
+package commands
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	kv2 "github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	libstate "github.com/ledgerwatch/erigon-lib/state"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func newReconTestDB(t *testing.T) kv.RwDB {
+	db := kv2.NewMDBX(log.New()).InMem().WithTableCfg(func(kv.TableCfg) kv.TableCfg { return state.ReconTablesCfg() }).MustOpen()
+	t.Cleanup(db.Close)
+	return db
+}
+
+func newReconTestTx(t *testing.T) kv.RwTx {
+	tx, err := newReconTestDB(t).BeginRw(context.Background())
+	require.NoError(t, err)
+	t.Cleanup(tx.Rollback)
+	return tx
+}
+
+func encodeReconTestAccount(incarnation uint64) []byte {
+	a := accounts.Account{Nonce: 1, Incarnation: incarnation}
+	v := make([]byte, a.EncodingLengthForStorage())
+	a.EncodeForStorage(v)
+	return v
+}
+
+// Contract is removed by selfdestruct, and re-created at the same address by CREATE2. Slot 1 is written only by the
+// first incarnation, slot 2 only by the second one, and slot 3 is filled from the history files
+func TestReconIncarnations(t *testing.T) {
+	contract, deleted := common.Address{1}, common.Address{2}
+	storageKey := func(addr common.Address, incarnation uint64, slot byte) []byte {
+		return dbutils.PlainGenerateCompositeStorageKey(addr[:], incarnation, common.Hash{slot}.Bytes())
+	}
+	items := [][2][]byte{ // in the order of keys
+		{contract[:], encodeReconTestAccount(2)},
+		{storageKey(contract, reconFilledIncarnation, 3), {3}},
+		{storageKey(contract, 1, 1), {1}},
+		{storageKey(contract, 2, 2), {2}},
+		{storageKey(deleted, 1, 1), {4}},
+	}
+	normalise := func(ri *reconIncarnations) map[string][]byte {
+		result := map[string][]byte{}
+		for _, item := range items {
+			key, val, keep, err := ri.normalise(item[0], item[1])
+			require.NoError(t, err)
+			if keep {
+				result[string(key)] = val
+			}
+		}
+		return result
+	}
+	require.Equal(t, map[string][]byte{
+		string(contract[:]):                encodeReconTestAccount(state.FirstContractIncarnation),
+		string(storageKey(contract, 1, 2)): {2},
+		string(storageKey(contract, 1, 3)): {3},
+	}, normalise(&reconIncarnations{}))
+	// Within a window, storage of accounts that are not changed is kept
+	require.Equal(t, []byte{4}, normalise(&reconIncarnations{keepUnknown: true})[string(storageKey(deleted, 1, 1))])
+
+	// Values of deleted account are dropped, tombstones are kept
+	ri := &reconIncarnations{keepUnknown: true}
+	_, _, keep, err := ri.normalise(deleted[:], nil)
+	require.NoError(t, err)
+	require.True(t, keep)
+	// Incarnation kept with the tombstone is dropped
+	_, _, keep, err = ri.normalise(append(deleted[:], state.ReconIncarnationKey2...), []byte{0, 0, 0, 0, 0, 0, 0, 1})
+	require.NoError(t, err)
+	require.False(t, keep)
+	_, _, keep, err = ri.normalise(storageKey(deleted, 1, 1), []byte{4})
+	require.NoError(t, err)
+	require.False(t, keep)
+	key, _, keep, err := ri.normalise(storageKey(deleted, 1, 2), nil)
+	require.NoError(t, err)
+	require.True(t, keep)
+	require.Equal(t, storageKey(deleted, 1, 2), key)
+}
+
+func TestReconCopyWindowIncarnations(t *testing.T) {
+	defer func(d string) { datadir = d }(datadir)
+	datadir = t.TempDir()
+	db := newReconTestDB(t)
+	contract := common.Address{1}
+	put := func(tx kv.RwTx, txNum uint64, key, val []byte) {
+		var k [8]byte
+		binary.BigEndian.PutUint64(k[:], txNum)
+		require.NoError(t, tx.Put(kv.PlainStateR, append(k[:], key...), val))
+	}
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		// First incarnation writes slot 1 at txNum 5, selfdestructs, and the second one is created at txNum 9
+		put(tx, 5, dbutils.PlainGenerateCompositeStorageKey(contract[:], 1, common.Hash{1}.Bytes()), []byte{1})
+		put(tx, 9, contract[:], encodeReconTestAccount(2))
+		put(tx, 10, dbutils.PlainGenerateCompositeStorageKey(contract[:], 2, common.Hash{2}.Bytes()), []byte{2})
+		return nil
+	}))
+	require.NoError(t, reconCopyWindow(context.Background(), db, 0, 10))
+	window := map[string][]byte{}
+	require.NoError(t, db.View(context.Background(), func(tx kv.Tx) error {
+		return tx.ForEach(state.ReconWindowPlainState, nil, func(k, v []byte) error {
+			window[string(k)] = common.CopyBytes(v)
+			return nil
+		})
+	}))
+	require.Equal(t, map[string][]byte{
+		string(contract[:]): encodeReconTestAccount(state.FirstContractIncarnation),
+		string(dbutils.PlainGenerateCompositeStorageKey(contract[:], state.FirstContractIncarnation, common.Hash{2}.Bytes())): {2},
+	}, window)
+}
+
+// Contract is removed by selfdestruct, and re-created at the same address by CREATE2 in a later txNum. The new
+// contract needs to get the next incarnation, rather than the first one again
+func TestReconIncarnationAfterSelfdestruct(t *testing.T) {
+	tx := newReconTestTx(t)
+	rs := state.NewReconState(nil, state.DefaultReconSchedulerCfg)
+	factory, salt := common.Address{1}, uint256.NewInt(1)
+	contract := crypto.CreateAddress2(factory, salt.Bytes32(), crypto.Keccak256(nil))
+	const factoryTxNum, selfdestructTxNum, create2TxNum = 1, 2, 3
+	putTxKey := func(address common.Address, txNum uint64) {
+		var txKey [8]byte
+		binary.BigEndian.PutUint64(txKey[:], txNum)
+		require.NoError(t, tx.Put(kv.XAccount, address[:], txKey[:]))
+	}
+	putTxKey(factory, factoryTxNum)
+	putTxKey(contract, selfdestructTxNum)
+	require.NoError(t, rs.Put(kv.PlainStateR, factory[:], nil, encodeReconTestAccount(state.FirstContractIncarnation), factoryTxNum))
+	rs.CommitTxNum(factoryTxNum)
+
+	// Second incarnation of the contract selfdestructs
+	_, plainTx := memdb.NewTestTx(t)
+	require.NoError(t, plainTx.Put(kv.PlainState, contract[:], encodeReconTestAccount(2)))
+	ibs := state.New(state.NewPlainStateReader(plainTx))
+	require.True(t, ibs.Suicide(contract))
+	w := state.NewStateReconWriter(nil, rs)
+	w.SetTx(tx)
+	w.SetTxNum(selfdestructTxNum)
+	require.NoError(t, ibs.FinalizeTx(params.TestRules, w))
+	rs.CommitTxNum(selfdestructTxNum)
+
+	hr := state.NewHistoryReaderNoState(nil, nil, rs)
+	hr.SetTx(tx)
+	hr.SetTxNum(create2TxNum)
+	ibs = state.New(hr)
+	blockCtx := vm.BlockContext{
+		CanTransfer:     core.CanTransfer,
+		Transfer:        core.Transfer,
+		ContractHasTEVM: func(common.Hash) (bool, error) { return false, nil },
+	}
+	evm := vm.NewEVM(blockCtx, vm.TxContext{}, ibs, params.TestChainConfig, vm.Config{})
+	_, contractAddr, _, err := evm.Create2(vm.AccountRef(factory), nil, 100_000, uint256.NewInt(0), salt)
+	require.NoError(t, err)
+	require.Equal(t, contract, contractAddr)
+	_, readError := hr.ReadError()
+	require.False(t, readError)
+	require.Equal(t, uint64(3), ibs.GetIncarnation(contract))
+}
+
+// Contract is removed by selfdestruct earlier in the history, i.e. not by the last change of its account, and
+// re-created at the same address by CREATE2. Its incarnation comes from the value of the account before the deletion
+// kept in the history files. The re-creation is the last change of the account, so the writer keeps its incarnation
+func TestReconIncarnationRecreatedInHistory(t *testing.T) {
+	tx := newReconTestTx(t)
+	rs := state.NewReconState(nil, state.DefaultReconSchedulerCfg)
+	factory, salt := common.Address{1}, uint256.NewInt(1)
+	contract := crypto.CreateAddress2(factory, salt.Bytes32(), crypto.Keccak256(nil))
+	const factoryTxNum, createTxNum, selfdestructTxNum, create2TxNum = 0, 1, 2, 5
+	putTxKey := func(address common.Address, txNum uint64) {
+		var txKey [8]byte
+		binary.BigEndian.PutUint64(txKey[:], txNum)
+		require.NoError(t, tx.Put(kv.XAccount, address[:], txKey[:]))
+	}
+	putTxKey(factory, factoryTxNum)
+	putTxKey(contract, create2TxNum)
+	require.NoError(t, rs.Put(kv.PlainStateR, factory[:], nil, encodeReconTestAccount(state.FirstContractIncarnation), factoryTxNum))
+	rs.CommitTxNum(factoryTxNum)
+
+	// History of the contract: the second incarnation is created, selfdestructs, and is re-created by create2TxNum
+	agg, err := libstate.NewAggregator22(t.TempDir(), 4)
+	require.NoError(t, err)
+	defer agg.Close()
+	_, aggTx := memdb.NewTestTx(t)
+	agg.SetTx(aggTx)
+	prevs := map[uint64][]byte{
+		createTxNum:       {},
+		selfdestructTxNum: accounts.Serialise2(&accounts.Account{Nonce: 1, Incarnation: 2}),
+		create2TxNum:      {},
+	}
+	for txNum := uint64(0); txNum < 12; txNum++ { // builds the files of the first two steps
+		agg.SetTxNum(txNum)
+		if prev, ok := prevs[txNum]; ok {
+			require.NoError(t, agg.AddAccountPrev(contract[:], prev))
+		}
+		require.NoError(t, agg.FinishTx())
+	}
+
+	hr := state.NewHistoryReaderNoState(agg.MakeContext(), agg.Accounts().InvertedIndex.MakeContext(), rs)
+	hr.SetTx(tx)
+	hr.SetTxNum(create2TxNum)
+	ibs := state.New(hr)
+	blockCtx := vm.BlockContext{
+		CanTransfer:     core.CanTransfer,
+		Transfer:        core.Transfer,
+		ContractHasTEVM: func(common.Hash) (bool, error) { return false, nil },
+	}
+	evm := vm.NewEVM(blockCtx, vm.TxContext{}, ibs, params.TestChainConfig, vm.Config{})
+	_, contractAddr, _, err := evm.Create2(vm.AccountRef(factory), nil, 100_000, uint256.NewInt(0), salt)
+	require.NoError(t, err)
+	require.Equal(t, contract, contractAddr)
+	_, readError := hr.ReadError()
+	require.False(t, readError)
+	require.Equal(t, uint64(3), ibs.GetIncarnation(contract))
+
+	w := state.NewStateReconWriter(nil, rs)
+	w.SetTx(tx)
+	w.SetTxNum(create2TxNum)
+	require.NoError(t, ibs.FinalizeTx(params.TestRules, w))
+	enc, err := rs.Get(kv.PlainStateR, contract[:], nil, create2TxNum)
+	require.NoError(t, err)
+	var a accounts.Account
+	require.NoError(t, a.DecodeForStorage(enc))
+	require.Equal(t, uint64(3), a.Incarnation)
+	enc, err = rs.Get(kv.PlainStateR, contract[:], state.ReconIncarnationKey2, create2TxNum)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), binary.BigEndian.Uint64(enc))
+}
+
+// Account a is last changed by txNum 1, contract c by txNum 2, and slots of c by txNums 3 and 6. Later transactions
+// sending from a, or calling c, depend on these changes
+func TestScanReconDependencies(t *testing.T) {
+	db, chainDb := newReconTestDB(t), memdb.NewTestDB(t)
+	a, c := common.Address{1}, common.Address{2}
+	putTxKey := func(tx kv.RwTx, table string, key []byte, txNum uint64) {
+		var txKey [8]byte
+		binary.BigEndian.PutUint64(txKey[:], txNum)
+		require.NoError(t, tx.Put(table, key, txKey[:]))
+	}
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		putTxKey(tx, kv.XAccount, a[:], 1)
+		putTxKey(tx, kv.XAccount, c[:], 2)
+		putTxKey(tx, kv.XStorage, append(c[:], common.Hash{1}.Bytes()...), 3)
+		putTxKey(tx, kv.XStorage, append(c[:], common.Hash{2}.Bytes()...), 6)
+		return nil
+	}))
+
+	agg, err := libstate.NewAggregator22(t.TempDir(), 4)
+	require.NoError(t, err)
+	defer agg.Close()
+	chainTx, err := chainDb.BeginRw(context.Background())
+	require.NoError(t, err)
+	defer chainTx.Rollback()
+	agg.SetTx(chainTx)
+	froms := map[uint64]common.Address{5: a}
+	tos := map[uint64]common.Address{4: c, 7: c, 8: c, 9: c}
+	for txNum := uint64(0); txNum < 12; txNum++ { // builds the files of the first two steps
+		agg.SetTxNum(txNum)
+		if from, ok := froms[txNum]; ok {
+			require.NoError(t, agg.AddTraceFrom(from[:]))
+		}
+		if to, ok := tos[txNum]; ok {
+			require.NoError(t, agg.AddTraceTo(to[:]))
+		}
+		require.NoError(t, agg.FinishTx())
+	}
+	require.NoError(t, chainTx.Commit())
+
+	bitmap := roaring64.BitmapOf(1, 2, 3, 4, 5, 6, 7, 9) // txNum 8 is not replayed
+	logEvery := time.NewTicker(time.Hour)
+	defer logEvery.Stop()
+	count, err := scanReconDependencies(context.Background(), db, chainDb, agg, bitmap, 12, logEvery)
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), count)
+
+	tx, err := db.BeginRo(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+	for txNum, expected := range map[uint64][]uint64{3: nil, 4: {2, 3}, 5: {1}, 7: {2, 6}, 8: nil, 9: {2, 6}} {
+		var txKey [8]byte
+		binary.BigEndian.PutUint64(txKey[:], txNum)
+		dependencies, err := reconDependencies(tx, txKey[:])
+		require.NoError(t, err)
+		require.Equal(t, expected, dependencies, "txNum %d", txNum)
+	}
+}
@@ -0,0 +1,94 @@
+package exec22
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/secp256k1"
+)
+
+// RecoverSender recovers the sender of the transaction, if it has not been recovered by the Senders stage
+// (or it has been skipped), so that the workers do not need a separate pass over the chain. Each worker uses
+// its own crypto context, out of the same set of contexts (one per thread) as the Senders stage
+func RecoverSender(cryptoCtx *secp256k1.Context, chainConfig *params.ChainConfig, txTask *state.TxTask) error {
+	if txTask.Tx == nil || txTask.Sender != nil {
+		return nil
+	}
+	sender, err := types.MakeSigner(chainConfig, txTask.BlockNum).SenderWithContext(cryptoCtx, txTask.Tx)
+	if err != nil {
+		return fmt.Errorf("recovering sender of tx %d in block %d: %w", txTask.TxIndex, txTask.BlockNum, err)
+	}
+	txTask.Tx.SetSender(sender)
+	txTask.Sender = &sender
+	return nil
+}
+
+// SendersRecoverer recovers the senders of the transactions of a block that have not been recovered by the
+// Senders stage, before the transactions are scheduled, so that the dependencies between the transactions of
+// the same sender are known. It is shared by the blocks of the whole run: the signatures of each block are
+// split between its crypto contexts, which are not used by anything else while it runs.
+// secp256k1 does not support batch recovery, so the batch is verified one signature at a time by every context
+type SendersRecoverer struct {
+	chainConfig *params.ChainConfig
+	cryptoCtxs  []*secp256k1.Context
+}
+
+func NewSendersRecoverer(chainConfig *params.ChainConfig, workerCount int) *SendersRecoverer {
+	if workerCount > secp256k1.NumOfContexts() {
+		workerCount = secp256k1.NumOfContexts()
+	}
+	if workerCount < 1 {
+		workerCount = 1
+	}
+	sr := &SendersRecoverer{chainConfig: chainConfig, cryptoCtxs: make([]*secp256k1.Context, workerCount)}
+	for i := range sr.cryptoCtxs {
+		sr.cryptoCtxs[i] = secp256k1.ContextForThread(i)
+	}
+	return sr
+}
+
+// RecoverBlock sets the senders of the transactions of the block that do not have them
+func (sr *SendersRecoverer) RecoverBlock(b *types.Block) error {
+	txs := b.Transactions()
+	var missing []int
+	for txIndex, txn := range txs {
+		if _, ok := txn.GetSender(); !ok {
+			missing = append(missing, txIndex)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	signer := types.MakeSigner(sr.chainConfig, b.NumberU64())
+	workerCount := len(sr.cryptoCtxs)
+	if workerCount > len(missing) {
+		workerCount = len(missing)
+	}
+	errs := make([]error, workerCount)
+	var wg sync.WaitGroup
+	for i := 0; i < workerCount; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := i; j < len(missing); j += workerCount {
+				txn := txs[missing[j]]
+				sender, err := signer.SenderWithContext(sr.cryptoCtxs[i], txn)
+				if err != nil {
+					errs[i] = fmt.Errorf("recovering sender of tx %d in block %d: %w", missing[j], b.NumberU64(), err)
+					return
+				}
+				txn.SetSender(sender)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package exec22
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendersRecoverer(t *testing.T) {
+	signer := types.LatestSignerForChainID(params.TestChainConfig.ChainID)
+	var txs []types.Transaction
+	var senders []common.Address
+	for i := 0; i < 10; i++ {
+		key, err := crypto.GenerateKey()
+		require.NoError(t, err)
+		addr := crypto.PubkeyToAddress(key.PublicKey)
+		txn, err := types.SignTx(types.NewTransaction(0, common.Address{1}, uint256.NewInt(1), params.TxGas, uint256.NewInt(1), nil), *signer, key)
+		require.NoError(t, err)
+		txs = append(txs, txn)
+		senders = append(senders, addr)
+	}
+	// Sender of the first transaction is known already, e.g. recovered by the Senders stage
+	txs[0].SetSender(senders[0])
+	b := types.NewBlock(&types.Header{Number: big.NewInt(1)}, txs, nil, nil)
+	require.NoError(t, NewSendersRecoverer(params.TestChainConfig, 3).RecoverBlock(b))
+	for i, txn := range b.Transactions() {
+		sender, ok := txn.GetSender()
+		require.True(t, ok)
+		require.Equal(t, senders[i], sender)
+	}
+}
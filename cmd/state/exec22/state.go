@@ -4,6 +4,7 @@ import (
 	"context"
 	"math/big"
 	"sync"
+	"time"
 
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/common"
@@ -22,6 +23,7 @@ import (
 )
 
 type Worker22 struct {
+	idx          int // index of the worker in the pool, for work stealing
 	lock         sync.Locker
 	chainDb      kv.RoDB
 	chainTx      kv.Tx
@@ -32,6 +34,7 @@ type Worker22 struct {
 	allSnapshots *snapshotsync.RoSnapshots
 	stateWriter  *state.StateWriter22
 	stateReader  *state.StateReader22
+	timedReader  *state.TimedStateReader
 	getHeader    func(hash common.Hash, number uint64) *types.Header
 	ctx          context.Context
 	engine       consensus.Engine
@@ -71,6 +74,7 @@ func NewWorker22(lock sync.Locker, background bool, chainDb kv.RoDB, wg *sync.Wa
 			return h
 		},
 	}
+	w.timedReader = state.NewTimedStateReader(w.stateReader)
 	w.posa, w.isPoSA = engine.(consensus.PoSA)
 	return w
 }
@@ -93,8 +97,9 @@ func (rw *Worker22) ResetTx(chainTx kv.Tx) {
 
 func (rw *Worker22) Run() {
 	defer rw.wg.Done()
-	for txTask, ok := rw.rs.Schedule(); ok; txTask, ok = rw.rs.Schedule() {
+	for txTask, ok := rw.rs.ScheduleFor(rw.idx); ok; txTask, ok = rw.rs.ScheduleFor(rw.idx) {
 		rw.RunTxTask(txTask)
+		rw.rs.Executed()
 		rw.resultCh <- txTask // Needs to have outside of the lock
 	}
 }
@@ -102,6 +107,7 @@ func (rw *Worker22) Run() {
 func (rw *Worker22) RunTxTask(txTask *state.TxTask) {
 	rw.lock.Lock()
 	defer rw.lock.Unlock()
+	defer func(start time.Time) { rw.timedReader.AddExecTimes(time.Since(start)) }(time.Now())
 	if rw.background && rw.chainTx == nil {
 		var err error
 		if rw.chainTx, err = rw.chainDb.BeginRo(rw.ctx); err != nil {
@@ -116,7 +122,7 @@ func (rw *Worker22) RunTxTask(txTask *state.TxTask) {
 	rw.stateWriter.SetTxNum(txTask.TxNum)
 	rw.stateReader.ResetReadSet()
 	rw.stateWriter.ResetWriteSet()
-	ibs := state.New(rw.stateReader)
+	ibs := state.New(rw.timedReader)
 	rules := txTask.Rules
 	daoForkTx := rw.chainConfig.DAOForkSupport && rw.chainConfig.DAOForkBlock != nil && rw.chainConfig.DAOForkBlock.Uint64() == txTask.BlockNum && txTask.TxIndex == -1
 	var err error
@@ -304,6 +310,7 @@ func NewWorkersPool(lock sync.Locker, background bool, chainDb kv.RoDB, wg *sync
 	resultCh = make(chan *state.TxTask, queueSize)
 	for i := 0; i < workerCount; i++ {
 		reconWorkers[i] = NewWorker22(lock, background, chainDb, wg, rs, blockReader, allSnapshots, chainConfig, logger, genesis, resultCh, engine)
+		reconWorkers[i].idx = i
 	}
 	clear = func() {
 		for i := 0; i < workerCount; i++ {
@@ -22,6 +22,7 @@ import (
 	"github.com/ledgerwatch/erigon/cmd/utils"
 	common2 "github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/common/paths"
+	"github.com/ledgerwatch/erigon/core"
 	"github.com/ledgerwatch/erigon/ethdb/privateapi"
 	"github.com/ledgerwatch/erigon/internal/debug"
 	"github.com/ledgerwatch/erigon/node/nodecfg/datadir"
@@ -47,6 +48,12 @@ var (
 	priceLimit   uint64
 	accountSlots uint64
 	priceBump    uint64
+	replacements uint64
+	maxNonceGap  uint64
+	noNonceGaps  bool
+
+	broadcastLocal bool
+	broadcastPeers []string
 )
 
 func init() {
@@ -68,6 +75,11 @@ func init() {
 	rootCmd.PersistentFlags().Uint64Var(&priceLimit, "txpool.pricelimit", txpool.DefaultConfig.MinFeeCap, "Minimum gas price (fee cap) limit to enforce for acceptance into the pool")
 	rootCmd.PersistentFlags().Uint64Var(&accountSlots, "txpool.accountslots", txpool.DefaultConfig.AccountSlots, "Minimum number of executable transaction slots guaranteed per account")
 	rootCmd.PersistentFlags().Uint64Var(&priceBump, "txpool.pricebump", txpool.DefaultConfig.PriceBump, "Price bump percentage to replace an already existing transaction")
+	rootCmd.PersistentFlags().Uint64Var(&replacements, utils.TxPoolReplacementsFlag.Name, utils.TxPoolReplacementsFlag.Value, utils.TxPoolReplacementsFlag.Usage)
+	rootCmd.PersistentFlags().Uint64Var(&maxNonceGap, utils.TxPoolMaxNonceGapFlag.Name, utils.TxPoolMaxNonceGapFlag.Value, utils.TxPoolMaxNonceGapFlag.Usage)
+	rootCmd.PersistentFlags().BoolVar(&noNonceGaps, utils.TxPoolNoGapsFlag.Name, false, utils.TxPoolNoGapsFlag.Usage)
+	rootCmd.PersistentFlags().BoolVar(&broadcastLocal, utils.TxPoolBroadcastLocalFlag.Name, false, utils.TxPoolBroadcastLocalFlag.Usage)
+	rootCmd.PersistentFlags().StringSliceVar(&broadcastPeers, utils.TxPoolBroadcastPeersFlag.Name, []string{}, utils.TxPoolBroadcastPeersFlag.Usage)
 	rootCmd.Flags().StringSliceVar(&traceSenders, utils.TxPoolTraceSendersFlag.Name, []string{}, utils.TxPoolTraceSendersFlag.Usage)
 }
 
@@ -152,7 +164,11 @@ var rootCmd = &cobra.Command{
 		*/
 		miningGrpcServer := privateapi.NewMiningServer(cmd.Context(), &rpcdaemontest.IsMiningMock{}, nil)
 
-		grpcServer, err := txpool.StartGrpc(txpoolGrpcServer, miningGrpcServer, txpoolApiAddr, nil)
+		policy := core.DeprecatedDefaultTxPoolConfig
+		policy.MaxReplacements = replacements
+		policy.MaxNonceGap, policy.NoNonceGaps = maxNonceGap, noNonceGaps
+		policy.BroadcastLocal, policy.BroadcastPeers = broadcastLocal, broadcastPeers
+		grpcServer, err := txpool.StartGrpc(privateapi.NewTxPoolServer(txpoolGrpcServer, coreDB, sentryClients, policy), miningGrpcServer, txpoolApiAddr, nil)
 		if err != nil {
 			return err
 		}
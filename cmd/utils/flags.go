@@ -29,6 +29,7 @@ import (
 	"strings"
 	"text/tabwriter"
 	"text/template"
+	"time"
 
 	"github.com/c2h5oh/datasize"
 	"github.com/ledgerwatch/erigon-lib/common/cmp"
@@ -54,12 +55,14 @@ import (
 	"github.com/ledgerwatch/erigon/crypto"
 	"github.com/ledgerwatch/erigon/eth/ethconfig"
 	"github.com/ledgerwatch/erigon/eth/gasprice"
+	"github.com/ledgerwatch/erigon/eth/tracers"
 	"github.com/ledgerwatch/erigon/metrics"
 	"github.com/ledgerwatch/erigon/p2p"
 	"github.com/ledgerwatch/erigon/p2p/enode"
 	"github.com/ledgerwatch/erigon/p2p/nat"
 	"github.com/ledgerwatch/erigon/p2p/netutil"
 	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/turbo/transactions"
 )
 
 func init() {
@@ -187,6 +190,29 @@ var (
 		Usage: "Price bump percentage to replace an already existing transaction",
 		Value: txpool.DefaultConfig.PriceBump,
 	}
+	TxPoolReplacementsFlag = cli.Uint64Flag{
+		Name:  "txpool.replacements",
+		Usage: "Maximum number of times a transaction submitted over RPC may be replaced by one of the same sender and nonce, 0 - unlimited",
+		Value: ethconfig.Defaults.DeprecatedTxPool.MaxReplacements,
+	}
+	TxPoolMaxNonceGapFlag = cli.Uint64Flag{
+		Name:  "txpool.maxnoncegap",
+		Usage: "Maximum number of nonces a transaction submitted over RPC may skip after the next nonce of the sender, 0 - unlimited",
+		Value: ethconfig.Defaults.DeprecatedTxPool.MaxNonceGap,
+	}
+	TxPoolNoGapsFlag = cli.BoolFlag{
+		Name:  "txpool.nogaps",
+		Usage: "Reject the transactions submitted over RPC which skip a nonce of the sender (sequencer-style)",
+	}
+	TxPoolBroadcastLocalFlag = cli.BoolFlag{
+		Name:  "txpool.broadcast.local",
+		Usage: "Send the transactions submitted over RPC to all peers right away, instead of announcing them to most peers",
+	}
+	TxPoolBroadcastPeersFlag = cli.StringFlag{
+		Name:  "txpool.broadcast.peers",
+		Usage: "Comma separated enode URLs of the peers the transactions submitted over RPC are sent to right away",
+		Value: "",
+	}
 	TxPoolAccountSlotsFlag = cli.Uint64Flag{
 		Name:  "txpool.accountslots",
 		Usage: "Minimum number of executable transaction slots guaranteed per account",
@@ -348,6 +374,19 @@ var (
 		Name:  "ws.compression",
 		Usage: "Enable compression over WebSocket",
 	}
+	WsSendQueueFlag = cli.IntFlag{
+		Name:  "ws.sendqueue",
+		Usage: "Notifications queued for a slow WebSocket client, over which --ws.sendqueue.policy applies. 0 - the notifications wait until the client reads them",
+	}
+	WsSendQueuePolicyFlag = cli.StringFlag{
+		Name:  "ws.sendqueue.policy",
+		Usage: "What happens to the notifications over --ws.sendqueue: drop - they are dropped, disconnect - the client is disconnected",
+		Value: "drop",
+	}
+	WsSubscriptionsMaxFlag = cli.IntFlag{
+		Name:  "ws.subscriptions.max",
+		Usage: "Max amount of WebSocket subscriptions per client IP address. 0 - unlimited",
+	}
 	HTTPCORSDomainFlag = cli.StringFlag{
 		Name:  "http.corsdomain",
 		Usage: "Comma separated list of domains from which to accept cross origin requests (browser enforced)",
@@ -373,6 +412,20 @@ var (
 		Usage: "Does limit amount of goroutines to process 1 batch request. Means 1 bach request can't overload server. 1 batch still can have unlimited amount of request",
 		Value: 2,
 	}
+	RpcGetLogsParallelFlag = cli.UintFlag{
+		Name:  "rpc.getlogs.parallel",
+		Usage: "Max amount of snapshot segments (500K blocks) eth_getLogs reads in parallel. 0 or 1 - sequential",
+		Value: 4,
+	}
+	RpcTraceBlockParallelFlag = cli.UintFlag{
+		Name:  "rpc.traceblock.parallel",
+		Usage: "Max amount of transactions debug_traceBlockByNumber/ByHash traces in parallel. 0 or 1 - sequential",
+		Value: 4,
+	}
+	RpcTimestampIndexFlag = cli.BoolFlag{
+		Name:  "rpc.timestampindex",
+		Usage: "Keep in memory the timestamp of every 1024th block of the snapshots, to read less headers in erigon_getBlockByTimestamp",
+	}
 	RpcStreamingDisableFlag = cli.BoolFlag{
 		Name:  "rpc.streaming.disable",
 		Usage: "Erigon has enalbed json streaming for some heavy endpoints (like trace_*). It's treadoff: greatly reduce amount of RAM (in some cases from 30GB to 30mb), but it produce invalid json format if error happened in the middle of streaming (because json is not streaming-friendly format)",
@@ -390,12 +443,90 @@ var (
 		Name:  "rpc.accessList",
 		Usage: "Specify granular (method-by-method) API allowlist",
 	}
+	RpcLanesFlag = cli.StringFlag{
+		Name:  "rpc.lanes",
+		Usage: "Serve the light, heavy (trace_, debug_, eth_getLogs, ...) and subscription requests by separate pools of workers, with the limits of their queues, e.g. light=64/1024,heavy=8/256,subscription=16/64",
+	}
+	RpcViewsMaxFlag = cli.IntFlag{
+		Name:  "rpc.views.max",
+		Usage: "Max amount of database views pinned at once by erigon_pinView, which the requests with the X-Erigon-View header read. 0 - disabled",
+	}
+	RpcViewsTTLFlag = cli.DurationFlag{
+		Name:  "rpc.views.ttl",
+		Usage: "Time after its last use after which a view pinned by erigon_pinView is released",
+		Value: 30 * time.Second,
+	}
+	RpcApiKeysFlag = cli.StringFlag{
+		Name:  "rpc.apikeys",
+		Usage: "JSON file with the API keys required from the clients (X-Api-Key header, or apikey query parameter of websocket) and the methods each of them may call, reloaded on change, e.g. {\"key1\": [\"eth_*\", \"debug_*\"], \"key2\": [\"eth_call\"]}",
+	}
+	RpcAuditFileFlag = cli.StringFlag{
+		Name:  "rpc.audit.file",
+		Usage: "File the audit log of the calls (method, params hash, latency, bytes, caller) is appended to as JSON lines. Empty - disabled",
+	}
+	RpcAuditSampleFlag = cli.Float64Flag{
+		Name:  "rpc.audit.sample",
+		Usage: "Share of the calls written to --rpc.audit.file, from 0 to 1",
+		Value: 0.01,
+	}
+	RpcAuditSlowFlag = cli.DurationFlag{
+		Name:  "rpc.audit.slow",
+		Usage: "The calls lasting longer are written to --rpc.audit.file with their params, whatever the sampling. 0 - disabled",
+		Value: time.Second,
+	}
+	RpcLocalTxsJournalFlag = cli.StringFlag{
+		Name:  "rpc.localtxs.journal",
+		Usage: "File journaling the transactions sent by eth_sendRawTransaction, which are submitted to the txpool again while they are not mined. Empty - disabled",
+	}
+	RpcLocalTxsResubmitFlag = cli.DurationFlag{
+		Name:  "rpc.localtxs.resubmit",
+		Usage: "How often the local transactions missing from the txpool are submitted to it again",
+		Value: time.Minute,
+	}
+	RpcTxsPerClientFlag = cli.IntFlag{
+		Name:  "rpc.txs.perclient",
+		Usage: "Max transactions sent by eth_sendRawTransaction which each client, by API key or IP address, may have in the txpool at once. 0 - unlimited",
+	}
+	RpcTxsPerSenderFlag = cli.IntFlag{
+		Name:  "rpc.txs.persender",
+		Usage: "Max transactions sent by eth_sendRawTransaction which each sender may have in the txpool at once. 0 - unlimited",
+	}
+	RpcRateLimitsFlag = cli.StringFlag{
+		Name:  "rpc.ratelimits",
+		Usage: "JSON file with the limits of the calls per method, per API key (X-Api-Key header) or IP address, e.g. {\"methods\": {\"eth_call\": {\"rate\": 100}, \"debug_traceBlockByNumber\": {\"concurrency\": 5}}}",
+	}
 
 	RpcGasCapFlag = cli.UintFlag{
 		Name:  "rpc.gascap",
 		Usage: "Sets a cap on gas that can be used in eth_call/estimateGas",
 		Value: 50000000,
 	}
+	RpcEvmTimeoutFlag = cli.DurationFlag{
+		Name:  "rpc.evmtimeout",
+		Usage: "Maximum time of the execution of eth_call and of each execution of eth_estimateGas. 0 - no limit",
+		Value: transactions.DefaultCallTimeout,
+	}
+	RpcEvmMemoryFlag = cli.Uint64Flag{
+		Name:  "rpc.evmmemory",
+		Usage: "Maximum memory (bytes) of each call frame of eth_call/estimateGas. 0 - no limit",
+	}
+	RpcCallBudgetMaxGasFlag = cli.Uint64Flag{
+		Name:  "rpc.callbudget.maxgas",
+		Usage: "Ceiling up to which the requests authenticated with the JWT secret may raise the gas cap of eth_call/estimateGas by the X-Call-Budget header. 0 - can't be raised",
+	}
+	RpcCallBudgetMaxTimeoutFlag = cli.DurationFlag{
+		Name:  "rpc.callbudget.maxtimeout",
+		Usage: "Ceiling up to which the requests authenticated with the JWT secret may raise --rpc.evmtimeout by the X-Call-Budget header. 0 - can't be raised",
+	}
+	RpcCallBudgetMaxMemoryFlag = cli.Uint64Flag{
+		Name:  "rpc.callbudget.maxmemory",
+		Usage: "Ceiling up to which the requests authenticated with the JWT secret may raise --rpc.evmmemory by the X-Call-Budget header. 0 - can't be raised",
+	}
+	RpcTracerOpBudgetFlag = cli.Uint64Flag{
+		Name:  "rpc.tracer.opbudget",
+		Usage: "Maximum number of opcodes each JavaScript tracer of debug_trace* is called for. 0 - no limit",
+		Value: tracers.DefaultOpBudget,
+	}
 	RpcTraceCompatFlag = cli.BoolFlag{
 		Name:  "trace.compat",
 		Usage: "Bug for bug compatibility with OE for trace_ routines",
@@ -425,6 +556,25 @@ var (
 		Usage: "Sets a limit on traces that can be returned in trace_filter",
 		Value: 200,
 	}
+	TraceMaxVmTraceOpsFlag = cli.Uint64Flag{
+		Name:  "trace.vmtrace.maxops",
+		Usage: "Sets a limit on operations recorded in the vmTrace of one transaction. 0 - no limit",
+		Value: 1_000_000,
+	}
+	RpcDebugDbFlag = cli.BoolFlag{
+		Name:  "rpc.debugdb",
+		Usage: "Serve debug_dbGet and debug_dbDump, reading raw keys of the chain database, on the port authenticated by the JWT secret (--authrpc.port)",
+	}
+	RpcSharedStateCacheFlag = cli.Uint64Flag{
+		Name:  "rpc.sharedstatecache",
+		Usage: "Maximum size (bytes) of the historical accounts, storage and code cached for the concurrent calls reading the same blocks. 0 - disabled",
+		Value: 64 * 1024 * 1024,
+	}
+	RpcDebugDbMaxDumpFlag = cli.Uint64Flag{
+		Name:  "rpc.debugdb.maxdump",
+		Usage: "Sets a limit on entries returned by one call of debug_dbDump",
+		Value: 1_000,
+	}
 
 	HTTPPathPrefixFlag = cli.StringFlag{
 		Name:  "http.rpcprefix",
@@ -607,6 +757,11 @@ var (
 		Usage: "Maximum gas price will be recommended by gpo",
 		Value: ethconfig.Defaults.GPO.MaxPrice.Int64(),
 	}
+	GpoEstimatorFlag = cli.StringFlag{
+		Name:  "gpo.estimator",
+		Usage: "Algorithm of the suggested gas tip: 'percentile' of the tips of the recent transactions, or 'ewma' - moving average of the percentiles of the recent blocks, newer blocks having more weight",
+		Value: gasprice.PercentileEstimator,
+	}
 
 	// Metrics flags
 	MetricsEnabledFlag = cli.BoolFlag{
@@ -709,6 +864,16 @@ var (
 		Value: 10,
 		Usage: "connections per file",
 	}
+	TorrentRateScheduleFlag = cli.StringFlag{
+		Name:  "torrent.rate.schedule",
+		Value: "",
+		Usage: "download/upload rates by time of day, overrides --torrent.download.rate and --torrent.upload.rate, example: 01:00=512mb/128mb,07:00=16mb/4mb",
+	}
+	TorrentWebSeedsFlag = cli.StringFlag{
+		Name:  "torrent.webseeds",
+		Value: "",
+		Usage: "comma separated http(s) urls of servers with .seg files of the network, to download them also by http when there are not enough seeders, example: https://snapshots.example.org/mainnet/",
+	}
 	DbPageSizeFlag = cli.StringFlag{
 		Name:  "db.pagesize",
 		Usage: "set mdbx pagesize on db creation: must be power of 2 and '256b <= pagesize <= 64kb'. default: equal to OperationSystem's pageSize",
@@ -1185,6 +1350,9 @@ func setGPO(ctx *cli.Context, cfg *gasprice.Config) {
 	if ctx.GlobalIsSet(GpoMaxGasPriceFlag.Name) {
 		cfg.MaxPrice = big.NewInt(ctx.GlobalInt64(GpoMaxGasPriceFlag.Name))
 	}
+	if ctx.GlobalIsSet(GpoEstimatorFlag.Name) {
+		cfg.Estimator = ctx.GlobalString(GpoEstimatorFlag.Name)
+	}
 }
 
 // nolint
@@ -1223,6 +1391,26 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolPriceBumpFlag.Name) {
 		cfg.PriceBump = ctx.GlobalUint64(TxPoolPriceBumpFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolReplacementsFlag.Name) {
+		cfg.MaxReplacements = ctx.GlobalUint64(TxPoolReplacementsFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolMaxNonceGapFlag.Name) {
+		cfg.MaxNonceGap = ctx.GlobalUint64(TxPoolMaxNonceGapFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolNoGapsFlag.Name) {
+		cfg.NoNonceGaps = ctx.GlobalBool(TxPoolNoGapsFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolBroadcastLocalFlag.Name) {
+		cfg.BroadcastLocal = ctx.GlobalBool(TxPoolBroadcastLocalFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolBroadcastPeersFlag.Name) {
+		for _, url := range SplitAndTrim(ctx.GlobalString(TxPoolBroadcastPeersFlag.Name)) {
+			if _, err := enode.ParseV4(url); err != nil {
+				Fatalf("Invalid enode in --%s: %s", TxPoolBroadcastPeersFlag.Name, err)
+			}
+			cfg.BroadcastPeers = append(cfg.BroadcastPeers, url)
+		}
+	}
 	if ctx.GlobalIsSet(TxPoolAccountSlotsFlag.Name) {
 		cfg.AccountSlots = ctx.GlobalUint64(TxPoolAccountSlotsFlag.Name)
 	}
@@ -1463,7 +1651,11 @@ func SetEthConfig(ctx *cli.Context, nodeConfig *nodecfg.Config, cfg *ethconfig.C
 			panic(err)
 		}
 		log.Info("torrent verbosity", "level", lvl.LogString())
-		cfg.Downloader, err = downloadercfg.New(cfg.Dirs.Snap, lvl, dbg, nodeConfig.P2P.NAT, downloadRate, uploadRate, ctx.GlobalInt(TorrentPortFlag.Name), ctx.GlobalInt(TorrentConnsPerFileFlag.Name), ctx.GlobalInt(TorrentDownloadSlotsFlag.Name))
+		cfg.Downloader, err = downloadercfg.New(cfg.Dirs.Snap, lvl, dbg, nodeConfig.P2P.NAT, downloadRate, uploadRate, ctx.GlobalInt(TorrentPortFlag.Name), ctx.GlobalInt(TorrentConnsPerFileFlag.Name), ctx.GlobalInt(TorrentDownloadSlotsFlag.Name), SplitAndTrim(ctx.GlobalString(TorrentWebSeedsFlag.Name)))
+		if err != nil {
+			panic(err)
+		}
+		cfg.Downloader.RateSchedule, err = downloadercfg.ParseRateSchedule(ctx.GlobalString(TorrentRateScheduleFlag.Name))
 		if err != nil {
 			panic(err)
 		}
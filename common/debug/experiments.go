@@ -82,3 +82,70 @@ func StopBeforeStage() string {
 	stopBeforeStageFlag.Do(f)
 	return stopBeforeStage
 }
+
+var (
+	exec22RecordLog     string
+	exec22RecordLogFlag sync.Once
+)
+
+// Exec22RecordLog - file to record the schedule, rollbacks and commits of parallel execution into (DEBUG_EXEC22_RECORD)
+func Exec22RecordLog() string {
+	exec22RecordLogFlag.Do(func() {
+		exec22RecordLog, _ = os.LookupEnv("DEBUG_EXEC22_RECORD")
+	})
+	return exec22RecordLog
+}
+
+var (
+	exec22ReplayLog     string
+	exec22ReplayLogFlag sync.Once
+)
+
+// Exec22ReplayLog - file recorded with DEBUG_EXEC22_RECORD, to re-execute transactions in the same interleaving (DEBUG_EXEC22_REPLAY)
+func Exec22ReplayLog() string {
+	exec22ReplayLogFlag.Do(func() {
+		exec22ReplayLog, _ = os.LookupEnv("DEBUG_EXEC22_REPLAY")
+	})
+	return exec22ReplayLog
+}
+
+var (
+	fusedSenders     bool
+	fusedSendersFlag sync.Once
+)
+
+// FusedSenders - skip the Senders stage if exec22 is the executor, which recovers senders of each block before scheduling it (DEBUG_FUSED_SENDERS)
+func FusedSenders() bool {
+	fusedSendersFlag.Do(func() {
+		v, _ := os.LookupEnv("DEBUG_FUSED_SENDERS")
+		fusedSenders = v == "true"
+	})
+	return fusedSenders
+}
+
+var (
+	prefetchState     bool
+	prefetchStateFlag sync.Once
+)
+
+// PrefetchState - read the state referenced by the blocks ahead of the Execution stage, to warm up the page cache (DEBUG_PREFETCH_STATE)
+func PrefetchState() bool {
+	prefetchStateFlag.Do(func() {
+		v, _ := os.LookupEnv("DEBUG_PREFETCH_STATE")
+		prefetchState = v == "true"
+	})
+	return prefetchState
+}
+
+var (
+	exec22RWSetsLog     string
+	exec22RWSetsLogFlag sync.Once
+)
+
+// Exec22RWSetsLog - file to record the read and write sets of the transactions applied by parallel execution into (DEBUG_EXEC22_RWSETS)
+func Exec22RWSetsLog() string {
+	exec22RWSetsLogFlag.Do(func() {
+		exec22RWSetsLog, _ = os.LookupEnv("DEBUG_EXEC22_RWSETS")
+	})
+	return exec22RWSetsLog
+}
@@ -0,0 +1,214 @@
+package rawdb
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+)
+
+// Tables of the contract index served by the ots2_ RPC commands, filled by the optional OtsContracts stage
+const (
+	// contract address -> block number (8 bytes) + transaction hash (32 bytes) + creator address (20 bytes)
+	OtsContractCreations = "OtsContractCreations"
+	// ordinal (8 bytes) -> contract address (20 bytes) + block number (8 bytes), in the order of deployment
+	OtsAllContracts = "OtsAllContracts"
+	OtsERC20        = "OtsERC20"
+	OtsERC721       = "OtsERC721"
+	// address -> AddressAttributes (1 byte), only for addresses with at least one attribute
+	OtsAddressAttributes = "OtsAddressAttributes"
+)
+
+// OtsTables are the tables of the contract index, added to the chain database by WithOtsTables
+var OtsTables = []string{
+	OtsContractCreations,
+	OtsAllContracts,
+	OtsERC20,
+	OtsERC721,
+	OtsAddressAttributes,
+}
+
+// WithOtsTables adds the tables of the contract index to the configuration of the chain database
+func WithOtsTables(defaultBuckets kv.TableCfg) kv.TableCfg {
+	cfg := kv.TableCfg{}
+	for table, tableCfg := range defaultBuckets {
+		cfg[table] = tableCfg
+	}
+	for _, table := range OtsTables {
+		cfg[table] = kv.TableCfgItem{}
+	}
+	return cfg
+}
+
+// AddressAttributes is the set of the properties found by the probes of the code of a contract
+type AddressAttributes uint8
+
+const (
+	AttrERC20 AddressAttributes = 1 << iota
+	AttrERC721
+)
+
+// ContractCreation is the transaction which deployed a contract
+type ContractCreation struct {
+	Creator     common.Address
+	Hash        common.Hash
+	BlockNumber uint64
+}
+
+// ContractListEntry is an entry of OtsAllContracts, OtsERC20 or OtsERC721
+type ContractListEntry struct {
+	Address     common.Address
+	BlockNumber uint64
+}
+
+func ReadContractCreation(db kv.Getter, addr common.Address) (*ContractCreation, error) {
+	v, err := db.GetOne(OtsContractCreations, addr[:])
+	if err != nil {
+		return nil, err
+	}
+	if len(v) == 0 {
+		return nil, nil
+	}
+	if len(v) != 8+common.HashLength+common.AddressLength {
+		return nil, fmt.Errorf("invalid contract creation of %x: %x", addr, v)
+	}
+	return &ContractCreation{
+		BlockNumber: binary.BigEndian.Uint64(v),
+		Hash:        common.BytesToHash(v[8 : 8+common.HashLength]),
+		Creator:     common.BytesToAddress(v[8+common.HashLength:]),
+	}, nil
+}
+
+func WriteContractCreation(db kv.Putter, addr common.Address, creation ContractCreation) error {
+	v := make([]byte, 8+common.HashLength+common.AddressLength)
+	binary.BigEndian.PutUint64(v, creation.BlockNumber)
+	copy(v[8:], creation.Hash[:])
+	copy(v[8+common.HashLength:], creation.Creator[:])
+	return db.Put(OtsContractCreations, addr[:], v)
+}
+
+func ReadAddressAttributes(db kv.Getter, addr common.Address) (AddressAttributes, error) {
+	v, err := db.GetOne(OtsAddressAttributes, addr[:])
+	if err != nil {
+		return 0, err
+	}
+	if len(v) == 0 {
+		return 0, nil
+	}
+	return AddressAttributes(v[0]), nil
+}
+
+func WriteAddressAttributes(db kv.Putter, addr common.Address, attrs AddressAttributes) error {
+	return db.Put(OtsAddressAttributes, addr[:], []byte{byte(attrs)})
+}
+
+// ReadContractListCount returns the number of entries of OtsAllContracts, OtsERC20 or OtsERC721
+func ReadContractListCount(tx kv.Tx, table string) (uint64, error) {
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+	k, _, err := c.Last()
+	if err != nil {
+		return 0, err
+	}
+	if k == nil {
+		return 0, nil
+	}
+	return binary.BigEndian.Uint64(k) + 1, nil
+}
+
+// ReadContractList returns at most count entries of OtsAllContracts, OtsERC20 or OtsERC721, starting from the
+// ordinal idx
+func ReadContractList(tx kv.Tx, table string, idx, count uint64) ([]ContractListEntry, error) {
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	var entries []ContractListEntry
+	for k, v, err := c.Seek(dbutils.EncodeBlockNumber(idx)); k != nil && uint64(len(entries)) < count; k, v, err = c.Next() {
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, ContractListEntry{
+			Address:     common.BytesToAddress(v[:common.AddressLength]),
+			BlockNumber: binary.BigEndian.Uint64(v[common.AddressLength:]),
+		})
+	}
+	return entries, nil
+}
+
+// AppendContractList appends the contract to OtsAllContracts, OtsERC20 or OtsERC721
+func AppendContractList(tx kv.RwTx, table string, entry ContractListEntry) error {
+	n, err := ReadContractListCount(tx, table)
+	if err != nil {
+		return err
+	}
+	v := make([]byte, common.AddressLength+8)
+	copy(v, entry.Address[:])
+	binary.BigEndian.PutUint64(v[common.AddressLength:], entry.BlockNumber)
+	return tx.Append(table, dbutils.EncodeBlockNumber(n), v)
+}
+
+// TruncateContractIndex removes from the contract index the contracts deployed after the block
+func TruncateContractIndex(tx kv.RwTx, blockNum uint64) error {
+	for _, table := range []string{OtsERC20, OtsERC721, OtsAllContracts} {
+		entries, keys, err := contractListTail(tx, table, blockNum)
+		if err != nil {
+			return err
+		}
+		for i, k := range keys {
+			if err = tx.Delete(table, k); err != nil {
+				return err
+			}
+			if table != OtsAllContracts {
+				continue
+			}
+			creation, err := ReadContractCreation(tx, entries[i].Address)
+			if err != nil {
+				return err
+			}
+			// Already removed with a later deployment at the same address
+			if creation == nil || creation.BlockNumber <= blockNum {
+				continue
+			}
+			if err = tx.Delete(OtsContractCreations, entries[i].Address[:]); err != nil {
+				return err
+			}
+			if err = tx.Delete(OtsAddressAttributes, entries[i].Address[:]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// contractListTail returns the entries of the list of contracts deployed after the block, with their keys
+func contractListTail(tx kv.Tx, table string, blockNum uint64) ([]ContractListEntry, [][]byte, error) {
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer c.Close()
+	var entries []ContractListEntry
+	var keys [][]byte
+	for k, v, err := c.Last(); k != nil; k, v, err = c.Prev() {
+		if err != nil {
+			return nil, nil, err
+		}
+		entry := ContractListEntry{
+			Address:     common.BytesToAddress(v[:common.AddressLength]),
+			BlockNumber: binary.BigEndian.Uint64(v[common.AddressLength:]),
+		}
+		if entry.BlockNumber <= blockNum {
+			break
+		}
+		entries = append(entries, entry)
+		keys = append(keys, common.CopyBytes(k))
+	}
+	return entries, keys, nil
+}
@@ -0,0 +1,90 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+type changeSetEntry struct {
+	k, v []byte
+}
+
+// ChangeSetBuffer accumulates the encoded changesets of consecutive blocks in memory, and writes them into the
+// database at once. The entries of a block are sorted by the encoding, and the blocks are added in increasing order,
+// so all the entries are appended through one cursor per table, instead of a lookup in the tree for each of them
+type ChangeSetBuffer struct {
+	accounts  []changeSetEntry
+	storage   []changeSetEntry
+	lastBlock uint64
+	size      int
+}
+
+func NewChangeSetBuffer() *ChangeSetBuffer {
+	return &ChangeSetBuffer{}
+}
+
+func (b *ChangeSetBuffer) add(table string, blockNumber uint64, k, v []byte) error {
+	if b.Len() > 0 && blockNumber < b.lastBlock {
+		return fmt.Errorf("changesets of block %d added after block %d", blockNumber, b.lastBlock)
+	}
+	b.lastBlock = blockNumber
+	b.size += len(k) + len(v)
+	switch table {
+	case kv.AccountChangeSet:
+		b.accounts = append(b.accounts, changeSetEntry{k: k, v: v})
+	case kv.StorageChangeSet:
+		b.storage = append(b.storage, changeSetEntry{k: k, v: v})
+	default:
+		return fmt.Errorf("unexpected changeset table %s", table)
+	}
+	return nil
+}
+
+// Len is the number of buffered entries
+func (b *ChangeSetBuffer) Len() int {
+	return len(b.accounts) + len(b.storage)
+}
+
+// Size is the size of the buffered keys and values, in bytes
+func (b *ChangeSetBuffer) Size() int {
+	return b.size
+}
+
+// Flush appends the buffered changesets to the tables, and empties the buffer. The changesets of the blocks
+// already in the tables must precede the buffered ones
+func (b *ChangeSetBuffer) Flush(tx kv.RwTx) error {
+	if err := appendChangeSets(tx, kv.AccountChangeSet, b.accounts); err != nil {
+		return err
+	}
+	if err := appendChangeSets(tx, kv.StorageChangeSet, b.storage); err != nil {
+		return err
+	}
+	b.accounts, b.storage, b.size = b.accounts[:0], b.storage[:0], 0
+	return nil
+}
+
+func appendChangeSets(tx kv.RwTx, table string, entries []changeSetEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	c, err := tx.RwCursorDupSort(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	var prev changeSetEntry
+	for i, e := range entries {
+		if i > 0 {
+			if cmp := bytes.Compare(prev.k, e.k); cmp > 0 || (cmp == 0 && bytes.Compare(prev.v, e.v) >= 0) {
+				return fmt.Errorf("%s: changeset entries are not sorted, key %x after %x", table, e.k, prev.k)
+			}
+		}
+		if err = c.AppendDup(e.k, e.v); err != nil {
+			return fmt.Errorf("%s: appending %x: %w", table, e.k, err)
+		}
+		prev = e
+	}
+	return nil
+}
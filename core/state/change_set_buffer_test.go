@@ -0,0 +1,60 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeSetBuffer(t *testing.T) {
+	_, direct := memdb.NewTestTx(t)
+	_, buffered := memdb.NewTestTx(t)
+	buffer := NewChangeSetBuffer()
+
+	writeBlock := func(db kv.RwTx, buffer *ChangeSetBuffer, blockNumber uint64) {
+		w := NewChangeSetWriterPlain(db, blockNumber).SetBuffer(buffer)
+		for i := uint64(0); i < 3; i++ {
+			address := common.BytesToAddress([]byte{byte(i + 1), byte(blockNumber)})
+			original, account := accounts.NewAccount(), accounts.NewAccount()
+			original.Nonce, account.Nonce = blockNumber, blockNumber+1
+			location := common.BytesToHash([]byte{byte(3 - i)})
+			require.NoError(t, w.WriteAccountStorage(address, FirstContractIncarnation, &location, uint256.NewInt(blockNumber), uint256.NewInt(blockNumber+1)))
+			require.NoError(t, w.UpdateAccountData(address, &original, &account))
+		}
+		require.NoError(t, w.WriteChangeSets())
+	}
+	for blockNumber := uint64(1); blockNumber <= 3; blockNumber++ {
+		writeBlock(direct, nil, blockNumber)
+		writeBlock(buffered, buffer, blockNumber)
+	}
+	require.Equal(t, 12, buffer.Len())
+
+	readAll := func(db kv.Tx, table string) (entries [][2][]byte) {
+		require.NoError(t, db.ForEach(table, nil, func(k, v []byte) error {
+			entries = append(entries, [2][]byte{common.CopyBytes(k), common.CopyBytes(v)})
+			return nil
+		}))
+		return entries
+	}
+	require.Empty(t, readAll(buffered, kv.AccountChangeSet))
+	require.NoError(t, buffer.Flush(buffered))
+	require.Zero(t, buffer.Len())
+	for _, table := range []string{kv.AccountChangeSet, kv.StorageChangeSet} {
+		expected := readAll(direct, table)
+		require.NotEmpty(t, expected)
+		require.Equal(t, expected, readAll(buffered, table))
+	}
+
+	// Blocks must be added in order
+	writeBlock(buffered, buffer, 5)
+	w := NewChangeSetWriterPlain(buffered, 4).SetBuffer(buffer)
+	original, account := accounts.NewAccount(), accounts.NewAccount()
+	account.Nonce = 1
+	require.NoError(t, w.UpdateAccountData(common.HexToAddress("0x01"), &original, &account))
+	require.Error(t, w.WriteChangeSets())
+}
@@ -20,6 +20,7 @@ type ChangeSetWriter struct {
 	storageChanged map[common.Address]bool
 	storageChanges map[string][]byte
 	blockNumber    uint64
+	buffer         *ChangeSetBuffer
 }
 
 func NewChangeSetWriter() *ChangeSetWriter {
@@ -39,6 +40,19 @@ func NewChangeSetWriterPlain(db kv.RwTx, blockNumber uint64) *ChangeSetWriter {
 	}
 }
 
+// SetBuffer makes WriteChangeSets add the changesets to the buffer, instead of writing them into the database
+func (w *ChangeSetWriter) SetBuffer(buffer *ChangeSetBuffer) *ChangeSetWriter {
+	w.buffer = buffer
+	return w
+}
+
+func (w *ChangeSetWriter) appendDup(table string) func(k, v []byte) error {
+	if w.buffer != nil {
+		return func(k, v []byte) error { return w.buffer.add(table, w.blockNumber, k, v) }
+	}
+	return func(k, v []byte) error { return w.db.AppendDup(table, k, v) }
+}
+
 func (w *ChangeSetWriter) GetAccountChanges() (*changeset.ChangeSet, error) {
 	cs := changeset.NewAccountChangeSet()
 	for address, val := range w.accountChanges {
@@ -128,12 +142,7 @@ func (w *ChangeSetWriter) WriteChangeSets() error {
 	if err != nil {
 		return err
 	}
-	if err = changeset.Mapper[kv.AccountChangeSet].Encode(w.blockNumber, accountChanges, func(k, v []byte) error {
-		if err = w.db.AppendDup(kv.AccountChangeSet, k, v); err != nil {
-			return err
-		}
-		return nil
-	}); err != nil {
+	if err = changeset.Mapper[kv.AccountChangeSet].Encode(w.blockNumber, accountChanges, w.appendDup(kv.AccountChangeSet)); err != nil {
 		return err
 	}
 
@@ -144,12 +153,7 @@ func (w *ChangeSetWriter) WriteChangeSets() error {
 	if storageChanges.Len() == 0 {
 		return nil
 	}
-	if err = changeset.Mapper[kv.StorageChangeSet].Encode(w.blockNumber, storageChanges, func(k, v []byte) error {
-		if err = w.db.AppendDup(kv.StorageChangeSet, k, v); err != nil {
-			return err
-		}
-		return nil
-	}); err != nil {
+	if err = changeset.Mapper[kv.StorageChangeSet].Encode(w.blockNumber, storageChanges, w.appendDup(kv.StorageChangeSet)); err != nil {
 		return err
 	}
 	return nil
@@ -38,6 +38,55 @@ type StateReader interface {
 	ReadAccountIncarnation(address common.Address) (uint64, error)
 }
 
+// BatchStateReader is implemented by the readers which read many items at once cheaper than one by one, e.g. by
+// setting up one cursor for all of them, or making one round trip to remote kv. Results are in the order of
+// the arguments. ReadAccountsData and ReadAccountStorages read with any StateReader
+type BatchStateReader interface {
+	StateReader
+	ReadAccountsData(addresses []common.Address) ([]*accounts.Account, error)
+	ReadAccountStorages(address common.Address, incarnation uint64, keys []common.Hash) ([][]byte, error)
+}
+
+// ReadAccountsData reads the accounts in one batch if the reader supports it, and one by one otherwise
+func ReadAccountsData(r StateReader, addresses []common.Address) ([]*accounts.Account, error) {
+	if br, ok := r.(BatchStateReader); ok {
+		return br.ReadAccountsData(addresses)
+	}
+	return readAccountsOneByOne(r, addresses)
+}
+
+func readAccountsOneByOne(r StateReader, addresses []common.Address) ([]*accounts.Account, error) {
+	result := make([]*accounts.Account, len(addresses))
+	for i := range addresses {
+		a, err := r.ReadAccountData(addresses[i])
+		if err != nil {
+			return nil, err
+		}
+		result[i] = a
+	}
+	return result, nil
+}
+
+// ReadAccountStorages reads the storage slots in one batch if the reader supports it, and one by one otherwise
+func ReadAccountStorages(r StateReader, address common.Address, incarnation uint64, keys []common.Hash) ([][]byte, error) {
+	if br, ok := r.(BatchStateReader); ok {
+		return br.ReadAccountStorages(address, incarnation, keys)
+	}
+	return readStoragesOneByOne(r, address, incarnation, keys)
+}
+
+func readStoragesOneByOne(r StateReader, address common.Address, incarnation uint64, keys []common.Hash) ([][]byte, error) {
+	result := make([][]byte, len(keys))
+	for i := range keys {
+		v, err := r.ReadAccountStorage(address, incarnation, &keys[i])
+		if err != nil {
+			return nil, err
+		}
+		result[i] = v
+	}
+	return result, nil
+}
+
 type StateWriter interface {
 	UpdateAccountData(address common.Address, original, account *accounts.Account) error
 	UpdateAccountCode(address common.Address, incarnation uint64, codeHash common.Hash, code []byte) error
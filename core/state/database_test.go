@@ -1665,3 +1665,34 @@ func TestTxLookupUnwind(t *testing.T) {
 		t.Errorf("txlookup record expected to be deleted, got %d", count)
 	}
 }
+
+func TestPlainStateReaderBatch(t *testing.T) {
+	contract := common.HexToAddress("0x71dd1027069078091B3ca48093B00E4735B20624")
+	missing := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	key1, key2, key3 := common.HexToHash("0x01"), common.HexToHash("0x02"), common.HexToHash("0x03")
+
+	_, tx := memdb.NewTestTx(t)
+	r, w := state.NewPlainStateReader(tx), state.NewPlainStateWriter(tx, nil, 0)
+	intraBlockState := state.New(r)
+	intraBlockState.CreateAccount(contract, true)
+	intraBlockState.SetCode(contract, []byte{0x01})
+	intraBlockState.SetState(contract, &key1, *uint256.NewInt(1))
+	intraBlockState.SetState(contract, &key3, *uint256.NewInt(3))
+	require.NoError(t, intraBlockState.CommitBlock(&params.Rules{}, w))
+
+	accs, err := r.ReadAccountsData([]common.Address{missing, contract})
+	require.NoError(t, err)
+	require.Nil(t, accs[0])
+	require.NotNil(t, accs[1])
+	incarnation := accs[1].Incarnation
+
+	values, err := r.ReadAccountStorages(contract, incarnation, []common.Hash{key3, key2, key1})
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{{0x03}, nil, {0x01}}, values)
+
+	for i, key := range []common.Hash{key3, key2, key1} {
+		v, err := r.ReadAccountStorage(contract, incarnation, &key)
+		require.NoError(t, err)
+		require.Equal(t, values[i], v)
+	}
+}
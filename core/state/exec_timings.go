@@ -0,0 +1,125 @@
+package state
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+)
+
+// ExecPhase is a part of the work of parallel execution (exec3) and state reconstitution, for which wall time is
+// accounted, to tell whether the bottleneck is IO (state reads, flushes), CPU (execution) or lock contention
+// (conflicts, puts into ReconState)
+type ExecPhase int
+
+const (
+	PhaseStateRead  ExecPhase = iota // reading state by the workers
+	PhaseExecution                   // executing transactions by the workers, excluding state reads
+	PhaseConflict                    // validating reads, and rolling back transactions with invalid reads
+	PhaseReconPut                    // writing the results of transactions into ReconState
+	PhaseReconFlush                  // flushing ReconState into the database
+	execPhaseCount
+)
+
+var execPhaseNames = [execPhaseCount]string{"state_read", "execution", "conflict", "recon_put", "recon_flush"}
+
+func (p ExecPhase) String() string { return execPhaseNames[p] }
+
+// Wall time (in nanoseconds) spent in each phase, summed over all workers
+var execTimings [execPhaseCount]int64
+
+// ExecTimingsPath is the path of the debug endpoint reporting wall time spent in each phase, served by the pprof and
+// metrics servers
+const ExecTimingsPath = "/debug/exec3/timings"
+
+func init() {
+	http.HandleFunc(ExecTimingsPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("reset") != "" {
+			ResetExecTimings()
+		}
+		_ = json.NewEncoder(w).Encode(ExecTimings())
+	})
+}
+
+func AddExecTime(phase ExecPhase, d time.Duration) {
+	atomic.AddInt64(&execTimings[phase], int64(d))
+}
+
+// TimeExecPhase is to be deferred: defer TimeExecPhase(PhaseReconFlush, time.Now())
+func TimeExecPhase(phase ExecPhase, start time.Time) {
+	AddExecTime(phase, time.Since(start))
+}
+
+// ExecTimings returns the wall time spent in each phase so far, in seconds
+func ExecTimings() map[string]float64 {
+	timings := make(map[string]float64, execPhaseCount)
+	for phase := ExecPhase(0); phase < execPhaseCount; phase++ {
+		timings[phase.String()] = time.Duration(atomic.LoadInt64(&execTimings[phase])).Seconds()
+	}
+	return timings
+}
+
+func ResetExecTimings() {
+	for phase := range execTimings {
+		atomic.StoreInt64(&execTimings[phase], 0)
+	}
+}
+
+// TimedStateReader measures time spent in the reads of the wrapped reader, to separate the state reads from
+// the execution of transactions. Not thread-safe, each worker needs its own
+type TimedStateReader struct {
+	r StateReader
+	d time.Duration
+}
+
+func NewTimedStateReader(r StateReader) *TimedStateReader {
+	return &TimedStateReader{r: r}
+}
+
+// Take returns the time spent in reads since the previous call
+func (tr *TimedStateReader) Take() time.Duration {
+	d := tr.d
+	tr.d = 0
+	return d
+}
+
+// AddExecTimes accounts the time spent by the worker on a transaction, which includes the reads since
+// the previous call, as state reads and execution
+func (tr *TimedStateReader) AddExecTimes(total time.Duration) {
+	reads := tr.Take()
+	AddExecTime(PhaseStateRead, reads)
+	AddExecTime(PhaseExecution, total-reads)
+}
+
+func (tr *TimedStateReader) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	defer tr.since(time.Now())
+	return tr.r.ReadAccountData(address)
+}
+
+func (tr *TimedStateReader) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	defer tr.since(time.Now())
+	return tr.r.ReadAccountStorage(address, incarnation, key)
+}
+
+func (tr *TimedStateReader) ReadAccountCode(address common.Address, incarnation uint64, codeHash common.Hash) ([]byte, error) {
+	defer tr.since(time.Now())
+	return tr.r.ReadAccountCode(address, incarnation, codeHash)
+}
+
+func (tr *TimedStateReader) ReadAccountCodeSize(address common.Address, incarnation uint64, codeHash common.Hash) (int, error) {
+	defer tr.since(time.Now())
+	return tr.r.ReadAccountCodeSize(address, incarnation, codeHash)
+}
+
+func (tr *TimedStateReader) ReadAccountIncarnation(address common.Address) (uint64, error) {
+	defer tr.since(time.Now())
+	return tr.r.ReadAccountIncarnation(address)
+}
+
+func (tr *TimedStateReader) since(start time.Time) {
+	tr.d += time.Since(start)
+}
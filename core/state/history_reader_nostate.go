@@ -20,18 +20,20 @@ func (r *RequiredStateError) Error() string {
 }
 
 type HistoryReaderNoState struct {
-	ac         *libstate.Aggregator22Context
-	tx         kv.Tx
-	txNum      uint64
-	trace      bool
-	rs         *ReconState
-	readError  bool
-	stateTxNum uint64
-	composite  []byte
+	ac          *libstate.Aggregator22Context
+	accountsIdx *libstate.InvertedIndexContext // txNums of the changes of the accounts, see ReadAccountIncarnation
+	tx          kv.Tx
+	txNum       uint64
+	trace       bool
+	rs          *ReconState
+	readError   bool
+	stateTxNum  uint64
+	errorKey    []byte // address or address+location of the read that caused readError
+	composite   []byte
 }
 
-func NewHistoryReaderNoState(ac *libstate.Aggregator22Context, rs *ReconState) *HistoryReaderNoState {
-	return &HistoryReaderNoState{ac: ac, rs: rs}
+func NewHistoryReaderNoState(ac *libstate.Aggregator22Context, accountsIdx *libstate.InvertedIndexContext, rs *ReconState) *HistoryReaderNoState {
+	return &HistoryReaderNoState{ac: ac, accountsIdx: accountsIdx, rs: rs}
 }
 
 func (hr *HistoryReaderNoState) SetTxNum(txNum uint64) {
@@ -69,9 +71,12 @@ func (hr *HistoryReaderNoState) ReadAccountData(address common.Address) (*accoun
 		if !hr.rs.Done(stateTxNum) {
 			hr.readError = true
 			hr.stateTxNum = stateTxNum
+			hr.errorKey = common.CopyBytes(address.Bytes())
 			return nil, &RequiredStateError{StateTxNum: stateTxNum}
 		}
-		enc = hr.rs.Get(kv.PlainStateR, address.Bytes(), nil, stateTxNum)
+		if enc, err = hr.rs.Get(kv.PlainStateR, address.Bytes(), nil, stateTxNum); err != nil {
+			return nil, err
+		}
 		if enc == nil {
 			if hr.tx == nil {
 				return nil, fmt.Errorf("hr.tx is nil")
@@ -87,9 +92,10 @@ func (hr *HistoryReaderNoState) ReadAccountData(address common.Address) (*accoun
 			if err != nil {
 				return nil, err
 			}
-			if enc == nil {
-				return nil, nil
-			}
+		}
+		if len(enc) == 0 {
+			// Either not found, or deleted at stateTxNum
+			return nil, nil
 		}
 		var a accounts.Account
 		if err = a.DecodeForStorage(enc); err != nil {
@@ -168,10 +174,13 @@ func (hr *HistoryReaderNoState) ReadAccountStorage(address common.Address, incar
 		if !hr.rs.Done(stateTxNum) {
 			hr.readError = true
 			hr.stateTxNum = stateTxNum
+			hr.errorKey = common.CopyBytes(hr.composite)
 			return nil, &RequiredStateError{StateTxNum: stateTxNum}
 		}
 
-		enc = hr.rs.Get(kv.PlainStateR, address.Bytes(), key.Bytes(), stateTxNum)
+		if enc, err = hr.rs.Get(kv.PlainStateR, address.Bytes(), ReconStorageKey2(incarnation, key.Bytes()), stateTxNum); err != nil {
+			return nil, err
+		}
 		if enc == nil {
 			if hr.tx == nil {
 				return nil, fmt.Errorf("hr.tx is nil")
@@ -183,7 +192,7 @@ func (hr *HistoryReaderNoState) ReadAccountStorage(address common.Address, incar
 			}
 			binary.BigEndian.PutUint64(hr.composite, stateTxNum)
 			copy(hr.composite[8:], address.Bytes())
-			binary.BigEndian.PutUint64(hr.composite[8+20:], 1)
+			binary.BigEndian.PutUint64(hr.composite[8+20:], incarnation)
 			copy(hr.composite[8+20+8:], key.Bytes())
 			enc, err = hr.tx.GetOne(kv.PlainStateR, hr.composite)
 			if err != nil {
@@ -192,13 +201,14 @@ func (hr *HistoryReaderNoState) ReadAccountStorage(address common.Address, incar
 		}
 	}
 	if hr.trace {
-		if enc == nil {
+		if len(enc) == 0 {
 			fmt.Printf("ReadAccountStorage [%x] [%x] => [], txNum: %d\n", address, key.Bytes(), hr.txNum)
 		} else {
 			fmt.Printf("ReadAccountStorage [%x] [%x] => [%x], txNum: %d\n", address, key.Bytes(), enc, hr.txNum)
 		}
 	}
-	if enc == nil {
+	if len(enc) == 0 {
+		// Either not found, or cleared at stateTxNum
 		return nil, nil
 	}
 	return enc, nil
@@ -227,9 +237,14 @@ func (hr *HistoryReaderNoState) ReadAccountCode(address common.Address, incarnat
 		if !hr.rs.Done(stateTxNum) {
 			hr.readError = true
 			hr.stateTxNum = stateTxNum
+			hr.errorKey = common.CopyBytes(address.Bytes())
 			return nil, &RequiredStateError{StateTxNum: stateTxNum}
 		}
-		enc = hr.rs.Get(kv.CodeR, codeHash.Bytes(), nil, stateTxNum)
+		// The same code could have been stored under a different txNum
+		stateTxNum = hr.rs.CodeTxNum(codeHash, stateTxNum)
+		if enc, err = hr.rs.Get(kv.CodeR, codeHash.Bytes(), nil, stateTxNum); err != nil {
+			return nil, err
+		}
 		if enc == nil {
 			if hr.tx == nil {
 				fmt.Printf("ReadAccountCode [%x] %d\n", address, incarnation)
@@ -277,9 +292,15 @@ func (hr *HistoryReaderNoState) ReadAccountCodeSize(address common.Address, inca
 		if !hr.rs.Done(stateTxNum) {
 			hr.readError = true
 			hr.stateTxNum = stateTxNum
+			hr.errorKey = common.CopyBytes(address.Bytes())
 			return 0, &RequiredStateError{StateTxNum: stateTxNum}
 		}
-		enc := hr.rs.Get(kv.CodeR, codeHash.Bytes(), nil, stateTxNum)
+		// The same code could have been stored under a different txNum
+		stateTxNum = hr.rs.CodeTxNum(codeHash, stateTxNum)
+		enc, err := hr.rs.Get(kv.CodeR, codeHash.Bytes(), nil, stateTxNum)
+		if err != nil {
+			return 0, err
+		}
 		if enc == nil {
 			if cap(hr.composite) < 8+32 {
 				hr.composite = make([]byte, 8+32)
@@ -301,14 +322,97 @@ func (hr *HistoryReaderNoState) ReadAccountCodeSize(address common.Address, inca
 	return size, nil
 }
 
+// ReadAccountIncarnation returns the incarnation of the account as of the current txNum, so that a contract
+// re-created on the same address gets the next incarnation. For the account deleted by its last change before
+// the current txNum, it is the incarnation kept with the tombstone, see ReconIncarnationKey2. For the account
+// deleted earlier in the history, it is the incarnation of the value before its deletion, see deletedIncarnation
 func (hr *HistoryReaderNoState) ReadAccountIncarnation(address common.Address) (uint64, error) {
-	return 0, nil
+	a, err := hr.ReadAccountData(address)
+	if err != nil {
+		return 0, err
+	}
+	if a != nil {
+		return a.Incarnation, nil
+	}
+	txKey, err := hr.tx.GetOne(kv.XAccount, address.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	if txKey == nil {
+		return 0, nil
+	}
+	stateTxNum := binary.BigEndian.Uint64(txKey)
+	if stateTxNum >= hr.txNum {
+		return hr.deletedIncarnation(address)
+	}
+	enc, err := hr.rs.Get(kv.PlainStateR, address.Bytes(), ReconIncarnationKey2, stateTxNum)
+	if err != nil {
+		return 0, err
+	}
+	if enc == nil {
+		composite := make([]byte, 8+20+8)
+		binary.BigEndian.PutUint64(composite, stateTxNum)
+		copy(composite[8:], address.Bytes())
+		if enc, err = hr.tx.GetOne(kv.PlainStateR, composite); err != nil {
+			return 0, err
+		}
+	}
+	if len(enc) != 8 {
+		return 0, nil
+	}
+	incarnation := binary.BigEndian.Uint64(enc)
+	if hr.trace {
+		fmt.Printf("ReadAccountIncarnation [%x] => [%d], stateTxNum=%d, txNum: %d\n", address, incarnation, stateTxNum, hr.txNum)
+	}
+	return incarnation, nil
+}
+
+// deletedIncarnation returns the incarnation of the contract deleted by the last change of the account before
+// the current txNum. The value of the account as of the current txNum is empty, but the history keeps the value
+// before each change, so the value before the deletion is the deleted contract
+func (hr *HistoryReaderNoState) deletedIncarnation(address common.Address) (uint64, error) {
+	if hr.accountsIdx == nil {
+		return 0, nil
+	}
+	// The history files cover all txNums reconstituted, so the iterator does not read the database
+	it := hr.accountsIdx.IterateRange(address.Bytes(), 0, hr.txNum, hr.tx)
+	defer it.Close()
+	var deletionTxNum uint64
+	var found bool
+	for it.HasNext() {
+		deletionTxNum, found = it.Next(), true
+	}
+	if !found {
+		// Never existed before the current txNum
+		return 0, nil
+	}
+	enc, ok, err := hr.ac.ReadAccountDataNoState(address.Bytes(), deletionTxNum)
+	if err != nil {
+		return 0, err
+	}
+	if !ok || len(enc) == 0 {
+		return 0, nil
+	}
+	var a accounts.Account
+	if err = accounts.Deserialise2(&a, enc); err != nil {
+		return 0, err
+	}
+	if hr.trace {
+		fmt.Printf("ReadAccountIncarnation [%x] => [%d], deletionTxNum=%d, txNum: %d\n", address, a.Incarnation, deletionTxNum, hr.txNum)
+	}
+	return a.Incarnation, nil
 }
 
 func (hr *HistoryReaderNoState) ResetError() {
 	hr.readError = false
+	hr.errorKey = nil
 }
 
 func (hr *HistoryReaderNoState) ReadError() (uint64, bool) {
 	return hr.stateTxNum, hr.readError
 }
+
+// ReadErrorKey returns the address (or address followed by storage location) which could not be read
+func (hr *HistoryReaderNoState) ReadErrorKey() []byte {
+	return hr.errorKey
+}
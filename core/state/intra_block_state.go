@@ -846,6 +846,69 @@ func (sdb *IntraBlockState) PrepareAccessList(sender common.Address, dst *common
 			sdb.AddSlotToAccessList(el.Address, key)
 		}
 	}
+	sdb.prewarmAccessList(list)
+}
+
+// prewarmAccessList reads the accounts and the storage slots of the access list in batches, if the reader supports
+// it, so that the reads during the execution find them in stateObjects
+func (sdb *IntraBlockState) prewarmAccessList(list types.AccessList) {
+	br, ok := sdb.stateReader.(BatchStateReader)
+	if !ok || len(list) == 0 {
+		return
+	}
+	addresses := make([]common.Address, 0, len(list))
+	seen := make(map[common.Address]struct{}, len(list))
+	for _, el := range list {
+		if _, ok := seen[el.Address]; ok {
+			continue
+		}
+		seen[el.Address] = struct{}{}
+		if _, ok := sdb.stateObjects[el.Address]; ok {
+			continue
+		}
+		if _, ok := sdb.nilAccounts[el.Address]; ok {
+			continue
+		}
+		addresses = append(addresses, el.Address)
+	}
+	accs, err := br.ReadAccountsData(addresses)
+	if err != nil {
+		sdb.setErrorUnsafe(err)
+		return
+	}
+	for i, account := range accs {
+		if account == nil {
+			sdb.nilAccounts[addresses[i]] = struct{}{}
+			continue
+		}
+		sdb.setStateObject(addresses[i], newObject(sdb, addresses[i], account, account))
+	}
+	for _, el := range list {
+		so := sdb.stateObjects[el.Address]
+		if so == nil || so.created || so.fakeStorage != nil {
+			continue
+		}
+		keys := make([]common.Hash, 0, len(el.StorageKeys))
+		for _, key := range el.StorageKeys {
+			if _, ok := so.originStorage[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		values, err := br.ReadAccountStorages(el.Address, so.data.GetIncarnation(), keys)
+		if err != nil {
+			sdb.setErrorUnsafe(err)
+			return
+		}
+		for i, enc := range values {
+			var value uint256.Int
+			value.SetBytes(enc)
+			so.originStorage[keys[i]] = value
+			so.blockOriginStorage[keys[i]] = value
+		}
+	}
 }
 
 // AddAddressToAccessList adds the given address to the access list
@@ -0,0 +1,230 @@
+package state
+
+import (
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+)
+
+var (
+	_ StateReader = (*OverlayState)(nil)
+	_ StateWriter = (*OverlayState)(nil)
+)
+
+type overlayStorageKey struct {
+	address     common.Address
+	incarnation uint64
+	key         common.Hash
+}
+
+type overlayCode struct {
+	address     common.Address
+	incarnation uint64
+	codeHash    common.Hash
+}
+
+// OverlayState keeps the changes written into it in memory, over the base reader, which is never written. It is
+// both a StateWriter and a StateReader: IntraBlockState commits into it with FinalizeTx or CommitBlock, and the next
+// IntraBlockState reads the changes back, instead of copying the IntraBlockState. Fork makes a child layer, which
+// sees the changes of the parent, and Discard drops the changes of the layer, so that the alternatives (calls,
+// bundles, transactions of the block being built) are tried without copying the state. The parent must not be
+// written while it has children in use. Not thread-safe
+type OverlayState struct {
+	parent       StateReader
+	accounts     map[common.Address]*accounts.Account // nil - deleted
+	storage      map[overlayStorageKey][]byte         // nil - zero
+	code         map[common.Hash][]byte
+	codeWrites   []overlayCode // to apply the code to the contracts it was written for
+	incarnations map[common.Address]uint64
+}
+
+func NewOverlayState(base StateReader) *OverlayState {
+	o := &OverlayState{parent: base}
+	o.Discard()
+	return o
+}
+
+// Fork returns a new layer over this one. Forking is cheap, it does not copy the changes
+func (o *OverlayState) Fork() *OverlayState {
+	return NewOverlayState(o)
+}
+
+// Discard drops the changes written into this layer, but not into its parents
+func (o *OverlayState) Discard() {
+	o.accounts = map[common.Address]*accounts.Account{}
+	o.storage = map[overlayStorageKey][]byte{}
+	o.code = map[common.Hash][]byte{}
+	o.codeWrites = nil
+	o.incarnations = map[common.Address]uint64{}
+}
+
+// Apply writes the changes of this layer (but not of its parents) into w, e.g. the changes of a child into its parent.
+// The original values are not known, so w must not write history
+func (o *OverlayState) Apply(w StateWriter) error {
+	for address, account := range o.accounts {
+		if account == nil {
+			original := &accounts.Account{Incarnation: o.incarnations[address]}
+			if err := w.DeleteAccount(address, original); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.UpdateAccountData(address, nil, account); err != nil {
+			return err
+		}
+	}
+	for _, c := range o.codeWrites {
+		if err := w.UpdateAccountCode(c.address, c.incarnation, c.codeHash, o.code[c.codeHash]); err != nil {
+			return err
+		}
+	}
+	for k, v := range o.storage {
+		var value uint256.Int
+		value.SetBytes(v)
+		key := k.key
+		if err := w.WriteAccountStorage(k.address, k.incarnation, &key, nil, &value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *OverlayState) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	if account, ok := o.accounts[address]; ok {
+		if account == nil {
+			return nil, nil
+		}
+		return account.SelfCopy(), nil
+	}
+	return o.parent.ReadAccountData(address)
+}
+
+func (o *OverlayState) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	if v, ok := o.storage[overlayStorageKey{address: address, incarnation: incarnation, key: *key}]; ok {
+		return v, nil
+	}
+	return o.parent.ReadAccountStorage(address, incarnation, key)
+}
+
+func (o *OverlayState) ReadAccountCode(address common.Address, incarnation uint64, codeHash common.Hash) ([]byte, error) {
+	if code, ok := o.code[codeHash]; ok {
+		return code, nil
+	}
+	return o.parent.ReadAccountCode(address, incarnation, codeHash)
+}
+
+func (o *OverlayState) ReadAccountCodeSize(address common.Address, incarnation uint64, codeHash common.Hash) (int, error) {
+	if code, ok := o.code[codeHash]; ok {
+		return len(code), nil
+	}
+	return o.parent.ReadAccountCodeSize(address, incarnation, codeHash)
+}
+
+func (o *OverlayState) ReadAccountIncarnation(address common.Address) (uint64, error) {
+	if incarnation, ok := o.incarnations[address]; ok {
+		return incarnation, nil
+	}
+	return o.parent.ReadAccountIncarnation(address)
+}
+
+func (o *OverlayState) UpdateAccountData(address common.Address, original, account *accounts.Account) error {
+	o.accounts[address] = account.SelfCopy()
+	return nil
+}
+
+func (o *OverlayState) UpdateAccountCode(address common.Address, incarnation uint64, codeHash common.Hash, code []byte) error {
+	o.code[codeHash] = common.CopyBytes(code)
+	o.codeWrites = append(o.codeWrites, overlayCode{address: address, incarnation: incarnation, codeHash: codeHash})
+	return nil
+}
+
+// DeleteAccount keeps the incarnation of the deleted contract, so that the contract re-created at the same address
+// gets the next one, and does not see the storage of the deleted one
+func (o *OverlayState) DeleteAccount(address common.Address, original *accounts.Account) error {
+	o.accounts[address] = nil
+	if original.Incarnation > 0 {
+		o.incarnations[address] = original.Incarnation
+	}
+	return nil
+}
+
+func (o *OverlayState) WriteAccountStorage(address common.Address, incarnation uint64, key *common.Hash, original, value *uint256.Int) error {
+	var v []byte
+	if !value.IsZero() {
+		v = value.Bytes()
+	}
+	o.storage[overlayStorageKey{address: address, incarnation: incarnation, key: *key}] = v
+	return nil
+}
+
+func (o *OverlayState) CreateContract(address common.Address) error {
+	return nil
+}
+
+// Over returns a reader of the state of this layer over base, instead of the reader the bottom layer is over, e.g.
+// over a reader of another database transaction. The layers must not be written anymore: then the readers returned
+// by Over can be used from several goroutines at once, each with its own base
+func (o *OverlayState) Over(base StateReader) StateReader {
+	return &overlayView{top: o, base: base}
+}
+
+// overlayView reads the layers from the top one down, then the base
+type overlayView struct {
+	top  *OverlayState
+	base StateReader
+}
+
+// below returns the layer under l, nil for the bottom one
+func below(l *OverlayState) *OverlayState {
+	parent, _ := l.parent.(*OverlayState)
+	return parent
+}
+
+func (v *overlayView) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	for l := v.top; l != nil; l = below(l) {
+		if account, ok := l.accounts[address]; ok {
+			if account == nil {
+				return nil, nil
+			}
+			return account.SelfCopy(), nil
+		}
+	}
+	return v.base.ReadAccountData(address)
+}
+
+func (v *overlayView) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	k := overlayStorageKey{address: address, incarnation: incarnation, key: *key}
+	for l := v.top; l != nil; l = below(l) {
+		if value, ok := l.storage[k]; ok {
+			return value, nil
+		}
+	}
+	return v.base.ReadAccountStorage(address, incarnation, key)
+}
+
+func (v *overlayView) ReadAccountCode(address common.Address, incarnation uint64, codeHash common.Hash) ([]byte, error) {
+	for l := v.top; l != nil; l = below(l) {
+		if code, ok := l.code[codeHash]; ok {
+			return code, nil
+		}
+	}
+	return v.base.ReadAccountCode(address, incarnation, codeHash)
+}
+
+func (v *overlayView) ReadAccountCodeSize(address common.Address, incarnation uint64, codeHash common.Hash) (int, error) {
+	for l := v.top; l != nil; l = below(l) {
+		if code, ok := l.code[codeHash]; ok {
+			return len(code), nil
+		}
+	}
+	return v.base.ReadAccountCodeSize(address, incarnation, codeHash)
+}
+
+func (v *overlayView) ReadAccountIncarnation(address common.Address) (uint64, error) {
+	for l := v.top; l != nil; l = below(l) {
+		if incarnation, ok := l.incarnations[address]; ok {
+			return incarnation, nil
+		}
+	}
+	return v.base.ReadAccountIncarnation(address)
+}
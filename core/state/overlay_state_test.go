@@ -0,0 +1,91 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverlayStateForkDiscard(t *testing.T) {
+	addr := common.HexToAddress("0x01")
+	key := common.HexToHash("0x02")
+
+	_, tx := memdb.NewTestTx(t)
+	base := New(NewPlainStateReader(tx))
+	base.AddBalance(addr, uint256.NewInt(10))
+	require.NoError(t, base.CommitBlock(&params.Rules{}, NewPlainStateWriterNoHistory(tx)))
+
+	overlay := NewOverlayState(NewPlainStateReader(tx))
+	ibs := New(overlay)
+	ibs.AddBalance(addr, uint256.NewInt(5))
+	ibs.SetState(addr, &key, *uint256.NewInt(7))
+	require.NoError(t, ibs.FinalizeTx(&params.Rules{}, overlay))
+
+	fork := overlay.Fork()
+	ibs = New(fork)
+	require.Equal(t, uint64(15), ibs.GetBalance(addr).Uint64())
+	ibs.SubBalance(addr, uint256.NewInt(15))
+	ibs.SetState(addr, &key, *uint256.NewInt(0))
+	require.NoError(t, ibs.FinalizeTx(&params.Rules{}, fork))
+
+	var value uint256.Int
+	ibs = New(fork)
+	ibs.GetState(addr, &key, &value)
+	require.True(t, value.IsZero())
+	require.Equal(t, uint64(0), ibs.GetBalance(addr).Uint64())
+
+	// Changes of the fork are not visible in the parent, nor after discarding
+	ibs = New(overlay)
+	ibs.GetState(addr, &key, &value)
+	require.Equal(t, uint64(7), value.Uint64())
+	require.Equal(t, uint64(15), ibs.GetBalance(addr).Uint64())
+	fork.Discard()
+	ibs = New(fork)
+	require.Equal(t, uint64(15), ibs.GetBalance(addr).Uint64())
+
+	// The base is not written
+	ibs = New(NewPlainStateReader(tx))
+	require.Equal(t, uint64(10), ibs.GetBalance(addr).Uint64())
+
+	// Applying the overlay writes its changes into the base
+	require.NoError(t, overlay.Apply(NewPlainStateWriterNoHistory(tx)))
+	ibs = New(NewPlainStateReader(tx))
+	ibs.GetState(addr, &key, &value)
+	require.Equal(t, uint64(7), value.Uint64())
+	require.Equal(t, uint64(15), ibs.GetBalance(addr).Uint64())
+}
+
+func TestOverlayStateOver(t *testing.T) {
+	addr := common.HexToAddress("0x01")
+	key := common.HexToHash("0x02")
+
+	_, tx := memdb.NewTestTx(t)
+	bottom := NewOverlayState(NewPlainStateReader(tx))
+	ibs := New(bottom)
+	ibs.AddBalance(addr, uint256.NewInt(5))
+	require.NoError(t, ibs.FinalizeTx(&params.Rules{}, bottom))
+	top := bottom.Fork()
+	ibs.SetState(addr, &key, *uint256.NewInt(7))
+	require.NoError(t, ibs.FinalizeTx(&params.Rules{}, top))
+
+	// The layers are read over the other base
+	_, otherTx := memdb.NewTestTx(t)
+	other := New(NewPlainStateReader(otherTx))
+	other.AddBalance(common.HexToAddress("0x03"), uint256.NewInt(10))
+	require.NoError(t, other.CommitBlock(&params.Rules{}, NewPlainStateWriterNoHistory(otherTx)))
+
+	var value uint256.Int
+	ibs = New(top.Over(NewPlainStateReader(otherTx)))
+	ibs.GetState(addr, &key, &value)
+	require.Equal(t, uint64(7), value.Uint64())
+	require.Equal(t, uint64(5), ibs.GetBalance(addr).Uint64())
+	require.Equal(t, uint64(10), ibs.GetBalance(common.HexToAddress("0x03")).Uint64())
+
+	ibs = New(bottom.Over(NewPlainStateReader(otherTx)))
+	ibs.GetState(addr, &key, &value)
+	require.True(t, value.IsZero())
+}
@@ -4,13 +4,14 @@ import (
 	"bytes"
 	"encoding/binary"
 
+	"github.com/ledgerwatch/erigon-lib/common/length"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/common/dbutils"
 	"github.com/ledgerwatch/erigon/core/types/accounts"
 )
 
-var _ StateReader = (*PlainStateReader)(nil)
+var _ BatchStateReader = (*PlainStateReader)(nil)
 
 // PlainStateReader reads data from so called "plain state".
 // Data in the plain state is stored using un-hashed account/storage items
@@ -78,3 +79,59 @@ func (r *PlainStateReader) ReadAccountIncarnation(address common.Address) (uint6
 	}
 	return binary.BigEndian.Uint64(b), nil
 }
+
+// ReadAccountsData reuses one cursor for all the accounts, if the reader is over a transaction
+func (r *PlainStateReader) ReadAccountsData(addresses []common.Address) ([]*accounts.Account, error) {
+	tx, ok := r.db.(kv.Tx)
+	if !ok {
+		return readAccountsOneByOne(r, addresses)
+	}
+	c, err := tx.Cursor(kv.PlainState)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	result := make([]*accounts.Account, len(addresses))
+	for i := range addresses {
+		_, enc, err := c.SeekExact(addresses[i].Bytes())
+		if err != nil {
+			return nil, err
+		}
+		if len(enc) == 0 {
+			continue
+		}
+		var a accounts.Account
+		if err = a.DecodeForStorage(enc); err != nil {
+			return nil, err
+		}
+		result[i] = &a
+	}
+	return result, nil
+}
+
+// ReadAccountStorages reuses one cursor for all the slots, if the reader is over a transaction. The slots of
+// the account are the duplicates of its key with the incarnation in the plain state
+func (r *PlainStateReader) ReadAccountStorages(address common.Address, incarnation uint64, keys []common.Hash) ([][]byte, error) {
+	tx, ok := r.db.(kv.Tx)
+	if !ok {
+		return readStoragesOneByOne(r, address, incarnation, keys)
+	}
+	c, err := tx.CursorDupSort(kv.PlainState)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	prefix := dbutils.PlainGenerateStoragePrefix(address.Bytes(), incarnation)
+	result := make([][]byte, len(keys))
+	for i := range keys {
+		v, err := c.SeekBothRange(prefix, keys[i].Bytes())
+		if err != nil {
+			return nil, err
+		}
+		if len(v) <= length.Hash || !bytes.Equal(v[:length.Hash], keys[i].Bytes()) {
+			continue
+		}
+		result[i] = v[length.Hash:]
+	}
+	return result, nil
+}
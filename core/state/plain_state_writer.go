@@ -41,6 +41,14 @@ func (w *PlainStateWriter) SetAccumulator(accumulator *shards.Accumulator) *Plai
 	return w
 }
 
+// SetChangeSetBuffer makes WriteChangeSets add the changesets to the buffer, see ChangeSetBuffer
+func (w *PlainStateWriter) SetChangeSetBuffer(buffer *ChangeSetBuffer) *PlainStateWriter {
+	if w.csw != nil {
+		w.csw.SetBuffer(buffer)
+	}
+	return w
+}
+
 func (w *PlainStateWriter) UpdateAccountData(address common.Address, original, account *accounts.Account) error {
 	//fmt.Printf("balance,%x,%d\n", address, &account.Balance)
 	if w.csw != nil {
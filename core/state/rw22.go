@@ -50,6 +50,9 @@ type TxTask struct {
 	Logs               []*types.Log
 	TraceFroms         map[common.Address]struct{}
 	TraceTos           map[common.Address]struct{}
+	Dependencies       []uint64  // txNums known in advance to produce state read by this transaction
+	GasUsed            uint64    // recorded (or estimated) gas used by the transaction, for scheduling
+	Group              []*TxTask // transactions of the same block to be executed after this one by the same worker, in block mode of reconstitution
 }
 
 type TxTaskQueue []*TxTask
@@ -79,17 +82,27 @@ func (h *TxTaskQueue) Pop() interface{} {
 const CodeSizeTable = "CodeSize"
 
 type State22 struct {
-	lock         sync.RWMutex
-	receiveWork  *sync.Cond
-	triggers     map[uint64]*TxTask
-	senderTxNums map[common.Address]uint64
-	triggerLock  sync.RWMutex
-	queue        TxTaskQueue
-	queueLock    sync.Mutex
-	changes      map[string]*btree.BTreeG[StateItem]
-	sizeEstimate uint64
-	txsDone      uint64
-	finished     bool
+	lock          sync.RWMutex
+	receiveWork   *sync.Cond
+	triggers      map[uint64][]*TxTask
+	senderTxNums  map[common.Address]uint64
+	keyTxNums     map[string]uint64   // last registered txNum predicted to write the key
+	txNumKeys     map[uint64][]string // keys predicted to be written by registered txNums, to clean up keyTxNums on commit
+	predicted     uint64              // number of transactions deferred because of the keys they read and write
+	triggerLock   sync.RWMutex
+	queue         TxTaskQueue
+	queueLock     sync.Mutex
+	changes       map[string]*btree.BTreeG[StateItem]
+	sizeEstimate  uint64
+	txsDone       uint64
+	finished      bool
+	deques        []txTaskDeque // per worker, only when work stealing is enabled
+	nextDeque     int
+	stealCount    uint64
+	concurrency   int // maximum number of transactions executed at the same time, 0 if not limited
+	running       int // number of transactions being executed
+	recorder      *ReplayRecorder
+	rwSetRecorder *RWSetRecorder
 }
 
 type StateItem struct {
@@ -103,8 +116,10 @@ func stateItemLess(i, j StateItem) bool {
 
 func NewState22() *State22 {
 	rs := &State22{
-		triggers:     map[uint64]*TxTask{},
+		triggers:     map[uint64][]*TxTask{},
 		senderTxNums: map[common.Address]uint64{},
+		keyTxNums:    map[string]uint64{},
+		txNumKeys:    map[uint64][]string{},
 		changes:      map[string]*btree.BTreeG[StateItem]{},
 	}
 	rs.receiveWork = sync.NewCond(&rs.queueLock)
@@ -168,29 +183,80 @@ func (rs *State22) Flush(rwTx kv.RwTx) error {
 }
 
 func (rs *State22) Schedule() (*TxTask, bool) {
+	return rs.ScheduleFor(-1)
+}
+
+// ScheduleFor is Schedule for the given worker, which takes work from its own deque first, if work stealing is enabled
+func (rs *State22) ScheduleFor(worker int) (*TxTask, bool) {
 	rs.queueLock.Lock()
 	defer rs.queueLock.Unlock()
-	for !rs.finished && rs.queue.Len() == 0 {
+	for !rs.finished && (rs.queuedLocked() == 0 || (rs.concurrency > 0 && rs.running >= rs.concurrency)) {
 		rs.receiveWork.Wait()
 	}
-	if rs.queue.Len() > 0 {
-		return heap.Pop(&rs.queue).(*TxTask), true
+	txTask, ok := rs.scheduleLocked(worker)
+	if ok {
+		rs.running++
+		if rs.recorder != nil {
+			rs.recorder.record(ReplayScheduled, txTask.TxNum)
+		}
 	}
-	return nil, false
+	return txTask, ok
+}
+
+// Executed needs to be called by the worker when it has finished executing a scheduled transaction,
+// to let another one to be scheduled if the concurrency is limited
+func (rs *State22) Executed() {
+	rs.queueLock.Lock()
+	defer rs.queueLock.Unlock()
+	rs.running--
+	rs.receiveWork.Signal()
 }
 
-func (rs *State22) RegisterSender(txTask *TxTask) bool {
+// SetConcurrency limits the number of transactions executed at the same time, regardless of the number of workers.
+// Zero means no limit
+func (rs *State22) SetConcurrency(concurrency int) {
+	rs.queueLock.Lock()
+	defer rs.queueLock.Unlock()
+	rs.concurrency = concurrency
+	rs.receiveWork.Broadcast()
+}
+
+// RegisterDependencies predicts the data dependencies of the transaction on the transactions registered
+// before it, from its sender and the keys it reads and writes, see predictedKeys. If there is one, the transaction
+// is added as a trigger of the latest such dependency, and false is returned. Otherwise, the transaction can be
+// scheduled now
+func (rs *State22) RegisterDependencies(txTask *TxTask) bool {
 	rs.triggerLock.Lock()
 	defer rs.triggerLock.Unlock()
 	lastTxNum, deferral := rs.senderTxNums[*txTask.Sender]
+	// Transactions with the same sender have obvious data dependency, no point running it before lastTxNum
+	//fmt.Printf("senderTxNums[%x]=%d\n", *txTask.Sender, txTask.TxNum)
+	rs.senderTxNums[*txTask.Sender] = txTask.TxNum
+	var byKeys bool
+	if txTask.Tx != nil {
+		reads, writes := predictedKeys(txTask)
+		// Only the keys written by the registered transactions are dependencies, both of the reads and the writes
+		for _, keys := range [2][]string{reads, writes} {
+			for _, key := range keys {
+				// Transactions committed in the order of txNum, so it is enough to wait for the latest one
+				if keyTxNum, ok := rs.keyTxNums[key]; ok && (!deferral || keyTxNum > lastTxNum) {
+					lastTxNum, deferral, byKeys = keyTxNum, true, true
+				}
+			}
+		}
+		for _, key := range writes {
+			rs.keyTxNums[key] = txTask.TxNum
+		}
+		rs.txNumKeys[txTask.TxNum] = writes
+	}
 	if deferral {
-		// Transactions with the same sender have obvious data dependency, no point running it before lastTxNum
 		// So we add this data dependency as a trigger
 		//fmt.Printf("trigger[%d] sender [%x]<=%x\n", lastTxNum, *txTask.Sender, txTask.Tx.Hash())
-		rs.triggers[lastTxNum] = txTask
+		rs.triggers[lastTxNum] = append(rs.triggers[lastTxNum], txTask)
+		if byKeys {
+			rs.predicted++
+		}
 	}
-	//fmt.Printf("senderTxNums[%x]=%d\n", *txTask.Sender, txTask.TxNum)
-	rs.senderTxNums[*txTask.Sender] = txTask.TxNum
 	return !deferral
 }
 
@@ -199,19 +265,28 @@ func (rs *State22) CommitTxNum(sender *common.Address, txNum uint64) uint64 {
 	defer rs.queueLock.Unlock()
 	rs.triggerLock.Lock()
 	defer rs.triggerLock.Unlock()
+	if rs.recorder != nil {
+		rs.recorder.record(ReplayApplied, txNum)
+	}
 	count := uint64(0)
-	if triggered, ok := rs.triggers[txNum]; ok {
+	for _, triggered := range rs.triggers[txNum] {
 		heap.Push(&rs.queue, triggered)
 		rs.receiveWork.Signal()
 		count++
-		delete(rs.triggers, txNum)
 	}
+	delete(rs.triggers, txNum)
 	if sender != nil {
 		if lastTxNum, ok := rs.senderTxNums[*sender]; ok && lastTxNum == txNum {
 			// This is the last transaction so far with this sender, remove
 			delete(rs.senderTxNums, *sender)
 		}
 	}
+	for _, key := range rs.txNumKeys[txNum] {
+		if keyTxNum, ok := rs.keyTxNums[key]; ok && keyTxNum == txNum {
+			delete(rs.keyTxNums, key)
+		}
+	}
+	delete(rs.txNumKeys, txNum)
 	rs.txsDone++
 	return count
 }
@@ -240,6 +315,9 @@ func (rs *State22) Finish() {
 func (rs *State22) Apply(emptyRemoval bool, roTx kv.Tx, txTask *TxTask, agg *libstate.Aggregator22) error {
 	rs.lock.Lock()
 	defer rs.lock.Unlock()
+	if rs.rwSetRecorder != nil {
+		rs.rwSetRecorder.record(txTask)
+	}
 	agg.SetTxNum(txTask.TxNum)
 	for addr := range txTask.BalanceIncreaseSet {
 		increase := txTask.BalanceIncreaseSet[addr]
@@ -511,6 +589,10 @@ func (rs *State22) SizeEstimate() uint64 {
 	return rs.sizeEstimate
 }
 
+// ReadsValid checks the values read by the transaction against the changes applied so far. Reads and writes
+// are tracked per key: accounts by address, storage by address, incarnation and location. So a transaction is
+// only rolled back if a storage slot it has read has changed, not any slot of the same contract, and rewriting
+// an account whose storage alone has changed (with the same encoding) does not invalidate the reads of it
 func (rs *State22) ReadsValid(readLists map[string]*KvList) bool {
 	rs.lock.RLock()
 	defer rs.lock.RUnlock()
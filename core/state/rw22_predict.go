@@ -0,0 +1,35 @@
+package state
+
+// predictedKeys returns the keys of the state which the transaction is known in advance to read and to write, used to
+// predict conflicts between transactions before executing them. The sender is written (nonce and balance), and so is
+// the recipient if the value is not zero. The keys declared by the EIP-2930 access list, address+location for each
+// storage key and the address of each entry, are only treated as read, because access lists do not tell reads from
+// writes, unless they are also among the written keys. Transactions reading the same slots of the same contract
+// (e.g. the total supply of a token) are not considered conflicting. Wrong predictions are still caught by the
+// validation of read sets
+func predictedKeys(txTask *TxTask) (reads, writes []string) {
+	writes = append(writes, string(txTask.Sender[:]))
+	if to := txTask.Tx.GetTo(); to != nil && !txTask.Tx.GetValue().IsZero() {
+		writes = append(writes, string(to[:]))
+	}
+	accessList := txTask.Tx.GetAccessList()
+	if len(accessList) == 0 {
+		return nil, writes
+	}
+	reads = make([]string, 0, len(accessList)+accessList.StorageKeys())
+	for _, tuple := range accessList {
+		reads = append(reads, string(tuple.Address[:]))
+		for _, location := range tuple.StorageKeys {
+			reads = append(reads, string(tuple.Address[:])+string(location[:]))
+		}
+	}
+	return reads, writes
+}
+
+// PredictedCount returns the number of transactions deferred until their dependencies are committed, because
+// of the conflicts predicted from their access lists and recipients
+func (rs *State22) PredictedCount() uint64 {
+	rs.triggerLock.RLock()
+	defer rs.triggerLock.RUnlock()
+	return rs.predicted
+}
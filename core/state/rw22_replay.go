@@ -0,0 +1,133 @@
+package state
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// ReplayEventKind is the kind of event recorded in the replay log of parallel execution
+type ReplayEventKind byte
+
+const (
+	ReplayScheduled  ReplayEventKind = iota + 1 // transaction is given to a worker for execution
+	ReplayRolledBack                            // result of the execution is discarded, because its reads are invalid
+	ReplayApplied                               // result of the execution is applied to the state
+)
+
+func (k ReplayEventKind) String() string {
+	switch k {
+	case ReplayScheduled:
+		return "scheduled"
+	case ReplayRolledBack:
+		return "rolled back"
+	case ReplayApplied:
+		return "applied"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(k))
+	}
+}
+
+type ReplayEvent struct {
+	Kind  ReplayEventKind
+	TxNum uint64
+}
+
+// ReplayRecorder writes the events of parallel execution, in the order they happen, into a file.
+// Each event is the kind (1 byte), followed by the difference from txNum of the previous event, as a varint,
+// which is usually 1-2 bytes long
+type ReplayRecorder struct {
+	lock      sync.Mutex
+	f         *os.File
+	w         *bufio.Writer
+	prevTxNum uint64
+	err       error
+}
+
+func NewReplayRecorder(fileName string) (*ReplayRecorder, error) {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return &ReplayRecorder{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+func (r *ReplayRecorder) record(kind ReplayEventKind, txNum uint64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.err != nil {
+		return
+	}
+	var buf [1 + binary.MaxVarintLen64]byte
+	buf[0] = byte(kind)
+	n := binary.PutVarint(buf[1:], int64(txNum-r.prevTxNum))
+	r.prevTxNum = txNum
+	_, r.err = r.w.Write(buf[:1+n])
+}
+
+// Close flushes the recorded events, and returns the first error encountered while recording, if any
+func (r *ReplayRecorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.err == nil {
+		r.err = r.w.Flush()
+	}
+	if err := r.f.Close(); r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
+
+// ReplayReader reads the events written by ReplayRecorder
+type ReplayReader struct {
+	f         *os.File
+	r         *bufio.Reader
+	prevTxNum uint64
+}
+
+func OpenReplayLog(fileName string) (*ReplayReader, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return &ReplayReader{f: f, r: bufio.NewReader(f)}, nil
+}
+
+// Next returns the next event, or io.EOF when there are no more
+func (r *ReplayReader) Next() (ReplayEvent, error) {
+	kind, err := r.r.ReadByte()
+	if err != nil {
+		return ReplayEvent{}, err
+	}
+	delta, err := binary.ReadVarint(r.r)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return ReplayEvent{}, err
+	}
+	r.prevTxNum += uint64(delta)
+	return ReplayEvent{Kind: ReplayEventKind(kind), TxNum: r.prevTxNum}, nil
+}
+
+func (r *ReplayReader) Close() error {
+	return r.f.Close()
+}
+
+// SetReplayRecorder makes the scheduler record scheduling, rollbacks and commits of transactions.
+// Needs to be called before any work is scheduled
+func (rs *State22) SetReplayRecorder(recorder *ReplayRecorder) {
+	rs.recorder = recorder
+}
+
+// RollbackTx returns the executed transaction to the queue, because its reads turned out to be invalid,
+// or because the results are discarded before commit
+func (rs *State22) RollbackTx(txTask *TxTask) {
+	if rs.recorder != nil {
+		rs.recorder.record(ReplayRolledBack, txTask.TxNum)
+	}
+	rs.AddWork(txTask)
+}
@@ -0,0 +1,204 @@
+package state
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+// rwSetTables are the tables of the read and write sets, in the order they are recorded. The index is the id of
+// the table in the log
+var rwSetTables = []string{kv.PlainState, kv.Code, CodeSizeTable, kv.PlainContractCode, kv.IncarnationMap}
+
+// RWSet is the read set and the write set of a transaction, the keys read and written by it, per table
+type RWSet struct {
+	TxNum  uint64
+	Reads  map[string][][]byte
+	Writes map[string][][]byte
+}
+
+// RWSetRecorder writes the read and write sets of the applied transactions, in the order of txNum, into a file.
+// Each record is the difference from txNum of the previous record (varint), followed by the reads and the writes.
+// Each of them is a list of tables with at least one key: table id (1 byte), number of keys (varint), and the keys,
+// each prefixed with its length (varint); the list ends with 0xff. Values are not recorded
+type RWSetRecorder struct {
+	lock      sync.Mutex
+	f         *os.File
+	w         *bufio.Writer
+	prevTxNum uint64
+	err       error
+}
+
+func NewRWSetRecorder(fileName string) (*RWSetRecorder, error) {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return &RWSetRecorder{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+func (r *RWSetRecorder) record(txTask *TxTask) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.err != nil {
+		return
+	}
+	r.putUvarint(txTask.TxNum - r.prevTxNum)
+	r.prevTxNum = txTask.TxNum
+	r.putLists(txTask.ReadLists, nil)
+	var balanceIncreases [][]byte
+	for addr := range txTask.BalanceIncreaseSet {
+		addr := addr
+		balanceIncreases = append(balanceIncreases, addr[:])
+	}
+	sort.Slice(balanceIncreases, func(i, j int) bool { return string(balanceIncreases[i]) < string(balanceIncreases[j]) })
+	r.putLists(txTask.WriteLists, balanceIncreases)
+}
+
+// putLists writes the keys of the lists, and the extra keys of kv.PlainState
+func (r *RWSetRecorder) putLists(lists map[string]*KvList, plainStateExtra [][]byte) {
+	for id, table := range rwSetTables {
+		var keys [][]byte
+		if list, ok := lists[table]; ok {
+			keys = list.Keys
+		}
+		count := len(keys)
+		if table == kv.PlainState {
+			count += len(plainStateExtra)
+		}
+		if count == 0 {
+			continue
+		}
+		r.putByte(byte(id))
+		r.putUvarint(uint64(count))
+		for _, key := range keys {
+			r.putKey(key)
+		}
+		if table == kv.PlainState {
+			for _, key := range plainStateExtra {
+				r.putKey(key)
+			}
+		}
+	}
+	r.putByte(0xff)
+}
+
+func (r *RWSetRecorder) putKey(key []byte) {
+	r.putUvarint(uint64(len(key)))
+	if r.err == nil {
+		_, r.err = r.w.Write(key)
+	}
+}
+
+func (r *RWSetRecorder) putUvarint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	if r.err == nil {
+		_, r.err = r.w.Write(buf[:n])
+	}
+}
+
+func (r *RWSetRecorder) putByte(b byte) {
+	if r.err == nil {
+		r.err = r.w.WriteByte(b)
+	}
+}
+
+// Close flushes the recorded sets, and returns the first error encountered while recording, if any
+func (r *RWSetRecorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.err == nil {
+		r.err = r.w.Flush()
+	}
+	if err := r.f.Close(); r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
+
+// RWSetReader reads the sets written by RWSetRecorder
+type RWSetReader struct {
+	f         *os.File
+	r         *bufio.Reader
+	prevTxNum uint64
+}
+
+func OpenRWSetLog(fileName string) (*RWSetReader, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return &RWSetReader{f: f, r: bufio.NewReader(f)}, nil
+}
+
+// Next returns the sets of the next transaction, or io.EOF when there are no more
+func (r *RWSetReader) Next() (RWSet, error) {
+	delta, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return RWSet{}, err
+	}
+	r.prevTxNum += delta
+	set := RWSet{TxNum: r.prevTxNum}
+	if set.Reads, err = r.readLists(); err != nil {
+		return RWSet{}, err
+	}
+	if set.Writes, err = r.readLists(); err != nil {
+		return RWSet{}, err
+	}
+	return set, nil
+}
+
+func (r *RWSetReader) readLists() (map[string][][]byte, error) {
+	lists := map[string][][]byte{}
+	for {
+		id, err := r.r.ReadByte()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if id == 0xff {
+			return lists, nil
+		}
+		if int(id) >= len(rwSetTables) {
+			return nil, fmt.Errorf("unknown table id %d", id)
+		}
+		count, err := binary.ReadUvarint(r.r)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		keys := make([][]byte, count)
+		for i := range keys {
+			l, err := binary.ReadUvarint(r.r)
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			keys[i] = make([]byte, l)
+			if _, err = io.ReadFull(r.r, keys[i]); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+		}
+		lists[rwSetTables[id]] = keys
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (r *RWSetReader) Close() error {
+	return r.f.Close()
+}
+
+// SetRWSetRecorder makes Apply record the read and write sets of the transactions
+func (rs *State22) SetRWSetRecorder(recorder *RWSetRecorder) {
+	rs.rwSetRecorder = recorder
+}
@@ -0,0 +1,100 @@
+package state
+
+import (
+	"container/heap"
+)
+
+// txTaskDeque holds the transactions assigned to one worker, in the order of txNum.
+// It is protected by queueLock of State22, like the global queue
+type txTaskDeque struct {
+	tasks []*TxTask
+}
+
+func (d *txTaskDeque) len() int { return len(d.tasks) }
+
+func (d *txTaskDeque) pushBack(txTask *TxTask) {
+	d.tasks = append(d.tasks, txTask)
+}
+
+// popFront is used by the owner, to get the transaction with the lowest txNum, which is needed first
+// to move the output forward
+func (d *txTaskDeque) popFront() *TxTask {
+	txTask := d.tasks[0]
+	d.tasks[0] = nil
+	d.tasks = d.tasks[1:]
+	return txTask
+}
+
+// popBack is used by the thieves, so that the next transactions of the owner stay with it
+func (d *txTaskDeque) popBack() *TxTask {
+	last := len(d.tasks) - 1
+	txTask := d.tasks[last]
+	d.tasks[last] = nil
+	d.tasks = d.tasks[:last]
+	return txTask
+}
+
+// EnableWorkStealing gives each of the workers its own deque of transactions, which is filled by AddLocalWork.
+// A worker takes transactions from its own deque, or from the global queue (which receives rolled back and
+// triggered transactions) if that has lower txNum. When both are empty, it steals from the worker with the
+// longest deque, so that workers whose transactions are stuck in triggers do not leave others idle.
+// Needs to be called before any work is added
+func (rs *State22) EnableWorkStealing(workerCount int) {
+	rs.queueLock.Lock()
+	defer rs.queueLock.Unlock()
+	rs.deques = make([]txTaskDeque, workerCount)
+}
+
+// AddLocalWork assigns new transaction to the deque of one of the workers, in turn.
+// Without work stealing, it is the same as AddWork
+func (rs *State22) AddLocalWork(txTask *TxTask) {
+	if rs.deques == nil {
+		rs.AddWork(txTask)
+		return
+	}
+	rs.queueLock.Lock()
+	defer rs.queueLock.Unlock()
+	rs.deques[rs.nextDeque].pushBack(txTask)
+	rs.nextDeque = (rs.nextDeque + 1) % len(rs.deques)
+	// Any worker can pick it up, by stealing if needed
+	rs.receiveWork.Signal()
+}
+
+// scheduleLocked must be called with queueLock held
+func (rs *State22) scheduleLocked(worker int) (*TxTask, bool) {
+	if worker >= 0 && worker < len(rs.deques) {
+		own := &rs.deques[worker]
+		if own.len() > 0 && (rs.queue.Len() == 0 || own.tasks[0].TxNum < rs.queue[0].TxNum) {
+			return own.popFront(), true
+		}
+	}
+	if rs.queue.Len() > 0 {
+		return heap.Pop(&rs.queue).(*TxTask), true
+	}
+	victim := -1
+	for i := range rs.deques {
+		if i != worker && rs.deques[i].len() > 0 && (victim < 0 || rs.deques[i].len() > rs.deques[victim].len()) {
+			victim = i
+		}
+	}
+	if victim < 0 {
+		return nil, false
+	}
+	rs.stealCount++
+	return rs.deques[victim].popBack(), true
+}
+
+func (rs *State22) queuedLocked() int {
+	n := rs.queue.Len()
+	for i := range rs.deques {
+		n += rs.deques[i].len()
+	}
+	return n
+}
+
+// StealCount returns how many transactions were taken by workers from the deques of other workers
+func (rs *State22) StealCount() uint64 {
+	rs.queueLock.Lock()
+	defer rs.queueLock.Unlock()
+	return rs.stealCount
+}
@@ -0,0 +1,38 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestState22WorkStealing(t *testing.T) {
+	rs := NewState22()
+	rs.EnableWorkStealing(2)
+	for txNum := uint64(0); txNum < 4; txNum++ {
+		rs.AddLocalWork(&TxTask{TxNum: txNum})
+	}
+	// Worker 0 owns 0 and 2, worker 1 owns 1 and 3
+	txTask, ok := rs.ScheduleFor(0)
+	require.True(t, ok)
+	require.Equal(t, uint64(0), txTask.TxNum)
+	txTask, ok = rs.ScheduleFor(0)
+	require.True(t, ok)
+	require.Equal(t, uint64(2), txTask.TxNum)
+	// Rolled back transaction in the global queue goes before the own work with higher txNum
+	rs.AddWork(&TxTask{TxNum: 0})
+	txTask, ok = rs.ScheduleFor(1)
+	require.True(t, ok)
+	require.Equal(t, uint64(0), txTask.TxNum)
+	// Worker 0 has run out of own work, and steals from the back of the deque of worker 1
+	txTask, ok = rs.ScheduleFor(0)
+	require.True(t, ok)
+	require.Equal(t, uint64(3), txTask.TxNum)
+	require.Equal(t, uint64(1), rs.StealCount())
+	txTask, ok = rs.ScheduleFor(1)
+	require.True(t, ok)
+	require.Equal(t, uint64(1), txTask.TxNum)
+	rs.Finish()
+	_, ok = rs.ScheduleFor(1)
+	require.False(t, ok)
+}
@@ -0,0 +1,159 @@
+package state
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/stretchr/testify/require"
+)
+
+func TestState22PredictedDependencies(t *testing.T) {
+	rs := NewState22()
+	sender1, sender2, sender3, sender4, sender5 := common.Address{1}, common.Address{2}, common.Address{3}, common.Address{4}, common.Address{5}
+	token := common.Address{0xaa}
+	withAccessList := func(txNum uint64, sender common.Address, slots ...common.Hash) *TxTask {
+		return &TxTask{TxNum: txNum, Sender: &sender, Tx: &types.AccessListTx{
+			LegacyTx:   types.LegacyTx{CommonTx: types.CommonTx{Value: uint256.NewInt(0)}},
+			AccessList: types.AccessList{{Address: token, StorageKeys: slots}},
+		}}
+	}
+	transfer := func(txNum uint64, sender, to common.Address) *TxTask {
+		return &TxTask{TxNum: txNum, Sender: &sender, Tx: types.NewTransaction(0, to, uint256.NewInt(1), 21000, uint256.NewInt(1), nil)}
+	}
+	require.True(t, rs.RegisterDependencies(withAccessList(1, sender1, common.Hash{1})))
+	// The keys of access lists are only read, so the same slot does not conflict
+	require.True(t, rs.RegisterDependencies(withAccessList(2, sender2, common.Hash{1})))
+	require.True(t, rs.RegisterDependencies(transfer(3, sender3, token)))
+	// The token account is written by the transfer
+	require.False(t, rs.RegisterDependencies(withAccessList(4, sender4, common.Hash{2})))
+	// And so is its sender
+	require.False(t, rs.RegisterDependencies(transfer(5, sender5, sender3)))
+	require.Equal(t, uint64(2), rs.PredictedCount())
+	require.Equal(t, uint64(0), rs.CommitTxNum(&sender1, 1))
+	require.Equal(t, uint64(0), rs.CommitTxNum(&sender2, 2))
+	require.Equal(t, uint64(2), rs.CommitTxNum(&sender3, 3))
+	txTask, ok := rs.Schedule()
+	require.True(t, ok)
+	require.Equal(t, uint64(4), txTask.TxNum)
+	txTask, ok = rs.Schedule()
+	require.True(t, ok)
+	require.Equal(t, uint64(5), txTask.TxNum)
+	rs.CommitTxNum(&sender4, 4)
+	rs.CommitTxNum(&sender5, 5)
+	// Keys of committed transactions are forgotten
+	require.True(t, rs.RegisterDependencies(transfer(6, sender1, sender3)))
+}
+
+func TestState22StorageSlotConflicts(t *testing.T) {
+	rs := NewState22()
+	token := common.Address{0xaa}
+	balance1, balance2 := common.Hash{1}, common.Hash{2}
+	original := accounts.NewAccount()
+	original.Initialised = true
+	original.Incarnation = 1
+	tokenEnc := make([]byte, original.EncodingLengthForStorage())
+	original.EncodeForStorage(tokenEnc)
+	_, tx := memdb.NewTestTx(t)
+	require.NoError(t, tx.Put(kv.PlainState, token.Bytes(), tokenEnc))
+	// Transfers read the token account and their own balance slot
+	transferReads := func(slot common.Hash) map[string]*KvList {
+		r := NewStateReader22(rs)
+		r.SetTx(tx)
+		_, err := r.ReadAccountData(token)
+		require.NoError(t, err)
+		_, err = r.ReadAccountStorage(token, 1, &slot)
+		require.NoError(t, err)
+		return r.ReadSet()
+	}
+	reads1, reads2 := transferReads(balance1), transferReads(balance2)
+
+	// The first transfer changes its balance slot, the token account is written unchanged
+	w := NewStateWriter22(rs)
+	account := original
+	require.NoError(t, w.WriteAccountStorage(token, 1, &balance1, uint256.NewInt(0), uint256.NewInt(2)))
+	require.NoError(t, w.UpdateAccountData(token, &original, &account))
+	require.Equal(t, 2, len(w.WriteSet()[kv.PlainState].Keys))
+	accountPrevs, _, storagePrevs, _ := w.PrevAndDels()
+	require.Equal(t, 1, len(accountPrevs))
+	require.Equal(t, 1, len(storagePrevs))
+	require.True(t, rs.ReadsValid(reads1))
+	for table, list := range w.WriteSet() {
+		for i, key := range list.Keys {
+			rs.put(table, key, list.Vals[i])
+		}
+	}
+	// The second transfer touches a different balance of the same token, and does not conflict
+	require.True(t, rs.ReadsValid(reads2))
+	// But a transaction that has read the changed balance does
+	require.False(t, rs.ReadsValid(reads1))
+}
+
+func TestReplayLog(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "replay")
+	recorder, err := NewReplayRecorder(fileName)
+	require.NoError(t, err)
+	events := []ReplayEvent{
+		{Kind: ReplayScheduled, TxNum: 1000},
+		{Kind: ReplayScheduled, TxNum: 1001},
+		{Kind: ReplayApplied, TxNum: 1000},
+		{Kind: ReplayRolledBack, TxNum: 1001},
+		{Kind: ReplayScheduled, TxNum: 1001},
+		{Kind: ReplayApplied, TxNum: 1001},
+	}
+	for _, event := range events {
+		recorder.record(event.Kind, event.TxNum)
+	}
+	require.NoError(t, recorder.Close())
+
+	replayLog, err := OpenReplayLog(fileName)
+	require.NoError(t, err)
+	defer replayLog.Close()
+	for _, event := range events {
+		replayed, err := replayLog.Next()
+		require.NoError(t, err)
+		require.Equal(t, event, replayed)
+	}
+	_, err = replayLog.Next()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestRWSetLog(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "rwsets")
+	recorder, err := NewRWSetRecorder(fileName)
+	require.NoError(t, err)
+	addr, coinbase := common.HexToAddress("0x01"), common.HexToAddress("0x02")
+	storageKey := append(addr.Bytes(), make([]byte, 8+32)...)
+	recorder.record(&TxTask{
+		TxNum:     1000,
+		ReadLists: map[string]*KvList{kv.PlainState: {Keys: [][]byte{addr[:], storageKey}, Vals: [][]byte{{1}, {2}}}, kv.Code: {}},
+		WriteLists: map[string]*KvList{
+			kv.PlainState: {Keys: [][]byte{storageKey}, Vals: [][]byte{{3}}},
+		},
+		BalanceIncreaseSet: map[common.Address]uint256.Int{coinbase: *uint256.NewInt(1)},
+	})
+	recorder.record(&TxTask{TxNum: 1002})
+	require.NoError(t, recorder.Close())
+
+	rwSetLog, err := OpenRWSetLog(fileName)
+	require.NoError(t, err)
+	defer rwSetLog.Close()
+	set, err := rwSetLog.Next()
+	require.NoError(t, err)
+	require.Equal(t, RWSet{
+		TxNum:  1000,
+		Reads:  map[string][][]byte{kv.PlainState: {addr[:], storageKey}},
+		Writes: map[string][][]byte{kv.PlainState: {storageKey, coinbase[:]}},
+	}, set)
+	set, err = rwSetLog.Next()
+	require.NoError(t, err)
+	require.Equal(t, RWSet{TxNum: 1002, Reads: map[string][][]byte{}, Writes: map[string][][]byte{}}, set)
+	_, err = rwSetLog.Next()
+	require.ErrorIs(t, err, io.EOF)
+}
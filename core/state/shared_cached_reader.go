@@ -0,0 +1,183 @@
+package state
+
+import (
+	"encoding/binary"
+	"math"
+	"sync/atomic"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+)
+
+const (
+	sharedAccount byte = iota
+	sharedStorage
+	sharedCode
+	sharedCodeSize
+	sharedIncarnation
+)
+
+type sharedStateKey struct {
+	parentHash common.Hash
+	kind       byte
+	key        string
+}
+
+// SharedStateCache caches accounts, storage and code of historical blocks, read by concurrent readers of the same
+// block (e.g. RPC calls), unlike kvcache, which only covers the latest state. The entries are keyed by the hash
+// of the parent block, which identifies the state at the beginning of a block, so they never need to be
+// invalidated: after a reorg, the blocks of the new branch are read with different keys, and the entries of the
+// blocks reorganised out are evicted from the LRU over time. The cache is limited by the size of its entries in
+// bytes rather than by their number, because code entries are up to 24Kb each. Thread-safe
+type SharedStateCache struct {
+	lru   *lru.Cache
+	size  int64 // atomic, approximate bytes of the entries in the lru
+	limit int64
+}
+
+// NewSharedStateCache creates the cache of up to limit bytes
+func NewSharedStateCache(limit uint64) (*SharedStateCache, error) {
+	// The number of entries is not limited, the entries are evicted by add
+	c, err := lru.New(math.MaxInt32)
+	if err != nil {
+		return nil, err
+	}
+	return &SharedStateCache{lru: c, limit: int64(limit)}, nil
+}
+
+func (c *SharedStateCache) Len() int { return c.lru.Len() }
+
+// Size returns the approximate size of the entries in bytes
+func (c *SharedStateCache) Size() uint64 { return uint64(atomic.LoadInt64(&c.size)) }
+
+// sharedEntryOverhead approximates the memory taken by the lru for an entry besides its key and value
+const sharedEntryOverhead = 96
+
+func sharedEntrySize(k sharedStateKey, v interface{}) int64 {
+	size := int64(sharedEntryOverhead + len(k.key))
+	switch v := v.(type) {
+	case []byte:
+		size += int64(len(v))
+	case *accounts.Account:
+		size += 160
+	}
+	return size
+}
+
+// add inserts the entry unless it is already cached, evicting the least recently used entries to keep the cache
+// within its limit
+func (c *SharedStateCache) add(k sharedStateKey, v interface{}) {
+	if found, _ := c.lru.ContainsOrAdd(k, v); found {
+		return
+	}
+	atomic.AddInt64(&c.size, sharedEntrySize(k, v))
+	for atomic.LoadInt64(&c.size) > c.limit {
+		oldK, oldV, ok := c.lru.RemoveOldest()
+		if !ok {
+			return
+		}
+		atomic.AddInt64(&c.size, -sharedEntrySize(oldK.(sharedStateKey), oldV))
+	}
+}
+
+// SharedCachedReader is a wrapper for an instance of type StateReader, reading the state at the beginning of
+// the block with the given parent. It only makes calls to the underlying reader if the item is not in the shared cache
+type SharedCachedReader struct {
+	r          StateReader
+	cache      *SharedStateCache
+	parentHash common.Hash
+}
+
+func NewSharedCachedReader(r StateReader, cache *SharedStateCache, parentHash common.Hash) *SharedCachedReader {
+	return &SharedCachedReader{r: r, cache: cache, parentHash: parentHash}
+}
+
+// codeKey does not depend on the block, because code is immutable for the given hash
+func codeKey(kind byte, codeHash common.Hash) sharedStateKey {
+	return sharedStateKey{kind: kind, key: string(codeHash[:])}
+}
+
+func (r *SharedCachedReader) key(kind byte, parts ...[]byte) sharedStateKey {
+	var key []byte
+	for _, part := range parts {
+		key = append(key, part...)
+	}
+	return sharedStateKey{parentHash: r.parentHash, kind: kind, key: string(key)}
+}
+
+// ReadAccountData returns a copy of the cached account, because the callers are allowed to modify it
+func (r *SharedCachedReader) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	k := r.key(sharedAccount, address[:])
+	if v, ok := r.cache.lru.Get(k); ok {
+		if v == nil {
+			return nil, nil
+		}
+		return v.(*accounts.Account).SelfCopy(), nil
+	}
+	a, err := r.r.ReadAccountData(address)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		r.cache.add(k, nil)
+		return nil, nil
+	}
+	r.cache.add(k, a.SelfCopy())
+	return a, nil
+}
+
+func (r *SharedCachedReader) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	var inc [8]byte
+	binary.BigEndian.PutUint64(inc[:], incarnation)
+	k := r.key(sharedStorage, address[:], inc[:], key[:])
+	if v, ok := r.cache.lru.Get(k); ok {
+		return common.CopyBytes(v.([]byte)), nil
+	}
+	enc, err := r.r.ReadAccountStorage(address, incarnation, key)
+	if err != nil {
+		return nil, err
+	}
+	r.cache.add(k, common.CopyBytes(enc))
+	return enc, nil
+}
+
+// ReadAccountCode caches the code by its hash, so that it is shared by all blocks, and by the contracts with the same code
+func (r *SharedCachedReader) ReadAccountCode(address common.Address, incarnation uint64, codeHash common.Hash) ([]byte, error) {
+	k := codeKey(sharedCode, codeHash)
+	if v, ok := r.cache.lru.Get(k); ok {
+		return common.CopyBytes(v.([]byte)), nil
+	}
+	code, err := r.r.ReadAccountCode(address, incarnation, codeHash)
+	if err != nil {
+		return nil, err
+	}
+	r.cache.add(k, common.CopyBytes(code))
+	return code, nil
+}
+
+func (r *SharedCachedReader) ReadAccountCodeSize(address common.Address, incarnation uint64, codeHash common.Hash) (int, error) {
+	k := codeKey(sharedCodeSize, codeHash)
+	if v, ok := r.cache.lru.Get(k); ok {
+		return v.(int), nil
+	}
+	size, err := r.r.ReadAccountCodeSize(address, incarnation, codeHash)
+	if err != nil {
+		return 0, err
+	}
+	r.cache.add(k, size)
+	return size, nil
+}
+
+func (r *SharedCachedReader) ReadAccountIncarnation(address common.Address) (uint64, error) {
+	k := r.key(sharedIncarnation, address[:])
+	if v, ok := r.cache.lru.Get(k); ok {
+		return v.(uint64), nil
+	}
+	incarnation, err := r.r.ReadAccountIncarnation(address)
+	if err != nil {
+		return 0, err
+	}
+	r.cache.add(k, incarnation)
+	return incarnation, nil
+}
@@ -0,0 +1,142 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/stretchr/testify/require"
+)
+
+type countingReader struct {
+	accounts map[common.Address]*accounts.Account
+	reads    int
+}
+
+func (r *countingReader) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	r.reads++
+	return r.accounts[address], nil
+}
+
+func (r *countingReader) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	r.reads++
+	return key[:], nil
+}
+
+func (r *countingReader) ReadAccountCode(address common.Address, incarnation uint64, codeHash common.Hash) ([]byte, error) {
+	r.reads++
+	return codeHash[:], nil
+}
+
+func (r *countingReader) ReadAccountCodeSize(address common.Address, incarnation uint64, codeHash common.Hash) (int, error) {
+	r.reads++
+	return len(codeHash), nil
+}
+
+func (r *countingReader) ReadAccountIncarnation(address common.Address) (uint64, error) {
+	r.reads++
+	return 1, nil
+}
+
+func TestSharedCachedReader(t *testing.T) {
+	addr, missing := common.HexToAddress("0x01"), common.HexToAddress("0x02")
+	underlying := &countingReader{accounts: map[common.Address]*accounts.Account{addr: {Nonce: 5, Initialised: true}}}
+	cache, err := NewSharedStateCache(1 << 20)
+	require.NoError(t, err)
+	parent9, parent10 := common.HexToHash("0x09"), common.HexToHash("0x0a")
+
+	r1 := NewSharedCachedReader(underlying, cache, parent10)
+	a, err := r1.ReadAccountData(addr)
+	require.NoError(t, err)
+	a.Nonce = 6 // must not affect the cached copy
+	a, err = r1.ReadAccountData(missing)
+	require.NoError(t, err)
+	require.Nil(t, a)
+	key := common.HexToHash("0x03")
+	_, err = r1.ReadAccountStorage(addr, 1, &key)
+	require.NoError(t, err)
+	_, err = r1.ReadAccountCode(addr, 1, key)
+	require.NoError(t, err)
+	require.Equal(t, 4, underlying.reads)
+
+	// Another reader of the same block shares the entries
+	r2 := NewSharedCachedReader(underlying, cache, parent10)
+	a, err = r2.ReadAccountData(addr)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), a.Nonce)
+	a, err = r2.ReadAccountData(missing)
+	require.NoError(t, err)
+	require.Nil(t, a)
+	_, err = r2.ReadAccountStorage(addr, 1, &key)
+	require.NoError(t, err)
+	require.Equal(t, 4, underlying.reads)
+
+	// Code is shared by all blocks, the rest is not
+	r3 := NewSharedCachedReader(underlying, cache, parent9)
+	_, err = r3.ReadAccountCode(addr, 1, key)
+	require.NoError(t, err)
+	_, err = r3.ReadAccountData(addr)
+	require.NoError(t, err)
+	require.Equal(t, 5, underlying.reads)
+
+	// After a reorg, block 10 has a different parent, and its state is read again, except the code
+	reorged := underlying.accounts[addr].SelfCopy()
+	reorged.Nonce = 7
+	underlying.accounts[addr] = reorged
+	r4 := NewSharedCachedReader(underlying, cache, common.HexToHash("0xa9"))
+	a, err = r4.ReadAccountData(addr)
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), a.Nonce)
+	_, err = r4.ReadAccountCode(addr, 1, key)
+	require.NoError(t, err)
+	require.Equal(t, 6, underlying.reads)
+	// The blocks of the old branch keep their own state
+	a, err = r2.ReadAccountData(addr)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), a.Nonce)
+	require.Equal(t, 6, underlying.reads)
+}
+
+func TestSharedCachedReaderCode(t *testing.T) {
+	addr := common.HexToAddress("0x01")
+	underlying := &countingReader{}
+	cache, err := NewSharedStateCache(1 << 20)
+	require.NoError(t, err)
+	codeHash := common.HexToHash("0x03")
+
+	r := NewSharedCachedReader(underlying, cache, common.HexToHash("0x0a"))
+	code, err := r.ReadAccountCode(addr, 1, codeHash)
+	require.NoError(t, err)
+	code[0] = 0xff // must not affect the cached copy
+	code, err = r.ReadAccountCode(addr, 1, codeHash)
+	require.NoError(t, err)
+	require.Equal(t, codeHash[:], code)
+	code[0] = 0xff
+	code, err = r.ReadAccountCode(addr, 1, codeHash)
+	require.NoError(t, err)
+	require.Equal(t, codeHash[:], code)
+	require.Equal(t, 1, underlying.reads)
+}
+
+func TestSharedStateCacheLimit(t *testing.T) {
+	underlying := &countingReader{}
+	entrySize := sharedEntrySize(codeKey(sharedCode, common.Hash{}), make([]byte, common.HashLength))
+	cache, err := NewSharedStateCache(uint64(3 * entrySize))
+	require.NoError(t, err)
+
+	r := NewSharedCachedReader(underlying, cache, common.HexToHash("0x0a"))
+	for i := byte(1); i <= 4; i++ {
+		_, err = r.ReadAccountCode(common.Address{}, 1, common.Hash{i})
+		require.NoError(t, err)
+	}
+	require.Equal(t, 3, cache.Len())
+	require.Equal(t, uint64(3*entrySize), cache.Size())
+	require.Equal(t, 4, underlying.reads)
+	// The least recently used code was evicted
+	_, err = r.ReadAccountCode(common.Address{}, 1, common.Hash{4})
+	require.NoError(t, err)
+	require.Equal(t, 4, underlying.reads)
+	_, err = r.ReadAccountCode(common.Address{}, 1, common.Hash{1})
+	require.NoError(t, err)
+	require.Equal(t, 5, underlying.reads)
+}
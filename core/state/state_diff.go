@@ -0,0 +1,118 @@
+package state
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	libstate "github.com/ledgerwatch/erigon-lib/state"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+)
+
+// AccountDiff is the change of an account between two txNums. Before or After is nil if the account did not exist
+type AccountDiff struct {
+	Before, After *accounts.Account
+	Storage       map[common.Hash]StorageDiff
+}
+
+type StorageDiff struct {
+	Before, After []byte
+}
+
+// StateDiff computes the accounts and storage changed between the states before fromTxNum and before toTxNum, without
+// re-executing the transactions: the changed keys are the keys of the inverted indices of account and storage history
+// after fromTxNum (in the files, and up to toTxNum in the database), which are compared at both txNums. The keys
+// changed back and forth between the txNums are not in the result. The cost depends on the number of changes after
+// fromTxNum, not on the size of the state
+func StateDiff(tx kv.Tx, ac *libstate.Aggregator22Context, fromTxNum, toTxNum uint64) (map[common.Address]*AccountDiff, error) {
+	before, after := NewHistoryReader22(ac), NewHistoryReader22(ac)
+	before.SetTx(tx)
+	before.SetTxNum(fromTxNum)
+	after.SetTx(tx)
+	after.SetTxNum(toTxNum)
+
+	changedAccounts := map[string]struct{}{}
+	for it := ac.IterateAccountsHistory(nil, nil, fromTxNum); it.HasNext(); {
+		key, _, _ := it.Next()
+		changedAccounts[string(key)] = struct{}{}
+	}
+	if err := changedKeysInDB(tx, kv.AccountHistoryKeys, fromTxNum, toTxNum, changedAccounts); err != nil {
+		return nil, err
+	}
+	changedStorage := map[string]struct{}{}
+	for it := ac.IterateStorageHistory(nil, nil, fromTxNum); it.HasNext(); {
+		key, _, _ := it.Next()
+		changedStorage[string(key)] = struct{}{}
+	}
+	if err := changedKeysInDB(tx, kv.StorageHistoryKeys, fromTxNum, toTxNum, changedStorage); err != nil {
+		return nil, err
+	}
+
+	diff := map[common.Address]*AccountDiff{}
+	for key := range changedAccounts {
+		address := common.BytesToAddress([]byte(key))
+		a, err := before.ReadAccountData(address)
+		if err != nil {
+			return nil, err
+		}
+		b, err := after.ReadAccountData(address)
+		if err != nil {
+			return nil, err
+		}
+		if (a == nil && b == nil) || (a != nil && b != nil && a.Equals(b)) {
+			continue
+		}
+		diff[address] = &AccountDiff{Before: a, After: b}
+	}
+	for key := range changedStorage {
+		address, location := common.BytesToAddress([]byte(key[:common.AddressLength])), common.BytesToHash([]byte(key[common.AddressLength:]))
+		a, err := before.ReadAccountStorage(address, FirstContractIncarnation, &location)
+		if err != nil {
+			return nil, err
+		}
+		b, err := after.ReadAccountStorage(address, FirstContractIncarnation, &location)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(a, b) {
+			continue
+		}
+		d, ok := diff[address]
+		if !ok {
+			d = &AccountDiff{}
+			if d.Before, err = before.ReadAccountData(address); err != nil {
+				return nil, err
+			}
+			d.After = d.Before
+			diff[address] = d
+		}
+		if d.Storage == nil {
+			d.Storage = map[common.Hash]StorageDiff{}
+		}
+		d.Storage[location] = StorageDiff{Before: common.CopyBytes(a), After: common.CopyBytes(b)}
+	}
+	return diff, nil
+}
+
+// changedKeysInDB adds the keys changed in [fromTxNum, toTxNum), from the part of the inverted index (txNum => keys)
+// not yet in the files
+func changedKeysInDB(tx kv.Tx, table string, fromTxNum, toTxNum uint64, changed map[string]struct{}) error {
+	c, err := tx.CursorDupSort(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	var fromKey [8]byte
+	binary.BigEndian.PutUint64(fromKey[:], fromTxNum)
+	for k, v, err := c.Seek(fromKey[:]); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if binary.BigEndian.Uint64(k) >= toTxNum {
+			break
+		}
+		changed[string(v)] = struct{}{}
+	}
+	return nil
+}
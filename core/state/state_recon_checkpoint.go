@@ -0,0 +1,228 @@
+package state
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+)
+
+// ReconCheckpointTable stores the progress of state reconstitution, so that it can be resumed after interruption
+// key - one of the reconCheckpoint* keys below
+const ReconCheckpointTable = "ReconCheckpoint"
+
+var (
+	reconCheckpointBlockKey    = []byte("block")    // target block number of the reconstitution
+	reconCheckpointTodoKey     = []byte("todo")     // serialised bitmap of txNums that need to be replayed
+	reconCheckpointDoneKey     = []byte("done")     // serialised bitmap of txNums with results flushed to the database
+	reconCheckpointTriggersKey = []byte("triggers") // pairs (dependency txNum, txNum) pending at the time of the checkpoint
+	reconCheckpointFlushedKey  = []byte("flushed")  // high-water mark - txNum up to which all txNums in todo are done
+)
+
+// Tables receiving the state produced by a window of txNums, when only the window is reconstituted.
+// Keys are the same as in PlainState, Code and PlainContractCode. Empty values mark deleted keys
+const (
+	ReconWindowPlainState        = "ReconWindowPlainState"
+	ReconWindowCode              = "ReconWindowCode"
+	ReconWindowPlainContractCode = "ReconWindowPlainContractCode"
+)
+
+// ReconDependencies stores the dependencies of the transactions to replay, predicted before the replay
+// key - txNum + txNum of the dependency, value - empty
+const ReconDependencies = "ReconDependencies"
+
+// ReconTablesCfg is the configuration of tables of the reconstitution database, including checkpoint
+// and window tables
+func ReconTablesCfg() kv.TableCfg {
+	cfg := kv.TableCfg{}
+	for table, tableCfg := range kv.ReconTablesCfg {
+		cfg[table] = tableCfg
+	}
+	cfg[ReconCheckpointTable] = kv.TableCfgItem{}
+	cfg[ReconWindowPlainState] = kv.TableCfgItem{}
+	cfg[ReconWindowCode] = kv.TableCfgItem{}
+	cfg[ReconWindowPlainContractCode] = kv.TableCfgItem{}
+	cfg[ReconDependencies] = kv.TableCfgItem{}
+	return cfg
+}
+
+// ReconCheckpoint is the progress of state reconstitution read from the database
+type ReconCheckpoint struct {
+	Block    uint64
+	Todo     *roaring64.Bitmap
+	Done     *roaring64.Bitmap
+	Triggers map[uint64][]uint64 // dependency => txNums waiting for it
+	Flushed  uint64              // all txNums in Todo up to this one are done, 0 if the first one is not
+}
+
+func putReconBitmap(rwTx kv.RwTx, key []byte, bitmap *roaring64.Bitmap) error {
+	var buf bytes.Buffer
+	if _, err := bitmap.WriteTo(&buf); err != nil {
+		return err
+	}
+	return rwTx.Put(ReconCheckpointTable, key, buf.Bytes())
+}
+
+func readReconBitmap(tx kv.Tx, key []byte) (*roaring64.Bitmap, error) {
+	v, err := tx.GetOne(ReconCheckpointTable, key)
+	if err != nil {
+		return nil, err
+	}
+	bitmap := roaring64.New()
+	if v == nil {
+		return bitmap, nil
+	}
+	if _, err = bitmap.ReadFrom(bytes.NewReader(v)); err != nil {
+		return nil, fmt.Errorf("reading recon checkpoint %s: %w", key, err)
+	}
+	return bitmap, nil
+}
+
+// SaveReconPlan records the target block and the set of txNums to be replayed, it needs to be called
+// before the first checkpoint is made
+func SaveReconPlan(rwTx kv.RwTx, block uint64, todo *roaring64.Bitmap) error {
+	if err := rwTx.ClearBucket(ReconCheckpointTable); err != nil {
+		return err
+	}
+	var blockKey [8]byte
+	binary.BigEndian.PutUint64(blockKey[:], block)
+	if err := rwTx.Put(ReconCheckpointTable, reconCheckpointBlockKey, blockKey[:]); err != nil {
+		return err
+	}
+	return putReconBitmap(rwTx, reconCheckpointTodoKey, todo)
+}
+
+// SaveCheckpoint records txNums that are done, and triggers that are pending. It is expected to be
+// called in the same transaction as Flush, so that done txNums correspond to the flushed changes
+func (rs *ReconState) SaveCheckpoint(rwTx kv.RwTx) error {
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+	return rs.saveCheckpoint(rwTx, &rs.doneBitmap)
+}
+
+// SaveFlushedCheckpoint is the same as SaveCheckpoint, but records given set of done txNums,
+// as returned by ParallelFlush
+func (rs *ReconState) SaveFlushedCheckpoint(rwTx kv.RwTx, done *roaring64.Bitmap) error {
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+	return rs.saveCheckpoint(rwTx, done)
+}
+
+// saveCheckpoint must be called with the lock held
+func (rs *ReconState) saveCheckpoint(rwTx kv.RwTx, done *roaring64.Bitmap) error {
+	if err := putReconBitmap(rwTx, reconCheckpointDoneKey, done); err != nil {
+		return err
+	}
+	var triggers []byte
+	for dependency, tt := range rs.triggers {
+		for _, t := range tt {
+			var pair [16]byte
+			binary.BigEndian.PutUint64(pair[:], dependency)
+			binary.BigEndian.PutUint64(pair[8:], t.TxNum)
+			triggers = append(triggers, pair[:]...)
+		}
+	}
+	if err := rwTx.Put(ReconCheckpointTable, reconCheckpointTriggersKey, triggers); err != nil {
+		return err
+	}
+	todo, err := readReconBitmap(rwTx, reconCheckpointTodoKey)
+	if err != nil {
+		return err
+	}
+	var flushed [8]byte
+	binary.BigEndian.PutUint64(flushed[:], reconHighWaterMark(todo, done))
+	return rwTx.Put(ReconCheckpointTable, reconCheckpointFlushedKey, flushed[:])
+}
+
+// reconHighWaterMark returns the txNum up to which all txNums in todo are done, 0 if the first one is not.
+// Transactions are done out of order, so the highest done txNum may have gaps below it
+func reconHighWaterMark(todo, done *roaring64.Bitmap) uint64 {
+	if todo.IsEmpty() {
+		return 0
+	}
+	notDone := roaring64.AndNot(todo, done)
+	if notDone.IsEmpty() {
+		return todo.Maximum()
+	}
+	first := notDone.Minimum()
+	if first == todo.Minimum() {
+		return 0
+	}
+	return first - 1
+}
+
+// ReadReconCheckpoint returns nil if there is no checkpoint in the database
+func ReadReconCheckpoint(tx kv.Tx) (*ReconCheckpoint, error) {
+	blockKey, err := tx.GetOne(ReconCheckpointTable, reconCheckpointBlockKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(blockKey) != 8 {
+		return nil, nil
+	}
+	cp := &ReconCheckpoint{Block: binary.BigEndian.Uint64(blockKey), Triggers: map[uint64][]uint64{}}
+	if cp.Todo, err = readReconBitmap(tx, reconCheckpointTodoKey); err != nil {
+		return nil, err
+	}
+	if cp.Done, err = readReconBitmap(tx, reconCheckpointDoneKey); err != nil {
+		return nil, err
+	}
+	triggers, err := tx.GetOne(ReconCheckpointTable, reconCheckpointTriggersKey)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i+16 <= len(triggers); i += 16 {
+		dependency := binary.BigEndian.Uint64(triggers[i:])
+		cp.Triggers[dependency] = append(cp.Triggers[dependency], binary.BigEndian.Uint64(triggers[i+8:]))
+	}
+	flushed, err := tx.GetOne(ReconCheckpointTable, reconCheckpointFlushedKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(flushed) == 8 {
+		cp.Flushed = binary.BigEndian.Uint64(flushed)
+	}
+	return cp, nil
+}
+
+// PendingDependencies inverts Triggers: txNum => dependencies it was waiting for. Only dependencies in Todo are
+// included, because others are not going to be replayed, and nothing would release the transactions waiting for them
+func (cp *ReconCheckpoint) PendingDependencies() map[uint64][]uint64 {
+	pending := map[uint64][]uint64{}
+	for dependency, txNums := range cp.Triggers {
+		if !cp.Todo.Contains(dependency) {
+			continue
+		}
+		for _, txNum := range txNums {
+			pending[txNum] = append(pending[txNum], dependency)
+		}
+	}
+	return pending
+}
+
+// RestoreDone marks txNums from the checkpoint as done, so that their results are read from the database
+func (rs *ReconState) RestoreDone(done *roaring64.Bitmap) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.doneBitmap.Or(done)
+	reconDoneGauge.Set(rs.doneBitmap.GetCardinality())
+}
+
+// RestoreCodes rebuilds the index of code stored by PutCode from CodeR table, when resuming from the checkpoint
+func (rs *ReconState) RestoreCodes(tx kv.Tx) error {
+	rs.codeLock.Lock()
+	defer rs.codeLock.Unlock()
+	return tx.ForEach(kv.CodeR, nil, func(k, v []byte) error {
+		if len(v) == 0 {
+			return nil
+		}
+		codeHash := common.BytesToHash(k[8:])
+		if _, ok := rs.codes[codeHash]; !ok {
+			rs.codes[codeHash] = binary.BigEndian.Uint64(k)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,78 @@
+package state
+
+import (
+	"context"
+	"testing"
+
+	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconCheckpoint(t *testing.T) {
+	tx, err := newReconTestDB(t).BeginRw(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+	cp, err := ReadReconCheckpoint(tx)
+	require.NoError(t, err)
+	require.Nil(t, cp)
+
+	workCh := make(chan *TxTask, 16)
+	rs := NewReconState(workCh, ReconSchedulerCfg{QueueDepth: 4})
+	ctx := context.Background()
+	for _, txNum := range []uint64{1, 2, 3} {
+		workCh <- &TxTask{TxNum: txNum}
+	}
+	close(workCh)
+	require.NoError(t, SaveReconPlan(tx, 10, roaring64.BitmapOf(1, 2, 3)))
+	txTask, ok := rs.Schedule(ctx)
+	require.True(t, ok)
+	require.Equal(t, uint64(1), txTask.TxNum)
+	// txNum 1 waits for txNum 3
+	rs.RollbackTx(txTask, 3, nil)
+	txTask, ok = rs.Schedule(ctx)
+	require.True(t, ok)
+	require.Equal(t, uint64(2), txTask.TxNum)
+	rs.CommitTxNum(2)
+	require.NoError(t, rs.SaveCheckpoint(tx))
+
+	cp, err = ReadReconCheckpoint(tx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), cp.Block)
+	require.Equal(t, []uint64{1, 2, 3}, cp.Todo.ToArray())
+	require.Equal(t, []uint64{2}, cp.Done.ToArray())
+	require.Equal(t, map[uint64][]uint64{3: {1}}, cp.Triggers)
+	// txNum 2 is done, but txNum 1 is not
+	require.Zero(t, cp.Flushed)
+	require.Equal(t, map[uint64][]uint64{1: {3}}, cp.PendingDependencies())
+
+	// Dependencies outside of the plan are not restored
+	cp.Triggers[20] = []uint64{3}
+	require.Equal(t, map[uint64][]uint64{1: {3}}, cp.PendingDependencies())
+
+	// Flushed set of txNums is recorded instead of done ones
+	require.NoError(t, rs.SaveFlushedCheckpoint(tx, roaring64.New()))
+	cp, err = ReadReconCheckpoint(tx)
+	require.NoError(t, err)
+	require.True(t, cp.Done.IsEmpty())
+	require.Zero(t, cp.Flushed)
+	require.NoError(t, rs.SaveFlushedCheckpoint(tx, roaring64.BitmapOf(1, 3)))
+	cp, err = ReadReconCheckpoint(tx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), cp.Flushed)
+	require.NoError(t, rs.SaveFlushedCheckpoint(tx, roaring64.BitmapOf(1, 2, 3)))
+	cp, err = ReadReconCheckpoint(tx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), cp.Flushed)
+}
+
+func TestReconHighWaterMark(t *testing.T) {
+	todo := roaring64.BitmapOf(5, 6, 8)
+	require.Zero(t, reconHighWaterMark(roaring64.New(), roaring64.New()))
+	// The first txNum in the plan is not done
+	require.Zero(t, reconHighWaterMark(todo, roaring64.New()))
+	require.Zero(t, reconHighWaterMark(todo, roaring64.BitmapOf(6, 8)))
+	require.Equal(t, uint64(5), reconHighWaterMark(todo, roaring64.BitmapOf(5)))
+	// txNum 7 is not in the plan
+	require.Equal(t, uint64(7), reconHighWaterMark(todo, roaring64.BitmapOf(5, 6)))
+	require.Equal(t, uint64(8), reconHighWaterMark(todo, roaring64.BitmapOf(5, 6, 8)))
+}
@@ -0,0 +1,96 @@
+package state
+
+import (
+	"sort"
+
+	"github.com/ledgerwatch/erigon/common"
+)
+
+// reconConflicts accumulates causes of rollbacks, it is only allocated when conflict tracking is enabled
+type reconConflicts struct {
+	deps map[uint64]uint64 // dependency txNum => number of rollbacks it caused
+	keys map[string]uint64 // address or address+location => number of rollbacks it caused
+}
+
+type ReconConflictAddr struct {
+	Address common.Address `json:"address"`
+	Count   uint64         `json:"count"`
+}
+
+type ReconConflictSlot struct {
+	Address  common.Address `json:"address"`
+	Location common.Hash    `json:"location"`
+	Count    uint64         `json:"count"`
+}
+
+type ReconConflictDep struct {
+	TxNum uint64 `json:"txNum"`
+	Count uint64 `json:"count"`
+}
+
+// ReconConflictReport summarises what causes rollbacks during reconstitution
+type ReconConflictReport struct {
+	Rollbacks    uint64              `json:"rollbacks"`
+	Contracts    []ReconConflictAddr `json:"contracts"`    // addresses with most rollbacks, including rollbacks on their storage
+	StorageSlots []ReconConflictSlot `json:"storageSlots"` // storage slots with most rollbacks
+	Dependencies []ReconConflictDep  `json:"dependencies"` // txNums that caused most rollbacks
+}
+
+// TrackConflicts enables recording of the keys and dependencies causing rollbacks, for ConflictReport
+func (rs *ReconState) TrackConflicts() {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.conflicts = &reconConflicts{deps: map[uint64]uint64{}, keys: map[string]uint64{}}
+}
+
+// recordConflict must be called with the lock held
+func (rs *ReconState) recordConflict(dependency uint64, conflictKey []byte) {
+	if rs.conflicts == nil {
+		return
+	}
+	rs.conflicts.deps[dependency]++
+	if len(conflictKey) > 0 {
+		rs.conflicts.keys[string(conflictKey)]++
+	}
+}
+
+// ConflictReport returns up to limit top entries in each category, or nil if conflict tracking is not enabled
+func (rs *ReconState) ConflictReport(limit int) *ReconConflictReport {
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+	if rs.conflicts == nil {
+		return nil
+	}
+	report := &ReconConflictReport{Rollbacks: rs.rollbackCount}
+	contracts := map[common.Address]uint64{}
+	for key, count := range rs.conflicts.keys {
+		addr := common.BytesToAddress([]byte(key[:common.AddressLength]))
+		contracts[addr] += count
+		if len(key) == common.AddressLength+common.HashLength {
+			report.StorageSlots = append(report.StorageSlots, ReconConflictSlot{
+				Address:  addr,
+				Location: common.BytesToHash([]byte(key[common.AddressLength:])),
+				Count:    count,
+			})
+		}
+	}
+	for addr, count := range contracts {
+		report.Contracts = append(report.Contracts, ReconConflictAddr{Address: addr, Count: count})
+	}
+	for txNum, count := range rs.conflicts.deps {
+		report.Dependencies = append(report.Dependencies, ReconConflictDep{TxNum: txNum, Count: count})
+	}
+	sort.Slice(report.Contracts, func(i, j int) bool { return report.Contracts[i].Count > report.Contracts[j].Count })
+	sort.Slice(report.StorageSlots, func(i, j int) bool { return report.StorageSlots[i].Count > report.StorageSlots[j].Count })
+	sort.Slice(report.Dependencies, func(i, j int) bool { return report.Dependencies[i].Count > report.Dependencies[j].Count })
+	if len(report.Contracts) > limit {
+		report.Contracts = report.Contracts[:limit]
+	}
+	if len(report.StorageSlots) > limit {
+		report.StorageSlots = report.StorageSlots[:limit]
+	}
+	if len(report.Dependencies) > limit {
+		report.Dependencies = report.Dependencies[:limit]
+	}
+	return report
+}
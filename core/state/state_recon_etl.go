@@ -0,0 +1,217 @@
+package state
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sync/atomic"
+
+	"github.com/ledgerwatch/erigon-lib/etl"
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+// reconArena is the alternative to btrees for storing changes of a shard, selected by UseETL.
+// All records are appended to a single byte slice, and the index does not contain pointers, so that
+// hundreds of millions of items do not put pressure on GC. Sorting is left to etl.Collector at flush time.
+// Record layout: offset+1 of the previous record with the same hash (4 bytes, 0 if none), flags (1 byte),
+// table length (1 byte), key length (2 bytes), value length (4 bytes), table, key (as in recon tables), value.
+// Offsets are 4 bytes, so once the data reaches reconArenaLimit, the arena is sealed and the records go into
+// a new one, which keeps the sealed arena as prev. Lookups and the flush walk the whole chain
+type reconArena struct {
+	index map[uint64]uint32 // hash of table and key => offset+1 of the latest record with this hash
+	data  []byte
+	prev  *reconArena // sealed arena with the older records, nil if none
+}
+
+const reconArenaHeader = 4 + 1 + 1 + 2 + 4
+
+// reconArenaLimit is the size of the data at which the arena is sealed, a variable to be lowered by the tests
+var reconArenaLimit = math.MaxUint32
+
+const (
+	reconArenaDeleted    = 1 << iota // record is a tombstone
+	reconArenaSuperseded             // record has been replaced by a newer one with the same table and key
+)
+
+func newReconArena() *reconArena {
+	return &reconArena{index: map[uint64]uint32{}}
+}
+
+// reconArenaHash is FNV-1a hash of the table name and the key
+func reconArenaHash(table string, key []byte) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(table); i++ {
+		h = (h ^ uint64(table[i])) * 1099511628211
+	}
+	for _, b := range key {
+		h = (h ^ uint64(b)) * 1099511628211
+	}
+	return h
+}
+
+// find returns the offset of the latest record for table and key, or -1
+func (a *reconArena) find(table string, key []byte, h uint64) int {
+	for next := a.index[h]; next != 0; {
+		off := int(next - 1)
+		tableLen, keyLen := int(a.data[off+5]), int(binary.BigEndian.Uint16(a.data[off+6:]))
+		start := off + reconArenaHeader
+		if string(a.data[start:start+tableLen]) == table && bytes.Equal(a.data[start+tableLen:start+tableLen+keyLen], key) {
+			return off
+		}
+		next = binary.BigEndian.Uint32(a.data[off:])
+	}
+	return -1
+}
+
+// put appends the record, and returns the arena that has received it: a new one chained to a,
+// if there is no room left in a
+func (a *reconArena) put(table string, key, val []byte, deleted bool) *reconArena {
+	off := len(a.data)
+	if off > 0 && off+reconArenaHeader+len(table)+len(key)+len(val) >= reconArenaLimit {
+		next := newReconArena()
+		next.prev = a
+		return next.put(table, key, val, deleted)
+	}
+	h := reconArenaHash(table, key)
+	// The latest record for the key can be in a sealed arena
+	for b := a; b != nil; b = b.prev {
+		if prev := b.find(table, key, h); prev >= 0 {
+			b.data[prev+4] |= reconArenaSuperseded
+			break
+		}
+	}
+	var header [reconArenaHeader]byte
+	binary.BigEndian.PutUint32(header[:], a.index[h])
+	if deleted {
+		header[4] = reconArenaDeleted
+	}
+	header[5] = byte(len(table))
+	binary.BigEndian.PutUint16(header[6:], uint16(len(key)))
+	binary.BigEndian.PutUint32(header[8:], uint32(len(val)))
+	a.data = append(a.data, header[:]...)
+	a.data = append(a.data, table...)
+	a.data = append(a.data, key...)
+	a.data = append(a.data, val...)
+	a.index[h] = uint32(off + 1)
+	return a
+}
+
+// get returns the value of the latest record, tombstones have non-nil empty values
+func (a *reconArena) get(table string, key []byte) ([]byte, bool) {
+	h := reconArenaHash(table, key)
+	off := a.find(table, key, h)
+	for off < 0 {
+		if a = a.prev; a == nil {
+			return nil, false
+		}
+		off = a.find(table, key, h)
+	}
+	if a.data[off+4]&reconArenaDeleted != 0 {
+		return []byte{}, true
+	}
+	tableLen, keyLen := int(a.data[off+5]), int(binary.BigEndian.Uint16(a.data[off+6:]))
+	valLen := int(binary.BigEndian.Uint32(a.data[off+8:]))
+	start := off + reconArenaHeader + tableLen + keyLen
+	return a.data[start : start+valLen : start+valLen], true
+}
+
+// forEach visits latest records in the order they were added, starting from the sealed arenas
+func (a *reconArena) forEach(f func(table string, key, val []byte, deleted bool) error) error {
+	if a.prev != nil {
+		if err := a.prev.forEach(f); err != nil {
+			return err
+		}
+	}
+	for off := 0; off < len(a.data); {
+		flags := a.data[off+4]
+		tableLen, keyLen := int(a.data[off+5]), int(binary.BigEndian.Uint16(a.data[off+6:]))
+		valLen := int(binary.BigEndian.Uint32(a.data[off+8:]))
+		start := off + reconArenaHeader
+		next := start + tableLen + keyLen + valLen
+		if flags&reconArenaSuperseded == 0 {
+			if err := f(string(a.data[start:start+tableLen]), a.data[start+tableLen:start+tableLen+keyLen], a.data[start+tableLen+keyLen:next], flags&reconArenaDeleted != 0); err != nil {
+				return err
+			}
+		}
+		off = next
+	}
+	return nil
+}
+
+func (a *reconArena) reset() {
+	a.index = map[uint64]uint32{}
+	a.data = nil
+	a.prev = nil
+}
+
+// UseETL switches ReconState to keep changes in arenas instead of btrees, and to sort them with etl collectors
+// (spilling into files in tmpdir) when flushing. It needs to be called before any changes are added, and
+// cannot be combined with SetSpill or ParallelFlush
+func (rs *ReconState) UseETL(tmpdir string) {
+	rs.etlTmpDir = tmpdir
+	for i := range rs.shards {
+		rs.shards[i].arena = newReconArena()
+	}
+}
+
+func (rs *ReconState) putArena(table string, key1, key2, val []byte, deleted bool, txNum uint64) error {
+	key := reconCompositeKey(txNum, key1, key2)
+	sh := &rs.shards[reconShardIdx(table, key1)]
+	sh.lock.Lock()
+	sh.arena = sh.arena.put(table, key, val, deleted)
+	sh.lock.Unlock()
+	sizeEstimate := atomic.AddUint64(&rs.sizeEstimate, uint64(reconArenaHeader+len(table)+len(key)+len(val))+16 /* index entry */)
+	reconSizeGauge.Set(sizeEstimate)
+	return nil
+}
+
+func (rs *ReconState) getArena(table string, key1, key2 []byte, txNum uint64) []byte {
+	key := reconCompositeKey(txNum, key1, key2)
+	sh := &rs.shards[reconShardIdx(table, key1)]
+	sh.lock.RLock()
+	defer sh.lock.RUnlock()
+	if val, ok := sh.arena.get(table, key); ok {
+		return val
+	}
+	return nil
+}
+
+// flushArenas sorts the contents of all arenas with etl collectors, one per table, and writes them into rwTx.
+// Must be called with all shard locks held
+func (rs *ReconState) flushArenas(rwTx kv.RwTx) error {
+	collectors := map[string]*etl.Collector{}
+	defer func() {
+		for _, collector := range collectors {
+			collector.Close()
+		}
+	}()
+	for i := range rs.shards {
+		if err := rs.shards[i].arena.forEach(func(table string, key, val []byte, deleted bool) error {
+			if len(val) == 0 && !deleted {
+				return nil
+			}
+			collector, ok := collectors[table]
+			if !ok {
+				collector = etl.NewCollector("recon "+table, rs.etlTmpDir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+				collectors[table] = collector
+			}
+			return collector.Collect(key, val)
+		}); err != nil {
+			return err
+		}
+	}
+	for table, collector := range collectors {
+		table := table
+		if err := collector.Load(nil, "", func(k, v []byte, _ etl.CurrentTableReader, _ etl.LoadNextFunc) error {
+			return rwTx.Put(table, k, v)
+		}, etl.TransformArgs{}); err != nil {
+			return err
+		}
+	}
+	for i := range rs.shards {
+		rs.shards[i].arena.reset()
+	}
+	atomic.StoreUint64(&rs.sizeEstimate, 0)
+	reconSizeGauge.Set(0)
+	return nil
+}
@@ -0,0 +1,33 @@
+package state
+
+import (
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	reconQueueGauge    = newReconGauge(`recon_queue`)    // transactions ready to be scheduled
+	reconTriggersGauge = newReconGauge(`recon_triggers`) // transactions waiting for their dependencies
+	reconDoneGauge     = newReconGauge(`recon_done`)     // including the ones restored from the checkpoint
+	reconRollbacks     = metrics.GetOrCreateCounter(`recon_rollbacks`)
+	reconSizeGauge     = newReconGauge(`recon_size_estimate`)
+	reconFlushTimer    = metrics.GetOrCreateSummary(`recon_flush_seconds{mode="serial"}`)
+	reconParFlushTimer = metrics.GetOrCreateSummary(`recon_flush_seconds{mode="parallel"}`)
+)
+
+// reconGauge holds the value of a gauge, which is read by the callback of the metric, so that it is exported
+// as a gauge rather than as a counter
+type reconGauge struct {
+	v uint64 // accessed atomically
+}
+
+func newReconGauge(name string) *reconGauge {
+	g := &reconGauge{}
+	metrics.GetOrCreateGauge(name, func() float64 { return float64(atomic.LoadUint64(&g.v)) })
+	return g
+}
+
+func (g *reconGauge) Set(v uint64) { atomic.StoreUint64(&g.v, v) }
+
+func (g *reconGauge) Inc() { atomic.AddUint64(&g.v, 1) }
@@ -5,14 +5,19 @@ import (
 
 	"bytes"
 	"container/heap"
+	"context"
 	"encoding/binary"
+	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"github.com/RoaringBitmap/roaring/roaring64"
 	"github.com/google/btree"
 	"github.com/holiman/uint256"
 	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/etl"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	libstate "github.com/ledgerwatch/erigon-lib/state"
 	"github.com/ledgerwatch/erigon/common"
@@ -24,6 +29,15 @@ type ReconStateItem struct {
 	txNum      uint64 // txNum where the item has been created
 	key1, key2 []byte
 	val        []byte
+	deleted    bool // tombstone - the key has been deleted by txNum
+}
+
+// value returns the value of the item as it is seen by the readers, tombstones have non-nil empty values
+func (i ReconStateItem) value() []byte {
+	if i.deleted {
+		return []byte{}
+	}
+	return i.val
 }
 
 func (i ReconStateItem) Less(than btree.Item) bool {
@@ -39,128 +53,724 @@ func (i ReconStateItem) Less(than btree.Item) bool {
 	return i.txNum < thanItem.txNum
 }
 
+// ReconSchedulerCfg controls how ReconState pulls work from the work channel into its queue
+type ReconSchedulerCfg struct {
+	QueueDepth    int // Maximum number of txNums kept in the queue after a refill
+	PrefetchBatch int // Maximum number of txNums pulled from the work channel during one refill
+	LowWatermark  int // Refill happens only when the queue has fewer than this many txNums
+	// If non-zero, instead of the lowest txNum, the transaction with the highest GasUsed is scheduled out of
+	// the ones in the queue that are within GasWindow txNums from the lowest one. Starting heavy transactions
+	// earlier reduces the time workers wait for the stragglers at the tail of each batch
+	GasWindow uint64
+}
+
+var DefaultReconSchedulerCfg = ReconSchedulerCfg{
+	QueueDepth:    16,
+	PrefetchBatch: 16,
+	LowWatermark:  16,
+}
+
+// reconShardCount is the number of shards that changes of ReconState are split into,
+// to reduce lock contention between the workers
+const reconShardCount = 64
+
+// reconShard holds a portion of changes, selected by the hash of table and key1
+type reconShard struct {
+	lock    sync.RWMutex
+	changes map[string]*btree.BTree // table => [] (txNum; key1; key2; val)
+	arena   *reconArena             // used instead of changes if UseETL has been called
+}
+
 // ReconState is the accumulator of changes to the state
 type ReconState struct {
-	lock          sync.RWMutex
+	lock          sync.RWMutex // guards scheduling state: doneBitmap, triggers, queue and the counters
 	doneBitmap    roaring64.Bitmap
 	triggers      map[uint64][]*TxTask
+	triggerCount  int // number of transactions in triggers
 	workCh        chan *TxTask
+	schedCfg      ReconSchedulerCfg
 	queue         TxTaskQueue
-	changes       map[string]*btree.BTree // table => [] (txNum; key1; key2; val)
-	sizeEstimate  uint64
 	rollbackCount uint64
+	deferCount    uint64 // number of times a transaction was deferred because of its known dependencies
+	conflicts     *reconConflicts
+	shards        [reconShardCount]reconShard
+	sizeEstimate  uint64 // accessed atomically
+	// Optional source of transactions outside of the plan, see SetOnDemand
+	planned   *roaring64.Bitmap
+	requested roaring64.Bitmap
+	newTask   func(txNum uint64) *TxTask
+	etlTmpDir string // if not empty, changes are kept in arenas and sorted by etl collectors, see UseETL
+	// Code is stored only once, under the first txNum that produced it
+	codeLock sync.RWMutex
+	codes    map[common.Hash]uint64 // codeHash => txNum under which the code is stored in CodeR
+	// Changes taken out of the shards by ParallelFlush. They remain visible to Get until ReleaseFrozen is called
+	frozenLock sync.RWMutex
+	frozen     *[reconShardCount]map[string]*btree.BTree
+	// Optional spill-over database. When the size estimate exceeds spillBudget,
+	// contents of the btrees are moved into the spill database as a sorted run, and merged
+	// into the target transaction on Flush
+	spillLock   sync.RWMutex // guards spill fields, and needs to be taken before any shard lock
+	spill       *reconSpill
+	spillBudget uint64
+	spillCount  uint64
+	// Spilled runs written out by ParallelFlush, which remain readable by Get until ReleaseFrozen. Meanwhile the
+	// changes are spilled into spareSpillDb, and ReleaseFrozen makes the database of the frozen runs the spare one
+	frozenSpill  *reconSpill
+	spareSpillDb kv.RwDB
+}
+
+// reconSpill is a spill database with the runs spilled into it
+type reconSpill struct {
+	db      kv.RwDB
+	spilled map[string]struct{} // tables that have items in db
+	// Read transactions of db reused by Get, so that a miss in the btrees does not begin a new transaction.
+	// Each is used by one reader at a time, and all of them are rolled back when the database changes
+	txLock sync.Mutex
+	txs    []kv.Tx
 }
 
-func NewReconState(workCh chan *TxTask) *ReconState {
+func newReconSpill(db kv.RwDB) *reconSpill {
+	return &reconSpill{db: db, spilled: map[string]struct{}{}}
+}
+
+func NewReconState(workCh chan *TxTask, schedCfg ReconSchedulerCfg) *ReconState {
+	if schedCfg.QueueDepth <= 0 {
+		schedCfg.QueueDepth = DefaultReconSchedulerCfg.QueueDepth
+	}
+	if schedCfg.PrefetchBatch <= 0 {
+		schedCfg.PrefetchBatch = schedCfg.QueueDepth
+	}
+	if schedCfg.LowWatermark <= 0 || schedCfg.LowWatermark > schedCfg.QueueDepth {
+		schedCfg.LowWatermark = schedCfg.QueueDepth
+	}
 	rs := &ReconState{
 		workCh:   workCh,
+		schedCfg: schedCfg,
 		triggers: map[uint64][]*TxTask{},
-		changes:  map[string]*btree.BTree{},
+		codes:    map[common.Hash]uint64{},
+	}
+	for i := range rs.shards {
+		rs.shards[i].changes = map[string]*btree.BTree{}
 	}
 	return rs
 }
 
-func (rs *ReconState) Put(table string, key1, key2, val []byte, txNum uint64) {
-	rs.lock.Lock()
-	defer rs.lock.Unlock()
-	t, ok := rs.changes[table]
+// reconShardIdx selects the shard by FNV-1a hash of the table name and key1
+func reconShardIdx(table string, key1 []byte) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(table); i++ {
+		h = (h ^ uint32(table[i])) * 16777619
+	}
+	for _, b := range key1 {
+		h = (h ^ uint32(b)) * 16777619
+	}
+	return int(h % reconShardCount)
+}
+
+func (rs *ReconState) lockShards() {
+	for i := range rs.shards {
+		rs.shards[i].lock.Lock()
+	}
+}
+
+func (rs *ReconState) unlockShards() {
+	for i := range rs.shards {
+		rs.shards[i].lock.Unlock()
+	}
+}
+
+// SetSpill enables spilling of accumulated changes into the given databases (which need to have
+// recon tables created) once the size estimate reaches memoryBudget bytes. The changes are spilled into db,
+// and into spareDb while ParallelFlush writes out the runs spilled into db
+func (rs *ReconState) SetSpill(db, spareDb kv.RwDB, memoryBudget uint64) {
+	rs.spillLock.Lock()
+	defer rs.spillLock.Unlock()
+	rs.spill = newReconSpill(db)
+	rs.spareSpillDb = spareDb
+	rs.spillBudget = memoryBudget
+}
+
+// CloseSpill releases the read transactions of the spill databases. Needs to be called before the databases are closed
+func (rs *ReconState) CloseSpill() {
+	rs.spillLock.Lock()
+	defer rs.spillLock.Unlock()
+	if rs.spill != nil {
+		rs.spill.closeTxs()
+	}
+	if rs.frozenSpill != nil {
+		rs.frozenSpill.closeTxs()
+	}
+}
+
+func (rs *ReconState) Put(table string, key1, key2, val []byte, txNum uint64) error {
+	if rs.etlTmpDir != "" {
+		return rs.putArena(table, key1, key2, val, false, txNum)
+	}
+	return rs.put(table, ReconStateItem{key1: libcommon.Copy(key1), key2: libcommon.Copy(key2), val: libcommon.Copy(val), txNum: txNum})
+}
+
+// Delete records a tombstone, which is flushed as an empty value, so that the key is absent from the
+// reconstituted state. Get returns non-nil empty value for the tombstone
+func (rs *ReconState) Delete(table string, key1, key2 []byte, txNum uint64) error {
+	if rs.etlTmpDir != "" {
+		return rs.putArena(table, key1, key2, nil, true, txNum)
+	}
+	return rs.put(table, ReconStateItem{key1: libcommon.Copy(key1), key2: libcommon.Copy(key2), deleted: true, txNum: txNum})
+}
+
+func (rs *ReconState) put(table string, item ReconStateItem) error {
+	sh := &rs.shards[reconShardIdx(table, item.key1)]
+	sh.lock.Lock()
+	t, ok := sh.changes[table]
 	if !ok {
 		t = btree.New(32)
-		rs.changes[table] = t
+		sh.changes[table] = t
 	}
-	item := ReconStateItem{key1: libcommon.Copy(key1), key2: libcommon.Copy(key2), val: libcommon.Copy(val), txNum: txNum}
 	t.ReplaceOrInsert(item)
-	rs.sizeEstimate += uint64(unsafe.Sizeof(item)) + uint64(len(key1)) + uint64(len(key2)) + uint64(len(val))
+	sh.lock.Unlock()
+	sizeEstimate := atomic.AddUint64(&rs.sizeEstimate, uint64(unsafe.Sizeof(item))+uint64(len(item.key1))+uint64(len(item.key2))+uint64(len(item.val)))
+	reconSizeGauge.Set(sizeEstimate)
+	rs.spillLock.RLock()
+	needSpill := rs.spill != nil && sizeEstimate >= rs.spillBudget
+	rs.spillLock.RUnlock()
+	if needSpill {
+		return rs.spillChanges()
+	}
+	return nil
 }
 
-func (rs *ReconState) Get(table string, key1, key2 []byte, txNum uint64) []byte {
-	rs.lock.RLock()
-	defer rs.lock.RUnlock()
-	t, ok := rs.changes[table]
-	if !ok {
+func (rs *ReconState) Get(table string, key1, key2 []byte, txNum uint64) ([]byte, error) {
+	if rs.etlTmpDir != "" {
+		return rs.getArena(table, key1, key2, txNum), nil
+	}
+	shardIdx := reconShardIdx(table, key1)
+	sh := &rs.shards[shardIdx]
+	sh.lock.RLock()
+	if t, ok := sh.changes[table]; ok {
+		if i := t.Get(ReconStateItem{txNum: txNum, key1: key1, key2: key2}); i != nil {
+			sh.lock.RUnlock()
+			return i.(ReconStateItem).value(), nil
+		}
+	}
+	sh.lock.RUnlock()
+	// The more recent changes are looked up first: the runs spilled since the last ParallelFlush, then the changes
+	// it has swapped out, then the runs spilled before it
+	rs.spillLock.RLock()
+	defer rs.spillLock.RUnlock()
+	if rs.spill != nil {
+		if v, err := rs.spill.get(table, reconCompositeKey(txNum, key1, key2)); err != nil || v != nil {
+			return v, err
+		}
+	}
+	rs.frozenLock.RLock()
+	if rs.frozen != nil {
+		if t, ok := rs.frozen[shardIdx][table]; ok {
+			if i := t.Get(ReconStateItem{txNum: txNum, key1: key1, key2: key2}); i != nil {
+				rs.frozenLock.RUnlock()
+				return i.(ReconStateItem).value(), nil
+			}
+		}
+	}
+	rs.frozenLock.RUnlock()
+	if rs.frozenSpill != nil {
+		return rs.frozenSpill.get(table, reconCompositeKey(txNum, key1, key2))
+	}
+	return nil, nil
+}
+
+// get returns the spilled value, nil if there is none. Must be called with the spill read lock held
+func (s *reconSpill) get(table string, key []byte) ([]byte, error) {
+	if _, ok := s.spilled[table]; !ok {
+		return nil, nil
+	}
+	tx, err := s.tx()
+	if err != nil {
+		return nil, err
+	}
+	defer s.releaseTx(tx)
+	v, err := tx.GetOne(table, key)
+	if err != nil {
+		return nil, err
+	}
+	return libcommon.Copy(v), nil
+}
+
+// tx returns a read transaction of the spill database that is not used by other readers.
+// Must be called with the spill read lock held
+func (s *reconSpill) tx() (kv.Tx, error) {
+	s.txLock.Lock()
+	if n := len(s.txs); n > 0 {
+		tx := s.txs[n-1]
+		s.txs = s.txs[:n-1]
+		s.txLock.Unlock()
+		return tx, nil
+	}
+	s.txLock.Unlock()
+	return s.db.BeginRo(context.Background())
+}
+
+func (s *reconSpill) releaseTx(tx kv.Tx) {
+	s.txLock.Lock()
+	defer s.txLock.Unlock()
+	s.txs = append(s.txs, tx)
+}
+
+// closeTxs rolls back the read transactions of the spill database, before its contents change.
+// Must be called with the spill lock held, so that none of the transactions is in use
+func (s *reconSpill) closeTxs() {
+	s.txLock.Lock()
+	defer s.txLock.Unlock()
+	for _, tx := range s.txs {
+		tx.Rollback()
+	}
+	s.txs = nil
+}
+
+// PutCode stores the code in CodeR under txNum, unless the same code has already been stored under another txNum
+func (rs *ReconState) PutCode(codeHash common.Hash, code []byte, txNum uint64) error {
+	if len(code) == 0 {
+		return rs.Put(kv.CodeR, codeHash[:], nil, code, txNum)
+	}
+	rs.codeLock.Lock()
+	defer rs.codeLock.Unlock()
+	if _, ok := rs.codes[codeHash]; ok {
 		return nil
 	}
-	i := t.Get(ReconStateItem{txNum: txNum, key1: key1, key2: key2})
-	if i == nil {
+	if err := rs.Put(kv.CodeR, codeHash[:], nil, code, txNum); err != nil {
+		return err
+	}
+	rs.codes[codeHash] = txNum
+	return nil
+}
+
+// CodeTxNum returns txNum under which the code is stored in CodeR, if it has been stored by PutCode, or txNum otherwise
+func (rs *ReconState) CodeTxNum(codeHash common.Hash, txNum uint64) uint64 {
+	rs.codeLock.RLock()
+	defer rs.codeLock.RUnlock()
+	if codeTxNum, ok := rs.codes[codeHash]; ok {
+		return codeTxNum
+	}
+	return txNum
+}
+
+// reconCompositeKey produces the key under which item is stored in the recon tables: txNum, followed
+// by key1, followed by key2. For storage items, key2 is the incarnation followed by the location
+func reconCompositeKey(txNum uint64, key1, key2 []byte) []byte {
+	composite := make([]byte, 8+len(key1)+len(key2))
+	binary.BigEndian.PutUint64(composite, txNum)
+	copy(composite[8:], key1)
+	copy(composite[8+len(key1):], key2)
+	return composite
+}
+
+// ReconStorageKey2 is key2 of storage items in ReconState - incarnation followed by the location
+func ReconStorageKey2(incarnation uint64, location []byte) []byte {
+	key2 := make([]byte, 8+len(location))
+	binary.BigEndian.PutUint64(key2, incarnation)
+	copy(key2[8:], location)
+	return key2
+}
+
+// ReconIncarnationKey2 is key2 of the item that goes with the tombstone of a deleted contract account, or with the
+// account of a created contract, and keeps the incarnation of the contract, the same way kv.IncarnationMap does, so
+// that the contract re-created on the same address gets the next incarnation. These items are not part of the
+// reconstituted state
+var ReconIncarnationKey2 = make([]byte, 8)
+
+// flushChanges writes out contents of the btrees of all shards into rwTx and clears them.
+// Must be called with all shard locks held
+func (rs *ReconState) flushChanges(rwTx kv.RwTx) error {
+	for i := range rs.shards {
+		for table, t := range rs.shards[i].changes {
+			var err error
+			t.Ascend(func(it btree.Item) bool {
+				item := it.(ReconStateItem)
+				if len(item.val) == 0 && !item.deleted {
+					return true
+				}
+				if err = rwTx.Put(table, reconCompositeKey(item.txNum, item.key1, item.key2), item.value()); err != nil {
+					return false
+				}
+				return true
+			})
+			if err != nil {
+				return err
+			}
+			t.Clear(true)
+		}
+	}
+	atomic.StoreUint64(&rs.sizeEstimate, 0)
+	reconSizeGauge.Set(0)
+	return nil
+}
+
+// spillChanges moves the current contents of the btrees into the spill database as one sorted run
+func (rs *ReconState) spillChanges() error {
+	rs.spillLock.Lock()
+	defer rs.spillLock.Unlock()
+	if atomic.LoadUint64(&rs.sizeEstimate) < rs.spillBudget {
+		// Another worker has spilled already
 		return nil
 	}
-	return i.(ReconStateItem).val
+	rs.lockShards()
+	defer rs.unlockShards()
+	rs.spill.closeTxs()
+	if err := rs.spill.db.Update(context.Background(), func(tx kv.RwTx) error {
+		for i := range rs.shards {
+			for table, t := range rs.shards[i].changes {
+				if t.Len() > 0 {
+					rs.spill.spilled[table] = struct{}{}
+				}
+			}
+		}
+		return rs.flushChanges(tx)
+	}); err != nil {
+		return err
+	}
+	rs.spillCount++
+	return nil
+}
+
+// SpillCount returns how many times the changes were spilled into the spill database
+func (rs *ReconState) SpillCount() uint64 {
+	rs.spillLock.RLock()
+	defer rs.spillLock.RUnlock()
+	return rs.spillCount
 }
 
 func (rs *ReconState) Flush(rwTx kv.RwTx) error {
-	rs.lock.Lock()
-	defer rs.lock.Unlock()
-	for table, t := range rs.changes {
-		var err error
-		t.Ascend(func(i btree.Item) bool {
-			item := i.(ReconStateItem)
-			if len(item.val) == 0 {
-				return true
+	defer reconFlushTimer.UpdateDuration(time.Now())
+	defer TimeExecPhase(PhaseReconFlush, time.Now())
+	if rs.etlTmpDir != "" {
+		rs.lockShards()
+		defer rs.unlockShards()
+		return rs.flushArenas(rwTx)
+	}
+	rs.spillLock.Lock()
+	defer rs.spillLock.Unlock()
+	rs.lockShards()
+	defer rs.unlockShards()
+	// Merge spilled runs first, so that more recent items from the btrees take precedence
+	if rs.spill != nil {
+		if err := rs.spill.copyTo(rwTx); err != nil {
+			return err
+		}
+		if err := rs.spill.clear(); err != nil {
+			return err
+		}
+	}
+	return rs.flushChanges(rwTx)
+}
+
+// copyTo writes the contents of the spill database into rwTx. The database must not change meanwhile
+func (s *reconSpill) copyTo(rwTx kv.RwTx) error {
+	if len(s.spilled) == 0 {
+		return nil
+	}
+	return s.db.View(context.Background(), func(tx kv.Tx) error {
+		for table := range s.spilled {
+			if err := tx.ForEach(table, nil, func(k, v []byte) error {
+				return rwTx.Put(table, k, v)
+			}); err != nil {
+				return err
 			}
-			var composite []byte
-			if item.key2 == nil {
-				composite = make([]byte, 8+len(item.key1))
-			} else {
-				composite = make([]byte, 8+len(item.key1)+8+len(item.key2))
-				binary.BigEndian.PutUint64(composite[8+len(item.key1):], FirstContractIncarnation)
-				copy(composite[8+len(item.key1)+8:], item.key2)
+		}
+		return nil
+	})
+}
+
+// clear empties the spill database. Must be called with the spill lock held
+func (s *reconSpill) clear() error {
+	if len(s.spilled) == 0 {
+		return nil
+	}
+	s.closeTxs()
+	if err := s.db.Update(context.Background(), func(tx kv.RwTx) error {
+		for table := range s.spilled {
+			if err := tx.ClearBucket(table); err != nil {
+				return err
 			}
-			binary.BigEndian.PutUint64(composite, item.txNum)
-			copy(composite[8:], item.key1)
-			if err = rwTx.Put(table, composite, item.val); err != nil {
-				return false
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	s.spilled = map[string]struct{}{}
+	return nil
+}
+
+// reconCollected is the etl collector of a table, filled by ParallelFlush
+type reconCollected struct {
+	table     string
+	collector *etl.Collector
+	err       error
+}
+
+// ParallelFlush is an alternative to Flush that holds the locks only for the time it takes to swap out the
+// accumulated changes and the spilled runs. The swapped out changes are collected by etl collectors in tmpdir, one
+// table per goroutine, while the workers continue to run and to spill. rwTx allows only one writer, so the spilled
+// runs are written into it first, and then each table as soon as its collector is filled. Swapped out changes and
+// spilled runs remain visible to Get until ReleaseFrozen is called, which should happen once the readers switched
+// to transactions that see the result of rwTx.
+// Returns the set of txNums whose changes have been flushed, to be used for the checkpoint
+func (rs *ReconState) ParallelFlush(rwTx kv.RwTx, tmpdir string) (*roaring64.Bitmap, error) {
+	defer reconParFlushTimer.UpdateDuration(time.Now())
+	defer TimeExecPhase(PhaseReconFlush, time.Now())
+	if rs.etlTmpDir != "" {
+		return nil, fmt.Errorf("parallel flush is not supported with etl backend")
+	}
+	rs.frozenLock.RLock()
+	alreadyFrozen := rs.frozen != nil
+	rs.frozenLock.RUnlock()
+	if alreadyFrozen {
+		return nil, fmt.Errorf("previous flush is not released")
+	}
+	// Take the snapshot of done txNums before the swap, so that all their changes are included
+	rs.lock.RLock()
+	done := rs.doneBitmap.Clone()
+	rs.lock.RUnlock()
+	rs.spillLock.Lock()
+	rs.lockShards()
+	var frozen [reconShardCount]map[string]*btree.BTree
+	for i := range rs.shards {
+		frozen[i] = rs.shards[i].changes
+		rs.shards[i].changes = map[string]*btree.BTree{}
+	}
+	rs.frozenLock.Lock()
+	rs.frozen = &frozen
+	rs.frozenLock.Unlock()
+	atomic.StoreUint64(&rs.sizeEstimate, 0)
+	reconSizeGauge.Set(0)
+	rs.unlockShards()
+	if rs.spill != nil {
+		rs.frozenSpill = rs.spill
+		rs.spill = newReconSpill(rs.spareSpillDb)
+		rs.spareSpillDb = nil
+	}
+	frozenSpill := rs.frozenSpill
+	rs.spillLock.Unlock()
+
+	tables := map[string]struct{}{}
+	for i := range frozen {
+		for table := range frozen[i] {
+			tables[table] = struct{}{}
+		}
+	}
+	collected := make(chan reconCollected, len(tables))
+	for table := range tables {
+		go func(table string) {
+			collector := etl.NewCollector("recon "+table, tmpdir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+			var err error
+			for i := range frozen {
+				t, ok := frozen[i][table]
+				if !ok {
+					continue
+				}
+				t.Ascend(func(it btree.Item) bool {
+					item := it.(ReconStateItem)
+					if len(item.val) > 0 || item.deleted {
+						err = collector.Collect(reconCompositeKey(item.txNum, item.key1, item.key2), item.value())
+					}
+					return err == nil
+				})
+				if err != nil {
+					break
+				}
 			}
-			return true
-		})
-		if err != nil {
+			collected <- reconCollected{table: table, collector: collector, err: err}
+		}(table)
+	}
+	// The frozen runs do not change until ReleaseFrozen, and the more recent swapped out changes overwrite them
+	var err error
+	if frozenSpill != nil {
+		err = frozenSpill.copyTo(rwTx)
+	}
+	for range tables {
+		c := <-collected
+		if err == nil {
+			err = c.err
+		}
+		if err == nil {
+			err = c.collector.Load(nil, "", func(k, v []byte, _ etl.CurrentTableReader, _ etl.LoadNextFunc) error {
+				return rwTx.Put(c.table, k, v)
+			}, etl.TransformArgs{})
+		}
+		c.collector.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+// ReleaseFrozen drops the changes swapped out by the last ParallelFlush, and the spilled runs it has written out
+func (rs *ReconState) ReleaseFrozen() error {
+	rs.spillLock.Lock()
+	defer rs.spillLock.Unlock()
+	if rs.frozenSpill != nil {
+		if err := rs.frozenSpill.clear(); err != nil {
 			return err
 		}
-		t.Clear(true)
+		rs.spareSpillDb = rs.frozenSpill.db
+		rs.frozenSpill = nil
 	}
-	rs.sizeEstimate = 0
+	rs.frozenLock.Lock()
+	defer rs.frozenLock.Unlock()
+	rs.frozen = nil
 	return nil
 }
 
-func (rs *ReconState) Schedule() (*TxTask, bool) {
+// Schedule returns the next transaction to execute. It returns false once there is no more work,
+// or when ctx is cancelled - in that case, transactions remaining in the queue and in the triggers
+// are not done, and will be replayed when reconstitution is resumed from the checkpoint
+func (rs *ReconState) Schedule(ctx context.Context) (*TxTask, bool) {
 	rs.lock.Lock()
 	defer rs.lock.Unlock()
-	for rs.queue.Len() < 16 {
-		txTask, ok := <-rs.workCh
-		if !ok {
-			// No more work, channel is closed
-			break
+	if ctx.Err() != nil {
+		return nil, false
+	}
+	if rs.queue.Len() < rs.schedCfg.LowWatermark {
+	fetch:
+		for fetched := 0; fetched < rs.schedCfg.PrefetchBatch && rs.queue.Len() < rs.schedCfg.QueueDepth; fetched++ {
+			var txTask *TxTask
+			var ok bool
+			select {
+			case <-ctx.Done():
+				return nil, false
+			case txTask, ok = <-rs.workCh:
+			}
+			if !ok {
+				// No more work, channel is closed
+				break fetch
+			}
+			if dependency, pending := rs.pendingDependency(txTask); pending {
+				// No point running the transaction before its dependency is done, it would be rolled back
+				rs.addTrigger(dependency, txTask)
+				rs.deferCount++
+				continue
+			}
+			heap.Push(&rs.queue, txTask)
 		}
-		heap.Push(&rs.queue, txTask)
 	}
-	if rs.queue.Len() > 0 {
-		return heap.Pop(&rs.queue).(*TxTask), true
+	if rs.queue.Len() == 0 {
+		reconQueueGauge.Set(0)
+		return nil, false
+	}
+	var txTask *TxTask
+	if rs.schedCfg.GasWindow > 0 {
+		txTask = heap.Remove(&rs.queue, rs.heaviestInWindow()).(*TxTask)
+	} else {
+		txTask = heap.Pop(&rs.queue).(*TxTask)
 	}
-	return nil, false
+	reconQueueGauge.Set(uint64(rs.queue.Len()))
+	return txTask, true
+}
+
+// addTrigger makes txTask wait for dependency to be done. Must be called with the lock held
+func (rs *ReconState) addTrigger(dependency uint64, txTask *TxTask) {
+	rs.triggers[dependency] = append(rs.triggers[dependency], txTask)
+	rs.triggerCount++
+	reconTriggersGauge.Set(uint64(rs.triggerCount))
+}
+
+// heaviestInWindow returns the position in the queue of the transaction with the highest GasUsed
+// out of the ones within GasWindow from the lowest txNum. Must be called with the lock held
+func (rs *ReconState) heaviestInWindow() int {
+	limit := rs.queue[0].TxNum + rs.schedCfg.GasWindow
+	best := 0
+	for i, txTask := range rs.queue {
+		if txTask.TxNum < limit && txTask.GasUsed > rs.queue[best].GasUsed {
+			best = i
+		}
+	}
+	return best
 }
 
 func (rs *ReconState) CommitTxNum(txNum uint64) {
 	rs.lock.Lock()
 	defer rs.lock.Unlock()
+	rs.doneBitmap.Add(txNum)
+	reconDoneGauge.Inc()
 	if tt, ok := rs.triggers[txNum]; ok {
+		delete(rs.triggers, txNum)
+		rs.triggerCount -= len(tt)
 		for _, t := range tt {
+			if dependency, pending := rs.pendingDependency(t); pending {
+				rs.addTrigger(dependency, t)
+				continue
+			}
 			heap.Push(&rs.queue, t)
 		}
-		delete(rs.triggers, txNum)
+		reconTriggersGauge.Set(uint64(rs.triggerCount))
+		reconQueueGauge.Set(uint64(rs.queue.Len()))
 	}
-	rs.doneBitmap.Add(txNum)
 }
 
-func (rs *ReconState) RollbackTx(txTask *TxTask, dependency uint64) {
+// pendingDependency returns a dependency of txTask that is not done yet, if any.
+// Must be called with the lock held
+func (rs *ReconState) pendingDependency(txTask *TxTask) (uint64, bool) {
+	for _, dependency := range txTask.Dependencies {
+		if !rs.doneBitmap.Contains(dependency) {
+			return dependency, true
+		}
+	}
+	return 0, false
+}
+
+// SetOnDemand makes ReconState schedule transactions that are not among planned txNums, when they turn
+// out to be dependencies of other transactions. This is needed when only a window of txNums is replayed, and
+// some of the state it reads was last modified before the window. newTask creates the task for given txNum
+func (rs *ReconState) SetOnDemand(planned *roaring64.Bitmap, newTask func(txNum uint64) *TxTask) {
 	rs.lock.Lock()
 	defer rs.lock.Unlock()
+	rs.planned = planned
+	rs.newTask = newTask
+}
+
+// RollbackTx reschedules txTask, which could not be completed, because the state produced by dependency
+// was not yet available. conflictKey is the address (or address+location) that was read, it can be nil
+func (rs *ReconState) RollbackTx(txTask *TxTask, dependency uint64, conflictKey []byte) {
+	rs.lock.Lock()
+	rs.recordConflict(dependency, conflictKey)
 	if rs.doneBitmap.Contains(dependency) {
 		heap.Push(&rs.queue, txTask)
 	} else {
-		tt := rs.triggers[dependency]
-		tt = append(tt, txTask)
-		rs.triggers[dependency] = tt
+		rs.addTrigger(dependency, txTask)
 	}
 	rs.rollbackCount++
+	reconRollbacks.Inc()
+	onDemand := rs.newTask != nil && !rs.doneBitmap.Contains(dependency) && !rs.planned.Contains(dependency) && !rs.requested.Contains(dependency)
+	if onDemand {
+		rs.requested.Add(dependency)
+	}
+	rs.lock.Unlock()
+	if !onDemand {
+		return
+	}
+	// Task is created without the lock held, because it involves reading the block
+	dependencyTask := rs.newTask(dependency)
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	heap.Push(&rs.queue, dependencyTask)
+}
+
+// DeferTx schedules the transaction after the dependency is done, like RollbackTx, but without counting
+// a rollback, because the transaction has not been executed
+func (rs *ReconState) DeferTx(txTask *TxTask, dependency uint64) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	if rs.doneBitmap.Contains(dependency) {
+		heap.Push(&rs.queue, txTask)
+	} else {
+		rs.addTrigger(dependency, txTask)
+	}
+}
+
+// OnDemandCount returns number of transactions scheduled in addition to the planned ones
+func (rs *ReconState) OnDemandCount() uint64 {
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+	return rs.requested.GetCardinality()
 }
 
 func (rs *ReconState) Done(txNum uint64) bool {
@@ -181,18 +791,24 @@ func (rs *ReconState) RollbackCount() uint64 {
 	return rs.rollbackCount
 }
 
-func (rs *ReconState) SizeEstimate() uint64 {
+func (rs *ReconState) DeferCount() uint64 {
 	rs.lock.RLock()
 	defer rs.lock.RUnlock()
-	return rs.sizeEstimate
+	return rs.deferCount
+}
+
+func (rs *ReconState) SizeEstimate() uint64 {
+	return atomic.LoadUint64(&rs.sizeEstimate)
 }
 
 type StateReconWriter struct {
-	ac        *libstate.Aggregator22Context
-	rs        *ReconState
-	txNum     uint64
-	tx        kv.Tx
-	composite []byte
+	ac         *libstate.Aggregator22Context
+	rs         *ReconState
+	txNum      uint64
+	tx         kv.Tx
+	composite  []byte
+	commitment StateWriter
+	created    *common.Address // contract created by the last change of its account, see CreateContract
 }
 
 func NewStateReconWriter(ac *libstate.Aggregator22Context, rs *ReconState) *StateReconWriter {
@@ -204,12 +820,20 @@ func NewStateReconWriter(ac *libstate.Aggregator22Context, rs *ReconState) *Stat
 
 func (w *StateReconWriter) SetTxNum(txNum uint64) {
 	w.txNum = txNum
+	w.created = nil
 }
 
 func (w *StateReconWriter) SetTx(tx kv.Tx) {
 	w.tx = tx
 }
 
+// SetCommitment registers the writer that receives the final values of the keys, i.e. those produced by
+// the txNums of their last modification, so that the commitment can be updated incrementally.
+// The same commitment writer is normally shared by all workers, so it needs to be safe for concurrent use
+func (w *StateReconWriter) SetCommitment(commitment StateWriter) {
+	w.commitment = commitment
+}
+
 func (w *StateReconWriter) UpdateAccountData(address common.Address, original, account *accounts.Account) error {
 	txKey, err := w.tx.GetOne(kv.XAccount, address.Bytes())
 	if err != nil {
@@ -221,16 +845,33 @@ func (w *StateReconWriter) UpdateAccountData(address common.Address, original, a
 	if stateTxNum := binary.BigEndian.Uint64(txKey); stateTxNum != w.txNum {
 		return nil
 	}
+	// Incarnation is kept as is, so that storage and code written by the same contract match it. Incarnations are
+	// normalised when the reconstituted state is loaded into the plain state
 	value := make([]byte, account.EncodingLengthForStorage())
-	if account.Incarnation > 0 {
-		account.Incarnation = FirstContractIncarnation
-	}
 	account.EncodeForStorage(value)
 	//fmt.Printf("account [%x]=>{Balance: %d, Nonce: %d, Root: %x, CodeHash: %x} txNum: %d\n", address, &account.Balance, account.Nonce, account.Root, account.CodeHash, w.txNum)
-	w.rs.Put(kv.PlainStateR, address[:], nil, value, w.txNum)
+	if err = w.rs.Put(kv.PlainStateR, address[:], nil, value, w.txNum); err != nil {
+		return err
+	}
+	if w.created != nil && *w.created == address {
+		w.created = nil
+		if err = w.putIncarnation(address, account.Incarnation); err != nil {
+			return err
+		}
+	}
+	if w.commitment != nil {
+		return w.commitment.UpdateAccountData(address, original, account)
+	}
 	return nil
 }
 
+// putIncarnation writes the item of ReconIncarnationKey2, which keeps the incarnation of the contract at the address
+func (w *StateReconWriter) putIncarnation(address common.Address, incarnation uint64) error {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], incarnation)
+	return w.rs.Put(kv.PlainStateR, address[:], ReconIncarnationKey2, b[:], w.txNum)
+}
+
 func (w *StateReconWriter) UpdateAccountCode(address common.Address, incarnation uint64, codeHash common.Hash, code []byte) error {
 	txKey, err := w.tx.GetOne(kv.XCode, address.Bytes())
 	if err != nil {
@@ -242,15 +883,52 @@ func (w *StateReconWriter) UpdateAccountCode(address common.Address, incarnation
 	if stateTxNum := binary.BigEndian.Uint64(txKey); stateTxNum != w.txNum {
 		return nil
 	}
-	w.rs.Put(kv.CodeR, codeHash[:], nil, code, w.txNum)
+	if err = w.rs.PutCode(codeHash, code, w.txNum); err != nil {
+		return err
+	}
 	if len(code) > 0 {
 		//fmt.Printf("code [%x] => %d CodeHash: %x, txNum: %d\n", address, len(code), codeHash, w.txNum)
-		w.rs.Put(kv.PlainContractR, dbutils.PlainGenerateStoragePrefix(address[:], FirstContractIncarnation), nil, codeHash[:], w.txNum)
+		if err = w.rs.Put(kv.PlainContractR, dbutils.PlainGenerateStoragePrefix(address[:], incarnation), nil, codeHash[:], w.txNum); err != nil {
+			return err
+		}
+	}
+	if w.commitment != nil {
+		return w.commitment.UpdateAccountCode(address, incarnation, codeHash, code)
 	}
 	return nil
 }
 
 func (w *StateReconWriter) DeleteAccount(address common.Address, original *accounts.Account) error {
+	txKey, err := w.tx.GetOne(kv.XAccount, address.Bytes())
+	if err != nil {
+		return err
+	}
+	if txKey == nil {
+		return nil
+	}
+	if stateTxNum := binary.BigEndian.Uint64(txKey); stateTxNum != w.txNum {
+		return nil
+	}
+	//fmt.Printf("delete account [%x] txNum: %d\n", address, w.txNum)
+	if err = w.rs.Delete(kv.PlainStateR, address[:], nil, w.txNum); err != nil {
+		return err
+	}
+	if original != nil && original.Incarnation > 0 {
+		if err = w.putIncarnation(address, original.Incarnation); err != nil {
+			return err
+		}
+	}
+	if txKey, err = w.tx.GetOne(kv.XCode, address.Bytes()); err != nil {
+		return err
+	}
+	if txKey != nil && binary.BigEndian.Uint64(txKey) == w.txNum && original != nil && original.Incarnation > 0 {
+		if err = w.rs.Delete(kv.PlainContractR, dbutils.PlainGenerateStoragePrefix(address[:], original.Incarnation), nil, w.txNum); err != nil {
+			return err
+		}
+	}
+	if w.commitment != nil {
+		return w.commitment.DeleteAccount(address, original)
+	}
 	return nil
 }
 
@@ -277,13 +955,39 @@ func (w *StateReconWriter) WriteAccountStorage(address common.Address, incarnati
 		//fmt.Printf("no found storage [%x] [%x]\n", address, *key)
 		return nil
 	}
-	if !value.IsZero() {
+	if value.IsZero() {
+		// The slot is cleared by this txNum, which needs to be recorded, otherwise an earlier value could be left in the state
+		err = w.rs.Delete(kv.PlainStateR, address.Bytes(), ReconStorageKey2(incarnation, key.Bytes()), w.txNum)
+	} else {
 		//fmt.Printf("storage [%x] [%x] => [%x], txNum: %d\n", address, *key, value.Bytes(), w.txNum)
-		w.rs.Put(kv.PlainStateR, address.Bytes(), key.Bytes(), value.Bytes(), w.txNum)
+		err = w.rs.Put(kv.PlainStateR, address.Bytes(), ReconStorageKey2(incarnation, key.Bytes()), value.Bytes(), w.txNum)
+	}
+	if err != nil {
+		return err
+	}
+	if w.commitment != nil {
+		return w.commitment.WriteAccountStorage(address, incarnation, key, original, value)
 	}
 	return nil
 }
 
+// CreateContract is called before UpdateAccountData of the created contract. If the creation is the last change of
+// the account, UpdateAccountData keeps the incarnation of the new contract in the item of ReconIncarnationKey2, the
+// same way DeleteAccount keeps the incarnation of the deleted one
 func (w *StateReconWriter) CreateContract(address common.Address) error {
+	txKey, err := w.tx.GetOne(kv.XAccount, address.Bytes())
+	if err != nil {
+		return err
+	}
+	if txKey == nil {
+		return nil
+	}
+	if stateTxNum := binary.BigEndian.Uint64(txKey); stateTxNum != w.txNum {
+		return nil
+	}
+	w.created = &address
+	if w.commitment != nil {
+		return w.commitment.CreateContract(address)
+	}
 	return nil
 }
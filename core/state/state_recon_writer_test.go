@@ -0,0 +1,419 @@
+package state
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconStatePutGet(t *testing.T) {
+	rs := NewReconState(nil, DefaultReconSchedulerCfg)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				key := []byte(fmt.Sprintf("key%d-%d", w, i))
+				assert.NoError(t, rs.Put(kv.PlainStateR, key, nil, []byte{byte(w), byte(i)}, uint64(i)))
+			}
+		}(w)
+	}
+	wg.Wait()
+	for w := 0; w < 8; w++ {
+		for i := 0; i < 100; i++ {
+			key := []byte(fmt.Sprintf("key%d-%d", w, i))
+			val, err := rs.Get(kv.PlainStateR, key, nil, uint64(i))
+			require.NoError(t, err)
+			require.Equal(t, []byte{byte(w), byte(i)}, val)
+			// Items are keyed by txNum as well
+			val, err = rs.Get(kv.PlainStateR, key, nil, uint64(i+1))
+			require.NoError(t, err)
+			require.Nil(t, val)
+		}
+	}
+	require.NotZero(t, rs.SizeEstimate())
+}
+
+func TestReconStateSchedule(t *testing.T) {
+	workCh := make(chan *TxTask, 16)
+	rs := NewReconState(workCh, ReconSchedulerCfg{QueueDepth: 4})
+	ctx := context.Background()
+	for txNum := uint64(0); txNum < 4; txNum++ {
+		workCh <- &TxTask{TxNum: txNum}
+	}
+	// txNum 4 is known to depend on txNum 2, so it should not be scheduled until 2 is done
+	workCh <- &TxTask{TxNum: 4, Dependencies: []uint64{2}}
+	close(workCh)
+
+	txTask, ok := rs.Schedule(ctx)
+	require.True(t, ok)
+	require.Equal(t, uint64(0), txTask.TxNum)
+	rs.CommitTxNum(0)
+
+	txTask, ok = rs.Schedule(ctx)
+	require.True(t, ok)
+	require.Equal(t, uint64(1), txTask.TxNum)
+	// txNum 1 needs the state produced by txNum 3
+	rs.RollbackTx(txTask, 3, nil)
+	require.Equal(t, uint64(1), rs.RollbackCount())
+
+	txTask, ok = rs.Schedule(ctx)
+	require.True(t, ok)
+	require.Equal(t, uint64(2), txTask.TxNum)
+	txTask, ok = rs.Schedule(ctx)
+	require.True(t, ok)
+	require.Equal(t, uint64(3), txTask.TxNum)
+	require.Equal(t, uint64(1), rs.DeferCount())
+
+	rs.CommitTxNum(3)
+	txTask, ok = rs.Schedule(ctx)
+	require.True(t, ok)
+	require.Equal(t, uint64(1), txTask.TxNum)
+	rs.CommitTxNum(1)
+
+	_, ok = rs.Schedule(ctx)
+	require.False(t, ok)
+	rs.CommitTxNum(2)
+	txTask, ok = rs.Schedule(ctx)
+	require.True(t, ok)
+	require.Equal(t, uint64(4), txTask.TxNum)
+	rs.CommitTxNum(4)
+	require.Equal(t, uint64(5), rs.DoneCount())
+}
+
+func TestReconStateScheduleCancel(t *testing.T) {
+	workCh := make(chan *TxTask, 16)
+	rs := NewReconState(workCh, ReconSchedulerCfg{QueueDepth: 4})
+	ctx, cancel := context.WithCancel(context.Background())
+	for txNum := uint64(0); txNum < 4; txNum++ {
+		workCh <- &TxTask{TxNum: txNum}
+	}
+	txTask, ok := rs.Schedule(ctx)
+	require.True(t, ok)
+	require.Equal(t, uint64(0), txTask.TxNum)
+	rs.CommitTxNum(0)
+
+	// Schedule is blocked refilling the queue with work that never arrives
+	scheduled := make(chan bool)
+	go func() {
+		_, ok := rs.Schedule(ctx)
+		scheduled <- ok
+	}()
+	cancel()
+	require.False(t, <-scheduled)
+	// Transactions still in the queue are not scheduled after cancellation
+	_, ok = rs.Schedule(ctx)
+	require.False(t, ok)
+	require.Equal(t, uint64(1), rs.DoneCount())
+}
+
+func TestReconStateDelete(t *testing.T) {
+	rs := NewReconState(nil, DefaultReconSchedulerCfg)
+	key := []byte("account")
+	require.NoError(t, rs.Put(kv.PlainStateR, key, nil, []byte{1}, 1))
+	require.NoError(t, rs.Delete(kv.PlainStateR, key, nil, 2))
+	val, err := rs.Get(kv.PlainStateR, key, nil, 1)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1}, val)
+	// Tombstone is distinguishable from the absence of the item
+	val, err = rs.Get(kv.PlainStateR, key, nil, 2)
+	require.NoError(t, err)
+	require.NotNil(t, val)
+	require.Empty(t, val)
+	val, err = rs.Get(kv.PlainStateR, key, nil, 3)
+	require.NoError(t, err)
+	require.Nil(t, val)
+}
+
+func TestReconStateOnDemand(t *testing.T) {
+	workCh := make(chan *TxTask, 16)
+	rs := NewReconState(workCh, ReconSchedulerCfg{QueueDepth: 4})
+	ctx := context.Background()
+	// Only the window of txNums 10 and 11 is planned
+	planned := roaring64.BitmapOf(10, 11)
+	rs.SetOnDemand(planned, func(txNum uint64) *TxTask { return &TxTask{TxNum: txNum} })
+	workCh <- &TxTask{TxNum: 10}
+	workCh <- &TxTask{TxNum: 11}
+	close(workCh)
+
+	txTask, ok := rs.Schedule(ctx)
+	require.True(t, ok)
+	require.Equal(t, uint64(10), txTask.TxNum)
+	// txNum 10 reads the state last modified by txNum 3, before the window
+	rs.RollbackTx(txTask, 3, nil)
+	txTask, ok = rs.Schedule(ctx)
+	require.True(t, ok)
+	require.Equal(t, uint64(3), txTask.TxNum)
+	rs.CommitTxNum(3)
+	txTask, ok = rs.Schedule(ctx)
+	require.True(t, ok)
+	require.Equal(t, uint64(10), txTask.TxNum)
+	rs.CommitTxNum(10)
+	// Dependency within the window is not requested again
+	txTask, ok = rs.Schedule(ctx)
+	require.True(t, ok)
+	require.Equal(t, uint64(11), txTask.TxNum)
+	rs.RollbackTx(txTask, 10, nil)
+	txTask, ok = rs.Schedule(ctx)
+	require.True(t, ok)
+	require.Equal(t, uint64(11), txTask.TxNum)
+	rs.CommitTxNum(11)
+	require.Equal(t, uint64(1), rs.OnDemandCount())
+}
+
+func TestReconStateETL(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	rs := NewReconState(nil, DefaultReconSchedulerCfg)
+	rs.UseETL(t.TempDir())
+	require.NoError(t, rs.Put(kv.Code, []byte("b"), nil, []byte{1}, 2))
+	require.NoError(t, rs.Put(kv.Code, []byte("a"), nil, []byte{2}, 2))
+	require.NoError(t, rs.Put(kv.Code, []byte("a"), nil, []byte{3}, 2))
+	require.NoError(t, rs.Delete(kv.Code, []byte("a"), nil, 1))
+	val, err := rs.Get(kv.Code, []byte("a"), nil, 2)
+	require.NoError(t, err)
+	require.Equal(t, []byte{3}, val)
+	val, err = rs.Get(kv.Code, []byte("a"), nil, 1)
+	require.NoError(t, err)
+	require.NotNil(t, val)
+	require.Empty(t, val)
+
+	require.NoError(t, rs.Flush(tx))
+	require.Zero(t, rs.SizeEstimate())
+	val, err = rs.Get(kv.Code, []byte("a"), nil, 2)
+	require.NoError(t, err)
+	require.Nil(t, val)
+	// Items are written in the order of txNum, then key, and only the latest value for each key is written
+	var keys [][]byte
+	var vals [][]byte
+	require.NoError(t, tx.ForEach(kv.Code, nil, func(k, v []byte) error {
+		keys = append(keys, common.CopyBytes(k))
+		vals = append(vals, common.CopyBytes(v))
+		return nil
+	}))
+	require.Equal(t, [][]byte{reconCompositeKey(1, []byte("a"), nil), reconCompositeKey(2, []byte("a"), nil), reconCompositeKey(2, []byte("b"), nil)}, keys)
+	require.Equal(t, [][]byte{{}, {3}, {1}}, vals)
+}
+
+func TestReconStateETLSealedArenas(t *testing.T) {
+	defer func(limit int) { reconArenaLimit = limit }(reconArenaLimit)
+	// Every arena fits only one record
+	reconArenaLimit = 2 * reconArenaHeader
+	_, tx := memdb.NewTestTx(t)
+	rs := NewReconState(nil, DefaultReconSchedulerCfg)
+	rs.UseETL(t.TempDir())
+	require.NoError(t, rs.Put(kv.Code, []byte("a"), nil, []byte{1}, 1))
+	require.NoError(t, rs.Put(kv.Code, []byte("b"), nil, []byte{2}, 1))
+	require.NoError(t, rs.Put(kv.Code, []byte("a"), nil, []byte{3}, 1))
+	val, err := rs.Get(kv.Code, []byte("a"), nil, 1)
+	require.NoError(t, err)
+	require.Equal(t, []byte{3}, val)
+	val, err = rs.Get(kv.Code, []byte("b"), nil, 1)
+	require.NoError(t, err)
+	require.Equal(t, []byte{2}, val)
+
+	require.NoError(t, rs.Flush(tx))
+	var vals [][]byte
+	require.NoError(t, tx.ForEach(kv.Code, nil, func(k, v []byte) error {
+		vals = append(vals, common.CopyBytes(v))
+		return nil
+	}))
+	require.Equal(t, [][]byte{{3}, {2}}, vals)
+}
+
+func newReconTestDB(t *testing.T) kv.RwDB {
+	db := mdbx.NewMDBX(log.New()).InMem().WithTableCfg(func(kv.TableCfg) kv.TableCfg { return ReconTablesCfg() }).MustOpen()
+	t.Cleanup(db.Close)
+	return db
+}
+
+func TestReconStateSpill(t *testing.T) {
+	rs := NewReconState(nil, DefaultReconSchedulerCfg)
+	// Every Put spills
+	rs.SetSpill(newReconTestDB(t), newReconTestDB(t), 1)
+	defer rs.CloseSpill()
+	require.NoError(t, rs.Put(kv.PlainStateR, []byte("a"), nil, []byte{1}, 1))
+	require.NoError(t, rs.Put(kv.PlainStateR, []byte("b"), nil, []byte{2}, 1))
+	require.NoError(t, rs.Put(kv.CodeR, []byte("a"), nil, []byte{3}, 2))
+	require.Equal(t, uint64(3), rs.SpillCount())
+	require.Zero(t, rs.SizeEstimate())
+
+	// Spilled items are read from the spill database, repeatedly and concurrently
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				val, err := rs.Get(kv.PlainStateR, []byte("a"), nil, 1)
+				assert.NoError(t, err)
+				assert.Equal(t, []byte{1}, val)
+				val, err = rs.Get(kv.PlainStateR, []byte("c"), nil, 1)
+				assert.NoError(t, err)
+				assert.Nil(t, val)
+			}
+		}()
+	}
+	wg.Wait()
+	val, err := rs.Get(kv.CodeR, []byte("a"), nil, 2)
+	require.NoError(t, err)
+	require.Equal(t, []byte{3}, val)
+
+	// Item written after the spill is visible, also once it is spilled itself
+	require.NoError(t, rs.Put(kv.PlainStateR, []byte("b"), nil, []byte{4}, 1))
+	val, err = rs.Get(kv.PlainStateR, []byte("b"), nil, 1)
+	require.NoError(t, err)
+	require.Equal(t, []byte{4}, val)
+
+	// Flush merges the spilled runs, and the items still in the btrees take precedence
+	rs.spillBudget = 1 << 20
+	require.NoError(t, rs.Put(kv.PlainStateR, []byte("a"), nil, []byte{5}, 1))
+	tx, err := newReconTestDB(t).BeginRw(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+	require.NoError(t, rs.Flush(tx))
+	vals := map[string][]byte{}
+	for _, table := range []string{kv.PlainStateR, kv.CodeR} {
+		require.NoError(t, tx.ForEach(table, nil, func(k, v []byte) error {
+			vals[table+string(k[8:])] = common.CopyBytes(v)
+			return nil
+		}))
+	}
+	require.Equal(t, map[string][]byte{kv.PlainStateR + "a": {5}, kv.PlainStateR + "b": {4}, kv.CodeR + "a": {3}}, vals)
+	// Spill database is empty after the merge
+	val, err = rs.Get(kv.PlainStateR, []byte("b"), nil, 1)
+	require.NoError(t, err)
+	require.Nil(t, val)
+}
+
+func TestReconStateParallelFlushSpill(t *testing.T) {
+	rs := NewReconState(nil, DefaultReconSchedulerCfg)
+	rs.SetSpill(newReconTestDB(t), newReconTestDB(t), 1)
+	defer rs.CloseSpill()
+	require.NoError(t, rs.Put(kv.PlainStateR, []byte("a"), nil, []byte{1}, 1))
+	require.Equal(t, uint64(1), rs.SpillCount())
+	rs.spillBudget = 1 << 20
+	require.NoError(t, rs.Put(kv.PlainStateR, []byte("b"), nil, []byte{2}, 2))
+	rs.CommitTxNum(1)
+	rs.CommitTxNum(2)
+
+	tx, err := newReconTestDB(t).BeginRw(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+	done, err := rs.ParallelFlush(tx, t.TempDir())
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1, 2}, done.ToArray())
+	vals := map[string][]byte{}
+	require.NoError(t, tx.ForEach(kv.PlainStateR, nil, func(k, v []byte) error {
+		vals[string(k[8:])] = common.CopyBytes(v)
+		return nil
+	}))
+	require.Equal(t, map[string][]byte{"a": {1}, "b": {2}}, vals)
+
+	// Until the readers switch to the flushed state, both spilled and swapped out changes are readable, and the new
+	// changes are spilled into the spare database
+	rs.spillBudget = 1
+	require.NoError(t, rs.Put(kv.PlainStateR, []byte("c"), nil, []byte{3}, 3))
+	require.Equal(t, uint64(2), rs.SpillCount())
+	require.NoError(t, rs.Put(kv.PlainStateR, []byte("b"), nil, []byte{5}, 5))
+	require.Equal(t, uint64(3), rs.SpillCount())
+	for key, expected := range map[string][]byte{"a": {1}, "b": {2}, "c": {3}} {
+		val, err := rs.Get(kv.PlainStateR, []byte(key), nil, uint64(expected[0]))
+		require.NoError(t, err)
+		require.Equal(t, expected, val, key)
+	}
+
+	require.NoError(t, rs.ReleaseFrozen())
+	for key, txNum := range map[string]uint64{"a": 1, "b": 2} {
+		val, err := rs.Get(kv.PlainStateR, []byte(key), nil, txNum)
+		require.NoError(t, err)
+		require.Nil(t, val, key)
+	}
+	// Runs spilled during the flush are kept, and the released database becomes the spare one
+	require.NoError(t, rs.Put(kv.PlainStateR, []byte("d"), nil, []byte{4}, 4))
+	require.Equal(t, uint64(4), rs.SpillCount())
+	for key, expected := range map[string][]byte{"b": {5}, "c": {3}, "d": {4}} {
+		val, err := rs.Get(kv.PlainStateR, []byte(key), nil, uint64(expected[0]))
+		require.NoError(t, err)
+		require.Equal(t, expected, val, key)
+	}
+	tx2, err := newReconTestDB(t).BeginRw(context.Background())
+	require.NoError(t, err)
+	defer tx2.Rollback()
+	_, err = rs.ParallelFlush(tx2, t.TempDir())
+	require.NoError(t, err)
+	vals = map[string][]byte{}
+	require.NoError(t, tx2.ForEach(kv.PlainStateR, nil, func(k, v []byte) error {
+		vals[string(k[8:])] = common.CopyBytes(v)
+		return nil
+	}))
+	require.Equal(t, map[string][]byte{"b": {5}, "c": {3}, "d": {4}}, vals)
+	require.NoError(t, rs.ReleaseFrozen())
+}
+
+func BenchmarkReconStatePut(b *testing.B) {
+	for _, backend := range []string{"btree", "etl"} {
+		b.Run(backend, func(b *testing.B) {
+			rs := NewReconState(nil, DefaultReconSchedulerCfg)
+			if backend == "etl" {
+				rs.UseETL(b.TempDir())
+			}
+			var key [32]byte
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				binary.BigEndian.PutUint64(key[:], uint64(i))
+				if err := rs.Put(kv.PlainStateR, key[:20], nil, key[:], uint64(i)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestReconStatePutCode(t *testing.T) {
+	rs := NewReconState(nil, DefaultReconSchedulerCfg)
+	code := []byte{0x60, 0x00}
+	codeHash := common.BytesToHash([]byte{1})
+	require.NoError(t, rs.PutCode(codeHash, code, 5))
+	require.NoError(t, rs.PutCode(codeHash, code, 7))
+	require.Equal(t, uint64(5), rs.CodeTxNum(codeHash, 7))
+	val, err := rs.Get(kv.CodeR, codeHash[:], nil, 5)
+	require.NoError(t, err)
+	require.Equal(t, code, val)
+	// Duplicate is not stored
+	val, err = rs.Get(kv.CodeR, codeHash[:], nil, 7)
+	require.NoError(t, err)
+	require.Nil(t, val)
+	require.Equal(t, uint64(9), rs.CodeTxNum(common.BytesToHash([]byte{2}), 9))
+}
+
+func TestReconStateDeferTx(t *testing.T) {
+	workCh := make(chan *TxTask, 16)
+	rs := NewReconState(workCh, ReconSchedulerCfg{QueueDepth: 4})
+	ctx := context.Background()
+	workCh <- &TxTask{TxNum: 1}
+	close(workCh)
+	txTask, ok := rs.Schedule(ctx)
+	require.True(t, ok)
+	// Rest of the group waits for txNum 1, which is not done yet
+	rs.DeferTx(&TxTask{TxNum: 2}, 1)
+	_, ok = rs.Schedule(ctx)
+	require.False(t, ok)
+	rs.CommitTxNum(txTask.TxNum)
+	txTask, ok = rs.Schedule(ctx)
+	require.True(t, ok)
+	require.Equal(t, uint64(2), txTask.TxNum)
+	require.Zero(t, rs.RollbackCount())
+}
@@ -0,0 +1,205 @@
+package state
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+)
+
+// StorageIterator is implemented by the readers of historical state, which iterate over the storage of a contract
+// in the order of locations, starting from startLocation, without the zero values
+type StorageIterator interface {
+	ForEachStorage(addr common.Address, startLocation common.Hash, cb func(key, seckey common.Hash, value uint256.Int) bool, maxResults int) error
+}
+
+var (
+	_ StorageIterator = (*PlainState)(nil)
+	_ StorageIterator = (*HistoryReader22)(nil)
+	_ StorageIterator = (*HistoryReader23)(nil)
+)
+
+// ForEachStorage merges the latest storage of the contract in the plain state with the locations changed after txNum,
+// found in the history files and in the inverted index not yet in the files. Values of the changed locations are
+// read from the history, and the rest have the latest values
+func (hr *HistoryReader22) ForEachStorage(addr common.Address, startLocation common.Hash, cb func(key, seckey common.Hash, value uint256.Int) bool, maxResults int) error {
+	if acc, err := hr.ReadAccountData(addr); err != nil || acc == nil {
+		return err
+	}
+	fromKey := append(addr.Bytes(), startLocation.Bytes()...)
+	toKey, _ := dbutils.NextSubtree(addr.Bytes())
+
+	// Locations changed after txNum, in the files
+	changed := map[common.Hash]struct{}{}
+	it := hr.ac.IterateStorageHistory(fromKey, toKey, hr.txNum)
+	for it.HasNext() {
+		key, _, _ := it.Next()
+		changed[common.BytesToHash(key[common.AddressLength:])] = struct{}{}
+	}
+	// Locations changed after txNum, not in the files yet
+	if err := hr.changedSinceInDB(fromKey, addr, changed); err != nil {
+		return err
+	}
+
+	// Latest values of the locations not changed after txNum, of the latest incarnation only. Any of them is a
+	// result, so there is no need to read beyond maxResults of them
+	latest := map[common.Hash][]byte{}
+	enc, err := hr.tx.GetOne(kv.PlainState, addr.Bytes())
+	if err != nil {
+		return err
+	}
+	if len(enc) > 0 {
+		var acc accounts.Account
+		if err = acc.DecodeForStorage(enc); err != nil {
+			return err
+		}
+		prefix := dbutils.PlainGenerateStoragePrefix(addr.Bytes(), acc.Incarnation)
+		c, err := hr.tx.Cursor(kv.PlainState)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		unchanged := 0
+		for k, v, err := c.Seek(append(common.CopyBytes(prefix), startLocation.Bytes()...)); k != nil && unchanged < maxResults; k, v, err = c.Next() {
+			if err != nil {
+				return err
+			}
+			if !bytes.HasPrefix(k, prefix) {
+				break
+			}
+			loc := common.BytesToHash(k[len(prefix):])
+			latest[loc] = common.CopyBytes(v)
+			if _, ok := changed[loc]; !ok {
+				unchanged++
+			}
+		}
+	}
+
+	return forEachStorageAt(changed, latest, maxResults, func(loc common.Hash) ([]byte, bool, error) {
+		return hr.ac.ReadAccountStorageNoStateWithRecent(addr.Bytes(), loc.Bytes(), hr.txNum)
+	}, cb)
+}
+
+// ForEachStorage merges the latest storage of the contract in the storage domain with the locations changed at or
+// after txNum in the history of the domain, without the plain state. Keys of the domain have no incarnation: the
+// locations removed by a self-destruct after txNum are in the history with their values before it, and the locations
+// of the incarnations destroyed before txNum are neither in the domain nor in the history after txNum
+func (hr *HistoryReader23) ForEachStorage(addr common.Address, startLocation common.Hash, cb func(key, seckey common.Hash, value uint256.Int) bool, maxResults int) error {
+	if acc, err := hr.ReadAccountData(addr); err != nil || acc == nil {
+		return err
+	}
+	fromKey := append(addr.Bytes(), startLocation.Bytes()...)
+	toKey, _ := dbutils.NextSubtree(addr.Bytes())
+
+	changed := map[common.Hash]struct{}{}
+	it := hr.ac.IterateStorageHistory(fromKey, toKey, hr.txNum, hr.tx)
+	for it.HasNext() {
+		key, _, _ := it.Next()
+		changed[common.BytesToHash(key[common.AddressLength:])] = struct{}{}
+	}
+
+	// The domain is iterated over the whole contract, only maxResults of the unchanged locations are kept
+	latest := map[common.Hash][]byte{}
+	unchanged := 0
+	if err := hr.ac.IterateStoragePrefix(addr.Bytes(), hr.tx, func(k, v []byte) {
+		if len(k) != common.AddressLength+common.HashLength || len(v) == 0 || bytes.Compare(k[common.AddressLength:], startLocation.Bytes()) < 0 {
+			return
+		}
+		loc := common.BytesToHash(k[common.AddressLength:])
+		if _, ok := changed[loc]; !ok {
+			if unchanged >= maxResults {
+				return
+			}
+			unchanged++
+		}
+		latest[loc] = common.CopyBytes(v)
+	}); err != nil {
+		return err
+	}
+
+	return forEachStorageAt(changed, latest, maxResults, func(loc common.Hash) ([]byte, bool, error) {
+		enc, err := hr.ac.ReadAccountStorageBeforeTxNum(addr.Bytes(), loc.Bytes(), hr.txNum, hr.tx)
+		return enc, true, err
+	}, cb)
+}
+
+// forEachStorageAt calls cb for up to maxResults non-empty locations in the order of locations. The values of the
+// changed locations are read by historical if found there, the rest are taken from latest
+func forEachStorageAt(changed map[common.Hash]struct{}, latest map[common.Hash][]byte, maxResults int, historical func(loc common.Hash) ([]byte, bool, error), cb func(key, seckey common.Hash, value uint256.Int) bool) error {
+	locations := make([]common.Hash, 0, len(changed)+len(latest))
+	for loc := range changed {
+		locations = append(locations, loc)
+	}
+	for loc := range latest {
+		if _, ok := changed[loc]; !ok {
+			locations = append(locations, loc)
+		}
+	}
+	sort.Slice(locations, func(i, j int) bool { return bytes.Compare(locations[i][:], locations[j][:]) < 0 })
+
+	results := 0
+	for i := range locations {
+		if results >= maxResults {
+			break
+		}
+		loc := locations[i]
+		enc := latest[loc]
+		if _, ok := changed[loc]; ok {
+			value, found, err := historical(loc)
+			if err != nil {
+				return err
+			}
+			if found {
+				enc = value
+			}
+		}
+		// Deleted at the time
+		if len(enc) == 0 {
+			continue
+		}
+		var value uint256.Int
+		value.SetBytes(enc)
+		seckey, err := common.HashData(loc.Bytes())
+		if err != nil {
+			return err
+		}
+		results++
+		if !cb(loc, seckey, value) {
+			break
+		}
+	}
+	return nil
+}
+
+// changedSinceInDB adds the locations of the contract, starting from fromKey, with the changes at or after txNum in
+// the inverted index of storage in the database (location => txNums)
+func (hr *HistoryReader22) changedSinceInDB(fromKey []byte, addr common.Address, changed map[common.Hash]struct{}) error {
+	c, err := hr.tx.CursorDupSort(kv.StorageIdx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	var txNumEnc [8]byte
+	binary.BigEndian.PutUint64(txNumEnc[:], hr.txNum)
+	for k, _, err := c.Seek(fromKey); k != nil; k, _, err = c.NextNoDup() {
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(k, addr.Bytes()) {
+			break
+		}
+		v, err := c.SeekBothRange(k, txNumEnc[:])
+		if err != nil {
+			return err
+		}
+		if v != nil {
+			changed[common.BytesToHash(k[common.AddressLength:])] = struct{}{}
+		}
+	}
+	return nil
+}
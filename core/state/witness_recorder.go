@@ -0,0 +1,243 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/rlp"
+)
+
+// StateWitness is the state accessed by the execution of a block, as it was before the block: enough to re-execute
+// the block without the database (see WitnessStateReader). It does not contain trie nodes, so it does not prove
+// the state against the state root of the parent block. Lists are sorted by key, for the encoding to be deterministic
+type StateWitness struct {
+	Accounts []WitnessAccount
+	Storage  []WitnessStorage
+	Code     [][]byte
+}
+
+type WitnessAccount struct {
+	Address     common.Address
+	Account     []byte // encoded for storage, empty if the account does not exist
+	Incarnation uint64 // of the last deleted contract at the address, if it was read, see ReadAccountIncarnation
+}
+
+type WitnessStorage struct {
+	Address     common.Address
+	Incarnation uint64
+	Key         common.Hash
+	Value       []byte
+}
+
+func (w *StateWitness) Encode() ([]byte, error) {
+	return rlp.EncodeToBytes(w)
+}
+
+func DecodeStateWitness(enc []byte) (*StateWitness, error) {
+	var w StateWitness
+	if err := rlp.DecodeBytes(enc, &w); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+type witnessStorageKey struct {
+	address     common.Address
+	incarnation uint64
+	key         common.Hash
+}
+
+// WitnessRecorder records the values read from the wrapped reader, for StateWitness. IntraBlockState reads every item
+// from the reader at most once, before it is written, so the values are the state before the execution
+type WitnessRecorder struct {
+	r            StateReader
+	accounts     map[common.Address][]byte
+	incarnations map[common.Address]uint64
+	storage      map[witnessStorageKey][]byte
+	code         map[common.Hash][]byte
+}
+
+func NewWitnessRecorder(r StateReader) *WitnessRecorder {
+	return &WitnessRecorder{
+		r:            r,
+		accounts:     map[common.Address][]byte{},
+		incarnations: map[common.Address]uint64{},
+		storage:      map[witnessStorageKey][]byte{},
+		code:         map[common.Hash][]byte{},
+	}
+}
+
+func (wr *WitnessRecorder) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	a, err := wr.r.ReadAccountData(address)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := wr.accounts[address]; !ok {
+		var enc []byte
+		if a != nil {
+			enc = make([]byte, a.EncodingLengthForStorage())
+			a.EncodeForStorage(enc)
+		}
+		wr.accounts[address] = enc
+	}
+	return a, nil
+}
+
+func (wr *WitnessRecorder) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	enc, err := wr.r.ReadAccountStorage(address, incarnation, key)
+	if err != nil {
+		return nil, err
+	}
+	k := witnessStorageKey{address: address, incarnation: incarnation, key: *key}
+	if _, ok := wr.storage[k]; !ok {
+		wr.storage[k] = common.CopyBytes(enc)
+	}
+	return enc, nil
+}
+
+func (wr *WitnessRecorder) ReadAccountCode(address common.Address, incarnation uint64, codeHash common.Hash) ([]byte, error) {
+	code, err := wr.r.ReadAccountCode(address, incarnation, codeHash)
+	if err != nil {
+		return nil, err
+	}
+	if len(code) > 0 {
+		wr.code[codeHash] = code
+	}
+	return code, nil
+}
+
+// ReadAccountCodeSize records the code, because the size alone can not be verified against the code hash
+func (wr *WitnessRecorder) ReadAccountCodeSize(address common.Address, incarnation uint64, codeHash common.Hash) (int, error) {
+	code, err := wr.ReadAccountCode(address, incarnation, codeHash)
+	return len(code), err
+}
+
+// ReadAccountIncarnation records the account too, so that every account in the witness has the data
+func (wr *WitnessRecorder) ReadAccountIncarnation(address common.Address) (uint64, error) {
+	if _, ok := wr.accounts[address]; !ok {
+		if _, err := wr.ReadAccountData(address); err != nil {
+			return 0, err
+		}
+	}
+	incarnation, err := wr.r.ReadAccountIncarnation(address)
+	if err != nil {
+		return 0, err
+	}
+	wr.incarnations[address] = incarnation
+	return incarnation, nil
+}
+
+func (wr *WitnessRecorder) Witness() *StateWitness {
+	w := &StateWitness{}
+	for address := range wr.accounts {
+		w.Accounts = append(w.Accounts, WitnessAccount{Address: address, Account: wr.accounts[address], Incarnation: wr.incarnations[address]})
+	}
+	sort.Slice(w.Accounts, func(i, j int) bool { return bytes.Compare(w.Accounts[i].Address[:], w.Accounts[j].Address[:]) < 0 })
+	for k, v := range wr.storage {
+		w.Storage = append(w.Storage, WitnessStorage{Address: k.address, Incarnation: k.incarnation, Key: k.key, Value: v})
+	}
+	sort.Slice(w.Storage, func(i, j int) bool {
+		if c := bytes.Compare(w.Storage[i].Address[:], w.Storage[j].Address[:]); c != 0 {
+			return c < 0
+		}
+		if w.Storage[i].Incarnation != w.Storage[j].Incarnation {
+			return w.Storage[i].Incarnation < w.Storage[j].Incarnation
+		}
+		return bytes.Compare(w.Storage[i].Key[:], w.Storage[j].Key[:]) < 0
+	})
+	codeHashes := make([]common.Hash, 0, len(wr.code))
+	for codeHash := range wr.code {
+		codeHashes = append(codeHashes, codeHash)
+	}
+	sort.Slice(codeHashes, func(i, j int) bool { return bytes.Compare(codeHashes[i][:], codeHashes[j][:]) < 0 })
+	for _, codeHash := range codeHashes {
+		w.Code = append(w.Code, wr.code[codeHash])
+	}
+	return w
+}
+
+// WitnessStateReader reads the state from StateWitness, and returns an error when the item is not in the witness,
+// i.e. the execution differs from the one recorded
+type WitnessStateReader struct {
+	accounts     map[common.Address][]byte
+	incarnations map[common.Address]uint64
+	storage      map[witnessStorageKey][]byte
+	code         map[common.Hash][]byte
+}
+
+func NewWitnessStateReader(w *StateWitness) (*WitnessStateReader, error) {
+	r := &WitnessStateReader{
+		accounts:     make(map[common.Address][]byte, len(w.Accounts)),
+		incarnations: make(map[common.Address]uint64, len(w.Accounts)),
+		storage:      make(map[witnessStorageKey][]byte, len(w.Storage)),
+		code:         make(map[common.Hash][]byte, len(w.Code)),
+	}
+	for _, a := range w.Accounts {
+		r.accounts[a.Address] = a.Account
+		r.incarnations[a.Address] = a.Incarnation
+	}
+	for _, s := range w.Storage {
+		r.storage[witnessStorageKey{address: s.Address, incarnation: s.Incarnation, key: s.Key}] = s.Value
+	}
+	for _, code := range w.Code {
+		codeHash, err := common.HashData(code)
+		if err != nil {
+			return nil, err
+		}
+		r.code[codeHash] = code
+	}
+	return r, nil
+}
+
+func (r *WitnessStateReader) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	enc, ok := r.accounts[address]
+	if !ok {
+		return nil, fmt.Errorf("account %x is not in the witness", address)
+	}
+	if len(enc) == 0 {
+		return nil, nil
+	}
+	var a accounts.Account
+	if err := a.DecodeForStorage(enc); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *WitnessStateReader) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	enc, ok := r.storage[witnessStorageKey{address: address, incarnation: incarnation, key: *key}]
+	if !ok {
+		return nil, fmt.Errorf("storage %x %x is not in the witness", address, *key)
+	}
+	if len(enc) == 0 {
+		return nil, nil
+	}
+	return enc, nil
+}
+
+func (r *WitnessStateReader) ReadAccountCode(address common.Address, incarnation uint64, codeHash common.Hash) ([]byte, error) {
+	if bytes.Equal(codeHash[:], emptyCodeHash) {
+		return nil, nil
+	}
+	code, ok := r.code[codeHash]
+	if !ok {
+		return nil, fmt.Errorf("code %x is not in the witness", codeHash)
+	}
+	return code, nil
+}
+
+func (r *WitnessStateReader) ReadAccountCodeSize(address common.Address, incarnation uint64, codeHash common.Hash) (int, error) {
+	code, err := r.ReadAccountCode(address, incarnation, codeHash)
+	return len(code), err
+}
+
+func (r *WitnessStateReader) ReadAccountIncarnation(address common.Address) (uint64, error) {
+	incarnation, ok := r.incarnations[address]
+	if !ok {
+		return 0, fmt.Errorf("incarnation of %x is not in the witness", address)
+	}
+	return incarnation, nil
+}
@@ -0,0 +1,59 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWitnessRecorder(t *testing.T) {
+	contract, missing := common.HexToAddress("0x01"), common.HexToAddress("0x02")
+	key1, key2 := common.HexToHash("0x03"), common.HexToHash("0x04")
+	code := []byte{0x60, 0x00}
+
+	_, tx := memdb.NewTestTx(t)
+	ibs := New(NewPlainStateReader(tx))
+	ibs.CreateAccount(contract, true)
+	ibs.SetCode(contract, code)
+	ibs.SetState(contract, &key1, *uint256.NewInt(1))
+	require.NoError(t, ibs.CommitBlock(&params.Rules{}, NewPlainStateWriterNoHistory(tx)))
+
+	execute := func(r StateReader) (uint64, uint64, []byte, bool) {
+		ibs := New(r)
+		var v1, v2 uint256.Int
+		ibs.GetState(contract, &key1, &v1)
+		ibs.GetState(contract, &key2, &v2)
+		ibs.SetState(contract, &key1, *uint256.NewInt(5)) // writes are not in the witness
+		return v1.Uint64(), v2.Uint64(), ibs.GetCode(contract), ibs.Exist(missing)
+	}
+
+	recorder := NewWitnessRecorder(NewPlainStateReader(tx))
+	v1, v2, c, exists := execute(recorder)
+	require.Equal(t, uint64(1), v1)
+	require.Equal(t, uint64(0), v2)
+	require.Equal(t, code, c)
+	require.False(t, exists)
+
+	enc, err := recorder.Witness().Encode()
+	require.NoError(t, err)
+	witness, err := DecodeStateWitness(enc)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(witness.Accounts))
+	require.Equal(t, 2, len(witness.Storage))
+	require.Equal(t, [][]byte{code}, witness.Code)
+
+	r, err := NewWitnessStateReader(witness)
+	require.NoError(t, err)
+	v1, v2, c, exists = execute(r)
+	require.Equal(t, uint64(1), v1)
+	require.Equal(t, uint64(0), v2)
+	require.Equal(t, code, c)
+	require.False(t, exists)
+
+	_, err = r.ReadAccountData(common.HexToAddress("0x05"))
+	require.Error(t, err)
+}
@@ -0,0 +1,182 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+)
+
+// ErrTxConditionsNotMet is returned when the block or the state does not satisfy the conditions of a conditional
+// transaction (see TransactionConditions)
+var ErrTxConditionsNotMet = errors.New("transaction conditions not met")
+
+// TransactionConditions are the conditions of eth_sendRawTransactionConditional: the transaction may be included
+// only into a block within the ranges, and only if the known accounts have the given storage before it
+type TransactionConditions struct {
+	KnownAccounts  map[common.Address]KnownAccount `json:"knownAccounts"`
+	BlockNumberMin *hexutil.Uint64                 `json:"blockNumberMin"`
+	BlockNumberMax *hexutil.Uint64                 `json:"blockNumberMax"`
+	TimestampMin   *hexutil.Uint64                 `json:"timestampMin"`
+	TimestampMax   *hexutil.Uint64                 `json:"timestampMax"`
+}
+
+// KnownAccount is either the storage root of the account, or the values of some of its slots
+type KnownAccount struct {
+	StorageRoot *common.Hash
+	Slots       map[common.Hash]common.Hash
+}
+
+func (a *KnownAccount) UnmarshalJSON(data []byte) error {
+	var root common.Hash
+	if err := json.Unmarshal(data, &root); err == nil {
+		a.StorageRoot, a.Slots = &root, nil
+		return nil
+	}
+	a.StorageRoot = nil
+	return json.Unmarshal(data, &a.Slots)
+}
+
+func (a KnownAccount) MarshalJSON() ([]byte, error) {
+	if a.StorageRoot != nil {
+		return json.Marshal(a.StorageRoot)
+	}
+	return json.Marshal(a.Slots)
+}
+
+// Validate rejects the conditions which Check does not support. The storage roots are not known without computing
+// the storage tries, so the conditions on them are rejected at submission
+func (c *TransactionConditions) Validate() error {
+	for address, known := range c.KnownAccounts {
+		if known.StorageRoot != nil {
+			return fmt.Errorf("storage root condition of %x is not supported, only slots", address)
+		}
+	}
+	return nil
+}
+
+// Check returns ErrTxConditionsNotMet if the block of the header, or the state before the transaction, does not
+// satisfy the conditions. The conditions are expected to pass Validate
+func (c *TransactionConditions) Check(header *types.Header, ibs *state.IntraBlockState) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	number := header.Number.Uint64()
+	if c.BlockNumberMin != nil && number < uint64(*c.BlockNumberMin) {
+		return fmt.Errorf("%w: block number %d is before %d", ErrTxConditionsNotMet, number, *c.BlockNumberMin)
+	}
+	if c.BlockNumberMax != nil && number > uint64(*c.BlockNumberMax) {
+		return fmt.Errorf("%w: block number %d is after %d", ErrTxConditionsNotMet, number, *c.BlockNumberMax)
+	}
+	if c.TimestampMin != nil && header.Time < uint64(*c.TimestampMin) {
+		return fmt.Errorf("%w: timestamp %d is before %d", ErrTxConditionsNotMet, header.Time, *c.TimestampMin)
+	}
+	if c.TimestampMax != nil && header.Time > uint64(*c.TimestampMax) {
+		return fmt.Errorf("%w: timestamp %d is after %d", ErrTxConditionsNotMet, header.Time, *c.TimestampMax)
+	}
+	for address, known := range c.KnownAccounts {
+		for slot, expected := range known.Slots {
+			slot := slot
+			var value uint256.Int
+			ibs.GetState(address, &slot, &value)
+			if common.Hash(value.Bytes32()) != expected {
+				return fmt.Errorf("%w: storage %x of %x is %x, expected %x", ErrTxConditionsNotMet, slot, address, value.Bytes32(), expected)
+			}
+		}
+	}
+	return nil
+}
+
+// ErrTxConditionsFull is returned when the registry has the conditions of as many transactions as its limit
+var ErrTxConditionsFull = errors.New("too many conditional transactions in the pool")
+
+// TxConditionsLimit is the number of the conditional transactions the registry of the miner keeps at once
+const TxConditionsLimit = 4096
+
+// TxConditionsRegistry keeps the conditions of the conditional transactions by transaction hash, for the miner to check
+// them again when building the block. The conditions are kept, even once they can no longer be met, until the
+// transaction can no longer be mined, so that the miner never takes a conditional transaction for an unconditional one.
+// Thread-safe
+type TxConditionsRegistry struct {
+	lock       sync.Mutex
+	limit      int
+	conditions map[common.Hash]*txConditions
+}
+
+type txConditions struct {
+	*TransactionConditions
+	sender common.Address
+	nonce  uint64
+}
+
+func NewTxConditionsRegistry(limit int) *TxConditionsRegistry {
+	return &TxConditionsRegistry{limit: limit, conditions: map[common.Hash]*txConditions{}}
+}
+
+// Add registers the conditions of the transaction of the sender and nonce, or returns ErrTxConditionsFull
+func (r *TxConditionsRegistry) Add(txHash common.Hash, sender common.Address, nonce uint64, conditions *TransactionConditions) error {
+	if err := conditions.Validate(); err != nil {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.conditions[txHash]; !ok && len(r.conditions) >= r.limit {
+		return fmt.Errorf("%w: %d", ErrTxConditionsFull, r.limit)
+	}
+	r.conditions[txHash] = &txConditions{TransactionConditions: conditions, sender: sender, nonce: nonce}
+	return nil
+}
+
+func (r *TxConditionsRegistry) Remove(txHash common.Hash) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.conditions, txHash)
+}
+
+func (r *TxConditionsRegistry) Len() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return len(r.conditions)
+}
+
+// Check returns the error of TransactionConditions.Check if the transaction is conditional
+func (r *TxConditionsRegistry) Check(txHash common.Hash, header *types.Header, ibs *state.IntraBlockState) error {
+	r.lock.Lock()
+	conditions, ok := r.conditions[txHash]
+	r.lock.Unlock()
+	if !ok {
+		return nil
+	}
+	return conditions.Check(header, ibs)
+}
+
+// Prune drops the conditions of the transactions which can no longer be mined on the state: mined, or replaced by a
+// mined transaction of the same nonce
+func (r *TxConditionsRegistry) Prune(stateReader state.StateReader) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	nonces := map[common.Address]uint64{}
+	for txHash, conditions := range r.conditions {
+		nonce, ok := nonces[conditions.sender]
+		if !ok {
+			account, err := stateReader.ReadAccountData(conditions.sender)
+			if err != nil {
+				return err
+			}
+			if account != nil {
+				nonce = account.Nonce
+			}
+			nonces[conditions.sender] = nonce
+		}
+		if conditions.nonce < nonce {
+			delete(r.conditions, txHash)
+		}
+	}
+	return nil
+}
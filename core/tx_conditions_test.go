@@ -0,0 +1,75 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactionConditions(t *testing.T) {
+	var conditions TransactionConditions
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"knownAccounts": {
+			"0x0000000000000000000000000000000000000001": {"0x0000000000000000000000000000000000000000000000000000000000000002": "0x0000000000000000000000000000000000000000000000000000000000000003"},
+			"0x0000000000000000000000000000000000000004": "0x0000000000000000000000000000000000000000000000000000000000000005"
+		},
+		"blockNumberMax": "0xa"
+	}`), &conditions))
+	require.NotNil(t, conditions.KnownAccounts[common.HexToAddress("0x04")].StorageRoot)
+	require.Len(t, conditions.KnownAccounts[common.HexToAddress("0x01")].Slots, 1)
+
+	_, tx := memdb.NewTestTx(t)
+	ibs := state.New(state.NewPlainStateReader(tx))
+	contract, slot := common.HexToAddress("0x01"), common.HexToHash("0x02")
+	ibs.SetState(contract, &slot, *uint256.NewInt(3))
+	header := &types.Header{Number: big.NewInt(10)}
+
+	// storage roots are not supported
+	require.Error(t, conditions.Validate())
+	require.Error(t, conditions.Check(header, ibs))
+	delete(conditions.KnownAccounts, common.HexToAddress("0x04"))
+	require.NoError(t, conditions.Validate())
+	require.NoError(t, conditions.Check(header, ibs))
+
+	ibs.SetState(contract, &slot, *uint256.NewInt(4))
+	require.True(t, errors.Is(conditions.Check(header, ibs), ErrTxConditionsNotMet))
+	ibs.SetState(contract, &slot, *uint256.NewInt(3))
+}
+
+func TestTxConditionsRegistry(t *testing.T) {
+	maxBlock := hexutil.Uint64(10)
+	conditions := &TransactionConditions{BlockNumberMax: &maxBlock}
+	_, tx := memdb.NewTestTx(t)
+	stateReader := state.NewPlainStateReader(tx)
+	ibs := state.New(stateReader)
+	sender := common.HexToAddress("0x07")
+
+	registry := NewTxConditionsRegistry(1)
+	txHash := common.HexToHash("0x06")
+	require.NoError(t, registry.Check(txHash, &types.Header{Number: big.NewInt(11)}, ibs)) // not conditional
+	require.NoError(t, registry.Add(txHash, sender, 0, conditions))
+	require.True(t, errors.Is(registry.Add(common.HexToHash("0x08"), sender, 1, conditions), ErrTxConditionsFull), "not evicted")
+	require.NoError(t, registry.Check(txHash, &types.Header{Number: big.NewInt(10)}, ibs))
+	// rejected for as long as the transaction may be mined, not only once expired
+	for i := 0; i < 2; i++ {
+		require.True(t, errors.Is(registry.Check(txHash, &types.Header{Number: big.NewInt(11)}, ibs), ErrTxConditionsNotMet))
+	}
+	require.NoError(t, registry.Prune(stateReader))
+	require.Equal(t, 1, registry.Len())
+
+	// the nonce of the sender is past the transaction
+	ibs.SetNonce(sender, 1)
+	require.NoError(t, ibs.CommitBlock(&params.Rules{}, state.NewPlainStateWriterNoHistory(tx)))
+	require.NoError(t, registry.Prune(stateReader))
+	require.Equal(t, 0, registry.Len())
+}
@@ -67,6 +67,13 @@ type TxPoolConfig struct {
 	PriceLimit uint64 // Minimum gas price to enforce for acceptance into the pool
 	PriceBump  uint64 // Minimum price bump percentage to replace an already existing transaction (nonce)
 
+	MaxReplacements uint64 // Times a transaction submitted over RPC may be replaced by one of the same sender and nonce, 0 - unlimited
+	MaxNonceGap     uint64 // Nonces a transaction submitted over RPC may skip after the next nonce of the sender, 0 - unlimited
+	NoNonceGaps     bool   // Reject the transactions submitted over RPC which skip a nonce, for sequencers
+
+	BroadcastLocal bool     // Send the transactions submitted over RPC to all peers right away
+	BroadcastPeers []string // Enodes of the peers the transactions submitted over RPC are sent to right away
+
 	AccountSlots uint64 // Number of executable transaction slots guaranteed per account
 	GlobalSlots  uint64 // Maximum number of executable transaction slots for all accounts
 	AccountQueue uint64 // Maximum number of non-executable transaction slots permitted per account
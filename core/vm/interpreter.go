@@ -37,6 +37,7 @@ type Config struct {
 	NoReceipts    bool   // Do not calculate receipts
 	ReadOnly      bool   // Do no perform any block finalisation
 	EnableTEMV    bool   // true if execution with TEVM enable flag
+	MaxMemory     uint64 // Limit of the memory of a call frame in bytes, 0 - no limit (e.g. budget of eth_call)
 
 	ExtraEips []int // Additional EIPS that are to be enabled
 }
@@ -294,6 +295,9 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 			if memorySize, overflow = math.SafeMul(toWordSize(memSize), 32); overflow {
 				return nil, ErrGasUintOverflow
 			}
+			if in.cfg.MaxMemory > 0 && memorySize > in.cfg.MaxMemory {
+				return nil, ErrMemoryLimit
+			}
 		}
 		// Dynamic portion of gas
 		// consume the gas and return an error if not enough gas is available.
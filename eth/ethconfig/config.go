@@ -67,6 +67,7 @@ var Defaults = Config{
 	Sync: Sync{
 		UseSnapshots:               false,
 		ExecWorkerCount:            1,
+		ExecMemoryBudget:           2 * datasize.GB,
 		BlockDownloaderWindow:      32768,
 		BodyDownloadTimeoutSeconds: 30,
 	},
@@ -243,8 +244,9 @@ type Config struct {
 type Sync struct {
 	UseSnapshots bool
 	// LoopThrottle sets a minimum time between staged loop iterations
-	LoopThrottle    time.Duration
-	ExecWorkerCount int
+	LoopThrottle     time.Duration
+	ExecWorkerCount  int
+	ExecMemoryBudget datasize.ByteSize // memory for the results of exec22 workers and the buffered changes together
 
 	BlockDownloaderWindow      int
 	BodyDownloadTimeoutSeconds int // TODO: change to duration
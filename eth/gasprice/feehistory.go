@@ -18,12 +18,15 @@ package gasprice
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
 	"math/big"
 	"sort"
 	"sync/atomic"
 
+	lru "github.com/hashicorp/golang-lru"
 	"github.com/holiman/uint256"
 	libcommon "github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon/common"
@@ -40,8 +43,9 @@ var (
 
 const (
 	// maxFeeHistory is the maximum number of blocks that can be retrieved for a
-	// fee history request.
-	maxFeeHistory = 1024
+	// fee history request. The processed blocks are cached (see FeeHistoryCache),
+	// so the long windows are expensive only the first time.
+	maxFeeHistory = 8192
 )
 
 // blockFees represents a single block for processing
@@ -51,11 +55,61 @@ type blockFees struct {
 	header      *types.Header
 	block       *types.Block // only set if reward percentiles are requested
 	receipts    types.Receipts
-	// filled by processBlock
+	// filled by processBlock or taken from the cache
+	results processedFees
+	err     error
+}
+
+// processedFees contains the results of a processed block
+type processedFees struct {
 	reward               []*big.Int
 	baseFee, nextBaseFee *big.Int
 	gasUsedRatio         float64
-	err                  error
+}
+
+// FeeHistoryCache keeps the processed fees of the recent blocks, by block hash and reward
+// percentiles, for the oracles of the following requests. Thread-safe
+type FeeHistoryCache struct {
+	lru *lru.Cache
+}
+
+type feeHistoryCacheKey struct {
+	blockHash   common.Hash
+	percentiles string
+}
+
+func NewFeeHistoryCache(size int) *FeeHistoryCache {
+	c, err := lru.New(size)
+	if err != nil {
+		panic(err)
+	}
+	return &FeeHistoryCache{lru: c}
+}
+
+func (c *FeeHistoryCache) get(key feeHistoryCacheKey) (processedFees, bool) {
+	if c == nil {
+		return processedFees{}, false
+	}
+	if v, ok := c.lru.Get(key); ok {
+		return v.(processedFees), true
+	}
+	return processedFees{}, false
+}
+
+func (c *FeeHistoryCache) add(key feeHistoryCacheKey, fees processedFees) {
+	if c == nil {
+		return
+	}
+	c.lru.Add(key, fees)
+}
+
+// percentilesKey encodes the reward percentiles for feeHistoryCacheKey
+func percentilesKey(percentiles []float64) string {
+	key := make([]byte, 8*len(percentiles))
+	for i, p := range percentiles {
+		binary.LittleEndian.PutUint64(key[i*8:], math.Float64bits(p))
+	}
+	return string(key)
 }
 
 // txGasAndReward is sorted in ascending order based on reward
@@ -80,15 +134,15 @@ func (s sortGasAndReward) Less(i, j int) bool {
 // fills in the rest of the fields.
 func (oracle *Oracle) processBlock(bf *blockFees, percentiles []float64) {
 	chainconfig := oracle.backend.ChainConfig()
-	if bf.baseFee = bf.header.BaseFee; bf.baseFee == nil {
-		bf.baseFee = new(big.Int)
+	if bf.results.baseFee = bf.header.BaseFee; bf.results.baseFee == nil {
+		bf.results.baseFee = new(big.Int)
 	}
 	if chainconfig.IsLondon(bf.blockNumber + 1) {
-		bf.nextBaseFee = misc.CalcBaseFee(chainconfig, bf.header)
+		bf.results.nextBaseFee = misc.CalcBaseFee(chainconfig, bf.header)
 	} else {
-		bf.nextBaseFee = new(big.Int)
+		bf.results.nextBaseFee = new(big.Int)
 	}
-	bf.gasUsedRatio = float64(bf.header.GasUsed) / float64(bf.header.GasLimit)
+	bf.results.gasUsedRatio = float64(bf.header.GasUsed) / float64(bf.header.GasLimit)
 	if len(percentiles) == 0 {
 		// rewards were not requested, return null
 		return
@@ -98,11 +152,11 @@ func (oracle *Oracle) processBlock(bf *blockFees, percentiles []float64) {
 		return
 	}
 
-	bf.reward = make([]*big.Int, len(percentiles))
+	bf.results.reward = make([]*big.Int, len(percentiles))
 	if len(bf.block.Transactions()) == 0 {
 		// return an all zero row if there are no transactions to gather data from
-		for i := range bf.reward {
-			bf.reward[i] = new(big.Int)
+		for i := range bf.results.reward {
+			bf.results.reward[i] = new(big.Int)
 		}
 		return
 	}
@@ -127,7 +181,7 @@ func (oracle *Oracle) processBlock(bf *blockFees, percentiles []float64) {
 			txIndex++
 			sumGasUsed += sorter[txIndex].gasUsed
 		}
-		bf.reward[i] = sorter[txIndex].reward
+		bf.results.reward[i] = sorter[txIndex].reward
 	}
 }
 
@@ -234,7 +288,8 @@ func (oracle *Oracle) FeeHistory(ctx context.Context, blocks int, unresolvedLast
 	oldestBlock := lastBlock + 1 - uint64(blocks)
 
 	var (
-		next = oldestBlock
+		next          = oldestBlock
+		percentileKey = percentilesKey(rewardPercentiles)
 	)
 	var (
 		reward       = make([][]*big.Int, blocks)
@@ -253,23 +308,29 @@ func (oracle *Oracle) FeeHistory(ctx context.Context, blocks int, unresolvedLast
 		}
 
 		fees := &blockFees{blockNumber: blockNumber}
+		cached := false
 		if pendingBlock != nil && blockNumber >= pendingBlock.NumberU64() {
 			fees.block, fees.receipts = pendingBlock, pendingReceipts
 		} else {
-			if len(rewardPercentiles) != 0 {
-				fees.block, fees.err = oracle.backend.BlockByNumber(ctx, rpc.BlockNumber(blockNumber))
-				if fees.block != nil && fees.err == nil {
-					fees.receipts, fees.err = oracle.backend.GetReceipts(ctx, fees.block.Hash())
+			fees.header, fees.err = oracle.backend.HeaderByNumber(ctx, rpc.BlockNumber(blockNumber))
+			if fees.header != nil && fees.err == nil && len(rewardPercentiles) != 0 {
+				fees.results, cached = oracle.cache.get(feeHistoryCacheKey{fees.header.Hash(), percentileKey})
+				if !cached {
+					fees.block, fees.err = oracle.backend.BlockByNumber(ctx, rpc.BlockNumber(blockNumber))
+					if fees.block != nil && fees.err == nil {
+						fees.receipts, fees.err = oracle.backend.GetReceipts(ctx, fees.block.Hash())
+					}
 				}
-			} else {
-				fees.header, fees.err = oracle.backend.HeaderByNumber(ctx, rpc.BlockNumber(blockNumber))
 			}
 		}
 		if fees.block != nil {
 			fees.header = fees.block.Header()
 		}
-		if fees.header != nil {
+		if fees.header != nil && !cached && fees.err == nil {
 			oracle.processBlock(fees, rewardPercentiles)
+			if fees.block != nil && fees.block != pendingBlock && fees.results.reward != nil {
+				oracle.cache.add(feeHistoryCacheKey{fees.header.Hash(), percentileKey}, fees.results)
+			}
 		}
 
 		if fees.err != nil {
@@ -277,7 +338,7 @@ func (oracle *Oracle) FeeHistory(ctx context.Context, blocks int, unresolvedLast
 		}
 		i := int(fees.blockNumber - oldestBlock)
 		if fees.header != nil {
-			reward[i], baseFee[i], baseFee[i+1], gasUsedRatio[i] = fees.reward, fees.baseFee, fees.nextBaseFee, fees.gasUsedRatio
+			reward[i], baseFee[i], baseFee[i+1], gasUsedRatio[i] = fees.results.reward, fees.results.baseFee, fees.results.nextBaseFee, fees.results.gasUsedRatio
 		} else {
 			// getting no block and no error means we are requesting into the future (might happen because of a reorg)
 			if i < firstMissing {
@@ -19,6 +19,7 @@ package gasprice_test
 import (
 	"context"
 	"errors"
+	"reflect"
 	"testing"
 
 	"github.com/ledgerwatch/erigon/eth/gasprice"
@@ -87,3 +88,24 @@ func TestFeeHistory(t *testing.T) {
 		}
 	}
 }
+
+func TestFeeHistoryCache(t *testing.T) {
+	backend := newTestBackend(t)
+	cache := gasprice.NewFeeHistoryCache(64)
+	percentiles := []float64{0, 50, 100}
+
+	expFirst, expReward, expBaseFee, expRatio, err := gasprice.NewOracle(backend, gasprice.Config{}).FeeHistory(context.Background(), 10, 30, percentiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the second oracle takes the blocks processed by the first one from the cache
+	for i := 0; i < 2; i++ {
+		first, reward, baseFee, ratio, err := gasprice.NewOracle(backend, gasprice.Config{}).SetCache(cache).FeeHistory(context.Background(), 10, 30, percentiles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first.Cmp(expFirst) != 0 || !reflect.DeepEqual(reward, expReward) || !reflect.DeepEqual(baseFee, expBaseFee) || !reflect.DeepEqual(ratio, expRatio) {
+			t.Fatalf("Run %d: fee history mismatch", i)
+		}
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"context"
 	"errors"
 	"math/big"
+	"sort"
 	"sync"
 
 	"github.com/holiman/uint256"
@@ -38,6 +39,15 @@ var (
 	DefaultIgnorePrice = big.NewInt(2 * params.Wei)
 )
 
+// Estimators of the suggested tip, see Config.Estimator
+const (
+	// PercentileEstimator suggests the percentile of the lowest tips of the recent transactions
+	PercentileEstimator = "percentile"
+	// EWMAEstimator suggests the exponentially weighted moving average of the percentiles of the
+	// lowest tips of the recent blocks, newer blocks having more weight
+	EWMAEstimator = "ewma"
+)
+
 type Config struct {
 	Blocks           int
 	Percentile       int
@@ -46,6 +56,7 @@ type Config struct {
 	Default          *big.Int `toml:",omitempty"`
 	MaxPrice         *big.Int `toml:",omitempty"`
 	IgnorePrice      *big.Int `toml:",omitempty"`
+	Estimator        string   `toml:",omitempty"` // PercentileEstimator if empty
 }
 
 // OracleBackend includes all necessary background APIs for oracle.
@@ -70,7 +81,10 @@ type Oracle struct {
 
 	checkBlocks                       int
 	percentile                        int
+	estimator                         string
 	maxHeaderHistory, maxBlockHistory int
+
+	cache *FeeHistoryCache // optional, shared by the oracles of different requests
 }
 
 // NewOracle returns a new gasprice oracle which can recommend suitable
@@ -100,6 +114,15 @@ func NewOracle(backend OracleBackend, params Config) *Oracle {
 		ignorePrice = DefaultIgnorePrice
 		log.Warn("Sanitizing invalid gasprice oracle ignore price", "provided", params.IgnorePrice, "updated", ignorePrice)
 	}
+	estimator := params.Estimator
+	switch estimator {
+	case PercentileEstimator, EWMAEstimator:
+	case "":
+		estimator = PercentileEstimator
+	default:
+		estimator = PercentileEstimator
+		log.Warn("Sanitizing invalid gasprice oracle estimator", "provided", params.Estimator, "updated", estimator)
+	}
 	return &Oracle{
 		backend:          backend,
 		lastPrice:        params.Default,
@@ -107,11 +130,18 @@ func NewOracle(backend OracleBackend, params Config) *Oracle {
 		ignorePrice:      ignorePrice,
 		checkBlocks:      blocks,
 		percentile:       percent,
+		estimator:        estimator,
 		maxHeaderHistory: params.MaxHeaderHistory,
 		maxBlockHistory:  params.MaxBlockHistory,
 	}
 }
 
+// SetCache sets the cache of the processed blocks of FeeHistory
+func (oracle *Oracle) SetCache(cache *FeeHistoryCache) *Oracle {
+	oracle.cache = cache
+	return oracle
+}
+
 // SuggestTipCap returns a TipCap so that newly created transaction can
 // have a very high chance to be included in the following blocks.
 // NODE: if caller wants legacy tx SuggestedPrice, we need to add
@@ -141,27 +171,17 @@ func (gpo *Oracle) SuggestTipCap(ctx context.Context) (*big.Int, error) {
 	if headHash == lastHead {
 		return lastPrice, nil
 	}
-	number := head.Number.Uint64()
-	txPrices := make(sortingHeap, 0, sampleNumber*gpo.checkBlocks)
-	for txPrices.Len() < sampleNumber*gpo.checkBlocks && number > 0 {
-		err := gpo.getBlockPrices(ctx, number, sampleNumber, gpo.ignorePrice, &txPrices)
-		if err != nil {
-			return lastPrice, err
-		}
-		number--
+	var price *big.Int
+	if gpo.estimator == EWMAEstimator {
+		price, err = gpo.ewmaTip(ctx, head.Number.Uint64())
+	} else {
+		price, err = gpo.percentileTip(ctx, head.Number.Uint64())
 	}
-	price := lastPrice
-	if txPrices.Len() > 0 {
-		// Item with this position needs to be extracted from the sorting heap
-		// so we pop all the items before it
-		percentilePosition := (txPrices.Len() - 1) * gpo.percentile / 100
-		for i := 0; i < percentilePosition; i++ {
-			heap.Pop(&txPrices)
-		}
+	if err != nil {
+		return lastPrice, err
 	}
-	if txPrices.Len() > 0 {
-		// Don't need to pop it, just take from the top of the heap
-		price = txPrices[0].ToBig()
+	if price == nil {
+		price = lastPrice
 	}
 	if price.Cmp(gpo.maxPrice) > 0 {
 		price = new(big.Int).Set(gpo.maxPrice)
@@ -173,6 +193,61 @@ func (gpo *Oracle) SuggestTipCap(ctx context.Context) (*big.Int, error) {
 	return price, nil
 }
 
+// percentileTip returns the percentile of the lowest tips of the transactions of the recent blocks, nil if
+// there are no transactions
+func (gpo *Oracle) percentileTip(ctx context.Context, number uint64) (*big.Int, error) {
+	txPrices := make(sortingHeap, 0, sampleNumber*gpo.checkBlocks)
+	for txPrices.Len() < sampleNumber*gpo.checkBlocks && number > 0 {
+		err := gpo.getBlockPrices(ctx, number, sampleNumber, gpo.ignorePrice, &txPrices)
+		if err != nil {
+			return nil, err
+		}
+		number--
+	}
+	if txPrices.Len() == 0 {
+		return nil, nil
+	}
+	// Item with this position needs to be extracted from the sorting heap
+	// so we pop all the items before it
+	percentilePosition := (txPrices.Len() - 1) * gpo.percentile / 100
+	for i := 0; i < percentilePosition; i++ {
+		heap.Pop(&txPrices)
+	}
+	// Don't need to pop it, just take from the top of the heap
+	return txPrices[0].ToBig(), nil
+}
+
+// ewmaTip returns the exponentially weighted moving average of the percentiles of the lowest tips of the
+// recent blocks, nil if there are no transactions. Smoothing factor is 2/(checkBlocks+1), so the average
+// follows the changes of the tips about as fast as the percentile of checkBlocks blocks
+func (gpo *Oracle) ewmaTip(ctx context.Context, number uint64) (*big.Int, error) {
+	blockTips := make([]*big.Int, 0, gpo.checkBlocks) // from the newest block
+	for len(blockTips) < gpo.checkBlocks && number > 0 {
+		txPrices := make(sortingHeap, 0, sampleNumber)
+		if err := gpo.getBlockPrices(ctx, number, sampleNumber, gpo.ignorePrice, &txPrices); err != nil {
+			return nil, err
+		}
+		number--
+		if txPrices.Len() == 0 {
+			continue
+		}
+		sort.Sort(txPrices)
+		blockTips = append(blockTips, txPrices[(txPrices.Len()-1)*gpo.percentile/100].ToBig())
+	}
+	if len(blockTips) == 0 {
+		return nil, nil
+	}
+	alpha := big.NewFloat(2 / (float64(gpo.checkBlocks) + 1))
+	keep := new(big.Float).Sub(big.NewFloat(1), alpha)
+	avg := new(big.Float).SetInt(blockTips[len(blockTips)-1])
+	for i := len(blockTips) - 2; i >= 0; i-- {
+		avg.Mul(avg, keep)
+		avg.Add(avg, new(big.Float).Mul(alpha, new(big.Float).SetInt(blockTips[i])))
+	}
+	tip, _ := avg.Int(nil)
+	return tip, nil
+}
+
 type transactionsByGasPrice struct {
 	txs     []types.Transaction
 	baseFee *uint256.Int
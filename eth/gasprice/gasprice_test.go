@@ -156,3 +156,24 @@ func TestSuggestPrice(t *testing.T) {
 		t.Fatalf("Gas price mismatch, want %d, got %d", expect, got)
 	}
 }
+
+func TestSuggestPriceEWMA(t *testing.T) {
+	config := gasprice.Config{
+		Blocks:     2,
+		Percentile: 60,
+		Default:    big.NewInt(params.GWei),
+		Estimator:  gasprice.EWMAEstimator,
+	}
+	backend := newTestBackend(t)
+	oracle := gasprice.NewOracle(backend, config)
+
+	// The gas price sampled is: 32G, 31G, the newest weighted by 2/3
+	got, err := oracle.SuggestTipCap(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to retrieve recommended gas price: %v", err)
+	}
+	expect := big.NewInt(params.GWei * int64(95) / 3)
+	if new(big.Int).Sub(got, expect).CmpAbs(big.NewInt(1)) > 0 {
+		t.Fatalf("Gas price mismatch, want %d, got %d", expect, got)
+	}
+}
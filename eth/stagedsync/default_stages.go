@@ -8,7 +8,7 @@ import (
 	"github.com/ledgerwatch/erigon/ethdb/prune"
 )
 
-func DefaultStages(ctx context.Context, sm prune.Mode, headers HeadersCfg, cumulativeIndex CumulativeIndexCfg, blockHashCfg BlockHashesCfg, bodies BodiesCfg, issuance IssuanceCfg, senders SendersCfg, exec ExecuteBlockCfg, trans TranspileCfg, hashState HashStateCfg, trieCfg TrieCfg, history HistoryCfg, logIndex LogIndexCfg, callTraces CallTracesCfg, txLookup TxLookupCfg, finish FinishCfg, test bool) []*Stage {
+func DefaultStages(ctx context.Context, sm prune.Mode, headers HeadersCfg, cumulativeIndex CumulativeIndexCfg, blockHashCfg BlockHashesCfg, bodies BodiesCfg, issuance IssuanceCfg, senders SendersCfg, exec ExecuteBlockCfg, trans TranspileCfg, hashState HashStateCfg, trieCfg TrieCfg, history HistoryCfg, logIndex LogIndexCfg, callTraces CallTracesCfg, txLookup TxLookupCfg, otsContracts OtsContractsCfg, finish FinishCfg, test bool) []*Stage {
 	return []*Stage{
 		{
 			ID:          stages.Headers,
@@ -203,6 +203,21 @@ func DefaultStages(ctx context.Context, sm prune.Mode, headers HeadersCfg, cumul
 				return PruneTxLookup(p, tx, txLookup, ctx)
 			},
 		},
+		{
+			ID:                  stages.OtsContracts,
+			Description:         "Generate contract creations index",
+			Disabled:            !sm.Experiments.Ots2,
+			DisabledDescription: "Enable by adding `ots2` to --experiments",
+			Forward: func(firstCycle bool, badBlockUnwind bool, s *StageState, u Unwinder, tx kv.RwTx) error {
+				return SpawnOtsContracts(s, tx, otsContracts, ctx)
+			},
+			Unwind: func(firstCycle bool, u *UnwindState, s *StageState, tx kv.RwTx) error {
+				return UnwindOtsContracts(u, s, tx, otsContracts, ctx)
+			},
+			Prune: func(firstCycle bool, p *PruneState, tx kv.RwTx) error {
+				return PruneOtsContracts(p, tx, otsContracts, ctx)
+			},
+		},
 		{
 			ID:          stages.Issuance,
 			Description: "Issuance computation",
@@ -325,6 +340,7 @@ var DefaultForwardOrder = UnwindOrder{
 	stages.StorageHistoryIndex,
 	stages.LogIndex,
 	stages.TxLookup,
+	stages.OtsContracts,
 	stages.Finish,
 }
 
@@ -337,6 +353,7 @@ type PruneOrder []stages.SyncStage
 
 var DefaultUnwindOrder = UnwindOrder{
 	stages.Finish,
+	stages.OtsContracts,
 	stages.TxLookup,
 	stages.LogIndex,
 	stages.StorageHistoryIndex,
@@ -369,6 +386,7 @@ var StateUnwindOrder = UnwindOrder{
 
 var DefaultPruneOrder = PruneOrder{
 	stages.Finish,
+	stages.OtsContracts,
 	stages.TxLookup,
 	stages.LogIndex,
 	stages.StorageHistoryIndex,
@@ -9,10 +9,12 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/c2h5oh/datasize"
 	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	state2 "github.com/ledgerwatch/erigon-lib/state"
 	"github.com/ledgerwatch/erigon/cmd/state/exec22"
+	"github.com/ledgerwatch/erigon/common/debug"
 	"github.com/ledgerwatch/erigon/consensus"
 	"github.com/ledgerwatch/erigon/core"
 	"github.com/ledgerwatch/erigon/core/state"
@@ -60,6 +62,8 @@ func (p *Progress) Log(rs *state.State22, rws state.TxTaskQueue, count, inputBlo
 		"result queue", rws.Len(),
 		"results size", common.ByteCount(resultsSize),
 		"repeat ratio", fmt.Sprintf("%.2f%%", repeatRatio),
+		"steals", rs.StealCount(),
+		"predicted", rs.PredictedCount(),
 		"buffer", common.ByteCount(sizeEstimate),
 		"alloc", common.ByteCount(m.Alloc), "sys", common.ByteCount(m.Sys),
 	)
@@ -70,7 +74,7 @@ func (p *Progress) Log(rs *state.State22, rws state.TxTaskQueue, count, inputBlo
 }
 
 func Exec22(ctx context.Context,
-	execStage *StageState, workerCount int, chainDb kv.RwDB, applyTx kv.RwTx,
+	execStage *StageState, workerCount int, memoryBudget datasize.ByteSize, chainDb kv.RwDB, applyTx kv.RwTx,
 	rs *state.State22, blockReader services.FullBlockReader,
 	allSnapshots *snapshotsync.RoSnapshots, txNums *exec22.TxNums,
 	logger log.Logger, agg *state2.Aggregator22, engine consensus.Engine,
@@ -93,18 +97,44 @@ func Exec22(ctx context.Context,
 	parallel := workerCount > 1
 	queueSize := workerCount * 4
 	var wg sync.WaitGroup
+	if parallel {
+		rs.EnableWorkStealing(workerCount)
+	}
 	reconWorkers, resultCh, clear := exec22.NewWorkersPool(lock.RLocker(), parallel, chainDb, &wg, rs, blockReader, allSnapshots, txNums, chainConfig, logger, genesis, engine, workerCount)
 	defer clear()
 	if !parallel {
 		reconWorkers[0].ResetTx(applyTx)
 		agg.SetTx(applyTx)
 	}
-	commitThreshold := uint64(1024 * 1024 * 1024)
-	resultsThreshold := int64(1024 * 1024 * 1024)
+	if parallel && debug.Exec22RecordLog() != "" {
+		recorder, recErr := state.NewReplayRecorder(debug.Exec22RecordLog())
+		if recErr != nil {
+			return recErr
+		}
+		defer func() {
+			if closeErr := recorder.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+		rs.SetReplayRecorder(recorder)
+	}
+	if debug.Exec22RWSetsLog() != "" {
+		rwSetRecorder, recErr := state.NewRWSetRecorder(debug.Exec22RWSetsLog())
+		if recErr != nil {
+			return recErr
+		}
+		defer func() {
+			if closeErr := rwSetRecorder.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+		rs.SetRWSetRecorder(rwSetRecorder)
+	}
 	count := uint64(0)
 	repeatCount := uint64(0)
 	triggerCount := uint64(0)
 	resultsSize := int64(0)
+	memory := newExecMemory(memoryBudget.Bytes(), &resultsSize, rs)
 	progress := NewProgress(block)
 	logEvery := time.NewTicker(logInterval)
 	defer logEvery.Stop()
@@ -121,6 +151,7 @@ func Exec22(ctx context.Context,
 	// Go-routine gathering results from the workers
 	var maxTxNum = txNums.MaxOf(txNums.LastBlockNum())
 	if parallel {
+		concurrency := newConcurrencyController(workerCount)
 		go func() {
 			applyTx, err := chainDb.BeginRw(ctx)
 			if err != nil {
@@ -129,6 +160,70 @@ func Exec22(ctx context.Context,
 			defer applyTx.Rollback()
 			agg.SetTx(applyTx)
 			defer rs.Finish()
+			// Applies all results which can be applied, rolls back the rest, and flushes the buffered changes
+			commit := func() {
+				commitStart := time.Now()
+				log.Info("Committing...")
+				err := func() error {
+					rwsLock.Lock()
+					defer rwsLock.Unlock()
+					// Drain results (and process) channel because read sets do not carry over
+					for {
+						var drained bool
+						for !drained {
+							select {
+							case txTask := <-resultCh:
+								atomic.AddInt64(&resultsSize, txTask.ResultsSize)
+								heap.Push(&rws, txTask)
+							default:
+								drained = true
+							}
+						}
+						processResultQueue(&rws, &outputTxNum, rs, agg, applyTx, &triggerCount, &outputBlockNum, &repeatCount, &resultsSize)
+						if rws.Len() == 0 {
+							break
+						}
+					}
+					rwsReceiveCond.Signal()
+					lock.Lock() // This is to prevent workers from starting work on any new txTask
+					defer lock.Unlock()
+					// Drain results channel because read sets do not carry over
+					var drained bool
+					for !drained {
+						select {
+						case txTask := <-resultCh:
+							rs.RollbackTx(txTask)
+						default:
+							drained = true
+						}
+					}
+
+					// Drain results queue as well
+					for rws.Len() > 0 {
+						txTask := heap.Pop(&rws).(*state.TxTask)
+						atomic.AddInt64(&resultsSize, -txTask.ResultsSize)
+						rs.RollbackTx(txTask)
+					}
+					if err := rs.Flush(applyTx); err != nil {
+						return err
+					}
+					if err = applyTx.Commit(); err != nil {
+						return err
+					}
+					for i := 0; i < len(reconWorkers); i++ {
+						reconWorkers[i].ResetTx(nil)
+					}
+					if applyTx, err = chainDb.BeginRw(ctx); err != nil {
+						return err
+					}
+					agg.SetTx(applyTx)
+					return nil
+				}()
+				if err != nil {
+					panic(err)
+				}
+				log.Info("Committed", "time", time.Since(commitStart))
+			}
 			for atomic.LoadUint64(&outputTxNum) < atomic.LoadUint64(&maxTxNum) {
 				select {
 				case txTask := <-resultCh:
@@ -143,70 +238,17 @@ func Exec22(ctx context.Context,
 					}()
 				case <-logEvery.C:
 					progress.Log(rs, rws, rs.DoneCount(), inputBlockNum, outputBlockNum, repeatCount, uint64(atomic.LoadInt64(&resultsSize)))
-					sizeEstimate := rs.SizeEstimate()
-					//prevTriggerCount = triggerCount
-					if sizeEstimate >= commitThreshold {
-						commitStart := time.Now()
-						log.Info("Committing...")
-						err := func() error {
-							rwsLock.Lock()
-							defer rwsLock.Unlock()
-							// Drain results (and process) channel because read sets do not carry over
-							for {
-								var drained bool
-								for !drained {
-									select {
-									case txTask := <-resultCh:
-										atomic.AddInt64(&resultsSize, txTask.ResultsSize)
-										heap.Push(&rws, txTask)
-									default:
-										drained = true
-									}
-								}
-								processResultQueue(&rws, &outputTxNum, rs, agg, applyTx, &triggerCount, &outputBlockNum, &repeatCount, &resultsSize)
-								if rws.Len() == 0 {
-									break
-								}
-							}
-							rwsReceiveCond.Signal()
-							lock.Lock() // This is to prevent workers from starting work on any new txTask
-							defer lock.Unlock()
-							// Drain results channel because read sets do not carry over
-							var drained bool
-							for !drained {
-								select {
-								case txTask := <-resultCh:
-									rs.AddWork(txTask)
-								default:
-									drained = true
-								}
-							}
-
-							// Drain results queue as well
-							for rws.Len() > 0 {
-								txTask := heap.Pop(&rws).(*state.TxTask)
-								atomic.AddInt64(&resultsSize, -txTask.ResultsSize)
-								rs.AddWork(txTask)
-							}
-							if err := rs.Flush(applyTx); err != nil {
-								return err
-							}
-							if err = applyTx.Commit(); err != nil {
-								return err
-							}
-							for i := 0; i < len(reconWorkers); i++ {
-								reconWorkers[i].ResetTx(nil)
-							}
-							if applyTx, err = chainDb.BeginRw(ctx); err != nil {
-								return err
-							}
-							agg.SetTx(applyTx)
-							return nil
-						}()
-						if err != nil {
-							panic(err)
-						}
-						log.Info("Committed", "time", time.Since(commitStart))
+					if prev, next := concurrency.current, concurrency.adjust(rs.DoneCount(), repeatCount); next != prev {
+						log.Info("Adjusted concurrency to the rate of rollbacks", "from", prev, "to", next)
+						rs.SetConcurrency(next)
+					}
+					if memory.flushNeeded() {
+						commit()
+					}
+				case <-memory.flushCh:
+					// Requested by the input when the memory budget is exceeded, unless flushed already on log tick
+					if memory.flushNeeded() {
+						commit()
 					}
 				}
 			}
@@ -219,7 +261,17 @@ func Exec22(ctx context.Context,
 	if block > 0 {
 		inputTxNum = txNums.MaxOf(block - 1)
 	}
+	if replayLog := debug.Exec22ReplayLog(); replayLog != "" && !parallel {
+		if stageProgress, err = replayExec22(ctx, replayLog, applyTx, rs, reconWorkers[0], blockReader, agg, chainConfig, block, inputTxNum, maxBlockNum); err != nil {
+			return err
+		}
+		if err = rs.Flush(applyTx); err != nil {
+			return err
+		}
+		return execStage.Update(applyTx, stageProgress)
+	}
 
+	senders := exec22.NewSendersRecoverer(chainConfig, workerCount)
 	var header *types.Header
 	var blockNum uint64
 loop:
@@ -234,6 +286,10 @@ loop:
 		if err != nil {
 			return err
 		}
+		// Senders are needed before scheduling, see State22.RegisterDependencies
+		if err = senders.RecoverBlock(b); err != nil {
+			return err
+		}
 		txs := b.Transactions()
 		for txIndex := -1; txIndex <= len(txs); txIndex++ {
 			// Do not oversend, wait for the result heap to go under certain size
@@ -241,7 +297,10 @@ loop:
 				func() {
 					rwsLock.Lock()
 					defer rwsLock.Unlock()
-					for rws.Len() > queueSize || atomic.LoadInt64(&resultsSize) >= resultsThreshold || rs.SizeEstimate() >= commitThreshold {
+					for rws.Len() > queueSize || memory.exceeded() {
+						if memory.flushNeeded() {
+							memory.requestFlush()
+						}
 						rwsReceiveCond.Wait()
 					}
 				}()
@@ -262,12 +321,12 @@ loop:
 					txTask.Sender = &sender
 				}
 				if parallel {
-					if ok := rs.RegisterSender(txTask); ok {
-						rs.AddWork(txTask)
+					if ok := rs.RegisterDependencies(txTask); ok {
+						rs.AddLocalWork(txTask)
 					}
 				}
 			} else if parallel {
-				rs.AddWork(txTask)
+				rs.AddLocalWork(txTask)
 			}
 			if !parallel {
 				count++
@@ -287,9 +346,7 @@ loop:
 				select {
 				case <-logEvery.C:
 					progress.Log(rs, rws, count, inputBlockNum, outputBlockNum, repeatCount, uint64(atomic.LoadInt64(&resultsSize)))
-					sizeEstimate := rs.SizeEstimate()
-					//prevTriggerCount = triggerCount
-					if sizeEstimate >= commitThreshold {
+					if memory.flushNeeded() {
 						commitStart := time.Now()
 						log.Info("Committing...")
 						if err := rs.Flush(applyTx); err != nil {
@@ -354,7 +411,9 @@ func processResultQueue(rws *state.TxTaskQueue, outputTxNum *uint64, rs *state.S
 	for rws.Len() > 0 && (*rws)[0].TxNum == *outputTxNum {
 		txTask := heap.Pop(rws).(*state.TxTask)
 		atomic.AddInt64(resultsSize, -txTask.ResultsSize)
+		validStart := time.Now()
 		if txTask.Error == nil && rs.ReadsValid(txTask.ReadLists) {
+			state.TimeExecPhase(state.PhaseConflict, validStart)
 			if err := rs.Apply(txTask.Rules.IsSpuriousDragon, applyTx, txTask, agg); err != nil {
 				panic(fmt.Errorf("State22.Apply: %w", err))
 			}
@@ -363,7 +422,8 @@ func processResultQueue(rws *state.TxTaskQueue, outputTxNum *uint64, rs *state.S
 			atomic.StoreUint64(outputBlockNum, txTask.BlockNum)
 			//fmt.Printf("Applied %d block %d txIndex %d\n", txTask.TxNum, txTask.BlockNum, txTask.TxIndex)
 		} else {
-			rs.AddWork(txTask)
+			rs.RollbackTx(txTask)
+			state.TimeExecPhase(state.PhaseConflict, validStart)
 			*repeatCount++
 			//fmt.Printf("Rolled back %d block %d txIndex %d\n", txTask.TxNum, txTask.BlockNum, txTask.TxIndex)
 		}
@@ -0,0 +1,39 @@
+package stagedsync
+
+const (
+	// concurrencyShrinkRatio is the share of rolled back transactions, since the previous adjustment, above which
+	// the number of concurrently executed transactions is halved
+	concurrencyShrinkRatio = 0.2
+	// concurrencyGrowRatio is the share of rolled back transactions below which concurrency is increased by one
+	concurrencyGrowRatio = 0.05
+)
+
+// concurrencyController adjusts the number of transactions executed at the same time by exec22 workers
+// to the rate of rollbacks: conflicts are more likely when more transactions run ahead of the ones being
+// applied, so it backs off quickly (halving) when they are frequent, and recovers slowly (by one) when they are not
+type concurrencyController struct {
+	max             int
+	current         int
+	prevDoneCount   uint64
+	prevRepeatCount uint64
+}
+
+func newConcurrencyController(max int) *concurrencyController {
+	return &concurrencyController{max: max, current: max}
+}
+
+// adjust returns the new concurrency, given total numbers of done and rolled back transactions so far
+func (c *concurrencyController) adjust(doneCount, repeatCount uint64) int {
+	done, repeated := doneCount-c.prevDoneCount, repeatCount-c.prevRepeatCount
+	c.prevDoneCount, c.prevRepeatCount = doneCount, repeatCount
+	if done == 0 {
+		return c.current
+	}
+	switch ratio := float64(repeated) / float64(done); {
+	case ratio > concurrencyShrinkRatio && c.current > 1:
+		c.current /= 2
+	case ratio < concurrencyGrowRatio && c.current < c.max:
+		c.current++
+	}
+	return c.current
+}
@@ -0,0 +1,24 @@
+package stagedsync
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrencyController(t *testing.T) {
+	c := newConcurrencyController(8)
+	// 30% of transactions rolled back
+	require.Equal(t, 4, c.adjust(100, 30))
+	require.Equal(t, 2, c.adjust(200, 60))
+	// Nothing done since the last adjustment
+	require.Equal(t, 2, c.adjust(200, 60))
+	// Between the thresholds
+	require.Equal(t, 2, c.adjust(300, 70))
+	// Conflicts subside
+	require.Equal(t, 3, c.adjust(400, 71))
+	for i := uint64(0); i < 10; i++ {
+		c.adjust(500+100*i, 71)
+	}
+	require.Equal(t, 8, c.current)
+}
@@ -0,0 +1,44 @@
+package stagedsync
+
+import (
+	"sync/atomic"
+
+	"github.com/ledgerwatch/erigon/core/state"
+)
+
+// execMemory accounts the memory used by parallel execution: the results of the transactions executed by the workers,
+// waiting to be applied in the order of txNum, and the changes applied to State22, buffered until they are flushed.
+// They grow independently of each other, so they share a single budget: when it is exceeded, the input stops
+// scheduling transactions until the results are applied, or (if the buffer takes most of the budget) the changes
+// are flushed
+type execMemory struct {
+	budget      uint64
+	resultsSize *int64
+	rs          *state.State22
+	flushCh     chan struct{} // requests to flush without waiting for the next log tick
+}
+
+func newExecMemory(budget uint64, resultsSize *int64, rs *state.State22) *execMemory {
+	return &execMemory{budget: budget, resultsSize: resultsSize, rs: rs, flushCh: make(chan struct{}, 1)}
+}
+
+func (m *execMemory) used() uint64 {
+	return uint64(atomic.LoadInt64(m.resultsSize)) + m.rs.SizeEstimate()
+}
+
+func (m *execMemory) exceeded() bool {
+	return m.used() >= m.budget
+}
+
+// flushNeeded returns true if the buffered changes take at least half of the budget
+func (m *execMemory) flushNeeded() bool {
+	return m.rs.SizeEstimate() >= m.budget/2
+}
+
+// requestFlush does not block, requests made while the previous one is pending are merged with it
+func (m *execMemory) requestFlush() {
+	select {
+	case m.flushCh <- struct{}{}:
+	default:
+	}
+}
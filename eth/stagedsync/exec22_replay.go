@@ -0,0 +1,147 @@
+package stagedsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	state2 "github.com/ledgerwatch/erigon-lib/state"
+	"github.com/ledgerwatch/erigon/cmd/state/exec22"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/turbo/services"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// replayTxTasks produces transaction tasks in the order of txNum, like the input loop of Exec22, and keeps them
+// until they are applied, so that they can be looked up by txNum in any order close to it
+type replayTxTasks struct {
+	ctx         context.Context
+	tx          kv.Tx
+	blockReader services.FullBlockReader
+	chainConfig *params.ChainConfig
+	senders     *exec22.SendersRecoverer
+	blockNum    uint64 // next block to produce tasks for
+	maxBlockNum uint64
+	txNum       uint64 // txNum of the next task to produce
+	pending     map[uint64]*state.TxTask
+}
+
+func (r *replayTxTasks) get(txNum uint64) (*state.TxTask, error) {
+	for {
+		if txTask, ok := r.pending[txNum]; ok {
+			return txTask, nil
+		}
+		if txNum < r.txNum || r.blockNum > r.maxBlockNum {
+			return nil, fmt.Errorf("txNum %d is not in the range of blocks being executed, or has been applied already", txNum)
+		}
+		header, err := r.blockReader.HeaderByNumber(r.ctx, r.tx, r.blockNum)
+		if err != nil {
+			return nil, err
+		}
+		blockHash := header.Hash()
+		b, _, err := r.blockReader.BlockWithSenders(r.ctx, r.tx, blockHash, r.blockNum)
+		if err != nil {
+			return nil, err
+		}
+		if err = r.senders.RecoverBlock(b); err != nil {
+			return nil, err
+		}
+		rules := r.chainConfig.Rules(r.blockNum)
+		txs := b.Transactions()
+		for txIndex := -1; txIndex <= len(txs); txIndex++ {
+			txTask := &state.TxTask{
+				Header:    header,
+				BlockNum:  r.blockNum,
+				Rules:     rules,
+				Block:     b,
+				TxNum:     r.txNum,
+				TxIndex:   txIndex,
+				BlockHash: blockHash,
+				Final:     txIndex == len(txs),
+			}
+			if txIndex >= 0 && txIndex < len(txs) {
+				txTask.Tx = txs[txIndex]
+				if sender, ok := txs[txIndex].GetSender(); ok {
+					txTask.Sender = &sender
+				}
+			}
+			r.pending[r.txNum] = txTask
+			r.txNum++
+		}
+		r.blockNum++
+	}
+}
+
+// replayExec22 re-executes transactions serially, following the log recorded by parallel execution: each transaction
+// is executed when it was scheduled, so that it sees the state applied up to that moment, and its result is
+// discarded or applied when it was rolled back or applied. Returns error if a transaction recorded as applied has
+// invalid reads in the replay, i.e. the replay has diverged from the recorded execution.
+// The interleaving is reproduced at the granularity of scheduling: applies happening while a transaction was being
+// executed by the recorded run are seen in the replay only if they happened before it was scheduled
+func replayExec22(ctx context.Context, logFile string, applyTx kv.RwTx, rs *state.State22, worker *exec22.Worker22,
+	blockReader services.FullBlockReader, agg *state2.Aggregator22, chainConfig *params.ChainConfig,
+	block, inputTxNum, maxBlockNum uint64,
+) (stageProgress uint64, err error) {
+	replayLog, err := state.OpenReplayLog(logFile)
+	if err != nil {
+		return 0, err
+	}
+	defer replayLog.Close()
+	txTasks := &replayTxTasks{
+		ctx:         ctx,
+		tx:          applyTx,
+		blockReader: blockReader,
+		chainConfig: chainConfig,
+		senders:     exec22.NewSendersRecoverer(chainConfig, 1),
+		blockNum:    block,
+		maxBlockNum: maxBlockNum,
+		txNum:       inputTxNum,
+		pending:     map[uint64]*state.TxTask{},
+	}
+	if block > 0 {
+		stageProgress = block - 1
+	}
+	var events, rollbacks uint64
+	for {
+		event, err := replayLog.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return stageProgress, fmt.Errorf("reading replay log after %d events: %w", events, err)
+		}
+		events++
+		txTask, err := txTasks.get(event.TxNum)
+		if err != nil {
+			return stageProgress, fmt.Errorf("event %d (%s): %w", events, event.Kind, err)
+		}
+		switch event.Kind {
+		case state.ReplayScheduled:
+			worker.RunTxTask(txTask)
+		case state.ReplayRolledBack:
+			rollbacks++
+		case state.ReplayApplied:
+			if txTask.Error != nil {
+				return stageProgress, fmt.Errorf("replay diverged at event %d: txNum %d block %d txIndex %d failed: %w", events, txTask.TxNum, txTask.BlockNum, txTask.TxIndex, txTask.Error)
+			}
+			if !rs.ReadsValid(txTask.ReadLists) {
+				return stageProgress, fmt.Errorf("replay diverged at event %d: txNum %d block %d txIndex %d has invalid reads", events, txTask.TxNum, txTask.BlockNum, txTask.TxIndex)
+			}
+			if err = rs.Apply(txTask.Rules.IsSpuriousDragon, applyTx, txTask, agg); err != nil {
+				return stageProgress, fmt.Errorf("State22.Apply: %w", err)
+			}
+			rs.CommitTxNum(txTask.Sender, txTask.TxNum)
+			delete(txTasks.pending, txTask.TxNum)
+			if txTask.Final {
+				stageProgress = txTask.BlockNum
+			}
+		default:
+			return stageProgress, fmt.Errorf("unknown event %d in replay log", event.Kind)
+		}
+	}
+	log.Info("Replayed parallel execution", "events", events, "rollbacks", rollbacks, "applied up to block", stageProgress)
+	return stageProgress, nil
+}
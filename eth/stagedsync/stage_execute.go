@@ -24,6 +24,7 @@ import (
 	ecom "github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/common/changeset"
 	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/common/debug"
 	"github.com/ledgerwatch/erigon/common/math"
 	"github.com/ledgerwatch/erigon/consensus"
 	"github.com/ledgerwatch/erigon/core"
@@ -77,9 +78,11 @@ type ExecuteBlockCfg struct {
 	dirs         datadir.Dirs
 	exec22       bool
 	workersCount int
+	memoryBudget datasize.ByteSize // shared by the results of the workers and the buffered changes, in exec22
 	genesis      *core.Genesis
 	agg          *libstate.Aggregator22
 	txNums       *exec22.TxNums
+	blockRetire  *snapshotsync.BlockRetire // retires receipts of executed blocks into snapshots, if set
 }
 
 func StageExecuteBlocksCfg(
@@ -100,8 +103,10 @@ func StageExecuteBlocksCfg(
 	hd *headerdownload.HeaderDownload,
 	genesis *core.Genesis,
 	workersCount int,
+	memoryBudget datasize.ByteSize,
 	txNums *exec22.TxNums,
 	agg *libstate.Aggregator22,
+	blockRetire *snapshotsync.BlockRetire,
 ) ExecuteBlockCfg {
 	return ExecuteBlockCfg{
 		db:            db,
@@ -120,8 +125,10 @@ func StageExecuteBlocksCfg(
 		genesis:       genesis,
 		exec22:        exec22,
 		workersCount:  workersCount,
+		memoryBudget:  memoryBudget,
 		txNums:        txNums,
 		agg:           agg,
+		blockRetire:   blockRetire,
 	}
 }
 
@@ -137,9 +144,10 @@ func executeBlock(
 	contractHasTEVM func(contractHash commonold.Hash) (bool, error),
 	initialCycle bool,
 	effectiveEngine consensus.Engine,
+	changeSets *state.ChangeSetBuffer,
 ) error {
 	blockNum := block.NumberU64()
-	stateReader, stateWriter, err := newStateReaderWriter(batch, tx, block, writeChangesets, cfg.accumulator, initialCycle, cfg.stateStream)
+	stateReader, stateWriter, err := newStateReaderWriter(batch, tx, block, writeChangesets, cfg.accumulator, initialCycle, cfg.stateStream, changeSets)
 	if err != nil {
 		return err
 	}
@@ -206,6 +214,7 @@ func newStateReaderWriter(
 	accumulator *shards.Accumulator,
 	initialCycle bool,
 	stateStream bool,
+	changeSets *state.ChangeSetBuffer,
 ) (state.StateReader, state.WriterWithChangeSets, error) {
 
 	var stateReader state.StateReader
@@ -223,7 +232,7 @@ func newStateReaderWriter(
 		accumulator = nil
 	}
 	if writeChangesets {
-		stateWriter = state.NewPlainStateWriter(batch, tx, block.NumberU64()).SetAccumulator(accumulator)
+		stateWriter = state.NewPlainStateWriter(batch, tx, block.NumberU64()).SetAccumulator(accumulator).SetChangeSetBuffer(changeSets)
 	} else {
 		stateWriter = state.NewPlainStateWriterNoHistory(batch).SetAccumulator(accumulator)
 	}
@@ -244,7 +253,8 @@ func ExecBlock22(s *StageState, u Unwinder, tx kv.RwTx, toBlock uint64, ctx cont
 	ctx = context.Background()
 
 	workersCount := cfg.workersCount
-	if !initialCycle {
+	if !initialCycle || debug.Exec22ReplayLog() != "" {
+		// Replay of the recorded parallel execution is serial
 		workersCount = 1
 	}
 	useExternalTx := tx != nil
@@ -276,7 +286,7 @@ func ExecBlock22(s *StageState, u Unwinder, tx kv.RwTx, toBlock uint64, ctx cont
 
 	rs := state.NewState22()
 
-	if err := Exec22(execCtx, s, workersCount, cfg.db, tx, rs,
+	if err := Exec22(execCtx, s, workersCount, cfg.memoryBudget, cfg.db, tx, rs,
 		cfg.blockReader, allSnapshots, cfg.txNums, log.New(), cfg.agg, cfg.engine,
 		to,
 		cfg.chainConfig, cfg.genesis, initialCycle); err != nil {
@@ -426,6 +436,13 @@ func SpawnExecuteBlocksStage(s *StageState, u Unwinder, tx kv.RwTx, toBlock uint
 		asyncEngine = asyncEngine.WithExecutionContext(ctx)
 		effectiveEngine = asyncEngine.(consensus.Engine)
 	}
+	var prefetcher *statePrefetcher
+	if debug.PrefetchState() && cfg.db != nil {
+		prefetcher = startStatePrefetcher(ctx, logPrefix, cfg.db, cfg.blockReader, stageProgress+1, to)
+		defer prefetcher.Close()
+	}
+	// changesets are appended to the tables when the state batch is committed
+	changeSets := state.NewChangeSetBuffer()
 Loop:
 	for blockNum := stageProgress + 1; blockNum <= to; blockNum++ {
 		if stoppedErr = common.Stopped(quit); stoppedErr != nil {
@@ -457,7 +474,7 @@ Loop:
 		writeChangeSets := nextStagesExpectData || blockNum > cfg.prune.History.PruneTo(to)
 		writeReceipts := nextStagesExpectData || blockNum > cfg.prune.Receipts.PruneTo(to)
 		writeCallTraces := nextStagesExpectData || blockNum > cfg.prune.CallTraces.PruneTo(to)
-		if err = executeBlock(block, tx, batch, cfg, *cfg.vmConfig, writeChangeSets, writeReceipts, writeCallTraces, contractHasTEVM, initialCycle, effectiveEngine); err != nil {
+		if err = executeBlock(block, tx, batch, cfg, *cfg.vmConfig, writeChangeSets, writeReceipts, writeCallTraces, contractHasTEVM, initialCycle, effectiveEngine, changeSets); err != nil {
 			if !errors.Is(err, context.Canceled) {
 				log.Warn(fmt.Sprintf("[%s] Execution failed", logPrefix), "block", blockNum, "hash", block.Hash().String(), "err", err)
 				if cfg.hd != nil {
@@ -471,10 +488,16 @@ Loop:
 			break Loop
 		}
 		stageProgress = blockNum
+		if prefetcher != nil {
+			prefetcher.Executed(blockNum)
+		}
 
 		if currentStateGas >= gasState {
 			log.Info("Committed State", "gas reached", currentStateGas, "gasTarget", gasState)
 			currentStateGas = 0
+			if err = changeSets.Flush(tx); err != nil {
+				return err
+			}
 			if err = batch.Commit(); err != nil {
 				return err
 			}
@@ -520,6 +543,9 @@ Loop:
 		}
 	}
 
+	if err = changeSets.Flush(tx); err != nil {
+		return fmt.Errorf("changesets flush: %w", err)
+	}
 	if err = s.Update(batch, stageProgress); err != nil {
 		return err
 	}
@@ -765,6 +791,15 @@ func PruneExecutionStage(s *PruneState, tx kv.RwTx, cfg ExecuteBlockCfg, ctx con
 		}
 	}
 
+	if cfg.blockRetire != nil && cfg.blockRetire.Snapshots() != nil && cfg.blockRetire.Snapshots().Cfg().Enabled {
+		// Before the receipts are pruned
+		if err = retireReceiptsInSingleBackgroundThread(s, cfg, ctx, tx); err != nil {
+			return fmt.Errorf("retireReceiptsInSingleBackgroundThread: %w", err)
+		}
+		if err = pruneRetiredReceipts(tx, cfg, ctx); err != nil {
+			return fmt.Errorf("pruneRetiredReceipts: %w", err)
+		}
+	}
 	if cfg.prune.Receipts.Enabled() {
 		if err = rawdb.PruneTable(tx, kv.Receipts, cfg.prune.Receipts.PruneTo(s.ForwardProgress), ctx, math.MaxInt32); err != nil {
 			return err
@@ -790,3 +825,41 @@ func PruneExecutionStage(s *PruneState, tx kv.RwTx, cfg ExecuteBlockCfg, ctx con
 	}
 	return nil
 }
+
+func retireReceiptsInSingleBackgroundThread(s *PruneState, cfg ExecuteBlockCfg, ctx context.Context, tx kv.RwTx) error {
+	// if something already happens in background - noop
+	if cfg.blockRetire.ReceiptsWorking() {
+		return nil
+	}
+	if res := cfg.blockRetire.ReceiptsResult(); res != nil && res.Err != nil {
+		// receipts stay in the db - the sync goes on
+		log.Warn(fmt.Sprintf("[%s] retire receipts", s.LogPrefix()), "err", res.Err, "fromBlock", res.BlockFrom, "toBlock", res.BlockTo)
+	}
+	receiptsAvailableFrom, err := rawdb.ReceiptsAvailableFrom(tx)
+	if err != nil {
+		return err
+	}
+	cfg.blockRetire.RetireReceiptsInBackground(ctx, s.ForwardProgress, receiptsAvailableFrom, log.LvlInfo)
+	return nil
+}
+
+// pruneRetiredReceipts - receipts and logs of the blocks in the receipts segments are read from the segments. The log
+// indices are kept, so that eth_getLogs still finds the blocks. Logs which LogIndex has not indexed yet stay in the db
+func pruneRetiredReceipts(tx kv.RwTx, cfg ExecuteBlockCfg, ctx context.Context) error {
+	receiptsAvailable := cfg.blockRetire.Snapshots().ReceiptsAvailable()
+	if receiptsAvailable == 0 {
+		return nil
+	}
+	logIndexProgress, err := stages.GetStageProgress(tx, stages.LogIndex)
+	if err != nil {
+		return err
+	}
+	pruneTo := receiptsAvailable + 1
+	if logIndexProgress+1 < pruneTo {
+		pruneTo = logIndexProgress + 1
+	}
+	if err = rawdb.PruneTable(tx, kv.Receipts, pruneTo, ctx, math.MaxInt32); err != nil {
+		return err
+	}
+	return rawdb.PruneTable(tx, kv.Log, pruneTo, ctx, math.MaxInt32)
+}
@@ -0,0 +1,166 @@
+package stagedsync
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/common/length"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/debug"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/turbo/services"
+	"github.com/ledgerwatch/log/v3"
+)
+
+const (
+	prefetchAhead    = 16   // blocks to prefetch ahead of execution
+	prefetchTxBlocks = 1024 // blocks to prefetch in one read-only transaction, to not hold the pages freed by commits
+)
+
+// statePrefetcher reads the accounts and storage slots referenced by the blocks ahead of the execution - senders,
+// recipients, access lists, and call traces if the block has been executed before - and discards them. It reads
+// through a separate read-only transaction, which does not see the changes of the execution not committed yet, so
+// the values may be stale, but the pages of the plain state get into the page cache, and the reads of the execution
+// (through mmap) do not wait for the disk
+type statePrefetcher struct {
+	logPrefix   string
+	db          kv.RoDB
+	blockReader services.FullBlockReader
+	executed    chan uint64 // the latest executed block, the older values are dropped
+	cancel      context.CancelFunc
+	done        chan struct{}
+}
+
+func startStatePrefetcher(ctx context.Context, logPrefix string, db kv.RoDB, blockReader services.FullBlockReader, from, to uint64) *statePrefetcher {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &statePrefetcher{logPrefix: logPrefix, db: db, blockReader: blockReader, executed: make(chan uint64, 1), cancel: cancel, done: make(chan struct{})}
+	go p.run(ctx, from, to)
+	return p
+}
+
+// Executed does not block
+func (p *statePrefetcher) Executed(blockNum uint64) {
+	select {
+	case <-p.executed:
+	default:
+	}
+	p.executed <- blockNum
+}
+
+func (p *statePrefetcher) Close() {
+	p.cancel()
+	<-p.done
+}
+
+func (p *statePrefetcher) run(ctx context.Context, from, to uint64) {
+	defer close(p.done)
+	defer debug.LogPanic()
+	executed := from - 1
+	for blockNum := from; blockNum <= to; {
+		tx, err := p.db.BeginRo(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Warn(fmt.Sprintf("[%s] Prefetch stopped", p.logPrefix), "err", err)
+			}
+			return
+		}
+		for end := blockNum + prefetchTxBlocks; blockNum <= to && blockNum < end; blockNum++ {
+			for blockNum > executed+prefetchAhead {
+				select {
+				case <-ctx.Done():
+					tx.Rollback()
+					return
+				case executed = <-p.executed:
+				}
+				if executed >= to {
+					tx.Rollback()
+					return
+				}
+			}
+			if blockNum <= executed {
+				continue
+			}
+			if err = p.prefetchBlock(ctx, tx, blockNum); err != nil {
+				tx.Rollback()
+				if ctx.Err() == nil {
+					log.Warn(fmt.Sprintf("[%s] Prefetch stopped", p.logPrefix), "block", blockNum, "err", err)
+				}
+				return
+			}
+		}
+		tx.Rollback()
+	}
+}
+
+func (p *statePrefetcher) prefetchBlock(ctx context.Context, tx kv.Tx, blockNum uint64) error {
+	blockHash, err := rawdb.ReadCanonicalHash(tx, blockNum)
+	if err != nil {
+		return err
+	}
+	block, senders, err := p.blockReader.BlockWithSenders(ctx, tx, blockHash, blockNum)
+	if err != nil || block == nil {
+		return err // block is not committed yet
+	}
+	addresses := append([]common.Address{block.Coinbase()}, senders...)
+	slots := map[common.Address][]common.Hash{}
+	for _, txn := range block.Transactions() {
+		if to := txn.GetTo(); to != nil {
+			addresses = append(addresses, *to)
+		}
+		for _, el := range txn.GetAccessList() {
+			addresses = append(addresses, el.Address)
+			slots[el.Address] = append(slots[el.Address], el.StorageKeys...)
+		}
+	}
+	if addresses, err = appendCallTraces(tx, blockNum, addresses); err != nil {
+		return err
+	}
+
+	r := state.NewPlainStateReader(tx)
+	accs, err := r.ReadAccountsData(addresses)
+	if err != nil {
+		return err
+	}
+	incarnations := make(map[common.Address]uint64, len(addresses))
+	for i, a := range accs {
+		if a != nil {
+			incarnations[addresses[i]] = a.Incarnation
+			if !a.IsEmptyCodeHash() {
+				if _, err = r.ReadAccountCodeSize(addresses[i], a.Incarnation, a.CodeHash); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for address, keys := range slots {
+		if inc, ok := incarnations[address]; ok {
+			if _, err = r.ReadAccountStorages(address, inc, keys); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// appendCallTraces appends the addresses touched by the block, recorded in CallTraceSet if it has been executed before
+func appendCallTraces(tx kv.Tx, blockNum uint64, addresses []common.Address) ([]common.Address, error) {
+	c, err := tx.CursorDupSort(kv.CallTraceSet)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	var blockNumEnc [8]byte
+	binary.BigEndian.PutUint64(blockNumEnc[:], blockNum)
+	for k, v, err := c.SeekExact(blockNumEnc[:]); k != nil; k, v, err = c.NextDup() {
+		if err != nil {
+			return nil, err
+		}
+		if len(v) == length.Addr+1 {
+			addresses = append(addresses, common.BytesToAddress(v[:length.Addr]))
+		}
+	}
+	return addresses, nil
+}
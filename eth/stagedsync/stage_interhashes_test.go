@@ -303,3 +303,61 @@ func TestStorageDeletion(t *testing.T) {
 
 	assert.Equal(t, 0, len(storageTrieB))
 }
+
+func TestProofTrie(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+
+	hash1 := common.HexToHash("0xB000000000000000000000000000000000000000000000000000000000000000")
+	assert.Nil(t, addTestAccount(tx, hash1, 3*params.Ether, 0))
+
+	incarnation := uint64(1)
+	hash2 := common.HexToHash("0xB041000000000000000000000000000000000000000000000000000000000000")
+	assert.Nil(t, addTestAccount(tx, hash2, 2*params.Ether, incarnation))
+
+	hash3 := common.HexToHash("0xB310000000000000000000000000000000000000000000000000000000000000")
+	assert.Nil(t, addTestAccount(tx, hash3, 8*params.Ether, 0))
+
+	loc1 := common.HexToHash("0x1200000000000000000000000000000000000000000000000000000000000000")
+	loc2 := common.HexToHash("0x1400000000000000000000000000000000000000000000000000000000000000")
+	loc3 := common.HexToHash("0x3000000000000000000000000000000000000000000000000000000000E00000")
+	val1 := common.FromHex("0x42")
+	assert.Nil(t, tx.Put(kv.HashedStorage, dbutils.GenerateCompositeStorageKey(hash2, incarnation, loc1), val1))
+	assert.Nil(t, tx.Put(kv.HashedStorage, dbutils.GenerateCompositeStorageKey(hash2, incarnation, loc2), common.FromHex("0x01")))
+
+	historyV2 := false
+	blockReader := snapshotsync.NewBlockReader()
+	cfg := StageTrieCfg(nil, false, true, false, t.TempDir(), blockReader, nil, historyV2, nil, nil)
+	expectedRoot, err := RegenerateIntermediateHashes("IH", tx, cfg, common.Hash{} /* expectedRootHash */, nil /* quit */)
+	assert.Nil(t, err)
+
+	// The intermediate hashes are used for everything except the paths to the proven keys
+	rl := trie.NewRetainList(0)
+	rl.AddKey(hash2[:])
+	rl.AddKey(dbutils.GenerateCompositeStorageKey(hash2, incarnation, loc1))
+	rl.AddKey(dbutils.GenerateCompositeStorageKey(hash2, incarnation, loc3))
+	loader := trie.NewFlatDBTrieLoader("proof")
+	assert.Nil(t, loader.Reset(rl, nil, nil, false))
+	loader.SetProofRetainer(rl)
+	root, err := loader.CalcTrieRoot(tx, []byte{}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, expectedRoot, root)
+
+	tr := loader.ProofTrie()
+	assert.Equal(t, expectedRoot, tr.Hash())
+	acc, ok := tr.GetAccount(hash2[:])
+	assert.True(t, ok)
+	assert.Equal(t, uint64(2*params.Ether), acc.Balance.Uint64())
+	v, ok := tr.Get(append(common.CopyBytes(hash2[:]), loc1[:]...))
+	assert.True(t, ok)
+	assert.Equal(t, val1, v)
+	v, ok = tr.Get(append(common.CopyBytes(hash2[:]), loc3[:]...))
+	assert.True(t, ok)
+	assert.Nil(t, v)
+
+	accountProof, err := tr.Prove(hash2[:], 0, false)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, accountProof)
+	storageProof, err := tr.Prove(append(common.CopyBytes(hash2[:]), loc1[:]...), 64, true)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, storageProof)
+}
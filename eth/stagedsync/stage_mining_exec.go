@@ -35,6 +35,8 @@ type MiningExecCfg struct {
 	vmConfig    *vm.Config
 	tmpdir      string
 	interrupt   *int32
+
+	txConditions *core.TxConditionsRegistry // of the conditional transactions, nil - none
 }
 
 func StageMiningExecCfg(
@@ -46,6 +48,7 @@ func StageMiningExecCfg(
 	vmConfig *vm.Config,
 	tmpdir string,
 	interrupt *int32,
+	txConditions *core.TxConditionsRegistry,
 ) MiningExecCfg {
 	return MiningExecCfg{
 		db:          db,
@@ -57,6 +60,8 @@ func StageMiningExecCfg(
 		vmConfig:    vmConfig,
 		tmpdir:      tmpdir,
 		interrupt:   interrupt,
+
+		txConditions: txConditions,
 	}
 }
 
@@ -78,6 +83,11 @@ func SpawnMiningExecStage(s *StageState, tx kv.RwTx, cfg MiningExecCfg, quit <-c
 		misc.ApplyDAOHardFork(ibs)
 	}
 	systemcontracts.UpgradeBuildInSystemContract(&cfg.chainConfig, current.Header.Number, ibs)
+	if cfg.txConditions != nil {
+		if err := cfg.txConditions.Prune(stateReader); err != nil {
+			return err
+		}
+	}
 
 	// Create an empty block based on temporary copied state for
 	// sealing in advance without waiting block execution finished.
@@ -94,7 +104,7 @@ func SpawnMiningExecStage(s *StageState, tx kv.RwTx, cfg MiningExecCfg, quit <-c
 	// empty block is necessary to keep the liveness of the network.
 	if noempty {
 		if !localTxs.Empty() {
-			logs, err := addTransactionsToMiningBlock(logPrefix, current, cfg.chainConfig, cfg.vmConfig, getHeader, contractHasTEVM, cfg.engine, localTxs, cfg.miningState.MiningConfig.Etherbase, ibs, stateReader, quit, cfg.interrupt)
+			logs, err := addTransactionsToMiningBlock(logPrefix, current, cfg.chainConfig, cfg.vmConfig, getHeader, contractHasTEVM, cfg.engine, localTxs, cfg.miningState.MiningConfig.Etherbase, ibs, stateReader, cfg.txConditions, quit, cfg.interrupt)
 			if err != nil {
 				return err
 			}
@@ -106,7 +116,7 @@ func SpawnMiningExecStage(s *StageState, tx kv.RwTx, cfg MiningExecCfg, quit <-c
 			//}
 		}
 		if !remoteTxs.Empty() {
-			logs, err := addTransactionsToMiningBlock(logPrefix, current, cfg.chainConfig, cfg.vmConfig, getHeader, contractHasTEVM, cfg.engine, remoteTxs, cfg.miningState.MiningConfig.Etherbase, ibs, stateReader, quit, cfg.interrupt)
+			logs, err := addTransactionsToMiningBlock(logPrefix, current, cfg.chainConfig, cfg.vmConfig, getHeader, contractHasTEVM, cfg.engine, remoteTxs, cfg.miningState.MiningConfig.Etherbase, ibs, stateReader, cfg.txConditions, quit, cfg.interrupt)
 			if err != nil {
 				return err
 			}
@@ -173,7 +183,7 @@ func SpawnMiningExecStage(s *StageState, tx kv.RwTx, cfg MiningExecCfg, quit <-c
 	return nil
 }
 
-func addTransactionsToMiningBlock(logPrefix string, current *MiningBlock, chainConfig params.ChainConfig, vmConfig *vm.Config, getHeader func(hash common.Hash, number uint64) *types.Header, contractHasTEVM func(common.Hash) (bool, error), engine consensus.Engine, txs types.TransactionsStream, coinbase common.Address, ibs *state.IntraBlockState, stateReader state.StateReader, quit <-chan struct{}, interrupt *int32) (types.Logs, error) {
+func addTransactionsToMiningBlock(logPrefix string, current *MiningBlock, chainConfig params.ChainConfig, vmConfig *vm.Config, getHeader func(hash common.Hash, number uint64) *types.Header, contractHasTEVM func(common.Hash) (bool, error), engine consensus.Engine, txs types.TransactionsStream, coinbase common.Address, ibs *state.IntraBlockState, stateReader state.StateReader, txConditions *core.TxConditionsRegistry, quit <-chan struct{}, interrupt *int32) (types.Logs, error) {
 	header := current.Header
 	tcount := 0
 	gasPool := new(core.GasPool).AddGas(current.Header.GasLimit)
@@ -236,6 +246,15 @@ func addTransactionsToMiningBlock(logPrefix string, current *MiningBlock, chainC
 			continue
 		}
 
+		// Conditional transactions (eth_sendRawTransactionConditional) are checked on the state before them
+		if txConditions != nil {
+			if err = txConditions.Check(txn.Hash(), header, ibs); err != nil {
+				log.Debug(fmt.Sprintf("[%s] Skipping conditional transaction", logPrefix), "hash", txn.Hash(), "sender", from, "err", err)
+				txs.Pop()
+				continue
+			}
+		}
+
 		// Start executing the transaction
 		logs, err := miningCommitTx(txn, coinbase, vmConfig, chainConfig, ibs, current)
 
@@ -0,0 +1,359 @@
+package stagedsync
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/changeset"
+	"github.com/ledgerwatch/erigon/consensus"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/turbo/services"
+	"github.com/ledgerwatch/log/v3"
+)
+
+type OtsContractsCfg struct {
+	db          kv.RwDB
+	chainConfig *params.ChainConfig
+	engine      consensus.Engine
+	blockReader services.FullBlockReader
+}
+
+func StageOtsContractsCfg(db kv.RwDB, chainConfig *params.ChainConfig, engine consensus.Engine, blockReader services.FullBlockReader) OtsContractsCfg {
+	return OtsContractsCfg{
+		db:          db,
+		chainConfig: chainConfig,
+		engine:      engine,
+		blockReader: blockReader,
+	}
+}
+
+// SpawnOtsContracts indexes the contracts deployed by the transactions of the blocks, with their creators and the
+// attributes found by probing their code (see rawdb.OtsContractCreations). The contracts are the accounts with code
+// after the block which did not exist or had no code before it, according to the account changesets. Only the blocks
+// deploying contracts are re-executed on the historical state, to find the creators
+func SpawnOtsContracts(s *StageState, tx kv.RwTx, cfg OtsContractsCfg, ctx context.Context) (err error) {
+	useExternalTx := tx != nil
+	if !useExternalTx {
+		tx, err = cfg.db.BeginRw(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+	logPrefix := s.LogPrefix()
+
+	// The blocks are re-executed on the state read from the history
+	endBlock, err := stages.GetStageProgress(tx, stages.AccountHistoryIndex)
+	if err != nil {
+		return err
+	}
+	storageProgress, err := stages.GetStageProgress(tx, stages.StorageHistoryIndex)
+	if err != nil {
+		return err
+	}
+	if storageProgress < endBlock {
+		endBlock = storageProgress
+	}
+	if endBlock <= s.BlockNumber {
+		return nil
+	}
+
+	logEvery := time.NewTicker(logInterval)
+	defer logEvery.Stop()
+	if endBlock-s.BlockNumber > 100 {
+		log.Info(fmt.Sprintf("[%s] processing", logPrefix), "from", s.BlockNumber+1, "to", endBlock)
+	}
+	var contracts int
+	for blockNum := s.BlockNumber + 1; blockNum <= endBlock; blockNum++ {
+		if err = libcommon.Stopped(ctx.Done()); err != nil {
+			return err
+		}
+		n, err := indexBlockContracts(ctx, tx, cfg, blockNum)
+		if err != nil {
+			return fmt.Errorf("[%s] block %d: %w", logPrefix, blockNum, err)
+		}
+		contracts += n
+		select {
+		default:
+		case <-logEvery.C:
+			log.Info(fmt.Sprintf("[%s] Progress", logPrefix), "number", blockNum, "contracts", contracts)
+		}
+	}
+	if err = s.Update(tx, endBlock); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexBlockContracts adds the contracts deployed by the block to the index, returns their number
+func indexBlockContracts(ctx context.Context, tx kv.RwTx, cfg OtsContractsCfg, blockNum uint64) (int, error) {
+	// Accounts which did not exist or had no code before the block
+	var candidates []common.Address
+	if err := changeset.ForRange(tx, kv.AccountChangeSet, blockNum, blockNum+1, func(_ uint64, k, v []byte) error {
+		if len(v) > 0 {
+			var acc accounts.Account
+			if err := acc.DecodeForStorage(v); err != nil {
+				return err
+			}
+			if !acc.IsEmptyCodeHash() {
+				return nil
+			}
+		}
+		candidates = append(candidates, common.BytesToAddress(k))
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	if len(candidates) == 0 {
+		return 0, nil
+	}
+	after := state.NewPlainState(tx, blockNum+1)
+	codes := map[common.Address][]byte{}
+	for _, addr := range candidates {
+		acc, err := after.ReadAccountData(addr)
+		if err != nil {
+			return 0, err
+		}
+		if acc == nil || acc.IsEmptyCodeHash() {
+			continue
+		}
+		code, err := after.ReadAccountCode(addr, acc.Incarnation, acc.CodeHash)
+		if err != nil {
+			return 0, err
+		}
+		codes[addr] = code
+	}
+	if len(codes) == 0 {
+		return 0, nil
+	}
+
+	blockHash, err := rawdb.ReadCanonicalHash(tx, blockNum)
+	if err != nil {
+		return 0, err
+	}
+	block, _, err := cfg.blockReader.BlockWithSenders(ctx, tx, blockHash, blockNum)
+	if err != nil {
+		return 0, err
+	}
+	if block == nil {
+		return 0, fmt.Errorf("block %d(%x) not found", blockNum, blockHash)
+	}
+	creations, err := blockContractCreations(ctx, tx, cfg, block)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, c := range creations {
+		code, ok := codes[c.contract]
+		if !ok {
+			// Reverted, self-destructed in the same block, or already indexed
+			continue
+		}
+		delete(codes, c.contract)
+		if err = rawdb.WriteContractCreation(tx, c.contract, rawdb.ContractCreation{Creator: c.creator, Hash: block.Transactions()[c.txIndex].Hash(), BlockNumber: blockNum}); err != nil {
+			return 0, err
+		}
+		entry := rawdb.ContractListEntry{Address: c.contract, BlockNumber: blockNum}
+		if err = rawdb.AppendContractList(tx, rawdb.OtsAllContracts, entry); err != nil {
+			return 0, err
+		}
+		attrs := ProbeContractAttributes(code)
+		if attrs&rawdb.AttrERC20 != 0 {
+			if err = rawdb.AppendContractList(tx, rawdb.OtsERC20, entry); err != nil {
+				return 0, err
+			}
+		}
+		if attrs&rawdb.AttrERC721 != 0 {
+			if err = rawdb.AppendContractList(tx, rawdb.OtsERC721, entry); err != nil {
+				return 0, err
+			}
+		}
+		if attrs != 0 {
+			if err = rawdb.WriteAddressAttributes(tx, c.contract, attrs); err != nil {
+				return 0, err
+			}
+		}
+		n++
+	}
+	// Contracts not deployed by the transactions, for example by the consensus engine, are not indexed
+	return n, nil
+}
+
+type contractCreation struct {
+	contract common.Address
+	creator  common.Address
+	txIndex  int
+}
+
+// blockContractCreations re-executes the transactions of the block and returns the contract creations they attempted,
+// in the order of execution
+func blockContractCreations(ctx context.Context, tx kv.Tx, cfg OtsContractsCfg, block *types.Block) ([]contractCreation, error) {
+	reader := state.NewPlainState(tx, block.NumberU64())
+	ibs := state.New(reader)
+	getHeader := func(hash common.Hash, number uint64) *types.Header {
+		h, _ := cfg.blockReader.Header(ctx, tx, hash, number)
+		return h
+	}
+	header := block.Header()
+	blockCtx := core.NewEVMBlockContext(header, core.GetHashFn(header, getHeader), cfg.engine, nil, nil)
+	signer := types.MakeSigner(cfg.chainConfig, block.NumberU64())
+	rules := cfg.chainConfig.Rules(block.NumberU64())
+	tracer := &creationTracer{}
+	for idx, txn := range block.Transactions() {
+		ibs.Prepare(txn.Hash(), block.Hash(), idx)
+		msg, err := txn.AsMessage(*signer, block.BaseFee(), rules)
+		if err != nil {
+			return nil, err
+		}
+		tracer.txIndex = idx
+		evm := vm.NewEVM(blockCtx, core.NewEVMTxContext(msg), ibs, cfg.chainConfig, vm.Config{Debug: true, Tracer: tracer})
+		if _, err = core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(msg.Gas()), true /* refunds */, false /* gasBailout */); err != nil {
+			return nil, fmt.Errorf("transaction %x failed: %w", txn.Hash(), err)
+		}
+		_ = ibs.FinalizeTx(rules, reader)
+	}
+	return tracer.creations, nil
+}
+
+// creationTracer records the contract creations of the transactions
+type creationTracer struct {
+	txIndex   int
+	creations []contractCreation
+}
+
+func (t *creationTracer) CaptureStart(env *vm.EVM, depth int, from common.Address, to common.Address, precompile bool, create bool, calltype vm.CallType, input []byte, gas uint64, value *big.Int, code []byte) {
+	if create {
+		t.creations = append(t.creations, contractCreation{contract: to, creator: from, txIndex: t.txIndex})
+	}
+}
+func (t *creationTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+}
+func (t *creationTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+func (t *creationTracer) CaptureEnd(depth int, output []byte, startGas, endGas uint64, d time.Duration, err error) {
+}
+func (t *creationTracer) CaptureSelfDestruct(from common.Address, to common.Address, value *big.Int) {
+}
+func (t *creationTracer) CaptureAccountRead(account common.Address) error {
+	return nil
+}
+func (t *creationTracer) CaptureAccountWrite(account common.Address) error {
+	return nil
+}
+
+// Selectors probed in the code of the contracts
+var (
+	erc20Selectors = [][4]byte{
+		{0x18, 0x16, 0x0d, 0xdd}, // totalSupply()
+		{0x70, 0xa0, 0x82, 0x31}, // balanceOf(address)
+		{0xa9, 0x05, 0x9c, 0xbb}, // transfer(address,uint256)
+		{0x23, 0xb8, 0x72, 0xdd}, // transferFrom(address,address,uint256)
+		{0x09, 0x5e, 0xa7, 0xb3}, // approve(address,uint256)
+		{0xdd, 0x62, 0xed, 0x3e}, // allowance(address,address)
+	}
+	erc721Selectors = [][4]byte{
+		{0x01, 0xff, 0xc9, 0xa7}, // supportsInterface(bytes4)
+		{0x70, 0xa0, 0x82, 0x31}, // balanceOf(address)
+		{0x63, 0x52, 0x21, 0x1e}, // ownerOf(uint256)
+		{0x42, 0x84, 0x2e, 0x0e}, // safeTransferFrom(address,address,uint256)
+		{0x23, 0xb8, 0x72, 0xdd}, // transferFrom(address,address,uint256)
+		{0xa2, 0x2c, 0xb4, 0x65}, // setApprovalForAll(address,bool)
+	}
+)
+
+// ProbeContractAttributes matches the code of a contract against the ERC-20 and ERC-721 interfaces: the contract
+// implements an interface if its code pushes the selectors of all the functions of the interface, as the dispatchers
+// generated by the compilers do. The ERC-721 functions are a superset of the ERC-20 transferFrom and balanceOf, the
+// contracts matching ERC-721 are not ERC-20 tokens
+func ProbeContractAttributes(code []byte) rawdb.AddressAttributes {
+	pushed := map[[4]byte]struct{}{}
+	for pc := 0; pc < len(code); pc++ {
+		op := vm.OpCode(code[pc])
+		if op < vm.PUSH1 || op > vm.PUSH32 {
+			continue
+		}
+		size := int(op - vm.PUSH1 + 1)
+		if op == vm.PUSH4 && pc+size < len(code) {
+			var selector [4]byte
+			copy(selector[:], code[pc+1:pc+1+size])
+			pushed[selector] = struct{}{}
+		}
+		pc += size
+	}
+	hasAll := func(selectors [][4]byte) bool {
+		for _, selector := range selectors {
+			if _, ok := pushed[selector]; !ok {
+				return false
+			}
+		}
+		return true
+	}
+	switch {
+	case hasAll(erc721Selectors):
+		return rawdb.AttrERC721
+	case hasAll(erc20Selectors):
+		return rawdb.AttrERC20
+	}
+	return 0
+}
+
+func UnwindOtsContracts(u *UnwindState, s *StageState, tx kv.RwTx, cfg OtsContractsCfg, ctx context.Context) (err error) {
+	useExternalTx := tx != nil
+	if !useExternalTx {
+		tx, err = cfg.db.BeginRw(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+	if err = rawdb.TruncateContractIndex(tx, u.UnwindPoint); err != nil {
+		return fmt.Errorf("[%s] %w", s.LogPrefix(), err)
+	}
+	if err = u.Done(tx); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func PruneOtsContracts(p *PruneState, tx kv.RwTx, cfg OtsContractsCfg, ctx context.Context) (err error) {
+	useExternalTx := tx != nil
+	if !useExternalTx {
+		tx, err = cfg.db.BeginRw(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+	if err = p.Done(tx); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
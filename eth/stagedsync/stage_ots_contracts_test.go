@@ -0,0 +1,78 @@
+package stagedsync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func dispatcherCode(selectors [][4]byte) []byte {
+	code := []byte{byte(vm.PUSH1), 0xe0, byte(vm.SHR)}
+	for _, selector := range selectors {
+		code = append(code, byte(vm.DUP1), byte(vm.PUSH4))
+		code = append(code, selector[:]...)
+		code = append(code, byte(vm.EQ), byte(vm.PUSH2), 0x01, 0x00, byte(vm.JUMPI))
+	}
+	return code
+}
+
+func TestProbeContractAttributes(t *testing.T) {
+	require.Equal(t, rawdb.AttrERC20, ProbeContractAttributes(dispatcherCode(erc20Selectors)))
+	require.Equal(t, rawdb.AttrERC721, ProbeContractAttributes(dispatcherCode(erc721Selectors)))
+	require.Equal(t, rawdb.AddressAttributes(0), ProbeContractAttributes(dispatcherCode(erc20Selectors[1:])))
+
+	// Selectors in the data of other pushes do not count
+	var hidden []byte
+	for _, selector := range erc20Selectors {
+		hidden = append(hidden, byte(vm.PUSH6), byte(vm.PUSH4))
+		hidden = append(hidden, selector[:]...)
+		hidden = append(hidden, 0x00)
+	}
+	require.Equal(t, rawdb.AddressAttributes(0), ProbeContractAttributes(hidden))
+
+	// Truncated push at the end of the code
+	require.Equal(t, rawdb.AddressAttributes(0), ProbeContractAttributes([]byte{byte(vm.PUSH4), 0x18, 0x16}))
+}
+
+func TestTruncateContractIndex(t *testing.T) {
+	db := mdbx.NewMDBX(log.New()).InMem().WithTableCfg(rawdb.WithOtsTables).MustOpen()
+	defer db.Close()
+	tx, err := db.BeginRw(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	for i := uint64(1); i <= 3; i++ {
+		addr := common.Address{byte(i)}
+		require.NoError(t, rawdb.WriteContractCreation(tx, addr, rawdb.ContractCreation{Creator: common.Address{0xff}, Hash: common.Hash{byte(i)}, BlockNumber: i}))
+		require.NoError(t, rawdb.AppendContractList(tx, rawdb.OtsAllContracts, rawdb.ContractListEntry{Address: addr, BlockNumber: i}))
+		require.NoError(t, rawdb.AppendContractList(tx, rawdb.OtsERC20, rawdb.ContractListEntry{Address: addr, BlockNumber: i}))
+		require.NoError(t, rawdb.WriteAddressAttributes(tx, addr, rawdb.AttrERC20))
+	}
+
+	require.NoError(t, rawdb.TruncateContractIndex(tx, 1))
+
+	n, err := rawdb.ReadContractListCount(tx, rawdb.OtsAllContracts)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), n)
+	n, err = rawdb.ReadContractListCount(tx, rawdb.OtsERC20)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), n)
+	entries, err := rawdb.ReadContractList(tx, rawdb.OtsAllContracts, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, []rawdb.ContractListEntry{{Address: common.Address{1}, BlockNumber: 1}}, entries)
+
+	for i := uint64(2); i <= 3; i++ {
+		creation, err := rawdb.ReadContractCreation(tx, common.Address{byte(i)})
+		require.NoError(t, err)
+		require.Nil(t, creation)
+		attrs, err := rawdb.ReadAddressAttributes(tx, common.Address{byte(i)})
+		require.NoError(t, err)
+		require.Equal(t, rawdb.AddressAttributes(0), attrs)
+	}
+}
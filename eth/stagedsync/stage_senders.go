@@ -41,9 +41,10 @@ type SendersCfg struct {
 	chainConfig     *params.ChainConfig
 	blockRetire     *snapshotsync.BlockRetire
 	hd              *headerdownload.HeaderDownload
+	exec22          bool // Execution stage runs exec22, which can recover the senders itself, see debug.FusedSenders
 }
 
-func StageSendersCfg(db kv.RwDB, chainCfg *params.ChainConfig, badBlockHalt bool, tmpdir string, prune prune.Mode, br *snapshotsync.BlockRetire, hd *headerdownload.HeaderDownload) SendersCfg {
+func StageSendersCfg(db kv.RwDB, chainCfg *params.ChainConfig, badBlockHalt bool, tmpdir string, prune prune.Mode, br *snapshotsync.BlockRetire, hd *headerdownload.HeaderDownload, exec22 bool) SendersCfg {
 	const sendersBatchSize = 10000
 	const sendersBlockSize = 4096
 
@@ -60,6 +61,7 @@ func StageSendersCfg(db kv.RwDB, chainCfg *params.ChainConfig, badBlockHalt bool
 		prune:           prune,
 		blockRetire:     br,
 		hd:              hd,
+		exec22:          exec22,
 	}
 }
 
@@ -92,6 +94,18 @@ func SpawnRecoverSendersStage(cfg SendersCfg, s *StageState, u Unwinder, tx kv.R
 		return nil
 	}
 	logPrefix := s.LogPrefix()
+	if debug.FusedSenders() && cfg.exec22 {
+		// Senders are recovered by exec22 before the transactions are scheduled. Other executors, and the readers
+		// of kv.Senders, need the stage
+		log.Info(fmt.Sprintf("[%s] Skipped, senders to be recovered during execution", logPrefix), "from", s.BlockNumber, "to", to)
+		if err := s.Update(tx, to); err != nil {
+			return err
+		}
+		if !useExternalTx {
+			return tx.Commit()
+		}
+		return nil
+	}
 	if to > s.BlockNumber+16 {
 		log.Info(fmt.Sprintf("[%s] Started", logPrefix), "from", s.BlockNumber, "to", to)
 	}
@@ -0,0 +1,259 @@
+package tracers
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/crypto"
+)
+
+// UserOpEntity is the role of a contract in the validation of an ERC-4337 UserOperation
+type UserOpEntity string
+
+const (
+	UserOpFactory   UserOpEntity = "factory"
+	UserOpAccount   UserOpEntity = "account"
+	UserOpPaymaster UserOpEntity = "paymaster"
+)
+
+// userOpForbiddenOpcodes may not be used by the entities during the validation (ERC-7562 OP-011)
+var userOpForbiddenOpcodes = map[vm.OpCode]struct{}{
+	vm.GASPRICE: {}, vm.GASLIMIT: {}, vm.DIFFICULTY: {}, vm.TIMESTAMP: {}, vm.BASEFEE: {}, vm.BLOCKHASH: {},
+	vm.NUMBER: {}, vm.SELFBALANCE: {}, vm.BALANCE: {}, vm.ORIGIN: {}, vm.CREATE: {}, vm.COINBASE: {},
+	vm.SELFDESTRUCT: {},
+}
+
+// depositToSelector is the only method of the EntryPoint the entities may call, besides its fallback
+var depositToSelector = []byte{0xb7, 0x60, 0xfa, 0xf9}
+
+// userOpAssociatedSlots is how many slots after keccak(address || ...) are associated with the address
+const userOpAssociatedSlots = 128
+
+// userOpStorageAccess is a SLOAD or SSTORE of an entity
+type userOpStorageAccess struct {
+	entity  UserOpEntity
+	address common.Address
+	slot    uint256.Int
+	write   bool
+}
+
+// UserOpTracer collects what the entities of a UserOperation do while EntryPoint.simulateValidation runs, to check the
+// rules of ERC-7562 on the opcodes, the code and the storage which the validation may use, see Violations. The phase of
+// an entity is the call of the EntryPoint to it: the account and the paymaster are called directly, the factory by
+// the SenderCreator of the EntryPoint
+type UserOpTracer struct {
+	entryPoint common.Address
+	entities   map[UserOpEntity]common.Address // the factory and the paymaster are missing if the operation has none
+
+	entity      UserOpEntity   // of the current phase, empty between the phases
+	phaseTarget common.Address // called by the EntryPoint for the current phase
+	afterGas    bool           // the last opcode was GAS
+	create2     int
+	precompiles map[common.Address]struct{}
+
+	associated map[common.Address][]uint256.Int // the keccak of the words starting with the address
+	accesses   []userOpStorageAccess
+	violations []string
+}
+
+// NewUserOpTracer returns the tracer of the validation of a UserOperation, factory and paymaster are nil if the operation
+// has none
+func NewUserOpTracer(entryPoint, sender common.Address, factory, paymaster *common.Address) *UserOpTracer {
+	t := &UserOpTracer{
+		entryPoint: entryPoint,
+		entities:   map[UserOpEntity]common.Address{UserOpAccount: sender},
+		associated: map[common.Address][]uint256.Int{},
+	}
+	if factory != nil {
+		t.entities[UserOpFactory] = *factory
+	}
+	if paymaster != nil {
+		t.entities[UserOpPaymaster] = *paymaster
+	}
+	return t
+}
+
+func (t *UserOpTracer) violate(format string, args ...interface{}) {
+	t.violations = append(t.violations, fmt.Sprintf("%s: %s", t.entity, fmt.Sprintf(format, args...)))
+}
+
+func (t *UserOpTracer) CaptureStart(env *vm.EVM, depth int, from common.Address, to common.Address, precompile bool, create bool, calltype vm.CallType, input []byte, gas uint64, value *big.Int, code []byte) {
+	if t.precompiles == nil {
+		t.precompiles = map[common.Address]struct{}{}
+		for _, addr := range vm.ActivePrecompiles(env.ChainRules()) {
+			t.precompiles[addr] = struct{}{}
+		}
+	}
+	if depth == 1 && from == t.entryPoint {
+		t.phaseTarget = to
+		if paymaster, ok := t.entities[UserOpPaymaster]; ok && to == paymaster {
+			t.entity = UserOpPaymaster
+		} else if to == t.entities[UserOpAccount] {
+			t.entity = UserOpAccount
+		} else if _, ok := t.entities[UserOpFactory]; ok {
+			t.entity = UserOpFactory
+		}
+		return
+	}
+	if t.entity != "" && depth > 1 && to == t.entryPoint && from != t.entryPoint {
+		if len(input) >= 4 && string(input[:4]) != string(depositToSelector) {
+			t.violate("calls the EntryPoint method %x", input[:4])
+		}
+	}
+}
+
+func (t *UserOpTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if t.entity == "" {
+		return
+	}
+	contract := scope.Contract.Address()
+	if contract == t.entryPoint || (t.entity == UserOpFactory && contract == t.phaseTarget) {
+		t.afterGas = false
+		return
+	}
+	if t.afterGas && op != vm.CALL && op != vm.CALLCODE && op != vm.DELEGATECALL && op != vm.STATICCALL {
+		t.violate("uses GAS without a call after it")
+	}
+	t.afterGas = op == vm.GAS
+
+	if _, ok := userOpForbiddenOpcodes[op]; ok {
+		t.violate("uses the forbidden opcode %s", op)
+	}
+	switch op {
+	case vm.CREATE2:
+		t.create2++
+		if t.entity != UserOpFactory || t.create2 > 1 {
+			t.violate("uses CREATE2 outside of the single deployment of the account")
+		}
+	case vm.SLOAD, vm.SSTORE:
+		t.accesses = append(t.accesses, userOpStorageAccess{entity: t.entity, address: contract, slot: *scope.Stack.Back(0), write: op == vm.SSTORE})
+	case vm.SHA3:
+		offset, size := scope.Stack.Back(0), scope.Stack.Back(1)
+		if size.LtUint64(32) || !offset.IsUint64() || !size.IsUint64() || offset.Uint64()+size.Uint64() > uint64(scope.Memory.Len()) {
+			return
+		}
+		data := scope.Memory.GetPtr(offset.Uint64(), size.Uint64())
+		for _, b := range data[:12] {
+			if b != 0 {
+				return
+			}
+		}
+		var hash uint256.Int
+		hash.SetBytes(crypto.Keccak256(data))
+		addr := common.BytesToAddress(data[12:32])
+		t.associated[addr] = append(t.associated[addr], hash)
+	case vm.EXTCODESIZE, vm.EXTCODEHASH, vm.EXTCODECOPY:
+		t.checkCode(env, common.Address(scope.Stack.Back(0).Bytes20()))
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		t.checkCode(env, common.Address(scope.Stack.Back(1).Bytes20()))
+	}
+}
+
+// checkCode reports the access to an address without code, except the sender which the factory deploys (OP-041)
+func (t *UserOpTracer) checkCode(env *vm.EVM, addr common.Address) {
+	if _, ok := t.precompiles[addr]; ok || addr == t.entities[UserOpAccount] {
+		return
+	}
+	if env.IntraBlockState().GetCodeSize(addr) == 0 {
+		t.violate("accesses the address %x without code", addr)
+	}
+}
+
+func (t *UserOpTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func (t *UserOpTracer) CaptureEnd(depth int, output []byte, startGas, endGas uint64, d time.Duration, err error) {
+	if t.entity == "" || depth < 1 {
+		return
+	}
+	if errors.Is(err, vm.ErrOutOfGas) {
+		t.violate("runs out of gas")
+	}
+	if depth == 1 {
+		t.entity = ""
+		t.afterGas = false
+	}
+}
+
+func (t *UserOpTracer) CaptureSelfDestruct(from common.Address, to common.Address, value *big.Int) {
+}
+
+func (t *UserOpTracer) CaptureAccountRead(account common.Address) error {
+	return nil
+}
+
+func (t *UserOpTracer) CaptureAccountWrite(account common.Address) error {
+	return nil
+}
+
+// isAssociated returns whether the slot is associated with the address: the address itself, or one of the slots after
+// the keccak of a word starting with the address, e.g. of a mapping keyed by the address
+func (t *UserOpTracer) isAssociated(addr common.Address, slot *uint256.Int) bool {
+	var self uint256.Int
+	self.SetBytes(addr.Bytes())
+	if slot.Eq(&self) {
+		return true
+	}
+	var diff uint256.Int
+	for i := range t.associated[addr] {
+		base := &t.associated[addr][i]
+		if !slot.Lt(base) && diff.Sub(slot, base).LtUint64(userOpAssociatedSlots) {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessesStorageOf returns whether an entity read or wrote the storage of the address
+func (t *UserOpTracer) AccessesStorageOf(addr common.Address) bool {
+	for i := range t.accesses {
+		if t.accesses[i].address == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// Violations returns the broken rules of ERC-7562 once the validation is traced, staked tells whether an entity has
+// enough stake in the EntryPoint. An entity may use the storage of the sender and the storage associated with the
+// sender; its own storage and the storage associated with it only if it's staked; and read any other storage only if
+// it's staked
+func (t *UserOpTracer) Violations(staked func(UserOpEntity) bool) []string {
+	violations := append([]string{}, t.violations...)
+	sender := t.entities[UserOpAccount]
+	for i := range t.accesses {
+		a := &t.accesses[i]
+		if a.address == sender || t.isAssociated(sender, &a.slot) {
+			continue
+		}
+		kind := "reads"
+		if a.write {
+			kind = "writes"
+		}
+		own := t.entities[a.entity]
+		if a.address == own || t.isAssociated(own, &a.slot) {
+			if !staked(a.entity) {
+				violations = append(violations, fmt.Sprintf("%s: %s its own storage slot %x of %x without stake", a.entity, kind, a.slot.Bytes32(), a.address))
+			}
+			continue
+		}
+		if a.write || !staked(a.entity) {
+			violations = append(violations, fmt.Sprintf("%s: %s the storage slot %x of %x", a.entity, kind, a.slot.Bytes32(), a.address))
+		}
+	}
+	// The same rule is often broken in a loop
+	seen := make(map[string]struct{}, len(violations))
+	unique := violations[:0]
+	for _, v := range violations {
+		if _, ok := seen[v]; !ok {
+			seen[v] = struct{}{}
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,59 @@
+package tracers
+
+import (
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/crypto"
+)
+
+func TestUserOpTracerStorageRules(t *testing.T) {
+	entryPoint, sender, paymaster, token := common.Address{1}, common.Address{2}, common.Address{3}, common.Address{4}
+	tracer := NewUserOpTracer(entryPoint, sender, nil, &paymaster)
+
+	// balances[sender] of a token and nonces[paymaster] of the paymaster
+	var senderBase, paymasterBase uint256.Int
+	senderBase.SetBytes(crypto.Keccak256(common.LeftPadBytes(sender.Bytes(), 32), make([]byte, 32)))
+	paymasterBase.SetBytes(crypto.Keccak256(common.LeftPadBytes(paymaster.Bytes(), 32), make([]byte, 32)))
+	tracer.associated[sender] = []uint256.Int{senderBase}
+	tracer.associated[paymaster] = []uint256.Int{paymasterBase}
+	slot := func(base *uint256.Int, n uint64) uint256.Int {
+		var s uint256.Int
+		s.AddUint64(base, n)
+		return s
+	}
+	tracer.accesses = []userOpStorageAccess{
+		{entity: UserOpAccount, address: sender, slot: *uint256.NewInt(0), write: true},
+		{entity: UserOpAccount, address: token, slot: slot(&senderBase, 1)},
+		{entity: UserOpPaymaster, address: paymaster, slot: slot(&paymasterBase, 0), write: true},
+		{entity: UserOpPaymaster, address: token, slot: *uint256.NewInt(7)},
+	}
+
+	staked := false
+	violations := tracer.Violations(func(UserOpEntity) bool { return staked })
+	if len(violations) != 2 {
+		t.Fatalf("Expected 2 violations of the unstaked paymaster, got %v", violations)
+	}
+	staked = true
+	if violations = tracer.Violations(func(UserOpEntity) bool { return staked }); len(violations) != 0 {
+		t.Fatalf("Expected no violations of the staked paymaster, got %v", violations)
+	}
+
+	// Even a staked entity can't write the storage of others, an unstaked one can't read past the associated slots
+	tracer.accesses = append(tracer.accesses,
+		userOpStorageAccess{entity: UserOpPaymaster, address: token, slot: *uint256.NewInt(7), write: true},
+		userOpStorageAccess{entity: UserOpAccount, address: token, slot: slot(&senderBase, userOpAssociatedSlots)},
+		userOpStorageAccess{entity: UserOpAccount, address: token, slot: slot(&senderBase, userOpAssociatedSlots)},
+	)
+	if violations = tracer.Violations(func(UserOpEntity) bool { return staked }); len(violations) != 1 {
+		t.Fatalf("Expected 1 violation, got %v", violations)
+	}
+	staked = false
+	if violations = tracer.Violations(func(UserOpEntity) bool { return staked }); len(violations) != 4 {
+		t.Fatalf("Expected 4 violations, got %v", violations)
+	}
+	if !tracer.AccessesStorageOf(token) || tracer.AccessesStorageOf(entryPoint) {
+		t.Errorf("Unexpected storage access of the token or the EntryPoint")
+	}
+}
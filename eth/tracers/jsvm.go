@@ -1,6 +1,8 @@
 package tracers
 
 import (
+	"errors"
+	"fmt"
 	"unsafe"
 
 	"github.com/dop251/goja"
@@ -176,7 +178,7 @@ func (vm *JSVM) Pcall(numArgs int) int {
 
 	v, err := fn(goja.Undefined(), args...)
 	if err != nil {
-		vm.stack = append(vm.stack, vm.vm.ToValue(err))
+		vm.pushError(err)
 		return 1
 	} else {
 		vm.stack = append(vm.stack, v)
@@ -199,7 +201,7 @@ func (vm *JSVM) PcallProp(objIndex int, numArgs int) int {
 
 	v, err := fn(obj, args...)
 	if err != nil {
-		vm.stack = append(vm.stack, vm.vm.ToValue(err))
+		vm.pushError(err)
 		return 1
 	} else {
 		vm.stack = append(vm.stack, v)
@@ -207,6 +209,22 @@ func (vm *JSVM) PcallProp(objIndex int, numArgs int) int {
 	}
 }
 
+// pushError pushes the error of a call, the reason only if the call was interrupted
+func (vm *JSVM) pushError(err error) {
+	var interrupted *goja.InterruptedError
+	if errors.As(err, &interrupted) {
+		vm.pushAny(fmt.Sprint(interrupted.Value()))
+		return
+	}
+	vm.stack = append(vm.stack, vm.vm.ToValue(err))
+}
+
+// Interrupt aborts the running JavaScript code with the reason, or the next one if none is running.
+// Safe to call from another goroutine
+func (vm *JSVM) Interrupt(reason interface{}) {
+	vm.vm.Interrupt(reason)
+}
+
 func (vm *JSVM) SafeToString(index int) string {
 	v := vm.stack[len(vm.stack)+index]
 	return v.ToString().String()
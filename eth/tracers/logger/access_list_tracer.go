@@ -109,8 +109,9 @@ func (al accessList) accessList() types.AccessList {
 // AccessListTracer is a tracer that accumulates touched accounts and storage
 // slots into an internal set.
 type AccessListTracer struct {
-	excl map[common.Address]struct{} // Set of account to exclude from the list
-	list accessList                  // Set of accounts and storage slots touched
+	excl    map[common.Address]struct{} // Set of account to exclude from the list
+	list    accessList                  // Set of accounts and storage slots touched
+	created map[common.Address]struct{} // Contracts created by the transaction, warm without the list
 }
 
 // NewAccessListTracer creates a new tracer that can generate AccessLists.
@@ -133,12 +134,16 @@ func NewAccessListTracer(acl types.AccessList, from, to common.Address, precompi
 		}
 	}
 	return &AccessListTracer{
-		excl: excl,
-		list: list,
+		excl:    excl,
+		list:    list,
+		created: map[common.Address]struct{}{},
 	}
 }
 
 func (a *AccessListTracer) CaptureStart(env *vm.EVM, depth int, from common.Address, to common.Address, precompile bool, create bool, callType vm.CallType, input []byte, gas uint64, value *big.Int, code []byte) {
+	if create {
+		a.created[to] = struct{}{}
+	}
 }
 
 // CaptureState captures all opcodes that touch storage or addresses and adds them to the accesslist.
@@ -179,9 +184,17 @@ func (*AccessListTracer) CaptureAccountWrite(account common.Address) error {
 	return nil
 }
 
-// AccessList returns the current accesslist maintained by the tracer.
+// AccessList returns the current accesslist maintained by the tracer, without
+// the contracts created by the transaction.
 func (a *AccessListTracer) AccessList() types.AccessList {
-	return a.list.accessList()
+	acl := a.list.accessList()
+	filtered := acl[:0]
+	for _, tuple := range acl {
+		if _, ok := a.created[tuple.Address]; !ok {
+			filtered = append(filtered, tuple)
+		}
+	}
+	return filtered
 }
 
 // Equal returns if the content of two access list traces are equal.
@@ -0,0 +1,139 @@
+package tracers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/vm"
+)
+
+// MuxTracerName is the name of the tracer combining the built-in tracers named in its config
+const MuxTracerName = "muxTracer"
+
+// ResultTracer is a tracer returning its result once the execution is traced, which can be stopped
+// from another goroutine. Implemented by Tracer and MuxTracer
+type ResultTracer interface {
+	vm.Tracer
+	Stop(err error)
+	SetOpBudget(budget uint64)
+	GetResult() (json.RawMessage, error)
+}
+
+// MuxTracer runs several built-in tracers over a single execution, its result is the object of
+// their results by name
+type MuxTracer struct {
+	names   []string
+	tracers []*Tracer
+}
+
+// NewMux instantiates the built-in tracers named by the keys of config, e.g.
+// {"callTracer": {}, "prestateTracer": {}}. The tracers have no config of their own
+func NewMux(config json.RawMessage, ctx *Context) (*MuxTracer, error) {
+	var configs map[string]json.RawMessage
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &configs); err != nil {
+			return nil, fmt.Errorf("invalid %s config: %w", MuxTracerName, err)
+		}
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("%s needs the names of the tracers to combine in tracerConfig", MuxTracerName)
+	}
+	mux := &MuxTracer{}
+	for name := range configs {
+		mux.names = append(mux.names, name)
+	}
+	sort.Strings(mux.names)
+	for _, name := range mux.names {
+		if _, ok := tracer(name); !ok {
+			return nil, fmt.Errorf("unknown tracer %q in %s", name, MuxTracerName)
+		}
+		if cfg := string(configs[name]); cfg != "{}" && cfg != "null" {
+			return nil, fmt.Errorf("config of %s in %s not supported", name, MuxTracerName)
+		}
+		t, err := New(name, ctx)
+		if err != nil {
+			return nil, err
+		}
+		mux.tracers = append(mux.tracers, t)
+	}
+	return mux, nil
+}
+
+// Stop terminates execution of all the tracers at the first opportune moment.
+func (mt *MuxTracer) Stop(err error) {
+	for _, t := range mt.tracers {
+		t.Stop(err)
+	}
+}
+
+// SetOpBudget limits the number of opcodes each of the tracers is called for, 0 - no limit
+func (mt *MuxTracer) SetOpBudget(budget uint64) {
+	for _, t := range mt.tracers {
+		t.SetOpBudget(budget)
+	}
+}
+
+func (mt *MuxTracer) CaptureStart(env *vm.EVM, depth int, from common.Address, to common.Address, precompile bool, create bool, calltype vm.CallType, input []byte, gas uint64, value *big.Int, code []byte) {
+	for _, t := range mt.tracers {
+		t.CaptureStart(env, depth, from, to, precompile, create, calltype, input, gas, value, code)
+	}
+}
+
+func (mt *MuxTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rdata []byte, depth int, err error) {
+	for _, t := range mt.tracers {
+		t.CaptureState(env, pc, op, gas, cost, scope, rdata, depth, err)
+	}
+}
+
+func (mt *MuxTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+	for _, t := range mt.tracers {
+		t.CaptureFault(env, pc, op, gas, cost, scope, depth, err)
+	}
+}
+
+func (mt *MuxTracer) CaptureEnd(depth int, output []byte, startGas, endGas uint64, d time.Duration, err error) {
+	for _, t := range mt.tracers {
+		t.CaptureEnd(depth, output, startGas, endGas, d, err)
+	}
+}
+
+func (mt *MuxTracer) CaptureSelfDestruct(from, to common.Address, value *big.Int) {
+	for _, t := range mt.tracers {
+		t.CaptureSelfDestruct(from, to, value)
+	}
+}
+
+func (mt *MuxTracer) CaptureAccountRead(account common.Address) error {
+	for _, t := range mt.tracers {
+		if err := t.CaptureAccountRead(account); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mt *MuxTracer) CaptureAccountWrite(account common.Address) error {
+	for _, t := range mt.tracers {
+		if err := t.CaptureAccountWrite(account); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetResult returns the object of the results of the tracers by name, or the first error of them
+func (mt *MuxTracer) GetResult() (json.RawMessage, error) {
+	results := make(map[string]json.RawMessage, len(mt.tracers))
+	for i, t := range mt.tracers {
+		result, err := t.GetResult()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", mt.names[i], err)
+		}
+		results[mt.names[i]] = result
+	}
+	return json.Marshal(results)
+}
@@ -0,0 +1,25 @@
+package tracers
+
+import (
+	"testing"
+)
+
+func TestMuxTracer(t *testing.T) {
+	tracer, err := NewMux([]byte(`{"opcountTracer": {}, "unigramTracer": null}`), new(Context))
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err := runTrace(tracer, testCtx())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"opcountTracer":3,"unigramTracer":{"PUSH1":2,"STOP":1}}`; string(have) != want {
+		t.Errorf("Expected %s, got %s", want, have)
+	}
+
+	for _, config := range []string{``, `{}`, `{"nonExistingTracer": {}}`, `{"callTracer": {"onlyTopCall": true}}`} {
+		if _, err = NewMux([]byte(config), new(Context)); err == nil {
+			t.Errorf("Expected error for config %q", config)
+		}
+	}
+}
@@ -317,9 +317,18 @@ type Tracer struct {
 	interrupt uint32 // Atomic flag to signal execution interruption
 	reason    error  // Textual reason for the interruption
 
+	opBudget uint64 // Maximum number of calls of step and fault, 0 - no limit
+	ops      uint64 // Number of calls of step and fault so far
+
 	activePrecompiles []common.Address // Updated on CaptureStart based on given rules
 }
 
+// DefaultOpBudget is the default op budget of the tracers run by the RPC daemon
+const DefaultOpBudget = 10_000_000
+
+// ErrOpBudgetExceeded is returned by a tracer that has been called for more opcodes than its op budget
+var ErrOpBudgetExceeded = errors.New("tracer op budget exceeded")
+
 // Context contains some contextual infos for a transaction execution that is not
 // available from within the EVM object.
 type Context struct {
@@ -536,10 +545,28 @@ func New(code string, ctx *Context) (*Tracer, error) {
 	return tracer, nil
 }
 
-// Stop terminates execution of the tracer at the first opportune moment.
+// Stop terminates execution of the tracer at the first opportune moment,
+// aborting the JavaScript code if it is running.
 func (jst *Tracer) Stop(err error) {
 	jst.reason = err
 	atomic.StoreUint32(&jst.interrupt, 1)
+	jst.vm.Interrupt(err)
+}
+
+// SetOpBudget limits the number of opcodes the tracer is called for (step and fault),
+// the tracing fails with ErrOpBudgetExceeded beyond it. 0 - no limit
+func (jst *Tracer) SetOpBudget(budget uint64) {
+	jst.opBudget = budget
+}
+
+// spendOp counts a call of step or fault against the op budget
+func (jst *Tracer) spendOp() bool {
+	jst.ops++
+	if jst.opBudget > 0 && jst.ops > jst.opBudget {
+		jst.err = ErrOpBudgetExceeded
+		return false
+	}
+	return true
 }
 
 // call executes a method on a JS object, catching any errors, formatting and
@@ -617,6 +644,9 @@ func (jst *Tracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost
 		jst.err = jst.reason
 		return
 	}
+	if !jst.spendOp() {
+		return
+	}
 	jst.opWrapper.op = op
 	jst.stackWrapper.stack = scope.Stack
 	jst.memoryWrapper.memory = scope.Memory
@@ -645,6 +675,9 @@ func (jst *Tracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost
 	if jst.err != nil {
 		return
 	}
+	if !jst.spendOp() {
+		return
+	}
 	// Apart from the error, everything matches the previous invocation
 	jst.errorValue = new(string)
 	*jst.errorValue = err.Error()
@@ -718,7 +751,7 @@ func (jst *Tracer) GetResult() (json.RawMessage, error) {
 
 	// Finalize the trace and return the results
 	result, err := jst.call(false, "result", "ctx", "db")
-	if err != nil {
+	if err != nil && jst.err == nil { // an interrupted tracer fails the result too
 		jst.err = wrapError("result", err)
 	}
 
@@ -63,7 +63,7 @@ func testCtx() *vmContext {
 	}, txCtx: vm.TxContext{GasPrice: big.NewInt(100000)}}
 }
 
-func runTrace(tracer *Tracer, vmctx *vmContext) (json.RawMessage, error) {
+func runTrace(tracer ResultTracer, vmctx *vmContext) (json.RawMessage, error) {
 	env := vm.NewEVM(vmctx.blockCtx, vmctx.txCtx, &dummyStatedb{}, params.TestChainConfig, vm.Config{Debug: true, Tracer: tracer})
 	var (
 		startGas uint64 = 10000
@@ -133,11 +133,9 @@ func TestTracer(t *testing.T) {
 }
 
 func TestHalt(t *testing.T) {
-	t.Skip("duktape doesn't support abortion")
-
 	timeout := errors.New("stahp")
 	vmctx := testCtx()
-	tracer, err := New("{step: function() { while(1); }, result: function() { return null; }}", new(Context))
+	tracer, err := New("{step: function() { while(1); }, fault: function() {}, result: function() { return null; }}", new(Context))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -173,6 +171,26 @@ func TestHaltBetweenSteps(t *testing.T) {
 	}
 }
 
+func TestOpBudget(t *testing.T) {
+	tracer, err := New("{count: 0, step: function() { this.count += 1; }, fault: function() {}, result: function() { return this.count; }}", new(Context))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer.SetOpBudget(2)
+	if _, err = runTrace(tracer, testCtx()); !errors.Is(err, ErrOpBudgetExceeded) {
+		t.Errorf("Expected op budget error, got %v", err)
+	}
+
+	tracer, err = New("{count: 0, step: function() { this.count += 1; }, fault: function() {}, result: function() { return this.count; }}", new(Context))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer.SetOpBudget(3)
+	if have, err := runTrace(tracer, testCtx()); err != nil || string(have) != "3" {
+		t.Errorf("Expected 3 ops, got %s, error %v", have, err)
+	}
+}
+
 // TestNoStepExec tests a regular value transfer (no exec), and accessing the statedb
 // in 'result'
 func TestNoStepExec(t *testing.T) {
@@ -0,0 +1,303 @@
+package privateapi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/VictoriaMetrics/metrics"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ledgerwatch/erigon-lib/direct"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	proto_sentry "github.com/ledgerwatch/erigon-lib/gointerfaces/sentry"
+	proto_txpool "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
+	types2 "github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/eth/protocols/eth"
+	"github.com/ledgerwatch/erigon/p2p/enode"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// txPoolBroadcastPeers counts the peers the transactions submitted over RPC are sent to by TxPoolServer
+var txPoolBroadcastPeers = metrics.GetOrCreateCounter(`txpool_rpc_broadcast_peers`)
+
+// txPoolReplacementsLRU is the number of the senders and nonces whose replacements TxPoolServer counts
+const txPoolReplacementsLRU = 65536
+
+// TxPoolServer applies the rules of core.TxPoolConfig which the pool does not have to the transactions submitted over
+// its gRPC interface, like those of eth_sendRawTransaction. The transactions received from the peers go to the pool
+// directly
+type TxPoolServer struct {
+	proto_txpool.TxpoolServer
+	db             kv.RoDB
+	sentries       []direct.SentryClient
+	cfg            core.TxPoolConfig
+	broadcastPeers []*types2.H512 // public keys of the enodes of cfg.BroadcastPeers
+
+	lock         sync.Mutex
+	signer       *types.Signer
+	replacements *lru.Cache // senderNonce -> *txReplacements
+}
+
+type senderNonce struct {
+	sender common.Address
+	nonce  uint64
+}
+
+type txReplacements struct {
+	hash  common.Hash // of the transaction in the pool
+	count uint64
+}
+
+// submittedTx is a transaction of an AddRequest which is decoded, the others are left to the pool
+type submittedTx struct {
+	txn    types.Transaction
+	hash   common.Hash
+	sender common.Address
+}
+
+func NewTxPoolServer(server proto_txpool.TxpoolServer, db kv.RoDB, sentries []direct.SentryClient, cfg core.TxPoolConfig) *TxPoolServer {
+	replacements, err := lru.New(txPoolReplacementsLRU)
+	if err != nil {
+		panic(err)
+	}
+	s := &TxPoolServer{TxpoolServer: server, db: db, sentries: sentries, cfg: cfg, replacements: replacements}
+	for _, url := range cfg.BroadcastPeers {
+		node, err := enode.ParseV4(url)
+		if err != nil {
+			log.Warn("[txpool] Invalid enode of --txpool.broadcast.peers", "enode", url, "err", err)
+			continue
+		}
+		var pubkey [64]byte
+		copy(pubkey[:], crypto.MarshalPubkey(node.Pubkey())[1:])
+		s.broadcastPeers = append(s.broadcastPeers, gointerfaces.ConvertHashToH512(pubkey))
+	}
+	return s
+}
+
+func (s *TxPoolServer) Add(ctx context.Context, in *proto_txpool.AddRequest) (*proto_txpool.AddReply, error) {
+	reply := &proto_txpool.AddReply{Imported: make([]proto_txpool.ImportResult, len(in.RlpTxs)), Errors: make([]string, len(in.RlpTxs))}
+	signer, err := s.chainSigner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	submitted := make([]*submittedTx, len(in.RlpTxs))
+	forward := &proto_txpool.AddRequest{}
+	var forwarded []int
+	nextNonces := map[common.Address]uint64{} // of the senders, after the transactions of the request before
+	for i, rlpTx := range in.RlpTxs {
+		if submitted[i], err = decodeSubmittedTx(rlpTx, signer); err == nil {
+			stx := submitted[i]
+			result, reason := s.check(stx)
+			if reason == nil && (s.cfg.MaxNonceGap > 0 || s.cfg.NoNonceGaps) {
+				next, ok := nextNonces[stx.sender]
+				if !ok {
+					if next, err = s.nextNonce(ctx, stx.sender); err != nil {
+						return nil, err
+					}
+					nextNonces[stx.sender] = next
+				}
+				result, reason = s.checkNonceGap(stx, next)
+			}
+			if reason != nil {
+				reply.Imported[i], reply.Errors[i] = result, reason.Error()
+				continue
+			}
+			// Only the transactions which pass all the checks advance the next nonce, the successor of a rejected one
+			// is a gap
+			if next, ok := nextNonces[stx.sender]; ok && stx.txn.GetNonce() >= next {
+				nextNonces[stx.sender] = stx.txn.GetNonce() + 1
+			}
+		}
+		// The transactions which fail to decode here are rejected by the pool with its reason
+		forward.RlpTxs = append(forward.RlpTxs, rlpTx)
+		forwarded = append(forwarded, i)
+	}
+	if len(forwarded) == 0 {
+		return reply, nil
+	}
+	res, err := s.TxpoolServer.Add(ctx, forward)
+	if err != nil {
+		return nil, err
+	}
+	var added []types.Transaction
+	for j, i := range forwarded {
+		reply.Imported[i], reply.Errors[i] = res.Imported[j], res.Errors[j]
+		if res.Imported[j] == proto_txpool.ImportResult_SUCCESS && submitted[i] != nil {
+			s.added(submitted[i])
+			added = append(added, submitted[i].txn)
+		}
+	}
+	if len(added) > 0 && (s.cfg.BroadcastLocal || len(s.broadcastPeers) > 0) {
+		go s.broadcast(added)
+	}
+	return reply, nil
+}
+
+// broadcast sends the transactions added to the pool to all the peers, or to the peers of
+// core.TxPoolConfig.BroadcastPeers, right away: the pool sends them to a part of the peers and announces them to the
+// others
+func (s *TxPoolServer) broadcast(txs []types.Transaction) {
+	packet := make(eth.TransactionsPacket, 0, len(txs))
+	for _, txn := range txs {
+		switch txn.(type) {
+		case *types.LegacyTx, *types.AccessListTx, *types.DynamicFeeTransaction:
+			packet = append(packet, txn)
+		}
+	}
+	if len(packet) == 0 {
+		return
+	}
+	data, err := rlp.EncodeToBytes(packet)
+	if err != nil {
+		log.Warn("[txpool] Failed to encode the transactions submitted over RPC", "err", err)
+		return
+	}
+	msg := &proto_sentry.OutboundMessageData{Id: proto_sentry.MessageId_TRANSACTIONS_66, Data: data}
+	ctx := context.Background()
+	for _, sentry := range s.sentries {
+		if !sentry.Ready() || sentry.Protocol() < direct.ETH66 {
+			continue
+		}
+		if s.cfg.BroadcastLocal {
+			sent, err := sentry.SendMessageToAll(ctx, msg)
+			if err != nil {
+				log.Debug("[txpool] Failed to broadcast the transactions submitted over RPC", "err", err)
+				continue
+			}
+			txPoolBroadcastPeers.Add(len(sent.Peers))
+			continue
+		}
+		for _, peerID := range s.broadcastPeers {
+			sent, err := sentry.SendMessageById(ctx, &proto_sentry.SendMessageByIdRequest{Data: msg, PeerId: peerID})
+			if err != nil {
+				log.Debug("[txpool] Failed to send the transactions submitted over RPC to a peer", "err", err)
+				continue
+			}
+			txPoolBroadcastPeers.Add(len(sent.Peers))
+		}
+	}
+}
+
+// chainSigner is read from the database on the first call, the external pool may start before the chain config is
+// written
+func (s *TxPoolServer) chainSigner(ctx context.Context) (*types.Signer, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.signer != nil {
+		return s.signer, nil
+	}
+	tx, err := s.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	genesisHash, err := rawdb.ReadCanonicalHash(tx, 0)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := rawdb.ReadChainConfig(tx, genesisHash)
+	if err != nil {
+		return nil, err
+	}
+	if cc == nil {
+		return nil, fmt.Errorf("chain config not found")
+	}
+	s.signer = types.LatestSigner(cc)
+	return s.signer, nil
+}
+
+func decodeSubmittedTx(rlpTx []byte, signer *types.Signer) (*submittedTx, error) {
+	txn, err := types.DecodeTransaction(rlp.NewStream(bytes.NewReader(rlpTx), uint64(len(rlpTx))))
+	if err != nil {
+		return nil, err
+	}
+	sender, err := txn.Sender(*signer)
+	if err != nil {
+		return nil, err
+	}
+	return &submittedTx{txn: txn, hash: txn.Hash(), sender: sender}, nil
+}
+
+func (s *TxPoolServer) check(stx *submittedTx) (proto_txpool.ImportResult, error) {
+	if s.cfg.MaxReplacements > 0 {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if v, ok := s.replacements.Get(senderNonce{stx.sender, stx.txn.GetNonce()}); ok {
+			if r := v.(*txReplacements); r.hash != stx.hash && r.count >= s.cfg.MaxReplacements {
+				return rejectTx("replacements", proto_txpool.ImportResult_INVALID, fmt.Errorf("transaction of nonce %d replaced %d times already, see --txpool.replacements", stx.txn.GetNonce(), r.count))
+			}
+		}
+	}
+	return proto_txpool.ImportResult_SUCCESS, nil
+}
+
+// rejectTx counts the transactions rejected by TxPoolServer by reason
+func rejectTx(reason string, result proto_txpool.ImportResult, err error) (proto_txpool.ImportResult, error) {
+	metrics.GetOrCreateCounter(fmt.Sprintf(`txpool_rpc_rejected{reason="%s"}`, reason)).Inc()
+	return result, err
+}
+
+// checkNonceGap rejects the transactions whose nonce is too far ahead of the next nonce of the sender
+func (s *TxPoolServer) checkNonceGap(stx *submittedTx, next uint64) (proto_txpool.ImportResult, error) {
+	if nonce := stx.txn.GetNonce(); nonce > next {
+		if s.cfg.NoNonceGaps {
+			return rejectTx("nonce_gap", proto_txpool.ImportResult_INVALID, fmt.Errorf("nonce %d, the transaction with nonce %d is missing, see --txpool.nogaps", nonce, next))
+		}
+		if s.cfg.MaxNonceGap > 0 && nonce-next > s.cfg.MaxNonceGap {
+			return rejectTx("nonce_gap", proto_txpool.ImportResult_INVALID, fmt.Errorf("nonce %d is %d ahead of the next nonce %d of the sender, see --txpool.maxnoncegap", nonce, nonce-next, next))
+		}
+	}
+	return proto_txpool.ImportResult_SUCCESS, nil
+}
+
+// nextNonce follows the transactions of the sender in the state and in the pool
+func (s *TxPoolServer) nextNonce(ctx context.Context, sender common.Address) (uint64, error) {
+	tx, err := s.db.BeginRo(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	account, err := state.NewPlainStateReader(tx).ReadAccountData(sender)
+	if err != nil {
+		return 0, err
+	}
+	var next uint64
+	if account != nil {
+		next = account.Nonce
+	}
+	// Only the highest nonce of the transactions of the sender in the pool is known
+	reply, err := s.TxpoolServer.Nonce(ctx, &proto_txpool.NonceRequest{Address: gointerfaces.ConvertAddressToH160(sender)})
+	if err != nil {
+		return 0, err
+	}
+	if reply.Found && reply.Nonce >= next {
+		next = reply.Nonce + 1
+	}
+	return next, nil
+}
+
+func (s *TxPoolServer) added(stx *submittedTx) {
+	if s.cfg.MaxReplacements > 0 {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		key := senderNonce{stx.sender, stx.txn.GetNonce()}
+		if v, ok := s.replacements.Get(key); ok {
+			// The same transaction submitted again, e.g. by rpchelper.LocalTxs, does not replace anything
+			if r := v.(*txReplacements); r.hash != stx.hash {
+				r.hash = stx.hash
+				r.count++
+			}
+		} else {
+			s.replacements.Add(key, &txReplacements{hash: stx.hash})
+		}
+	}
+}
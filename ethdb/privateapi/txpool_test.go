@@ -0,0 +1,114 @@
+package privateapi
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/holiman/uint256"
+	proto_txpool "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/stretchr/testify/require"
+)
+
+// acceptingTxPool imports all the transactions it's given
+type acceptingTxPool struct {
+	proto_txpool.UnimplementedTxpoolServer
+	added [][]byte
+	nonce proto_txpool.NonceReply // of any sender
+}
+
+func (p *acceptingTxPool) Nonce(context.Context, *proto_txpool.NonceRequest) (*proto_txpool.NonceReply, error) {
+	return &p.nonce, nil
+}
+
+func (p *acceptingTxPool) Add(_ context.Context, in *proto_txpool.AddRequest) (*proto_txpool.AddReply, error) {
+	p.added = append(p.added, in.RlpTxs...)
+	return &proto_txpool.AddReply{Imported: make([]proto_txpool.ImportResult, len(in.RlpTxs)), Errors: make([]string, len(in.RlpTxs))}, nil
+}
+
+func newTestTxPoolServer(t *testing.T, cfg core.TxPoolConfig) (*TxPoolServer, *acceptingTxPool) {
+	db := memdb.NewTestDB(t)
+	genesisHash := common.HexToHash("0x1")
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		if err := rawdb.WriteCanonicalHash(tx, genesisHash, 0); err != nil {
+			return err
+		}
+		return rawdb.WriteChainConfig(tx, genesisHash, params.TestChainConfig)
+	}))
+	pool := &acceptingTxPool{}
+	return NewTxPoolServer(pool, db, nil, cfg), pool
+}
+
+func signedTx(t *testing.T, nonce uint64, gasPrice uint64) []byte {
+	key, err := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	require.NoError(t, err)
+	txn, err := types.SignTx(types.NewTransaction(nonce, common.Address{1}, uint256.NewInt(1), params.TxGas, uint256.NewInt(gasPrice), nil), *types.LatestSignerForChainID(params.TestChainConfig.ChainID), key)
+	require.NoError(t, err)
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, txn.MarshalBinary(buf))
+	return buf.Bytes()
+}
+
+func TestTxPoolServerReplacements(t *testing.T) {
+	cfg := core.DeprecatedDefaultTxPoolConfig
+	cfg.MaxReplacements = 1
+	s, pool := newTestTxPoolServer(t, cfg)
+	ctx := context.Background()
+
+	add := func(rlpTx []byte) proto_txpool.ImportResult {
+		reply, err := s.Add(ctx, &proto_txpool.AddRequest{RlpTxs: [][]byte{rlpTx}})
+		require.NoError(t, err)
+		return reply.Imported[0]
+	}
+	require.Equal(t, proto_txpool.ImportResult_SUCCESS, add(signedTx(t, 0, 10)))
+	require.Equal(t, proto_txpool.ImportResult_SUCCESS, add(signedTx(t, 0, 10)), "the same transaction is not a replacement")
+	require.Equal(t, proto_txpool.ImportResult_SUCCESS, add(signedTx(t, 0, 20)))
+	require.Equal(t, proto_txpool.ImportResult_INVALID, add(signedTx(t, 0, 30)))
+	require.Equal(t, proto_txpool.ImportResult_SUCCESS, add(signedTx(t, 0, 20)))
+	require.Equal(t, proto_txpool.ImportResult_SUCCESS, add(signedTx(t, 1, 30)), "other nonces are not limited")
+	require.Len(t, pool.added, 5)
+}
+
+func TestTxPoolServerNonceGaps(t *testing.T) {
+	cfg := core.DeprecatedDefaultTxPoolConfig
+	cfg.NoNonceGaps = true
+	s, _ := newTestTxPoolServer(t, cfg)
+	reply, err := s.Add(context.Background(), &proto_txpool.AddRequest{RlpTxs: [][]byte{signedTx(t, 0, 10), signedTx(t, 1, 10), signedTx(t, 3, 10)}})
+	require.NoError(t, err)
+	require.Equal(t, []proto_txpool.ImportResult{proto_txpool.ImportResult_SUCCESS, proto_txpool.ImportResult_SUCCESS, proto_txpool.ImportResult_INVALID}, reply.Imported)
+
+	cfg = core.DeprecatedDefaultTxPoolConfig
+	cfg.MaxNonceGap = 2
+	s, pool := newTestTxPoolServer(t, cfg)
+	pool.nonce = proto_txpool.NonceReply{Found: true, Nonce: 4}
+	reply, err = s.Add(context.Background(), &proto_txpool.AddRequest{RlpTxs: [][]byte{signedTx(t, 7, 10), signedTx(t, 11, 10)}})
+	require.NoError(t, err)
+	require.Equal(t, []proto_txpool.ImportResult{proto_txpool.ImportResult_SUCCESS, proto_txpool.ImportResult_INVALID}, reply.Imported)
+}
+
+func TestTxPoolServerNonceGapAfterRejected(t *testing.T) {
+	cfg := core.DeprecatedDefaultTxPoolConfig
+	cfg.NoNonceGaps = true
+	cfg.MaxReplacements = 1
+	s, _ := newTestTxPoolServer(t, cfg)
+	ctx := context.Background()
+	for _, gasPrice := range []uint64{10, 20} {
+		reply, err := s.Add(ctx, &proto_txpool.AddRequest{RlpTxs: [][]byte{signedTx(t, 0, gasPrice)}})
+		require.NoError(t, err)
+		require.Equal(t, proto_txpool.ImportResult_SUCCESS, reply.Imported[0])
+	}
+
+	// The pool doesn't have the nonce 0 anymore, its replacement over the limit leaves a gap before the nonce 1
+	reply, err := s.Add(ctx, &proto_txpool.AddRequest{RlpTxs: [][]byte{signedTx(t, 0, 30), signedTx(t, 1, 30)}})
+	require.NoError(t, err)
+	require.Equal(t, []proto_txpool.ImportResult{proto_txpool.ImportResult_INVALID, proto_txpool.ImportResult_INVALID}, reply.Imported)
+	require.Contains(t, reply.Errors[1], "--txpool.nogaps")
+}
@@ -31,8 +31,12 @@ var (
 
 type Experiments struct {
 	TEVM bool
+	Ots2 bool // Index of contract creations, ERC-20 and ERC-721 tokens for the ots2_ RPC commands
 }
 
+// storageModeOts2 is the key of the ots2 experiment in kv.DatabaseInfo
+var storageModeOts2 = []byte("smOts2")
+
 func FromCli(chainId uint64, flags string, exactHistory, exactReceipts, exactTxIndex, exactCallTraces,
 	beforeH, beforeR, beforeT, beforeC uint64, experiments []string) (Mode, error) {
 	mode := DefaultMode
@@ -95,12 +99,17 @@ func FromCli(chainId uint64, flags string, exactHistory, exactReceipts, exactTxI
 		switch ex {
 		case "tevm":
 			mode.Experiments.TEVM = true
+		case "ots2":
+			mode.Experiments.Ots2 = true
 		case "":
 			// skip
 		default:
 			return DefaultMode, fmt.Errorf("unexpected experiment found: %s", ex)
 		}
 	}
+	if mode.Experiments.Ots2 && mode.History.Enabled() {
+		return DefaultMode, fmt.Errorf("experiment ots2 re-executes blocks on historical state and can not be used with pruned history")
+	}
 	return mode, nil
 }
 
@@ -159,6 +168,12 @@ func Get(db kv.Getter) (Mode, error) {
 	}
 	prune.Experiments.TEVM = len(v) == 1 && v[0] == 1
 
+	v, err = db.GetOne(kv.DatabaseInfo, storageModeOts2)
+	if err != nil {
+		return prune, err
+	}
+	prune.Experiments.Ots2 = len(v) == 1 && v[0] == 1
+
 	return prune, nil
 }
 
@@ -257,6 +272,9 @@ func (m Mode) String() string {
 	if m.Experiments.TEVM {
 		long += " --experiments.tevm=enabled"
 	}
+	if m.Experiments.Ots2 {
+		long += " --experiments.ots2=enabled"
+	}
 
 	return strings.TrimLeft(short+long, " ")
 }
@@ -291,6 +309,11 @@ func Override(db kv.RwTx, sm Mode) error {
 		return err
 	}
 
+	err = setMode(db, storageModeOts2, sm.Experiments.Ots2)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -346,6 +369,11 @@ func setIfNotExist(db kv.GetPut, pm Mode) error {
 		return err
 	}
 
+	err = setModeOnEmpty(db, storageModeOts2, pm.Experiments.Ots2)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
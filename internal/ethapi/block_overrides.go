@@ -0,0 +1,56 @@
+package ethapi
+
+import (
+	"fmt"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/vm"
+)
+
+// BlockOverrides replace the fields of the block a call is executed in, to simulate time-dependent logic
+// (blockOverrides of eth_call and debug_traceCall). Time is the timestamp of the block
+type BlockOverrides struct {
+	Number     *hexutil.Big    `json:"number"`
+	Difficulty *hexutil.Big    `json:"difficulty"`
+	Time       *hexutil.Uint64 `json:"time"`
+	GasLimit   *hexutil.Uint64 `json:"gasLimit"`
+	Coinbase   *common.Address `json:"coinbase"`
+	Random     *common.Hash    `json:"random"`
+	BaseFee    *hexutil.Big    `json:"baseFee"`
+}
+
+// Override replaces the overridden fields of the block context
+func (overrides *BlockOverrides) Override(blockCtx *vm.BlockContext) error {
+	if overrides.Number != nil {
+		if !overrides.Number.ToInt().IsUint64() {
+			return fmt.Errorf("block number override higher than 2^64-1")
+		}
+		blockCtx.BlockNumber = overrides.Number.ToInt().Uint64()
+	}
+	if overrides.Difficulty != nil {
+		blockCtx.Difficulty = overrides.Difficulty.ToInt()
+	}
+	if overrides.Time != nil {
+		blockCtx.Time = uint64(*overrides.Time)
+	}
+	if overrides.GasLimit != nil {
+		blockCtx.GasLimit = uint64(*overrides.GasLimit)
+	}
+	if overrides.Coinbase != nil {
+		blockCtx.Coinbase = *overrides.Coinbase
+	}
+	if overrides.Random != nil {
+		random := *overrides.Random
+		blockCtx.PrevRanDao = &random
+	}
+	if overrides.BaseFee != nil {
+		baseFee, overflow := uint256.FromBig(overrides.BaseFee.ToInt())
+		if overflow {
+			return fmt.Errorf("base fee override higher than 2^256-1")
+		}
+		blockCtx.BaseFee = baseFee
+	}
+	return nil
+}
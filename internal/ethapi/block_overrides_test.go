@@ -0,0 +1,31 @@
+package ethapi
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockOverrides(t *testing.T) {
+	var overrides BlockOverrides
+	require.NoError(t, json.Unmarshal([]byte(`{"number": "0x10", "time": "0x20", "gasLimit": "0x30", "coinbase": "0x0000000000000000000000000000000000000001", "random": "0x0000000000000000000000000000000000000000000000000000000000000002", "baseFee": "0x40"}`), &overrides))
+
+	blockCtx := vm.BlockContext{BlockNumber: 1, Time: 2, GasLimit: 3, Difficulty: big.NewInt(4)}
+	require.NoError(t, overrides.Override(&blockCtx))
+	require.Equal(t, uint64(0x10), blockCtx.BlockNumber)
+	require.Equal(t, uint64(0x20), blockCtx.Time)
+	require.Equal(t, uint64(0x30), blockCtx.GasLimit)
+	require.Equal(t, common.HexToAddress("0x01"), blockCtx.Coinbase)
+	require.Equal(t, common.HexToHash("0x02"), *blockCtx.PrevRanDao)
+	require.Equal(t, uint256.NewInt(0x40), blockCtx.BaseFee)
+	require.Equal(t, big.NewInt(4), blockCtx.Difficulty) // not overridden
+
+	overrides = BlockOverrides{Number: (*hexutil.Big)(new(big.Int).Lsh(big.NewInt(1), 64))}
+	require.Error(t, overrides.Override(&blockCtx))
+}
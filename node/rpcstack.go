@@ -18,12 +18,14 @@ package node
 
 import (
 	"compress/gzip"
+	"compress/zlib"
 	"context"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -343,7 +345,7 @@ func NewHTTPHandlerStack(srv http.Handler, cors []string, vhosts []string, compr
 	handler := newCorsHandler(srv, cors)
 	handler = newVHostHandler(vhosts, handler)
 	if compression {
-		handler = newGzipHandler(handler)
+		handler = newCompressionHandler(handler)
 	}
 	return handler
 }
@@ -416,36 +418,89 @@ var gzPool = sync.Pool{
 	},
 }
 
-type gzipResponseWriter struct {
+var zlibPool = sync.Pool{
+	New: func() interface{} {
+		w := zlib.NewWriter(io.Discard)
+		return w
+	},
+}
+
+type compressResponseWriter struct {
 	io.Writer
 	http.ResponseWriter
 }
 
-func (w *gzipResponseWriter) WriteHeader(status int) {
+func (w *compressResponseWriter) WriteHeader(status int) {
 	w.Header().Del("Content-Length")
 	w.ResponseWriter.WriteHeader(status)
 }
 
-func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+func (w *compressResponseWriter) Write(b []byte) (int, error) {
 	return w.Writer.Write(b)
 }
 
-func newGzipHandler(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
-			next.ServeHTTP(w, r)
-			return
+// negotiateEncoding returns the encoding of the response among gzip and deflate preferred by the Accept-Encoding
+// header, empty if the response is not to be compressed
+func negotiateEncoding(acceptEncoding string) string {
+	weights := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
 		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if param = strings.TrimSpace(param); strings.HasPrefix(param, "q=") {
+				parsed, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+				if err != nil {
+					parsed = 0
+				}
+				q = parsed
+			}
+		}
+		weights[name] = q
+	}
+	best, bestQ := "", 0.0
+	for _, encoding := range []string{"gzip", "deflate"} {
+		q, ok := weights[encoding]
+		if !ok {
+			q = weights["*"]
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+func newCompressionHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		switch negotiateEncoding(r.Header.Get("Accept-Encoding")) {
+		case "gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+
+			gz := gzPool.Get().(*gzip.Writer)
+			defer gzPool.Put(gz)
+
+			gz.Reset(w)
+			defer gz.Close()
 
-		w.Header().Set("Content-Encoding", "gzip")
+			next.ServeHTTP(&compressResponseWriter{ResponseWriter: w, Writer: gz}, r)
+		case "deflate":
+			w.Header().Set("Content-Encoding", "deflate")
 
-		gz := gzPool.Get().(*gzip.Writer)
-		defer gzPool.Put(gz)
+			zw := zlibPool.Get().(*zlib.Writer)
+			defer zlibPool.Put(zw)
 
-		gz.Reset(w)
-		defer gz.Close()
+			zw.Reset(w)
+			defer zw.Close()
 
-		next.ServeHTTP(&gzipResponseWriter{ResponseWriter: w, Writer: gz}, r)
+			next.ServeHTTP(&compressResponseWriter{ResponseWriter: w, Writer: zw}, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
 	})
 }
 
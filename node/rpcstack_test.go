@@ -18,9 +18,12 @@ package node
 
 import (
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strconv"
 	"strings"
@@ -181,6 +184,42 @@ func TestIsWebsocket(t *testing.T) {
 	assert.True(t, isWebsocket(r))
 }
 
+func TestNegotiateEncoding(t *testing.T) {
+	assert.Equal(t, "", negotiateEncoding(""))
+	assert.Equal(t, "gzip", negotiateEncoding("gzip, deflate, br"))
+	assert.Equal(t, "deflate", negotiateEncoding("deflate"))
+	assert.Equal(t, "deflate", negotiateEncoding("gzip;q=0.5, deflate"))
+	assert.Equal(t, "deflate", negotiateEncoding("GZIP;q=0, *"))
+	assert.Equal(t, "gzip", negotiateEncoding("*"))
+	assert.Equal(t, "", negotiateEncoding("gzip;q=0, deflate;q=0"))
+	assert.Equal(t, "", negotiateEncoding("identity, br"))
+}
+
+func TestCompressionHandler(t *testing.T) {
+	const body = `{"jsonrpc":"2.0","id":1,"result":"0x1"}`
+	handler := newCompressionHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body)) //nolint:errcheck
+	}))
+	for encoding, newReader := range map[string]func(io.Reader) (io.Reader, error){
+		"gzip":    func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"deflate": func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+		"":        func(r io.Reader) (io.Reader, error) { return r, nil },
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, encoding, rec.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+		r, err := newReader(rec.Body)
+		assert.NoError(t, err)
+		decoded, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, body, string(decoded), encoding)
+	}
+}
+
 func Test_checkPath(t *testing.T) {
 	tests := []struct {
 		req      *http.Request
@@ -0,0 +1,155 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// APIKeyHeader is the header of the requests with the API key of the client, see APIKeys
+const APIKeyHeader = "X-Api-Key"
+
+// apiKeyQueryParam is the query parameter with the API key of the websocket clients which can't set headers, e.g. browsers
+const apiKeyQueryParam = "apikey"
+
+var (
+	errMissingAPIKey = errors.New("missing API key, see the " + APIKeyHeader + " header")
+	errUnknownAPIKey = errors.New("unknown API key")
+)
+
+// APIKeys are the keys which the clients of the HTTP and websocket endpoints present in the APIKeyHeader, with the
+// methods each of them may call: "*" - all of them, "debug_*" - the methods of a namespace, or the name of a method
+type APIKeys map[string][]string
+
+type apiKeyACL struct {
+	all        bool
+	namespaces map[string]struct{}
+	methods    map[string]struct{}
+}
+
+func newAPIKeyACL(allow []string) (*apiKeyACL, error) {
+	acl := &apiKeyACL{namespaces: map[string]struct{}{}, methods: map[string]struct{}{}}
+	for _, entry := range allow {
+		switch {
+		case entry == "*":
+			acl.all = true
+		case strings.HasSuffix(entry, serviceMethodSeparator+"*"):
+			acl.namespaces[strings.TrimSuffix(entry, serviceMethodSeparator+"*")] = struct{}{}
+		case strings.Contains(entry, serviceMethodSeparator) && !strings.Contains(entry, "*"):
+			acl.methods[entry] = struct{}{}
+		default:
+			return nil, fmt.Errorf("invalid entry %q, expected *, <namespace>_* or <namespace>_<method>", entry)
+		}
+	}
+	return acl, nil
+}
+
+func (acl *apiKeyACL) allows(method string) bool {
+	if acl.all {
+		return true
+	}
+	if _, ok := acl.methods[method]; ok {
+		return true
+	}
+	namespace, _, _ := strings.Cut(method, serviceMethodSeparator)
+	_, ok := acl.namespaces[namespace]
+	return ok
+}
+
+// apiKeyStore holds the ACLs of the keys, which are replaced as a whole when the keys are reloaded
+type apiKeyStore struct {
+	acls atomic.Value // map[string]*apiKeyACL, nil - the keys are not required
+}
+
+func (s *apiKeyStore) set(keys APIKeys) error {
+	if keys == nil {
+		s.acls.Store(map[string]*apiKeyACL(nil))
+		return nil
+	}
+	acls := make(map[string]*apiKeyACL, len(keys))
+	for key, allow := range keys {
+		if key == "" {
+			return errors.New("empty API key")
+		}
+		acl, err := newAPIKeyACL(allow)
+		if err != nil {
+			return fmt.Errorf("methods of an API key: %w", err)
+		}
+		acls[key] = acl
+	}
+	s.acls.Store(acls)
+	return nil
+}
+
+func (s *apiKeyStore) load() map[string]*apiKeyACL {
+	acls, _ := s.acls.Load().(map[string]*apiKeyACL)
+	return acls
+}
+
+// clientAPIKey is the API key of a connection. Its methods are looked up at each call, so that the reloaded keys apply
+// to the open websocket connections too
+type clientAPIKey struct {
+	store *apiKeyStore
+	key   string
+}
+
+// forRequest returns the API key of the HTTP request, nil if the keys are not required, or an error if the request
+// has no valid key
+func (s *apiKeyStore) forRequest(r *http.Request) (*clientAPIKey, error) {
+	acls := s.load()
+	if acls == nil {
+		return nil, nil
+	}
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		key = r.URL.Query().Get(apiKeyQueryParam)
+	}
+	if key == "" {
+		return nil, errMissingAPIKey
+	}
+	if _, ok := acls[key]; !ok {
+		return nil, errUnknownAPIKey
+	}
+	return &clientAPIKey{store: s, key: key}, nil
+}
+
+// allows returns false if the method is not allowed for the key, or if the key was removed since the connection opened
+func (c *clientAPIKey) allows(method string) bool {
+	acls := c.store.load()
+	if acls == nil {
+		return true
+	}
+	acl, ok := acls[c.key]
+	return ok && acl.allows(method)
+}
+
+type handlerContextKey struct{}
+
+// CallerFromContext identifies the client of the call in ctx, e.g. to share a resource between the clients: "key:" and
+// its API key if it has one, "ip:" and its IP address otherwise. Empty if the client is in-process or ctx isn't the
+// context of a call
+func CallerFromContext(ctx context.Context) string {
+	h, ok := ctx.Value(handlerContextKey{}).(*handler)
+	if !ok {
+		return ""
+	}
+	if h.apiKey != nil {
+		return "key:" + h.apiKey.key
+	}
+	if h.rateLimit != nil {
+		return h.rateLimit.client
+	}
+	remote := h.conn.remoteAddr()
+	if remote == "" {
+		return ""
+	}
+	ip, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		ip = remote
+	}
+	return "ip:" + ip
+}
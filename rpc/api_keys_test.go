@@ -0,0 +1,103 @@
+package rpc
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyACL(t *testing.T) {
+	acl, err := newAPIKeyACL([]string{"debug_*", "eth_call"})
+	require.NoError(t, err)
+	require.True(t, acl.allows("debug_traceTransaction"))
+	require.True(t, acl.allows("eth_call"))
+	require.False(t, acl.allows("eth_getBalance"))
+	require.False(t, acl.allows("debugger_x"))
+
+	acl, err = newAPIKeyACL([]string{"*"})
+	require.NoError(t, err)
+	require.True(t, acl.allows("admin_peers"))
+
+	for _, entry := range []string{"debug", "debug_trace*", "*_call", ""} {
+		_, err = newAPIKeyACL([]string{entry})
+		require.Error(t, err, entry)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Stop()
+	require.NoError(t, srv.SetAPIKeys(APIKeys{"a": {"test_*"}, "b": {"test_echo"}}))
+	httpsrv := httptest.NewServer(srv)
+	defer httpsrv.Close()
+
+	client, err := DialHTTP(httpsrv.URL)
+	require.NoError(t, err)
+	defer client.Close()
+	var result echoResult
+	require.Error(t, client.Call(&result, "test_echo", "hello", 10, &echoArgs{"world"}), "no key")
+	client.SetHeader(APIKeyHeader, "c")
+	require.Error(t, client.Call(&result, "test_echo", "hello", 10, &echoArgs{"world"}), "unknown key")
+
+	client.SetHeader(APIKeyHeader, "b")
+	require.NoError(t, client.Call(&result, "test_echo", "hello", 10, &echoArgs{"world"}))
+	var s string
+	require.EqualError(t, client.Call(&s, "test_rets"), "the method test_rets is not allowed for the API key")
+
+	// The reloaded keys apply to the next requests
+	require.NoError(t, srv.SetAPIKeys(APIKeys{"b": {"*"}}))
+	require.NoError(t, client.Call(&s, "test_rets"))
+
+	// and to the open websocket connections, whose clients may pass the key in the URL
+	require.NoError(t, srv.SetAPIKeys(APIKeys{"a": {"test_*"}}))
+	wssrv := httptest.NewServer(srv.WebsocketHandler([]string{"*"}, nil, false))
+	defer wssrv.Close()
+	wsURL := "ws:" + strings.TrimPrefix(wssrv.URL, "http:")
+	_, err = DialWebsocket(context.Background(), wsURL, "")
+	require.Error(t, err)
+	wsClient, err := DialWebsocket(context.Background(), wsURL+"?apikey=a", "")
+	require.NoError(t, err)
+	defer wsClient.Close()
+	require.NoError(t, wsClient.Call(&s, "test_rets"))
+	require.NoError(t, srv.SetAPIKeys(APIKeys{"b": {"*"}}))
+	require.Error(t, wsClient.Call(&s, "test_rets"))
+
+	require.NoError(t, srv.SetAPIKeys(nil))
+	client.SetHeader(APIKeyHeader, "")
+	require.NoError(t, client.Call(&s, "test_rets"))
+}
+
+func TestCallerFromContext(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Stop()
+	httpsrv := httptest.NewServer(srv)
+	defer httpsrv.Close()
+	wssrv := httptest.NewServer(srv.WebsocketHandler([]string{"*"}, nil, false))
+	defer wssrv.Close()
+
+	var caller string
+	inproc := DialInProc(srv)
+	defer inproc.Close()
+	require.NoError(t, inproc.Call(&caller, "test_caller"))
+	require.Empty(t, caller)
+
+	client, err := DialHTTP(httpsrv.URL)
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.Call(&caller, "test_caller"))
+	require.Equal(t, "ip:127.0.0.1", caller)
+
+	wsClient, err := DialWebsocket(context.Background(), "ws:"+strings.TrimPrefix(wssrv.URL, "http:"), "")
+	require.NoError(t, err)
+	defer wsClient.Close()
+	require.NoError(t, wsClient.Call(&caller, "test_caller"))
+	require.Equal(t, "ip:127.0.0.1", caller)
+
+	require.NoError(t, srv.SetAPIKeys(APIKeys{"a": {"*"}}))
+	client.SetHeader(APIKeyHeader, "a")
+	require.NoError(t, client.Call(&caller, "test_caller"))
+	require.Equal(t, "key:a", caller)
+}
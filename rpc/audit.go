@@ -0,0 +1,147 @@
+package rpc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// AuditConfig selects the calls written to the audit log, see Server.SetAuditLog
+type AuditConfig struct {
+	SampleRate    float64       // share of the calls logged, from 0 to 1
+	SlowThreshold time.Duration // the calls lasting longer are logged with their params whatever the sampling, 0 - disabled
+}
+
+// AuditRecord is a line of the audit log
+type AuditRecord struct {
+	Time          time.Time       `json:"time"`
+	Method        string          `json:"method"`
+	ParamsHash    string          `json:"paramsHash"` // the same params of a method have the same hash
+	Params        json.RawMessage `json:"params,omitempty"`
+	LatencyMs     float64         `json:"latencyMs"`
+	RequestBytes  int             `json:"requestBytes"` // of the params
+	ResponseBytes int             `json:"responseBytes"`
+	Caller        string          `json:"caller"`           // remote address of the connection
+	APIKey        string          `json:"apiKey,omitempty"` // hash of the API key of the client, see APIKeys
+	ErrorCode     int             `json:"errorCode,omitempty"`
+	Slow          bool            `json:"slow,omitempty"`
+}
+
+type auditLog struct {
+	cfg  AuditConfig
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func newAuditLog(w io.Writer, cfg AuditConfig) (*auditLog, error) {
+	if cfg.SampleRate < 0 || cfg.SampleRate > 1 {
+		return nil, fmt.Errorf("sample rate %v is not between 0 and 1", cfg.SampleRate)
+	}
+	if cfg.SlowThreshold < 0 {
+		return nil, fmt.Errorf("negative slow request threshold %v", cfg.SlowThreshold)
+	}
+	return &auditLog{cfg: cfg, w: w}, nil
+}
+
+// sampled is called before the call, the calls which are not sampled are logged only if they are slow
+func (l *auditLog) sampled() bool {
+	return l.cfg.SampleRate > 0 && rand.Float64() < l.cfg.SampleRate //nolint:gosec
+}
+
+func (l *auditLog) isSlow(latency time.Duration) bool {
+	return l.cfg.SlowThreshold > 0 && latency >= l.cfg.SlowThreshold
+}
+
+func (l *auditLog) write(record *AuditRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.Warn("[rpc] Failed to encode the audit record", "method", record.Method, "err", err)
+		return
+	}
+	line = append(line, '\n')
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if _, err = l.w.Write(line); err != nil {
+		log.Warn("[rpc] Failed to write the audit record", "method", record.Method, "err", err)
+	}
+}
+
+// shortHash identifies params and API keys in the audit log without writing them
+func shortHash(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:8])
+}
+
+// countingWriter counts the bytes of the responses streamed by the calls, see responseBytes
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += n
+	return n, err
+}
+
+// newCountingStream returns the stream of the responses to w, which counts the bytes written to w
+func newCountingStream(w io.Writer) *jsoniter.Stream {
+	cw := &countingWriter{w: w}
+	stream := jsoniter.NewStream(jsoniter.ConfigDefault, cw, 4096)
+	stream.Attachment = cw
+	return stream
+}
+
+// responseBytes returns the bytes written to the stream so far, including the buffered ones
+func responseBytes(stream *jsoniter.Stream) int {
+	if stream == nil {
+		return 0
+	}
+	n := stream.Buffered()
+	if cw, ok := stream.Attachment.(*countingWriter); ok {
+		n += cw.n
+	}
+	return n
+}
+
+// auditCall writes the record of the call if it's sampled or slow. streamed is the size of the response streamed by
+// the call, resp is the response which is not written yet
+func (h *handler) auditCall(msg *jsonrpcMessage, sampled bool, latency time.Duration, streamed int, resp *jsonrpcMessage) {
+	slow := h.audit.isSlow(latency)
+	if !sampled && !slow {
+		return
+	}
+	record := &AuditRecord{
+		Time:          time.Now().Add(-latency).UTC(),
+		Method:        msg.Method,
+		ParamsHash:    shortHash(msg.Params),
+		LatencyMs:     float64(latency.Microseconds()) / 1000,
+		RequestBytes:  len(msg.Params),
+		ResponseBytes: streamed,
+		Caller:        h.conn.remoteAddr(),
+		Slow:          slow,
+	}
+	if slow {
+		record.Params = msg.Params
+	}
+	if h.apiKey != nil {
+		record.APIKey = shortHash([]byte(h.apiKey.key))
+	}
+	if resp != nil {
+		if buf, err := json.Marshal(resp); err == nil {
+			record.ResponseBytes += len(buf)
+		}
+		if resp.Error != nil {
+			record.ErrorCode = resp.Error.Code
+		}
+	}
+	h.audit.write(record)
+}
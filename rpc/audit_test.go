@@ -0,0 +1,82 @@
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Stop()
+	out := &syncBuffer{}
+	require.NoError(t, srv.SetAuditLog(out, AuditConfig{SampleRate: 1}))
+	httpsrv := httptest.NewServer(srv)
+	defer httpsrv.Close()
+	client, err := DialHTTP(httpsrv.URL)
+	require.NoError(t, err)
+	defer client.Close()
+
+	var result echoResult
+	require.NoError(t, client.Call(&result, "test_echo", "hello", 10, &echoArgs{"world"}))
+	require.NoError(t, client.Call(&result, "test_echo", "hello", 10, &echoArgs{"world"}))
+	require.Error(t, client.Call(nil, "test_returnError"))
+	records := out.records(t, 3)
+	require.Equal(t, "test_echo", records[0].Method)
+	require.Equal(t, records[0].ParamsHash, records[1].ParamsHash)
+	require.Equal(t, len(`["hello",10,{"S":"world"}]`), records[0].RequestBytes)
+	require.Greater(t, records[0].ResponseBytes, 0)
+	require.NotEmpty(t, records[0].Caller)
+	require.Empty(t, records[0].Params)
+	require.False(t, records[0].Slow)
+	require.Equal(t, "test_returnError", records[2].Method)
+	require.NotZero(t, records[2].ErrorCode)
+
+	// Without sampling only the slow calls are logged, with their params
+	out = &syncBuffer{}
+	require.NoError(t, srv.SetAuditLog(out, AuditConfig{SlowThreshold: 20 * time.Millisecond}))
+	require.NoError(t, client.Call(&result, "test_echo", "hello", 10, &echoArgs{"world"}))
+	require.NoError(t, client.Call(nil, "test_sleep", 30*time.Millisecond))
+	records = out.records(t, 1)
+	require.Equal(t, "test_sleep", records[0].Method)
+	require.True(t, records[0].Slow)
+	require.Equal(t, "[30000000]", string(records[0].Params))
+	require.GreaterOrEqual(t, records[0].LatencyMs, float64(30))
+
+	require.Error(t, srv.SetAuditLog(out, AuditConfig{SampleRate: 2}))
+}
+
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+// records waits for n lines of the audit log and decodes them
+func (b *syncBuffer) records(t *testing.T, n int) []AuditRecord {
+	var records []AuditRecord
+	require.Eventually(t, func() bool {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		records = records[:0]
+		scanner := bufio.NewScanner(bytes.NewReader(b.buf.Bytes()))
+		for scanner.Scan() {
+			var record AuditRecord
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+			records = append(records, record)
+		}
+		return len(records) == n
+	}, time.Second, 10*time.Millisecond)
+	return records
+}
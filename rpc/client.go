@@ -78,6 +78,11 @@ type Client struct {
 	isHTTP          bool
 	services        *serviceRegistry
 	methodAllowList AllowList
+	rateLimit       *clientRateLimit
+	lanes           lanes
+	subs            *clientSubscriptions
+	apiKey          *clientAPIKey
+	audit           *auditLog
 
 	idCounter uint32
 
@@ -113,6 +118,16 @@ type clientConn struct {
 func (c *Client) newClientConn(conn ServerCodec) *clientConn {
 	ctx := context.WithValue(context.Background(), clientContextKey{}, c)
 	handler := newHandler(ctx, conn, c.idgen, c.services, c.methodAllowList, 50, false /* traceRequests */)
+	handler.rateLimit = c.rateLimit
+	handler.lanes = c.lanes
+	handler.apiKey = c.apiKey
+	handler.audit = c.audit
+	if c.subs != nil {
+		handler.subs = c.subs
+		if limits := c.subs.limiter.limits; limits.SendQueue > 0 {
+			handler.sendQueue = newSendQueue(conn, limits)
+		}
+	}
 	return &clientConn{conn, handler}
 }
 
@@ -196,17 +211,22 @@ func newClient(initctx context.Context, connect reconnectFunc) (*Client, error)
 	if err != nil {
 		return nil, err
 	}
-	c := initClient(conn, randomIDGenerator(), new(serviceRegistry))
+	c := initClient(conn, randomIDGenerator(), new(serviceRegistry), nil, nil, nil, nil, nil)
 	c.reconnectFunc = connect
 	return c, nil
 }
 
-func initClient(conn ServerCodec, idgen func() ID, services *serviceRegistry) *Client {
+func initClient(conn ServerCodec, idgen func() ID, services *serviceRegistry, rateLimit *clientRateLimit, lanes lanes, subs *clientSubscriptions, apiKey *clientAPIKey, audit *auditLog) *Client {
 	_, isHTTP := conn.(*httpConn)
 	c := &Client{
 		idgen:       idgen,
 		isHTTP:      isHTTP,
 		services:    services,
+		rateLimit:   rateLimit,
+		lanes:       lanes,
+		subs:        subs,
+		apiKey:      apiKey,
+		audit:       audit,
 		writeConn:   conn,
 		close:       make(chan struct{}),
 		closing:     make(chan struct{}),
@@ -25,6 +25,10 @@ var (
 	_ Error = new(invalidRequestError)
 	_ Error = new(invalidMessageError)
 	_ Error = new(invalidParamsError)
+	_ Error = new(rateLimitedError)
+	_ Error = new(laneBusyError)
+	_ Error = new(tooManySubscriptionsError)
+	_ Error = new(methodForbiddenError)
 	_ Error = new(CustomError)
 )
 
@@ -74,6 +78,42 @@ func (e *invalidParamsError) ErrorCode() int { return -32602 }
 
 func (e *invalidParamsError) Error() string { return e.message }
 
+// the call is over the rate limits of the client, see RateLimits
+type rateLimitedError struct{ method string }
+
+func (e *rateLimitedError) ErrorCode() int { return -32005 }
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("rate limit exceeded for %s", e.method)
+}
+
+// the queue of the lane of the call is full, see Lane
+type laneBusyError struct{ lane Lane }
+
+func (e *laneBusyError) ErrorCode() int { return -32005 }
+
+func (e *laneBusyError) Error() string {
+	return fmt.Sprintf("server is busy with %s requests, try again later", e.lane)
+}
+
+// the client has the max amount of subscriptions, see SubscriptionLimits
+type tooManySubscriptionsError struct{ max int }
+
+func (e *tooManySubscriptionsError) ErrorCode() int { return -32005 }
+
+func (e *tooManySubscriptionsError) Error() string {
+	return fmt.Sprintf("too many subscriptions, max %d per client", e.max)
+}
+
+// the method is not allowed for the API key of the client, see APIKeys
+type methodForbiddenError struct{ method string }
+
+func (e *methodForbiddenError) ErrorCode() int { return -32601 }
+
+func (e *methodForbiddenError) Error() string {
+	return fmt.Sprintf("the method %s is not allowed for the API key", e.method)
+}
+
 type CustomError struct {
 	Code    int
 	Message string
@@ -19,8 +19,10 @@ package rpc
 import (
 	"bytes"
 	"context"
+	"encoding"
 	"encoding/json"
 	"fmt"
+	"io"
 	"reflect"
 	"strconv"
 	"strings"
@@ -66,6 +68,12 @@ type handler struct {
 
 	allowList     AllowList // a list of explicitly allowed methods, if empty -- everything is allowed
 	forbiddenList ForbiddenList
+	rateLimit     *clientRateLimit     // nil - the calls are not rate limited
+	lanes         lanes                // worker pools of the calls of the server, nil - the calls are not queued
+	subs          *clientSubscriptions // nil - the subscriptions are not limited
+	sendQueue     *sendQueue           // nil - the notifications are written by the notifying goroutine
+	apiKey        *clientAPIKey        // nil - the API keys are not required
+	audit         *auditLog            // nil - the calls are not audited
 
 	subLock             sync.Mutex
 	serverSubs          map[ID]*Subscription
@@ -111,7 +119,6 @@ func HandleError(err error, stream *jsoniter.Stream) error {
 }
 
 func newHandler(connCtx context.Context, conn jsonWriter, idgen func() ID, reg *serviceRegistry, allowList AllowList, maxBatchConcurrency uint, traceRequests bool) *handler {
-	rootCtx, cancelRoot := context.WithCancel(connCtx)
 	forbiddenList := newForbiddenList()
 	h := &handler{
 		reg:            reg,
@@ -119,8 +126,6 @@ func newHandler(connCtx context.Context, conn jsonWriter, idgen func() ID, reg *
 		conn:           conn,
 		respWait:       make(map[string]*requestOp),
 		clientSubs:     make(map[string]*ClientSubscription),
-		rootCtx:        rootCtx,
-		cancelRoot:     cancelRoot,
 		allowSubscribe: true,
 		serverSubs:     make(map[ID]*Subscription),
 		log:            log.Root(),
@@ -130,6 +135,7 @@ func newHandler(connCtx context.Context, conn jsonWriter, idgen func() ID, reg *
 		maxBatchConcurrency: maxBatchConcurrency,
 		traceRequests:       traceRequests,
 	}
+	h.rootCtx, h.cancelRoot = context.WithCancel(context.WithValue(connCtx, handlerContextKey{}, h))
 
 	if conn.remoteAddr() != "" {
 		h.log = h.log.New("conn", conn.remoteAddr())
@@ -182,7 +188,7 @@ func (h *handler) handleBatch(msgs []*jsonrpcMessage) {
 				}
 
 				buf := bytes.NewBuffer(nil)
-				stream := jsoniter.NewStream(jsoniter.ConfigDefault, buf, 4096)
+				stream := newCountingStream(buf)
 				if res := h.handleCallMsg(cp, calls[i], stream); res != nil {
 					answersWithNils[i] = res
 				}
@@ -216,9 +222,17 @@ func (h *handler) handleMsg(msg *jsonrpcMessage, stream *jsoniter.Stream) {
 	}
 	h.startCallProc(func(cp *callProc) {
 		needWriteStream := false
+		var streamWriter io.WriteCloser
 		if stream == nil {
-			stream = jsoniter.NewStream(jsoniter.ConfigDefault, nil, 4096)
-			needWriteStream = true
+			if codec, ok := h.conn.(streamingCodec); ok {
+				streamWriter = codec.newStreamWriter(cp.ctx)
+			}
+			if streamWriter != nil {
+				stream = newCountingStream(streamWriter)
+			} else {
+				stream = jsoniter.NewStream(jsoniter.ConfigDefault, nil, 4096)
+				needWriteStream = true
+			}
 		}
 		answer := h.handleCallMsg(cp, msg, stream)
 		h.addSubscriptions(cp.notifiers)
@@ -228,6 +242,9 @@ func (h *handler) handleMsg(msg *jsonrpcMessage, stream *jsoniter.Stream) {
 		}
 		if needWriteStream {
 			h.conn.writeJSON(cp.ctx, json.RawMessage(stream.Buffer()))
+		} else if streamWriter != nil {
+			stream.Flush()
+			streamWriter.Close()
 		} else {
 			stream.Write([]byte("\n"))
 		}
@@ -289,7 +306,10 @@ func (h *handler) addSubscriptions(nn []*Notifier) {
 
 	for _, n := range nn {
 		if sub := n.takeSubscription(); sub != nil {
+			sub.release = n.release
 			h.serverSubs[sub.ID] = sub
+		} else if n.release != nil {
+			n.release()
 		}
 	}
 }
@@ -303,6 +323,9 @@ func (h *handler) cancelServerSubscriptions(err error) {
 		s.err <- err
 		close(s.err)
 		delete(h.serverSubs, id)
+		if s.release != nil {
+			s.release()
+		}
 	}
 }
 
@@ -389,7 +412,15 @@ func (h *handler) handleCallMsg(ctx *callProc, msg *jsonrpcMessage, stream *json
 		}
 		return nil
 	case msg.isCall():
+		var sampled bool
+		var written int
+		if h.audit != nil {
+			sampled, written = h.audit.sampled(), responseBytes(stream)
+		}
 		resp := h.handleCall(ctx, msg, stream)
+		if h.audit != nil {
+			h.auditCall(msg, sampled, time.Since(start), responseBytes(stream)-written, resp)
+		}
 		if resp != nil && resp.Error != nil {
 			if resp.Error.Data != nil {
 				h.log.Warn("Served", "method", msg.Method, "reqid", idForLog{msg.ID}, "t", time.Since(start),
@@ -413,17 +444,24 @@ func (h *handler) handleCallMsg(ctx *callProc, msg *jsonrpcMessage, stream *json
 }
 
 func (h *handler) isMethodAllowedByGranularControl(method string) bool {
-	_, isForbidden := h.forbiddenList[method]
-	if len(h.allowList) == 0 {
+	return isMethodAllowed(h.allowList, h.forbiddenList, method)
+}
+
+func isMethodAllowed(allowList AllowList, forbiddenList ForbiddenList, method string) bool {
+	_, isForbidden := forbiddenList[method]
+	if len(allowList) == 0 {
 		return !isForbidden
 	}
 
-	_, ok := h.allowList[method]
+	_, ok := allowList[method]
 	return ok
 }
 
 // handleCall processes method calls.
 func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage, stream *jsoniter.Stream) *jsonrpcMessage {
+	if h.apiKey != nil && !msg.isUnsubscribe() && !h.apiKey.allows(msg.Method) {
+		return msg.errorResponse(&methodForbiddenError{method: msg.Method})
+	}
 	if msg.isSubscribe() {
 		return h.handleSubscribe(cp, msg, stream)
 	}
@@ -440,6 +478,14 @@ func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage, stream *jsoniter
 	if err != nil {
 		return msg.errorResponse(&invalidParamsError{err.Error()})
 	}
+	if h.rateLimit != nil && callb != h.unsubscribeCb {
+		release, err := h.rateLimit.acquire(msg.Method)
+		if err != nil {
+			newRateLimitedCounter(msg.Method).Inc()
+			return msg.errorResponse(err)
+		}
+		defer release()
+	}
 	start := time.Now()
 	answer := h.runMethod(cp.ctx, msg, callb, args, stream)
 
@@ -482,6 +528,14 @@ func (h *handler) handleSubscribe(cp *callProc, msg *jsonrpcMessage, stream *jso
 
 	// Install notifier in context so the subscription handler can find it.
 	n := &Notifier{h: h, namespace: namespace}
+	if h.subs != nil {
+		// The slot is released by addSubscriptions if the call doesn't create a subscription
+		release, err := h.subs.acquire()
+		if err != nil {
+			return msg.errorResponse(err)
+		}
+		n.release = release
+	}
 	cp.notifiers = append(cp.notifiers, n)
 	ctx := context.WithValue(cp.ctx, notifierKey{}, n)
 
@@ -490,14 +544,43 @@ func (h *handler) handleSubscribe(cp *callProc, msg *jsonrpcMessage, stream *jso
 
 // runMethod runs the Go callback for an RPC method.
 func (h *handler) runMethod(ctx context.Context, msg *jsonrpcMessage, callb *callback, args []reflect.Value, stream *jsoniter.Stream) *jsonrpcMessage {
+	if h.lanes != nil {
+		release, err := h.lanes.acquire(ctx, msg.Method)
+		if err != nil {
+			return msg.errorResponse(err)
+		}
+		defer release()
+	}
 	if !callb.streamable {
 		result, err := callb.call(ctx, msg.Method, args, stream)
 		if err != nil {
 			return msg.errorResponse(err)
 		}
+		if msg.isCall() && h.reg.streamedArray(msg.Method) {
+			if array, ok := streamedArray(result); ok {
+				if err := writeArrayResponse(msg, array, stream); err != nil {
+					return msg.errorResponse(err)
+				}
+				return nil
+			}
+		}
 		return msg.response(result)
 	}
 
+	writeResponseStart(msg, stream)
+	_, err := callb.call(ctx, msg.Method, args, stream)
+	if err != nil {
+		stream.WriteNil()
+		stream.WriteMore()
+		HandleError(err, stream)
+	}
+	stream.WriteObjectEnd()
+	stream.Flush()
+	return nil
+}
+
+// writeResponseStart writes the response up to its result
+func writeResponseStart(msg *jsonrpcMessage, stream *jsoniter.Stream) {
 	stream.WriteObjectStart()
 	stream.WriteObjectField("jsonrpc")
 	stream.WriteString("2.0")
@@ -508,12 +591,69 @@ func (h *handler) runMethod(ctx context.Context, msg *jsonrpcMessage, callb *cal
 		stream.WriteMore()
 	}
 	stream.WriteObjectField("result")
-	_, err := callb.call(ctx, msg.Method, args, stream)
-	if err != nil {
-		stream.WriteNil()
-		stream.WriteMore()
-		HandleError(err, stream)
+}
+
+// streamedArrayMinLen is the length from which the array results of the methods registered by
+// Server.SetStreamedArrayMethods (e.g. eth_getLogs) are sent in chunks, instead of being encoded in memory as a whole
+const streamedArrayMinLen = 128
+
+// streamedArrayFlushSize is the size of the chunks in which the array results are sent
+const streamedArrayFlushSize = 64 * 1024
+
+// streamedArray returns the result as a value if it is an array to encode element by element: the arrays with
+// their own encoding, and the byte arrays, are encoded as a whole
+func streamedArray(result interface{}) (reflect.Value, bool) {
+	switch result.(type) {
+	case nil, json.Marshaler, encoding.TextMarshaler:
+		return reflect.Value{}, false
+	}
+	array := reflect.ValueOf(result)
+	if array.Kind() != reflect.Slice && array.Kind() != reflect.Array {
+		return reflect.Value{}, false
 	}
+	if array.Len() < streamedArrayMinLen || array.Type().Elem().Kind() == reflect.Uint8 {
+		return reflect.Value{}, false
+	}
+	return array, true
+}
+
+// writeArrayResponse writes the response of the array result, encoding its elements one by one straight to the stream
+// and flushing it every streamedArrayFlushSize bytes. An element which can not be encoded before the first flush
+// fails the call with nothing written, a later one ends the result and gets the error of the response, like the
+// errors of the streaming methods
+func writeArrayResponse(msg *jsonrpcMessage, array reflect.Value, stream *jsoniter.Stream) error {
+	start, flushed := stream.Buffered(), false
+	writeResponseStart(msg, stream)
+	stream.WriteArrayStart()
+	for i := 0; i < array.Len(); i++ {
+		elem, err := json.Marshal(array.Index(i).Interface())
+		if err != nil {
+			if !flushed {
+				stream.SetBuffer(stream.Buffer()[:start])
+				return err
+			}
+			stream.WriteArrayEnd()
+			stream.WriteMore()
+			HandleError(err, stream)
+			stream.WriteObjectEnd()
+			stream.Flush()
+			return nil
+		}
+		if i > 0 {
+			stream.WriteMore()
+		}
+		if _, err := stream.Write(elem); err != nil {
+			// the connection is broken, the rest of the response can not be sent either
+			return nil
+		}
+		if stream.Buffered() >= streamedArrayFlushSize {
+			if err := stream.Flush(); err != nil {
+				return nil
+			}
+			flushed = true
+		}
+	}
+	stream.WriteArrayEnd()
 	stream.WriteObjectEnd()
 	stream.Flush()
 	return nil
@@ -530,6 +670,9 @@ func (h *handler) unsubscribe(ctx context.Context, id ID) (bool, error) {
 	}
 	close(s.err)
 	delete(h.serverSubs, id)
+	if s.release != nil {
+		s.release()
+	}
 	return true, nil
 }
 
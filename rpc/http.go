@@ -219,15 +219,58 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if origin := r.Header.Get("Origin"); origin != "" {
 		ctx = context.WithValue(ctx, "Origin", origin)
 	}
+	if budget := r.Header.Get(CallBudgetHeader); budget != "" && s.callBudgetSecret != nil {
+		if err := checkJwt(r, s.callBudgetSecret); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		ctx = context.WithValue(ctx, callBudgetKey{}, budget)
+	}
+	if view := r.Header.Get(ViewHeader); view != "" {
+		ctx = ContextWithView(ctx, view)
+	}
+
+	apiKey, err := s.apiKeys.forRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	rateLimit := s.rateLimiter.forRequest(r)
+	if rateLimit != nil {
+		w = &rateLimitedResponse{ResponseWriter: w, rateLimit: rateLimit}
+	}
 
 	w.Header().Set("content-type", contentType)
 	codec := newHTTPServerConn(r, w)
 	defer codec.close()
 	var stream *jsoniter.Stream
 	if !s.disableStreaming {
-		stream = jsoniter.NewStream(jsoniter.ConfigDefault, w, 4096)
+		stream = newCountingStream(w)
 	}
-	s.serveSingleRequest(ctx, codec, stream)
+	s.serveSingleRequest(ctx, codec, stream, rateLimit, apiKey)
+}
+
+// rateLimitedResponse has the status 429 if all the calls of the request were over the limits. The calls of a batch
+// which are over the limits get the error responses in the batch, with the status 200 as long as one of them is not.
+// The status is decided at the first write of the response, which is of the only goroutine writing it and comes after
+// all the calls are done
+type rateLimitedResponse struct {
+	http.ResponseWriter
+	rateLimit   *clientRateLimit
+	wroteHeader bool
+}
+
+func (w *rateLimitedResponse) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *rateLimitedResponse) Write(b []byte) (int, error) {
+	if !w.wroteHeader && w.rateLimit.allLimited() {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
 }
 
 // validateRequest returns a non-zero response code and error message if the
@@ -257,7 +300,46 @@ func validateRequest(r *http.Request) (int, error) {
 	return http.StatusUnsupportedMediaType, err
 }
 
+// CallBudgetHeader is the header of the HTTP requests authenticated by a JWT (see Server.SetCallBudgetSecret) which
+// raises the execution budget of their calls, e.g. "gas=100000000,timeout=1m,memory=67108864" (see
+// transactions.ParseCallBudget)
+const CallBudgetHeader = "X-Call-Budget"
+
+type callBudgetKey struct{}
+
+// CallBudgetFromContext returns the value of the CallBudgetHeader of the authenticated request
+func CallBudgetFromContext(ctx context.Context) (string, bool) {
+	budget, ok := ctx.Value(callBudgetKey{}).(string)
+	return budget, ok
+}
+
+// ViewHeader is the header of the HTTP requests whose calls read the database view pinned by erigon_pinView, so that
+// the calls of several requests observe the same state even if new blocks are imported meanwhile
+const ViewHeader = "X-Erigon-View"
+
+type viewKey struct{}
+
+// ContextWithView returns ctx with the id of the pinned database view its calls read
+func ContextWithView(ctx context.Context, view string) context.Context {
+	return context.WithValue(ctx, viewKey{}, view)
+}
+
+// ViewFromContext returns the id of the pinned database view of the request, see ViewHeader
+func ViewFromContext(ctx context.Context) (string, bool) {
+	view, ok := ctx.Value(viewKey{}).(string)
+	return view, ok
+}
+
 func CheckJwtSecret(w http.ResponseWriter, r *http.Request, jwtSecret []byte) bool {
+	if err := checkJwt(r, jwtSecret); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// checkJwt returns the error if the request is not authenticated by a JWT signed with the secret
+func checkJwt(r *http.Request, jwtSecret []byte) error {
 	var tokenStr string
 	// Check if JWT signature is correct
 	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
@@ -265,8 +347,7 @@ func CheckJwtSecret(w http.ResponseWriter, r *http.Request, jwtSecret []byte) bo
 	}
 
 	if len(tokenStr) == 0 {
-		http.Error(w, "missing token", http.StatusForbidden)
-		return false
+		return errors.New("missing token")
 	}
 
 	keyFunc := func(token *jwt.Token) (interface{}, error) {
@@ -282,20 +363,18 @@ func CheckJwtSecret(w http.ResponseWriter, r *http.Request, jwtSecret []byte) bo
 
 	switch {
 	case err != nil:
-		http.Error(w, err.Error(), http.StatusForbidden)
+		return err
 	case !token.Valid:
-		http.Error(w, "invalid token", http.StatusForbidden)
+		return errors.New("invalid token")
 	case !claims.VerifyExpiresAt(time.Now(), false): // optional
-		http.Error(w, "token is expired", http.StatusForbidden)
+		return errors.New("token is expired")
 	case claims.IssuedAt == nil:
-		http.Error(w, "missing issued-at", http.StatusForbidden)
+		return errors.New("missing issued-at")
 	case time.Since(claims.IssuedAt.Time) > jwtTokenExpiry:
-		http.Error(w, "stale token", http.StatusForbidden)
+		return errors.New("stale token")
 	case time.Until(claims.IssuedAt.Time) > jwtTokenExpiry:
-		http.Error(w, "future token", http.StatusForbidden)
+		return errors.New("future token")
 	default:
-		return true
+		return nil
 	}
-
-	return false
 }
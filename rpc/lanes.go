@@ -0,0 +1,159 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lane is a class of requests served by its own pool of workers, so that the heavy requests don't starve the light ones
+type Lane string
+
+const (
+	LaneLight        Lane = "light"
+	LaneHeavy        Lane = "heavy"
+	LaneSubscription Lane = "subscription"
+)
+
+// heavyNamespaces and heavyMethods are served in LaneHeavy
+var heavyNamespaces = map[string]struct{}{"trace": {}, "debug": {}, "ots": {}, "ots2": {}}
+
+var heavyMethods = map[string]struct{}{
+	"eth_getLogs":          {},
+	"eth_estimateGas":      {},
+	"eth_createAccessList": {},
+	"eth_callMany":         {},
+	"eth_callBundle":       {},
+	"eth_getFilterLogs":    {},
+	"erigon_getLogs":       {},
+	"erigon_getLatestLogs": {},
+	"erigon_getLogsByHash": {},
+}
+
+// subscriptionMethods are served in LaneSubscription, with the *_subscribe and *_unsubscribe calls
+var subscriptionMethods = map[string]struct{}{
+	"eth_newFilter":                   {},
+	"eth_newBlockFilter":              {},
+	"eth_newPendingTransactionFilter": {},
+	"eth_getFilterChanges":            {},
+	"eth_uninstallFilter":             {},
+}
+
+// LaneOf returns the lane of the method
+func LaneOf(method string) Lane {
+	if strings.HasSuffix(method, subscribeMethodSuffix) || strings.HasSuffix(method, unsubscribeMethodSuffix) {
+		return LaneSubscription
+	}
+	if _, ok := subscriptionMethods[method]; ok {
+		return LaneSubscription
+	}
+	if _, ok := heavyMethods[method]; ok {
+		return LaneHeavy
+	}
+	if i := strings.Index(method, serviceMethodSeparator); i > 0 {
+		if _, ok := heavyNamespaces[method[:i]]; ok {
+			return LaneHeavy
+		}
+	}
+	return LaneLight
+}
+
+// LaneConfig is the size of the pool of workers of a lane and the limit of its queue
+type LaneConfig struct {
+	Workers int // calls served at the same time
+	Queue   int // calls waiting for a worker, the calls over this limit are rejected
+}
+
+// ParseLanes parses the configuration of the lanes, e.g. "light=64/1024,heavy=8/256,subscription=16/64" - workers and
+// the queue limit of each lane. The calls of a lane which is not listed are not limited
+func ParseLanes(s string) (map[Lane]LaneConfig, error) {
+	lanes := map[Lane]LaneConfig{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, sizes, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid lane %q, expected <lane>=<workers>/<queue>", entry)
+		}
+		lane := Lane(name)
+		if lane != LaneLight && lane != LaneHeavy && lane != LaneSubscription {
+			return nil, fmt.Errorf("unknown lane %q", name)
+		}
+		workers, queue, ok := strings.Cut(sizes, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid lane %q, expected <lane>=<workers>/<queue>", entry)
+		}
+		var cfg LaneConfig
+		var err error
+		if cfg.Workers, err = strconv.Atoi(workers); err != nil || cfg.Workers <= 0 {
+			return nil, fmt.Errorf("invalid workers of lane %q: %s", name, workers)
+		}
+		if cfg.Queue, err = strconv.Atoi(queue); err != nil || cfg.Queue < 0 {
+			return nil, fmt.Errorf("invalid queue of lane %q: %s", name, queue)
+		}
+		lanes[lane] = cfg
+	}
+	return lanes, nil
+}
+
+type lane struct {
+	name    Lane
+	workers chan struct{}
+	lock    sync.Mutex
+	queued  int
+	queue   int
+}
+
+// lanes are the worker pools of the calls of a server
+type lanes map[Lane]*lane
+
+func newLanes(cfg map[Lane]LaneConfig) lanes {
+	l := lanes{}
+	for name, c := range cfg {
+		l[name] = &lane{name: name, workers: make(chan struct{}, c.Workers), queue: c.Queue}
+	}
+	return l
+}
+
+// acquire waits for a worker of the lane of the method, returns laneBusyError if the queue of the lane is full. The
+// returned function releases the worker
+func (l lanes) acquire(ctx context.Context, method string) (func(), error) {
+	ln, ok := l[LaneOf(method)]
+	if !ok {
+		return func() {}, nil
+	}
+	release := func() { <-ln.workers }
+	select {
+	case ln.workers <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	ln.lock.Lock()
+	if ln.queued >= ln.queue {
+		ln.lock.Unlock()
+		newLaneRejectedCounter(ln.name).Inc()
+		return nil, &laneBusyError{lane: ln.name}
+	}
+	ln.queued++
+	ln.lock.Unlock()
+	defer func() {
+		ln.lock.Lock()
+		ln.queued--
+		ln.lock.Unlock()
+	}()
+
+	start := time.Now()
+	defer newLaneWaitTimer(ln.name).UpdateDuration(start)
+	select {
+	case ln.workers <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
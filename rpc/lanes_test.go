@@ -0,0 +1,76 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLaneOf(t *testing.T) {
+	require.Equal(t, LaneLight, LaneOf("eth_blockNumber"))
+	require.Equal(t, LaneLight, LaneOf("eth_call"))
+	require.Equal(t, LaneHeavy, LaneOf("eth_getLogs"))
+	require.Equal(t, LaneHeavy, LaneOf("trace_block"))
+	require.Equal(t, LaneHeavy, LaneOf("debug_traceTransaction"))
+	require.Equal(t, LaneSubscription, LaneOf("eth_subscribe"))
+	require.Equal(t, LaneSubscription, LaneOf("eth_unsubscribe"))
+	require.Equal(t, LaneSubscription, LaneOf("eth_getFilterChanges"))
+}
+
+func TestParseLanes(t *testing.T) {
+	lanes, err := ParseLanes("light=64/1024, heavy=8/0")
+	require.NoError(t, err)
+	require.Equal(t, map[Lane]LaneConfig{LaneLight: {Workers: 64, Queue: 1024}, LaneHeavy: {Workers: 8, Queue: 0}}, lanes)
+
+	lanes, err = ParseLanes("")
+	require.NoError(t, err)
+	require.Empty(t, lanes)
+
+	for _, s := range []string{"light=64", "medium=1/1", "heavy=0/1", "heavy=1/-1", "heavy"} {
+		_, err = ParseLanes(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestLanesAcquire(t *testing.T) {
+	l := newLanes(map[Lane]LaneConfig{LaneHeavy: {Workers: 1, Queue: 1}})
+	ctx := context.Background()
+
+	release, err := l.acquire(ctx, "trace_block")
+	require.NoError(t, err)
+
+	// The second heavy call waits in the queue, the third one is rejected
+	acquired := make(chan func())
+	go func() {
+		r, err := l.acquire(ctx, "trace_block")
+		if err == nil {
+			acquired <- r
+		}
+	}()
+	require.Eventually(t, func() bool {
+		l[LaneHeavy].lock.Lock()
+		defer l[LaneHeavy].lock.Unlock()
+		return l[LaneHeavy].queued == 1
+	}, time.Second, time.Millisecond)
+	_, err = l.acquire(ctx, "trace_block")
+	require.Equal(t, &laneBusyError{lane: LaneHeavy}, err)
+
+	// The light calls are not held up by the heavy ones
+	releaseLight, err := l.acquire(ctx, "eth_blockNumber")
+	require.NoError(t, err)
+	releaseLight()
+
+	release()
+	(<-acquired)()
+
+	// A queued call gives up with its context
+	release, err = l.acquire(ctx, "trace_block")
+	require.NoError(t, err)
+	defer release()
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = l.acquire(cancelCtx, "trace_block")
+	require.ErrorIs(t, err, context.Canceled)
+}
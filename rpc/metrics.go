@@ -25,6 +25,10 @@ import (
 var (
 	rpcRequestGauge    = metrics.GetOrCreateCounter("rpc_total")
 	failedReqeustGauge = metrics.GetOrCreateCounter("rpc_failure")
+
+	droppedNotificationsCounter    = metrics.GetOrCreateCounter("rpc_ws_notifications_dropped")
+	slowClientsDisconnectedCounter = metrics.GetOrCreateCounter("rpc_ws_slow_clients_disconnected")
+	subscriptionsRejectedCounter   = metrics.GetOrCreateCounter("rpc_ws_subscriptions_rejected")
 )
 
 func newRPCServingTimerMS(method string, valid bool) *metrics.Summary {
@@ -35,3 +39,15 @@ func newRPCServingTimerMS(method string, valid bool) *metrics.Summary {
 	m := fmt.Sprintf(`rpc_duration_seconds{method="%s",success="%s"}`, method, flag)
 	return metrics.GetOrCreateSummary(m)
 }
+
+func newRateLimitedCounter(method string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`rpc_rate_limited{method="%s"}`, method))
+}
+
+func newLaneRejectedCounter(lane Lane) *metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`rpc_lane_rejected{lane="%s"}`, lane))
+}
+
+func newLaneWaitTimer(lane Lane) *metrics.Summary {
+	return metrics.GetOrCreateSummary(fmt.Sprintf(`rpc_lane_wait_seconds{lane="%s"}`, lane))
+}
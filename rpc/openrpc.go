@@ -0,0 +1,193 @@
+package rpc
+
+import (
+	"encoding"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OpenRPCVersion is the version of the OpenRPC specification of the document returned by rpc_discover
+const OpenRPCVersion = "1.2.6"
+
+var (
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	bigIntType          = reflect.TypeOf(big.Int{})
+)
+
+// OpenRPCDocument is the OpenRPC description of the methods served by a server, see https://spec.open-rpc.org
+type OpenRPCDocument struct {
+	OpenRPC    string            `json:"openrpc"`
+	Info       OpenRPCInfo       `json:"info"`
+	Methods    []OpenRPCMethod   `json:"methods"`
+	Components OpenRPCComponents `json:"components"`
+}
+
+type OpenRPCInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type OpenRPCMethod struct {
+	Name           string                     `json:"name"`
+	Params         []OpenRPCContentDescriptor `json:"params"`
+	Result         OpenRPCContentDescriptor   `json:"result"`
+	ParamStructure string                     `json:"paramStructure"`
+}
+
+type OpenRPCContentDescriptor struct {
+	Name     string        `json:"name"`
+	Required bool          `json:"required,omitempty"`
+	Schema   OpenRPCSchema `json:"schema"`
+}
+
+type OpenRPCComponents struct {
+	Schemas map[string]OpenRPCSchema `json:"schemas"`
+}
+
+// OpenRPCSchema is a JSON schema
+type OpenRPCSchema map[string]interface{}
+
+// Discover implements rpc_discover. Returns the OpenRPC document of the methods allowed on the server, generated from
+// the Go types of their parameters and results. The names of the parameters are positional, and the types with custom
+// JSON encodings are described as strings if they are text, otherwise by their Go type name only
+func (s *RPCService) Discover() *OpenRPCDocument {
+	s.server.services.mu.Lock()
+	defer s.server.services.mu.Unlock()
+
+	forbiddenList := newForbiddenList()
+	schemas := &openrpcSchemas{components: map[string]OpenRPCSchema{}}
+	doc := &OpenRPCDocument{
+		OpenRPC:    OpenRPCVersion,
+		Info:       OpenRPCInfo{Title: "Erigon JSON-RPC API", Version: "1.0"},
+		Methods:    []OpenRPCMethod{},
+		Components: OpenRPCComponents{Schemas: schemas.components},
+	}
+	for namespace, svc := range s.server.services.services {
+		for name, cb := range svc.callbacks {
+			method := namespace + serviceMethodSeparator + name
+			if !isMethodAllowed(s.server.methodAllowList, forbiddenList, method) {
+				continue
+			}
+			doc.Methods = append(doc.Methods, schemas.method(method, cb))
+		}
+	}
+	sort.Slice(doc.Methods, func(i, j int) bool { return doc.Methods[i].Name < doc.Methods[j].Name })
+	return doc
+}
+
+// openrpcSchemas generates the JSON schemas of the Go types, the named structs are added to the components
+type openrpcSchemas struct {
+	components map[string]OpenRPCSchema
+}
+
+func (g *openrpcSchemas) method(name string, cb *callback) OpenRPCMethod {
+	m := OpenRPCMethod{Name: name, Params: []OpenRPCContentDescriptor{}, ParamStructure: "by-position"}
+	for i, t := range cb.argTypes {
+		m.Params = append(m.Params, OpenRPCContentDescriptor{
+			Name:     "param" + strconv.Itoa(i+1),
+			Required: t.Kind() != reflect.Ptr,
+			Schema:   g.schema(t),
+		})
+	}
+	m.Result = OpenRPCContentDescriptor{Name: "result", Schema: OpenRPCSchema{"type": "null"}}
+	fntype := cb.fn.Type()
+	switch {
+	case cb.streamable:
+		m.Result.Schema = OpenRPCSchema{}
+	case fntype.NumOut() == 2 || (fntype.NumOut() == 1 && cb.errPos != 0):
+		m.Result.Schema = g.schema(fntype.Out(0))
+	}
+	return m
+}
+
+func (g *openrpcSchemas) schema(t reflect.Type) OpenRPCSchema {
+	if t.Kind() == reflect.Ptr {
+		return g.schema(t.Elem())
+	}
+	if t == bigIntType {
+		return OpenRPCSchema{"type": "integer"}
+	}
+	if implements(t, textMarshalerType) || implements(t, textUnmarshalerType) {
+		return OpenRPCSchema{"type": "string", "title": t.String()}
+	}
+	if implements(t, jsonMarshalerType) || implements(t, jsonUnmarshalerType) {
+		return OpenRPCSchema{"title": t.String()}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return OpenRPCSchema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return OpenRPCSchema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return OpenRPCSchema{"type": "number"}
+	case reflect.String:
+		return OpenRPCSchema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return OpenRPCSchema{"type": "string", "contentEncoding": "base64"}
+		}
+		return OpenRPCSchema{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return OpenRPCSchema{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := t.String()
+		if _, ok := g.components[name]; !ok {
+			g.components[name] = OpenRPCSchema{} // placeholder for the recursive types
+			g.components[name] = g.structSchema(t)
+		}
+		return OpenRPCSchema{"$ref": "#/components/schemas/" + name}
+	default:
+		return OpenRPCSchema{}
+	}
+}
+
+func (g *openrpcSchemas) structSchema(t reflect.Type) OpenRPCSchema {
+	properties := OpenRPCSchema{}
+	g.addProperties(t, properties)
+	return OpenRPCSchema{"type": "object", "properties": properties}
+}
+
+// addProperties adds the JSON fields of the struct to the properties, the fields of the embedded structs without a
+// tag are inlined like encoding/json does
+func (g *openrpcSchemas) addProperties(t reflect.Type, properties OpenRPCSchema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addProperties(ft, properties)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = g.schema(f.Type)
+	}
+}
+
+func implements(t, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PtrTo(t).Implements(iface)
+}
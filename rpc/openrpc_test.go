@@ -0,0 +1,46 @@
+package rpc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscover(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	doc := (&RPCService{server: server}).Discover()
+	require.Equal(t, OpenRPCVersion, doc.OpenRPC)
+	var echo *OpenRPCMethod
+	for i := range doc.Methods {
+		if i > 0 {
+			require.Less(t, doc.Methods[i-1].Name, doc.Methods[i].Name)
+		}
+		if doc.Methods[i].Name == "test_echo" {
+			echo = &doc.Methods[i]
+		}
+	}
+	require.NotNil(t, echo)
+	require.Equal(t, []OpenRPCContentDescriptor{
+		{Name: "param1", Required: true, Schema: OpenRPCSchema{"type": "string"}},
+		{Name: "param2", Required: true, Schema: OpenRPCSchema{"type": "integer"}},
+		{Name: "param3", Schema: OpenRPCSchema{"$ref": "#/components/schemas/rpc.echoArgs"}},
+	}, echo.Params)
+	require.Equal(t, OpenRPCSchema{"$ref": "#/components/schemas/rpc.echoResult"}, echo.Result.Schema)
+	require.Equal(t, OpenRPCSchema{"type": "object", "properties": OpenRPCSchema{
+		"String": OpenRPCSchema{"type": "string"},
+		"Int":    OpenRPCSchema{"type": "integer"},
+		"Args":   OpenRPCSchema{"$ref": "#/components/schemas/rpc.echoArgs"},
+	}}, doc.Components.Schemas["rpc.echoResult"])
+
+	_, err := json.Marshal(doc)
+	require.NoError(t, err)
+
+	// Only the allowed methods are described
+	server.SetAllowList(AllowList{"test_echo": {}})
+	doc = (&RPCService{server: server}).Discover()
+	require.Len(t, doc.Methods, 1)
+	require.Equal(t, "test_echo", doc.Methods[0].Name)
+}
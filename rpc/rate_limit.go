@@ -0,0 +1,155 @@
+package rpc
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	lru "github.com/hashicorp/golang-lru"
+	"golang.org/x/time/rate"
+)
+
+// RateLimitKeyHeader is the header of the requests with the API key of the client, see RateLimits
+const RateLimitKeyHeader = APIKeyHeader
+
+// rateLimitClients is the number of clients whose limiters are kept, the least recently seen ones are forgotten
+const rateLimitClients = 10_000
+
+// RateLimit is the limit of the calls of a method by a client
+type RateLimit struct {
+	Rate        float64 `json:"rate"`        // calls per second, 0 - unlimited
+	Burst       int     `json:"burst"`       // calls allowed at once above the rate, 0 - the rate rounded up
+	Concurrency int     `json:"concurrency"` // calls in progress at the same time, 0 - unlimited
+}
+
+// RateLimits are the limits of the calls per client. A client is identified by the RateLimitKeyHeader of the request
+// if the key is listed in Keys, otherwise by the IP address. The limit of a method is looked up in the limits of the
+// key, then in Methods; the "*" entry is the limit of each method which is not listed
+type RateLimits struct {
+	Methods map[string]RateLimit            `json:"methods"`
+	Keys    map[string]map[string]RateLimit `json:"keys"`
+}
+
+func (l *RateLimits) limit(key, method string) (RateLimit, bool) {
+	for _, methods := range []map[string]RateLimit{l.Keys[key], l.Methods} {
+		if limit, ok := methods[method]; ok {
+			return limit, true
+		}
+		if limit, ok := methods["*"]; ok {
+			return limit, true
+		}
+	}
+	return RateLimit{}, false
+}
+
+type rateLimiter struct {
+	limits  RateLimits
+	lock    sync.Mutex
+	clients *lru.Cache // client -> *clientLimiters
+}
+
+type clientLimiters struct {
+	lock    sync.Mutex
+	buckets map[string]*rate.Limiter // method -> token bucket
+	running map[string]int           // method -> calls in progress
+}
+
+func newRateLimiter(limits RateLimits) (*rateLimiter, error) {
+	clients, err := lru.New(rateLimitClients)
+	if err != nil {
+		return nil, err
+	}
+	return &rateLimiter{limits: limits, clients: clients}, nil
+}
+
+// clientRateLimit is the rate limiter of the calls of one connection
+type clientRateLimit struct {
+	limiter *rateLimiter
+	key     string // API key, empty if the client is identified by the IP address
+	client  string
+
+	calls, limited int32 // of the request, atomic, see allLimited
+}
+
+// forRequest returns the rate limiter of the calls of the HTTP request, nil if there are no limits
+func (l *rateLimiter) forRequest(r *http.Request) *clientRateLimit {
+	if l == nil {
+		return nil
+	}
+	if key := r.Header.Get(RateLimitKeyHeader); key != "" {
+		if _, ok := l.limits.Keys[key]; ok {
+			return &clientRateLimit{limiter: l, key: key, client: "key:" + key}
+		}
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return &clientRateLimit{limiter: l, client: "ip:" + ip}
+}
+
+func (l *rateLimiter) clientLimiters(client string) *clientLimiters {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if c, ok := l.clients.Get(client); ok {
+		return c.(*clientLimiters)
+	}
+	c := &clientLimiters{buckets: map[string]*rate.Limiter{}, running: map[string]int{}}
+	l.clients.Add(client, c)
+	return c
+}
+
+// allLimited returns true if the request had calls, and all of them were over the limits
+func (c *clientRateLimit) allLimited() bool {
+	limited := atomic.LoadInt32(&c.limited)
+	return limited > 0 && limited == atomic.LoadInt32(&c.calls)
+}
+
+// acquire returns rateLimitedError if the call of the method is over the limits, otherwise the function to call when
+// the call is done
+func (c *clientRateLimit) acquire(method string) (func(), error) {
+	atomic.AddInt32(&c.calls, 1)
+	release, err := c.tryAcquire(method)
+	if err != nil {
+		atomic.AddInt32(&c.limited, 1)
+	}
+	return release, err
+}
+
+func (c *clientRateLimit) tryAcquire(method string) (func(), error) {
+	limit, ok := c.limiter.limits.limit(c.key, method)
+	if !ok {
+		return func() {}, nil
+	}
+	limiters := c.limiter.clientLimiters(c.client)
+	limiters.lock.Lock()
+	defer limiters.lock.Unlock()
+	if limit.Concurrency > 0 && limiters.running[method] >= limit.Concurrency {
+		return nil, &rateLimitedError{method: method}
+	}
+	if limit.Rate > 0 {
+		bucket, ok := limiters.buckets[method]
+		if !ok {
+			burst := limit.Burst
+			if burst == 0 {
+				burst = int(math.Max(1, math.Ceil(limit.Rate)))
+			}
+			bucket = rate.NewLimiter(rate.Limit(limit.Rate), burst)
+			limiters.buckets[method] = bucket
+		}
+		if !bucket.Allow() {
+			return nil, &rateLimitedError{method: method}
+		}
+	}
+	if limit.Concurrency == 0 {
+		return func() {}, nil
+	}
+	limiters.running[method]++
+	return func() {
+		limiters.lock.Lock()
+		defer limiters.lock.Unlock()
+		limiters.running[method]--
+	}, nil
+}
@@ -0,0 +1,150 @@
+package rpc
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitsLookup(t *testing.T) {
+	limits := RateLimits{
+		Methods: map[string]RateLimit{"*": {Rate: 10}, "eth_call": {Rate: 100}},
+		Keys:    map[string]map[string]RateLimit{"key": {"eth_call": {Rate: 1000}}},
+	}
+	limit, ok := limits.limit("", "eth_call")
+	require.True(t, ok)
+	require.Equal(t, RateLimit{Rate: 100}, limit)
+	limit, ok = limits.limit("", "eth_getBalance")
+	require.True(t, ok)
+	require.Equal(t, RateLimit{Rate: 10}, limit)
+	limit, ok = limits.limit("key", "eth_call")
+	require.True(t, ok)
+	require.Equal(t, RateLimit{Rate: 1000}, limit)
+	limit, ok = limits.limit("key", "eth_getBalance")
+	require.True(t, ok)
+	require.Equal(t, RateLimit{Rate: 10}, limit)
+
+	_, ok = (&RateLimits{}).limit("", "eth_call")
+	require.False(t, ok)
+}
+
+func TestClientRateLimit(t *testing.T) {
+	limiter, err := newRateLimiter(RateLimits{Methods: map[string]RateLimit{
+		"test_sleep": {Concurrency: 2},
+		"test_echo":  {Rate: 0.001, Burst: 2},
+	}})
+	require.NoError(t, err)
+	client := &clientRateLimit{limiter: limiter, client: "ip:127.0.0.1"}
+
+	release1, err := client.acquire("test_sleep")
+	require.NoError(t, err)
+	release2, err := client.acquire("test_sleep")
+	require.NoError(t, err)
+	_, err = client.acquire("test_sleep")
+	require.Equal(t, &rateLimitedError{method: "test_sleep"}, err)
+	release1()
+	release3, err := client.acquire("test_sleep")
+	require.NoError(t, err)
+	release2()
+	release3()
+
+	for i := 0; i < 2; i++ {
+		_, err = client.acquire("test_echo")
+		require.NoError(t, err)
+	}
+	_, err = client.acquire("test_echo")
+	require.Error(t, err)
+
+	// Other clients and methods have their own limits
+	_, err = (&clientRateLimit{limiter: limiter, client: "ip:127.0.0.2"}).acquire("test_echo")
+	require.NoError(t, err)
+	_, err = client.acquire("test_rets")
+	require.NoError(t, err)
+}
+
+func TestHTTPRateLimited(t *testing.T) {
+	s := newTestServer()
+	defer s.Stop()
+	require.NoError(t, s.SetRateLimits(&RateLimits{
+		Methods: map[string]RateLimit{"test_rets": {Rate: 0.001, Burst: 1}},
+		Keys:    map[string]map[string]RateLimit{"key": {"test_rets": {Rate: 0.001, Burst: 2}}},
+	}))
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	post := func(body, key string) (int, string) {
+		req, err := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", contentType)
+		if key != "" {
+			req.Header.Set(RateLimitKeyHeader, key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		respBody, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(respBody)
+	}
+	call := `{"jsonrpc":"2.0","id":1,"method":"test_rets"}`
+
+	status, _ := post(call, "")
+	require.Equal(t, http.StatusOK, status)
+	status, body := post(call, "")
+	require.Equal(t, http.StatusTooManyRequests, status)
+	require.Contains(t, body, "-32005")
+
+	// An unknown key does not escape the limits of the IP address
+	status, _ = post(call, "unknown")
+	require.Equal(t, http.StatusTooManyRequests, status)
+	for i := 0; i < 2; i++ {
+		status, _ = post(call, "key")
+		require.Equal(t, http.StatusOK, status)
+	}
+
+	// The calls of a batch over the limits get the errors in the batch
+	status, body = post("["+call+","+`{"jsonrpc":"2.0","id":2,"method":"test_echo","params":["x",1]}`+"]", "")
+	require.Equal(t, http.StatusOK, status)
+	require.Contains(t, body, "rate limit exceeded for test_rets")
+	require.Contains(t, body, `"id":2,"result"`)
+}
+
+// TestHTTPRateLimitedBatch runs the calls of the batches in parallel, see it with -race
+func TestHTTPRateLimitedBatch(t *testing.T) {
+	s := newTestServer()
+	defer s.Stop()
+	require.NoError(t, s.SetRateLimits(&RateLimits{Methods: map[string]RateLimit{"test_rets": {Rate: 0.001, Burst: 4}}}))
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	batch := func(calls int, method string) string {
+		var b strings.Builder
+		for i := 0; i < calls; i++ {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(&b, `{"jsonrpc":"2.0","id":%d,"method":"%s"}`, i, method)
+		}
+		return "[" + b.String() + "]"
+	}
+	post := func(body string) int {
+		resp, err := http.Post(ts.URL, contentType, strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		_, err = io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	// Some of the calls are over the limits
+	require.Equal(t, http.StatusOK, post(batch(16, "test_rets")))
+	// All of them
+	require.Equal(t, http.StatusTooManyRequests, post(batch(16, "test_rets")))
+	// None of them is limited
+	require.Equal(t, http.StatusOK, post(batch(16, "test_noArgsRets")))
+}
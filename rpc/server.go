@@ -52,6 +52,13 @@ type Server struct {
 	batchConcurrency uint
 	disableStreaming bool
 	traceRequests    bool // Whether to print requests at INFO level
+
+	callBudgetSecret []byte               // JWT secret of the requests which may raise the call budget, nil - CallBudgetHeader is ignored
+	rateLimiter      *rateLimiter         // nil - the calls are not rate limited
+	lanes            lanes                // nil - the calls are not queued by lane
+	subLimiter       *subscriptionLimiter // nil - the websocket subscriptions are not limited
+	apiKeys          apiKeyStore
+	audit            *auditLog // nil - the calls are not audited
 }
 
 // NewServer creates a new server instance with no registered handlers.
@@ -61,14 +68,88 @@ func NewServer(batchConcurrency uint, traceRequests, disableStreaming bool) *Ser
 	// as the services and methods it offers.
 	rpcService := &RPCService{server: server}
 	server.RegisterName(MetadataApi, rpcService)
+	server.SetStreamedArrayMethods(DefaultStreamedArrayMethods)
 	return server
 }
 
+// DefaultStreamedArrayMethods are the methods whose large array results are sent in chunks by default. The methods
+// with a parameter of type *jsoniter.Stream (e.g. trace_filter) write their results as they produce them anyway
+var DefaultStreamedArrayMethods = []string{"eth_getLogs"}
+
+// SetStreamedArrayMethods sets the methods whose array results of streamedArrayMinLen elements or more are sent in
+// chunks as they are written, instead of being encoded in memory as a whole
+func (s *Server) SetStreamedArrayMethods(methods []string) {
+	s.services.setStreamedArrays(methods)
+}
+
 // SetAllowList sets the allow list for methods that are handled by this server
 func (s *Server) SetAllowList(allowList AllowList) {
 	s.methodAllowList = allowList
 }
 
+// SetCallBudgetSecret sets the JWT secret of the HTTP requests which may raise the budget of the calls by the
+// CallBudgetHeader
+func (s *Server) SetCallBudgetSecret(secret []byte) {
+	s.callBudgetSecret = secret
+}
+
+// SetRateLimits sets the limits of the calls per client of the HTTP and websocket connections, nil - no limits
+func (s *Server) SetRateLimits(limits *RateLimits) error {
+	if limits == nil {
+		s.rateLimiter = nil
+		return nil
+	}
+	limiter, err := newRateLimiter(*limits)
+	if err != nil {
+		return err
+	}
+	s.rateLimiter = limiter
+	return nil
+}
+
+// SetAPIKeys sets the API keys required from the clients of the HTTP and websocket connections and the methods each of
+// them may call, nil - no key is required. It may be called while the server is running, e.g. to reload the keys
+func (s *Server) SetAPIKeys(keys APIKeys) error {
+	return s.apiKeys.set(keys)
+}
+
+// SetAuditLog sets the writer of the audit log of the calls, which gets a JSON line (AuditRecord) per call selected by
+// cfg, nil - the calls are not audited
+func (s *Server) SetAuditLog(w io.Writer, cfg AuditConfig) error {
+	if w == nil {
+		s.audit = nil
+		return nil
+	}
+	audit, err := newAuditLog(w, cfg)
+	if err != nil {
+		return err
+	}
+	s.audit = audit
+	return nil
+}
+
+// SetSubscriptionLimits sets the limits of the send queues and the subscriptions of the websocket connections
+func (s *Server) SetSubscriptionLimits(limits SubscriptionLimits) error {
+	if err := limits.validate(); err != nil {
+		return err
+	}
+	if limits.SendQueue == 0 && limits.PerClient == 0 {
+		s.subLimiter = nil
+		return nil
+	}
+	s.subLimiter = newSubscriptionLimiter(limits)
+	return nil
+}
+
+// SetLanes sets the worker pools of the lanes of the calls, see ParseLanes
+func (s *Server) SetLanes(cfg map[Lane]LaneConfig) {
+	if len(cfg) == 0 {
+		s.lanes = nil
+		return
+	}
+	s.lanes = newLanes(cfg)
+}
+
 // RegisterName creates a service for the given receiver type under the given name. When no
 // methods on the given receiver match the criteria to be either a RPC method or a
 // subscription an error is returned. Otherwise a new service is created and added to the
@@ -83,6 +164,10 @@ func (s *Server) RegisterName(name string, receiver interface{}) error {
 //
 // Note that codec options are no longer supported.
 func (s *Server) ServeCodec(codec ServerCodec, options CodecOption) {
+	s.serveCodec(codec, nil, nil, nil)
+}
+
+func (s *Server) serveCodec(codec ServerCodec, rateLimit *clientRateLimit, subs *clientSubscriptions, apiKey *clientAPIKey) {
 	defer codec.close()
 
 	// Don't serve if server is stopped.
@@ -94,7 +179,7 @@ func (s *Server) ServeCodec(codec ServerCodec, options CodecOption) {
 	s.codecs.Add(codec)
 	defer s.codecs.Remove(codec)
 
-	c := initClient(codec, s.idgen, &s.services)
+	c := initClient(codec, s.idgen, &s.services, rateLimit, s.lanes, subs, apiKey, s.audit)
 	<-codec.closed()
 	c.Close()
 }
@@ -102,7 +187,7 @@ func (s *Server) ServeCodec(codec ServerCodec, options CodecOption) {
 // serveSingleRequest reads and processes a single RPC request from the given codec. This
 // is used to serve HTTP connections. Subscriptions and reverse calls are not allowed in
 // this mode.
-func (s *Server) serveSingleRequest(ctx context.Context, codec ServerCodec, stream *jsoniter.Stream) {
+func (s *Server) serveSingleRequest(ctx context.Context, codec ServerCodec, stream *jsoniter.Stream, rateLimit *clientRateLimit, apiKey *clientAPIKey) {
 	// Don't serve if server is stopped.
 	if atomic.LoadInt32(&s.run) == 0 {
 		return
@@ -110,6 +195,10 @@ func (s *Server) serveSingleRequest(ctx context.Context, codec ServerCodec, stre
 
 	h := newHandler(ctx, codec, s.idgen, &s.services, s.methodAllowList, s.batchConcurrency, s.traceRequests)
 	h.allowSubscribe = false
+	h.rateLimit = rateLimit
+	h.lanes = s.lanes
+	h.apiKey = apiKey
+	h.audit = s.audit
 	defer h.close(io.EOF, nil)
 
 	reqs, batch, err := codec.readBatch()
@@ -39,8 +39,9 @@ var (
 )
 
 type serviceRegistry struct {
-	mu       sync.Mutex
-	services map[string]service
+	mu             sync.Mutex
+	services       map[string]service
+	streamedArrays map[string]struct{} // methods whose large array results are sent in chunks
 }
 
 // service represents a registered object.
@@ -106,6 +107,25 @@ func (r *serviceRegistry) callback(method string) *callback {
 	return r.services[elem[0]].callbacks[elem[1]]
 }
 
+// setStreamedArrays replaces the methods whose large array results are sent in chunks
+func (r *serviceRegistry) setStreamedArrays(methods []string) {
+	streamedArrays := make(map[string]struct{}, len(methods))
+	for _, method := range methods {
+		streamedArrays[method] = struct{}{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.streamedArrays = streamedArrays
+}
+
+// streamedArray returns whether the large array results of the method are sent in chunks
+func (r *serviceRegistry) streamedArray(method string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.streamedArrays[method]
+	return ok
+}
+
 // subscription returns a subscription callback in the given service.
 func (r *serviceRegistry) subscription(service, name string) *callback {
 	r.mu.Lock()
@@ -93,6 +93,7 @@ func NotifierFromContext(ctx context.Context) (*Notifier, bool) {
 type Notifier struct {
 	h         *handler
 	namespace string
+	release   func() // frees the slot of the subscription in the SubscriptionLimits of the client, nil - unlimited
 
 	mu           sync.Mutex
 	sub          *Subscription
@@ -174,12 +175,16 @@ func (n *Notifier) activate() error {
 
 func (n *Notifier) send(sub *Subscription, data json.RawMessage) error {
 	params, _ := json.Marshal(&subscriptionResult{ID: string(sub.ID), Result: data})
-	ctx := context.Background()
-	return n.h.conn.writeJSON(ctx, &jsonrpcMessage{
+	msg := &jsonrpcMessage{
 		Version: vsn,
 		Method:  n.namespace + notificationMethodSuffix,
 		Params:  params,
-	})
+	}
+	if n.h.sendQueue != nil {
+		return n.h.sendQueue.push(msg)
+	}
+	ctx := context.Background()
+	return n.h.conn.writeJSON(ctx, msg)
 }
 
 // A Subscription is created by a notifier and tied to that notifier. The client can use
@@ -188,6 +193,7 @@ type Subscription struct {
 	ID        ID
 	namespace string
 	err       chan error // closed on unsubscribe
+	release   func()     // see Notifier.release
 }
 
 // Err returns a channel that is closed when the client send an unsubscribe request.
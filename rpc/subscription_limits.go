@@ -0,0 +1,149 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/ledgerwatch/log/v3"
+)
+
+// SendQueuePolicy is what happens to a notification for a websocket connection whose send queue is full
+type SendQueuePolicy string
+
+const (
+	SendQueueDrop       SendQueuePolicy = "drop"       // the notification is dropped
+	SendQueueDisconnect SendQueuePolicy = "disconnect" // the connection is closed
+)
+
+// ErrSendQueueFull is returned by Notifier.Notify when the connection was closed because its send queue is full
+var ErrSendQueueFull = errors.New("send queue of the connection is full, the client is too slow")
+
+// ErrNotificationDropped is returned by Notify when the send queue of the connection is full and the notification was
+// dropped by SendQueueDrop. The subscriptions whose notifications must all arrive, like the streams, end on it
+var ErrNotificationDropped = errors.New("notification dropped, the send queue of the connection is full")
+
+// SubscriptionLimits bound the notifications held for the slow websocket clients, and their subscriptions
+type SubscriptionLimits struct {
+	SendQueue int             // notifications queued per connection, 0 - they are written by the notifying goroutine
+	Policy    SendQueuePolicy // of the notifications over SendQueue, empty - SendQueueDrop
+	PerClient int             // subscriptions per client IP address, 0 - unlimited
+}
+
+func (l SubscriptionLimits) validate() error {
+	if l.SendQueue < 0 || l.PerClient < 0 {
+		return fmt.Errorf("negative limits: send queue %d, subscriptions per client %d", l.SendQueue, l.PerClient)
+	}
+	switch l.Policy {
+	case "", SendQueueDrop, SendQueueDisconnect:
+		return nil
+	default:
+		return fmt.Errorf("unknown send queue policy %q, expected %s or %s", l.Policy, SendQueueDrop, SendQueueDisconnect)
+	}
+}
+
+type subscriptionLimiter struct {
+	limits SubscriptionLimits
+	lock   sync.Mutex
+	subs   map[string]int // client -> active subscriptions
+}
+
+func newSubscriptionLimiter(limits SubscriptionLimits) *subscriptionLimiter {
+	if limits.Policy == "" {
+		limits.Policy = SendQueueDrop
+	}
+	return &subscriptionLimiter{limits: limits, subs: map[string]int{}}
+}
+
+// clientSubscriptions are the limits of the subscriptions of one websocket connection
+type clientSubscriptions struct {
+	limiter *subscriptionLimiter
+	client  string
+}
+
+// forRequest returns the limits of the subscriptions of the websocket connection of the request, nil if there are none
+func (l *subscriptionLimiter) forRequest(r *http.Request) *clientSubscriptions {
+	if l == nil {
+		return nil
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return &clientSubscriptions{limiter: l, client: ip}
+}
+
+// acquire returns tooManySubscriptionsError if the client has PerClient subscriptions, otherwise the function to call
+// when the subscription is gone
+func (c *clientSubscriptions) acquire() (func(), error) {
+	l := c.limiter
+	if l.limits.PerClient == 0 {
+		return func() {}, nil
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.subs[c.client] >= l.limits.PerClient {
+		subscriptionsRejectedCounter.Inc()
+		return nil, &tooManySubscriptionsError{max: l.limits.PerClient}
+	}
+	l.subs[c.client]++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.lock.Lock()
+			defer l.lock.Unlock()
+			if l.subs[c.client]--; l.subs[c.client] <= 0 {
+				delete(l.subs, c.client)
+			}
+		})
+	}, nil
+}
+
+// sendQueue writes the notifications of a connection in its own goroutine, so that a slow client holds at most
+// SendQueue of them instead of blocking the producers of the notifications, e.g. rpchelper.Filters
+type sendQueue struct {
+	codec  ServerCodec
+	policy SendQueuePolicy
+	queue  chan *jsonrpcMessage
+}
+
+func newSendQueue(codec ServerCodec, limits SubscriptionLimits) *sendQueue {
+	q := &sendQueue{codec: codec, policy: limits.Policy, queue: make(chan *jsonrpcMessage, limits.SendQueue)}
+	go q.run()
+	return q
+}
+
+func (q *sendQueue) run() {
+	for {
+		select {
+		case msg := <-q.queue:
+			if err := q.codec.writeJSON(context.Background(), msg); err != nil {
+				log.Trace("Failed to write notification", "remote", q.codec.remoteAddr(), "err", err)
+			}
+		case <-q.codec.closed():
+			return
+		}
+	}
+}
+
+// push queues the notification, or applies the policy if the queue is full
+func (q *sendQueue) push(msg *jsonrpcMessage) error {
+	select {
+	case q.queue <- msg:
+		return nil
+	case <-q.codec.closed():
+		return ErrClientQuit
+	default:
+	}
+	if q.policy == SendQueueDisconnect {
+		log.Debug("Closing websocket connection with a full send queue", "remote", q.codec.remoteAddr())
+		slowClientsDisconnectedCounter.Inc()
+		q.codec.close()
+		return ErrSendQueueFull
+	}
+	droppedNotificationsCounter.Inc()
+	return ErrNotificationDropped
+}
@@ -0,0 +1,110 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriptionsPerClient(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Stop()
+	require.NoError(t, srv.SetSubscriptionLimits(SubscriptionLimits{PerClient: 1}))
+	httpsrv := httptest.NewServer(srv.WebsocketHandler([]string{"*"}, nil, false))
+	defer httpsrv.Close()
+	wsURL := "ws:" + strings.TrimPrefix(httpsrv.URL, "http:")
+
+	ctx := context.Background()
+	client, err := DialWebsocket(ctx, wsURL, "")
+	require.NoError(t, err)
+	defer client.Close()
+	sub, err := client.Subscribe(ctx, "nftest", make(chan int), "someSubscription", 0, 0)
+	require.NoError(t, err)
+
+	// The limit is shared by the connections of the client
+	other, err := DialWebsocket(ctx, wsURL, "")
+	require.NoError(t, err)
+	defer other.Close()
+	_, err = other.Subscribe(ctx, "nftest", make(chan int), "someSubscription", 0, 0)
+	require.EqualError(t, err, "too many subscriptions, max 1 per client")
+
+	// The failed subscribe calls don't hold the slot, the unsubscribed ones release it
+	sub.Unsubscribe()
+	require.Eventually(t, func() bool {
+		sub, err := other.Subscribe(ctx, "nftest", make(chan int), "someSubscription", 0, 0)
+		if err != nil {
+			return false
+		}
+		sub.Unsubscribe()
+		return true
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSetSubscriptionLimits(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Stop()
+	require.NoError(t, srv.SetSubscriptionLimits(SubscriptionLimits{}))
+	require.Nil(t, srv.subLimiter)
+	require.NoError(t, srv.SetSubscriptionLimits(SubscriptionLimits{SendQueue: 16}))
+	require.Equal(t, SendQueueDrop, srv.subLimiter.limits.Policy)
+	require.Error(t, srv.SetSubscriptionLimits(SubscriptionLimits{SendQueue: 16, Policy: "block"}))
+	require.Error(t, srv.SetSubscriptionLimits(SubscriptionLimits{PerClient: -1}))
+}
+
+func TestSendQueue(t *testing.T) {
+	msg := &jsonrpcMessage{Version: vsn, Method: "nftest" + notificationMethodSuffix}
+
+	// The writes of a slow client block, the notifications over the queue are dropped
+	codec := newStalledCodec()
+	q := newSendQueue(codec, SubscriptionLimits{SendQueue: 1, Policy: SendQueueDrop})
+	dropped := droppedNotificationsCounter.Get()
+	err := q.push(msg)
+	for i := 0; i < 3 && err == nil; i++ {
+		err = q.push(msg)
+	}
+	require.Equal(t, ErrNotificationDropped, err)
+	require.Greater(t, droppedNotificationsCounter.Get(), dropped)
+	codec.close()
+
+	// or the client is disconnected
+	codec = newStalledCodec()
+	q = newSendQueue(codec, SubscriptionLimits{SendQueue: 1, Policy: SendQueueDisconnect})
+	err = nil
+	for i := 0; i < 3 && err == nil; i++ {
+		err = q.push(msg)
+	}
+	require.Equal(t, ErrSendQueueFull, err)
+	select {
+	case <-codec.closed():
+	default:
+		t.Fatal("connection of the slow client is not closed")
+	}
+}
+
+// stalledCodec is the connection of a client which doesn't read the messages
+type stalledCodec struct {
+	closeOnce sync.Once
+	closeCh   chan interface{}
+}
+
+func newStalledCodec() *stalledCodec { return &stalledCodec{closeCh: make(chan interface{})} }
+
+func (c *stalledCodec) readBatch() ([]*jsonrpcMessage, bool, error) {
+	<-c.closeCh
+	return nil, false, errors.New("closed")
+}
+
+func (c *stalledCodec) writeJSON(ctx context.Context, _ interface{}) error {
+	<-c.closeCh
+	return errors.New("closed")
+}
+
+func (c *stalledCodec) close()                     { c.closeOnce.Do(func() { close(c.closeCh) }) }
+func (c *stalledCodec) closed() <-chan interface{} { return c.closeCh }
+func (c *stalledCodec) remoteAddr() string         { return "stalled" }
@@ -20,6 +20,7 @@ import (
 	"context"
 	"encoding/binary"
 	"errors"
+	"math"
 	"strings"
 	"sync"
 	"time"
@@ -89,6 +90,10 @@ func (s *testService) Block(ctx context.Context) error {
 	return errors.New("context canceled in testservice_block")
 }
 
+func (s *testService) Caller(ctx context.Context) string {
+	return CallerFromContext(ctx)
+}
+
 func (s *testService) Rets() (string, error) {
 	return "", nil
 }
@@ -204,3 +209,18 @@ type largeRespService struct {
 func (x largeRespService) LargeResp() string {
 	return strings.Repeat("x", x.length)
 }
+
+func (x largeRespService) LargeArray() []int {
+	array := make([]int, x.length)
+	for i := range array {
+		array[i] = i
+	}
+	return array
+}
+
+// InvalidArray returns an array whose last element can not be encoded
+func (x largeRespService) InvalidArray() []float64 {
+	array := make([]float64, x.length)
+	array[len(array)-1] = math.Inf(1)
+	return array
+}
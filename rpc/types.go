@@ -20,6 +20,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"math"
 	"strconv"
 	"strings"
@@ -67,6 +68,12 @@ type jsonWriter interface {
 	remoteAddr() string
 }
 
+// streamingCodec is implemented by the codecs which can send a response while it is being encoded. The responses of
+// the other codecs, and of these codecs if newStreamWriter returns nil, are encoded in memory first
+type streamingCodec interface {
+	newStreamWriter(ctx context.Context) io.WriteCloser
+}
+
 type BlockNumber int64
 type Timestamp uint64
 
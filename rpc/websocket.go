@@ -17,9 +17,11 @@
 package rpc
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
@@ -38,6 +40,7 @@ const (
 	wsPingInterval     = 60 * time.Second
 	wsPingWriteTimeout = 5 * time.Second
 	wsMessageSizeLimit = 32 * 1024 * 1024
+	wsStreamSpoolSize  = 1024 * 1024 // responses up to this size are encoded in memory before they are sent
 )
 
 var wsBufferPool = new(sync.Pool)
@@ -58,13 +61,19 @@ func (s *Server) WebsocketHandler(allowedOrigins []string, jwtSecret []byte, com
 		if jwtSecret != nil && !CheckJwtSecret(w, r, jwtSecret) {
 			return
 		}
+		apiKey, err := s.apiKeys.forRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			log.Warn("WebSocket upgrade failed", "err", err)
 			return
 		}
 		codec := newWebsocketCodec(conn)
-		s.ServeCodec(codec, 0)
+		codec.(*websocketCodec).disableStreaming = s.disableStreaming
+		s.serveCodec(codec, s.rateLimiter.forRequest(r), s.subLimiter.forRequest(r), apiKey)
 	})
 }
 
@@ -240,8 +249,9 @@ type websocketCodec struct {
 	*jsonCodec
 	conn *websocket.Conn
 
-	wg        sync.WaitGroup
-	pingReset chan struct{}
+	wg               sync.WaitGroup
+	pingReset        chan struct{}
+	disableStreaming bool // the responses are encoded in memory as a whole before they are sent
 }
 
 func newWebsocketCodec(conn *websocket.Conn) ServerCodec {
@@ -251,6 +261,7 @@ func newWebsocketCodec(conn *websocket.Conn) ServerCodec {
 		conn:      conn,
 		pingReset: make(chan struct{}, 1),
 	}
+	wc.remote = conn.RemoteAddr().String()
 	wc.wg.Add(1)
 	go wc.pingLoop()
 	return wc
@@ -273,6 +284,99 @@ func (wc *websocketCodec) writeJSON(ctx context.Context, v interface{}) error {
 	return err
 }
 
+// newStreamWriter returns the writer of a single websocket message. Up to wsStreamSpoolSize, the message is spooled
+// into memory and sent as a whole when it is complete, so the encoder is only held while it is sent. A larger message
+// is sent in frames as the response is produced instead, and holds the encoder until it is closed, so a peer which
+// does not read the response also blocks the notifications and the other responses of the connection (backpressure).
+// Returns nil if streaming is disabled
+func (wc *websocketCodec) newStreamWriter(ctx context.Context) io.WriteCloser {
+	if wc.disableStreaming {
+		return nil
+	}
+	return &wsStreamWriter{wc: wc, ctx: ctx}
+}
+
+// wsStreamWriter opens the message when the spool overflows or when it is closed, so nothing is sent for the calls
+// without a response
+type wsStreamWriter struct {
+	wc    *websocketCodec
+	ctx   context.Context
+	spool bytes.Buffer
+	w     io.WriteCloser
+	err   error
+}
+
+func (sw *wsStreamWriter) Write(p []byte) (int, error) {
+	if sw.err != nil {
+		return 0, sw.err
+	}
+	if sw.w == nil {
+		if sw.spool.Len()+len(p) <= wsStreamSpoolSize {
+			return sw.spool.Write(p)
+		}
+		if sw.open() != nil {
+			return 0, sw.err
+		}
+		if _, sw.err = sw.w.Write(sw.spool.Bytes()); sw.err != nil {
+			return 0, sw.err
+		}
+		sw.spool = bytes.Buffer{}
+	} else {
+		sw.setDeadline()
+	}
+	var n int
+	n, sw.err = sw.w.Write(p)
+	return n, sw.err
+}
+
+// open takes the encoder and starts the message
+func (sw *wsStreamWriter) open() error {
+	sw.wc.encMu.Lock()
+	sw.setDeadline()
+	if sw.w, sw.err = sw.wc.conn.NextWriter(websocket.TextMessage); sw.err != nil {
+		sw.w = nil
+		sw.wc.encMu.Unlock()
+	}
+	return sw.err
+}
+
+// setDeadline limits the time of every write without a deadline of the call, not of the whole message, so a slow
+// peer can still receive a large response as long as it keeps reading
+func (sw *wsStreamWriter) setDeadline() {
+	deadline, ok := sw.ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultWriteTimeout)
+	}
+	sw.wc.conn.SetWriteDeadline(deadline) //nolint:errcheck
+}
+
+func (sw *wsStreamWriter) Close() error {
+	if sw.w == nil {
+		if sw.err != nil || sw.spool.Len() == 0 {
+			return sw.err
+		}
+		// The whole message is spooled
+		if sw.open() != nil {
+			return sw.err
+		}
+		_, sw.err = sw.w.Write(sw.spool.Bytes())
+	}
+	err := sw.w.Close()
+	sw.w = nil
+	sw.wc.encMu.Unlock()
+	if sw.err == nil {
+		sw.err = err
+	}
+	if sw.err == nil {
+		// Notify pingLoop to delay the next idle ping.
+		select {
+		case sw.wc.pingReset <- struct{}{}:
+		default:
+		}
+	}
+	return sw.err
+}
+
 // pingLoop sends periodic ping frames when the connection is idle.
 func (wc *websocketCodec) pingLoop() {
 	timer := time.NewTimer(wsPingInterval)
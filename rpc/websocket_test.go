@@ -18,6 +18,8 @@ package rpc
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -189,6 +191,91 @@ func TestClientWebsocketLargeMessage(t *testing.T) {
 	}
 }
 
+// This checks that the array results streamed in chunks over websocket are received whole, both spooled and sent
+// in frames as they are produced.
+func TestClientWebsocketLargeArray(t *testing.T) {
+	var (
+		srv     = NewServer(50, false /* traceRequests */, false)
+		httpsrv = httptest.NewServer(srv.WebsocketHandler(nil, nil, false))
+		wsURL   = "ws:" + strings.TrimPrefix(httpsrv.URL, "http:")
+	)
+	defer srv.Stop()
+	defer httpsrv.Close()
+
+	srv.SetStreamedArrayMethods([]string{"test1000_largeArray", fmt.Sprintf("test%d_largeArray", wsStreamSpoolSize/2)})
+	for _, respLength := range []int{1000, wsStreamSpoolSize / 2} { // the larger array is encoded in more than wsStreamSpoolSize
+		name := fmt.Sprintf("test%d", respLength)
+		if err := srv.RegisterName(name, largeRespService{respLength}); err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := DialWebsocket(context.Background(), wsURL, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ { // the connection is usable after the streamed response
+			var r []int
+			if err := c.Call(&r, name+"_largeArray"); err != nil {
+				t.Fatal("call failed:", err)
+			}
+			if len(r) != respLength {
+				t.Fatalf("response has wrong length %d, want %d", len(r), respLength)
+			}
+			for j, v := range r {
+				if v != j {
+					t.Fatalf("wrong element %d at %d", v, j)
+				}
+			}
+		}
+		c.Close()
+	}
+}
+
+// This checks that a streamed array result with an element which can not be encoded gets an error response, without
+// any part of the result unless a part was sent already.
+func TestClientWebsocketLargeArrayError(t *testing.T) {
+	var (
+		srv     = NewServer(50, false /* traceRequests */, false)
+		httpsrv = httptest.NewServer(srv.WebsocketHandler(nil, nil, false))
+		wsURL   = "ws:" + strings.TrimPrefix(httpsrv.URL, "http:")
+	)
+	defer srv.Stop()
+	defer httpsrv.Close()
+	if err := srv.RegisterName("test", largeRespService{1000}); err != nil {
+		t.Fatal(err)
+	}
+	// the invalid element comes after the first streamedArrayFlushSize bytes, written already
+	if err := srv.RegisterName("testflushed", largeRespService{streamedArrayFlushSize}); err != nil {
+		t.Fatal(err)
+	}
+	srv.SetStreamedArrayMethods([]string{"test_invalidArray", "testflushed_invalidArray"})
+
+	c, err := DialWebsocket(context.Background(), wsURL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var r json.RawMessage
+	if err := c.Call(&r, "test_invalidArray"); err == nil || !strings.Contains(err.Error(), "unsupported value") {
+		t.Fatalf("wrong error %v", err)
+	}
+	if r != nil {
+		t.Fatalf("unexpected result of %d bytes", len(r))
+	}
+	// the connection is usable after the error
+	var s string
+	if err := c.Call(&s, "test_largeResp"); err != nil {
+		t.Fatal("call failed:", err)
+	}
+	// the response has the error after the part of the result
+	if err := c.Call(&r, "testflushed_invalidArray"); err == nil || !strings.Contains(err.Error(), "unsupported value") {
+		t.Fatalf("wrong error %v", err)
+	}
+	if err := c.Call(&s, "test_largeResp"); err != nil {
+		t.Fatal("call failed:", err)
+	}
+}
+
 // wsPingTestServer runs a WebSocket server which accepts a single subscription request.
 // When a value arrives on sendPing, the server sends a ping frame, waits for a matching
 // pong and finally delivers a single subscription result.
@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"runtime"
 
+	"github.com/c2h5oh/datasize"
 	"github.com/holiman/uint256"
 	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/common/cmp"
@@ -19,6 +20,7 @@ import (
 	"github.com/ledgerwatch/erigon-lib/etl"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon/cmd/downloader/downloader"
 	"github.com/ledgerwatch/erigon/cmd/hack/tool"
 	"github.com/ledgerwatch/erigon/cmd/utils"
 	"github.com/ledgerwatch/erigon/core/rawdb"
@@ -61,6 +63,16 @@ var snapshotCommand = cli.Command{
 				SnapshotRebuildFlag,
 			}, debug.Flags...),
 		},
+		{
+			Name:   "verify",
+			Action: doVerifyCommand,
+			Usage:  "Check hashes of segments, indices and blocks continuity. Run it before start of Erigon",
+			Before: func(ctx *cli.Context) error { return debug.Setup(ctx) },
+			Flags: append([]cli.Flag{
+				utils.DataDirFlag,
+				SnapshotRepairFlag,
+			}, debug.Flags...),
+		},
 		{
 			Name:   "retire",
 			Action: doRetireCommand,
@@ -114,6 +126,10 @@ var (
 		Name:  "rebuild",
 		Usage: "Force rebuild",
 	}
+	SnapshotRepairFlag = cli.BoolFlag{
+		Name:  "repair",
+		Usage: "Rebuild broken indices and remove broken segments - Erigon will download them again",
+	}
 )
 
 func doIndicesCommand(cliCtx *cli.Context) error {
@@ -129,14 +145,108 @@ func doIndicesCommand(cliCtx *cli.Context) error {
 
 	if rebuild {
 		cfg := ethconfig.NewSnapCfg(true, true, false)
-		workers := cmp.InRange(1, 4, runtime.GOMAXPROCS(-1)-1)
-		if err := rebuildIndices(ctx, chainDB, cfg, dirs, from, workers); err != nil {
+		workers := cmp.Max(1, runtime.GOMAXPROCS(-1)-1)
+		if err := rebuildIndices(ctx, chainDB, cfg, dirs, from, workers, 4*etl.BufferOptimalSize); err != nil {
 			log.Error("Error", "err", err)
 		}
 	}
 	return nil
 }
 
+func doVerifyCommand(cliCtx *cli.Context) error {
+	ctx, cancel := common.RootContext()
+	defer cancel()
+
+	dirs := datadir.New(cliCtx.String(utils.DataDirFlag.Name))
+	repair := cliCtx.Bool(SnapshotRepairFlag.Name)
+
+	chainDB := mdbx.NewMDBX(log.New()).Path(dirs.Chaindata).Readonly().MustOpen()
+	chainConfig := tool.ChainConfigFromDB(chainDB)
+	chainDB.Close()
+	chainID, _ := uint256.FromBig(chainConfig.ChainID)
+
+	brokenData, err := downloader.BrokenDataFiles(ctx, dirs.Snap)
+	if err != nil {
+		return err
+	}
+	report, err := snapshotsync.VerifySegments(ctx, dirs.Snap, *chainID, log.LvlInfo)
+	if err != nil {
+		return err
+	}
+	for _, name := range brokenData {
+		if _, ok := report.Segments[name]; !ok {
+			report.Segments[name] = fmt.Errorf("hash mismatch with .torrent file")
+		}
+	}
+
+	for _, r := range report.Gaps {
+		log.Warn("[snapshots] Missing segments", "blocks", r.String())
+	}
+	for name, err := range report.Segments {
+		log.Warn("[snapshots] Broken segment", "file", name, "err", err)
+	}
+	for name, err := range report.Indices {
+		log.Warn("[snapshots] Broken index", "file", name, "err", err)
+	}
+	if report.Ok() {
+		log.Info("[snapshots] Verify done, no broken files")
+		return nil
+	}
+	if !repair {
+		return fmt.Errorf("found %d broken segments and %d broken indices, use --%s to fix them", len(report.Segments), len(report.Indices), SnapshotRepairFlag.Name)
+	}
+	return repairSnapshots(ctx, dirs, *chainID, report)
+}
+
+// repairSnapshots - removes broken .seg files which have .torrent file (Downloader will download them again on next
+// start of Erigon) and broken .idx files, then builds missing indices. Segments without .torrent file can't be repaired
+func repairSnapshots(ctx context.Context, dirs datadir.Dirs, chainID uint256.Int, report *snapshotsync.VerifyReport) error {
+	var unrepairable []string
+	var removedSegments bool
+	for name := range report.Segments {
+		f, err := snap.ParseFileName(dirs.Snap, name)
+		if err != nil {
+			return err
+		}
+		if !f.TorrentFileExists() {
+			unrepairable = append(unrepairable, name)
+			continue
+		}
+		toRemove := []string{f.Path, filepath.Join(dirs.Snap, snap.IdxFileName(f.From, f.To, f.T.String()))}
+		if f.T == snap.Transactions {
+			toRemove = append(toRemove, filepath.Join(dirs.Snap, snap.IdxFileName(f.From, f.To, snap.Transactions2Block.String())))
+		}
+		for _, p := range toRemove {
+			if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		log.Info("[snapshots] Removed broken segment", "file", name)
+		removedSegments = true
+	}
+	for name := range report.Indices {
+		if err := os.Remove(filepath.Join(dirs.Snap, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if removedSegments {
+		// Downloader remembers which pieces are downloaded - it must check files again
+		if err := os.RemoveAll(filepath.Join(dirs.Snap, "db")); err != nil {
+			return err
+		}
+	}
+	if len(unrepairable) > 0 {
+		return fmt.Errorf("segments without .torrent files can't be repaired, remove them and create again by `erigon snapshots create`: %v", unrepairable)
+	}
+
+	workers := cmp.Max(1, runtime.GOMAXPROCS(-1)-1)
+	if err := snapshotsync.BuildMissedIndices(ctx, dirs.Snap, chainID, dirs.Tmp, workers, 4*etl.BufferOptimalSize, log.LvlInfo); err != nil {
+		return err
+	}
+	log.Info("[snapshots] Repair done")
+	return nil
+}
+
 func doUncompress(cliCtx *cli.Context) error {
 	ctx, cancel := common.RootContext()
 	defer cancel()
@@ -300,7 +410,7 @@ func doSnapshotCommand(cliCtx *cli.Context) error {
 	return nil
 }
 
-func rebuildIndices(ctx context.Context, db kv.RoDB, cfg ethconfig.Snapshot, dirs datadir.Dirs, from uint64, workers int) error {
+func rebuildIndices(ctx context.Context, db kv.RoDB, cfg ethconfig.Snapshot, dirs datadir.Dirs, from uint64, workers int, memLimit datasize.ByteSize) error {
 	chainConfig := tool.ChainConfigFromDB(db)
 	chainID, _ := uint256.FromBig(chainConfig.ChainID)
 
@@ -308,7 +418,7 @@ func rebuildIndices(ctx context.Context, db kv.RoDB, cfg ethconfig.Snapshot, dir
 	if err := allSnapshots.ReopenFolder(); err != nil {
 		return err
 	}
-	if err := snapshotsync.BuildMissedIndices(ctx, allSnapshots.Dir(), *chainID, dirs.Tmp, workers, log.LvlInfo); err != nil {
+	if err := snapshotsync.BuildMissedIndices(ctx, allSnapshots.Dir(), *chainID, dirs.Tmp, workers, memLimit, log.LvlInfo); err != nil {
 		return err
 	}
 	return nil
@@ -16,6 +16,11 @@ var DefaultFlags = []cli.Flag{
 	utils.TxPoolNoLocalsFlag,
 	utils.TxPoolPriceLimitFlag,
 	utils.TxPoolPriceBumpFlag,
+	utils.TxPoolReplacementsFlag,
+	utils.TxPoolMaxNonceGapFlag,
+	utils.TxPoolNoGapsFlag,
+	utils.TxPoolBroadcastLocalFlag,
+	utils.TxPoolBroadcastPeersFlag,
 	utils.TxPoolAccountSlotsFlag,
 	utils.TxPoolGlobalSlotsFlag,
 	utils.TxPoolGlobalBaseFeeSlotsFlag,
@@ -33,6 +38,7 @@ var DefaultFlags = []cli.Flag{
 	PruneTxIndexBeforeFlag,
 	PruneCallTracesBeforeFlag,
 	BatchSizeFlag,
+	ExecMemoryBudgetFlag,
 	BlockDownloaderWindowFlag,
 	DatabaseVerbosityFlag,
 	PrivateApiAddr,
@@ -59,19 +65,47 @@ var DefaultFlags = []cli.Flag{
 	utils.HTTPApiFlag,
 	utils.WSEnabledFlag,
 	utils.WsCompressionFlag,
+	utils.WsSendQueueFlag,
+	utils.WsSendQueuePolicyFlag,
+	utils.WsSubscriptionsMaxFlag,
 	utils.HTTPTraceFlag,
 	utils.StateCacheFlag,
 	utils.RpcBatchConcurrencyFlag,
+	utils.RpcGetLogsParallelFlag,
+	utils.RpcTraceBlockParallelFlag,
+	utils.RpcTimestampIndexFlag,
 	utils.RpcStreamingDisableFlag,
 	utils.DBReadConcurrencyFlag,
 	utils.RpcAccessListFlag,
+	utils.RpcRateLimitsFlag,
+	utils.RpcApiKeysFlag,
+	utils.RpcAuditFileFlag,
+	utils.RpcAuditSampleFlag,
+	utils.RpcAuditSlowFlag,
+	utils.RpcLocalTxsJournalFlag,
+	utils.RpcLocalTxsResubmitFlag,
+	utils.RpcTxsPerClientFlag,
+	utils.RpcTxsPerSenderFlag,
+	utils.RpcLanesFlag,
+	utils.RpcViewsMaxFlag,
+	utils.RpcViewsTTLFlag,
 	utils.RpcTraceCompatFlag,
 	utils.RpcGasCapFlag,
+	utils.RpcEvmTimeoutFlag,
+	utils.RpcEvmMemoryFlag,
+	utils.RpcCallBudgetMaxGasFlag,
+	utils.RpcCallBudgetMaxTimeoutFlag,
+	utils.RpcCallBudgetMaxMemoryFlag,
+	utils.RpcTracerOpBudgetFlag,
+	utils.RpcSharedStateCacheFlag,
 	utils.StarknetGrpcAddressFlag,
 	utils.TevmFlag,
 	utils.MemoryOverlayFlag,
 	utils.TxpoolApiAddrFlag,
 	utils.TraceMaxtracesFlag,
+	utils.TraceMaxVmTraceOpsFlag,
+	utils.RpcDebugDbFlag,
+	utils.RpcDebugDbMaxDumpFlag,
 	HTTPReadTimeoutFlag,
 	HTTPWriteTimeoutFlag,
 	HTTPIdleTimeoutFlag,
@@ -89,6 +123,8 @@ var DefaultFlags = []cli.Flag{
 	utils.TorrentUploadRateFlag,
 	utils.TorrentDownloadRateFlag,
 	utils.TorrentVerbosityFlag,
+	utils.TorrentRateScheduleFlag,
+	utils.TorrentWebSeedsFlag,
 	utils.ListenPortFlag,
 	utils.P2pProtocolVersionFlag,
 	utils.NATFlag,
@@ -109,6 +145,8 @@ var DefaultFlags = []cli.Flag{
 	utils.FakePoWFlag,
 	utils.GpoBlocksFlag,
 	utils.GpoPercentileFlag,
+	utils.GpoMaxGasPriceFlag,
+	utils.GpoEstimatorFlag,
 	utils.InsecureUnlockAllowedFlag,
 	utils.MetricsEnabledFlag,
 	utils.MetricsEnabledExpensiveFlag,
@@ -34,6 +34,11 @@ var (
 		Usage: "Batch size for the execution stage",
 		Value: "256M",
 	}
+	ExecMemoryBudgetFlag = cli.StringFlag{
+		Name:  "exec.memory-budget",
+		Usage: "Memory shared by the results of parallel execution workers and the state changes buffered before flush. When exceeded, scheduling is paused and the changes are flushed",
+		Value: ethconfig.Defaults.Sync.ExecMemoryBudget.String(),
+	}
 	EtlBufferSizeFlag = cli.StringFlag{
 		Name:  "etl.bufferSize",
 		Usage: "Buffer size for ETL operations.",
@@ -108,7 +113,8 @@ var (
 	ExperimentsFlag = cli.StringFlag{
 		Name: "experiments",
 		Usage: `Enable some experimental stages:
-* tevm - write TEVM translated code to the DB`,
+* tevm - write TEVM translated code to the DB
+* ots2 - index contract creations, ERC-20 and ERC-721 tokens for the ots2_ RPC commands, requires full history`,
 		Value: "default",
 	}
 
@@ -212,6 +218,12 @@ func ApplyFlagsForEthConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 			utils.Fatalf("Invalid batchSize provided: %v", err)
 		}
 	}
+	if ctx.GlobalString(ExecMemoryBudgetFlag.Name) != "" {
+		err := cfg.Sync.ExecMemoryBudget.UnmarshalText([]byte(ctx.GlobalString(ExecMemoryBudgetFlag.Name)))
+		if err != nil {
+			utils.Fatalf("Invalid exec.memory-budget provided: %v", err)
+		}
+	}
 
 	if ctx.GlobalString(EtlBufferSizeFlag.Name) != "" {
 		sizeVal := datasize.ByteSize(0)
@@ -291,6 +303,12 @@ func ApplyFlagsForEthConfigCobra(f *pflag.FlagSet, cfg *ethconfig.Config) {
 			utils.Fatalf("Invalid batchSize provided: %v", err)
 		}
 	}
+	if v := f.String(ExecMemoryBudgetFlag.Name, ExecMemoryBudgetFlag.Value, ExecMemoryBudgetFlag.Usage); v != nil {
+		err := cfg.Sync.ExecMemoryBudget.UnmarshalText([]byte(*v))
+		if err != nil {
+			utils.Fatalf("Invalid exec.memory-budget provided: %v", err)
+		}
+	}
 	if v := f.String(EtlBufferSizeFlag.Name, EtlBufferSizeFlag.Value, EtlBufferSizeFlag.Usage); v != nil {
 		sizeVal := datasize.ByteSize(0)
 		size := &sizeVal
@@ -351,16 +369,44 @@ func setEmbeddedRpcDaemon(ctx *cli.Context, cfg *nodecfg.Config) {
 			IdleTimeout:  ctx.GlobalDuration(HTTPIdleTimeoutFlag.Name),
 		},
 
-		WebsocketEnabled:     ctx.GlobalIsSet(utils.WSEnabledFlag.Name),
-		RpcBatchConcurrency:  ctx.GlobalUint(utils.RpcBatchConcurrencyFlag.Name),
-		RpcStreamingDisable:  ctx.GlobalBool(utils.RpcStreamingDisableFlag.Name),
-		DBReadConcurrency:    ctx.GlobalInt(utils.DBReadConcurrencyFlag.Name),
-		RpcAllowListFilePath: ctx.GlobalString(utils.RpcAccessListFlag.Name),
-		Gascap:               ctx.GlobalUint64(utils.RpcGasCapFlag.Name),
-		MaxTraces:            ctx.GlobalUint64(utils.TraceMaxtracesFlag.Name),
-		TraceCompatibility:   ctx.GlobalBool(utils.RpcTraceCompatFlag.Name),
-		StarknetGRPCAddress:  ctx.GlobalString(utils.StarknetGrpcAddressFlag.Name),
-		TevmEnabled:          ctx.GlobalBool(utils.TevmFlag.Name),
+		WebsocketEnabled:      ctx.GlobalIsSet(utils.WSEnabledFlag.Name),
+		WebsocketSendQueue:    ctx.GlobalInt(utils.WsSendQueueFlag.Name),
+		WebsocketSendPolicy:   ctx.GlobalString(utils.WsSendQueuePolicyFlag.Name),
+		WebsocketSubsMax:      ctx.GlobalInt(utils.WsSubscriptionsMaxFlag.Name),
+		RpcBatchConcurrency:   ctx.GlobalUint(utils.RpcBatchConcurrencyFlag.Name),
+		RpcStreamingDisable:   ctx.GlobalBool(utils.RpcStreamingDisableFlag.Name),
+		GetLogsParallel:       ctx.GlobalUint(utils.RpcGetLogsParallelFlag.Name),
+		TraceBlockParallel:    ctx.GlobalUint(utils.RpcTraceBlockParallelFlag.Name),
+		TimestampIndex:        ctx.GlobalBool(utils.RpcTimestampIndexFlag.Name),
+		DBReadConcurrency:     ctx.GlobalInt(utils.DBReadConcurrencyFlag.Name),
+		RpcAllowListFilePath:  ctx.GlobalString(utils.RpcAccessListFlag.Name),
+		RpcRateLimitsFilePath: ctx.GlobalString(utils.RpcRateLimitsFlag.Name),
+		RpcApiKeysFilePath:    ctx.GlobalString(utils.RpcApiKeysFlag.Name),
+		RpcAuditFilePath:      ctx.GlobalString(utils.RpcAuditFileFlag.Name),
+		RpcAuditSampleRate:    ctx.GlobalFloat64(utils.RpcAuditSampleFlag.Name),
+		RpcAuditSlow:          ctx.GlobalDuration(utils.RpcAuditSlowFlag.Name),
+		LocalTxsJournal:       ctx.GlobalString(utils.RpcLocalTxsJournalFlag.Name),
+		LocalTxsResubmit:      ctx.GlobalDuration(utils.RpcLocalTxsResubmitFlag.Name),
+		TxsPerClient:          ctx.GlobalInt(utils.RpcTxsPerClientFlag.Name),
+		TxsPerSender:          ctx.GlobalInt(utils.RpcTxsPerSenderFlag.Name),
+		RpcLanes:              ctx.GlobalString(utils.RpcLanesFlag.Name),
+		PinnedViewsMax:        ctx.GlobalInt(utils.RpcViewsMaxFlag.Name),
+		PinnedViewsTTL:        ctx.GlobalDuration(utils.RpcViewsTTLFlag.Name),
+		Gascap:                ctx.GlobalUint64(utils.RpcGasCapFlag.Name),
+		EvmCallTimeout:        ctx.GlobalDuration(utils.RpcEvmTimeoutFlag.Name),
+		EvmMaxMemory:          ctx.GlobalUint64(utils.RpcEvmMemoryFlag.Name),
+		CallBudgetMaxGas:      ctx.GlobalUint64(utils.RpcCallBudgetMaxGasFlag.Name),
+		CallBudgetMaxTimeout:  ctx.GlobalDuration(utils.RpcCallBudgetMaxTimeoutFlag.Name),
+		CallBudgetMaxMemory:   ctx.GlobalUint64(utils.RpcCallBudgetMaxMemoryFlag.Name),
+		SharedStateCache:      ctx.GlobalUint64(utils.RpcSharedStateCacheFlag.Name),
+		MaxTraces:             ctx.GlobalUint64(utils.TraceMaxtracesFlag.Name),
+		MaxVmTraceOps:         ctx.GlobalUint64(utils.TraceMaxVmTraceOpsFlag.Name),
+		DebugDbEnabled:        ctx.GlobalBool(utils.RpcDebugDbFlag.Name),
+		DebugDbMaxDump:        ctx.GlobalUint64(utils.RpcDebugDbMaxDumpFlag.Name),
+		TracerOpBudget:        ctx.GlobalUint64(utils.RpcTracerOpBudgetFlag.Name),
+		TraceCompatibility:    ctx.GlobalBool(utils.RpcTraceCompatFlag.Name),
+		StarknetGRPCAddress:   ctx.GlobalString(utils.StarknetGrpcAddressFlag.Name),
+		TevmEnabled:           ctx.GlobalBool(utils.TevmFlag.Name),
 
 		TxPoolApiAddr: ctx.GlobalString(utils.TxpoolApiAddrFlag.Name),
 
@@ -378,6 +424,9 @@ func setEmbeddedRpcDaemon(ctx *cli.Context, cfg *nodecfg.Config) {
 	}
 
 	c.StateCache.CodeKeysLimit = ctx.GlobalInt(utils.StateCacheFlag.Name)
+	if c.DebugDbMaxDump == 0 {
+		utils.Fatalf("--%s must be positive", utils.RpcDebugDbMaxDumpFlag.Name)
+	}
 
 	/*
 		rootCmd.PersistentFlags().BoolVar(&cfg.GRPCServerEnabled, "grpc", false, "Enable GRPC server")
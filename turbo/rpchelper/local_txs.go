@@ -0,0 +1,323 @@
+package rpchelper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
+	types2 "github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/turbo/services"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// LocalTxs are the transactions submitted by the RPC of this node. They are journaled to disk, so they survive
+// restarts of the node and of the pool, and submitted again to the pool while they are not mined: a local transaction
+// evicted from the pool, e.g. by cheaper remote ones, comes back on the next Resubmit and is propagated to the peers
+// again. The pool doesn't know which transactions are local, they are not exempt from its eviction.
+//
+// A transaction is forgotten when it's mined, when its nonce is used by another transaction of the sender, when it's
+// replaced by a local transaction of the same nonce, after localTxsLifetime, or by Drop. At most localTxsPerSender
+// transactions of a sender and localTxsMax in total are kept
+type LocalTxs struct {
+	db          kv.RoDB
+	blockReader services.FullBlockReader
+	pool        txpool.TxpoolClient
+	path        string
+
+	lock    sync.Mutex
+	txs     map[common.Hash]*localTx
+	journal *os.File // appended by Add, rewritten when transactions are forgotten
+}
+
+type localTx struct {
+	Sender common.Address
+	Rlp    []byte
+	Added  uint64 `rlp:"optional"` // unix time of Add
+	nonce  uint64
+}
+
+const (
+	localTxsPerSender = 64
+	localTxsMax       = 4096
+	localTxsLifetime  = 3 * time.Hour
+)
+
+// ErrLocalTxsFull is returned by LocalTxs.Add when the sender, or all the senders, have as many local transactions as
+// the limits
+var ErrLocalTxsFull = errors.New("too many local transactions")
+
+var (
+	localTxsIncludedTimer = metrics.GetOrCreateSummary(`rpc_sendtx_included_seconds`) // from Add to the check which finds the transaction mined
+	localTxsResubmitted   = metrics.GetOrCreateCounter(`rpc_sendtx_resubmitted`)
+	localTxsForgotten     = metrics.GetOrCreateCounter(`rpc_sendtx_forgotten`) // mined, superseded or expired
+)
+
+// NewLocalTxs loads the transactions of the journal at path, which is created if it doesn't exist
+func NewLocalTxs(db kv.RoDB, blockReader services.FullBlockReader, pool txpool.TxpoolClient, path string) (*LocalTxs, error) {
+	l := &LocalTxs{db: db, blockReader: blockReader, pool: pool, path: path, txs: map[common.Hash]*localTx{}}
+	if err := l.load(); err != nil {
+		return nil, fmt.Errorf("load the journal of local transactions %s: %w", path, err)
+	}
+	if err := l.rotate(); err != nil {
+		return nil, err
+	}
+	log.Info("[rpc] Loaded local transactions", "journal", path, "txs", len(l.txs))
+	return l, nil
+}
+
+func (l *LocalTxs) load() error {
+	file, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	stream := rlp.NewStream(bufio.NewReader(file), 0)
+	for {
+		entry := &localTx{}
+		if err = stream.Decode(entry); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			// The last entry may be cut by a crash, keep the ones before it
+			log.Warn("[rpc] Skipping the rest of the journal of local transactions", "journal", l.path, "err", err)
+			return nil
+		}
+		txn, err := types.DecodeTransaction(rlp.NewStream(bytes.NewReader(entry.Rlp), uint64(len(entry.Rlp))))
+		if err != nil {
+			log.Warn("[rpc] Invalid transaction in the journal of local transactions", "journal", l.path, "err", err)
+			continue
+		}
+		entry.nonce = txn.GetNonce()
+		if entry.Added == 0 { // journaled before the time was
+			entry.Added = uint64(time.Now().Unix())
+		}
+		l.txs[txn.Hash()] = entry
+	}
+}
+
+// rotate rewrites the journal with the current transactions, l.lock is held or l isn't shared yet
+func (l *LocalTxs) rotate() error {
+	tmp := l.path + ".new"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	for _, entry := range l.txs {
+		if err = rlp.Encode(w, entry); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err = w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, l.path); err != nil {
+		return err
+	}
+	if l.journal != nil {
+		l.journal.Close()
+	}
+	l.journal, err = os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0644)
+	return err
+}
+
+// Add journals a transaction added to the pool by the RPC, in place of the local transaction of the same sender and
+// nonce it replaces. Returns ErrLocalTxsFull over the limits
+func (l *LocalTxs) Add(txn types.Transaction, sender common.Address, encoded []byte) error {
+	entry := &localTx{Sender: sender, Rlp: common.CopyBytes(encoded), Added: uint64(time.Now().Unix()), nonce: txn.GetNonce()}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if _, ok := l.txs[txn.Hash()]; ok {
+		return nil
+	}
+	var replaced []common.Hash
+	senderTxs := 0
+	for hash, other := range l.txs {
+		if other.Sender == sender {
+			if other.nonce == entry.nonce {
+				replaced = append(replaced, hash)
+			} else {
+				senderTxs++
+			}
+		}
+	}
+	if senderTxs >= localTxsPerSender {
+		return fmt.Errorf("%w: %d of the sender %x", ErrLocalTxsFull, senderTxs, sender)
+	}
+	if len(l.txs)-len(replaced) >= localTxsMax {
+		return fmt.Errorf("%w: %d", ErrLocalTxsFull, len(l.txs))
+	}
+	if len(replaced) > 0 {
+		localTxsForgotten.Add(len(replaced))
+		for _, hash := range replaced {
+			delete(l.txs, hash)
+		}
+		l.txs[txn.Hash()] = entry
+		return l.rotate()
+	}
+	if err := rlp.Encode(l.journal, entry); err != nil {
+		return err
+	}
+	l.txs[txn.Hash()] = entry
+	return nil
+}
+
+// Drop forgets a local transaction, it's not submitted to the pool again. Returns false if it's not local
+func (l *LocalTxs) Drop(hash common.Hash) (bool, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if _, ok := l.txs[hash]; !ok {
+		return false, nil
+	}
+	delete(l.txs, hash)
+	return true, l.rotate()
+}
+
+// Hashes returns the hashes of the local transactions
+func (l *LocalTxs) Hashes() []common.Hash {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	hashes := make([]common.Hash, 0, len(l.txs))
+	for hash := range l.txs {
+		hashes = append(hashes, hash)
+	}
+	return hashes
+}
+
+// Loop resubmits the local transactions missing from the pool every interval, until ctx is done
+func (l *LocalTxs) Loop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer func() {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		l.journal.Close()
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := l.Resubmit(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			log.Warn("[rpc] Failed to resubmit local transactions", "err", err)
+		}
+	}
+}
+
+// Resubmit forgets the mined, superseded and expired local transactions, and adds the others to the pool of this node
+// again if it doesn't have them. The pool propagates them to the peers as new transactions, the ones it still has are
+// not announced again
+func (l *LocalTxs) Resubmit(ctx context.Context) error {
+	l.lock.Lock()
+	txs := make(map[common.Hash]*localTx, len(l.txs))
+	for hash, entry := range l.txs {
+		txs[hash] = entry
+	}
+	l.lock.Unlock()
+	if len(txs) == 0 {
+		return nil
+	}
+
+	var done []common.Hash
+	expiredBefore := uint64(time.Now().Add(-localTxsLifetime).Unix())
+	if err := l.db.View(ctx, func(tx kv.Tx) error {
+		reader := state.NewPlainStateReader(tx)
+		for hash, entry := range txs {
+			_, mined, err := l.blockReader.TxnLookup(ctx, tx, hash)
+			if err != nil {
+				return err
+			}
+			forget := mined
+			if mined {
+				localTxsIncludedTimer.UpdateDuration(time.Unix(int64(entry.Added), 0))
+			} else {
+				account, err := reader.ReadAccountData(entry.Sender)
+				if err != nil {
+					return err
+				}
+				// superseded by a transaction of the same nonce, or expired
+				forget = (account != nil && account.Nonce > entry.nonce) || entry.Added < expiredBefore
+			}
+			if forget {
+				done = append(done, hash)
+				delete(txs, hash)
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if len(done) > 0 {
+		localTxsForgotten.Add(len(done))
+		l.lock.Lock()
+		for _, hash := range done {
+			delete(l.txs, hash)
+		}
+		err := l.rotate()
+		l.lock.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	if len(txs) == 0 {
+		return nil
+	}
+
+	hashes := make([]common.Hash, 0, len(txs))
+	request := &txpool.TransactionsRequest{Hashes: make([]*types2.H256, 0, len(txs))}
+	for hash := range txs {
+		hashes = append(hashes, hash)
+		request.Hashes = append(request.Hashes, gointerfaces.ConvertHashToH256(hash))
+	}
+	reply, err := l.pool.Transactions(ctx, request)
+	if err != nil {
+		return err
+	}
+	add := &txpool.AddRequest{}
+	for i, hash := range hashes {
+		if len(reply.RlpTxs[i]) == 0 {
+			add.RlpTxs = append(add.RlpTxs, txs[hash].Rlp)
+		}
+	}
+	if len(add.RlpTxs) == 0 {
+		return nil
+	}
+	res, err := l.pool.Add(ctx, add)
+	if err != nil {
+		return err
+	}
+	resubmitted := 0
+	for i := range res.Imported {
+		if res.Imported[i] == txpool.ImportResult_SUCCESS {
+			resubmitted++
+		} else {
+			log.Debug("[rpc] Local transaction not resubmitted", "result", res.Imported[i], "err", res.Errors[i])
+		}
+	}
+	localTxsResubmitted.Add(resubmitted)
+	log.Info("[rpc] Resubmitted local transactions missing from the pool", "txs", resubmitted, "failed", len(add.RlpTxs)-resubmitted, "forgotten", len(done))
+	return nil
+}
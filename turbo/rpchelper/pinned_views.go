@@ -0,0 +1,174 @@
+package rpchelper
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/rpc"
+)
+
+// PinnedViews keeps read transactions of the database open between the requests, so that several rpcdaemons sharing
+// a datadir or a remote kv, or the pages of a paginated query, observe the same state even if new blocks are imported
+// meanwhile. A view is released ttl after its last use, or by Unpin.
+//
+// The transaction of a view is used by one request at a time, the others wait for it
+type PinnedViews struct {
+	db    kv.RoDB
+	max   int
+	ttl   time.Duration
+	lock  sync.Mutex
+	views map[string]*pinnedView
+}
+
+type pinnedView struct {
+	tx     kv.Tx
+	inUse  chan struct{} // holds a token while a request uses tx
+	done   chan struct{} // closed when tx is rolled back
+	timer  *time.Timer
+	closed bool // guarded by PinnedViews.lock
+}
+
+func NewPinnedViews(db kv.RoDB, max int, ttl time.Duration) *PinnedViews {
+	return &PinnedViews{db: db, max: max, ttl: ttl, views: map[string]*pinnedView{}}
+}
+
+// Pin begins a read transaction and returns the id of its view, see rpc.ViewHeader
+func (v *PinnedViews) Pin() (string, error) {
+	v.lock.Lock()
+	full := len(v.views) >= v.max
+	v.lock.Unlock()
+	if full {
+		return "", fmt.Errorf("too many pinned views, max %d", v.max)
+	}
+
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", err
+	}
+	// The transaction outlives the request, e.g. the stream of a remote transaction must not be bound to its context
+	tx, err := v.db.BeginRo(context.Background())
+	if err != nil {
+		return "", err
+	}
+	view := &pinnedView{tx: tx, inUse: make(chan struct{}, 1), done: make(chan struct{})}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if len(v.views) >= v.max {
+		tx.Rollback()
+		return "", fmt.Errorf("too many pinned views, max %d", v.max)
+	}
+	viewID := hex.EncodeToString(id[:])
+	v.views[viewID] = view
+	view.timer = time.AfterFunc(v.ttl, func() { v.Unpin(viewID) })
+	return viewID, nil
+}
+
+// Unpin releases the view once the request using it is done, returns false if there is no such view
+func (v *PinnedViews) Unpin(id string) bool {
+	v.lock.Lock()
+	view, ok := v.views[id]
+	if ok {
+		delete(v.views, id)
+		view.closed = true
+		view.timer.Stop()
+	}
+	v.lock.Unlock()
+	if !ok {
+		return false
+	}
+	view.inUse <- struct{}{}
+	view.tx.Rollback()
+	close(view.done)
+	return true
+}
+
+// View runs f in the transaction of the view
+func (v *PinnedViews) View(ctx context.Context, id string, f func(tx kv.Tx) error) error {
+	tx, release, err := v.acquire(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return f(tx)
+}
+
+// acquire waits until the view is not used by another request, the returned function releases it and restarts its ttl
+func (v *PinnedViews) acquire(ctx context.Context, id string) (kv.Tx, func(), error) {
+	v.lock.Lock()
+	view, ok := v.views[id]
+	v.lock.Unlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("view %s is not pinned, it may have expired", id)
+	}
+	select {
+	case view.inUse <- struct{}{}:
+	case <-view.done:
+		return nil, nil, fmt.Errorf("view %s is not pinned, it may have expired", id)
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if view.closed {
+		<-view.inUse
+		return nil, nil, fmt.Errorf("view %s is not pinned, it may have expired", id)
+	}
+	view.timer.Stop()
+	return view.tx, func() {
+		v.lock.Lock()
+		if !view.closed {
+			view.timer.Reset(v.ttl)
+		}
+		v.lock.Unlock()
+		<-view.inUse
+	}, nil
+}
+
+// DB returns db, which begins the read transactions of the requests with a pinned view (see rpc.ViewFromContext) in
+// the transaction of the view
+func (v *PinnedViews) DB() kv.RoDB {
+	return &pinnedViewsDB{RoDB: v.db, views: v}
+}
+
+type pinnedViewsDB struct {
+	kv.RoDB
+	views *PinnedViews
+}
+
+func (db *pinnedViewsDB) BeginRo(ctx context.Context) (kv.Tx, error) {
+	id, ok := rpc.ViewFromContext(ctx)
+	if !ok {
+		return db.RoDB.BeginRo(ctx)
+	}
+	tx, release, err := db.views.acquire(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &pinnedViewTx{Tx: tx, release: release}, nil
+}
+
+func (db *pinnedViewsDB) View(ctx context.Context, f func(tx kv.Tx) error) error {
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return f(tx)
+}
+
+// pinnedViewTx is the transaction of a pinned view used by a request
+type pinnedViewTx struct {
+	kv.Tx
+	once    sync.Once
+	release func()
+}
+
+// Rollback releases the view for the next request, its transaction stays open
+func (tx *pinnedViewTx) Rollback() { tx.once.Do(tx.release) }
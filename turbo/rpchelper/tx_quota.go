@@ -0,0 +1,157 @@
+package rpchelper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
+	types2 "github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/rpc"
+)
+
+// txQuotaKeys is the number of clients and senders whose transactions are counted, the least recently seen ones are
+// forgotten
+const txQuotaKeys = 10_000
+
+var ErrTxQuotaExceeded = errors.New("too many transactions in the txpool")
+
+// TxQuota limits the transactions sent over the RPC which each client, see rpc.CallerFromContext, and each sender have
+// in the pool at once. A client or a sender sending many transactions can't fill the pool and evict the transactions
+// of the others, it has to wait for its transactions to be mined or dropped. The in-process callers are limited per
+// sender only
+type TxQuota struct {
+	pool      txpool.TxpoolClient
+	perClient int // 0 - unlimited
+	perSender int // 0 - unlimited
+
+	lock sync.Mutex
+	keys *lru.Cache // txQuotaKey -> *txQuotaEntry
+}
+
+type txQuotaKey struct {
+	client string // empty for the key of the sender
+	sender common.Address
+}
+
+type txQuotaEntry struct {
+	txs      map[common.Hash]struct{} // in the pool, or which were when last checked
+	reserved int                      // transactions being added to the pool
+}
+
+type txQuotaLimit struct {
+	key  txQuotaKey
+	max  int
+	flag string
+}
+
+func NewTxQuota(pool txpool.TxpoolClient, perClient, perSender int) (*TxQuota, error) {
+	if perClient < 0 || perSender < 0 || perClient+perSender == 0 {
+		return nil, fmt.Errorf("transactions per client %d and per sender %d can't be negative or both 0", perClient, perSender)
+	}
+	keys, err := lru.New(txQuotaKeys)
+	if err != nil {
+		return nil, err
+	}
+	return &TxQuota{pool: pool, perClient: perClient, perSender: perSender, keys: keys}, nil
+}
+
+// Reserve returns ErrTxQuotaExceeded if the client of the call in ctx, or the sender, has the max transactions in the
+// pool. The transactions which left the pool since they were sent don't count anymore. Otherwise it reserves a place
+// for the transaction until done is called with the reply of the pool: an added transaction takes the place, a
+// rejected one frees it
+func (q *TxQuota) Reserve(ctx context.Context, sender common.Address) (done func(hash common.Hash, added bool), err error) {
+	var limits []txQuotaLimit
+	if client := rpc.CallerFromContext(ctx); client != "" && q.perClient > 0 {
+		limits = append(limits, txQuotaLimit{key: txQuotaKey{client: client}, max: q.perClient, flag: "--rpc.txs.perclient"})
+	}
+	if q.perSender > 0 {
+		limits = append(limits, txQuotaLimit{key: txQuotaKey{sender: sender}, max: q.perSender, flag: "--rpc.txs.persender"})
+	}
+	if len(limits) == 0 {
+		return func(common.Hash, bool) {}, nil
+	}
+	if full := q.tryReserve(limits); full != nil {
+		// The pool is asked outside of the lock, the places are checked again and reserved at once under it
+		if err = q.forgetLeft(ctx, full); err != nil {
+			return nil, err
+		}
+		if full = q.tryReserve(limits); full != nil {
+			return nil, fmt.Errorf("%w: %d, see %s", ErrTxQuotaExceeded, full.max, full.flag)
+		}
+	}
+	return func(hash common.Hash, added bool) {
+		q.lock.Lock()
+		defer q.lock.Unlock()
+		for _, limit := range limits {
+			entry := q.entry(limit.key)
+			if entry.reserved > 0 {
+				entry.reserved--
+			}
+			if added {
+				entry.txs[hash] = struct{}{}
+			}
+		}
+	}, nil
+}
+
+// tryReserve reserves a place for each limit, or for none and returns the first of the limits which is reached
+func (q *TxQuota) tryReserve(limits []txQuotaLimit) *txQuotaLimit {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for i := range limits {
+		if entry := q.entry(limits[i].key); len(entry.txs)+entry.reserved >= limits[i].max {
+			return &limits[i]
+		}
+	}
+	for _, limit := range limits {
+		q.entry(limit.key).reserved++
+	}
+	return nil
+}
+
+// forgetLeft forgets the transactions counted for the limit which are not in the pool anymore
+func (q *TxQuota) forgetLeft(ctx context.Context, limit *txQuotaLimit) error {
+	q.lock.Lock()
+	txs := q.entry(limit.key).txs
+	hashes := make([]common.Hash, 0, len(txs))
+	for hash := range txs {
+		hashes = append(hashes, hash)
+	}
+	q.lock.Unlock()
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	request := &txpool.TransactionsRequest{Hashes: make([]*types2.H256, len(hashes))}
+	for i, hash := range hashes {
+		request.Hashes[i] = gointerfaces.ConvertHashToH256(hash)
+	}
+	reply, err := q.pool.Transactions(ctx, request)
+	if err != nil {
+		return err
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	txs = q.entry(limit.key).txs
+	for i, hash := range hashes {
+		if len(reply.RlpTxs[i]) == 0 {
+			delete(txs, hash)
+		}
+	}
+	return nil
+}
+
+// entry returns the transactions of the key, q.lock is held
+func (q *TxQuota) entry(key txQuotaKey) *txQuotaEntry {
+	if v, ok := q.keys.Get(key); ok {
+		return v.(*txQuotaEntry)
+	}
+	entry := &txQuotaEntry{txs: map[common.Hash]struct{}{}}
+	q.keys.Add(key, entry)
+	return entry
+}
@@ -0,0 +1,65 @@
+package rpchelper
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// emptyTxPool has none of the transactions it's asked for
+type emptyTxPool struct {
+	txpool.TxpoolClient
+}
+
+func (emptyTxPool) Transactions(_ context.Context, in *txpool.TransactionsRequest, _ ...grpc.CallOption) (*txpool.TransactionsReply, error) {
+	return &txpool.TransactionsReply{RlpTxs: make([][]byte, len(in.Hashes))}, nil
+}
+
+func TestTxQuota(t *testing.T) {
+	q, err := NewTxQuota(emptyTxPool{}, 0, 2)
+	require.NoError(t, err)
+	ctx, sender := context.Background(), common.Address{1}
+
+	// The concurrent calls reserve the places at once
+	var wg sync.WaitGroup
+	var reserved int32
+	dones := make(chan func(common.Hash, bool), 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done, err := q.Reserve(ctx, sender)
+			if err == nil {
+				atomic.AddInt32(&reserved, 1)
+				dones <- done
+			} else if !errors.Is(err, ErrTxQuotaExceeded) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(dones)
+	require.Equal(t, int32(2), reserved)
+
+	// A rejected transaction frees its place, an added one takes it until it leaves the pool
+	var i byte
+	for done := range dones {
+		done(common.Hash{i}, i == 0)
+		i++
+	}
+	done, err := q.Reserve(ctx, sender)
+	require.NoError(t, err)
+	done(common.Hash{2}, true)
+	_, err = q.Reserve(ctx, sender)
+	require.NoError(t, err, "the pool has none of them")
+
+	_, err = q.Reserve(ctx, common.Address{2})
+	require.NoError(t, err, "other senders have their own places")
+}
@@ -21,6 +21,7 @@ type HeaderReader interface {
 	Header(ctx context.Context, tx kv.Getter, hash common.Hash, blockHeight uint64) (*types.Header, error)
 	HeaderByNumber(ctx context.Context, tx kv.Getter, blockHeight uint64) (*types.Header, error)
 	HeaderByHash(ctx context.Context, tx kv.Getter, hash common.Hash) (*types.Header, error)
+	HeaderRlp(ctx context.Context, tx kv.Getter, hash common.Hash, blockHeight uint64) (headerRlp rlp.RawValue, err error)
 }
 
 type CanonicalReader interface {
@@ -37,6 +38,11 @@ type TxnReader interface {
 	TxnLookup(ctx context.Context, tx kv.Getter, txnHash common.Hash) (uint64, bool, error)
 	TxnByIdxInBlock(ctx context.Context, tx kv.Getter, blockNum uint64, i int) (txn types.Transaction, err error)
 }
+
+// ReceiptsReader - receipts without the fields derived from the block, see rawdb.ReadRawReceipts
+type ReceiptsReader interface {
+	RawReceipts(ctx context.Context, tx kv.Tx, blockHeight uint64) (types.Receipts, error)
+}
 type HeaderAndCanonicalReader interface {
 	HeaderReader
 	CanonicalReader
@@ -54,4 +60,5 @@ type FullBlockReader interface {
 	HeaderReader
 	TxnReader
 	CanonicalReader
+	ReceiptsReader
 }
@@ -36,6 +36,10 @@ func (back *BlockReader) Header(ctx context.Context, tx kv.Getter, hash common.H
 	return h, nil
 }
 
+func (back *BlockReader) HeaderRlp(ctx context.Context, tx kv.Getter, hash common.Hash, blockHeight uint64) (rlp.RawValue, error) {
+	return rawdb.ReadHeaderRLP(tx, hash, blockHeight), nil
+}
+
 func (back *BlockReader) Body(ctx context.Context, tx kv.Getter, hash common.Hash, blockHeight uint64) (body *types.Body, txAmount uint32, err error) {
 	body, _, txAmount = rawdb.ReadBody(tx, hash, blockHeight)
 	return body, txAmount, nil
@@ -46,7 +50,7 @@ func (back *BlockReader) BodyWithTransactions(ctx context.Context, tx kv.Getter,
 }
 
 func (back *BlockReader) BodyRlp(ctx context.Context, tx kv.Getter, hash common.Hash, blockHeight uint64) (bodyRlp rlp.RawValue, err error) {
-	body, _, err := back.Body(ctx, tx, hash, blockHeight)
+	body, err := back.BodyWithTransactions(ctx, tx, hash, blockHeight)
 	if err != nil {
 		return nil, err
 	}
@@ -115,6 +119,10 @@ func (back *BlockReader) TxnByIdxInBlock(ctx context.Context, tx kv.Getter, bloc
 	return txn, nil
 }
 
+func (back *BlockReader) RawReceipts(ctx context.Context, tx kv.Tx, blockHeight uint64) (types.Receipts, error) {
+	return rawdb.ReadRawReceipts(tx, blockHeight), nil
+}
+
 type RemoteBlockReader struct {
 	client remote.ETHBACKENDClient
 }
@@ -168,6 +176,10 @@ func (back *RemoteBlockReader) TxnByIdxInBlock(ctx context.Context, tx kv.Getter
 	panic("not implemented")
 }
 
+func (back *RemoteBlockReader) RawReceipts(ctx context.Context, tx kv.Tx, blockHeight uint64) (types.Receipts, error) {
+	return rawdb.ReadRawReceipts(tx, blockHeight), nil
+}
+
 func (back *RemoteBlockReader) BlockWithSenders(ctx context.Context, _ kv.Getter, hash common.Hash, blockHeight uint64) (block *types.Block, senders []common.Address, err error) {
 	reply, err := back.client.Block(ctx, &remote.BlockRequest{BlockHash: gointerfaces.ConvertHashToH256(hash), BlockHeight: blockHeight})
 	if err != nil {
@@ -199,6 +211,16 @@ func (back *RemoteBlockReader) Header(ctx context.Context, tx kv.Getter, hash co
 	}
 	return block.Header(), nil
 }
+func (back *RemoteBlockReader) HeaderRlp(ctx context.Context, tx kv.Getter, hash common.Hash, blockHeight uint64) (rlp.RawValue, error) {
+	header, err := back.Header(ctx, tx, hash, blockHeight)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, nil
+	}
+	return rlp.EncodeToBytes(header)
+}
 func (back *RemoteBlockReader) Body(ctx context.Context, tx kv.Getter, hash common.Hash, blockHeight uint64) (body *types.Body, txAmount uint32, err error) {
 	block, _, err := back.BlockWithSenders(ctx, tx, hash, blockHeight)
 	if err != nil {
@@ -334,6 +356,21 @@ func (back *BlockReaderWithSnapshots) Header(ctx context.Context, tx kv.Getter,
 	return h, nil
 }
 
+// HeaderRlp - the header as it is encoded in the snapshot segment, without decoding, or in the database
+func (back *BlockReaderWithSnapshots) HeaderRlp(ctx context.Context, tx kv.Getter, hash common.Hash, blockHeight uint64) (headerRlp rlp.RawValue, err error) {
+	ok, err := back.sn.ViewHeaders(blockHeight, func(segment *HeaderSegment) error {
+		headerRlp, _ = back.headerRlpFromSnapshot(blockHeight, segment, nil)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return headerRlp, nil
+	}
+	return rawdb.ReadHeaderRLP(tx, hash, blockHeight), nil
+}
+
 func (back *BlockReaderWithSnapshots) ReadHeaderByNumber(ctx context.Context, tx kv.Getter, hash common.Hash, blockHeight uint64) (h *types.Header, err error) {
 	ok, err := back.sn.ViewHeaders(blockHeight, func(segment *HeaderSegment) error {
 		h, _, err = back.headerFromSnapshot(blockHeight, segment, nil)
@@ -498,24 +535,34 @@ func (back *BlockReaderWithSnapshots) BlockWithSenders(ctx context.Context, tx k
 }
 
 func (back *BlockReaderWithSnapshots) headerFromSnapshot(blockHeight uint64, sn *HeaderSegment, buf []byte) (*types.Header, []byte, error) {
-	if sn.idxHeaderHash == nil {
+	headerRlp, buf := back.headerRlpFromSnapshot(blockHeight, sn, buf)
+	if headerRlp == nil {
 		return nil, buf, nil
 	}
+	h := &types.Header{}
+	if err := rlp.DecodeBytes(headerRlp, h); err != nil {
+		return nil, buf, err
+	}
+	return h, buf, nil
+}
+
+// headerRlpFromSnapshot - the word of the segment is the first byte of the header hash followed by the header RLP,
+// the returned RLP is a slice of buf
+func (back *BlockReaderWithSnapshots) headerRlpFromSnapshot(blockHeight uint64, sn *HeaderSegment, buf []byte) (rlp.RawValue, []byte) {
+	if sn.idxHeaderHash == nil {
+		return nil, buf
+	}
 	headerOffset := sn.idxHeaderHash.OrdinalLookup(blockHeight - sn.idxHeaderHash.BaseDataID())
 	gg := sn.seg.MakeGetter()
 	gg.Reset(headerOffset)
 	if !gg.HasNext() {
-		return nil, nil, nil
+		return nil, nil
 	}
 	buf, _ = gg.Next(buf[:0])
 	if len(buf) == 0 {
-		return nil, buf, nil
-	}
-	h := &types.Header{}
-	if err := rlp.DecodeBytes(buf[1:], h); err != nil {
-		return nil, buf, err
+		return nil, buf
 	}
-	return h, buf, nil
+	return buf[1:], buf
 }
 
 // headerFromSnapshotByHash - getting header by hash AND ensure that it has correct hash
@@ -649,6 +696,35 @@ func (back *BlockReaderWithSnapshots) txsFromSnapshot(baseTxnID uint64, txsAmoun
 	return txs, senders, nil
 }
 
+// receiptsFromSnapshot - receipts without the fields derived from the block, see types.Receipts.DeriveFields
+func (back *BlockReaderWithSnapshots) receiptsFromSnapshot(blockHeight uint64, sn *ReceiptSegment, buf []byte) (types.Receipts, []byte, error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			panic(fmt.Errorf("%+v, snapshot: %d-%d, trace: %s", rec, sn.ranges.from, sn.ranges.to, dbg.Stack()))
+		}
+	}() // avoid crash because Erigon's core does many things
+
+	if sn.idxReceiptsNumber == nil {
+		return nil, buf, nil
+	}
+	receiptsOffset := sn.idxReceiptsNumber.OrdinalLookup(blockHeight - sn.idxReceiptsNumber.BaseDataID())
+	gg := sn.seg.MakeGetter()
+	gg.Reset(receiptsOffset)
+	if !gg.HasNext() {
+		return nil, buf, nil
+	}
+	buf, _ = gg.Next(buf[:0])
+	var stored types.ReceiptsForStorage
+	if err := rlp.DecodeBytes(buf, &stored); err != nil {
+		return nil, buf, err
+	}
+	receipts := make(types.Receipts, len(stored))
+	for i, r := range stored {
+		receipts[i] = (*types.Receipt)(r)
+	}
+	return receipts, buf, nil
+}
+
 func (back *BlockReaderWithSnapshots) txnByID(txnID uint64, sn *TxnSegment, buf []byte) (txn types.Transaction, err error) {
 	offset := sn.IdxTxnHash.OrdinalLookup(txnID - sn.IdxTxnHash.BaseDataID())
 	gg := sn.Seg.MakeGetter()
@@ -788,3 +864,19 @@ func (back *BlockReaderWithSnapshots) TxnLookup(ctx context.Context, tx kv.Gette
 	}
 	return blockNum, true, nil
 }
+
+// RawReceipts - receipts of the block without the fields derived from the block, from the receipts segments if they
+// have the block, otherwise from the db
+func (back *BlockReaderWithSnapshots) RawReceipts(ctx context.Context, tx kv.Tx, blockHeight uint64) (receipts types.Receipts, err error) {
+	ok, err := back.sn.ViewReceipts(blockHeight, func(seg *ReceiptSegment) error {
+		receipts, _, err = back.receiptsFromSnapshot(blockHeight, seg, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ok && receipts != nil {
+		return receipts, nil
+	}
+	return rawdb.ReadRawReceipts(tx, blockHeight), nil
+}
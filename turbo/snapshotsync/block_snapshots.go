@@ -14,6 +14,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/c2h5oh/datasize"
 	"github.com/holiman/uint256"
 	common2 "github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/common/background"
@@ -41,6 +42,7 @@ import (
 	"github.com/ledgerwatch/log/v3"
 	"go.uber.org/atomic"
 	"golang.org/x/exp/slices"
+	"golang.org/x/sync/errgroup"
 	"golang.org/x/sync/semaphore"
 )
 
@@ -325,14 +327,17 @@ type RoSnapshots struct {
 	indicesReady  atomic.Bool
 	segmentsReady atomic.Bool
 
-	Headers *headerSegments
-	Bodies  *bodySegments
-	Txs     *txnSegments
+	Headers  *headerSegments
+	Bodies   *bodySegments
+	Txs      *txnSegments
+	Receipts *receiptSegments // opened by their own rules, see ReopenReceipts
 
-	dir         string
-	segmentsMax atomic.Uint64 // all types of .seg files are available - up to this number
-	idxMax      atomic.Uint64 // all types of .idx files are available - up to this number
-	cfg         ethconfig.Snapshot
+	dir           string
+	segmentsMax   atomic.Uint64 // all types of .seg files are available - up to this number
+	idxMax        atomic.Uint64 // all types of .idx files are available - up to this number
+	receiptsReady atomic.Bool
+	receiptsMax   atomic.Uint64 // receipts .seg and .idx files are available - up to this number
+	cfg           ethconfig.Snapshot
 }
 
 // NewRoSnapshots - opens all snapshots. But to simplify everything:
@@ -341,7 +346,7 @@ type RoSnapshots struct {
 //   - gaps are not allowed
 //   - segment have [from:to) semantic
 func NewRoSnapshots(cfg ethconfig.Snapshot, snapDir string) *RoSnapshots {
-	return &RoSnapshots{dir: snapDir, cfg: cfg, Headers: &headerSegments{}, Bodies: &bodySegments{}, Txs: &txnSegments{}}
+	return &RoSnapshots{dir: snapDir, cfg: cfg, Headers: &headerSegments{}, Bodies: &bodySegments{}, Txs: &txnSegments{}, Receipts: &receiptSegments{}}
 }
 
 func (s *RoSnapshots) Cfg() ethconfig.Snapshot { return s.cfg }
@@ -436,7 +441,8 @@ func (s *RoSnapshots) Files() (list []string) {
 	return list
 }
 
-// ReopenList stops on optimistic=false, continue opening files on optimistic=true
+// ReopenList stops on optimistic=false, continue opening files on optimistic=true. Receipts segments are not in the
+// list of downloaded files - they are reopened from the folder
 func (s *RoSnapshots) ReopenList(fileNames []string, optimistic bool) error {
 	s.Headers.lock.Lock()
 	defer s.Headers.lock.Unlock()
@@ -562,6 +568,8 @@ Loop:
 			if err := sn.reopenIdxIfNeed(s.dir, optimistic); err != nil {
 				return err
 			}
+		default:
+			continue Loop
 		}
 
 		if f.To > 0 {
@@ -578,7 +586,7 @@ Loop:
 	s.idxMax.Store(s.idxAvailability())
 	s.indicesReady.Store(true)
 
-	return nil
+	return s.reopenReceipts(optimistic)
 }
 
 func (s *RoSnapshots) Ranges() (ranges []Range) {
@@ -626,6 +634,9 @@ func (s *RoSnapshots) Close() {
 	s.Txs.lock.Lock()
 	defer s.Txs.lock.Unlock()
 	s.closeWhatNotInList(nil)
+	s.Receipts.lock.Lock()
+	defer s.Receipts.lock.Unlock()
+	s.Receipts.close()
 }
 
 func (s *RoSnapshots) closeWhatNotInList(l []string) {
@@ -751,11 +762,36 @@ func buildIdx(ctx context.Context, sn snap.FileInfo, chainID uint256.Int, tmpDir
 		if err := TransactionsIdx(ctx, chainID, sn.From, sn.To, dir, tmpDir, p, lvl); err != nil {
 			return err
 		}
+	case snap.Receipts:
+		if err := ReceiptsIdx(ctx, sn.Path, sn.From, tmpDir, p, lvl); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func BuildMissedIndices(ctx context.Context, dir string, chainID uint256.Int, tmpDir string, workers int, lvl log.Lvl) error {
+// idxBytesPerKey - approximate size of 1 key in etl buffer of recsplit
+const idxBytesPerKey = 64
+
+// idxMemEstimate - how much memory building of indices of segment needs: etl buffers of recsplit grow with amount of
+// keys - up to EtlBufLimit
+func idxMemEstimate(sn snap.FileInfo) (int64, error) {
+	d, err := compress.NewDecompressor(sn.Path)
+	if err != nil {
+		return 0, err
+	}
+	defer d.Close()
+	keys := int64(d.Count()) * idxBytesPerKey
+	if sn.T == snap.Transactions { // 2 indices, see TransactionsIdx
+		return 2 * cmp.Min(keys, int64(etl.BufferOptimalSize/2)), nil
+	}
+	return cmp.Min(keys, int64(etl.BufferOptimalSize)), nil
+}
+
+// BuildMissedIndices - builds indices of many segments in parallel: `workers` - limit of segments indexed at the same
+// time, `memLimit` - limit of memory they use together. Small segments need small etl buffers - many of them can be
+// indexed in parallel
+func BuildMissedIndices(ctx context.Context, dir string, chainID uint256.Int, tmpDir string, workers int, memLimit datasize.ByteSize, lvl log.Lvl) error {
 	//log.Log(lvl, "[snapshots] Build indices", "from", min)
 	logEvery := time.NewTicker(60 * time.Second)
 	defer logEvery.Stop()
@@ -767,6 +803,7 @@ func BuildMissedIndices(ctx context.Context, dir string, chainID uint256.Int, tm
 	wg := &sync.WaitGroup{}
 	ps := background.NewProgressSet()
 	sem := semaphore.NewWeighted(int64(workers))
+	memSem := semaphore.NewWeighted(int64(memLimit))
 	go func() {
 		for _, t := range snap.AllSnapshotTypes {
 			for index := range segments {
@@ -777,13 +814,25 @@ func BuildMissedIndices(ctx context.Context, dir string, chainID uint256.Int, tm
 				if hasIdxFile(&segment) {
 					continue
 				}
+				mem, err := idxMemEstimate(segment)
+				if err != nil {
+					errs <- err
+					return
+				}
+				mem = cmp.Min(mem, int64(memLimit))
 				if err := sem.Acquire(ctx, 1); err != nil {
 					errs <- err
 					return
 				}
+				if err := memSem.Acquire(ctx, mem); err != nil {
+					sem.Release(1)
+					errs <- err
+					return
+				}
 				wg.Add(1)
 				go func(sn snap.FileInfo) {
 					defer sem.Release(1)
+					defer memSem.Release(mem)
 					defer wg.Done()
 
 					p := &background.Progress{}
@@ -933,6 +982,9 @@ type BlockRetire struct {
 	wg      *sync.WaitGroup
 	result  *BlockRetireResult
 
+	receiptsWorking atomic.Bool
+	receiptsResult  *BlockRetireResult
+
 	workers   int
 	tmpDir    string
 	snapshots *RoSnapshots
@@ -1151,7 +1203,7 @@ func hasIdxFile(sn *snap.FileInfo) bool {
 			return false
 		}
 		_ = idx.Close()
-	case snap.Bodies:
+	case snap.Bodies, snap.Receipts:
 		idx, err := recsplit.OpenIndex(path.Join(dir, fName))
 		if err != nil {
 			return false
@@ -1645,14 +1697,21 @@ RETRY:
 			panic(fmt.Errorf("expect: %d, got %d", expectedCount, i))
 		}
 
-		if err := txnHashIdx.Build(); err != nil {
-			return fmt.Errorf("txnHashIdx: %w", err)
-		}
-		if err := txnHash2BlockNumIdx.Build(); err != nil {
-			return fmt.Errorf("txnHash2BlockNumIdx: %w", err)
-		}
-
-		return nil
+		// both indices are big, build them in parallel
+		g := &errgroup.Group{}
+		g.Go(func() error {
+			if err := txnHashIdx.Build(); err != nil {
+				return fmt.Errorf("txnHashIdx: %w", err)
+			}
+			return nil
+		})
+		g.Go(func() error {
+			if err := txnHash2BlockNumIdx.Build(); err != nil {
+				return fmt.Errorf("txnHash2BlockNumIdx: %w", err)
+			}
+			return nil
+		})
+		return g.Wait()
 	}); err != nil {
 		if errors.Is(err, recsplit.ErrCollision) {
 			log.Warn("Building recsplit. Collision happened. It's ok. Restarting with another salt...", "err", err)
@@ -0,0 +1,416 @@
+package snapshotsync
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/holiman/uint256"
+	common2 "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/background"
+	"github.com/ledgerwatch/erigon-lib/common/dbg"
+	"github.com/ledgerwatch/erigon-lib/compress"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/recsplit"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync/snap"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// ReceiptSegment - receipts of a range of blocks. Unlike the segments of the blocks, they are produced after
+// execution of the range
+type ReceiptSegment struct {
+	seg               *compress.Decompressor // value: rlp(types.ReceiptsForStorage) of the block, with the logs
+	idxReceiptsNumber *recsplit.Index        // block_num_u64     -> receipts_segment_offset
+	ranges            Range
+}
+
+func (sn *ReceiptSegment) closeSeg() {
+	if sn.seg != nil {
+		sn.seg.Close()
+		sn.seg = nil
+	}
+}
+func (sn *ReceiptSegment) closeIdx() {
+	if sn.idxReceiptsNumber != nil {
+		sn.idxReceiptsNumber.Close()
+		sn.idxReceiptsNumber = nil
+	}
+}
+func (sn *ReceiptSegment) close() {
+	sn.closeSeg()
+	sn.closeIdx()
+}
+func (sn *ReceiptSegment) reopenSeg(dir string) (err error) {
+	sn.closeSeg()
+	fileName := snap.SegmentFileName(sn.ranges.from, sn.ranges.to, snap.Receipts)
+	sn.seg, err = compress.NewDecompressor(path.Join(dir, fileName))
+	if err != nil {
+		return fmt.Errorf("%w, fileName: %s", err, fileName)
+	}
+	return nil
+}
+func (sn *ReceiptSegment) reopenIdxIfNeed(dir string, optimistic bool) (err error) {
+	if sn.idxReceiptsNumber != nil {
+		return nil
+	}
+	err = sn.reopenIdx(dir)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			if optimistic {
+				log.Warn("[snapshots] open index", "err", err)
+			} else {
+				return err
+			}
+		}
+	}
+	return nil
+}
+func (sn *ReceiptSegment) reopenIdx(dir string) (err error) {
+	sn.closeIdx()
+	fileName := snap.IdxFileName(sn.ranges.from, sn.ranges.to, snap.Receipts.String())
+	sn.idxReceiptsNumber, err = recsplit.OpenIndex(path.Join(dir, fileName))
+	if err != nil {
+		return fmt.Errorf("%w, fileName: %s", err, fileName)
+	}
+	return nil
+}
+
+type receiptSegments struct {
+	lock     sync.RWMutex
+	segments []*ReceiptSegment
+}
+
+func (s *receiptSegments) View(f func([]*ReceiptSegment) error) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return f(s.segments)
+}
+func (s *receiptSegments) ViewSegment(blockNum uint64, f func(*ReceiptSegment) error) (found bool, err error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for _, seg := range s.segments {
+		if !(blockNum >= seg.ranges.from && blockNum < seg.ranges.to) {
+			continue
+		}
+		return true, f(seg)
+	}
+	return false, nil
+}
+func (s *receiptSegments) close() {
+	for _, sn := range s.segments {
+		sn.close()
+	}
+	s.segments = nil
+}
+
+// ReceiptsAvailable - receipts of the blocks up to this number are in the segments
+func (s *RoSnapshots) ReceiptsAvailable() uint64 { return s.receiptsMax.Load() }
+
+func (s *RoSnapshots) ReceiptRanges() (ranges []Range) {
+	_ = s.Receipts.View(func(segments []*ReceiptSegment) error {
+		for _, sn := range segments {
+			ranges = append(ranges, sn.ranges)
+		}
+		return nil
+	})
+	return ranges
+}
+
+func (s *RoSnapshots) ViewReceipts(blockNum uint64, f func(sn *ReceiptSegment) error) (found bool, err error) {
+	if !s.receiptsReady.Load() || blockNum > s.ReceiptsAvailable() {
+		return false, nil
+	}
+	return s.Receipts.ViewSegment(blockNum, f)
+}
+
+// ReopenReceipts - opens the receipts segments of the folder, by the rules of ReceiptSegments. They are not in the list
+// of downloaded files: the node produces them after execution, see RetireReceiptsInBackground
+func (s *RoSnapshots) ReopenReceipts() error { return s.reopenReceipts(false) }
+
+func (s *RoSnapshots) reopenReceipts(optimistic bool) error {
+	files, _, err := ReceiptSegments(s.dir)
+	if err != nil {
+		return err
+	}
+	s.Receipts.lock.Lock()
+	defer s.Receipts.lock.Unlock()
+	s.Receipts.close()
+	for _, f := range files {
+		sn := &ReceiptSegment{ranges: Range{f.From, f.To}}
+		if err := sn.reopenSeg(s.dir); err != nil {
+			// gaps are not allowed - the segments after this one are not used
+			if errors.Is(err, os.ErrNotExist) {
+				break
+			}
+			if optimistic {
+				log.Warn("[snapshots] open segment", "err", err)
+				break
+			}
+			return err
+		}
+		s.Receipts.segments = append(s.Receipts.segments, sn)
+		if err := sn.reopenIdxIfNeed(s.dir, optimistic); err != nil {
+			return err
+		}
+	}
+	s.receiptsMax.Store(s.receiptsAvailability())
+	s.receiptsReady.Store(true)
+	return nil
+}
+
+func (s *RoSnapshots) receiptsAvailability() (receipts uint64) {
+	for _, seg := range s.Receipts.segments {
+		if seg.idxReceiptsNumber == nil {
+			break
+		}
+		receipts = seg.ranges.to - 1
+	}
+	return receipts
+}
+
+// ReceiptSegments - receipts segments don't need the segments of other types of their range (execution may lag behind
+// the retired blocks, and the blocks may come from other nodes), but must have no gaps from the first block
+func ReceiptSegments(dir string) (res []snap.FileInfo, missingSnapshots []Range, err error) {
+	list, err := snap.Segments(dir)
+	if err != nil {
+		return nil, missingSnapshots, err
+	}
+	var l []snap.FileInfo
+	for _, f := range list {
+		if f.T != snap.Receipts {
+			continue
+		}
+		l = append(l, f)
+	}
+	res, missingSnapshots = noGaps(noOverlaps(l))
+	return res, missingSnapshots, nil
+}
+
+// ReceiptsIdx - blockNum -> offset (analog of kv.Receipts)
+func ReceiptsIdx(ctx context.Context, segmentFilePath string, firstBlockNumInSegment uint64, tmpDir string, p *background.Progress, lvl log.Lvl) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			_, fName := filepath.Split(segmentFilePath)
+			err = fmt.Errorf("ReceiptsIdx: at=%s, %v, %s", fName, rec, dbg.Stack())
+		}
+	}()
+
+	num := make([]byte, 8)
+
+	d, err := compress.NewDecompressor(segmentFilePath)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	_, fname := filepath.Split(segmentFilePath)
+	p.Name.Store(fname)
+	p.Total.Store(uint64(d.Count()))
+
+	if err := Idx(ctx, d, firstBlockNumInSegment, tmpDir, log.LvlDebug, func(idx *recsplit.RecSplit, i, offset uint64, word []byte) error {
+		p.Processed.Inc()
+		n := binary.PutUvarint(num, i)
+		if err := idx.AddKey(num[:n], offset); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("ReceiptsNumberIdx: %w", err)
+	}
+	return nil
+}
+
+// DumpReceipts - [from, to). Receipts of every block of the range must be in the db
+func DumpReceipts(ctx context.Context, db kv.RoDB, segmentFilePath, tmpDir string, blockFrom, blockTo uint64, workers int, lvl log.Lvl) error {
+	logEvery := time.NewTicker(20 * time.Second)
+	defer logEvery.Stop()
+
+	f, err := compress.NewCompressor(ctx, "Snapshot Receipts", segmentFilePath, tmpDir, compress.MinPatternScore, workers, lvl)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	expectedBlockNum := blockFrom
+	from := dbutils.EncodeBlockNumber(blockFrom)
+	if err := kv.BigChunks(db, kv.Receipts, from, func(tx kv.Tx, k, v []byte) (bool, error) {
+		blockNum := binary.BigEndian.Uint64(k)
+		if blockNum >= blockTo {
+			return false, nil
+		}
+		if blockNum != expectedBlockNum {
+			return false, fmt.Errorf("receipts missed in db: block_num=%d", expectedBlockNum)
+		}
+		expectedBlockNum++
+
+		// receipts of a block without transactions are read as nil
+		receipts := rawdb.ReadRawReceipts(tx, blockNum)
+		stored := make(types.ReceiptsForStorage, len(receipts))
+		for i, r := range receipts {
+			stored[i] = (*types.ReceiptForStorage)(r)
+		}
+		value, err := rlp.EncodeToBytes(stored)
+		if err != nil {
+			return false, err
+		}
+		if err := f.AddWord(value); err != nil {
+			return false, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-logEvery.C:
+			var m runtime.MemStats
+			if lvl >= log.LvlInfo {
+				common2.ReadMemStats(&m)
+			}
+			log.Log(lvl, "[snapshots] Dumping receipts", "block num", blockNum,
+				"alloc", common2.ByteCount(m.Alloc), "sys", common2.ByteCount(m.Sys),
+			)
+		default:
+		}
+		return true, nil
+	}); err != nil {
+		return err
+	}
+	if expectedBlockNum != blockTo {
+		return fmt.Errorf("receipts missed in db: block_num=%d", expectedBlockNum)
+	}
+	if err := f.Compress(); err != nil {
+		return fmt.Errorf("compress: %w", err)
+	}
+	return nil
+}
+
+// CanRetireReceipts - receipts are retired by the same ranges as blocks, once the blocks are executed and immutable.
+// Retiring needs the receipts of the whole range in the db, which nodes pruning the receipts may not have
+func CanRetireReceipts(executedBlockNum, receiptsAvailableFrom uint64, snapshots *RoSnapshots) (blockFrom, blockTo uint64, can bool) {
+	if executedBlockNum < params.FullImmutabilityThreshold {
+		return 0, 0, false
+	}
+	blockFrom, blockTo, can = canRetire(snapshots.ReceiptsAvailable()+1, executedBlockNum-params.FullImmutabilityThreshold)
+	return blockFrom, blockTo, can && receiptsAvailableFrom <= blockFrom
+}
+
+func (br *BlockRetire) ReceiptsWorking() bool { return br.receiptsWorking.Load() }
+func (br *BlockRetire) ReceiptsResult() *BlockRetireResult {
+	r := br.receiptsResult
+	br.receiptsResult = nil
+	return r
+}
+
+func (br *BlockRetire) RetireReceipts(ctx context.Context, blockFrom, blockTo uint64, lvl log.Lvl) error {
+	return retireReceipts(ctx, blockFrom, blockTo, br.tmpDir, br.snapshots, br.db, br.workers, lvl, br.notifier)
+}
+
+// RetireReceiptsInBackground - like RetireBlocksInBackground, but for the receipts of the executed blocks
+func (br *BlockRetire) RetireReceiptsInBackground(ctx context.Context, executedBlockNum, receiptsAvailableFrom uint64, lvl log.Lvl) {
+	if br.receiptsWorking.Load() {
+		// go-routine is still working
+		return
+	}
+	if br.receiptsResult != nil {
+		// Prevent invocation for the same range twice, result needs to be cleared in the ReceiptsResult() function
+		return
+	}
+
+	br.wg.Add(1)
+	go func() {
+		br.receiptsWorking.Store(true)
+		defer br.receiptsWorking.Store(false)
+		defer br.wg.Done()
+
+		blockFrom, blockTo, ok := CanRetireReceipts(executedBlockNum, receiptsAvailableFrom, br.Snapshots())
+		if !ok {
+			return
+		}
+
+		err := br.RetireReceipts(ctx, blockFrom, blockTo, lvl)
+		br.receiptsResult = &BlockRetireResult{
+			BlockFrom: blockFrom,
+			BlockTo:   blockTo,
+			Err:       err,
+		}
+	}()
+}
+
+func retireReceipts(ctx context.Context, blockFrom, blockTo uint64, tmpDir string, snapshots *RoSnapshots, db kv.RoDB, workers int, lvl log.Lvl, notifier DBEventNotifier) error {
+	log.Log(lvl, "[snapshots] Retire Receipts", "range", fmt.Sprintf("%dk-%dk", blockFrom/1000, blockTo/1000))
+	for i := blockFrom; i < blockTo; i = chooseSegmentEnd(i, blockTo, snap.DEFAULT_SEGMENT_SIZE) {
+		segName := snap.SegmentFileName(i, chooseSegmentEnd(i, blockTo, snap.DEFAULT_SEGMENT_SIZE), snap.Receipts)
+		f, _ := snap.ParseFileName(snapshots.Dir(), segName)
+		if err := DumpReceipts(ctx, db, f.Path, tmpDir, f.From, f.To, workers, lvl); err != nil {
+			return fmt.Errorf("DumpReceipts: %w", err)
+		}
+		p := &background.Progress{}
+		if err := ReceiptsIdx(ctx, f.Path, f.From, tmpDir, p, lvl); err != nil {
+			return err
+		}
+	}
+	if err := snapshots.ReopenReceipts(); err != nil {
+		return fmt.Errorf("reopen: %w", err)
+	}
+	if notifier != nil { // notify about new snapshots of any size
+		notifier.OnNewSnapshot()
+	}
+	merger := NewMerger(tmpDir, workers, lvl, uint256.Int{}, notifier) // chainID is needed only by the indices of transactions
+	return merger.MergeReceipts(ctx, snapshots, merger.FindMergeRanges(snapshots.ReceiptRanges()), snapshots.Dir())
+}
+
+// MergeReceipts - like Merge, for the receipts segments. Their download is not requested: other nodes produce their
+// own ones
+func (m *Merger) MergeReceipts(ctx context.Context, snapshots *RoSnapshots, mergeRanges []Range, snapDir string) error {
+	if len(mergeRanges) == 0 {
+		return nil
+	}
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+	log.Log(m.lvl, "[snapshots] Merge receipts segments", "ranges", fmt.Sprintf("%v", mergeRanges))
+	for _, r := range mergeRanges {
+		var toMerge []string
+		_ = snapshots.Receipts.View(func(segments []*ReceiptSegment) error {
+			for _, sn := range segments {
+				if sn.ranges.from < r.from {
+					continue
+				}
+				if sn.ranges.to > r.to {
+					break
+				}
+				toMerge = append(toMerge, sn.seg.FilePath())
+			}
+			return nil
+		})
+		f, _ := snap.ParseFileName(snapDir, snap.SegmentFileName(r.from, r.to, snap.Receipts))
+		if err := m.merge(ctx, toMerge, f.Path, logEvery); err != nil {
+			return fmt.Errorf("mergeByAppendSegments: %w", err)
+		}
+		p := &background.Progress{}
+		if err := ReceiptsIdx(ctx, f.Path, f.From, m.tmpDir, p, m.lvl); err != nil {
+			return err
+		}
+		// the merged segment has the largest range, it replaces the old ones
+		if err := snapshots.ReopenReceipts(); err != nil {
+			return fmt.Errorf("ReopenReceipts: %w", err)
+		}
+		if m.notifier != nil { // notify about new snapshots of any size
+			m.notifier.OnNewSnapshot()
+			time.Sleep(1 * time.Second) // i working on blocking API - to ensure client does not use old snapsthos - and then delete them
+		}
+		m.removeOldFiles(toMerge, snapDir)
+	}
+	log.Log(m.lvl, "[snapshots] Merge receipts done", "from", mergeRanges[0].from)
+	return nil
+}
@@ -0,0 +1,146 @@
+package snapshotsync
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/common/background"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync/snap"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+// testReceipts - blocks with odd numbers have a transaction with a log
+func testReceipts(blockNum uint64) types.Receipts {
+	if blockNum%2 == 0 {
+		return nil
+	}
+	return types.Receipts{{
+		Status:            types.ReceiptStatusSuccessful,
+		CumulativeGasUsed: blockNum,
+		Logs:              []*types.Log{{Address: common.Address{byte(blockNum)}, Topics: []common.Hash{{1}}, Data: []byte{byte(blockNum >> 8)}}},
+	}}
+}
+
+func requireTestReceipts(t *testing.T, blockNum uint64, receipts types.Receipts) {
+	expected := testReceipts(blockNum)
+	require.NotNil(t, receipts, "block %d", blockNum)
+	require.Equal(t, len(expected), len(receipts), "block %d", blockNum)
+	for i, r := range receipts {
+		require.Equal(t, expected[i].Status, r.Status)
+		require.Equal(t, expected[i].CumulativeGasUsed, r.CumulativeGasUsed)
+		require.Equal(t, len(expected[i].Logs), len(r.Logs))
+		for j, l := range r.Logs {
+			require.Equal(t, expected[i].Logs[j].Address, l.Address)
+			require.Equal(t, expected[i].Logs[j].Topics, l.Topics)
+			require.Equal(t, expected[i].Logs[j].Data, l.Data)
+		}
+	}
+}
+
+func createTestReceiptsDB(t *testing.T, blockFrom, blockTo uint64) kv.RwDB {
+	db := memdb.NewTestDB(t)
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		for blockNum := blockFrom; blockNum < blockTo; blockNum++ {
+			if err := rawdb.WriteReceipts(tx, blockNum, testReceipts(blockNum)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	return db
+}
+
+func TestReceiptsSegments(t *testing.T) {
+	ctx, dir, require := context.Background(), t.TempDir(), require.New(t)
+	db := createTestReceiptsDB(t, 0, 2_000)
+	for from := uint64(0); from < 2_000; from += 1_000 {
+		segPath := filepath.Join(dir, snap.SegmentFileName(from, from+1_000, snap.Receipts))
+		require.NoError(DumpReceipts(ctx, db, segPath, dir, from, from+1_000, 1, log.LvlDebug))
+		require.NoError(ReceiptsIdx(ctx, segPath, from, dir, &background.Progress{}, log.LvlDebug))
+	}
+	// receipts of the range are not in the db
+	err := DumpReceipts(ctx, db, filepath.Join(dir, snap.SegmentFileName(2_000, 3_000, snap.Receipts)), dir, 2_000, 3_000, 1, log.LvlDebug)
+	require.Error(err)
+	// after a gap
+	createTestSegmentFile(t, 3_000, 4_000, snap.Receipts, dir)
+
+	// receipts segments are opened without the segments of the blocks
+	s := NewRoSnapshots(ethconfig.Snapshot{Enabled: true}, dir)
+	defer s.Close()
+	require.NoError(s.ReopenFolder())
+	require.Zero(s.BlocksAvailable())
+	require.Equal(uint64(1_999), s.ReceiptsAvailable())
+	require.Equal([]Range{{0, 1_000}, {1_000, 2_000}}, s.ReceiptRanges())
+
+	require.NoError(db.Update(ctx, func(tx kv.RwTx) error {
+		return rawdb.WriteReceipts(tx, 10_001, testReceipts(10_001))
+	}))
+	reader := NewBlockReaderWithSnapshots(s)
+	require.NoError(db.View(ctx, func(tx kv.Tx) error {
+		for _, blockNum := range []uint64{0, 1, 999, 1_000, 1_999} {
+			receipts, err := reader.RawReceipts(ctx, tx, blockNum)
+			require.NoError(err)
+			requireTestReceipts(t, blockNum, receipts)
+		}
+		// from the db
+		receipts, err := reader.RawReceipts(ctx, tx, 10_001)
+		require.NoError(err)
+		requireTestReceipts(t, 10_001, receipts)
+		return nil
+	}))
+
+	from, to, ok := CanRetireReceipts(10_000+params.FullImmutabilityThreshold, 0, s)
+	require.True(ok)
+	require.Equal(uint64(2_000), from)
+	require.Equal(uint64(3_000), to)
+	// receipts of the range are pruned
+	_, _, ok = CanRetireReceipts(10_000+params.FullImmutabilityThreshold, 2_500, s)
+	require.False(ok)
+	_, _, ok = CanRetireReceipts(params.FullImmutabilityThreshold-1, 0, s)
+	require.False(ok)
+}
+
+func TestRetireReceipts(t *testing.T) {
+	ctx, dir, require := context.Background(), t.TempDir(), require.New(t)
+	db := createTestReceiptsDB(t, 0, 10_000)
+	s := NewRoSnapshots(ethconfig.Snapshot{Enabled: true}, dir)
+	defer s.Close()
+	for from := uint64(0); from < 10_000; from += 1_000 {
+		require.NoError(retireReceipts(ctx, from, from+1_000, dir, s, db, 1, log.LvlDebug, nil))
+	}
+	// the last range completes the 10k segment
+	require.Equal([]Range{{0, 10_000}}, s.ReceiptRanges())
+	segments, _, err := ReceiptSegments(dir)
+	require.NoError(err)
+	require.Equal(1, len(segments))
+	require.Equal(uint64(9_999), s.ReceiptsAvailable())
+
+	reader := NewBlockReaderWithSnapshots(s)
+	require.NoError(db.Update(ctx, func(tx kv.RwTx) error {
+		// receipts are read from the segments
+		if err := rawdb.TruncateReceipts(tx, 0); err != nil {
+			return err
+		}
+		for _, blockNum := range []uint64{0, 1_001, 9_999} {
+			receipts, err := reader.RawReceipts(ctx, tx, blockNum)
+			require.NoError(err)
+			requireTestReceipts(t, blockNum, receipts)
+		}
+		receipts, err := reader.RawReceipts(ctx, tx, 10_001)
+		require.NoError(err)
+		require.Nil(receipts)
+		return nil
+	}))
+	from, _, ok := CanRetireReceipts(20_000+params.FullImmutabilityThreshold, 0, s)
+	require.True(ok)
+	require.Equal(uint64(10_000), from)
+}
@@ -2,6 +2,7 @@ package snapshotsync
 
 import (
 	"context"
+	"os"
 	"path/filepath"
 	"testing"
 	"testing/fstest"
@@ -106,6 +107,25 @@ func TestMergeSnapshots(t *testing.T) {
 	require.Equal(1, a)
 }
 
+func TestBuildMissedIndices(t *testing.T) {
+	ctx, dir, require := context.Background(), t.TempDir(), require.New(t)
+	var parent common.Hash
+	for from := uint64(0); from < 4_000; from += 1_000 {
+		parent = createTestBlocksSegments(t, dir, from, from+1_000, parent, math.MaxUint64)
+	}
+	idxFiles, err := snap.IdxFiles(dir)
+	require.NoError(err)
+	for _, f := range idxFiles {
+		require.NoError(os.Remove(f.Path))
+	}
+
+	// memory limit is less than any segment needs - segments are indexed one by one
+	require.NoError(BuildMissedIndices(ctx, dir, uint256.Int{}, dir, 4, 1_000, log.LvlDebug))
+	report, err := VerifySegments(ctx, dir, uint256.Int{}, log.LvlDebug)
+	require.NoError(err)
+	require.True(report.Ok(), "%v %v", report.Segments, report.Indices)
+}
+
 func TestCanRetire(t *testing.T) {
 	require := require.New(t)
 	cases := []struct {
@@ -0,0 +1,274 @@
+package snapshotsync
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/compress"
+	"github.com/ledgerwatch/erigon-lib/recsplit"
+	types2 "github.com/ledgerwatch/erigon-lib/types"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync/snap"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// VerifyReport - problems found by VerifySegments
+type VerifyReport struct {
+	Segments map[string]error // broken .seg file name -> problem
+	Indices  map[string]error // broken .idx file name -> problem
+	Gaps     []Range          // blocks ranges without segments - Erigon will download them on start
+}
+
+// Ok - no broken files found
+func (r *VerifyReport) Ok() bool { return len(r.Segments) == 0 && len(r.Indices) == 0 }
+
+// VerifySegments - reads all segments and checks that:
+//   - headers have sequential numbers, and each header is parent of next one - also across segments
+//   - bodies have sequential BaseTxId, and amount of transactions matches bodies
+//   - every .idx finds every word of segment by key and by ordinal
+//
+// It doesn't check hashes of files - see downloader.BrokenDataFiles
+func VerifySegments(ctx context.Context, snapDir string, chainID uint256.Int, lvl log.Lvl) (*VerifyReport, error) {
+	segments, missingSnapshots, err := Segments(snapDir)
+	if err != nil {
+		return nil, err
+	}
+	report := &VerifyReport{Segments: map[string]error{}, Indices: map[string]error{}, Gaps: missingSnapshots}
+	var parentHash *common.Hash // nil if previous segment is broken
+	var nextTxID *uint64
+	for _, f := range segments {
+		if f.T != snap.Headers {
+			continue
+		}
+		r := Range{f.From, f.To}
+		start := time.Now()
+		parentHash = verifyHeaders(ctx, snapDir, r, parentHash, report)
+		var txAmounts []uint32
+		var firstTxID uint64
+		firstTxID, txAmounts, nextTxID = verifyBodies(ctx, snapDir, r, nextTxID, report)
+		if txAmounts != nil {
+			verifyTxs(ctx, snapDir, r, chainID, firstTxID, txAmounts, report)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		log.Log(lvl, "[snapshots] Verified", "blocks", r.String(), "took", time.Since(start), "broken", len(report.Segments)+len(report.Indices))
+	}
+	return report, nil
+}
+
+// verifyHeaders - returns hash of last header, nil if segment is broken
+func verifyHeaders(ctx context.Context, dir string, r Range, parentHash *common.Hash, report *VerifyReport) (lastHash *common.Hash) {
+	segName := snap.SegmentFileName(r.from, r.to, snap.Headers)
+	idx := openIdxChecker(dir, snap.IdxFileName(r.from, r.to, snap.Headers.String()), r.from)
+	defer idx.close(report)
+	err := walkSegment(ctx, filepath.Join(dir, segName), r.to-r.from, func(i, offset uint64, word []byte) error {
+		if len(word) == 0 {
+			return fmt.Errorf("empty header at block %d", r.from+i)
+		}
+		h := new(types.Header)
+		if err := rlp.DecodeBytes(word[1:], h); err != nil {
+			return fmt.Errorf("header at block %d: %w", r.from+i, err)
+		}
+		hash := h.Hash()
+		if h.Number.Uint64() != r.from+i {
+			return fmt.Errorf("header of block %d at block %d", h.Number.Uint64(), r.from+i)
+		}
+		if word[0] != hash[0] {
+			return fmt.Errorf("header at block %d: first byte of hash %x, expected %x", r.from+i, word[0], hash[0])
+		}
+		if parentHash != nil && h.ParentHash != *parentHash {
+			return fmt.Errorf("header at block %d: parent %x, expected %x", r.from+i, h.ParentHash, *parentHash)
+		}
+		idx.checkEnum(i, hash[:], offset)
+		parentHash = &hash
+		return nil
+	})
+	if err != nil {
+		report.Segments[segName] = err
+		return nil
+	}
+	return parentHash
+}
+
+// verifyBodies - returns amount of transactions in each block, nil if segment is broken
+func verifyBodies(ctx context.Context, dir string, r Range, nextTxID *uint64, report *VerifyReport) (firstTxID uint64, txAmounts []uint32, lastTxID *uint64) {
+	segName := snap.SegmentFileName(r.from, r.to, snap.Bodies)
+	idx := openIdxChecker(dir, snap.IdxFileName(r.from, r.to, snap.Bodies.String()), r.from)
+	defer idx.close(report)
+	txAmounts = make([]uint32, 0, r.to-r.from)
+	num := make([]byte, binary.MaxVarintLen64)
+	var b types.BodyForStorage
+	err := walkSegment(ctx, filepath.Join(dir, segName), r.to-r.from, func(i, offset uint64, word []byte) error {
+		if err := rlp.DecodeBytes(word, &b); err != nil {
+			return fmt.Errorf("body at block %d: %w", r.from+i, err)
+		}
+		if i == 0 {
+			firstTxID = b.BaseTxId
+		}
+		if nextTxID != nil && b.BaseTxId != *nextTxID {
+			return fmt.Errorf("body at block %d: BaseTxId %d, expected %d", r.from+i, b.BaseTxId, *nextTxID)
+		}
+		n := binary.PutUvarint(num, i)
+		idx.checkEnum(i, num[:n], offset)
+		txAmounts = append(txAmounts, b.TxAmount)
+		next := b.BaseTxId + uint64(b.TxAmount)
+		nextTxID = &next
+		return nil
+	})
+	if err != nil {
+		report.Segments[segName] = err
+		return 0, nil, nil
+	}
+	return firstTxID, txAmounts, nextTxID
+}
+
+func verifyTxs(ctx context.Context, dir string, r Range, chainID uint256.Int, firstTxID uint64, txAmounts []uint32, report *VerifyReport) {
+	segName := snap.SegmentFileName(r.from, r.to, snap.Transactions)
+	var expectedCount uint64
+	for _, amount := range txAmounts {
+		expectedCount += uint64(amount)
+	}
+	idx := openIdxChecker(dir, snap.IdxFileName(r.from, r.to, snap.Transactions.String()), firstTxID)
+	defer idx.close(report)
+	idx2Block := openIdxChecker(dir, snap.IdxFileName(r.from, r.to, snap.Transactions2Block.String()), r.from)
+	defer idx2Block.close(report)
+
+	parseCtx := types2.NewTxParseContext(chainID)
+	parseCtx.WithSender(false)
+	slot := types2.TxSlot{}
+	var block, txsInBlock uint64
+	err := walkSegment(ctx, filepath.Join(dir, segName), expectedCount, func(i, offset uint64, word []byte) error {
+		for txsInBlock == uint64(txAmounts[block]) { // skip empty blocks
+			block++
+			txsInBlock = 0
+		}
+		txsInBlock++
+		if len(word) == 0 { // system-txs have no hash to lookup
+			idx.checkEnum(i, nil, offset)
+			return nil
+		}
+		if len(word) < 1+20 {
+			return fmt.Errorf("transaction %d: too short", firstTxID+i)
+		}
+		if _, err := parseCtx.ParseTransaction(word[1+20:], 0, &slot, nil, true /* hasEnvelope */, nil); err != nil {
+			return fmt.Errorf("transaction %d: %w", firstTxID+i, err)
+		}
+		if word[0] != slot.IDHash[0] {
+			return fmt.Errorf("transaction %d: first byte of hash %x, expected %x", firstTxID+i, word[0], slot.IDHash[0])
+		}
+		idx.checkEnum(i, slot.IDHash[:], offset)
+		idx2Block.checkValue(slot.IDHash[:], r.from+block)
+		return nil
+	})
+	if err != nil {
+		report.Segments[segName] = err
+	}
+}
+
+// walkSegment - calls f for every word of segment, checks that segment has expected amount of words
+func walkSegment(ctx context.Context, segPath string, expectedCount uint64, f func(i, offset uint64, word []byte) error) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("%v", rec)
+		}
+	}()
+	d, err := compress.NewDecompressor(segPath)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if uint64(d.Count()) != expectedCount {
+		return fmt.Errorf("expected %d words, got %d", expectedCount, d.Count())
+	}
+	return d.WithReadAhead(func() error {
+		g := d.MakeGetter()
+		var i, offset, nextPos uint64
+		word := make([]byte, 0, 4096)
+		for g.HasNext() {
+			word, nextPos = g.Next(word[:0])
+			if err := f(i, offset, word); err != nil {
+				return err
+			}
+			i++
+			offset = nextPos
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+		}
+		return nil
+	})
+}
+
+// idxChecker - checks .idx while segment is walked, remembers first problem
+type idxChecker struct {
+	name   string
+	idx    *recsplit.Index
+	reader *recsplit.IndexReader
+	err    error
+}
+
+func openIdxChecker(dir, name string, baseDataID uint64) *idxChecker {
+	c := &idxChecker{name: name}
+	if c.idx, c.err = recsplit.OpenIndex(filepath.Join(dir, name)); c.err != nil {
+		return c
+	}
+	if c.idx.BaseDataID() != baseDataID {
+		c.err = fmt.Errorf("baseDataID %d, expected %d", c.idx.BaseDataID(), baseDataID)
+		return c
+	}
+	c.reader = recsplit.NewIndexReader(c.idx)
+	return c
+}
+
+// checkEnum - .idx built with Enums must find i-th word by key, and offset of i-th word by ordinal. nil key is not checked
+func (c *idxChecker) checkEnum(i uint64, key []byte, offset uint64) {
+	if c.err != nil {
+		return
+	}
+	defer c.catch()
+	if key != nil {
+		if id := c.reader.Lookup(key); id != i {
+			c.err = fmt.Errorf("key %x of word %d points to word %d", key, i, id)
+			return
+		}
+	}
+	if o := c.idx.OrdinalLookup(i); o != offset {
+		c.err = fmt.Errorf("word %d at offset %d, expected %d", i, o, offset)
+	}
+}
+
+// checkValue - .idx built without Enums must map key to value
+func (c *idxChecker) checkValue(key []byte, value uint64) {
+	if c.err != nil {
+		return
+	}
+	defer c.catch()
+	if v := c.reader.Lookup(key); v != value {
+		c.err = fmt.Errorf("key %x points to %d, expected %d", key, v, value)
+	}
+}
+
+func (c *idxChecker) catch() {
+	if rec := recover(); rec != nil {
+		c.err = fmt.Errorf("%v", rec)
+	}
+}
+
+func (c *idxChecker) close(report *VerifyReport) {
+	if c.idx != nil {
+		c.idx.Close()
+	}
+	if c.err != nil {
+		report.Indices[c.name] = c.err
+	}
+}
@@ -0,0 +1,82 @@
+package snapshotsync
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common/background"
+	"github.com/ledgerwatch/erigon-lib/compress"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync/snap"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+// createTestBlocksSegments - blocks [from:to) with 2 system transactions each, brokenAt - block with wrong parent hash
+func createTestBlocksSegments(t *testing.T, dir string, from, to uint64, parent common.Hash, brokenAt uint64) common.Hash {
+	ctx, require := context.Background(), require.New(t)
+	newCompressor := func(t snap.Type) *compress.Compressor {
+		c, err := compress.NewCompressor(ctx, "test", filepath.Join(dir, snap.SegmentFileName(from, to, t)), dir, 100, 1, log.LvlDebug)
+		require.NoError(err)
+		return c
+	}
+	headers, bodies, txs := newCompressor(snap.Headers), newCompressor(snap.Bodies), newCompressor(snap.Transactions)
+	defer headers.Close()
+	defer bodies.Close()
+	defer txs.Close()
+	for i := from; i < to; i++ {
+		h := &types.Header{Number: new(big.Int).SetUint64(i), ParentHash: parent, Difficulty: big.NewInt(1)}
+		if i == brokenAt {
+			h.ParentHash = common.Hash{1}
+		}
+		headerRlp, err := rlp.EncodeToBytes(h)
+		require.NoError(err)
+		parent = h.Hash()
+		require.NoError(headers.AddWord(append([]byte{parent[0]}, headerRlp...)))
+
+		bodyRlp, err := rlp.EncodeToBytes(&types.BodyForStorage{BaseTxId: 2 * i, TxAmount: 2})
+		require.NoError(err)
+		require.NoError(bodies.AddWord(bodyRlp))
+		require.NoError(txs.AddWord(nil))
+		require.NoError(txs.AddWord(nil))
+	}
+	require.NoError(headers.Compress())
+	require.NoError(bodies.Compress())
+	require.NoError(txs.Compress())
+
+	p := &background.Progress{}
+	require.NoError(HeadersIdx(ctx, filepath.Join(dir, snap.SegmentFileName(from, to, snap.Headers)), from, dir, p, log.LvlDebug))
+	require.NoError(BodiesIdx(ctx, filepath.Join(dir, snap.SegmentFileName(from, to, snap.Bodies)), from, dir, p, log.LvlDebug))
+	require.NoError(TransactionsIdx(ctx, uint256.Int{}, from, to, dir, dir, p, log.LvlDebug))
+	return parent
+}
+
+func TestVerifySegments(t *testing.T) {
+	ctx, require := context.Background(), require.New(t)
+
+	dir := t.TempDir()
+	last := createTestBlocksSegments(t, dir, 0, 1_000, common.Hash{}, math.MaxUint64)
+	createTestBlocksSegments(t, dir, 1_000, 2_000, last, math.MaxUint64)
+	report, err := VerifySegments(ctx, dir, uint256.Int{}, log.LvlDebug)
+	require.NoError(err)
+	require.True(report.Ok(), "%v %v", report.Segments, report.Indices)
+
+	// block 1500 is not a child of block 1499, and an index is missing
+	dir = t.TempDir()
+	createTestBlocksSegments(t, dir, 0, 1_000, common.Hash{}, math.MaxUint64)
+	createTestBlocksSegments(t, dir, 1_000, 2_000, last, 1_500)
+	require.NoError(os.Remove(filepath.Join(dir, snap.IdxFileName(0, 1_000, snap.Transactions2Block.String()))))
+	report, err = VerifySegments(ctx, dir, uint256.Int{}, log.LvlDebug)
+	require.NoError(err)
+	require.Len(report.Segments, 1)
+	require.Contains(report.Segments, snap.SegmentFileName(1_000, 2_000, snap.Headers))
+	require.Len(report.Indices, 1)
+	require.Contains(report.Indices, snap.IdxFileName(0, 1_000, snap.Transactions2Block.String()))
+}
@@ -20,6 +20,7 @@ const (
 	Headers Type = iota
 	Bodies
 	Transactions
+	Receipts // produced after execution, not in AllSnapshotTypes
 	NumberOfTypes
 )
 
@@ -31,6 +32,8 @@ func (ft Type) String() string {
 		return "bodies"
 	case Transactions:
 		return "transactions"
+	case Receipts:
+		return "receipts"
 	default:
 		panic(fmt.Sprintf("unknown file type: %d", ft))
 	}
@@ -44,6 +47,8 @@ func ParseFileType(s string) (Type, bool) {
 		return Bodies, true
 	case "transactions":
 		return Transactions, true
+	case "receipts":
+		return Receipts, true
 	default:
 		return NumberOfTypes, false
 	}
@@ -57,6 +62,8 @@ const (
 
 func (it IdxType) String() string { return string(it) }
 
+// AllSnapshotTypes - segments of all these types must exist to make a range of blocks available. Receipts segments
+// are not here: they are produced by the node after execution, so a range of blocks is available without them
 var AllSnapshotTypes = []Type{Headers, Bodies, Transactions}
 
 var (
@@ -122,6 +129,8 @@ func ParseFileName(dir, fileName string) (res FileInfo, err error) {
 		snapshotType = Bodies
 	case Transactions:
 		snapshotType = Transactions
+	case Receipts:
+		snapshotType = Receipts
 	default:
 		return res, fmt.Errorf("unexpected snapshot suffix: %s,%w", parts[2], ErrInvalidFileName)
 	}
@@ -4,11 +4,12 @@ import (
 	"context"
 	"fmt"
 	"math/big"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/holiman/uint256"
 	"github.com/ledgerwatch/erigon-lib/kv"
-	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/core"
 	"github.com/ledgerwatch/erigon/core/state"
@@ -17,22 +18,78 @@ import (
 	"github.com/ledgerwatch/erigon/internal/ethapi"
 	"github.com/ledgerwatch/erigon/params"
 	"github.com/ledgerwatch/erigon/rpc"
-	"github.com/ledgerwatch/erigon/turbo/rpchelper"
 	"github.com/ledgerwatch/erigon/turbo/services"
 	"github.com/ledgerwatch/log/v3"
 )
 
-const callTimeout = 5 * time.Minute
+// DefaultCallTimeout limits the execution time of the calls and of the traces without a timeout
+const DefaultCallTimeout = 5 * time.Minute
+
+// CallBudget limits the execution of a call (eth_call, eth_estimateGas). The zero fields are not limited
+type CallBudget struct {
+	GasCap    uint64
+	Timeout   time.Duration
+	MaxMemory uint64 // of each call frame, in bytes
+}
+
+// ParseCallBudget parses the budget "gas=<gas>,timeout=<duration>,memory=<bytes>", all fields are optional
+func ParseCallBudget(s string) (CallBudget, error) {
+	var budget CallBudget
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return CallBudget{}, fmt.Errorf("invalid call budget field %q, expected <name>=<value>", field)
+		}
+		var err error
+		switch name, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]); name {
+		case "gas":
+			budget.GasCap, err = strconv.ParseUint(value, 10, 64)
+		case "timeout":
+			budget.Timeout, err = time.ParseDuration(value)
+		case "memory":
+			budget.MaxMemory, err = strconv.ParseUint(value, 10, 64)
+		default:
+			return CallBudget{}, fmt.Errorf("unknown call budget field %q", name)
+		}
+		if err != nil {
+			return CallBudget{}, fmt.Errorf("invalid call budget field %q: %w", field, err)
+		}
+	}
+	return budget, nil
+}
+
+// Raise returns the budget with the fields raised to the requested ones, but not above the ceiling. A field is never
+// lowered, and can not be raised if it is not limited by the ceiling
+func (b CallBudget) Raise(requested, ceiling CallBudget) CallBudget {
+	raise := func(current, requested, ceiling uint64) uint64 {
+		if current == 0 || requested <= current || ceiling <= current {
+			return current
+		}
+		if requested > ceiling {
+			return ceiling
+		}
+		return requested
+	}
+	return CallBudget{
+		GasCap:    raise(b.GasCap, requested.GasCap, ceiling.GasCap),
+		Timeout:   time.Duration(raise(uint64(b.Timeout), uint64(requested.Timeout), uint64(ceiling.Timeout))),
+		MaxMemory: raise(b.MaxMemory, requested.MaxMemory, ceiling.MaxMemory),
+	}
+}
 
 func DoCall(
 	ctx context.Context,
 	args ethapi.CallArgs,
 	tx kv.Tx, blockNrOrHash rpc.BlockNumberOrHash,
 	block *types.Block, overrides *ethapi.StateOverrides,
-	gasCap uint64,
+	blockOverrides *ethapi.BlockOverrides,
+	budget CallBudget,
 	chainConfig *params.ChainConfig,
-	filters *rpchelper.Filters,
-	stateCache kvcache.Cache,
+	stateReader state.StateReader,
 	contractHasTEVM func(hash common.Hash) (bool, error),
 	headerReader services.HeaderReader,
 ) (*core.ExecutionResult, error) {
@@ -43,10 +100,6 @@ func DoCall(
 			return state, block.Header(), nil
 		}
 	*/
-	stateReader, err := rpchelper.CreateStateReader(ctx, tx, blockNrOrHash, filters, stateCache)
-	if err != nil {
-		return nil, err
-	}
 	state := state.New(stateReader)
 
 	header := block.Header()
@@ -62,8 +115,8 @@ func DoCall(
 	// Setup context so it may be cancelled the call has completed
 	// or, in case of unmetered gas, setup a context with a timeout.
 	var cancel context.CancelFunc
-	if callTimeout > 0 {
-		ctx, cancel = context.WithTimeout(ctx, callTimeout)
+	if budget.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, budget.Timeout)
 	} else {
 		ctx, cancel = context.WithCancel(ctx)
 	}
@@ -81,13 +134,25 @@ func DoCall(
 			return nil, fmt.Errorf("header.BaseFee uint256 overflow")
 		}
 	}
-	msg, err := args.ToMessage(gasCap, baseFee)
+	if blockOverrides != nil && blockOverrides.BaseFee != nil {
+		var overflow bool
+		baseFee, overflow = uint256.FromBig(blockOverrides.BaseFee.ToInt())
+		if overflow {
+			return nil, fmt.Errorf("blockOverrides.BaseFee uint256 overflow")
+		}
+	}
+	msg, err := args.ToMessage(budget.GasCap, baseFee)
 	if err != nil {
 		return nil, err
 	}
 	blockCtx, txCtx := GetEvmContext(msg, header, blockNrOrHash.RequireCanonical, tx, contractHasTEVM, headerReader)
+	if blockOverrides != nil {
+		if err := blockOverrides.Override(&blockCtx); err != nil {
+			return nil, err
+		}
+	}
 
-	evm := vm.NewEVM(blockCtx, txCtx, state, chainConfig, vm.Config{NoBaseFee: true})
+	evm := vm.NewEVM(blockCtx, txCtx, state, chainConfig, vm.Config{NoBaseFee: true, MaxMemory: budget.MaxMemory})
 
 	// Wait for the context to be done and cancel the evm. Even if the
 	// EVM has finished, cancelling may be done (repeatedly)
@@ -104,7 +169,7 @@ func DoCall(
 
 	// If the timer caused an abort, return an appropriate error message
 	if evm.Cancelled() {
-		return nil, fmt.Errorf("execution aborted (timeout = %v)", callTimeout)
+		return nil, fmt.Errorf("execution aborted (timeout = %v)", budget.Timeout)
 	}
 	return result, nil
 }
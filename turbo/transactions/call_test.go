@@ -0,0 +1,27 @@
+package transactions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallBudget(t *testing.T) {
+	requested, err := ParseCallBudget("gas=100000000, timeout=1m,memory=1024")
+	require.NoError(t, err)
+	require.Equal(t, CallBudget{GasCap: 100000000, Timeout: time.Minute, MaxMemory: 1024}, requested)
+	_, err = ParseCallBudget("gas=1,depth=2")
+	require.Error(t, err)
+	_, err = ParseCallBudget("timeout")
+	require.Error(t, err)
+
+	budget := CallBudget{GasCap: 50000000, Timeout: 5 * time.Second}
+	ceiling := CallBudget{GasCap: 80000000, Timeout: 30 * time.Minute, MaxMemory: 4096}
+	// raised up to the ceiling, the memory is not limited already
+	require.Equal(t, CallBudget{GasCap: 80000000, Timeout: time.Minute}, budget.Raise(requested, ceiling))
+	// never lowered
+	require.Equal(t, budget, budget.Raise(CallBudget{GasCap: 1, Timeout: time.Millisecond}, ceiling))
+	// not raised without the ceiling
+	require.Equal(t, budget, budget.Raise(requested, CallBudget{}))
+}
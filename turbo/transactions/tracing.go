@@ -34,10 +34,20 @@ type BlockGetter interface {
 func ComputeTxEnv(ctx context.Context, block *types.Block, cfg *params.ChainConfig, getHeader func(hash common.Hash, number uint64) *types.Header, contractHasTEVM func(common.Hash) (bool, error), engine consensus.Engine, dbtx kv.Tx, blockHash common.Hash, txIndex uint64) (core.Message, vm.BlockContext, vm.TxContext, *state.IntraBlockState, *state.PlainState, error) {
 	// Create the parent state database
 	reader := state.NewPlainState(dbtx, block.NumberU64())
+	msg, blockCtx, txCtx, statedb, err := ComputeTxEnvWithState(ctx, block, cfg, getHeader, contractHasTEVM, engine, reader, reader, blockHash, txIndex)
+	if err != nil {
+		return nil, vm.BlockContext{}, vm.TxContext{}, nil, nil, err
+	}
+	return msg, blockCtx, txCtx, statedb, reader, nil
+}
+
+// ComputeTxEnvWithState is ComputeTxEnv over the given state at the beginning of the block, e.g. read from the
+// history files. The changes of the transactions before txIndex are finalized to writer
+func ComputeTxEnvWithState(ctx context.Context, block *types.Block, cfg *params.ChainConfig, getHeader func(hash common.Hash, number uint64) *types.Header, contractHasTEVM func(common.Hash) (bool, error), engine consensus.Engine, reader state.StateReader, writer state.StateWriter, blockHash common.Hash, txIndex uint64) (core.Message, vm.BlockContext, vm.TxContext, *state.IntraBlockState, error) {
 	statedb := state.New(reader)
 
 	if txIndex == 0 && len(block.Transactions()) == 0 {
-		return nil, vm.BlockContext{}, vm.TxContext{}, statedb, reader, nil
+		return nil, vm.BlockContext{}, vm.TxContext{}, statedb, nil
 	}
 	// Recompute transactions up to the target index.
 	signer := types.MakeSigner(cfg, block.NumberU64())
@@ -50,7 +60,7 @@ func ComputeTxEnv(ctx context.Context, block *types.Block, cfg *params.ChainConf
 		select {
 		default:
 		case <-ctx.Done():
-			return nil, vm.BlockContext{}, vm.TxContext{}, nil, nil, ctx.Err()
+			return nil, vm.BlockContext{}, vm.TxContext{}, nil, ctx.Err()
 		}
 		statedb.Prepare(tx.Hash(), blockHash, idx)
 
@@ -58,23 +68,23 @@ func ComputeTxEnv(ctx context.Context, block *types.Block, cfg *params.ChainConf
 		msg, _ := tx.AsMessage(*signer, block.BaseFee(), rules)
 		TxContext := core.NewEVMTxContext(msg)
 		if idx == int(txIndex) {
-			return msg, BlockContext, TxContext, statedb, reader, nil
+			return msg, BlockContext, TxContext, statedb, nil
 		}
 		vmenv.Reset(TxContext, statedb)
 		// Not yet the searched for transaction, execute on top of the current state
 		if _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(tx.GetGas()), true /* refunds */, false /* gasBailout */); err != nil {
-			return nil, vm.BlockContext{}, vm.TxContext{}, nil, nil, fmt.Errorf("transaction %x failed: %w", tx.Hash(), err)
+			return nil, vm.BlockContext{}, vm.TxContext{}, nil, fmt.Errorf("transaction %x failed: %w", tx.Hash(), err)
 		}
 		// Ensure any modifications are committed to the state
 		// Only delete empty objects if EIP161 (part of Spurious Dragon) is in effect
-		_ = statedb.FinalizeTx(rules, reader)
+		_ = statedb.FinalizeTx(rules, writer)
 
 		if idx+1 == len(block.Transactions()) {
 			// Return the state from evaluating all txs in the block, note no msg or TxContext in this case
-			return nil, BlockContext, vm.TxContext{}, statedb, reader, nil
+			return nil, BlockContext, vm.TxContext{}, statedb, nil
 		}
 	}
-	return nil, vm.BlockContext{}, vm.TxContext{}, nil, nil, fmt.Errorf("transaction index %d out of range for block %x", txIndex, blockHash)
+	return nil, vm.BlockContext{}, vm.TxContext{}, nil, fmt.Errorf("transaction index %d out of range for block %x", txIndex, blockHash)
 }
 
 // TraceTx configures a new tracer according to the provided configuration, and
@@ -99,25 +109,31 @@ func TraceTx(
 	switch {
 	case config != nil && config.Tracer != nil:
 		// Define a meaningful timeout of a single transaction trace
-		timeout := callTimeout
+		timeout := DefaultCallTimeout
 		if config.Timeout != nil {
 			if timeout, err = time.ParseDuration(*config.Timeout); err != nil {
 				stream.WriteNil()
 				return err
 			}
 		}
-		// Construct the JavaScript tracer to execute with
-		if tracer, err = tracers.New(*config.Tracer, &tracers.Context{
-			TxHash: txCtx.TxHash,
-		}); err != nil {
+		// Construct the JavaScript tracer, or the combination of the built-in ones, to execute with
+		var jsTracer tracers.ResultTracer
+		if *config.Tracer == tracers.MuxTracerName {
+			jsTracer, err = tracers.NewMux(config.TracerConfig, &tracers.Context{TxHash: txCtx.TxHash})
+		} else {
+			jsTracer, err = tracers.New(*config.Tracer, &tracers.Context{TxHash: txCtx.TxHash})
+		}
+		if err != nil {
 			stream.WriteNil()
 			return err
 		}
+		jsTracer.SetOpBudget(config.OpBudget)
+		tracer = jsTracer
 		// Handle timeouts and RPC cancellations
 		deadlineCtx, cancel := context.WithTimeout(ctx, timeout)
 		go func() {
 			<-deadlineCtx.Done()
-			tracer.(*tracers.Tracer).Stop(errors.New("execution timeout"))
+			tracer.(tracers.ResultTracer).Stop(errors.New("execution timeout"))
 		}()
 		defer cancel()
 		streaming = false
@@ -168,7 +184,7 @@ func TraceTx(
 		stream.WriteString(returnVal)
 		stream.WriteObjectEnd()
 	} else {
-		if r, err1 := tracer.(*tracers.Tracer).GetResult(); err1 == nil {
+		if r, err1 := tracer.(tracers.ResultTracer).GetResult(); err1 == nil {
 			stream.Write(r)
 		} else {
 			return err1
@@ -122,6 +122,10 @@ type RootHashAggregator struct {
 	a              accounts.Account
 	leafData       GenStructStepLeafData
 	accData        GenStructStepAccountData
+	// Optional, nodes on the paths to its keys are built instead of hashed, see FlatDBTrieLoader.SetProofRetainer
+	proofRetain RetainDecider
+	proofRoot   node
+	proofPrefix []byte
 }
 
 type StreamReceiver interface {
@@ -173,6 +177,23 @@ func (l *FlatDBTrieLoader) SetStreamReceiver(receiver StreamReceiver) {
 	l.receiver = receiver
 }
 
+// SetProofRetainer makes CalcTrieRoot build the nodes on the paths to the keys of rd (account keys, and storage keys
+// with the incarnation), so that ProofTrie can prove them. The keys also need to be retained by the RetainDecider
+// passed to Reset, otherwise their paths are replaced by the intermediate hashes. Needs to be called after Reset
+func (l *FlatDBTrieLoader) SetProofRetainer(rd RetainDecider) {
+	l.defaultReceiver.proofRetain = rd
+}
+
+// ProofTrie returns the trie of the last CalcTrieRoot, with the nodes on the paths set by SetProofRetainer and the
+// hashes of the rest of the nodes
+func (l *FlatDBTrieLoader) ProofTrie() *Trie {
+	t := New(l.defaultReceiver.root)
+	if l.defaultReceiver.proofRoot != nil {
+		t.root = l.defaultReceiver.proofRoot
+	}
+	return t
+}
+
 // CalcTrieRoot algo:
 //
 //		for iterateIHOfAccounts {
@@ -327,6 +348,23 @@ func (r *RootHashAggregator) RetainNothing(_ []byte) bool {
 	return false
 }
 
+func (r *RootHashAggregator) retainAccount(prefix []byte) bool {
+	return r.proofRetain != nil && r.proofRetain.Retain(prefix)
+}
+
+// retainStorage is called with the prefix of the storage key, without the account and the incarnation
+func (r *RootHashAggregator) retainStorage(prefix []byte) bool {
+	if r.proofRetain == nil {
+		return false
+	}
+	r.proofPrefix = r.proofPrefix[:0]
+	for _, b := range r.currAccK {
+		r.proofPrefix = append(r.proofPrefix, b/16, b%16)
+	}
+	r.proofPrefix = append(r.proofPrefix, prefix...)
+	return r.proofRetain.Retain(r.proofPrefix)
+}
+
 func (r *RootHashAggregator) Reset(hc HashCollector2, shc StorageHashCollector2, trace bool) {
 	r.hc = hc
 	r.shc = shc
@@ -346,6 +384,8 @@ func (r *RootHashAggregator) Reset(hc HashCollector2, shc StorageHashCollector2,
 	r.root = common.Hash{}
 	r.trace = trace
 	r.hb.trace = trace
+	r.proofRetain = nil
+	r.proofRoot = nil
 }
 
 func (r *RootHashAggregator) Receive(itemType StreamItem,
@@ -493,6 +533,9 @@ func (r *RootHashAggregator) Receive(itemType StreamItem,
 		}
 		if r.hb.hasRoot() {
 			r.root = r.hb.rootHash()
+			if r.proofRetain != nil {
+				r.proofRoot = r.hb.root()
+			}
 		} else {
 			r.root = EmptyRoot
 		}
@@ -563,7 +606,7 @@ func (r *RootHashAggregator) genStructStorage() error {
 		r.leafData.Value = rlphacks.RlpSerializableBytes(r.valueStorage)
 		data = &r.leafData
 	}
-	r.groupsStorage, r.hasTreeStorage, r.hasHashStorage, err = GenStructStep(r.RetainNothing, r.currStorage.Bytes(), r.succStorage.Bytes(), r.hb, func(keyHex []byte, hasState, hasTree, hasHash uint16, hashes, rootHash []byte) error {
+	r.groupsStorage, r.hasTreeStorage, r.hasHashStorage, err = GenStructStep(r.retainStorage, r.currStorage.Bytes(), r.succStorage.Bytes(), r.hb, func(keyHex []byte, hasState, hasTree, hasHash uint16, hashes, rootHash []byte) error {
 		if r.shc == nil {
 			return nil
 		}
@@ -631,7 +674,7 @@ func (r *RootHashAggregator) genStructAccount() error {
 	r.currStorage.Reset()
 	r.succStorage.Reset()
 	var err error
-	if r.groups, r.hasTree, r.hasHash, err = GenStructStep(r.RetainNothing, r.curr.Bytes(), r.succ.Bytes(), r.hb, func(keyHex []byte, hasState, hasTree, hasHash uint16, hashes, rootHash []byte) error {
+	if r.groups, r.hasTree, r.hasHash, err = GenStructStep(r.retainAccount, r.curr.Bytes(), r.succ.Bytes(), r.hb, func(keyHex []byte, hasState, hasTree, hasHash uint16, hashes, rootHash []byte) error {
 		if r.hc == nil {
 			return nil
 		}